@@ -3,6 +3,7 @@ module github.com/rama-kairi/go-term
 go 1.25.0
 
 require (
+	github.com/creack/pty v1.1.24
 	github.com/google/jsonschema-go v0.2.1-0.20250825175020-748c325cec76
 	github.com/google/uuid v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.32
@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -32,6 +33,9 @@ type Config struct {
 
 	// Monitoring configuration
 	Monitoring MonitoringConfig `json:"monitoring"`
+
+	// File the configuration was loaded from (not persisted)
+	SourceFile string `json:"-"`
 }
 
 // ServerConfig holds server-specific configuration
@@ -50,15 +54,38 @@ type SessionConfig struct {
 	MaxOutputSize            int           `json:"max_output_size"`
 	OutputChunkSize          int           `json:"output_chunk_size"` // H5: Chunk size for streaming output
 	WorkingDir               string        `json:"working_dir"`
+	WorkspaceSearchDepth     int           `json:"workspace_search_depth"` // Directories walked up when auto-detecting the workspace root
+	WorkspaceBoundaries      []string      `json:"workspace_boundaries"`   // Directories the workspace search never walks above (e.g. "$HOME")
 	Shell                    string        `json:"shell"`
 	EnableStreaming          bool          `json:"enable_streaming"`
 	MaxCommandsPerSession    int           `json:"max_commands_per_session"`
 	MaxBackgroundProcesses   int           `json:"max_background_processes"`
 	BackgroundProcessTimeout time.Duration `json:"background_process_timeout"` // H1: Configurable background timeout
 	BackgroundOutputLimit    int           `json:"background_output_limit"`
+	BackgroundOutputBuffer   int           `json:"background_output_buffer"`  // Lines queued between a background process and its output buffer
+	BackgroundDropPolicy     string        `json:"background_drop_policy"`    // When the queue is full: "block", "drop_oldest" or "drop_newest"
+	DefaultReadinessTimeout  time.Duration `json:"default_readiness_timeout"` // Wait for a readiness pattern when no timeout is given
+	DedupBackgroundOutput    bool          `json:"dedup_background_output"`   // Collapse consecutive identical lines as "<line> (xN)"
+	RestartMinUptime         time.Duration `json:"restart_min_uptime"`        // Auto-restart only processes that fail sooner than this (0 = any failure)
+	RecentCommandsLimit      int           `json:"recent_commands_limit"`     // Commands kept in each session's in-memory recent buffer (0 disables)
+	RecentCommandsMaxBytes   int           `json:"recent_commands_max_bytes"` // Total command + output bytes kept in the recent buffer (0 = no limit)
+	RunAsUser                string        `json:"run_as_user"`               // Run commands as this user (requires root); empty runs as the server's user
+	MaxFanOutConcurrency     int           `json:"max_fan_out_concurrency"`   // Upper bound on sessions a fan-out command runs in at once
+	MaxSequenceCommands      int           `json:"max_sequence_commands"`     // Most commands one run_commands call may run
+	TemplateCacheSize        int           `json:"template_cache_size"`       // Expanded command templates kept in an LRU cache (0 disables)
+	InferTemplateCategory    bool          `json:"infer_template_category"`   // Categorize templates added without a category from their command
 	ResourceCleanupInterval  time.Duration `json:"resource_cleanup_interval"`
-	RateLimitPerMinute       int           `json:"rate_limit_per_minute"` // H2: Rate limit for tool calls
-	RateLimitBurst           int           `json:"rate_limit_burst"`      // H2: Burst size for rate limiter
+	MaxCleanupPause          time.Duration `json:"max_cleanup_pause"`     // Longest the cleanup routines may be paused for bulk work (0 disables pausing)
+	RateLimitPerMinute       int           `json:"rate_limit_per_minute"` // H2: Rate limit for tool calls in each session
+	RateLimitBurst           int           `json:"rate_limit_burst"`      // H2: Burst size of each session's rate limiter
+
+	// Global rate limiting, an outer bound on calls across all sessions
+	GlobalRateLimitPerMinute int `json:"global_rate_limit_per_minute"` // Calls per minute across all sessions (0 disables)
+	GlobalRateLimitBurst     int `json:"global_rate_limit_burst"`      // Burst size of the global limiter
+
+	// Per-project rate limiting, checked in addition to the global limiter
+	ProjectRateLimitPerMinute int `json:"project_rate_limit_per_minute"` // Calls per minute for each project (0 disables)
+	ProjectRateLimitBurst     int `json:"project_rate_limit_burst"`      // Burst size for each project's limiter
 
 	// M6: Resource limits for background processes
 	MaxProcessMemoryMB   int64 `json:"max_process_memory_mb"`   // Maximum memory per process in MB (0 = no limit)
@@ -69,18 +96,33 @@ type SessionConfig struct {
 
 	// M7: Graceful termination settings
 	TerminationGracePeriod time.Duration `json:"termination_grace_period"` // Time to wait after SIGTERM before SIGKILL
+	UseTimeoutCommand      bool          `json:"use_timeout_command"`      // Wrap foreground commands with coreutils timeout when available
+	DaemonCommandHandling  string        `json:"daemon_command_handling"`  // Foreground commands that fork into the background: "warn", "reject" or "capture_pid"
+	ParseCdChains          bool          `json:"parse_cd_chains"`          // Follow every cd in "cd a && cd b" chains; false tracks only a leading cd
+	PersistentShell        bool          `json:"persistent_shell"`         // Run commands in the session's long-lived shell so shell state carries over
+	UniqueNames            bool          `json:"unique_names"`             // Suffix a new session's name ("build-2") when the project already has a session with it
+
+	// Idle timeout for foreground commands: stopped after producing no output for CommandIdleTimeout,
+	// however long they have run, up to CommandMaxTimeout
+	CommandIdleTimeout time.Duration `json:"command_idle_timeout"` // Default idle_timeout of run_command (0 keeps a fixed total timeout)
+	CommandMaxTimeout  time.Duration `json:"command_max_timeout"`  // Longest a command run with an idle timeout may take in total
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
-	Enable            bool          `json:"enable"`
-	Driver            string        `json:"driver"`
-	Path              string        `json:"path"`
-	DataDir           string        `json:"data_dir"`
-	MaxConnections    int           `json:"max_connections"`
-	ConnectionTimeout time.Duration `json:"connection_timeout"`
-	EnableWAL         bool          `json:"enable_wal"`
-	VacuumInterval    time.Duration `json:"vacuum_interval"`
+	Enable                bool          `json:"enable"`
+	Driver                string        `json:"driver"`
+	Path                  string        `json:"path"`
+	DataDir               string        `json:"data_dir"`
+	MaxConnections        int           `json:"max_connections"`
+	ConnectionTimeout     time.Duration `json:"connection_timeout"`
+	EnableWAL             bool          `json:"enable_wal"`
+	VacuumInterval        time.Duration `json:"vacuum_interval"`         // How often to VACUUM and ANALYZE the database to reclaim deleted space (0 disables)
+	CleanupOrphans        bool          `json:"cleanup_orphans"`         // Delete commands and stream chunks of missing sessions during periodic maintenance
+	WALCheckpointInterval time.Duration `json:"wal_checkpoint_interval"` // How often to checkpoint and truncate the SQLite WAL (0 disables)
+	SessionEvents         bool          `json:"session_events"`          // Persist session lifecycle events (created, closed, cleaned up) for auditing
+	SessionEventRetention time.Duration `json:"session_event_retention"` // How long session events are kept before they are pruned
+	OutputSearchWorkers   int           `json:"output_search_workers"`   // Goroutines that scan command outputs in parallel for search_command_output
 }
 
 // StreamingConfig holds streaming configuration
@@ -100,6 +142,53 @@ type SecurityConfig struct {
 	MaxProcesses         int      `json:"max_processes"`
 	MaxMemoryMB          int      `json:"max_memory_mb"`
 	MaxCPUPercent        int      `json:"max_cpu_percent"`
+	AllowedWorkingDirs   []string `json:"allowed_working_dirs"`  // Empty means any directory is allowed
+	LogDecisions         bool     `json:"log_decisions"`         // Log allowed commands as well as blocked ones
+	BlockedHistoryLimit  int      `json:"blocked_history_limit"` // Blocked attempts kept in the database audit history (0 disables)
+
+	// Dotenv imports normally only read files under the session's current directory
+	AllowAbsoluteEnvFiles bool `json:"allow_absolute_env_files"` // Also accept absolute paths (still subject to allowed_working_dirs)
+
+	// Commands made only of shell comments do nothing and are rejected like empty ones by default
+	AllowCommentOnlyCommands bool `json:"allow_comment_only_commands"` // Run comment-only commands instead of rejecting them
+
+	// Guard against sessions modifying the server's installation and data directories
+	ServerDirGuard string   `json:"server_dir_guard"` // "off", "warn" or "block" destructive commands
+	ProtectedPaths []string `json:"protected_paths"`  // Guarded in addition to the server's own directories
+}
+
+// IsWorkingDirAllowed reports whether path is inside one of the allowed working directories.
+// An empty allowlist allows every directory.
+func (s *SecurityConfig) IsWorkingDirAllowed(path string) bool {
+	if len(s.AllowedWorkingDirs) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.AllowedWorkingDirs {
+		if allowed != "" && IsWithinDir(path, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWithinDir reports whether path is root or inside it, after both are made absolute and
+// their symlinks resolved
+func IsWithinDir(path, root string) bool {
+	target := normalizeDirPath(path)
+	root = normalizeDirPath(root)
+	return target == root || strings.HasPrefix(target, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// normalizeDirPath returns an absolute, cleaned path with symlinks resolved when possible
+func normalizeDirPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Clean(path)
 }
 
 // LoggingConfig holds logging configuration
@@ -110,6 +199,10 @@ type LoggingConfig struct {
 	MaxSizeMB  int    `json:"max_size_mb"`
 	MaxBackups int    `json:"max_backups"`
 	MaxAgeDays int    `json:"max_age_days"`
+
+	// Echo command output to the log at debug level, redacted and truncated to TeeMaxBytes
+	TeeCommandOutput bool `json:"tee_command_output"`
+	TeeMaxBytes      int  `json:"tee_max_bytes"`
 }
 
 // MonitoringConfig holds monitoring configuration
@@ -118,6 +211,29 @@ type MonitoringConfig struct {
 	MetricsPort     int           `json:"metrics_port"`
 	HealthCheckPort int           `json:"health_check_port"`
 	StatsInterval   time.Duration `json:"stats_interval"`
+
+	// Goroutines above the startup baseline at which the health endpoint reports a leak
+	GoroutineDegradedIncrease  int `json:"goroutine_degraded_increase"`  // Reported as degraded
+	GoroutineUnhealthyIncrease int `json:"goroutine_unhealthy_increase"` // Reported as unhealthy
+
+	// Command completion webhook (disabled when URL is empty)
+	CommandWebhookURL     string        `json:"command_webhook_url"`
+	CommandWebhookTimeout time.Duration `json:"command_webhook_timeout"` // Per-request timeout
+	CommandWebhookRetries int           `json:"command_webhook_retries"` // Retries after a failed delivery
+
+	// Periodic export of session activity metrics as JSON lines (disabled when the file is empty)
+	ActivityMetricsFile       string        `json:"activity_metrics_file"`
+	ActivityMetricsInterval   time.Duration `json:"activity_metrics_interval"`    // Time between snapshots
+	ActivityMetricsMaxSizeMB  int           `json:"activity_metrics_max_size_mb"` // Rotate the file once it would grow past this
+	ActivityMetricsMaxBackups int           `json:"activity_metrics_max_backups"` // Rotated files kept as file.1, file.2, ...
+
+	// Export of trace spans to an OpenTelemetry collector over OTLP/HTTP (disabled when the endpoint is empty)
+	OTLPEndpoint      string            `json:"otlp_endpoint"`       // Collector base URL, e.g. http://localhost:4318; spans are sent to /v1/traces
+	OTLPHeaders       map[string]string `json:"otlp_headers"`        // Extra request headers, e.g. for collector authentication
+	OTLPTimeout       time.Duration     `json:"otlp_timeout"`        // Per-request timeout
+	OTLPBatchSize     int               `json:"otlp_batch_size"`     // Spans per export request
+	OTLPFlushInterval time.Duration     `json:"otlp_flush_interval"` // Longest an ended span waits before it is exported
+	OTLPMaxRetries    int               `json:"otlp_max_retries"`    // Retries after a failed export before its spans are dropped
 }
 
 // DefaultConfig returns a configuration with sensible defaults
@@ -140,15 +256,38 @@ func DefaultConfig() *Config {
 			MaxOutputSize:            5 * 1024 * 1024, // H5: Reduced to 5MB from 10MB
 			OutputChunkSize:          64 * 1024,       // H5: 64KB chunks for streaming
 			WorkingDir:               "",              // Use current directory
+			WorkspaceSearchDepth:     10,              // Walk up at most 10 directories
+			WorkspaceBoundaries:      []string{},      // Walk up to the filesystem root
 			Shell:                    "",              // Use system default
 			EnableStreaming:          true,            // Enable real-time streaming
 			MaxCommandsPerSession:    30,              // User requested: max 30 commands per session
 			MaxBackgroundProcesses:   3,               // User requested: max 3 background processes
 			BackgroundProcessTimeout: 4 * time.Hour,   // H1: Configurable, default 4 hours
 			BackgroundOutputLimit:    2000,            // Keep only latest 2000 characters of background output
+			BackgroundOutputBuffer:   100,             // Queue up to 100 lines per output stream
+			BackgroundDropPolicy:     "block",         // Slow the process down rather than lose output
+			DefaultReadinessTimeout:  30 * time.Second,
+			MaxCleanupPause:          30 * time.Minute,
+			DedupBackgroundOutput:    false,           // Raw output by default
+			RestartMinUptime:         0,               // Restart on any non-zero exit
+			RecentCommandsLimit:      50,              // Last 50 commands per session
+			RecentCommandsMaxBytes:   256 * 1024,      // 256KB of commands and output per session
+			RunAsUser:                "",              // Run commands as the server's own user
+			MaxFanOutConcurrency:     4,               // Fan-out runs in at most 4 sessions at once
+			MaxSequenceCommands:      50,              // run_commands runs at most 50 commands per call
+			TemplateCacheSize:        128,             // Cache the 128 most recent template expansions
+			InferTemplateCategory:    true,            // git, docker, npm, ... templates are categorized automatically
 			ResourceCleanupInterval:  1 * time.Minute, // Cleanup every minute
-			RateLimitPerMinute:       60,              // H2: 60 calls per minute
-			RateLimitBurst:           10,              // H2: Burst of 10 calls
+			RateLimitPerMinute:       60,              // H2: 60 calls per minute per session
+			RateLimitBurst:           10,              // H2: Burst of 10 calls per session
+
+			// No global bound by default; each session is limited on its own
+			GlobalRateLimitPerMinute: 0,
+			GlobalRateLimitBurst:     30,
+
+			// Per-project rate limiting is off by default
+			ProjectRateLimitPerMinute: 0,
+			ProjectRateLimitBurst:     10,
 
 			// M6: Resource limits for background processes
 			MaxProcessMemoryMB:   512,  // Default: 512MB per process
@@ -159,16 +298,29 @@ func DefaultConfig() *Config {
 
 			// M7: Graceful termination settings
 			TerminationGracePeriod: 5 * time.Second, // Wait 5 seconds after SIGTERM before SIGKILL
+			UseTimeoutCommand:      false,           // Use context-based kill by default
+			DaemonCommandHandling:  "warn",          // Run daemonizing commands but flag them in the result
+			ParseCdChains:          true,            // Track the directory through chained cd commands
+			PersistentShell:        false,           // Spawn a fresh shell per command by default
+			UniqueNames:            false,           // Allow duplicate session names for compatibility
+
+			CommandIdleTimeout: 0,                // Commands keep a fixed total timeout unless idle_timeout is given
+			CommandMaxTimeout:  30 * time.Minute, // Long enough for slow builds that keep printing progress
 		},
 		Database: DatabaseConfig{
-			Enable:            true,
-			Driver:            "sqlite3",
-			Path:              filepath.Join(configDir, "sessions.db"),
-			DataDir:           configDir,
-			MaxConnections:    10,
-			ConnectionTimeout: 5 * time.Second,
-			EnableWAL:         true,
-			VacuumInterval:    24 * time.Hour,
+			Enable:                true,
+			Driver:                "sqlite3",
+			Path:                  filepath.Join(configDir, "sessions.db"),
+			DataDir:               configDir,
+			MaxConnections:        10,
+			ConnectionTimeout:     5 * time.Second,
+			EnableWAL:             true,
+			VacuumInterval:        24 * time.Hour,
+			CleanupOrphans:        false,
+			WALCheckpointInterval: 5 * time.Minute,
+			SessionEvents:         true,
+			SessionEventRetention: 30 * 24 * time.Hour, // Keep a month of lifecycle events
+			OutputSearchWorkers:   4,
 		},
 		Streaming: StreamingConfig{
 			Enable:     true,
@@ -208,6 +360,16 @@ func DefaultConfig() *Config {
 			MaxProcesses:         20,   // Increased from 5
 			MaxMemoryMB:          2048, // Increased from 512
 			MaxCPUPercent:        80,   // Increased from 50
+			AllowedWorkingDirs:   []string{},
+			LogDecisions:         false,
+			BlockedHistoryLimit:  500, // Last 500 blocked attempts
+
+			AllowAbsoluteEnvFiles: false,
+
+			AllowCommentOnlyCommands: false,
+
+			ServerDirGuard: "warn",
+			ProtectedPaths: []string{},
 		},
 		Logging: LoggingConfig{
 			Level:      "info",
@@ -216,12 +378,34 @@ func DefaultConfig() *Config {
 			MaxSizeMB:  100,
 			MaxBackups: 3,
 			MaxAgeDays: 30,
+
+			TeeCommandOutput: false, // Only command metadata is logged by default
+			TeeMaxBytes:      4096,
 		},
 		Monitoring: MonitoringConfig{
 			EnableMetrics:   false,
 			MetricsPort:     9090,
 			HealthCheckPort: 8080,
 			StatsInterval:   30 * time.Second,
+
+			GoroutineDegradedIncrease:  100,
+			GoroutineUnhealthyIncrease: 1000,
+
+			CommandWebhookURL:     "",
+			CommandWebhookTimeout: 5 * time.Second,
+			CommandWebhookRetries: 3,
+
+			ActivityMetricsFile:       "",
+			ActivityMetricsInterval:   5 * time.Minute,
+			ActivityMetricsMaxSizeMB:  10,
+			ActivityMetricsMaxBackups: 3,
+
+			OTLPEndpoint:      "",
+			OTLPHeaders:       map[string]string{},
+			OTLPTimeout:       10 * time.Second,
+			OTLPBatchSize:     128,
+			OTLPFlushInterval: 5 * time.Second,
+			OTLPMaxRetries:    3,
 		},
 	}
 }
@@ -264,6 +448,8 @@ func LoadConfig(configFile string) (*Config, error) {
 		}
 	}
 
+	config.SourceFile = configFileToUse
+
 	// Override with environment variables
 	loadFromEnvironment(config)
 
@@ -297,6 +483,17 @@ func loadFromFile(config *Config, filename string) error {
 	return json.Unmarshal(data, config)
 }
 
+// LoadFile loads the defaults overlaid with a config file only, without environment overrides,
+// so callers can compare it against the running configuration
+func LoadFile(filename string) (*Config, error) {
+	config := DefaultConfig()
+	if err := loadFromFile(config, filename); err != nil {
+		return nil, err
+	}
+	config.SourceFile = filename
+	return config, nil
+}
+
 // loadFromEnvironment loads configuration from environment variables
 func loadFromEnvironment(config *Config) {
 	// Server configuration
@@ -327,6 +524,15 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_WORKING_DIR"); val != "" {
 		config.Session.WorkingDir = val
 	}
+	if val := os.Getenv("TERMINAL_MCP_WORKSPACE_SEARCH_DEPTH"); val != "" {
+		config.Session.WorkspaceSearchDepth = parseInt(val, config.Session.WorkspaceSearchDepth)
+	}
+	if val := os.Getenv("TERMINAL_MCP_WORKSPACE_BOUNDARIES"); val != "" {
+		config.Session.WorkspaceBoundaries = strings.Split(val, ",")
+		for i := range config.Session.WorkspaceBoundaries {
+			config.Session.WorkspaceBoundaries[i] = strings.TrimSpace(config.Session.WorkspaceBoundaries[i])
+		}
+	}
 	if val := os.Getenv("TERMINAL_MCP_SHELL"); val != "" {
 		config.Session.Shell = val
 	}
@@ -342,17 +548,75 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_BACKGROUND_OUTPUT_LIMIT"); val != "" {
 		config.Session.BackgroundOutputLimit = parseInt(val, config.Session.BackgroundOutputLimit)
 	}
+	if val := os.Getenv("TERMINAL_MCP_BACKGROUND_OUTPUT_BUFFER"); val != "" {
+		config.Session.BackgroundOutputBuffer = parseInt(val, config.Session.BackgroundOutputBuffer)
+	}
+	if val := os.Getenv("TERMINAL_MCP_BACKGROUND_DROP_POLICY"); val != "" {
+		config.Session.BackgroundDropPolicy = strings.ToLower(strings.TrimSpace(val))
+	}
+	if val := os.Getenv("TERMINAL_MCP_USE_TIMEOUT_COMMAND"); val != "" {
+		config.Session.UseTimeoutCommand = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_PARSE_CD_CHAINS"); val != "" {
+		config.Session.ParseCdChains = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_PERSISTENT_SHELL"); val != "" {
+		config.Session.PersistentShell = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_UNIQUE_SESSION_NAMES"); val != "" {
+		config.Session.UniqueNames = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_COMMAND_IDLE_TIMEOUT"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Session.CommandIdleTimeout = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_COMMAND_MAX_TIMEOUT"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Session.CommandMaxTimeout = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_DAEMON_COMMAND_HANDLING"); val != "" {
+		config.Session.DaemonCommandHandling = strings.ToLower(strings.TrimSpace(val))
+	}
+	if val := os.Getenv("TERMINAL_MCP_DEDUP_BACKGROUND_OUTPUT"); val != "" {
+		config.Session.DedupBackgroundOutput = parseBool(val)
+	}
 	if val := os.Getenv("TERMINAL_MCP_RESOURCE_CLEANUP_INTERVAL"); val != "" {
 		if duration, err := time.ParseDuration(val); err == nil {
 			config.Session.ResourceCleanupInterval = duration
 		}
 	}
+	if val := os.Getenv("TERMINAL_MCP_MAX_CLEANUP_PAUSE"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Session.MaxCleanupPause = duration
+		}
+	}
 	// New H1, H2, H5 environment variables
 	if val := os.Getenv("TERMINAL_MCP_BACKGROUND_PROCESS_TIMEOUT"); val != "" {
 		if duration, err := time.ParseDuration(val); err == nil {
 			config.Session.BackgroundProcessTimeout = duration
 		}
 	}
+	if val := os.Getenv("TERMINAL_MCP_DEFAULT_READINESS_TIMEOUT"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Session.DefaultReadinessTimeout = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_RESTART_MIN_UPTIME"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Session.RestartMinUptime = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_RECENT_COMMANDS_LIMIT"); val != "" {
+		config.Session.RecentCommandsLimit = parseInt(val, config.Session.RecentCommandsLimit)
+	}
+	if val := os.Getenv("TERMINAL_MCP_RECENT_COMMANDS_MAX_BYTES"); val != "" {
+		config.Session.RecentCommandsMaxBytes = parseInt(val, config.Session.RecentCommandsMaxBytes)
+	}
+	if val := os.Getenv("TERMINAL_MCP_RUN_AS_USER"); val != "" {
+		config.Session.RunAsUser = val
+	}
 	if val := os.Getenv("TERMINAL_MCP_OUTPUT_CHUNK_SIZE"); val != "" {
 		config.Session.OutputChunkSize = parseInt(val, config.Session.OutputChunkSize)
 	}
@@ -362,6 +626,30 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_RATE_LIMIT_BURST"); val != "" {
 		config.Session.RateLimitBurst = parseInt(val, config.Session.RateLimitBurst)
 	}
+	if val := os.Getenv("TERMINAL_MCP_GLOBAL_RATE_LIMIT_PER_MINUTE"); val != "" {
+		config.Session.GlobalRateLimitPerMinute = parseInt(val, config.Session.GlobalRateLimitPerMinute)
+	}
+	if val := os.Getenv("TERMINAL_MCP_GLOBAL_RATE_LIMIT_BURST"); val != "" {
+		config.Session.GlobalRateLimitBurst = parseInt(val, config.Session.GlobalRateLimitBurst)
+	}
+	if val := os.Getenv("TERMINAL_MCP_PROJECT_RATE_LIMIT_PER_MINUTE"); val != "" {
+		config.Session.ProjectRateLimitPerMinute = parseInt(val, config.Session.ProjectRateLimitPerMinute)
+	}
+	if val := os.Getenv("TERMINAL_MCP_PROJECT_RATE_LIMIT_BURST"); val != "" {
+		config.Session.ProjectRateLimitBurst = parseInt(val, config.Session.ProjectRateLimitBurst)
+	}
+	if val := os.Getenv("TERMINAL_MCP_MAX_FAN_OUT_CONCURRENCY"); val != "" {
+		config.Session.MaxFanOutConcurrency = parseInt(val, config.Session.MaxFanOutConcurrency)
+	}
+	if val := os.Getenv("TERMINAL_MCP_MAX_SEQUENCE_COMMANDS"); val != "" {
+		config.Session.MaxSequenceCommands = parseInt(val, config.Session.MaxSequenceCommands)
+	}
+	if val := os.Getenv("TERMINAL_MCP_TEMPLATE_CACHE_SIZE"); val != "" {
+		config.Session.TemplateCacheSize = parseInt(val, config.Session.TemplateCacheSize)
+	}
+	if val := os.Getenv("TERMINAL_MCP_INFER_TEMPLATE_CATEGORY"); val != "" {
+		config.Session.InferTemplateCategory = parseBool(val)
+	}
 
 	// Database configuration
 	if val := os.Getenv("TERMINAL_MCP_DATA_DIR"); val != "" {
@@ -378,6 +666,30 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_ENABLE_WAL"); val != "" {
 		config.Database.EnableWAL = parseBool(val)
 	}
+	if val := os.Getenv("TERMINAL_MCP_CLEANUP_ORPHANS"); val != "" {
+		config.Database.CleanupOrphans = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_VACUUM_INTERVAL"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Database.VacuumInterval = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_WAL_CHECKPOINT_INTERVAL"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Database.WALCheckpointInterval = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_SESSION_EVENTS"); val != "" {
+		config.Database.SessionEvents = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_SESSION_EVENT_RETENTION"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Database.SessionEventRetention = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_OUTPUT_SEARCH_WORKERS"); val != "" {
+		config.Database.OutputSearchWorkers = parseInt(val, config.Database.OutputSearchWorkers)
+	}
 
 	// Security configuration
 	if val := os.Getenv("TERMINAL_MCP_ENABLE_SANDBOX"); val != "" {
@@ -389,6 +701,33 @@ func loadFromEnvironment(config *Config) {
 			config.Security.BlockedCommands[i] = strings.TrimSpace(config.Security.BlockedCommands[i])
 		}
 	}
+	if val := os.Getenv("TERMINAL_MCP_ALLOWED_WORKING_DIRS"); val != "" {
+		config.Security.AllowedWorkingDirs = strings.Split(val, ",")
+		for i := range config.Security.AllowedWorkingDirs {
+			config.Security.AllowedWorkingDirs[i] = strings.TrimSpace(config.Security.AllowedWorkingDirs[i])
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_LOG_SECURITY_DECISIONS"); val != "" {
+		config.Security.LogDecisions = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_BLOCKED_HISTORY_LIMIT"); val != "" {
+		config.Security.BlockedHistoryLimit = parseInt(val, config.Security.BlockedHistoryLimit)
+	}
+	if val := os.Getenv("TERMINAL_MCP_ALLOW_ABSOLUTE_ENV_FILES"); val != "" {
+		config.Security.AllowAbsoluteEnvFiles = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_ALLOW_COMMENT_ONLY_COMMANDS"); val != "" {
+		config.Security.AllowCommentOnlyCommands = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_SERVER_DIR_GUARD"); val != "" {
+		config.Security.ServerDirGuard = strings.ToLower(strings.TrimSpace(val))
+	}
+	if val := os.Getenv("TERMINAL_MCP_PROTECTED_PATHS"); val != "" {
+		config.Security.ProtectedPaths = strings.Split(val, ",")
+		for i := range config.Security.ProtectedPaths {
+			config.Security.ProtectedPaths[i] = strings.TrimSpace(config.Security.ProtectedPaths[i])
+		}
+	}
 	if val := os.Getenv("TERMINAL_MCP_ALLOW_NETWORK"); val != "" {
 		config.Security.AllowNetworkAccess = parseBool(val)
 	}
@@ -415,6 +754,12 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_LOG_OUTPUT"); val != "" {
 		config.Logging.Output = val
 	}
+	if val := os.Getenv("TERMINAL_MCP_TEE_COMMAND_OUTPUT"); val != "" {
+		config.Logging.TeeCommandOutput = parseBool(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_TEE_MAX_BYTES"); val != "" {
+		config.Logging.TeeMaxBytes = parseInt(val, config.Logging.TeeMaxBytes)
+	}
 
 	// Monitoring configuration
 	if val := os.Getenv("TERMINAL_MCP_ENABLE_METRICS"); val != "" {
@@ -426,6 +771,59 @@ func loadFromEnvironment(config *Config) {
 	if val := os.Getenv("TERMINAL_MCP_HEALTH_PORT"); val != "" {
 		config.Monitoring.HealthCheckPort = parseInt(val, config.Monitoring.HealthCheckPort)
 	}
+	if val := os.Getenv("TERMINAL_MCP_GOROUTINE_DEGRADED_INCREASE"); val != "" {
+		config.Monitoring.GoroutineDegradedIncrease = parseInt(val, config.Monitoring.GoroutineDegradedIncrease)
+	}
+	if val := os.Getenv("TERMINAL_MCP_GOROUTINE_UNHEALTHY_INCREASE"); val != "" {
+		config.Monitoring.GoroutineUnhealthyIncrease = parseInt(val, config.Monitoring.GoroutineUnhealthyIncrease)
+	}
+	if val := os.Getenv("TERMINAL_MCP_COMMAND_WEBHOOK_URL"); val != "" {
+		config.Monitoring.CommandWebhookURL = val
+	}
+	if val := os.Getenv("TERMINAL_MCP_COMMAND_WEBHOOK_TIMEOUT"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Monitoring.CommandWebhookTimeout = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_COMMAND_WEBHOOK_RETRIES"); val != "" {
+		config.Monitoring.CommandWebhookRetries = parseInt(val, config.Monitoring.CommandWebhookRetries)
+	}
+	if val := os.Getenv("TERMINAL_MCP_ACTIVITY_METRICS_FILE"); val != "" {
+		config.Monitoring.ActivityMetricsFile = val
+	}
+	if val := os.Getenv("TERMINAL_MCP_ACTIVITY_METRICS_INTERVAL"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Monitoring.ActivityMetricsInterval = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_ACTIVITY_METRICS_MAX_SIZE_MB"); val != "" {
+		config.Monitoring.ActivityMetricsMaxSizeMB = parseInt(val, config.Monitoring.ActivityMetricsMaxSizeMB)
+	}
+	if val := os.Getenv("TERMINAL_MCP_ACTIVITY_METRICS_MAX_BACKUPS"); val != "" {
+		config.Monitoring.ActivityMetricsMaxBackups = parseInt(val, config.Monitoring.ActivityMetricsMaxBackups)
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_ENDPOINT"); val != "" {
+		config.Monitoring.OTLPEndpoint = val
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_HEADERS"); val != "" {
+		config.Monitoring.OTLPHeaders = parseHeaderList(val)
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_TIMEOUT"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Monitoring.OTLPTimeout = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_BATCH_SIZE"); val != "" {
+		config.Monitoring.OTLPBatchSize = parseInt(val, config.Monitoring.OTLPBatchSize)
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_FLUSH_INTERVAL"); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			config.Monitoring.OTLPFlushInterval = duration
+		}
+	}
+	if val := os.Getenv("TERMINAL_MCP_OTLP_MAX_RETRIES"); val != "" {
+		config.Monitoring.OTLPMaxRetries = parseInt(val, config.Monitoring.OTLPMaxRetries)
+	}
 }
 
 // validateConfig validates the configuration values
@@ -438,6 +836,10 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("default_timeout must be greater than 0")
 	}
 
+	if config.Session.WorkspaceSearchDepth <= 0 {
+		return fmt.Errorf("workspace_search_depth must be greater than 0")
+	}
+
 	if config.Session.MaxCommandLength <= 0 {
 		return fmt.Errorf("max_command_length must be greater than 0")
 	}
@@ -458,15 +860,58 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("background_output_limit must be greater than 0")
 	}
 
+	if config.Session.BackgroundOutputBuffer <= 0 {
+		return fmt.Errorf("background_output_buffer must be greater than 0")
+	}
+
+	switch config.Session.BackgroundDropPolicy {
+	case "block", "drop_oldest", "drop_newest":
+	default:
+		return fmt.Errorf("background_drop_policy must be one of block, drop_oldest, drop_newest (got %q)", config.Session.BackgroundDropPolicy)
+	}
+
+	switch config.Session.DaemonCommandHandling {
+	case "warn", "reject", "capture_pid":
+	default:
+		return fmt.Errorf("daemon_command_handling must be one of warn, reject, capture_pid (got %q)", config.Session.DaemonCommandHandling)
+	}
+
+	if config.Session.CommandIdleTimeout < 0 {
+		return fmt.Errorf("command_idle_timeout cannot be negative")
+	}
+	if config.Session.CommandMaxTimeout <= 0 {
+		return fmt.Errorf("command_max_timeout must be greater than 0")
+	}
+
 	if config.Session.ResourceCleanupInterval <= 0 {
 		return fmt.Errorf("resource_cleanup_interval must be greater than 0")
 	}
 
+	if config.Session.MaxCleanupPause < 0 {
+		return fmt.Errorf("max_cleanup_pause cannot be negative")
+	}
+
 	// H1: Validate background process timeout
 	if config.Session.BackgroundProcessTimeout <= 0 {
 		return fmt.Errorf("background_process_timeout must be greater than 0")
 	}
 
+	if config.Session.DefaultReadinessTimeout <= 0 {
+		return fmt.Errorf("default_readiness_timeout must be greater than 0")
+	}
+
+	if config.Session.RestartMinUptime < 0 {
+		return fmt.Errorf("restart_min_uptime cannot be negative")
+	}
+
+	if config.Session.RecentCommandsLimit < 0 {
+		return fmt.Errorf("recent_commands_limit cannot be negative")
+	}
+
+	if config.Session.RecentCommandsMaxBytes < 0 {
+		return fmt.Errorf("recent_commands_max_bytes cannot be negative")
+	}
+
 	// H5: Validate output chunk size
 	if config.Session.OutputChunkSize <= 0 {
 		return fmt.Errorf("output_chunk_size must be greater than 0")
@@ -479,6 +924,44 @@ func validateConfig(config *Config) error {
 	if config.Session.RateLimitBurst <= 0 {
 		return fmt.Errorf("rate_limit_burst must be greater than 0")
 	}
+	if config.Session.GlobalRateLimitPerMinute < 0 {
+		return fmt.Errorf("global_rate_limit_per_minute cannot be negative")
+	}
+	if config.Session.GlobalRateLimitPerMinute > 0 && config.Session.GlobalRateLimitBurst <= 0 {
+		return fmt.Errorf("global_rate_limit_burst must be greater than 0 when global rate limiting is enabled")
+	}
+	if config.Session.ProjectRateLimitPerMinute < 0 {
+		return fmt.Errorf("project_rate_limit_per_minute cannot be negative")
+	}
+	if config.Session.ProjectRateLimitPerMinute > 0 && config.Session.ProjectRateLimitBurst <= 0 {
+		return fmt.Errorf("project_rate_limit_burst must be greater than 0 when project rate limiting is enabled")
+	}
+
+	if config.Session.MaxFanOutConcurrency <= 0 {
+		return fmt.Errorf("max_fan_out_concurrency must be greater than 0")
+	}
+	if config.Session.MaxSequenceCommands <= 0 {
+		return fmt.Errorf("max_sequence_commands must be greater than 0")
+	}
+	if config.Session.TemplateCacheSize < 0 {
+		return fmt.Errorf("template_cache_size cannot be negative")
+	}
+
+	if config.Database.MaxConnections <= 0 {
+		return fmt.Errorf("max_connections must be greater than 0")
+	}
+	if config.Database.VacuumInterval < 0 {
+		return fmt.Errorf("vacuum_interval cannot be negative")
+	}
+	if config.Database.WALCheckpointInterval < 0 {
+		return fmt.Errorf("wal_checkpoint_interval cannot be negative")
+	}
+	if config.Database.SessionEvents && config.Database.SessionEventRetention <= 0 {
+		return fmt.Errorf("session_event_retention must be greater than 0 when session_events is enabled")
+	}
+	if config.Database.OutputSearchWorkers <= 0 {
+		return fmt.Errorf("output_search_workers must be greater than 0")
+	}
 
 	if config.Security.MaxProcesses <= 0 {
 		return fmt.Errorf("max_processes must be greater than 0")
@@ -492,6 +975,75 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("max_cpu_percent must be between 1 and 100")
 	}
 
+	if config.Security.BlockedHistoryLimit < 0 {
+		return fmt.Errorf("blocked_history_limit cannot be negative")
+	}
+
+	switch config.Security.ServerDirGuard {
+	case "off", "warn", "block":
+	default:
+		return fmt.Errorf("server_dir_guard must be one of off, warn, block (got %q)", config.Security.ServerDirGuard)
+	}
+
+	if config.Monitoring.EnableMetrics {
+		if config.Monitoring.MetricsPort <= 0 || config.Monitoring.MetricsPort > 65535 {
+			return fmt.Errorf("metrics_port must be between 1 and 65535")
+		}
+		if config.Monitoring.MetricsPort == config.Monitoring.HealthCheckPort {
+			return fmt.Errorf("metrics_port and health_check_port must differ when metrics are enabled")
+		}
+		if config.Monitoring.GoroutineDegradedIncrease <= 0 {
+			return fmt.Errorf("goroutine_degraded_increase must be greater than 0")
+		}
+		if config.Monitoring.GoroutineUnhealthyIncrease <= config.Monitoring.GoroutineDegradedIncrease {
+			return fmt.Errorf("goroutine_unhealthy_increase must be greater than goroutine_degraded_increase")
+		}
+	}
+
+	if config.Monitoring.CommandWebhookURL != "" {
+		u, err := url.Parse(config.Monitoring.CommandWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("command_webhook_url must be a valid http or https URL")
+		}
+		if config.Monitoring.CommandWebhookTimeout <= 0 {
+			return fmt.Errorf("command_webhook_timeout must be greater than 0")
+		}
+		if config.Monitoring.CommandWebhookRetries < 0 {
+			return fmt.Errorf("command_webhook_retries cannot be negative")
+		}
+	}
+
+	if config.Monitoring.OTLPEndpoint != "" {
+		u, err := url.Parse(config.Monitoring.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp_endpoint must be a valid http or https URL")
+		}
+		if config.Monitoring.OTLPTimeout <= 0 {
+			return fmt.Errorf("otlp_timeout must be greater than 0")
+		}
+		if config.Monitoring.OTLPBatchSize <= 0 {
+			return fmt.Errorf("otlp_batch_size must be greater than 0")
+		}
+		if config.Monitoring.OTLPFlushInterval <= 0 {
+			return fmt.Errorf("otlp_flush_interval must be greater than 0")
+		}
+		if config.Monitoring.OTLPMaxRetries < 0 {
+			return fmt.Errorf("otlp_max_retries cannot be negative")
+		}
+	}
+
+	if config.Monitoring.ActivityMetricsFile != "" {
+		if config.Monitoring.ActivityMetricsInterval <= 0 {
+			return fmt.Errorf("activity_metrics_interval must be greater than 0")
+		}
+		if config.Monitoring.ActivityMetricsMaxSizeMB <= 0 {
+			return fmt.Errorf("activity_metrics_max_size_mb must be greater than 0")
+		}
+		if config.Monitoring.ActivityMetricsMaxBackups < 0 {
+			return fmt.Errorf("activity_metrics_max_backups cannot be negative")
+		}
+	}
+
 	validLogLevels := map[string]bool{
 		"debug": true, "info": true, "warn": true, "error": true,
 	}
@@ -506,6 +1058,10 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid log format: %s", config.Logging.Format)
 	}
 
+	if config.Logging.TeeMaxBytes <= 0 {
+		return fmt.Errorf("tee_max_bytes must be greater than 0")
+	}
+
 	return nil
 }
 
@@ -522,6 +1078,20 @@ func parseInt(s string, defaultVal int) int {
 	return defaultVal
 }
 
+// parseHeaderList parses "key=value,key2=value2" into a header map, skipping malformed entries
+func parseHeaderList(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
 // SaveConfig saves the current configuration to a file
 func (c *Config) SaveToFile(filename string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -529,7 +1099,64 @@ func (c *Config) SaveToFile(filename string) error {
 		return err
 	}
 
-	return os.WriteFile(filename, data, 0o644)
+	return writeFileAtomic(filename, data)
+}
+
+// SaveSecurityToFile replaces the "security" section of an existing config file with security,
+// writing every other key back as it appears in the file rather than filling in defaults
+func SaveSecurityToFile(filename string, security SecurityConfig) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	if sections == nil {
+		sections = make(map[string]json.RawMessage)
+	}
+	if sections["security"], err = json.Marshal(security); err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(sections, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames it into place, so
+// a crash mid-write leaves the old file intact. An existing file keeps its permissions.
+func writeFileAtomic(filename string, data []byte) error {
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
 }
 
 // GetConfigDir returns the default configuration directory path
@@ -159,6 +159,29 @@ func TestHelperFunctions(t *testing.T) {
 	}
 }
 
+func TestOTLPConfig(t *testing.T) {
+	headers := parseHeaderList("authorization=Bearer a=b, x-team = infra,malformed,=empty")
+	if len(headers) != 2 || headers["authorization"] != "Bearer a=b" || headers["x-team"] != "infra" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	config := DefaultConfig()
+	config.Monitoring.OTLPEndpoint = "localhost:4318"
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for an endpoint without http or https scheme")
+	}
+
+	config.Monitoring.OTLPEndpoint = "http://localhost:4318"
+	if err := validateConfig(config); err != nil {
+		t.Errorf("Expected valid OTLP config, got %v", err)
+	}
+
+	config.Monitoring.OTLPBatchSize = 0
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for zero OTLP batch size")
+	}
+}
+
 func TestFileExists(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "file_exists_test")
 	if err != nil {
@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +23,9 @@ type DB struct {
 	conn *sql.DB
 	path string
 
+	// Serializes WAL checkpoints and vacuums so one never runs in the middle of the other
+	maintenanceMu sync.Mutex
+
 	// Health check caching to reduce overhead
 	lastHealthCheck  time.Time
 	healthCheckMutex sync.RWMutex
@@ -37,6 +44,8 @@ type SessionRecord struct {
 	LastUsedAt   time.Time `json:"last_used_at"`
 	IsActive     bool      `json:"is_active"`
 	CommandCount int       `json:"command_count"`
+
+	SecurityPolicy string `json:"security_policy,omitempty"` // JSON-encoded session security policy; empty when none
 }
 
 // CommandRecord represents a command execution record
@@ -59,12 +68,55 @@ type CommandRecord struct {
 type StreamChunk struct {
 	SessionID   string    `json:"session_id"`
 	CommandID   string    `json:"command_id"`
-	ChunkType   string    `json:"chunk_type"` // "stdout", "stderr", "status"
+	ChunkType   string    `json:"chunk_type"` // ChunkTypeStdout, ChunkTypeStderr or ChunkTypeStatus
 	Content     string    `json:"content"`
 	Timestamp   time.Time `json:"timestamp"`
 	SequenceNum int       `json:"sequence_num"`
 }
 
+// Stream chunk types. A status chunk is written last and holds the command's exit code as
+// "exit_code=N".
+const (
+	ChunkTypeStdout = "stdout"
+	ChunkTypeStderr = "stderr"
+	ChunkTypeStatus = "status"
+)
+
+// BlockedCommandRecord represents a command attempt rejected by the security policy
+type BlockedCommandRecord struct {
+	ID          int64     `json:"id"`
+	SessionID   string    `json:"session_id"`
+	Command     string    `json:"command"`
+	Source      string    `json:"source"` // Tool that rejected it, e.g. "run_command"
+	RuleType    string    `json:"rule_type"`
+	MatchedRule string    `json:"matched_rule"`
+	Reason      string    `json:"reason"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// SessionEventRecord is one session lifecycle event, such as a session being created or cleaned up
+type SessionEventRecord struct {
+	ID          int64                  `json:"id"`
+	SessionID   string                 `json:"session_id"`
+	SessionName string                 `json:"session_name"`
+	ProjectID   string                 `json:"project_id"`
+	Event       string                 `json:"event"`  // created, closed or cleaned_up
+	Reason      string                 `json:"reason"` // Why, e.g. "inactive_timeout" for a cleaned up session
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+// SessionEventFilter selects session events; zero fields do not filter
+type SessionEventFilter struct {
+	SessionID string
+	ProjectID string
+	Event     string
+	Reason    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
 // CommandResult represents a formatted command result for API responses
 type CommandResult struct {
 	ID          string `json:"id"`
@@ -79,10 +131,27 @@ type CommandResult struct {
 	WorkingDir  string `json:"working_dir"`
 	Timestamp   string `json:"timestamp"` // RFC3339 formatted string
 	Tags        string `json:"tags"`
+
+	RegexMatches []RegexMatch `json:"regex_matches,omitempty"` // Set by regex history searches
 }
 
-// NewDB creates a new database connection
+// ErrCommandNotFound is returned by GetCommand when no command has the requested ID
+var ErrCommandNotFound = errors.New("command not found")
+
+// defaultMaxOpenConns is the pool size used by NewDB
+const defaultMaxOpenConns = 10
+
+// NewDB creates a new database connection with the default pool size
 func NewDB(dbPath string) (*DB, error) {
+	return NewDBWithPool(dbPath, defaultMaxOpenConns)
+}
+
+// NewDBWithPool creates a new database connection that keeps at most maxOpenConns connections open
+func NewDBWithPool(dbPath string, maxOpenConns int) (*DB, error) {
+	if maxOpenConns <= 0 {
+		maxOpenConns = defaultMaxOpenConns
+	}
+
 	// Ensure the directory exists
 	dataDir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dataDir, 0o755); err != nil {
@@ -94,9 +163,9 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Configure connection pool
-	conn.SetMaxOpenConns(10)
-	conn.SetMaxIdleConns(5)
+	// Configure connection pool, keeping half the connections idle for reuse
+	conn.SetMaxOpenConns(maxOpenConns)
+	conn.SetMaxIdleConns(max(1, maxOpenConns/2))
 	conn.SetConnMaxLifetime(time.Hour)
 
 	db := &DB{
@@ -126,7 +195,8 @@ func (db *DB) initialize() error {
 		created_at DATETIME NOT NULL,
 		last_used_at DATETIME NOT NULL,
 		is_active BOOLEAN DEFAULT 1,
-		command_count INTEGER DEFAULT 0
+		command_count INTEGER DEFAULT 0,
+		security_policy TEXT DEFAULT ''
 	);
 
 	-- Commands table
@@ -159,6 +229,30 @@ func (db *DB) initialize() error {
 		FOREIGN KEY (command_id) REFERENCES commands(id) ON DELETE CASCADE
 	);
 
+	-- Blocked command attempts (security audit history)
+	CREATE TABLE IF NOT EXISTS blocked_commands (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		command TEXT NOT NULL,
+		source TEXT NOT NULL,
+		rule_type TEXT DEFAULT '',
+		matched_rule TEXT DEFAULT '',
+		reason TEXT DEFAULT '',
+		timestamp DATETIME NOT NULL
+	);
+
+	-- Session lifecycle events (audit trail that outlives the sessions themselves)
+	CREATE TABLE IF NOT EXISTS session_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		session_name TEXT DEFAULT '',
+		project_id TEXT DEFAULT '',
+		event TEXT NOT NULL,
+		reason TEXT DEFAULT '',
+		details TEXT DEFAULT '{}',
+		timestamp DATETIME NOT NULL
+	);
+
 	-- Indexes for better performance
 	CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id);
 	CREATE INDEX IF NOT EXISTS idx_sessions_last_used ON sessions(last_used_at);
@@ -167,9 +261,44 @@ func (db *DB) initialize() error {
 	CREATE INDEX IF NOT EXISTS idx_commands_timestamp ON commands(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_stream_chunks_command_id ON stream_chunks(command_id);
 	CREATE INDEX IF NOT EXISTS idx_stream_chunks_session_id ON stream_chunks(session_id);
+	CREATE INDEX IF NOT EXISTS idx_blocked_commands_session_id ON blocked_commands(session_id);
+	CREATE INDEX IF NOT EXISTS idx_session_events_session_id ON session_events(session_id);
+	CREATE INDEX IF NOT EXISTS idx_session_events_timestamp ON session_events(timestamp);
 	`
 
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	// Databases created before session security policies lack the column
+	return db.addColumnIfMissing("sessions", "security_policy", "TEXT DEFAULT ''")
+}
+
+// addColumnIfMissing adds a column to an existing table created by an older schema
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
@@ -181,6 +310,11 @@ func (db *DB) Close() error {
 	return nil
 }
 
+// PoolStats returns the connection pool statistics
+func (db *DB) PoolStats() sql.DBStats {
+	return db.conn.Stats()
+}
+
 // HealthCheck performs a simple database connectivity check
 func (db *DB) HealthCheck() error {
 	return db.HealthCheckContext(context.Background())
@@ -222,12 +356,12 @@ func (db *DB) CreateSessionContext(ctx context.Context, session *SessionRecord)
 	}
 
 	query := `
-	INSERT INTO sessions (id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO sessions (id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count, security_policy)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = db.conn.ExecContext(ctx, query, session.ID, session.Name, session.ProjectID, session.WorkingDir,
-		string(envJSON), session.CreatedAt, session.LastUsedAt, session.IsActive, session.CommandCount)
+		string(envJSON), session.CreatedAt, session.LastUsedAt, session.IsActive, session.CommandCount, session.SecurityPolicy)
 
 	return err
 }
@@ -240,7 +374,8 @@ func (db *DB) GetSession(sessionID string) (*SessionRecord, error) {
 // GetSessionContext retrieves a session by ID with context support (M3)
 func (db *DB) GetSessionContext(ctx context.Context, sessionID string) (*SessionRecord, error) {
 	query := `
-	SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count
+	SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count,
+		COALESCE(security_policy, '')
 	FROM sessions WHERE id = ?
 	`
 
@@ -250,7 +385,7 @@ func (db *DB) GetSessionContext(ctx context.Context, sessionID string) (*Session
 	var envJSON string
 
 	err := row.Scan(&session.ID, &session.Name, &session.ProjectID, &session.WorkingDir,
-		&envJSON, &session.CreatedAt, &session.LastUsedAt, &session.IsActive, &session.CommandCount)
+		&envJSON, &session.CreatedAt, &session.LastUsedAt, &session.IsActive, &session.CommandCount, &session.SecurityPolicy)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("session not found: %s", sessionID)
@@ -274,13 +409,15 @@ func (db *DB) ListSessionsContext(ctx context.Context, projectID string) ([]*Ses
 
 	if projectID != "" {
 		query = `
-		SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count
+		SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count,
+			COALESCE(security_policy, '')
 		FROM sessions WHERE project_id = ? ORDER BY last_used_at DESC
 		`
 		args = []interface{}{projectID}
 	} else {
 		query = `
-		SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count
+		SELECT id, name, project_id, working_dir, environment, created_at, last_used_at, is_active, command_count,
+			COALESCE(security_policy, '')
 		FROM sessions ORDER BY last_used_at DESC
 		`
 	}
@@ -298,7 +435,7 @@ func (db *DB) ListSessionsContext(ctx context.Context, projectID string) ([]*Ses
 		var envJSON string
 
 		err := rows.Scan(&session.ID, &session.Name, &session.ProjectID, &session.WorkingDir,
-			&envJSON, &session.CreatedAt, &session.LastUsedAt, &session.IsActive, &session.CommandCount)
+			&envJSON, &session.CreatedAt, &session.LastUsedAt, &session.IsActive, &session.CommandCount, &session.SecurityPolicy)
 		if err != nil {
 			return nil, err
 		}
@@ -358,11 +495,11 @@ func (db *DB) DeleteProjectSessions(projectID string) (int64, error) {
 
 // Command operations
 
-// CreateCommand creates a new command record
+// CreateCommand creates a new command record. Tags holds a JSON-encoded array; empty stores no tags.
 func (db *DB) CreateCommand(cmd *CommandRecord) error {
-	tagsJSON, err := json.Marshal([]string{})
-	if err != nil {
-		return fmt.Errorf("failed to marshal tags: %w", err)
+	tagsJSON := cmd.Tags
+	if tagsJSON == "" {
+		tagsJSON = "[]"
 	}
 
 	query := `
@@ -370,21 +507,42 @@ func (db *DB) CreateCommand(cmd *CommandRecord) error {
 	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = db.conn.Exec(query, cmd.ID, cmd.SessionID, cmd.ProjectID, cmd.Command, cmd.Output,
-		cmd.ErrorOutput, cmd.Success, cmd.ExitCode, cmd.Duration, cmd.WorkingDir, cmd.Timestamp, string(tagsJSON))
+	_, err := db.conn.Exec(query, cmd.ID, cmd.SessionID, cmd.ProjectID, cmd.Command, cmd.Output,
+		cmd.ErrorOutput, cmd.Success, cmd.ExitCode, cmd.Duration, cmd.WorkingDir, cmd.Timestamp, tagsJSON)
 
 	return err
 }
 
-// StoreCommand stores a command execution record
+// StoreCommand stores a command execution record without tags
 func (db *DB) StoreCommand(sessionID, projectID, command, output string, exitCode int, success bool, startTime, endTime time.Time, duration time.Duration, workingDir string) error {
+	return db.StoreCommandWithTags(sessionID, projectID, command, output, exitCode, success, startTime, endTime, duration, workingDir, nil)
+}
+
+// StoreCommandWithTags stores a command execution record labelled with tags, which are
+// normalized with NormalizeTags before being saved
+func (db *DB) StoreCommandWithTags(sessionID, projectID, command, output string, exitCode int, success bool, startTime, endTime time.Time, duration time.Duration, workingDir string, tags []string) error {
+	return db.StoreCommandWithID("", sessionID, projectID, command, output, exitCode, success, startTime, endTime, duration, workingDir, tags)
+}
+
+// StoreCommandWithID stores a command execution record under commandID, so records such as stream
+// chunks written while the command ran can refer to it. An empty commandID generates one.
+func (db *DB) StoreCommandWithID(commandID, sessionID, projectID, command, output string, exitCode int, success bool, startTime, endTime time.Time, duration time.Duration, workingDir string, tags []string) error {
 	// Check if database connection is still valid
 	if err := db.HealthCheck(); err != nil {
 		return fmt.Errorf("database not available: %w", err)
 	}
 
+	tagsJSON, err := json.Marshal(NormalizeTags(tags))
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	if commandID == "" {
+		commandID = uuid.New().String() // Use proper UUID to prevent collisions
+	}
+
 	cmd := &CommandRecord{
-		ID:         uuid.New().String(), // Use proper UUID to prevent collisions
+		ID:         commandID,
 		SessionID:  sessionID,
 		ProjectID:  projectID,
 		Command:    command,
@@ -394,18 +552,91 @@ func (db *DB) StoreCommand(sessionID, projectID, command, output string, exitCod
 		Duration:   duration.Milliseconds(),
 		WorkingDir: workingDir,
 		Timestamp:  startTime,
+		Tags:       string(tagsJSON),
 	}
 
 	return db.CreateCommand(cmd)
 }
 
+// NormalizeTags trims and lowercases tags, dropping empty and duplicate ones, and sorts the result.
+// It never returns nil, so the tags always encode as a JSON array.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
 // SearchCommands searches command history with various filters
-func (db *DB) SearchCommands(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, limit int) ([]*CommandRecord, error) {
+func (db *DB) SearchCommands(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string, limit int) ([]*CommandRecord, error) {
+	return db.SearchCommandsPage(sessionID, projectID, command, output, success, startTime, endTime, tags, limit, 0)
+}
+
+// SearchCommandsPage searches command history like SearchCommands, skipping the first offset
+// matches. Commands with the same timestamp are ordered by ID so pages do not overlap.
+func (db *DB) SearchCommandsPage(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string, limit, offset int) ([]*CommandRecord, error) {
+	query, args := commandSearchQuery(sessionID, projectID, command, output, success, startTime, endTime, tags, limit, offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []*CommandRecord
+
+	for rows.Next() {
+		cmd, err := scanCommandRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+
+	return commands, rows.Err()
+}
+
+// CountCommands returns how many commands SearchCommands would find with no limit
+func (db *DB) CountCommands(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string) (int, error) {
+	where, args := commandSearchFilters(sessionID, projectID, command, output, success, startTime, endTime, tags)
+
+	var count int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM commands WHERE 1=1"+where, args...).Scan(&count)
+	return count, err
+}
+
+// commandSearchQuery builds the SQL for SearchCommands, newest commands first with the ID as a
+// tiebreaker. A zero limit returns every match.
+func commandSearchQuery(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string, limit, offset int) (string, []interface{}) {
+	where, args := commandSearchFilters(sessionID, projectID, command, output, success, startTime, endTime, tags)
 	query := `
 	SELECT id, session_id, project_id, command, output, error_output, success, exit_code, duration_ms, working_dir, timestamp, tags
 	FROM commands WHERE 1=1
-	`
+	` + where + " ORDER BY timestamp DESC, id DESC"
+
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	} else if offset > 0 {
+		query += " LIMIT -1 OFFSET ?"
+		args = append(args, offset)
+	}
+
+	return query, args
+}
 
+// commandSearchFilters builds the conditions shared by commandSearchQuery and CountCommands. A
+// command must carry every one of tags; the stored JSON array is decoded by SQLite's json_each.
+func commandSearchFilters(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string) (string, []interface{}) {
+	var query string
 	var args []interface{}
 
 	if sessionID != "" {
@@ -443,36 +674,141 @@ func (db *DB) SearchCommands(sessionID, projectID, command, output string, succe
 		args = append(args, endTime)
 	}
 
-	query += " ORDER BY timestamp DESC"
+	for _, tag := range NormalizeTags(tags) {
+		query += " AND json_valid(tags) AND EXISTS (SELECT 1 FROM json_each(commands.tags) WHERE json_each.value = ?)"
+		args = append(args, tag)
+	}
 
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
+	return query, args
+}
+
+// scanCommandRecord reads one row selected by commandSearchQuery
+func scanCommandRecord(rows *sql.Rows) (*CommandRecord, error) {
+	var cmd CommandRecord
+	var tagsJSON string
+
+	err := rows.Scan(&cmd.ID, &cmd.SessionID, &cmd.ProjectID, &cmd.Command, &cmd.Output,
+		&cmd.ErrorOutput, &cmd.Success, &cmd.ExitCode, &cmd.Duration, &cmd.WorkingDir, &cmd.Timestamp, &tagsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Tags = tagsJSON
+	return &cmd, nil
+}
+
+// Regex search bounds: SQLite cannot evaluate Go regular expressions, so candidates are read with
+// the plain filters and matched in Go, scanning at most MaxRegexScanRows of the newest rows
+const (
+	MaxRegexScanRows     = 5000
+	maxRegexMatchOffsets = 20 // Matched substrings reported per field
+)
+
+// InvalidRegexError reports a search regex that does not compile
+type InvalidRegexError struct {
+	Field string // Argument the pattern was given as, e.g. "output_regex"
+	Err   error
+}
+
+func (e *InvalidRegexError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+}
+
+func (e *InvalidRegexError) Unwrap() error {
+	return e.Err
+}
+
+// RegexMatch records where a search regex matched one field of a command
+type RegexMatch struct {
+	Regex   string  `json:"regex"`   // "command_regex" or "output_regex"
+	Field   string  `json:"field"`   // "command", "output" or "error_output"
+	Offsets [][]int `json:"offsets"` // Byte offsets [start, end) of each matched substring
+}
+
+// RegexSearchStats describes how much history a regex search read
+type RegexSearchStats struct {
+	RowsScanned      int  `json:"rows_scanned"`
+	ScanLimitReached bool `json:"scan_limit_reached"` // Older commands were not examined
+}
+
+// CommandRegexMatch is a command found by SearchCommandsRegex with the positions each regex matched
+type CommandRegexMatch struct {
+	*CommandRecord
+	Matches []RegexMatch
+}
+
+// SearchCommandsRegex searches command history like SearchCommands and additionally requires the
+// command to match commandRegex and the output or error output to match outputRegex; empty
+// patterns are ignored. Rows are filtered as they are read, so only matches are held in memory.
+func (db *DB) SearchCommandsRegex(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string, commandRegex, outputRegex string, limit int) ([]*CommandRegexMatch, RegexSearchStats, error) {
+	var stats RegexSearchStats
+
+	var commandRe, outputRe *regexp.Regexp
+	if commandRegex != "" {
+		re, err := regexp.Compile(commandRegex)
+		if err != nil {
+			return nil, stats, &InvalidRegexError{Field: "command_regex", Err: err}
+		}
+		commandRe = re
+	}
+	if outputRegex != "" {
+		re, err := regexp.Compile(outputRegex)
+		if err != nil {
+			return nil, stats, &InvalidRegexError{Field: "output_regex", Err: err}
+		}
+		outputRe = re
 	}
 
+	query, args := commandSearchQuery(sessionID, projectID, command, output, success, startTime, endTime, tags, MaxRegexScanRows, 0)
 	rows, err := db.conn.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, stats, err
 	}
 	defer rows.Close()
 
-	var commands []*CommandRecord
-
+	var results []*CommandRegexMatch
+	full := false
 	for rows.Next() {
-		var cmd CommandRecord
-		var tagsJSON string
-
-		err := rows.Scan(&cmd.ID, &cmd.SessionID, &cmd.ProjectID, &cmd.Command, &cmd.Output,
-			&cmd.ErrorOutput, &cmd.Success, &cmd.ExitCode, &cmd.Duration, &cmd.WorkingDir, &cmd.Timestamp, &tagsJSON)
+		cmd, err := scanCommandRecord(rows)
 		if err != nil {
-			return nil, err
+			return nil, stats, err
+		}
+		stats.RowsScanned++
+
+		var matches []RegexMatch
+		if commandRe != nil {
+			offsets := commandRe.FindAllStringIndex(cmd.Command, maxRegexMatchOffsets)
+			if offsets == nil {
+				continue
+			}
+			matches = append(matches, RegexMatch{Regex: "command_regex", Field: "command", Offsets: offsets})
+		}
+		if outputRe != nil {
+			outputOffsets := outputRe.FindAllStringIndex(cmd.Output, maxRegexMatchOffsets)
+			errorOffsets := outputRe.FindAllStringIndex(cmd.ErrorOutput, maxRegexMatchOffsets)
+			if outputOffsets == nil && errorOffsets == nil {
+				continue
+			}
+			if outputOffsets != nil {
+				matches = append(matches, RegexMatch{Regex: "output_regex", Field: "output", Offsets: outputOffsets})
+			}
+			if errorOffsets != nil {
+				matches = append(matches, RegexMatch{Regex: "output_regex", Field: "error_output", Offsets: errorOffsets})
+			}
 		}
 
-		cmd.Tags = tagsJSON
-		commands = append(commands, &cmd)
+		results = append(results, &CommandRegexMatch{CommandRecord: cmd, Matches: matches})
+		if limit > 0 && len(results) >= limit {
+			full = true
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stats, err
 	}
 
-	return commands, rows.Err()
+	stats.ScanLimitReached = !full && stats.RowsScanned >= MaxRegexScanRows
+	return results, stats, nil
 }
 
 // ToCommandResult converts a CommandRecord to CommandResult with formatted timestamps
@@ -494,8 +830,8 @@ func (cmd *CommandRecord) ToCommandResult() *CommandResult {
 }
 
 // SearchCommandsFormatted searches command history and returns formatted results
-func (db *DB) SearchCommandsFormatted(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, limit int) ([]*CommandResult, error) {
-	records, err := db.SearchCommands(sessionID, projectID, command, output, success, startTime, endTime, limit)
+func (db *DB) SearchCommandsFormatted(sessionID, projectID, command, output string, success *bool, startTime, endTime time.Time, tags []string, limit int) ([]*CommandResult, error) {
+	records, err := db.SearchCommands(sessionID, projectID, command, output, success, startTime, endTime, tags, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -508,6 +844,95 @@ func (db *DB) SearchCommandsFormatted(sessionID, projectID, command, output stri
 	return results, nil
 }
 
+// GetLatestCommandCursor returns the cursor (SQLite rowid) of the most recently recorded command
+func (db *DB) GetLatestCommandCursor() (int64, error) {
+	var cursor int64
+	err := db.conn.QueryRow(`SELECT COALESCE(MAX(rowid), 0) FROM commands`).Scan(&cursor)
+	if err != nil {
+		return 0, err
+	}
+	return cursor, nil
+}
+
+// GetCommandsAfter returns commands recorded after the given cursor in insertion order,
+// along with the cursor of the last returned command (or the input cursor if none were found).
+// The rowid is used instead of the timestamp because timestamps record when a command started,
+// not when it was stored.
+func (db *DB) GetCommandsAfter(cursor int64, sessionID, projectID string, limit int) ([]*CommandRecord, int64, error) {
+	query := `
+	SELECT rowid, id, session_id, project_id, command, output, error_output, success, exit_code, duration_ms, working_dir, timestamp, tags
+	FROM commands WHERE rowid > ?
+	`
+
+	args := []interface{}{cursor}
+
+	if sessionID != "" {
+		query += " AND session_id = ?"
+		args = append(args, sessionID)
+	}
+
+	if projectID != "" {
+		query += " AND project_id = ?"
+		args = append(args, projectID)
+	}
+
+	query += " ORDER BY rowid ASC"
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer rows.Close()
+
+	var commands []*CommandRecord
+	lastCursor := cursor
+
+	for rows.Next() {
+		var cmd CommandRecord
+		var tagsJSON string
+		var rowID int64
+
+		err := rows.Scan(&rowID, &cmd.ID, &cmd.SessionID, &cmd.ProjectID, &cmd.Command, &cmd.Output,
+			&cmd.ErrorOutput, &cmd.Success, &cmd.ExitCode, &cmd.Duration, &cmd.WorkingDir, &cmd.Timestamp, &tagsJSON)
+		if err != nil {
+			return nil, cursor, err
+		}
+
+		cmd.Tags = tagsJSON
+		commands = append(commands, &cmd)
+		lastCursor = rowID
+	}
+
+	return commands, lastCursor, rows.Err()
+}
+
+// GetCommand retrieves a single command record by ID, including its full output
+func (db *DB) GetCommand(commandID string) (*CommandRecord, error) {
+	query := `
+	SELECT id, session_id, project_id, command, output, error_output, success, exit_code, duration_ms, working_dir, timestamp, tags
+	FROM commands WHERE id = ?
+	`
+
+	row := db.conn.QueryRow(query, commandID)
+
+	var cmd CommandRecord
+	err := row.Scan(&cmd.ID, &cmd.SessionID, &cmd.ProjectID, &cmd.Command, &cmd.Output,
+		&cmd.ErrorOutput, &cmd.Success, &cmd.ExitCode, &cmd.Duration, &cmd.WorkingDir, &cmd.Timestamp, &cmd.Tags)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrCommandNotFound, commandID)
+		}
+		return nil, err
+	}
+
+	return &cmd, nil
+}
+
 // Stream operations
 
 // CreateStreamChunk stores a real-time stream chunk
@@ -523,14 +948,66 @@ func (db *DB) CreateStreamChunk(chunk *StreamChunk) error {
 	return err
 }
 
+// StoreStreamChunk stores the next chunk of a running command's output, timestamped now
+func (db *DB) StoreStreamChunk(sessionID, commandID, chunkType, content string, sequenceNum int) error {
+	return db.CreateStreamChunk(&StreamChunk{
+		SessionID:   sessionID,
+		CommandID:   commandID,
+		ChunkType:   chunkType,
+		Content:     content,
+		Timestamp:   time.Now(),
+		SequenceNum: sequenceNum,
+	})
+}
+
+// StoreStreamChunks stores a batch of stream chunks in one transaction
+func (db *DB) StoreStreamChunks(chunks []*StreamChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO stream_chunks (session_id, command_id, chunk_type, content, timestamp, sequence_num)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare stream chunk insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, chunk := range chunks {
+		if _, err := stmt.Exec(chunk.SessionID, chunk.CommandID, chunk.ChunkType,
+			chunk.Content, chunk.Timestamp, chunk.SequenceNum); err != nil {
+			return fmt.Errorf("failed to store stream chunk %d: %w", chunk.SequenceNum, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stream chunks: %w", err)
+	}
+	return nil
+}
+
 // GetStreamChunks retrieves stream chunks for a command
 func (db *DB) GetStreamChunks(commandID string) ([]*StreamChunk, error) {
+	return db.GetStreamChunksAfter(commandID, 0)
+}
+
+// GetStreamChunksAfter retrieves a command's stream chunks with a sequence number above
+// afterSequence, in order, so a replay can resume where an earlier call stopped
+func (db *DB) GetStreamChunksAfter(commandID string, afterSequence int) ([]*StreamChunk, error) {
 	query := `
 	SELECT session_id, command_id, chunk_type, content, timestamp, sequence_num
-	FROM stream_chunks WHERE command_id = ? ORDER BY sequence_num
+	FROM stream_chunks WHERE command_id = ? AND sequence_num > ? ORDER BY sequence_num
 	`
 
-	rows, err := db.conn.Query(query, commandID)
+	rows, err := db.conn.Query(query, commandID, afterSequence)
 	if err != nil {
 		return nil, err
 	}
@@ -618,6 +1095,85 @@ func (db *DB) GetProjectStats(projectID string) (map[string]interface{}, error)
 	}, nil
 }
 
+// Time bucket sizes for GetSuccessRateTrend
+const (
+	TrendIntervalHourly = "hourly"
+	TrendIntervalDaily  = "daily"
+)
+
+// trendBucketFormats are the strftime patterns that truncate a timestamp to the start of its bucket (UTC)
+var trendBucketFormats = map[string]string{
+	TrendIntervalHourly: "%Y-%m-%d %H:00:00",
+	TrendIntervalDaily:  "%Y-%m-%d 00:00:00",
+}
+
+// SuccessRateBucket is the command success count for one time bucket
+type SuccessRateBucket struct {
+	Start       time.Time `json:"start"` // Bucket start, UTC
+	Total       int       `json:"total"`
+	Successful  int       `json:"successful"`
+	Failed      int       `json:"failed"`
+	SuccessRate float64   `json:"success_rate"` // 0..1
+}
+
+// GetSuccessRateTrend groups commands at or after since into hourly or daily buckets and returns
+// the success counts per bucket, oldest first. Buckets without commands are omitted.
+func (db *DB) GetSuccessRateTrend(sessionID, projectID, interval string, since time.Time) ([]*SuccessRateBucket, error) {
+	format, ok := trendBucketFormats[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown trend interval %q (use %s or %s)", interval, TrendIntervalHourly, TrendIntervalDaily)
+	}
+
+	query := `
+	SELECT
+		strftime(?, timestamp) as bucket,
+		COUNT(*) as total_commands,
+		SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) as successful_commands
+	FROM commands WHERE 1=1
+	`
+	args := []interface{}{format}
+
+	if sessionID != "" {
+		query += " AND session_id = ?"
+		args = append(args, sessionID)
+	}
+	if projectID != "" {
+		query += " AND project_id = ?"
+		args = append(args, projectID)
+	}
+	if !since.IsZero() {
+		// Compare as julian days so stored timestamps with different UTC offsets order correctly
+		query += " AND julianday(timestamp) >= julianday(?)"
+		args = append(args, since.UTC())
+	}
+	query += " GROUP BY bucket ORDER BY bucket ASC"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate success rate: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []*SuccessRateBucket
+	for rows.Next() {
+		var bucket string
+		entry := &SuccessRateBucket{}
+		if err := rows.Scan(&bucket, &entry.Total, &entry.Successful); err != nil {
+			return nil, fmt.Errorf("failed to scan success rate bucket: %w", err)
+		}
+		if entry.Start, err = time.Parse("2006-01-02 15:04:05", bucket); err != nil {
+			return nil, fmt.Errorf("failed to parse bucket %q: %w", bucket, err)
+		}
+		entry.Failed = entry.Total - entry.Successful
+		if entry.Total > 0 {
+			entry.SuccessRate = float64(entry.Successful) / float64(entry.Total)
+		}
+		buckets = append(buckets, entry)
+	}
+
+	return buckets, rows.Err()
+}
+
 // SessionWithStats represents a session with dynamically calculated statistics
 type SessionWithStats struct {
 	SessionRecord
@@ -631,14 +1187,14 @@ func (db *DB) GetSessionsWithStats() ([]*SessionWithStats, error) {
 	query := `
 	SELECT
 		s.id, s.name, s.project_id, s.working_dir, s.environment,
-		s.created_at, s.last_used_at, s.is_active,
+		s.created_at, s.last_used_at, s.is_active, COALESCE(s.security_policy, ''),
 		COALESCE(COUNT(c.id), 0) as command_count,
 		COALESCE(SUM(CASE WHEN c.success THEN 1 ELSE 0 END), 0) as success_count,
 		COALESCE(SUM(c.duration_ms), 0) as total_duration_ms
 	FROM sessions s
 	LEFT JOIN commands c ON s.id = c.session_id
 	GROUP BY s.id, s.name, s.project_id, s.working_dir, s.environment,
-			 s.created_at, s.last_used_at, s.is_active
+			 s.created_at, s.last_used_at, s.is_active, s.security_policy
 	ORDER BY s.last_used_at DESC
 	`
 
@@ -655,7 +1211,7 @@ func (db *DB) GetSessionsWithStats() ([]*SessionWithStats, error) {
 
 		err := rows.Scan(
 			&session.ID, &session.Name, &session.ProjectID, &session.WorkingDir, &session.Environment,
-			&session.CreatedAt, &session.LastUsedAt, &session.IsActive,
+			&session.CreatedAt, &session.LastUsedAt, &session.IsActive, &session.SecurityPolicy,
 			&session.CommandCount, &session.SuccessCount, &totalDurationMs,
 		)
 		if err != nil {
@@ -708,3 +1264,407 @@ func (db *DB) CleanupOldStreamChunks(maxAge time.Duration) (int64, error) {
 
 	return result.RowsAffected()
 }
+
+// OrphanedRecords counts command and stream chunk rows whose session no longer exists
+type OrphanedRecords struct {
+	Commands     int64    `json:"commands"`
+	StreamChunks int64    `json:"stream_chunks"`
+	SessionIDs   []string `json:"session_ids,omitempty"` // Missing sessions the orphans belong to (at most 100)
+}
+
+// orphanedCommandsWhere and orphanedChunksWhere select rows left behind when a session was removed
+// without the foreign key cascade, e.g. by an abnormal shutdown or with foreign keys disabled
+const (
+	orphanedCommandsWhere = `session_id NOT IN (SELECT id FROM sessions)`
+	orphanedChunksWhere   = `session_id NOT IN (SELECT id FROM sessions) OR command_id NOT IN (SELECT id FROM commands)`
+)
+
+// FindOrphanedRecords counts command and stream chunk rows that reference a missing session
+func (db *DB) FindOrphanedRecords() (*OrphanedRecords, error) {
+	orphans := &OrphanedRecords{}
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM commands WHERE ` + orphanedCommandsWhere).Scan(&orphans.Commands); err != nil {
+		return nil, fmt.Errorf("failed to count orphaned commands: %w", err)
+	}
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM stream_chunks WHERE ` + orphanedChunksWhere).Scan(&orphans.StreamChunks); err != nil {
+		return nil, fmt.Errorf("failed to count orphaned stream chunks: %w", err)
+	}
+
+	rows, err := db.conn.Query(`
+	SELECT session_id FROM commands WHERE ` + orphanedCommandsWhere + `
+	UNION
+	SELECT session_id FROM stream_chunks WHERE session_id NOT IN (SELECT id FROM sessions)
+	ORDER BY session_id LIMIT 100`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphaned sessions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan orphaned session: %w", err)
+		}
+		orphans.SessionIDs = append(orphans.SessionIDs, sessionID)
+	}
+
+	return orphans, rows.Err()
+}
+
+// DeleteOrphanedRecords removes command and stream chunk rows that reference a missing session
+// in one transaction, returning how many of each were deleted
+func (db *DB) DeleteOrphanedRecords() (*OrphanedRecords, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleted := &OrphanedRecords{}
+	// Commands go first so chunks of the removed commands are caught by the second delete
+	result, err := tx.Exec(`DELETE FROM commands WHERE ` + orphanedCommandsWhere)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete orphaned commands: %w", err)
+	}
+	if deleted.Commands, err = result.RowsAffected(); err != nil {
+		return nil, err
+	}
+
+	result, err = tx.Exec(`DELETE FROM stream_chunks WHERE ` + orphanedChunksWhere)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete orphaned stream chunks: %w", err)
+	}
+	if deleted.StreamChunks, err = result.RowsAffected(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit orphan cleanup: %w", err)
+	}
+	return deleted, nil
+}
+
+// WALCheckpoint reports the outcome of a WAL checkpoint
+type WALCheckpoint struct {
+	Busy               bool  `json:"busy"`                // Another connection kept the checkpoint from completing
+	LogFrames          int   `json:"log_frames"`          // Frames in the WAL when the checkpoint ran
+	CheckpointedFrames int   `json:"checkpointed_frames"` // Frames copied back into the database
+	SizeBeforeBytes    int64 `json:"size_before_bytes"`   // Size of the -wal file before the checkpoint
+	SizeAfterBytes     int64 `json:"size_after_bytes"`    // Size of the -wal file after the checkpoint
+}
+
+// CheckpointWAL copies the write-ahead log back into the database and truncates it with
+// PRAGMA wal_checkpoint(TRUNCATE), reporting the WAL size before and after. A truncated WAL reports
+// no frames, so a passive checkpoint runs first to count them.
+func (db *DB) CheckpointWAL(ctx context.Context) (*WALCheckpoint, error) {
+	db.maintenanceMu.Lock()
+	defer db.maintenanceMu.Unlock()
+
+	checkpoint := &WALCheckpoint{SizeBeforeBytes: db.walSize()}
+
+	var busy int
+	row := db.conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(PASSIVE)`)
+	if err := row.Scan(&busy, &checkpoint.LogFrames, &checkpoint.CheckpointedFrames); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+
+	var logFrames, checkpointedFrames int
+	row = db.conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	if err := row.Scan(&busy, &logFrames, &checkpointedFrames); err != nil {
+		return nil, fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	checkpoint.Busy = busy != 0
+	if checkpoint.Busy {
+		// The WAL was not reset, so these counts are current
+		checkpoint.LogFrames, checkpoint.CheckpointedFrames = logFrames, checkpointedFrames
+	}
+	checkpoint.SizeAfterBytes = db.walSize()
+
+	return checkpoint, nil
+}
+
+// walSize returns the size of the database's -wal file, or 0 when there is none
+func (db *DB) walSize() int64 {
+	info, err := os.Stat(db.path + "-wal")
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// VacuumResult reports the outcome of Vacuum
+type VacuumResult struct {
+	Skipped         bool   `json:"skipped"`
+	SkipReason      string `json:"skip_reason,omitempty"`
+	SizeBeforeBytes int64  `json:"size_before_bytes"` // Database and -wal file before VACUUM
+	SizeAfterBytes  int64  `json:"size_after_bytes"`  // Database and -wal file after VACUUM and a WAL truncate
+	ReclaimedBytes  int64  `json:"reclaimed_bytes"`
+	DurationMs      int64  `json:"duration_ms"`
+}
+
+// Vacuum rebuilds the database file with VACUUM to return space freed by deletes, refreshes the
+// query planner statistics with ANALYZE and truncates the WAL the rebuild went through. Rather
+// than wait, it skips when a WAL checkpoint is running, another connection is in use or SQLite
+// reports the database busy; Skipped says why.
+func (db *DB) Vacuum(ctx context.Context) (*VacuumResult, error) {
+	result := &VacuumResult{}
+	if !db.maintenanceMu.TryLock() {
+		result.Skipped, result.SkipReason = true, "a WAL checkpoint is in progress"
+		return result, nil
+	}
+	defer db.maintenanceMu.Unlock()
+
+	if inUse := db.conn.Stats().InUse; inUse > 0 {
+		result.Skipped, result.SkipReason = true, fmt.Sprintf("%d database connection(s) in use", inUse)
+		return result, nil
+	}
+
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a connection for VACUUM: %w", err)
+	}
+	defer conn.Close()
+
+	// Fail at once on a lock held by a writer instead of waiting out the pool's busy timeout
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 0"); err != nil {
+		return nil, fmt.Errorf("failed to set busy timeout: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA busy_timeout = 5000")
+
+	start := time.Now()
+	result.SizeBeforeBytes = db.fileSize() + db.walSize()
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		if isBusy(err) {
+			result.Skipped, result.SkipReason = true, "the database is busy"
+			return result, nil
+		}
+		return nil, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "ANALYZE"); err != nil && !isBusy(err) {
+		return nil, fmt.Errorf("failed to analyze database: %w", err)
+	}
+	// In WAL mode the rebuilt pages land in the WAL; the file only shrinks once they are copied back
+	var busy, logFrames, checkpointedFrames int
+	if err := conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointedFrames); err != nil && !isBusy(err) {
+		return nil, fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+
+	result.SizeAfterBytes = db.fileSize() + db.walSize()
+	result.ReclaimedBytes = result.SizeBeforeBytes - result.SizeAfterBytes
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// fileSize returns the size of the main database file, or 0 when it cannot be read
+func (db *DB) fileSize() int64 {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// isBusy reports whether err is SQLite refusing an operation because another connection holds a
+// lock. SQLITE_BUSY and SQLITE_LOCKED are matched by message, as the driver's error type only
+// exists in cgo builds.
+func isBusy(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
+}
+
+// RecordBlockedCommand stores a blocked command attempt and prunes the history down to the
+// newest maxRetained entries (0 means no limit)
+func (db *DB) RecordBlockedCommand(record *BlockedCommandRecord, maxRetained int) error {
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	query := `
+	INSERT INTO blocked_commands (session_id, command, source, rule_type, matched_rule, reason, timestamp)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.conn.Exec(query, record.SessionID, record.Command, record.Source,
+		record.RuleType, record.MatchedRule, record.Reason, record.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to record blocked command: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		record.ID = id
+	}
+
+	if maxRetained > 0 {
+		prune := `DELETE FROM blocked_commands WHERE id NOT IN (SELECT id FROM blocked_commands ORDER BY id DESC LIMIT ?)`
+		if _, err := db.conn.Exec(prune, maxRetained); err != nil {
+			return fmt.Errorf("failed to prune blocked command history: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetBlockedCommands returns blocked command attempts, newest first, optionally for one session
+func (db *DB) GetBlockedCommands(sessionID string, limit int) ([]*BlockedCommandRecord, error) {
+	query := `
+	SELECT id, session_id, command, source, rule_type, matched_rule, reason, timestamp
+	FROM blocked_commands WHERE 1=1
+	`
+
+	var args []interface{}
+	if sessionID != "" {
+		query += " AND session_id = ?"
+		args = append(args, sessionID)
+	}
+
+	query += " ORDER BY id DESC"
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*BlockedCommandRecord
+	for rows.Next() {
+		var record BlockedCommandRecord
+		if err := rows.Scan(&record.ID, &record.SessionID, &record.Command, &record.Source,
+			&record.RuleType, &record.MatchedRule, &record.Reason, &record.Timestamp); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+
+	return records, rows.Err()
+}
+
+// ClearBlockedCommands deletes blocked command history, optionally only for one session
+func (db *DB) ClearBlockedCommands(sessionID string) (int64, error) {
+	query := `DELETE FROM blocked_commands`
+	var args []interface{}
+	if sessionID != "" {
+		query += ` WHERE session_id = ?`
+		args = append(args, sessionID)
+	}
+
+	result, err := db.conn.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear blocked command history: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// RecordSessionEvent stores a session lifecycle event and prunes events older than retention
+// (0 means no pruning)
+// Timestamps are stored in UTC so that they compare correctly as text.
+func (db *DB) RecordSessionEvent(record *SessionEventRecord, retention time.Duration) error {
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	details := "{}"
+	if len(record.Details) > 0 {
+		data, err := json.Marshal(record.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode session event details: %w", err)
+		}
+		details = string(data)
+	}
+
+	query := `
+	INSERT INTO session_events (session_id, session_name, project_id, event, reason, details, timestamp)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.conn.Exec(query, record.SessionID, record.SessionName, record.ProjectID,
+		record.Event, record.Reason, details, record.Timestamp.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record session event: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		record.ID = id
+	}
+
+	if retention > 0 {
+		if _, err := db.PruneSessionEvents(time.Now().Add(-retention)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneSessionEvents deletes session events recorded before cutoff
+func (db *DB) PruneSessionEvents(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM session_events WHERE timestamp < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune session events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetSessionEvents returns session events matching filter, newest first
+func (db *DB) GetSessionEvents(filter SessionEventFilter) ([]*SessionEventRecord, error) {
+	query := `
+	SELECT id, session_id, session_name, project_id, event, reason, details, timestamp
+	FROM session_events WHERE 1=1
+	`
+
+	var args []interface{}
+	if filter.SessionID != "" {
+		query += " AND session_id = ?"
+		args = append(args, filter.SessionID)
+	}
+	if filter.ProjectID != "" {
+		query += " AND project_id = ?"
+		args = append(args, filter.ProjectID)
+	}
+	if filter.Event != "" {
+		query += " AND event = ?"
+		args = append(args, filter.Event)
+	}
+	if filter.Reason != "" {
+		query += " AND reason = ?"
+		args = append(args, filter.Reason)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.Until.UTC())
+	}
+
+	query += " ORDER BY timestamp DESC, id DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*SessionEventRecord
+	for rows.Next() {
+		var record SessionEventRecord
+		var details string
+		if err := rows.Scan(&record.ID, &record.SessionID, &record.SessionName, &record.ProjectID,
+			&record.Event, &record.Reason, &details, &record.Timestamp); err != nil {
+			return nil, err
+		}
+		if details != "" && details != "{}" {
+			if err := json.Unmarshal([]byte(details), &record.Details); err != nil {
+				return nil, fmt.Errorf("invalid details for session event %d: %w", record.ID, err)
+			}
+		}
+		records = append(records, &record)
+	}
+
+	return records, rows.Err()
+}
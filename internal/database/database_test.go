@@ -1,8 +1,13 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -36,6 +41,32 @@ func TestNewDB(t *testing.T) {
 	}
 }
 
+// TestNewDBWithPool tests that the configured pool size is applied
+func TestNewDBWithPool(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_db_pool")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := NewDBWithPool(filepath.Join(tempDir, "test.db"), 3)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.HealthCheck(); err != nil {
+		t.Errorf("Database health check failed: %v", err)
+	}
+	stats := db.PoolStats()
+	if stats.MaxOpenConnections != 3 {
+		t.Errorf("Expected max open connections 3, got %d", stats.MaxOpenConnections)
+	}
+	if stats.OpenConnections < 1 {
+		t.Errorf("Expected at least one open connection, got %d", stats.OpenConnections)
+	}
+}
+
 // TestSessionCRUD tests session creation, retrieval, update, and deletion
 func TestSessionCRUD(t *testing.T) {
 	db, tempDir := setupTestDB(t)
@@ -113,6 +144,63 @@ func TestSessionCRUD(t *testing.T) {
 	}
 }
 
+// TestSessionSecurityPolicy tests that session security policies are stored and that older
+// databases gain the column
+func TestSessionSecurityPolicy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "db-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	dbPath := filepath.Join(tempDir, "test.db")
+
+	old, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE sessions (
+		id TEXT PRIMARY KEY, name TEXT NOT NULL, project_id TEXT NOT NULL, working_dir TEXT NOT NULL,
+		environment TEXT DEFAULT '{}', created_at DATETIME NOT NULL, last_used_at DATETIME NOT NULL,
+		is_active BOOLEAN DEFAULT 1, command_count INTEGER DEFAULT 0)`); err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+	if _, err := old.Exec(`INSERT INTO sessions (id, name, project_id, working_dir, created_at, last_used_at)
+		VALUES ('old-session', 'Old', 'p', '/tmp', ?, ?)`, time.Now(), time.Now()); err != nil {
+		t.Fatalf("Failed to insert old session: %v", err)
+	}
+	old.Close()
+
+	db, err := NewDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database with the old schema: %v", err)
+	}
+	defer db.Close()
+
+	if record, err := db.GetSession("old-session"); err != nil || record.SecurityPolicy != "" {
+		t.Fatalf("Expected the old session with no policy, got %+v (%v)", record, err)
+	}
+
+	policy := `{"allow_network_access":false}`
+	if err := db.CreateSession(&SessionRecord{
+		ID: "policy-session", Name: "Policy", ProjectID: "p", WorkingDir: "/tmp",
+		CreatedAt: time.Now(), LastUsedAt: time.Now(), IsActive: true, SecurityPolicy: policy,
+	}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if record, err := db.GetSession("policy-session"); err != nil || record.SecurityPolicy != policy {
+		t.Errorf("Expected policy %s, got %+v (%v)", policy, record, err)
+	}
+	withStats, err := db.GetSessionsWithStats()
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	for _, session := range withStats {
+		if session.ID == "policy-session" && session.SecurityPolicy != policy {
+			t.Errorf("Expected GetSessionsWithStats to return the policy, got %q", session.SecurityPolicy)
+		}
+	}
+}
+
 // TestCommandStorage tests command storage and retrieval
 func TestCommandStorage(t *testing.T) {
 	db, tempDir := setupTestDB(t)
@@ -157,7 +245,7 @@ func TestCommandStorage(t *testing.T) {
 	}
 
 	// Test command search
-	commands, err := db.SearchCommands("test-session-2", "", "", "", nil, time.Time{}, time.Time{}, 10)
+	commands, err := db.SearchCommands("test-session-2", "", "", "", nil, time.Time{}, time.Time{}, nil, 10)
 	if err != nil {
 		t.Fatalf("Failed to search commands: %v", err)
 	}
@@ -288,7 +376,7 @@ func TestStreamChunks(t *testing.T) {
 	}
 
 	// Find the command ID by searching for the command we just stored
-	commands, err := db.SearchCommands("test-session-3", "", "", "", nil, time.Time{}, time.Time{}, 1)
+	commands, err := db.SearchCommands("test-session-3", "", "", "", nil, time.Time{}, time.Time{}, nil, 1)
 	if err != nil || len(commands) == 0 {
 		t.Fatalf("Failed to retrieve stored command for stream test: %v", err)
 	}
@@ -339,6 +427,17 @@ func TestStreamChunks(t *testing.T) {
 	if retrievedChunks[1].SequenceNum != 2 {
 		t.Errorf("Expected second chunk sequence 2, got %d", retrievedChunks[1].SequenceNum)
 	}
+
+	if err := db.StoreStreamChunk("test-session-3", commandID, ChunkTypeStatus, "exit_code=0", 3); err != nil {
+		t.Fatalf("Failed to store stream chunk: %v", err)
+	}
+	retrievedChunks, err = db.GetStreamChunksAfter(commandID, 1)
+	if err != nil {
+		t.Fatalf("Failed to get stream chunks after a sequence number: %v", err)
+	}
+	if len(retrievedChunks) != 2 || retrievedChunks[0].SequenceNum != 2 || retrievedChunks[1].ChunkType != ChunkTypeStatus || retrievedChunks[1].Timestamp.IsZero() {
+		t.Errorf("Expected chunks 2 and 3 with the stored status chunk last, got %+v", retrievedChunks)
+	}
 }
 
 // TestSessionStats tests session statistics retrieval
@@ -528,3 +627,717 @@ func TestDatabaseErrorHandling(t *testing.T) {
 		t.Error("Expected error when deleting non-existent session, got nil")
 	}
 }
+
+// TestGetCommandsAfter tests cursor-based retrieval of newly recorded commands
+func TestGetCommandsAfter(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "test-session-follow",
+		Name:       "Follow Test Session",
+		ProjectID:  "test-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	cursor, err := db.GetLatestCommandCursor()
+	if err != nil {
+		t.Fatalf("Failed to get latest cursor: %v", err)
+	}
+	if cursor != 0 {
+		t.Errorf("Expected cursor 0 on empty table, got %d", cursor)
+	}
+
+	startTime := time.Now()
+	for _, command := range []string{"echo one", "echo two"} {
+		err := db.StoreCommand("test-session-follow", "test-project", command, "out", 0, true,
+			startTime, startTime.Add(time.Second), time.Second, "/tmp")
+		if err != nil {
+			t.Fatalf("Failed to store command: %v", err)
+		}
+	}
+
+	commands, next, err := db.GetCommandsAfter(cursor, "", "", 0)
+	if err != nil {
+		t.Fatalf("Failed to get commands after cursor: %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(commands))
+	}
+	if commands[0].Command != "echo one" || commands[1].Command != "echo two" {
+		t.Errorf("Expected commands in insertion order, got %q, %q", commands[0].Command, commands[1].Command)
+	}
+
+	latest, err := db.GetLatestCommandCursor()
+	if err != nil {
+		t.Fatalf("Failed to get latest cursor: %v", err)
+	}
+	if next != latest {
+		t.Errorf("Expected next cursor %d, got %d", latest, next)
+	}
+
+	commands, same, err := db.GetCommandsAfter(next, "", "", 0)
+	if err != nil {
+		t.Fatalf("Failed to get commands after cursor: %v", err)
+	}
+	if len(commands) != 0 || same != next {
+		t.Errorf("Expected no new commands and unchanged cursor, got %d commands, cursor %d", len(commands), same)
+	}
+
+	commands, _, err = db.GetCommandsAfter(cursor, "other-session", "", 0)
+	if err != nil {
+		t.Fatalf("Failed to get commands for other session: %v", err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("Expected no commands for other session, got %d", len(commands))
+	}
+}
+
+// TestBlockedCommands tests recording, pruning, filtering and clearing blocked command history
+func TestBlockedCommands(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	for i := 0; i < 4; i++ {
+		sessionID := "session-a"
+		if i%2 == 1 {
+			sessionID = "session-b"
+		}
+		record := &BlockedCommandRecord{
+			SessionID: sessionID,
+			Command:   fmt.Sprintf("shutdown %d", i),
+			Source:    "run_command",
+			RuleType:  "blocked_command",
+			Reason:    "blocked",
+		}
+		if err := db.RecordBlockedCommand(record, 3); err != nil {
+			t.Fatalf("Failed to record blocked command: %v", err)
+		}
+	}
+
+	records, err := db.GetBlockedCommands("", 0)
+	if err != nil {
+		t.Fatalf("Failed to get blocked commands: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected history pruned to 3 records, got %d", len(records))
+	}
+	if records[0].Command != "shutdown 3" || records[2].Command != "shutdown 1" {
+		t.Errorf("Expected newest first with oldest pruned, got %q .. %q", records[0].Command, records[2].Command)
+	}
+
+	records, err = db.GetBlockedCommands("session-b", 1)
+	if err != nil {
+		t.Fatalf("Failed to get session blocked commands: %v", err)
+	}
+	if len(records) != 1 || records[0].Command != "shutdown 3" {
+		t.Errorf("Expected latest session-b record, got %+v", records)
+	}
+
+	cleared, err := db.ClearBlockedCommands("session-b")
+	if err != nil || cleared != 2 {
+		t.Errorf("Expected 2 session-b records cleared, got %d (%v)", cleared, err)
+	}
+	cleared, err = db.ClearBlockedCommands("")
+	if err != nil || cleared != 1 {
+		t.Errorf("Expected remaining record cleared, got %d (%v)", cleared, err)
+	}
+}
+
+// TestSessionEvents tests recording, filtering and pruning session lifecycle events
+func TestSessionEvents(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	now := time.Now()
+	events := []*SessionEventRecord{
+		{SessionID: "session-a", SessionName: "a", ProjectID: "p1", Event: "created", Timestamp: now.Add(-3 * time.Hour)},
+		{SessionID: "session-b", SessionName: "b", ProjectID: "p2", Event: "created", Timestamp: now.Add(-2 * time.Hour)},
+		{SessionID: "session-a", SessionName: "a", ProjectID: "p1", Event: "cleaned_up", Reason: "inactive_timeout",
+			Details: map[string]interface{}{"command_count": 3}, Timestamp: now.Add(-time.Hour)},
+		{SessionID: "session-b", SessionName: "b", ProjectID: "p2", Event: "closed", Reason: "requested", Timestamp: now},
+	}
+	for _, event := range events {
+		if err := db.RecordSessionEvent(event, 0); err != nil {
+			t.Fatalf("Failed to record session event: %v", err)
+		}
+		if event.ID == 0 {
+			t.Errorf("Expected the record ID to be set")
+		}
+	}
+
+	records, err := db.GetSessionEvents(SessionEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get session events: %v", err)
+	}
+	if len(records) != 4 || records[0].Event != "closed" || records[3].Event != "created" {
+		t.Fatalf("Expected 4 events newest first, got %+v", records)
+	}
+
+	records, err = db.GetSessionEvents(SessionEventFilter{ProjectID: "p1", Event: "cleaned_up"})
+	if err != nil {
+		t.Fatalf("Failed to filter session events: %v", err)
+	}
+	if len(records) != 1 || records[0].Reason != "inactive_timeout" {
+		t.Fatalf("Expected the cleaned up event, got %+v", records)
+	}
+	if count, ok := records[0].Details["command_count"].(float64); !ok || count != 3 {
+		t.Errorf("Expected details to round-trip, got %+v", records[0].Details)
+	}
+
+	records, err = db.GetSessionEvents(SessionEventFilter{Since: now.Add(-150 * time.Minute), Until: now.Add(-30 * time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to filter session events by time: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 events in the time range, got %d", len(records))
+	}
+
+	records, err = db.GetSessionEvents(SessionEventFilter{SessionID: "session-b", Limit: 1})
+	if err != nil || len(records) != 1 || records[0].Event != "closed" {
+		t.Errorf("Expected the latest session-b event, got %+v (%v)", records, err)
+	}
+
+	// Recording with a retention prunes older events
+	if err := db.RecordSessionEvent(&SessionEventRecord{SessionID: "session-c", Event: "created"}, 90*time.Minute); err != nil {
+		t.Fatalf("Failed to record session event: %v", err)
+	}
+	records, err = db.GetSessionEvents(SessionEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get session events: %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("Expected events older than the retention pruned, got %d events", len(records))
+	}
+}
+
+func TestOrphanedRecords(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	startTime := time.Now()
+	for _, sessionID := range []string{"session-kept", "session-gone"} {
+		session := &SessionRecord{
+			ID:         sessionID,
+			Name:       sessionID,
+			ProjectID:  "test-project",
+			WorkingDir: "/tmp",
+			CreatedAt:  startTime,
+			LastUsedAt: startTime,
+			IsActive:   true,
+		}
+		if err := db.CreateSession(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			err := db.StoreCommand(sessionID, "test-project", fmt.Sprintf("echo %d", i), "out", 0, true,
+				startTime, startTime.Add(time.Second), time.Second, "/tmp")
+			if err != nil {
+				t.Fatalf("Failed to store command: %v", err)
+			}
+		}
+	}
+
+	// Remove a session the way an abnormal shutdown would: without the foreign key cascade
+	ctx := context.Background()
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	for _, stmt := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`INSERT INTO stream_chunks (session_id, command_id, chunk_type, content, timestamp, sequence_num) VALUES ('session-gone', 'missing-command', 'stdout', 'x', CURRENT_TIMESTAMP, 0)`,
+		`DELETE FROM sessions WHERE id = 'session-gone'`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Failed to run %q: %v", stmt, err)
+		}
+	}
+	conn.Close()
+
+	found, err := db.FindOrphanedRecords()
+	if err != nil {
+		t.Fatalf("Failed to find orphaned records: %v", err)
+	}
+	if found.Commands != 2 || found.StreamChunks != 1 || len(found.SessionIDs) != 1 || found.SessionIDs[0] != "session-gone" {
+		t.Errorf("Expected 2 orphaned commands and 1 chunk of session-gone, got %+v", found)
+	}
+
+	deleted, err := db.DeleteOrphanedRecords()
+	if err != nil {
+		t.Fatalf("Failed to delete orphaned records: %v", err)
+	}
+	if deleted.Commands != 2 || deleted.StreamChunks != 1 {
+		t.Errorf("Expected 2 commands and 1 chunk deleted, got %+v", deleted)
+	}
+
+	found, err = db.FindOrphanedRecords()
+	if err != nil || found.Commands != 0 || found.StreamChunks != 0 {
+		t.Errorf("Expected no orphans left, got %+v (%v)", found, err)
+	}
+	kept, err := db.SearchCommands("session-kept", "", "", "", nil, time.Time{}, time.Time{}, nil, 0)
+	if err != nil || len(kept) != 2 {
+		t.Errorf("Expected session-kept commands untouched, got %d (%v)", len(kept), err)
+	}
+}
+
+func TestSuccessRateTrend(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "trend-session",
+		Name:       "Trend Session",
+		ProjectID:  "trend-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Two days of history: day one all passing, day two half failing. One command is stored
+	// with a non-UTC offset to check it lands in the right UTC bucket.
+	dayOne := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	dayTwo := dayOne.Add(24 * time.Hour)
+	plusTwo := time.FixedZone("UTC+2", 2*60*60)
+	history := []struct {
+		at      time.Time
+		success bool
+	}{
+		{dayOne, true},
+		{dayOne.Add(30 * time.Minute), true},
+		{dayOne.Add(90 * time.Minute).In(plusTwo), true},
+		{dayTwo, true},
+		{dayTwo.Add(10 * time.Minute), false},
+	}
+	for i, entry := range history {
+		err := db.CreateCommand(&CommandRecord{
+			ID:         fmt.Sprintf("trend-%d", i),
+			SessionID:  "trend-session",
+			ProjectID:  "trend-project",
+			Command:    "make build",
+			Success:    entry.success,
+			WorkingDir: "/tmp",
+			Timestamp:  entry.at,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create command: %v", err)
+		}
+	}
+
+	daily, err := db.GetSuccessRateTrend("", "trend-project", TrendIntervalDaily, dayOne.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get daily trend: %v", err)
+	}
+	if len(daily) != 2 {
+		t.Fatalf("Expected 2 daily buckets, got %d", len(daily))
+	}
+	if !daily[0].Start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) || daily[0].Total != 3 || daily[0].SuccessRate != 1 {
+		t.Errorf("Unexpected first day bucket: %+v", daily[0])
+	}
+	if daily[1].Total != 2 || daily[1].Failed != 1 || daily[1].SuccessRate != 0.5 {
+		t.Errorf("Unexpected second day bucket: %+v", daily[1])
+	}
+
+	hourly, err := db.GetSuccessRateTrend("trend-session", "", TrendIntervalHourly, dayTwo)
+	if err != nil {
+		t.Fatalf("Failed to get hourly trend: %v", err)
+	}
+	if len(hourly) != 1 || !hourly[0].Start.Equal(dayTwo) || hourly[0].Total != 2 {
+		t.Errorf("Expected one hourly bucket at %s with 2 commands, got %+v", dayTwo, hourly)
+	}
+
+	if _, err := db.GetSuccessRateTrend("", "", "weekly", time.Time{}); err == nil {
+		t.Error("Expected an unknown interval to be rejected")
+	}
+}
+
+// TestCheckpointWAL tests that a checkpoint empties the WAL and reports the frames it copied
+func TestCheckpointWAL(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		session := &SessionRecord{
+			ID:         fmt.Sprintf("wal-session-%d", i),
+			Name:       "wal",
+			ProjectID:  "wal_project",
+			WorkingDir: tempDir,
+			CreatedAt:  time.Now(),
+			LastUsedAt: time.Now(),
+			IsActive:   true,
+		}
+		if err := db.CreateSession(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	checkpoint, err := db.CheckpointWAL(context.Background())
+	if err != nil {
+		t.Fatalf("CheckpointWAL failed: %v", err)
+	}
+	if checkpoint.Busy || checkpoint.SizeBeforeBytes == 0 || checkpoint.SizeAfterBytes != 0 {
+		t.Errorf("Expected the WAL to be truncated, got %+v", checkpoint)
+	}
+	if checkpoint.CheckpointedFrames == 0 || checkpoint.CheckpointedFrames != checkpoint.LogFrames {
+		t.Errorf("Expected every WAL frame to be checkpointed, got %+v", checkpoint)
+	}
+
+	// Nothing was written since, so a second checkpoint has nothing to do
+	checkpoint, err = db.CheckpointWAL(context.Background())
+	if err != nil || checkpoint.SizeBeforeBytes != 0 || checkpoint.CheckpointedFrames != 0 {
+		t.Errorf("Expected an empty WAL, got %+v (%v)", checkpoint, err)
+	}
+	if _, err := db.GetSession("wal-session-49"); err != nil {
+		t.Errorf("Expected checkpointed data to remain readable: %v", err)
+	}
+}
+
+// TestVacuum tests that vacuuming reclaims deleted space and skips instead of waiting when busy
+func TestVacuum(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "vacuum-session",
+		Name:       "vacuum",
+		ProjectID:  "vacuum_project",
+		WorkingDir: tempDir,
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	output := strings.Repeat("x", 16*1024)
+	for i := 0; i < 100; i++ {
+		if err := db.CreateCommand(&CommandRecord{ID: fmt.Sprintf("vacuum-%d", i), SessionID: session.ID, ProjectID: session.ProjectID,
+			Command: "cat big.log", Output: output, Success: true, Timestamp: time.Now(), Tags: "[]"}); err != nil {
+			t.Fatalf("Failed to create command: %v", err)
+		}
+	}
+	if _, err := db.CheckpointWAL(context.Background()); err != nil {
+		t.Fatalf("CheckpointWAL failed: %v", err)
+	}
+	if _, err := db.conn.Exec("DELETE FROM commands"); err != nil {
+		t.Fatalf("Failed to delete commands: %v", err)
+	}
+
+	result, err := db.Vacuum(context.Background())
+	if err != nil {
+		t.Fatalf("Vacuum failed: %v", err)
+	}
+	if result.Skipped || result.ReclaimedBytes < 1024*1024 || result.SizeAfterBytes >= result.SizeBeforeBytes {
+		t.Errorf("Expected the deleted output to be reclaimed, got %+v", result)
+	}
+	if _, err := db.GetSession(session.ID); err != nil {
+		t.Errorf("Expected data to survive the vacuum: %v", err)
+	}
+
+	// A checkpoint in progress holds the maintenance lock
+	db.maintenanceMu.Lock()
+	result, err = db.Vacuum(context.Background())
+	db.maintenanceMu.Unlock()
+	if err != nil || !result.Skipped || !strings.Contains(result.SkipReason, "checkpoint") {
+		t.Errorf("Expected the vacuum to skip during a checkpoint, got %+v (%v)", result, err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	result, err = db.Vacuum(context.Background())
+	tx.Rollback()
+	if err != nil || !result.Skipped {
+		t.Errorf("Expected the vacuum to skip while a connection is in use, got %+v (%v)", result, err)
+	}
+
+	// A writer in another process holds the lock SQLite needs
+	other, err := sql.Open("sqlite3", db.path)
+	if err != nil {
+		t.Fatalf("Failed to open second connection: %v", err)
+	}
+	defer other.Close()
+	otherTx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if _, err := otherTx.Exec("DELETE FROM sessions WHERE id = 'missing'"); err != nil {
+		t.Fatalf("Failed to take the write lock: %v", err)
+	}
+	result, err = db.Vacuum(context.Background())
+	otherTx.Rollback()
+	if err != nil || !result.Skipped || result.SkipReason != "the database is busy" {
+		t.Errorf("Expected the vacuum to skip while another writer holds the lock, got %+v (%v)", result, err)
+	}
+}
+
+// TestSearchCommandsRegex tests regex filtering of command history
+func TestSearchCommandsRegex(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "test-session-regex",
+		Name:       "Regex Test Session",
+		ProjectID:  "test-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	startTime := time.Now()
+	commands := map[string]string{
+		"go test ./...":  "ok  pkg/a\nFAIL pkg/b\nFAIL pkg/c",
+		"go build ./...": "",
+		"npm test":       "1 failing",
+	}
+	for command, output := range commands {
+		if err := db.StoreCommand("test-session-regex", "test-project", command, output, 0, true,
+			startTime, startTime.Add(time.Second), time.Second, "/tmp"); err != nil {
+			t.Fatalf("Failed to store command: %v", err)
+		}
+	}
+
+	matches, stats, err := db.SearchCommandsRegex("", "", "", "", nil, time.Time{}, time.Time{}, nil, `^go (test|build)`, "", 0)
+	if err != nil {
+		t.Fatalf("SearchCommandsRegex failed: %v", err)
+	}
+	if len(matches) != 2 || stats.RowsScanned != 3 || stats.ScanLimitReached {
+		t.Errorf("Expected 2 go commands out of 3 scanned, got %d (%+v)", len(matches), stats)
+	}
+
+	matches, _, err = db.SearchCommandsRegex("", "", "go", "", nil, time.Time{}, time.Time{}, nil, "", `FAIL \S+`, 0)
+	if err != nil {
+		t.Fatalf("SearchCommandsRegex failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Command != "go test ./..." {
+		t.Fatalf("Expected only go test to match, got %d matches", len(matches))
+	}
+	match := matches[0].Matches
+	if len(match) != 1 || match[0].Regex != "output_regex" || match[0].Field != "output" || len(match[0].Offsets) != 2 {
+		t.Fatalf("Unexpected regex matches: %+v", match)
+	}
+	if start, end := match[0].Offsets[0][0], match[0].Offsets[0][1]; matches[0].Output[start:end] != "FAIL pkg/b" {
+		t.Errorf("Expected offsets of 'FAIL pkg/b', got %q", matches[0].Output[start:end])
+	}
+
+	matches, _, _ = db.SearchCommandsRegex("", "", "", "", nil, time.Time{}, time.Time{}, nil, "test", "", 1)
+	if len(matches) != 1 {
+		t.Errorf("Expected the limit to cap results, got %d", len(matches))
+	}
+
+	_, _, err = db.SearchCommandsRegex("", "", "", "", nil, time.Time{}, time.Time{}, nil, "", "(unclosed", 0)
+	var regexErr *InvalidRegexError
+	if !errors.As(err, &regexErr) || regexErr.Field != "output_regex" {
+		t.Errorf("Expected an InvalidRegexError for output_regex, got %v", err)
+	}
+}
+
+// TestSearchCommandsByTags tests storing command tags and filtering history by them
+func TestSearchCommandsByTags(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "test-session-tags",
+		Name:       "Tags Test Session",
+		ProjectID:  "test-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	startTime := time.Now()
+	tagged := map[string][]string{
+		"git push":        {"git", " Deploy ", "deploy"},
+		"git status":      {"git"},
+		"docker build .":  {"docker", "deploy"},
+		"echo no tags":    nil,
+		"gitk --all":      {"gitk"},
+		"echo substrings": {"git-lfs"},
+	}
+	for command, tags := range tagged {
+		if err := db.StoreCommandWithTags("test-session-tags", "test-project", command, "", 0, true,
+			startTime, startTime.Add(time.Second), time.Second, "/tmp", tags); err != nil {
+			t.Fatalf("Failed to store command: %v", err)
+		}
+	}
+	// Rows with a malformed tags column must not break tag searches
+	if err := db.CreateCommand(&CommandRecord{ID: "malformed-tags", SessionID: "test-session-tags", ProjectID: "test-project",
+		Command: "legacy", Timestamp: startTime, Tags: "not json"}); err != nil {
+		t.Fatalf("Failed to create command: %v", err)
+	}
+
+	commands, err := db.SearchCommands("", "", "git push", "", nil, time.Time{}, time.Time{}, nil, 0)
+	if err != nil || len(commands) != 1 {
+		t.Fatalf("Expected to find git push, got %d (%v)", len(commands), err)
+	}
+	if commands[0].Tags != `["deploy","git"]` {
+		t.Errorf("Expected normalized, deduplicated tags, got %s", commands[0].Tags)
+	}
+
+	tests := []struct {
+		tags []string
+		want int
+	}{
+		{[]string{"git"}, 2},
+		{[]string{"GIT", "deploy"}, 1},
+		{[]string{"deploy"}, 2},
+		{[]string{"git", "docker"}, 0},
+		{[]string{"missing"}, 0},
+		{nil, 7},
+	}
+	for _, tt := range tests {
+		commands, err := db.SearchCommands("", "", "", "", nil, time.Time{}, time.Time{}, tt.tags, 0)
+		if err != nil {
+			t.Fatalf("SearchCommands(%v) failed: %v", tt.tags, err)
+		}
+		if len(commands) != tt.want {
+			t.Errorf("SearchCommands(%v) found %d commands, want %d", tt.tags, len(commands), tt.want)
+		}
+	}
+
+	matches, _, err := db.SearchCommandsRegex("", "", "", "", nil, time.Time{}, time.Time{}, []string{"deploy"}, "^git", "", 0)
+	if err != nil || len(matches) != 1 || matches[0].Command != "git push" {
+		t.Errorf("Expected the tag filter to apply to regex searches, got %d matches (%v)", len(matches), err)
+	}
+}
+
+// TestSearchCommandsPage tests paging through history with an offset and counting every match
+func TestSearchCommandsPage(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "test-session-page",
+		Name:       "Page Test Session",
+		ProjectID:  "test-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Identical timestamps must still page without overlap
+	timestamp := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := db.CreateCommand(&CommandRecord{ID: fmt.Sprintf("page-%d", i), SessionID: session.ID, ProjectID: "test-project",
+			Command: fmt.Sprintf("echo %d", i), Success: true, Timestamp: timestamp, Tags: "[]"}); err != nil {
+			t.Fatalf("Failed to create command: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for offset := 0; offset < 6; offset += 2 {
+		commands, err := db.SearchCommandsPage(session.ID, "", "echo", "", nil, time.Time{}, time.Time{}, nil, 2, offset)
+		if err != nil {
+			t.Fatalf("SearchCommandsPage(offset %d) failed: %v", offset, err)
+		}
+		if want := min(2, 5-offset); len(commands) != want {
+			t.Fatalf("Offset %d returned %d commands, want %d", offset, len(commands), want)
+		}
+		for _, cmd := range commands {
+			if seen[cmd.ID] {
+				t.Errorf("Command %s returned on more than one page", cmd.ID)
+			}
+			seen[cmd.ID] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected every command once across pages, got %d", len(seen))
+	}
+
+	count, err := db.CountCommands(session.ID, "", "echo", "", nil, time.Time{}, time.Time{}, nil)
+	if err != nil || count != 5 {
+		t.Errorf("Expected a count of 5, got %d (%v)", count, err)
+	}
+	failed := false
+	count, err = db.CountCommands(session.ID, "", "", "", &failed, time.Time{}, time.Time{}, nil)
+	if err != nil || count != 0 {
+		t.Errorf("Expected the count to apply filters, got %d (%v)", count, err)
+	}
+
+	commands, err := db.SearchCommandsPage(session.ID, "", "", "", nil, time.Time{}, time.Time{}, nil, 0, 3)
+	if err != nil || len(commands) != 2 {
+		t.Errorf("Expected an offset without a limit to return the rest, got %d (%v)", len(commands), err)
+	}
+}
+
+func TestGetCommand(t *testing.T) {
+	db, tempDir := setupTestDB(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	session := &SessionRecord{
+		ID:         "test-session-get",
+		Name:       "Get Command Test Session",
+		ProjectID:  "test-project",
+		WorkingDir: "/tmp",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		IsActive:   true,
+	}
+	if err := db.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	output := strings.Repeat("line of build output\n", 5000)
+	startTime := time.Now()
+	if err := db.StoreCommandWithTags("test-session-get", "test-project", "make build", output, 2, false,
+		startTime, startTime.Add(1500*time.Millisecond), 1500*time.Millisecond, "/tmp/app", []string{"make"}); err != nil {
+		t.Fatalf("Failed to store command: %v", err)
+	}
+
+	records, err := db.SearchCommands("test-session-get", "", "", "", nil, time.Time{}, time.Time{}, nil, 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Failed to find the stored command: %v, %d records", err, len(records))
+	}
+
+	record, err := db.GetCommand(records[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get command: %v", err)
+	}
+	if record.Command != "make build" || record.Output != output || record.ExitCode != 2 || record.Success {
+		t.Errorf("Expected the complete command record, got command %q exit %d with %d bytes of output", record.Command, record.ExitCode, len(record.Output))
+	}
+	if record.WorkingDir != "/tmp/app" || record.Duration != 1500 || record.Tags != `["make"]` {
+		t.Errorf("Unexpected working dir, duration or tags: %q %d %q", record.WorkingDir, record.Duration, record.Tags)
+	}
+
+	if _, err := db.GetCommand("missing-command"); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("Expected ErrCommandNotFound for an unknown ID, got %v", err)
+	}
+}
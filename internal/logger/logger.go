@@ -64,6 +64,10 @@ type Logger struct {
 	component  string
 	baseFields map[string]interface{}
 	fileHandle *os.File // H7: Track file handle for cleanup
+
+	// Command output echoed at debug level, see LogCommand
+	teeOutput bool
+	teeLimit  int
 }
 
 // NewLogger creates a new logger instance
@@ -106,6 +110,8 @@ func NewLogger(cfg *config.LoggingConfig, component string) (*Logger, error) {
 		component:  component,
 		baseFields: make(map[string]interface{}),
 		fileHandle: fileHandle,
+		teeOutput:  cfg.TeeCommandOutput,
+		teeLimit:   cfg.TeeMaxBytes,
 	}, nil
 }
 
@@ -200,6 +206,13 @@ func (l *Logger) Error(message string, err error, fields ...map[string]interface
 	l.log(ERROR, message, errorStr, fields...)
 }
 
+// debugEnabled reports whether debug entries are written
+func (l *Logger) debugEnabled() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level <= DEBUG
+}
+
 // LogCommand logs a command execution
 func (l *Logger) LogCommand(sessionID, command string, duration time.Duration, success bool, output string, err error) {
 	fields := map[string]interface{}{
@@ -215,6 +228,16 @@ func (l *Logger) LogCommand(sessionID, command string, duration time.Duration, s
 	} else {
 		l.Info("Command execution completed successfully", fields)
 	}
+
+	if l.teeOutput && output != "" && l.debugEnabled() {
+		teed, truncated := teeCommandOutput(output, l.teeLimit)
+		l.Debug("Command output", map[string]interface{}{
+			"session_id": sessionID,
+			"command":    RedactSecrets(command),
+			"output":     teed,
+			"truncated":  truncated,
+		})
+	}
 }
 
 // LogSessionEvent logs session-related events
@@ -0,0 +1,169 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rama-kairi/go-term/internal/logger"
+	"github.com/rama-kairi/go-term/internal/utils"
+)
+
+const (
+	// webhookQueueSize bounds the number of pending notifications; extra events are dropped
+	webhookQueueSize = 100
+	// webhookMaxOutput is the maximum number of output bytes sent per event
+	webhookMaxOutput = 4096
+)
+
+// CommandEvent is the JSON payload POSTed to the command webhook on command completion
+type CommandEvent struct {
+	SessionID  string    `json:"session_id"`
+	ProjectID  string    `json:"project_id"`
+	Command    string    `json:"command"`
+	Success    bool      `json:"success"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMs int64     `json:"duration_ms"`
+	Output     string    `json:"output"`
+	Truncated  bool      `json:"truncated"`
+	Background bool      `json:"background"`
+	WorkingDir string    `json:"working_dir"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// CommandWebhook asynchronously POSTs command completion events to a configured URL.
+// Delivery failures are logged and never affect command execution.
+type CommandWebhook struct {
+	url     string
+	retries int
+	client  *http.Client
+	logger  *logger.Logger
+	queue   chan CommandEvent
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewCommandWebhook creates a webhook notifier and starts its delivery worker
+func NewCommandWebhook(url string, timeout time.Duration, retries int, logger *logger.Logger) *CommandWebhook {
+	if retries < 0 {
+		retries = 0
+	}
+
+	w := &CommandWebhook{
+		url:     url,
+		retries: retries,
+		client:  &http.Client{Timeout: timeout},
+		logger:  logger,
+		queue:   make(chan CommandEvent, webhookQueueSize),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Notify queues an event for delivery without blocking. Secrets in the command and output are
+// masked (see logger.RedactSecrets) before either leaves the server, and output is truncated to
+// the latest content.
+func (w *CommandWebhook) Notify(event CommandEvent) {
+	event.Command = logger.RedactSecrets(event.Command)
+	event.Output = logger.RedactSecrets(event.Output)
+	if len(event.Output) > webhookMaxOutput {
+		event.Output = "..." + utils.TruncateTail(event.Output, webhookMaxOutput-3)
+		event.Truncated = true
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		w.logger.Warn("Command webhook queue full, dropping event", map[string]interface{}{
+			"session_id": event.SessionID,
+			"command":    event.Command,
+		})
+	}
+}
+
+// Stop stops the delivery worker; pending events are discarded
+func (w *CommandWebhook) Stop() {
+	close(w.stopCh)
+	<-w.doneCh
+}
+
+// run delivers queued events until stopped
+func (w *CommandWebhook) run() {
+	defer close(w.doneCh)
+
+	for {
+		select {
+		case event := <-w.queue:
+			if err := w.deliver(event); err != nil {
+				w.logger.Warn("Command webhook delivery failed", map[string]interface{}{
+					"session_id": event.SessionID,
+					"command":    event.Command,
+					"error":      err.Error(),
+				})
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// deliver POSTs an event, retrying with exponential backoff
+func (w *CommandWebhook) deliver(event CommandEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := 500 * time.Millisecond
+	var lastErr error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return lastErr
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := w.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return lastErr
+}
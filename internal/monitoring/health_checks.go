@@ -0,0 +1,57 @@
+package monitoring
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// GoroutineLeakCheck compares the goroutine count with the baseline the resource monitor took at
+// startup. Sessions and background processes each hold a few goroutines, so the thresholds are
+// an increase over the baseline rather than an absolute count.
+type GoroutineLeakCheck struct {
+	monitor           *ResourceMonitor
+	degradedIncrease  int
+	unhealthyIncrease int
+}
+
+// NewGoroutineLeakCheck creates a check that reports degraded once the goroutine count exceeds
+// the monitor's baseline by more than degradedIncrease, and unhealthy past unhealthyIncrease
+func NewGoroutineLeakCheck(monitor *ResourceMonitor, degradedIncrease, unhealthyIncrease int) *GoroutineLeakCheck {
+	return &GoroutineLeakCheck{
+		monitor:           monitor,
+		degradedIncrease:  degradedIncrease,
+		unhealthyIncrease: unhealthyIncrease,
+	}
+}
+
+// CheckHealth reports the goroutine count against the baseline
+func (c *GoroutineLeakCheck) CheckHealth() ComponentHealth {
+	current := runtime.NumGoroutine()
+	baseline := c.monitor.GoroutineBaseline()
+	increase := current - baseline
+
+	health := ComponentHealth{
+		Status: "healthy",
+		Details: map[string]interface{}{
+			"goroutines":          current,
+			"baseline_goroutines": baseline,
+			"increase":            increase,
+			"degraded_increase":   c.degradedIncrease,
+			"unhealthy_increase":  c.unhealthyIncrease,
+		},
+	}
+	if latest := c.monitor.GetCurrentMetrics(); !latest.Timestamp.IsZero() {
+		health.Details["active_sessions"] = latest.ActiveSessions
+		health.Details["background_processes"] = latest.BgProcesses
+	}
+
+	switch {
+	case increase > c.unhealthyIncrease:
+		health.Status = "unhealthy"
+		health.Message = fmt.Sprintf("%d goroutines, %d over the baseline of %d; likely a goroutine leak", current, increase, baseline)
+	case increase > c.degradedIncrease:
+		health.Status = "degraded"
+		health.Message = fmt.Sprintf("%d goroutines, %d over the baseline of %d", current, increase, baseline)
+	}
+	return health
+}
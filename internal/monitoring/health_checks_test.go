@@ -0,0 +1,62 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestGoroutineLeakCheck(t *testing.T) {
+	monitor := &ResourceMonitor{baselineGoroutines: runtime.NumGoroutine()}
+
+	if health := NewGoroutineLeakCheck(monitor, 50, 100).CheckHealth(); health.Status != "healthy" || health.Details["baseline_goroutines"] != monitor.baselineGoroutines {
+		t.Errorf("Expected healthy at the baseline, got %+v", health)
+	}
+
+	// Pretend the server started with far fewer goroutines than it has now
+	monitor.baselineGoroutines = runtime.NumGoroutine() - 20
+	if health := NewGoroutineLeakCheck(monitor, 10, 100).CheckHealth(); health.Status != "degraded" || health.Message == "" {
+		t.Errorf("Expected degraded past the first threshold, got %+v", health)
+	}
+	if health := NewGoroutineLeakCheck(monitor, 5, 10).CheckHealth(); health.Status != "unhealthy" {
+		t.Errorf("Expected unhealthy past the second threshold, got %+v", health)
+	}
+}
+
+func TestHealthEndpointComponentChecks(t *testing.T) {
+	endpoint := NewHealthEndpoint(0, nil)
+	status := "degraded"
+	endpoint.RegisterComponentCheck("background_processes", ComponentCheckFunc(func() ComponentHealth {
+		return ComponentHealth{Status: status, Message: "1 background process vanished", Details: map[string]interface{}{"count": 1}}
+	}))
+
+	check := func(handler http.HandlerFunc, path string) (int, map[string]interface{}) {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", path, err)
+		}
+		return recorder.Code, body
+	}
+
+	// A degraded component is named in the health JSON but does not fail either probe
+	code, body := check(endpoint.handleHealth, "/health")
+	component, _ := body["components"].(map[string]interface{})["background_processes"].(map[string]interface{})
+	if code != http.StatusOK || body["status"] != "degraded" || component["status"] != "degraded" || component["details"] == nil {
+		t.Errorf("Expected a degraded background_processes component, got %d %+v", code, body)
+	}
+	if code, body := check(endpoint.handleReadiness, "/health/ready"); code != http.StatusOK || body["ready"] != true {
+		t.Errorf("Expected a degraded server to stay ready, got %d %+v", code, body)
+	}
+
+	status = "unhealthy"
+	if code, body := check(endpoint.handleHealth, "/health"); code != http.StatusServiceUnavailable || body["status"] != "unhealthy" {
+		t.Errorf("Expected an unhealthy component to fail the health check, got %d %+v", code, body)
+	}
+	if code, body := check(endpoint.handleReadiness, "/health/ready"); code != http.StatusServiceUnavailable || body["ready"] != false {
+		t.Errorf("Expected an unhealthy component to fail readiness, got %d %+v", code, body)
+	}
+}
@@ -12,11 +12,12 @@ import (
 
 // M8: HealthEndpoint provides HTTP health check endpoints
 type HealthEndpoint struct {
-	server       *http.Server
-	resourceMon  *ResourceMonitor
-	healthChecks map[string]HealthChecker
-	mu           sync.RWMutex
-	startTime    time.Time
+	server          *http.Server
+	resourceMon     *ResourceMonitor
+	healthChecks    map[string]HealthChecker
+	componentChecks map[string]ComponentChecker
+	mu              sync.RWMutex
+	startTime       time.Time
 }
 
 // HealthChecker is an interface for components that can report health
@@ -24,6 +25,20 @@ type HealthChecker interface {
 	HealthCheck() error
 }
 
+// ComponentChecker is implemented by checks that can report a degraded state between healthy and
+// unhealthy
+type ComponentChecker interface {
+	CheckHealth() ComponentHealth
+}
+
+// ComponentCheckFunc adapts a function to ComponentChecker
+type ComponentCheckFunc func() ComponentHealth
+
+// CheckHealth calls f
+func (f ComponentCheckFunc) CheckHealth() ComponentHealth {
+	return f()
+}
+
 // HealthStatus represents the overall health status
 type HealthStatus struct {
 	Status     string                     `json:"status"` // "healthy", "degraded", "unhealthy"
@@ -35,8 +50,9 @@ type HealthStatus struct {
 
 // ComponentHealth represents health of a single component
 type ComponentHealth struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Status  string                 `json:"status"` // "healthy", "degraded" or "unhealthy"
+	Message string                 `json:"message,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 // HealthMetrics contains resource metrics
@@ -51,9 +67,10 @@ type HealthMetrics struct {
 // NewHealthEndpoint creates a new health endpoint
 func NewHealthEndpoint(port int, resourceMon *ResourceMonitor) *HealthEndpoint {
 	he := &HealthEndpoint{
-		resourceMon:  resourceMon,
-		healthChecks: make(map[string]HealthChecker),
-		startTime:    time.Now(),
+		resourceMon:     resourceMon,
+		healthChecks:    make(map[string]HealthChecker),
+		componentChecks: make(map[string]ComponentChecker),
+		startTime:       time.Now(),
 	}
 
 	mux := http.NewServeMux()
@@ -80,6 +97,14 @@ func (he *HealthEndpoint) RegisterHealthCheck(name string, checker HealthChecker
 	he.healthChecks[name] = checker
 }
 
+// RegisterComponentCheck registers a check that reports its own status, including degraded, under
+// name in the health components
+func (he *HealthEndpoint) RegisterComponentCheck(name string, checker ComponentChecker) {
+	he.mu.Lock()
+	defer he.mu.Unlock()
+	he.componentChecks[name] = checker
+}
+
 // Start starts the health endpoint server
 func (he *HealthEndpoint) Start() error {
 	go func() {
@@ -141,6 +166,17 @@ func (he *HealthEndpoint) handleReadiness(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	// Degraded components still serve requests; only unhealthy ones fail readiness
+	for name, checker := range he.componentChecks {
+		health := checker.CheckHealth()
+		if health.Status == "unhealthy" {
+			ready = false
+			components[name] = health.Message
+		} else {
+			components[name] = "ready"
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if ready {
 		w.WriteHeader(http.StatusOK)
@@ -217,6 +253,17 @@ func (he *HealthEndpoint) getHealthStatus() HealthStatus {
 		}
 	}
 
+	for name, checker := range he.componentChecks {
+		health := checker.CheckHealth()
+		switch health.Status {
+		case "unhealthy":
+			overallHealthy = false
+		case "degraded":
+			hasDegraded = true
+		}
+		components[name] = health
+	}
+
 	// Check resource health
 	if runtime.NumGoroutine() > 1000 {
 		hasDegraded = true
@@ -0,0 +1,220 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rama-kairi/go-term/internal/logger"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServerMetrics is a point-in-time view of the server's sessions, commands and rate limiting
+type ServerMetrics struct {
+	Sessions                   int
+	ActiveSessions             int
+	CommandsTotal              int64 // Commands completed since the server started
+	CommandsSuccessful         int64 // Of CommandsTotal, those that exited 0
+	BackgroundProcesses        int
+	RunningBackgroundProcesses int
+	RateLimitRejections        map[string]int64 // Rejected calls per limiter name
+	Goroutines                 int
+}
+
+// SuccessRatio returns the fraction of completed commands that succeeded, 0 before any completes
+func (sm ServerMetrics) SuccessRatio() float64 {
+	if sm.CommandsTotal == 0 {
+		return 0
+	}
+	return float64(sm.CommandsSuccessful) / float64(sm.CommandsTotal)
+}
+
+// MetricsSource supplies the server metrics for each scrape
+type MetricsSource func() ServerMetrics
+
+// MetricsEndpoint serves server metrics in the Prometheus text exposition format on /metrics
+type MetricsEndpoint struct {
+	server      *http.Server
+	source      MetricsSource
+	resourceMon *ResourceMonitor
+	startTime   time.Time
+	logger      *logger.Logger
+}
+
+// NewMetricsEndpoint creates a metrics endpoint that reads source on every scrape. resourceMon
+// is optional; when set, its latest sample adds heap metrics.
+func NewMetricsEndpoint(port int, source MetricsSource, resourceMon *ResourceMonitor, logger *logger.Logger) *MetricsEndpoint {
+	me := &MetricsEndpoint{
+		source:      source,
+		resourceMon: resourceMon,
+		startTime:   time.Now(),
+		logger:      logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", me.handleMetrics)
+
+	me.server = &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	return me
+}
+
+// Start binds the metrics port and serves scrapes in the background. Failing to bind, e.g. because
+// the port is in use, is returned; errors while serving are logged, since stdout carries the MCP
+// protocol.
+func (me *MetricsEndpoint) Start() error {
+	listener, err := net.Listen("tcp", me.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", me.server.Addr, err)
+	}
+
+	go func() {
+		if err := me.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			// The metrics endpoint is optional, so the server keeps running without it
+			me.logger.Error("Metrics endpoint stopped", err, map[string]interface{}{
+				"addr": me.server.Addr,
+			})
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully stops the metrics server
+func (me *MetricsEndpoint) Stop(ctx context.Context) error {
+	return me.server.Shutdown(ctx)
+}
+
+// handleMetrics writes the current metrics for a Prometheus scrape
+func (me *MetricsEndpoint) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	me.writeMetrics(&buf)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.Write(buf.Bytes())
+}
+
+// writeMetrics renders every metric the endpoint exposes
+func (me *MetricsEndpoint) writeMetrics(w io.Writer) {
+	var metrics ServerMetrics
+	if me.source != nil {
+		metrics = me.source()
+	}
+	if metrics.Goroutines == 0 {
+		metrics.Goroutines = runtime.NumGoroutine()
+	}
+	WritePrometheusMetrics(w, metrics)
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	pw := prometheusWriter{w: w}
+	pw.metric("goterm_memory_alloc_bytes", "gauge", "Bytes of allocated heap objects", formatUint(m.Alloc))
+	pw.metric("goterm_uptime_seconds", "gauge", "Seconds since the metrics endpoint was created", formatFloat(time.Since(me.startTime).Seconds()))
+
+	if me.resourceMon != nil {
+		if sample := me.resourceMon.GetCurrentMetrics(); !sample.Timestamp.IsZero() {
+			pw.metric("goterm_resource_monitor_heap_inuse_megabytes", "gauge", "Heap in use at the resource monitor's latest sample, in megabytes", formatUint(sample.MemoryHeapInuse))
+			pw.metric("goterm_resource_monitor_heap_objects", "gauge", "Live heap objects at the resource monitor's latest sample", formatUint(sample.MemoryHeapObjs))
+			pw.metric("goterm_resource_monitor_sample_timestamp_seconds", "gauge", "Unix time of the resource monitor's latest sample", strconv.FormatInt(sample.Timestamp.Unix(), 10))
+		}
+	}
+}
+
+// WritePrometheusMetrics writes server metrics in the Prometheus text exposition format, each
+// family preceded by its HELP and TYPE lines
+func WritePrometheusMetrics(w io.Writer, metrics ServerMetrics) {
+	pw := prometheusWriter{w: w}
+
+	pw.metric("goterm_sessions", "gauge", "Terminal sessions currently held by the server", strconv.Itoa(metrics.Sessions))
+	pw.metric("goterm_sessions_active", "gauge", "Terminal sessions currently marked active", strconv.Itoa(metrics.ActiveSessions))
+	pw.metric("goterm_commands_total", "counter", "Commands completed since the server started, foreground and background", formatInt(metrics.CommandsTotal))
+	pw.metric("goterm_commands_successful_total", "counter", "Commands that exited 0 since the server started", formatInt(metrics.CommandsSuccessful))
+	pw.metric("goterm_command_success_ratio", "gauge", "Fraction of completed commands that succeeded (0 before any completes)", formatFloat(metrics.SuccessRatio()))
+	pw.metric("goterm_background_processes", "gauge", "Background processes tracked across all sessions", strconv.Itoa(metrics.BackgroundProcesses))
+	pw.metric("goterm_background_processes_running", "gauge", "Tracked background processes that are still running", strconv.Itoa(metrics.RunningBackgroundProcesses))
+
+	limiters := make([]string, 0, len(metrics.RateLimitRejections))
+	for limiter := range metrics.RateLimitRejections {
+		limiters = append(limiters, limiter)
+	}
+	sort.Strings(limiters)
+	pw.header("goterm_rate_limit_rejections_total", "counter", "Tool calls rejected by a rate limiter since the server started")
+	for _, limiter := range limiters {
+		pw.sample("goterm_rate_limit_rejections_total", `limiter="`+escapeLabelValue(limiter)+`"`, formatInt(metrics.RateLimitRejections[limiter]))
+	}
+
+	pw.metric("goterm_goroutines", "gauge", "Goroutines that currently exist", strconv.Itoa(metrics.Goroutines))
+}
+
+// prometheusWriter writes metric families in the text exposition format
+type prometheusWriter struct {
+	w io.Writer
+}
+
+// header writes a family's HELP and TYPE lines
+func (pw prometheusWriter) header(name, metricType, help string) {
+	fmt.Fprintf(pw.w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(pw.w, "# TYPE %s %s\n", name, metricType)
+}
+
+// sample writes one sample line; labels is the already formatted label list, or empty
+func (pw prometheusWriter) sample(name, labels, value string) {
+	if labels != "" {
+		fmt.Fprintf(pw.w, "%s{%s} %s\n", name, labels, value)
+		return
+	}
+	fmt.Fprintf(pw.w, "%s %s\n", name, value)
+}
+
+// metric writes a family that has a single unlabelled sample
+func (pw prometheusWriter) metric(name, metricType, help, value string) {
+	pw.header(name, metricType, help)
+	pw.sample(name, "", value)
+}
+
+// helpReplacer escapes HELP text as the exposition format requires
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// labelValueReplacer escapes label values as the exposition format requires
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+func formatUint(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	var b strings.Builder
+	WritePrometheusMetrics(&b, ServerMetrics{
+		Sessions:                   3,
+		ActiveSessions:             2,
+		CommandsTotal:              4,
+		CommandsSuccessful:         3,
+		BackgroundProcesses:        2,
+		RunningBackgroundProcesses: 1,
+		RateLimitRejections:        map[string]int64{"session": 5, "global": 1},
+		Goroutines:                 42,
+	})
+	output := b.String()
+
+	for _, want := range []string{
+		"# HELP goterm_sessions_active ",
+		"# TYPE goterm_sessions_active gauge\ngoterm_sessions_active 2\n",
+		"# TYPE goterm_commands_total counter\ngoterm_commands_total 4\n",
+		"goterm_commands_successful_total 3\n",
+		"goterm_command_success_ratio 0.75\n",
+		"goterm_background_processes 2\n",
+		"goterm_background_processes_running 1\n",
+		"# TYPE goterm_rate_limit_rejections_total counter\n" +
+			"goterm_rate_limit_rejections_total{limiter=\"global\"} 1\n" +
+			"goterm_rate_limit_rejections_total{limiter=\"session\"} 5\n",
+		"goterm_goroutines 42\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	// Every sample belongs to a family announced by HELP and TYPE lines
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		if !typed[name] {
+			t.Errorf("Sample %q has no TYPE line before it", line)
+		}
+	}
+
+	// No commands yet reports a ratio of 0 rather than NaN
+	b.Reset()
+	WritePrometheusMetrics(&b, ServerMetrics{})
+	if !strings.Contains(b.String(), "goterm_command_success_ratio 0\n") {
+		t.Errorf("Expected a zero success ratio without commands, got:\n%s", b.String())
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	endpoint := NewMetricsEndpoint(0, func() ServerMetrics {
+		return ServerMetrics{Sessions: 1, ActiveSessions: 1}
+	}, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	endpoint.handleMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text content type, got %q", contentType)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "goterm_sessions_active 1\n") || !strings.Contains(body, "goterm_memory_alloc_bytes ") {
+		t.Errorf("Expected session and memory metrics, got:\n%s", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	endpoint.handleMetrics(recorder, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestMetricsEndpointStartReportsBindFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if err := NewMetricsEndpoint(port, nil, nil, nil).Start(); err == nil {
+		t.Error("Expected Start to fail while the port is in use")
+	}
+
+	listener.Close()
+	endpoint := NewMetricsEndpoint(port, nil, nil, nil)
+	if err := endpoint.Start(); err != nil {
+		t.Fatalf("Expected Start to bind a free port, got %v", err)
+	}
+	defer endpoint.Stop(context.Background())
+
+	resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to scrape the started endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
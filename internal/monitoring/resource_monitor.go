@@ -66,6 +66,11 @@ func (rm *ResourceMonitor) SetCounters(sessionCounter, processCounter func() int
 	rm.processCounter = processCounter
 }
 
+// GoroutineBaseline returns the goroutine count recorded when the monitor was created
+func (rm *ResourceMonitor) GoroutineBaseline() int {
+	return rm.baselineGoroutines
+}
+
 // Start begins resource monitoring
 func (rm *ResourceMonitor) Start(ctx context.Context) {
 	rm.ticker = time.NewTicker(rm.interval)
@@ -191,6 +196,14 @@ func (rm *ResourceMonitor) checkForLeaks() {
 	}
 }
 
+// Sample records a measurement and runs the leak check immediately instead of waiting for the
+// next tick, returning the resulting summary
+func (rm *ResourceMonitor) Sample() map[string]interface{} {
+	rm.recordMetrics()
+	rm.checkForLeaks()
+	return rm.GetResourceSummary()
+}
+
 // GetCurrentMetrics returns the current resource metrics
 func (rm *ResourceMonitor) GetCurrentMetrics() ResourceMetrics {
 	rm.mutex.RLock()
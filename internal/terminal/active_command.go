@@ -0,0 +1,148 @@
+package terminal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// liveOutputLimit is how much of a running command's output is kept for GetActiveCommandOutput;
+// older output is dropped from the front
+const liveOutputLimit = 1024 * 1024
+
+// liveCommand collects a foreground command's output as it is produced, so it can be read before
+// the command completes, and passes it on to the command's stream recorder. A nil *liveCommand
+// discards writes.
+type liveCommand struct {
+	mutex      sync.Mutex
+	command    string
+	commandID  string          // History ID the command will be stored under, if any
+	stream     *streamRecorder // nil when stream chunks are not recorded
+	startTime  time.Time
+	endTime    time.Time
+	running    bool
+	exitCode   int
+	output     []byte
+	totalBytes int
+	lastOutput time.Time // When output was last written; zero until the command writes any
+}
+
+// ActiveCommandOutput is a snapshot of the foreground command most recently started in a session
+type ActiveCommandOutput struct {
+	Command    string    `json:"command"`
+	CommandID  string    `json:"command_id,omitempty"` // History ID the command is stored under once it finishes
+	Running    bool      `json:"running"`
+	StartTime  time.Time `json:"start_time"`
+	Elapsed    string    `json:"elapsed"`             // Time since start, or the total duration once finished
+	ExitCode   *int      `json:"exit_code,omitempty"` // Set once the command has finished
+	Output     string    `json:"output"`
+	TotalBytes int       `json:"total_bytes"` // Bytes produced so far, including any dropped from the front
+	Truncated  bool      `json:"truncated"`   // Output holds only the most recent bytes
+}
+
+// Write appends standard output produced by the command, see WriteStream
+func (l *liveCommand) Write(p []byte) (int, error) {
+	l.WriteStream(database.ChunkTypeStdout, p)
+	return len(p), nil
+}
+
+// WriteStream appends output of chunkType produced by the command, keeping at most liveOutputLimit
+// bytes, and records it as stream chunks
+func (l *liveCommand) WriteStream(chunkType string, p []byte) {
+	if l == nil {
+		return
+	}
+	l.stream.write(chunkType, p)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.output = append(l.output, p...)
+	l.totalBytes += len(p)
+	l.lastOutput = time.Now()
+	// Trim only once the buffer is twice the limit so trimming is amortized across writes
+	if len(l.output) > 2*liveOutputLimit {
+		l.output = append(l.output[:0:0], l.output[len(l.output)-liveOutputLimit:]...)
+	}
+}
+
+// idleSince returns when the command last wrote output, or when it started if it has written none
+func (l *liveCommand) idleSince() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.lastOutput.IsZero() {
+		return l.startTime
+	}
+	return l.lastOutput
+}
+
+// finish marks the command as completed with exitCode and closes its stream recorder, returning
+// the number of stream chunks recorded
+func (l *liveCommand) finish(exitCode int) int {
+	chunks := l.stream.close(exitCode)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.running = false
+	l.exitCode = exitCode
+	l.endTime = time.Now()
+	return chunks
+}
+
+// snapshot returns the command's state and the output captured so far
+func (l *liveCommand) snapshot() *ActiveCommandOutput {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	output := l.output
+	if len(output) > liveOutputLimit {
+		output = output[len(output)-liveOutputLimit:]
+	}
+	snapshot := &ActiveCommandOutput{
+		Command:    l.command,
+		CommandID:  l.commandID,
+		Running:    l.running,
+		StartTime:  l.startTime,
+		Output:     string(output),
+		TotalBytes: l.totalBytes,
+		Truncated:  len(output) < l.totalBytes,
+	}
+	if l.running {
+		snapshot.Elapsed = time.Since(l.startTime).Round(time.Millisecond).String()
+	} else {
+		exitCode := l.exitCode
+		snapshot.ExitCode = &exitCode
+		snapshot.Elapsed = l.endTime.Sub(l.startTime).Round(time.Millisecond).String()
+	}
+	return snapshot
+}
+
+// startLiveCommand makes command the session's active foreground command and returns the collector
+// its output should be written to, which also feeds stream, if any. Concurrent commands each get
+// their own collector; the session reports the one started last.
+func (s *Session) startLiveCommand(command, commandID string, stream *streamRecorder) *liveCommand {
+	live := &liveCommand{command: command, commandID: commandID, stream: stream, startTime: time.Now(), running: true}
+	s.liveMu.Lock()
+	s.liveCommand = live
+	s.liveMu.Unlock()
+	return live
+}
+
+// GetActiveCommandOutput returns the output captured so far for the foreground command most recently
+// started in the session, whether it is still running or has finished. It returns nil when no
+// foreground command has run in the session yet.
+func (m *Manager) GetActiveCommandOutput(sessionID string) (*ActiveCommandOutput, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %v", err)
+	}
+
+	session.liveMu.Lock()
+	live := session.liveCommand
+	session.liveMu.Unlock()
+	if live == nil {
+		return nil, nil
+	}
+	return live.snapshot(), nil
+}
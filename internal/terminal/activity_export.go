@@ -0,0 +1,151 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// activityExporter serializes writes to the activity metrics file so a periodic snapshot and an
+// on-demand export cannot interleave lines or rotate the file underneath each other
+type activityExporter struct {
+	mu sync.Mutex
+}
+
+// ActivityMetricsRecord is one JSON line of the activity metrics file
+type ActivityMetricsRecord struct {
+	Timestamp time.Time               `json:"timestamp"`
+	Metrics   *SessionActivityMetrics `json:"metrics"`
+}
+
+// ActivityMetricsExport describes one snapshot appended to the activity metrics file
+type ActivityMetricsExport struct {
+	Path         string `json:"path"`
+	Timestamp    string `json:"timestamp"`
+	Sessions     int    `json:"sessions"`
+	BytesWritten int    `json:"bytes_written"`
+	Rotated      bool   `json:"rotated"` // The file was rotated before this snapshot was written
+}
+
+// ExportActivityMetrics appends one line per session to the configured activity metrics file,
+// rotating it first when the snapshot would grow it past activity_metrics_max_size_mb
+func (m *Manager) ExportActivityMetrics() (*ActivityMetricsExport, error) {
+	path := m.config.Monitoring.ActivityMetricsFile
+	if path == "" {
+		return nil, fmt.Errorf("activity metrics export is disabled (activity_metrics_file is not set)")
+	}
+
+	now := time.Now()
+	metrics := m.GetAllSessionActivityMetrics()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].SessionID < metrics[j].SessionID
+	})
+
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, metric := range metrics {
+		if err := encoder.Encode(ActivityMetricsRecord{Timestamp: now, Metrics: metric}); err != nil {
+			return nil, fmt.Errorf("failed to encode activity metrics: %w", err)
+		}
+	}
+
+	export := &ActivityMetricsExport{
+		Path:      path,
+		Timestamp: now.Format(time.RFC3339),
+		Sessions:  len(metrics),
+	}
+	if lines.Len() == 0 {
+		return export, nil
+	}
+
+	m.activityExport.mu.Lock()
+	defer m.activityExport.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create activity metrics directory: %w", err)
+	}
+
+	maxBytes := int64(m.config.Monitoring.ActivityMetricsMaxSizeMB) * 1024 * 1024
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && info.Size()+int64(lines.Len()) > maxBytes {
+		if err := rotateFile(path, m.config.Monitoring.ActivityMetricsMaxBackups); err != nil {
+			return nil, fmt.Errorf("failed to rotate activity metrics file: %w", err)
+		}
+		export.Rotated = true
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open activity metrics file: %w", err)
+	}
+	written, err := file.Write(lines.Bytes())
+	export.BytesWritten = written
+	if err := errors.Join(err, file.Close()); err != nil {
+		return nil, fmt.Errorf("failed to write activity metrics file: %w", err)
+	}
+
+	return export, nil
+}
+
+// rotateFile moves path to path.1, shifting existing backups up by one and dropping any beyond
+// backups. With no backups the file is removed.
+func rotateFile(path string, backups int) error {
+	if backups <= 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, backups)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := backups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// startActivityMetricsExportRoutine periodically appends a snapshot of every session's activity
+// metrics to the configured file, building a time series for offline analysis
+func (m *Manager) startActivityMetricsExportRoutine() {
+	ticker := time.NewTicker(m.config.Monitoring.ActivityMetricsInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.exportActivityMetrics()
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// exportActivityMetrics writes one periodic snapshot, logging failures and rotations
+func (m *Manager) exportActivityMetrics() {
+	export, err := m.ExportActivityMetrics()
+	if err != nil {
+		m.logger.Error("Failed to export session activity metrics", err, map[string]interface{}{
+			"path": m.config.Monitoring.ActivityMetricsFile,
+		})
+		return
+	}
+	if export.Rotated {
+		m.logger.Info("Rotated session activity metrics file", map[string]interface{}{
+			"path":        export.Path,
+			"max_size_mb": m.config.Monitoring.ActivityMetricsMaxSizeMB,
+			"max_backups": m.config.Monitoring.ActivityMetricsMaxBackups,
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Drop policies for background output capture when the line queue is full
+const (
+	DropPolicyBlock      = "block"       // Stop reading until there is room, slowing the process down
+	DropPolicyDropOldest = "drop_oldest" // Discard the oldest queued line to make room
+	DropPolicyDropNewest = "drop_newest" // Discard the line just read
+)
+
+// defaultBackgroundOutputBuffer is used when background_output_buffer is not configured
+const defaultBackgroundOutputBuffer = 100
+
+// droppedLinesMarker is written into captured output where lines were discarded
+const droppedLinesMarker = "[... %d lines dropped ...]\n"
+
+// appendBounded appends newOutput to current while keeping the result within maxLength, dropping
+// the oldest content first and marking the cut with "...". The oversized concatenation is never
+// built, so a flood of output costs at most maxLength bytes.
+func appendBounded(current, newOutput string, maxLength int) string {
+	if maxLength <= 0 || len(current)+len(newOutput) <= maxLength {
+		return current + newOutput
+	}
+
+	keep := maxLength - 3 - len(newOutput)
+	if keep <= 0 {
+		return "..." + newOutput[len(newOutput)-(maxLength-3):]
+	}
+	return "..." + current[len(current)-keep:] + newOutput
+}
+
+// outputLine is a captured line together with the number of lines dropped just before it
+type outputLine struct {
+	text       string
+	dropped    int64
+	markerOnly bool // Carries only a trailing drop count, no line
+}
+
+// captureBackgroundOutput reads r line by line and hands each line to update until r is exhausted,
+// done is closed or ctx is cancelled. Lines pass through a queue of background_output_buffer
+// entries; when it is full, background_drop_policy decides whether reading blocks or lines are
+// dropped, in which case a marker records how many were lost at the point they were lost.
+func (m *Manager) captureBackgroundOutput(ctx context.Context, done <-chan struct{}, r io.Reader, update func(string)) {
+	capacity := m.config.Session.BackgroundOutputBuffer
+	if capacity <= 0 {
+		capacity = defaultBackgroundOutputBuffer
+	}
+	policy := m.config.Session.BackgroundDropPolicy
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanLines)
+
+	lineChan := make(chan outputLine, capacity)
+	// Lines evicted from the front of the queue; they are older than anything still queued
+	var evicted atomic.Int64
+
+	// Scanner goroutine
+	go func() {
+		defer close(lineChan)
+		var pending int64 // Lines dropped since the last queued line (drop_newest)
+		for scanner.Scan() {
+			line := outputLine{text: scanner.Text(), dropped: pending}
+
+			if policy == DropPolicyDropOldest || policy == DropPolicyDropNewest {
+				select {
+				case lineChan <- line:
+					pending = 0
+					continue
+				default:
+				}
+
+				if policy == DropPolicyDropNewest {
+					pending++
+					continue
+				}
+				select {
+				case old := <-lineChan:
+					evicted.Add(old.dropped + 1)
+				default:
+				}
+			}
+
+			select {
+			case lineChan <- line:
+				pending = 0
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		if pending > 0 {
+			select {
+			case lineChan <- outputLine{dropped: pending, markerOnly: true}:
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	// Drain channel until closed or done
+	for {
+		select {
+		case line, ok := <-lineChan:
+			if !ok {
+				return // Channel closed, scanner finished
+			}
+			if n := evicted.Swap(0) + line.dropped; n > 0 {
+				update(fmt.Sprintf(droppedLinesMarker, n))
+			}
+			if !line.markerOnly {
+				update(line.text + "\n")
+			}
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// commandSegment is one simple command in a chain, with the operator that joined it to the
+// previous segment ("" for the first, "&&", ";" or newline)
+type commandSegment struct {
+	joinedBy string
+	text     string
+}
+
+// splitCommandChain splits command at top-level "&&", ";" and newlines, ignoring operators inside
+// quotes. Splitting stops at an operator whose effect on the directory cannot be known from the
+// exit status alone ("||", "|", "&", subshells); only the segments before it are returned.
+func splitCommandChain(command string) (segments []commandSegment) {
+	var current strings.Builder
+	joinedBy := ""
+	var quote byte
+
+	flush := func(next string) {
+		segments = append(segments, commandSegment{joinedBy: joinedBy, text: strings.TrimSpace(current.String())})
+		current.Reset()
+		joinedBy = next
+	}
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(command) {
+				current.WriteByte(c)
+				i++
+				c = command[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\' && i+1 < len(command):
+			current.WriteByte(c)
+			i++
+			c = command[i]
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '&' && i+1 < len(command) && command[i+1] == '&':
+			flush("&&")
+			i++
+			continue
+		case c == ';' || c == '\n':
+			flush(string(c))
+			continue
+		case c == '|' || c == '&' || c == '(' || c == '`':
+			// Redirections such as 2>&1 and >| do not end the chain
+			if i > 0 && (command[i-1] == '>' || command[i-1] == '<') {
+				break
+			}
+			if c == '&' && i+1 < len(command) && command[i+1] == '>' {
+				break
+			}
+			return segments
+		}
+		current.WriteByte(c)
+	}
+	flush("")
+	return segments
+}
+
+// parseCdTarget returns the directory argument of a plain "cd" segment, with shell quoting
+// removed. isCd is false for any other command; target is "" for a bare "cd" (home directory).
+// A "~user" prefix is expanded to that user's home directory; an unknown user is left to the shell.
+func parseCdTarget(segment string) (target string, isCd bool, err error) {
+	words, expands := splitShellWords(segment)
+	if len(words) == 0 || words[0] != "cd" {
+		return "", false, nil
+	}
+	if expands {
+		return "", true, fmt.Errorf("cannot resolve %q without a shell", segment)
+	}
+
+	args := words[1:]
+	for len(args) > 0 && (args[0] == "-L" || args[0] == "-P" || args[0] == "--") {
+		args = args[1:]
+	}
+	switch len(args) {
+	case 0:
+		return "", true, nil
+	case 1:
+		target = args[0]
+		if strings.HasPrefix(target, "~") && target != "~" && !strings.HasPrefix(target, "~/") {
+			name, rest, _ := strings.Cut(target[1:], "/")
+			account, err := user.Lookup(name)
+			if err != nil || account.HomeDir == "" {
+				return "", true, fmt.Errorf("cannot resolve %q without a shell", segment)
+			}
+			target = filepath.Join(account.HomeDir, rest)
+		}
+		return target, true, nil
+	default:
+		return "", true, fmt.Errorf("cd given more than one argument: %q", segment)
+	}
+}
+
+// splitShellWords splits a simple command into words, removing quotes and backslash escapes.
+// expands reports unquoted variables, globs or command substitutions only a shell can resolve.
+func splitShellWords(text string) (words []string, expands bool) {
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(text):
+				i++
+				word.WriteByte(text[i])
+			default:
+				if c == '$' || c == '`' {
+					expands = true
+				}
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\' && i+1 < len(text):
+			i++
+			word.WriteByte(text[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			if strings.IndexByte("$*?[`", c) >= 0 {
+				expands = true
+			}
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, expands
+}
+
+// resolveCdChain follows the cd commands in a chain from startDir and returns the directory the
+// shell ends in and the one it was in before its last cd, which "cd -" returns to; previousDir
+// seeds that for the first hop. Each hop must be an existing, allowed directory; a hop that fails
+// ends an "&&" chain and is skipped after ";". When the command failed, only the leading run of
+// cd hops is trusted, since a later cd may not have been reached. With chains disabled only the
+// first segment is considered, matching the original single-cd detection.
+func (m *Manager) resolveCdChain(startDir, previousDir, home, command string, succeeded bool) (string, string, error) {
+	dir, previous := startDir, previousDir
+	var chainErr error
+	hopFailed := false
+	for _, segment := range m.cdSegments(command) {
+		if hopFailed && segment.joinedBy == "&&" {
+			break
+		}
+		hopFailed = false
+
+		target, isCd, err := parseCdTarget(segment.text)
+		if !isCd {
+			if !succeeded {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			// An unresolvable hop leaves the real directory unknown, so stop tracking here
+			return dir, previous, err
+		}
+
+		resolved, err := m.resolveCdHop(dir, previous, home, target)
+		if err != nil {
+			hopFailed = true
+			if chainErr == nil {
+				chainErr = err
+			}
+			continue
+		}
+		dir, previous = resolved, dir
+	}
+	return dir, previous, chainErr
+}
+
+// cdSegments splits command for directory tracking, keeping only the first segment when chains
+// are disabled
+func (m *Manager) cdSegments(command string) []commandSegment {
+	segments := splitCommandChain(command)
+	if !m.config.Session.ParseCdChains && len(segments) > 1 {
+		segments = segments[:1]
+	}
+	return segments
+}
+
+// cdTargetPath resolves a cd target against dir: "" and "~" are the home directory, "~/" paths
+// are under it and "-" is the previous directory
+func (m *Manager) cdTargetPath(dir, previous, home, target string) (string, error) {
+	switch {
+	case target == "" || target == "~" || strings.HasPrefix(target, "~/"):
+		if home == "" {
+			return "", fmt.Errorf("cd %s: home directory unknown", target)
+		}
+		if target == "" || target == "~" {
+			return home, nil
+		}
+		return filepath.Join(home, target[2:]), nil
+	case target == "-":
+		if previous == "" {
+			return "", fmt.Errorf("cd -: no previous directory")
+		}
+		return previous, nil
+	}
+	return m.resolveDirectoryPath(dir, target), nil
+}
+
+// resolveCdHop resolves one cd target against dir and checks the result is an allowed directory
+func (m *Manager) resolveCdHop(dir, previous, home, target string) (string, error) {
+	resolved, err := m.cdTargetPath(dir, previous, home, target)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("cd %s: %w", target, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cd %s: not a directory", target)
+	}
+	if !m.config.Security.IsWorkingDirAllowed(resolved) {
+		return "", fmt.Errorf("cd %s: outside the allowed working directories", target)
+	}
+	return resolved, nil
+}
+
+// prepareCdTargets checks the cd commands a chain must get through before anything else in it
+// runs: the leading run of cd segments joined by "&&". A target that does not exist is created
+// (like mkdir -p) when the session has auto_create_dirs on and the path is an allowed working
+// directory, and is an error otherwise, so the command is refused instead of leaving the session
+// pointed at a missing directory. Targets only a shell can resolve are left to the shell. The
+// caller must hold session.mutex.
+func (m *Manager) prepareCdTargets(session *Session, command string) error {
+	dir, previous := session.currentDir, session.previousDir
+	home := session.homeDir()
+	for i, segment := range m.cdSegments(command) {
+		if i > 0 && segment.joinedBy != "&&" {
+			return nil
+		}
+		target, isCd, err := parseCdTarget(segment.text)
+		if !isCd || err != nil {
+			return nil
+		}
+
+		resolved, err := m.cdTargetPath(dir, previous, home, target)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(resolved)
+		switch {
+		case err == nil && !info.IsDir():
+			return fmt.Errorf("cd %s: %s is not a directory", target, resolved)
+		case os.IsNotExist(err) && session.AutoCreateDirs:
+			if !m.config.Security.IsWorkingDirAllowed(resolved) {
+				return fmt.Errorf("cd %s: %s does not exist and is outside the allowed working directories", target, resolved)
+			}
+			if err := os.MkdirAll(resolved, 0755); err != nil {
+				return fmt.Errorf("cd %s: failed to create %s: %w", target, resolved, err)
+			}
+			m.logger.Info("Created directory for cd", map[string]interface{}{
+				"session_id": session.ID,
+				"directory":  resolved,
+			})
+		case os.IsNotExist(err):
+			return fmt.Errorf("cd %s: directory %s does not exist", target, resolved)
+		case err != nil:
+			return fmt.Errorf("cd %s: %w", target, err)
+		}
+		dir, previous = resolved, dir
+	}
+	return nil
+}
+
+// trackDirectoryChange moves the session to the directory its cd chain ended in. The caller must
+// hold session.mutex.
+func (m *Manager) trackDirectoryChange(session *Session, command string, succeeded bool) {
+	dir, previous, err := m.resolveCdChain(session.currentDir, session.previousDir, session.homeDir(), command, succeeded)
+	if err != nil {
+		m.logger.Debug("Directory tracking stopped mid-chain", map[string]interface{}{
+			"session_id": session.ID,
+			"command":    command,
+			"error":      err.Error(),
+		})
+	}
+	session.currentDir, session.previousDir = dir, previous
+}
+
+// homeDir returns the directory a bare "cd" goes to: the session's HOME if set, otherwise the
+// server's home directory, or "" when neither is known
+func (s *Session) homeDir() string {
+	if home := s.shellEnv["HOME"]; home != "" {
+		return home
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
@@ -0,0 +1,109 @@
+package terminal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cleanupPause suspends the automatic cleanup routines until a deadline, so bulk work is not
+// reaped mid-flight. The timer resumes cleanup on its own if nobody calls ResumeCleanup.
+type cleanupPause struct {
+	mu     sync.Mutex
+	until  time.Time
+	reason string
+	timer  *time.Timer
+}
+
+// CleanupPauseStatus describes whether the automatic cleanup routines are paused
+type CleanupPauseStatus struct {
+	Paused bool   `json:"paused"`
+	Until  string `json:"until,omitempty"` // RFC3339 time cleanup resumes automatically
+	Reason string `json:"reason,omitempty"`
+}
+
+// PauseCleanup suspends cleanupInactiveSessions and cleanupResources for duration, which may not
+// exceed max_cleanup_pause. Pausing again replaces the previous deadline.
+func (m *Manager) PauseCleanup(duration time.Duration, reason string) (CleanupPauseStatus, error) {
+	maxPause := m.config.Session.MaxCleanupPause
+	if maxPause <= 0 {
+		return CleanupPauseStatus{}, fmt.Errorf("pausing cleanup is disabled (max_cleanup_pause is 0)")
+	}
+	if duration <= 0 {
+		return CleanupPauseStatus{}, fmt.Errorf("pause duration must be greater than 0")
+	}
+	if duration > maxPause {
+		return CleanupPauseStatus{}, fmt.Errorf("pause duration %s exceeds max_cleanup_pause %s", duration, maxPause)
+	}
+
+	p := &m.cleanupPause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	until := time.Now().Add(duration)
+	p.until = until
+	p.reason = reason
+	p.timer = time.AfterFunc(duration, func() {
+		if m.resumeCleanup(until) {
+			m.logger.Info("Automatic cleanup resumed after pause timeout", map[string]interface{}{
+				"paused_for": duration.String(),
+			})
+		}
+	})
+
+	m.logger.Info("Automatic cleanup paused", map[string]interface{}{
+		"duration": duration.String(),
+		"until":    until.Format(time.RFC3339),
+		"reason":   reason,
+	})
+
+	return CleanupPauseStatus{Paused: true, Until: until.Format(time.RFC3339), Reason: reason}, nil
+}
+
+// ResumeCleanup lifts a pause early and reports whether cleanup was paused
+func (m *Manager) ResumeCleanup() bool {
+	if !m.resumeCleanup(time.Time{}) {
+		return false
+	}
+	m.logger.Info("Automatic cleanup resumed")
+	return true
+}
+
+// resumeCleanup clears the pause and reports whether one was active. A non-zero deadline only
+// clears the pause it belongs to, so a superseded timer cannot end a newer pause.
+func (m *Manager) resumeCleanup(deadline time.Time) bool {
+	p := &m.cleanupPause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.until.IsZero() || (!deadline.IsZero() && !p.until.Equal(deadline)) {
+		return false
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.until = time.Time{}
+	p.reason = ""
+	return true
+}
+
+// CleanupPauseStatus reports whether the automatic cleanup routines are currently paused
+func (m *Manager) CleanupPauseStatus() CleanupPauseStatus {
+	p := &m.cleanupPause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.until.IsZero() || time.Now().After(p.until) {
+		return CleanupPauseStatus{}
+	}
+	return CleanupPauseStatus{Paused: true, Until: p.until.Format(time.RFC3339), Reason: p.reason}
+}
+
+// cleanupPaused reports whether a periodic cleanup pass should be skipped
+func (m *Manager) cleanupPaused() bool {
+	return m.CleanupPauseStatus().Paused
+}
@@ -0,0 +1,140 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxSessionAliases bounds how many aliases one session may define
+	MaxSessionAliases = 100
+	// maxAliasExpansions bounds how many aliases are expanded in turn for one command
+	maxAliasExpansions = 10
+)
+
+// aliasNamePattern matches alias names: a single word such as gs or build.dev
+var aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:+-]*$`)
+
+// AliasExpansion describes how a command's first word was expanded through session aliases
+type AliasExpansion struct {
+	Original string   `json:"original"` // Command as given
+	Expanded string   `json:"expanded"` // Command that was validated and run
+	Aliases  []string `json:"aliases"`  // Aliases expanded, in order
+}
+
+// CommandAlias is one alias of a session
+type CommandAlias struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// ExpandAlias replaces the first word of command with the alias it names, then does the same for
+// the first word of the result, at most maxAliasExpansions times. As in shells, an alias is not
+// expanded again once used, so `ls` may alias `ls -la`. Leading whitespace is dropped from an
+// expanded command. It returns nil when command does not start with an alias.
+func (s *Session) ExpandAlias(command string) (*AliasExpansion, error) {
+	s.aliasMu.RLock()
+	defer s.aliasMu.RUnlock()
+
+	expanded := command
+	var used []string
+	for {
+		trimmed := strings.TrimLeftFunc(expanded, unicode.IsSpace)
+		name, rest := trimmed, ""
+		if end := strings.IndexFunc(trimmed, unicode.IsSpace); end >= 0 {
+			name, rest = trimmed[:end], trimmed[end:]
+		}
+
+		replacement, ok := s.aliases[name]
+		if !ok || containsString(used, name) {
+			break
+		}
+		if len(used) == maxAliasExpansions {
+			return nil, fmt.Errorf("alias expansion of %q exceeds %d levels (%s)", command, maxAliasExpansions, strings.Join(used, " -> "))
+		}
+		used = append(used, name)
+		expanded = replacement + rest
+	}
+
+	if len(used) == 0 {
+		return nil, nil
+	}
+	return &AliasExpansion{Original: command, Expanded: expanded, Aliases: used}, nil
+}
+
+// containsString reports whether values holds value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedAliases returns the session's aliases sorted by name; the caller must hold aliasMu
+func (s *Session) sortedAliases() []CommandAlias {
+	aliases := make([]CommandAlias, 0, len(s.aliases))
+	for name, command := range s.aliases {
+		aliases = append(aliases, CommandAlias{Name: name, Command: command})
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Name < aliases[j].Name
+	})
+	return aliases
+}
+
+// SetSessionAlias defines the alias name for command in a session, replacing any previous
+// definition, or removes it when command is empty. It returns the session's aliases afterwards.
+func (m *Manager) SetSessionAlias(sessionID, name, command string) ([]CommandAlias, error) {
+	if !aliasNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid alias name %q: use a single word of letters, digits and _ . : + -", name)
+	}
+	command = strings.TrimSpace(command)
+
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.aliasMu.Lock()
+	defer session.aliasMu.Unlock()
+
+	if command == "" {
+		if _, exists := session.aliases[name]; !exists {
+			return nil, fmt.Errorf("alias %q is not defined in session %s", name, sessionID)
+		}
+		delete(session.aliases, name)
+	} else {
+		if _, exists := session.aliases[name]; !exists && len(session.aliases) >= MaxSessionAliases {
+			return nil, fmt.Errorf("session %s already has the maximum of %d aliases", sessionID, MaxSessionAliases)
+		}
+		if session.aliases == nil {
+			session.aliases = make(map[string]string)
+		}
+		session.aliases[name] = command
+	}
+
+	m.logger.Info("Updated session command alias", map[string]interface{}{
+		"session_id": sessionID,
+		"alias":      name,
+		"removed":    command == "",
+	})
+
+	return session.sortedAliases(), nil
+}
+
+// GetSessionAliases returns a session's aliases sorted by name
+func (m *Manager) GetSessionAliases(sessionID string) ([]CommandAlias, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.aliasMu.RLock()
+	defer session.aliasMu.RUnlock()
+	return session.sortedAliases(), nil
+}
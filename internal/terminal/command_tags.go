@@ -0,0 +1,133 @@
+package terminal
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// autoTags maps executables to the history tag added when a command runs them
+var autoTags = map[string]string{
+	"git":            "git",
+	"npm":            "npm",
+	"npx":            "npm",
+	"yarn":           "yarn",
+	"pnpm":           "pnpm",
+	"bun":            "bun",
+	"node":           "node",
+	"deno":           "deno",
+	"docker":         "docker",
+	"docker-compose": "docker",
+	"podman":         "podman",
+	"kubectl":        "kubectl",
+	"helm":           "helm",
+	"go":             "go",
+	"cargo":          "cargo",
+	"rustc":          "cargo",
+	"make":           "make",
+	"python":         "python",
+	"python3":        "python",
+	"pip":            "pip",
+	"pip3":           "pip",
+	"uv":             "uv",
+	"poetry":         "poetry",
+	"pytest":         "pytest",
+	"terraform":      "terraform",
+}
+
+// commandPrefixes are wrappers and shell keywords that run the command after them, so the
+// executable is looked for past them
+var commandPrefixes = map[string]bool{
+	"sudo":    true,
+	"env":     true,
+	"time":    true,
+	"nohup":   true,
+	"exec":    true,
+	"command": true,
+	"nice":    true,
+	"{":       true,
+	"!":       true,
+	"if":      true,
+	"then":    true,
+	"else":    true,
+	"elif":    true,
+	"do":      true,
+	"while":   true,
+	"until":   true,
+}
+
+// CommandTags returns the history tags for command: the explicit tags plus one for each known tool
+// (git, npm, docker, ...) that the command runs, normalized with database.NormalizeTags
+func CommandTags(command string, explicit []string) []string {
+	tags := append([]string(nil), explicit...)
+	for _, name := range commandExecutables(command) {
+		if tag, ok := autoTags[name]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	return database.NormalizeTags(tags)
+}
+
+// commandExecutables returns the lowercased base name of the executable each simple command in
+// command runs, splitting at pipes, lists and subshells outside quotes. Leading variable
+// assignments and wrappers such as sudo are skipped.
+func commandExecutables(command string) []string {
+	var names []string
+	for _, segment := range splitSimpleCommands(command) {
+		words, _ := splitShellWords(segment)
+		for len(words) > 0 && (strings.Contains(words[0], "=") || commandPrefixes[words[0]] || strings.HasPrefix(words[0], "-")) {
+			words = words[1:]
+		}
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		names = append(names, strings.ToLower(filepath.Base(words[0])))
+	}
+	return names
+}
+
+// splitSimpleCommands splits command at every top-level shell operator ("|", "&", ";", newlines,
+// parentheses and backquotes), ignoring operators inside quotes
+func splitSimpleCommands(command string) []string {
+	var segments []string
+	var current strings.Builder
+	var quote byte
+
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			segments = append(segments, text)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(command) {
+				current.WriteByte(c)
+				i++
+				c = command[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\' && i+1 < len(command):
+			current.WriteByte(c)
+			i++
+			c = command[i]
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.IndexByte("|&;\n()`", c) >= 0:
+			// Redirections such as 2>&1 and &> do not start a new command
+			if c == '&' && ((i > 0 && (command[i-1] == '>' || command[i-1] == '<')) || (i+1 < len(command) && command[i+1] == '>')) {
+				break
+			}
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return segments
+}
@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// routineState tracks a periodic maintenance routine so its health can be inspected
+type routineState struct {
+	running atomic.Bool
+	runs    atomic.Int64
+	lastRun atomic.Int64 // Unix nanoseconds of the last completed run, 0 if never run
+}
+
+// recordRun marks one completed pass of the routine
+func (rs *routineState) recordRun() {
+	rs.runs.Add(1)
+	rs.lastRun.Store(time.Now().UnixNano())
+}
+
+// diagnostics reports the routine state alongside its configured interval
+func (rs *routineState) diagnostics(interval time.Duration) RoutineDiagnostics {
+	diag := RoutineDiagnostics{
+		Running:  rs.running.Load(),
+		Interval: interval.String(),
+		Runs:     rs.runs.Load(),
+	}
+	if last := rs.lastRun.Load(); last != 0 {
+		diag.LastRun = time.Unix(0, last).Format(time.RFC3339)
+	}
+	return diag
+}
+
+// commandTotals counts completed commands across all sessions. Unlike the per-session counts
+// loaded from the database, it only ever grows, so it can back Prometheus counters.
+type commandTotals struct {
+	total      atomic.Int64
+	successful atomic.Int64
+}
+
+// record counts one completed command
+func (ct *commandTotals) record(success bool) {
+	ct.total.Add(1)
+	if success {
+		ct.successful.Add(1)
+	}
+}
+
+// CommandTotals returns how many commands, foreground and background, completed since the server
+// started and how many of them succeeded
+func (m *Manager) CommandTotals() (total, successful int64) {
+	return m.commandTotals.total.Load(), m.commandTotals.successful.Load()
+}
+
+// RoutineDiagnostics describes a periodic maintenance routine
+type RoutineDiagnostics struct {
+	Running  bool   `json:"running"`
+	Interval string `json:"interval"`
+	Runs     int64  `json:"runs"`
+	LastRun  string `json:"last_run,omitempty"`
+}
+
+// ManagerDiagnostics is a read-only snapshot of the manager's internal counters
+type ManagerDiagnostics struct {
+	Sessions                   int                `json:"sessions"`
+	ActiveSessions             int                `json:"active_sessions"`
+	MaxSessions                int                `json:"max_sessions"`
+	BackgroundProcesses        int                `json:"background_processes"`
+	RunningBackgroundProcesses int                `json:"running_background_processes"`
+	Goroutines                 int                `json:"goroutines"`
+	ShuttingDown               bool               `json:"shutting_down"`
+	DatabaseAttached           bool               `json:"database_attached"`
+	WebhookEnabled             bool               `json:"webhook_enabled"`
+	CleanupRoutine             RoutineDiagnostics `json:"cleanup_routine"`
+	ResourceCleanupRoutine     RoutineDiagnostics `json:"resource_cleanup_routine"`
+	CleanupPause               CleanupPauseStatus `json:"cleanup_pause"`
+	StuckProcesses             int                `json:"stuck_processes"` // Processes that survived SIGKILL and are not reaped yet
+}
+
+// Diagnostics returns a snapshot of the manager's internal state for debugging. It only
+// reports counters and flags, never session contents such as environments or output.
+func (m *Manager) Diagnostics() ManagerDiagnostics {
+	diag := ManagerDiagnostics{
+		MaxSessions:            m.config.Session.MaxSessions,
+		Goroutines:             runtime.NumGoroutine(),
+		ShuttingDown:           m.ctx.Err() != nil,
+		DatabaseAttached:       m.database != nil,
+		WebhookEnabled:         m.commandWebhook != nil,
+		CleanupRoutine:         m.cleanupState.diagnostics(m.config.Session.CleanupInterval),
+		ResourceCleanupRoutine: m.resourceCleanupState.diagnostics(m.config.Session.ResourceCleanupInterval),
+		CleanupPause:           m.CleanupPauseStatus(),
+		StuckProcesses:         len(m.StuckProcesses()),
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	diag.Sessions = len(m.sessions)
+	for _, session := range m.sessions {
+		session.mutex.RLock()
+		if session.IsActive {
+			diag.ActiveSessions++
+		}
+		diag.BackgroundProcesses += len(session.BackgroundProcesses)
+		for _, proc := range session.BackgroundProcesses {
+			proc.Mutex.RLock()
+			if proc.IsRunning {
+				diag.RunningBackgroundProcesses++
+			}
+			proc.Mutex.RUnlock()
+		}
+		session.mutex.RUnlock()
+	}
+
+	return diag
+}
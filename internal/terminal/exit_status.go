@@ -0,0 +1,78 @@
+package terminal
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Exit reasons reported in ExitStatus
+const (
+	ExitReasonExited     = "exited"       // Exited with code 0
+	ExitReasonNonZero    = "nonzero_exit" // Exited with a nonzero code, or could not be waited on
+	ExitReasonTimeout    = "timeout"      // Killed when background_process_timeout elapsed; exit code 124
+	ExitReasonSignaled   = "signaled"     // Killed by a signal the server did not send, e.g. the OOM killer
+	ExitReasonTerminated = "terminated"   // Stopped by a signal the server sent, e.g. terminate_background_process
+	ExitReasonVanished   = "vanished"     // PID gone without the server seeing the exit; exit code unknown (-1)
+)
+
+// unknownExitCode is reported for processes whose exit the server never observed
+const unknownExitCode = -1
+
+// timeoutExitCode is reported for processes killed on timeout, as the timeout utility does
+const timeoutExitCode = 124
+
+// ExitStatus describes how a background process ended
+type ExitStatus struct {
+	Reason     string `json:"reason"`
+	ExitCode   int    `json:"exit_code"`
+	Signal     string `json:"signal,omitempty"`      // Signal that ended the process, when it was killed by one
+	SignalSent string `json:"signal_sent,omitempty"` // Last signal the server sent the process, if any
+}
+
+// crashSignalNames names the signals a process commonly dies of besides the termination signals
+var crashSignalNames = map[syscall.Signal]string{
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+}
+
+// classifyExit builds the exit status of a process from the error cmd.Wait returned. timedOut
+// reports that the process's timeout killed it; signalSent is the last signal the server sent.
+func classifyExit(execErr error, timedOut bool, signalSent string) ExitStatus {
+	status := ExitStatus{Reason: ExitReasonExited, SignalSent: signalSent}
+	if execErr != nil {
+		status.Reason = ExitReasonNonZero
+		status.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(execErr, &exitErr) {
+			status.ExitCode = exitErr.ExitCode()
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				status.Signal = signalName(ws.Signal())
+				status.Reason = ExitReasonSignaled
+			}
+		}
+	}
+
+	switch {
+	case timedOut:
+		status.Reason = ExitReasonTimeout
+		status.ExitCode = timeoutExitCode
+	case signalSent != "":
+		status.Reason = ExitReasonTerminated
+	}
+	return status
+}
+
+// noteSignalSent records that the server is about to send sig to the process, so its exit is
+// reported as terminated rather than as a crash
+func (bp *BackgroundProcess) noteSignalSent(sig syscall.Signal) {
+	bp.Mutex.Lock()
+	bp.signalSent = signalName(sig)
+	bp.Mutex.Unlock()
+}
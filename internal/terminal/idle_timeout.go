@@ -0,0 +1,39 @@
+package terminal
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Why a foreground command was stopped before it finished, see CommandOutput.TimeoutReason
+const (
+	TimeoutReasonTotal = "total" // It ran for longer than its timeout
+	TimeoutReasonIdle  = "idle"  // It produced no output for its idle timeout
+)
+
+// watchIdle calls cancel once live has written no output for idle and returns a function that
+// reports whether it did. Each write pushes the deadline back, so a command that keeps printing
+// progress is never stopped by it. Watching ends with ctx.
+func watchIdle(ctx context.Context, cancel context.CancelFunc, live *liveCommand, idle time.Duration) func() bool {
+	var idled atomic.Bool
+	go func() {
+		timer := time.NewTimer(idle)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			remaining := idle - time.Since(live.idleSince())
+			if remaining <= 0 {
+				idled.Store(true)
+				cancel()
+				return
+			}
+			timer.Reset(remaining)
+		}
+	}()
+	return idled.Load
+}
@@ -0,0 +1,90 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// truncationMarker prefixes captured output once its oldest content has been dropped
+const truncationMarker = "..."
+
+// ErrOutputCursorUnavailable is returned when output is read by offset from a process that
+// collapses repeated lines, since collapsing rewrites output that was already captured
+var ErrOutputCursorUnavailable = errors.New("output offsets are not available for processes started with dedup_lines")
+
+// outputCursor counts the bytes written to one output stream of a background process, so readers
+// can ask for output since an offset even after background_output_limit dropped older content
+type outputCursor struct {
+	written   int64 // Total bytes ever captured; never decreases
+	truncated bool  // The buffer starts with truncationMarker rather than captured output
+}
+
+// OutputChunk is output captured from one stream of a background process since an offset
+type OutputChunk struct {
+	Data       string
+	Offset     int64 // Offset of Data's first byte; past the requested one when there is a gap
+	NextOffset int64 // Offset to read from next time
+	Gap        bool  // Output between the requested offset and Offset was dropped by the output limit
+	GapBytes   int64 // How many bytes were dropped
+}
+
+// read returns the part of buffer at or after offset. Only the newest bytes of the stream are
+// retained in buffer, so the start of the retained output is derived from the bytes written.
+func (c outputCursor) read(buffer string, offset int64) OutputChunk {
+	retained := int64(len(buffer))
+	if c.truncated {
+		retained -= int64(len(truncationMarker))
+	}
+	if retained > c.written {
+		retained = c.written
+	}
+	start := c.written - retained
+
+	chunk := OutputChunk{Offset: offset, NextOffset: c.written}
+	if offset < start {
+		chunk.Gap = true
+		chunk.GapBytes = start - offset
+		chunk.Offset = start
+	}
+	chunk.Data = buffer[int64(len(buffer))-(c.written-chunk.Offset):]
+	return chunk
+}
+
+// ReadOutputSince returns the output (stream stdout) or error output (stream stderr) captured at
+// or after offset, a byte count from the start of the stream. Offsets come from NextOffset or
+// OutputWithOffsets. If background_output_limit dropped part of the requested output, the chunk
+// starts at the oldest byte still held and reports the gap.
+func (bp *BackgroundProcess) ReadOutputSince(stream string, offset int64) (OutputChunk, error) {
+	bp.Mutex.RLock()
+	defer bp.Mutex.RUnlock()
+
+	if bp.dedupLines {
+		return OutputChunk{}, ErrOutputCursorUnavailable
+	}
+
+	cursor, buffer := bp.outputCursor, bp.Output
+	switch stream {
+	case OutputStreamStdout:
+	case OutputStreamStderr:
+		cursor, buffer = bp.errorCursor, bp.ErrorOutput
+	default:
+		return OutputChunk{}, fmt.Errorf("unknown output stream %q", stream)
+	}
+
+	if offset < 0 {
+		return OutputChunk{}, fmt.Errorf("output offset cannot be negative")
+	}
+	if offset > cursor.written {
+		return OutputChunk{}, fmt.Errorf("offset %d is past the end of %s (%d bytes written); the process may have been relaunched under the same ID",
+			offset, stream, cursor.written)
+	}
+	return cursor.read(buffer, offset), nil
+}
+
+// OutputWithOffsets returns the captured output and error output together with the offsets at
+// which each stream will continue, so a later ReadOutputSince picks up exactly where they end
+func (bp *BackgroundProcess) OutputWithOffsets() (output, errorOutput string, stdoutOffset, stderrOffset int64) {
+	bp.Mutex.RLock()
+	defer bp.Mutex.RUnlock()
+	return bp.Output, bp.ErrorOutput, bp.outputCursor.written, bp.errorCursor.written
+}
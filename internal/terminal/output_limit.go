@@ -0,0 +1,84 @@
+package terminal
+
+import "fmt"
+
+// outputTruncatedFormat is the line left in place of output dropped by a foreground output limit
+const outputTruncatedFormat = "[output truncated, %d bytes omitted]\n"
+
+// cappedOutput captures a foreground command's output up to a limit. Once the limit is exceeded
+// it keeps the first and the last half of it, so both how the output starts and the error it
+// usually ends with stay visible, while the command keeps running to completion. A limit of zero
+// or less keeps everything.
+type cappedOutput struct {
+	limit int
+	head  []byte
+	tail  []byte // Newest bytes; holds up to twice tailSize between compactions
+	total int64  // Bytes ever written
+}
+
+// newCappedOutput returns an empty cappedOutput keeping at most limit bytes
+func newCappedOutput(limit int) *cappedOutput {
+	return &cappedOutput{limit: limit}
+}
+
+// tailSize is how many of the newest bytes are kept once the output exceeds the limit
+func (c *cappedOutput) tailSize() int {
+	return c.limit - c.limit/2
+}
+
+// Write appends p, dropping bytes between the head and the tail once the limit is exceeded
+func (c *cappedOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	c.total += int64(n)
+	if c.limit <= 0 {
+		c.head = append(c.head, p...)
+		return n, nil
+	}
+
+	if room := c.limit/2 - len(c.head); room > 0 {
+		take := min(room, len(p))
+		c.head = append(c.head, p[:take]...)
+		p = p[take:]
+	}
+
+	tailSize := c.tailSize()
+	if len(p) >= tailSize {
+		c.tail = append(c.tail[:0], p[len(p)-tailSize:]...)
+		return n, nil
+	}
+	c.tail = append(c.tail, p...)
+	if len(c.tail) > 2*tailSize {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-tailSize:]...)
+	}
+	return n, nil
+}
+
+// omitted returns how many bytes were dropped from the middle of the output
+func (c *cappedOutput) omitted() int64 {
+	if c.limit <= 0 {
+		return 0
+	}
+	kept := len(c.head) + min(len(c.tail), c.tailSize())
+	return c.total - int64(kept)
+}
+
+// Truncated reports whether part of the output was dropped
+func (c *cappedOutput) Truncated() bool {
+	return c.omitted() > 0
+}
+
+// String returns the captured output. When part of it was dropped, the head and tail are joined
+// by a line giving the number of bytes omitted.
+func (c *cappedOutput) String() string {
+	omitted := c.omitted()
+	if omitted <= 0 {
+		return string(c.head) + string(c.tail)
+	}
+
+	tail := c.tail[len(c.tail)-c.tailSize():]
+	separator := ""
+	if len(c.head) > 0 && c.head[len(c.head)-1] != '\n' {
+		separator = "\n"
+	}
+	return string(c.head) + separator + fmt.Sprintf(outputTruncatedFormat, omitted) + string(tail)
+}
@@ -0,0 +1,146 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Streams reported in OutputPatternMatch
+const (
+	OutputStreamStdout = "stdout"
+	OutputStreamStderr = "stderr"
+)
+
+// OutputPatternMatch is the outcome of WaitForOutputPattern
+type OutputPatternMatch struct {
+	Matched bool          // False when the timeout elapsed first
+	Match   string        // Text the pattern matched
+	Stream  string        // Stream the match was found in, stdout or stderr
+	Waited  time.Duration // How long the call blocked
+}
+
+// outputWatcher is matched against a background process's output as it arrives. It sees every
+// captured chunk, so output trimmed by background_output_limit before anyone looked is not missed.
+type outputWatcher struct {
+	re      *regexp.Regexp
+	matched chan struct{} // Closed on the first match
+	match   string
+	stream  string
+}
+
+// check matches text against the watcher, recording the first match. Callers hold the process lock.
+func (w *outputWatcher) check(stream, text string) bool {
+	if w.stream != "" {
+		return true
+	}
+	loc := w.re.FindStringIndex(text)
+	if loc == nil {
+		return false
+	}
+	w.match = text[loc[0]:loc[1]]
+	w.stream = stream
+	close(w.matched)
+	return true
+}
+
+// watchOutput registers a watcher for re. The output captured so far is checked under the same
+// lock that new output is appended with, so nothing that arrived before the watcher attached, or
+// while it was attaching, is missed.
+func (bp *BackgroundProcess) watchOutput(re *regexp.Regexp) *outputWatcher {
+	w := &outputWatcher{re: re, matched: make(chan struct{})}
+
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+
+	if w.check(OutputStreamStdout, bp.Output) || w.check(OutputStreamStderr, bp.ErrorOutput) {
+		return w
+	}
+	bp.outputWatchers = append(bp.outputWatchers, w)
+	return w
+}
+
+// unwatchOutput removes a watcher that is no longer waited on
+func (bp *BackgroundProcess) unwatchOutput(w *outputWatcher) {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+
+	for i, watcher := range bp.outputWatchers {
+		if watcher == w {
+			bp.outputWatchers = append(bp.outputWatchers[:i], bp.outputWatchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// notifyOutputWatchers checks newly captured output against the registered watchers, dropping
+// those that matched. Callers hold the process lock.
+func (bp *BackgroundProcess) notifyOutputWatchers(stream, newOutput string) {
+	if len(bp.outputWatchers) == 0 {
+		return
+	}
+	remaining := bp.outputWatchers[:0]
+	for _, w := range bp.outputWatchers {
+		if !w.check(stream, newOutput) {
+			remaining = append(remaining, w)
+		}
+	}
+	for i := len(remaining); i < len(bp.outputWatchers); i++ {
+		bp.outputWatchers[i] = nil
+	}
+	bp.outputWatchers = remaining
+}
+
+// WaitForOutputPattern blocks until a background process's output or error output matches
+// pattern (a regular expression), or until timeout elapses. A timeout is not an error: the result
+// then reports Matched false. It is an error if the process exits for good without a match.
+func (m *Manager) WaitForOutputPattern(sessionID, processID, pattern string, timeout time.Duration) (*OutputPatternMatch, error) {
+	return m.WaitForOutputPatternWithContext(context.Background(), sessionID, processID, pattern, timeout)
+}
+
+// WaitForOutputPatternWithContext is WaitForOutputPattern, returning ctx's error if ctx is
+// cancelled first
+func (m *Manager) WaitForOutputPatternWithContext(ctx context.Context, sessionID, processID, pattern string, timeout time.Duration) (*OutputPatternMatch, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output pattern: %w", err)
+	}
+
+	bgProcess, err := m.GetBackgroundProcess(sessionID, processID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	w := bgProcess.watchOutput(re)
+	defer bgProcess.unwatchOutput(w)
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// A process that exits for good may still be flushing its last lines, so a match is
+	// preferred over the exit whenever both are ready
+	select {
+	case <-w.matched:
+	case <-bgProcess.done:
+		select {
+		case <-w.matched:
+		default:
+			return nil, fmt.Errorf("process %s exited before its output matched %q", processID, pattern)
+		}
+	case <-deadline.C:
+		return &OutputPatternMatch{Waited: time.Since(start)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	bgProcess.Mutex.RLock()
+	defer bgProcess.Mutex.RUnlock()
+	return &OutputPatternMatch{
+		Matched: true,
+		Match:   w.match,
+		Stream:  w.stream,
+		Waited:  time.Since(start),
+	}, nil
+}
@@ -0,0 +1,95 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// NoOpCommand is the trivial command used to measure fixed per-command overhead
+const NoOpCommand = ":"
+
+// DurationStats summarizes a set of timing samples
+type DurationStats struct {
+	Samples int           `json:"samples"`
+	Mean    time.Duration `json:"mean"`
+	Min     time.Duration `json:"min"`
+	Max     time.Duration `json:"max"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+}
+
+// SummarizeDurations computes mean, min, max and nearest-rank percentiles for samples
+func SummarizeDurations(samples []time.Duration) DurationStats {
+	if len(samples) == 0 {
+		return DurationStats{}
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, sample := range sorted {
+		total += sample
+	}
+
+	return DurationStats{
+		Samples: len(sorted),
+		Mean:    total / time.Duration(len(sorted)),
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		P50:     percentile(sorted, 50),
+		P90:     percentile(sorted, 90),
+		P99:     percentile(sorted, 99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of an ascending slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// MeasureCommandTimings runs command in a session the given number of times and returns
+// the wall-clock duration of each run. Runs go through the same execution path as normal
+// commands but are not recorded in history or counted as session activity.
+func (m *Manager) MeasureCommandTimings(ctx context.Context, sessionID, command string, iterations int) ([]time.Duration, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("iterations must be positive")
+	}
+
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like other commands, runs lock the session only around the state they read, so a measurement
+	// does not block the session while it runs
+	session.mutex.RLock()
+	prefix := session.commandPrefix()
+	session.mutex.RUnlock()
+
+	samples := make([]time.Duration, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return samples, err
+		}
+
+		start := time.Now()
+		_, _, err := m.executeCommandInSession(ctx, session, command, prefix, nil, "")
+		elapsed := time.Since(start)
+		if err != nil {
+			return samples, fmt.Errorf("run %d failed: %w", i+1, err)
+		}
+		samples = append(samples, elapsed)
+	}
+
+	return samples, nil
+}
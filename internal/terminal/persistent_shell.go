@@ -0,0 +1,354 @@
+package terminal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// persistentShellMarker prefixes the line the shell prints after each command, followed by a
+	// per-command random suffix, ":" and the command's exit status
+	persistentShellMarker = "__GO_TERM_DONE_"
+	// persistentShellDrainTimeout is how long to wait for the completion marker after a timed-out
+	// command's processes are killed before the shell is replaced
+	persistentShellDrainTimeout = time.Second
+)
+
+// envNamePattern matches names that can be exported from a shell script
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// persistentShellEnabled reports whether commands run in the session's long-lived shell. The
+// shell is driven with POSIX syntax, so the option has no effect on Windows.
+func (m *Manager) persistentShellEnabled() bool {
+	return m.config.Session.PersistentShell && posixShell
+}
+
+// preparePersistentShell merges the shell's stderr into stdout so output is read from a single,
+// ordered stream, and records the environment and options the shell starts with. The caller must
+// hold the session mutex or own the session exclusively.
+func (m *Manager) preparePersistentShell(session *Session) error {
+	if _, err := io.WriteString(session.stdin, "exec 2>&1\n"); err != nil {
+		return fmt.Errorf("failed to configure persistent shell: %w", err)
+	}
+
+	session.shellReader = bufio.NewReader(session.stdout)
+	session.shellSyncedEnv = make(map[string]string)
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			session.shellSyncedEnv[key] = value
+		}
+	}
+	session.shellSyncedOptions = make(map[string]bool)
+	return nil
+}
+
+// executeInPersistentShell runs command by writing it to the session's long-lived shell and reading
+// its output back up to a random completion marker, so variables, functions, aliases and options set
+// by one command remain for the next. A non-empty stdin is fed to the command from a temporary file.
+// Output is written to output, and to live as it arrives; once this returns nothing more is written
+// to either. shellMu is held for the whole command, session.mutex only while the script is built
+// from the session's directory, environment and options and while the shell is replaced, so the
+// caller must not hold session.mutex.
+func (m *Manager) executeInPersistentShell(ctx context.Context, session *Session, command string, envOverrides map[string]string, stdin string, live *liveCommand, output io.Writer) (int, error) {
+	session.shellMu.Lock()
+	defer session.shellMu.Unlock()
+
+	// The shell's own stdin carries the script, so input for the command comes from a file
+	stdinPath := ""
+	if stdin != "" {
+		path, err := writeStdinFile(stdin)
+		if err != nil {
+			return 1, err
+		}
+		defer os.Remove(path)
+		stdinPath = path
+	}
+
+	marker := persistentShellMarker + strings.ReplaceAll(uuid.New().String(), "-", "")
+	session.mutex.Lock()
+	if session.shellReader == nil || !processAlive(session.shellPid) {
+		if err := m.replacePersistentShell(session); err != nil {
+			session.mutex.Unlock()
+			return 1, err
+		}
+	}
+	script := session.persistentShellScript(command, envOverrides, marker, stdinPath)
+	shellStdin, reader, shellPid := session.stdin, session.shellReader, session.shellPid
+	session.mutex.Unlock()
+
+	// replace restarts the shell under session.mutex after the command has left it unusable
+	replace := func() error {
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		return m.replacePersistentShell(session)
+	}
+
+	if _, err := io.WriteString(shellStdin, script); err != nil {
+		replace()
+		return 1, fmt.Errorf("failed to write to persistent shell: %w", err)
+	}
+
+	type shellResult struct {
+		exitCode int
+		err      error
+	}
+	resultCh := make(chan shellResult, 1)
+	go func() {
+		exitCode, err := readUntilMarker(reader, marker, output, live)
+		resultCh <- shellResult{exitCode, err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		if result.err != nil {
+			// The shell ended before printing the marker, e.g. after `exit` or a failure under errexit
+			session.mutex.Lock()
+			status := m.shellExitStatus(session)
+			err := m.replacePersistentShell(session)
+			session.mutex.Unlock()
+			if err != nil {
+				return status, fmt.Errorf("persistent shell exited with status %d: %w", status, err)
+			}
+			return status, fmt.Errorf("persistent shell exited with status %d; a new shell was started and shell state was reset", status)
+		}
+		if result.exitCode != 0 {
+			return result.exitCode, fmt.Errorf("exit status %d", result.exitCode)
+		}
+		return 0, nil
+
+	case <-ctx.Done():
+		// Stop what the command started but keep the shell, which then prints the marker
+		signalDescendants(shellPid, syscall.SIGTERM)
+		select {
+		case <-resultCh:
+			return 124, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			signalDescendants(shellPid, syscall.SIGKILL)
+		}
+
+		select {
+		case <-resultCh:
+			return 124, ctx.Err()
+		case <-time.After(persistentShellDrainTimeout):
+			// The shell itself is stuck (e.g. waiting on an unterminated quote); replacing it
+			// closes the pipe and ends the read
+			replace()
+			<-resultCh
+			return 124, ctx.Err()
+		}
+	}
+}
+
+// persistentShellScript builds the text written to the shell for one command: pending environment
+// and option changes, a cd to the session directory, the command with stdin detached (or read from
+// stdinPath) so it cannot consume the rest of the script, and the completion marker carrying the
+// exit status. Per-command environment overrides run the command in a subshell so they do not persist.
+func (s *Session) persistentShellScript(command string, envOverrides map[string]string, marker, stdinPath string) string {
+	var script strings.Builder
+	command = runnableCommand(command)
+
+	stdinRedirect := "</dev/null"
+	if stdinPath != "" {
+		stdinRedirect = "<" + shellEscape(stdinPath)
+	}
+
+	for _, line := range s.syncPersistentShellEnv() {
+		script.WriteString(line + "\n")
+	}
+	if line := s.syncPersistentShellOptions(); line != "" {
+		script.WriteString(line + "\n")
+	}
+
+	fmt.Fprintf(&script, "if builtin cd -- %s; then\n", shellEscape(s.currentDir))
+	if s.previousDir != "" {
+		fmt.Fprintf(&script, "OLDPWD=%s\n", shellEscape(s.previousDir))
+	}
+	if len(envOverrides) > 0 {
+		script.WriteString("(\n")
+		for _, key := range sortedKeys(envOverrides) {
+			if envNamePattern.MatchString(key) {
+				fmt.Fprintf(&script, "export %s=%s\n", key, shellEscape(envOverrides[key]))
+			}
+		}
+		script.WriteString(command + "\n) " + stdinRedirect + "\n")
+	} else {
+		script.WriteString("{\n" + command + "\n} " + stdinRedirect + "\n")
+	}
+	script.WriteString("else (exit 1); fi\n")
+	fmt.Fprintf(&script, "builtin printf '\\n%%s:%%d\\n' '%s' \"$?\"\n", marker)
+
+	return script.String()
+}
+
+// writeStdinFile stores input for a persistent shell command in a temporary file and returns its path
+func writeStdinFile(stdin string) (string, error) {
+	file, err := os.CreateTemp("", "go-term-stdin-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create stdin file: %w", err)
+	}
+	_, writeErr := file.WriteString(stdin)
+	closeErr := file.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write stdin file: %v", errors.Join(writeErr, closeErr))
+	}
+	return file.Name(), nil
+}
+
+// syncPersistentShellEnv returns export and unset lines for session variables changed since they
+// were last sent to the shell. Variables the commands themselves export are left alone.
+func (s *Session) syncPersistentShellEnv() []string {
+	var lines []string
+	for _, key := range sortedKeys(s.shellEnv) {
+		value := s.shellEnv[key]
+		if synced, ok := s.shellSyncedEnv[key]; (ok && synced == value) || !envNamePattern.MatchString(key) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("export %s=%s", key, shellEscape(value)))
+		s.shellSyncedEnv[key] = value
+	}
+	for _, key := range sortedKeys(s.shellSyncedEnv) {
+		if _, ok := s.shellEnv[key]; !ok && envNamePattern.MatchString(key) {
+			lines = append(lines, "unset "+key)
+			delete(s.shellSyncedEnv, key)
+		}
+	}
+	return lines
+}
+
+// syncPersistentShellOptions returns a set line for session shell options toggled since they were
+// last sent to the shell, or "" when nothing changed. Options a command sets itself persist.
+func (s *Session) syncPersistentShellOptions() string {
+	var args []string
+	for _, name := range KnownShellOptions {
+		if s.shellOptions[name] == s.shellSyncedOptions[name] {
+			continue
+		}
+		if s.shellOptions[name] {
+			args = append(args, "-o", name)
+		} else {
+			args = append(args, "+o", name)
+		}
+		s.shellSyncedOptions[name] = s.shellOptions[name]
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return "set " + strings.Join(args, " ")
+}
+
+// readUntilMarker reads shell output up to the marker line, writing the output before it to output
+// and to progress, and returns the exit status the marker reports. On a read error everything read
+// so far is written out and the error returned. Output is passed on as it arrives, holding back
+// only what may be part of the marker, so nothing but that partial marker is buffered here.
+func readUntilMarker(reader *bufio.Reader, marker string, output, progress io.Writer) (int, error) {
+	needle := []byte("\n" + marker + ":")
+	var pending bytes.Buffer
+	chunk := make([]byte, 4096)
+	emit := func(data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		output.Write(data)
+		if progress != nil {
+			progress.Write(data)
+		}
+	}
+
+	for {
+		n, err := reader.Read(chunk)
+		pending.Write(chunk[:n])
+
+		data := pending.Bytes()
+		if idx := bytes.Index(data, needle); idx >= 0 {
+			emit(pending.Next(idx))
+			rest := pending.Bytes()[len(needle):]
+			if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+				exitCode, convErr := strconv.Atoi(string(rest[:end]))
+				if convErr != nil {
+					exitCode = 1
+				}
+				return exitCode, nil
+			}
+		} else {
+			emit(pending.Next(len(data) - partialMarkerLength(data, needle)))
+		}
+
+		if err != nil {
+			emit(pending.Bytes())
+			return 1, err
+		}
+	}
+}
+
+// partialMarkerLength returns the length of the longest suffix of data that is a prefix of needle,
+// i.e. how many trailing bytes may still turn out to be the start of the marker
+func partialMarkerLength(data, needle []byte) int {
+	for n := min(len(data), len(needle)-1); n > 0; n-- {
+		if bytes.HasPrefix(needle, data[len(data)-n:]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// shellExitStatus reaps an exited persistent shell and returns its exit status
+func (m *Manager) shellExitStatus(session *Session) int {
+	if session.cmd == nil || session.cmd.Process == nil {
+		return 1
+	}
+	if session.cmd.ProcessState == nil {
+		session.cmd.Wait()
+	}
+	if session.cmd.ProcessState == nil {
+		return 1
+	}
+	return session.cmd.ProcessState.ExitCode()
+}
+
+// replacePersistentShell stops the session's shell and starts a fresh one in the session's current
+// directory. Nothing is restarted once the session has been closed.
+func (m *Manager) replacePersistentShell(session *Session) error {
+	m.stopSessionShell(session)
+	session.shellReader = nil
+	if session.ctx != nil && session.ctx.Err() != nil {
+		return fmt.Errorf("session %s is closed", session.ID)
+	}
+
+	workingDir := session.currentDir
+	if workingDir == "" {
+		workingDir = session.WorkingDir
+	}
+	if err := m.startSessionShell(session, workingDir); err != nil {
+		return fmt.Errorf("failed to restart persistent shell: %w", err)
+	}
+
+	m.logger.Info("Replaced persistent session shell", map[string]interface{}{
+		"session_id": session.ID,
+		"new_pid":    session.shellPid,
+	})
+	return nil
+}
+
+// sortedKeys returns the keys of env in sorted order
+func sortedKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,185 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// maxProcessTreeDepth bounds the walk from a PID up to a tracked ancestor
+const maxProcessTreeDepth = 64
+
+// SessionProcessKill describes a process killed within a session's process tree
+type SessionProcessKill struct {
+	PID         int    `json:"pid"`
+	Signal      string `json:"signal"`
+	AncestorPID int    `json:"ancestor_pid"` // Tracked process the PID descends from
+	Ancestor    string `json:"ancestor"`     // What the tracked ancestor is, e.g. "background process <id>"
+}
+
+// ParseSignal converts a signal name such as "SIGTERM" or "kill" to a signal
+func ParseSignal(name string) (syscall.Signal, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(normalized, "SIG") {
+		normalized = "SIG" + normalized
+	}
+	sig, ok := terminationSignals[normalized]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal %q (supported: SIGINT, SIGTERM, SIGHUP, SIGQUIT, SIGKILL)", name)
+	}
+	return sig, nil
+}
+
+// signalName returns the conventional name (e.g. "SIGTERM") for a supported or common crash signal
+func signalName(sig syscall.Signal) string {
+	for name, candidate := range terminationSignals {
+		if candidate == sig {
+			return name
+		}
+	}
+	if name, ok := crashSignalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
+
+// KillSessionProcess sends sig to pid after verifying that pid is a descendant of one of the
+// session's tracked processes (its shell or a running background process). Tracked processes
+// themselves are rejected so their bookkeeping stays consistent; use
+// TerminateBackgroundProcess for those.
+func (m *Manager) KillSessionProcess(sessionID string, pid int, sig syscall.Signal) (*SessionProcessKill, error) {
+	if pid <= 1 || pid == os.Getpid() {
+		return nil, fmt.Errorf("refusing to signal PID %d", pid)
+	}
+
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %v", err)
+	}
+
+	roots := sessionRootPIDs(session)
+	if label, tracked := roots[pid]; tracked {
+		return nil, fmt.Errorf("PID %d is the session's %s; use terminate_background_process or close the session instead", pid, label)
+	}
+
+	current := pid
+	for depth := 0; depth < maxProcessTreeDepth; depth++ {
+		parent, err := parentPID(current)
+		if err != nil {
+			return nil, fmt.Errorf("PID %d is not within session %s's process tree: %v", pid, sessionID, err)
+		}
+
+		if label, tracked := roots[parent]; tracked {
+			if err := signalPID(pid, sig); err != nil {
+				return nil, fmt.Errorf("failed to signal PID %d: %w", pid, err)
+			}
+
+			m.logger.Info("Killed process in session process tree", map[string]interface{}{
+				"session_id":   sessionID,
+				"pid":          pid,
+				"signal":       signalName(sig),
+				"ancestor_pid": parent,
+			})
+
+			return &SessionProcessKill{PID: pid, Signal: signalName(sig), AncestorPID: parent, Ancestor: label}, nil
+		}
+
+		if parent <= 1 {
+			break
+		}
+		current = parent
+	}
+
+	return nil, fmt.Errorf("PID %d is not within session %s's process tree", pid, sessionID)
+}
+
+// sessionRootPIDs returns the PIDs the session tracks directly, keyed to a description
+func sessionRootPIDs(session *Session) map[int]string {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	roots := make(map[int]string)
+	if session.shellPid > 0 {
+		roots[session.shellPid] = "shell"
+	}
+	for id, proc := range session.BackgroundProcesses {
+		proc.Mutex.RLock()
+		if proc.IsRunning && proc.PID > 0 {
+			roots[proc.PID] = "background process " + id
+		}
+		proc.Mutex.RUnlock()
+	}
+	return roots
+}
+
+// procStatFields returns the fields of /proc/<pid>/stat that follow the command name, starting
+// with the process state
+func procStatFields(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// Format: pid (comm) state ppid ...; comm may itself contain spaces or parentheses
+	stat := string(data)
+	if end := strings.LastIndex(stat, ")"); end != -1 {
+		if fields := strings.Fields(stat[end+1:]); len(fields) >= 2 {
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+}
+
+// parentPID returns the parent of pid, reading /proc where available and falling back to ps
+func parentPID(pid int) (int, error) {
+	if fields, err := procStatFields(pid); err == nil {
+		return strconv.Atoi(fields[1])
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	output, err := exec.Command("ps", "-o", "ppid=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("process %d not found", pid)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// childPIDs returns the direct children of pid using pgrep, which is available on Linux and macOS
+func childPIDs(pid int) []int {
+	output, err := exec.Command("pgrep", "-P", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return nil
+	}
+	var children []int
+	for _, field := range strings.Fields(string(output)) {
+		if child, err := strconv.Atoi(field); err == nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// signalDescendants sends sig to every process below pid, but not to pid itself, and returns how
+// many were signalled. The whole tree is collected first so children reparented by the signal are
+// not missed.
+func signalDescendants(pid int, sig syscall.Signal) int {
+	var descendants []int
+	pending := []int{pid}
+	for len(pending) > 0 && len(descendants) < 1024 {
+		children := childPIDs(pending[0])
+		pending = append(pending[1:], children...)
+		descendants = append(descendants, children...)
+	}
+
+	signalled := 0
+	for _, descendant := range descendants {
+		if signalPID(descendant, sig) == nil {
+			signalled++
+		}
+	}
+	return signalled
+}
@@ -0,0 +1,148 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/creack/pty"
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// Size of the pseudo-terminal commands run in with use_pty, wide enough that tools such as top
+// and ls do not truncate their output
+const (
+	ptyRows = 40
+	ptyCols = 160
+)
+
+// ptyTerm is the TERM value commands attached to a pseudo-terminal get unless their environment
+// sets one, so tools enable colors and cursor handling
+const ptyTerm = "xterm-256color"
+
+// pseudoTerminal is an allocated pseudo-terminal: the command is attached to tty and the server
+// reads what it writes from ptmx
+type pseudoTerminal struct {
+	ptmx *os.File
+	tty  *os.File
+}
+
+// openPseudoTerminal allocates a pseudo-terminal. It fails on platforms without pseudo-terminals,
+// such as Windows, and when the system has none left.
+func openPseudoTerminal() (*pseudoTerminal, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate pseudo-terminal: %w", err)
+	}
+	if err := pty.Setsize(ptmx, &pty.Winsize{Rows: ptyRows, Cols: ptyCols}); err != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, fmt.Errorf("failed to set pseudo-terminal size: %w", err)
+	}
+	return &pseudoTerminal{ptmx: ptmx, tty: tty}, nil
+}
+
+// attach connects cmd's standard streams to the terminal and makes it the controlling terminal of
+// the new session cmd starts, which also makes cmd the leader of its own process group
+func (p *pseudoTerminal) attach(cmd *exec.Cmd) {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = p.tty, p.tty, p.tty
+	setControllingTerminal(cmd)
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	hasTerm := false
+	for _, entry := range cmd.Env {
+		if strings.HasPrefix(entry, "TERM=") {
+			hasTerm = true
+			break
+		}
+	}
+	if !hasTerm {
+		cmd.Env = append(cmd.Env, "TERM="+ptyTerm)
+	}
+}
+
+// started closes the server's copy of the command's side once it has started, so reading ptmx
+// ends when the command and everything it started have exited
+func (p *pseudoTerminal) started() {
+	p.tty.Close()
+}
+
+// close releases the terminal
+func (p *pseudoTerminal) close() {
+	p.ptmx.Close()
+	p.tty.Close()
+}
+
+// executeCommandInPTY runs command in a fresh session shell attached to term, which it closes. The
+// terminal merges stdout and stderr, so all output is reported as stdout. A non-empty stdin is
+// typed into the terminal followed by Ctrl-D, which reads as end of input at the start of a line.
+// At most outputLimit bytes of output are kept (see cappedOutput). prefix is the session's
+// commandPrefix, built by the caller under session.mutex, which must not be held here.
+func (m *Manager) executeCommandInPTY(ctx context.Context, session *Session, command, prefix string, envOverrides map[string]string, stdin string, live *liveCommand, term *pseudoTerminal, outputLimit int) (CommandOutput, int, error) {
+	defer term.close()
+
+	shell := m.config.Session.Shell
+	if shell == "" {
+		shell = defaultShell()
+	}
+
+	session.mutex.RLock()
+	script := sessionScript(shell, session.currentDir, prefix, command)
+	env := buildCommandEnv(session.shellEnv, envOverrides)
+	session.mutex.RUnlock()
+
+	cmd := newShellCommand(ctx, shell, script)
+	cmd.Dir = session.GetWorkingDir()
+	cmd.Env = env
+	term.attach(cmd)
+
+	if err := m.applyRunAsUser(cmd); err != nil {
+		return CommandOutput{}, 1, err
+	}
+	if err := cmd.Start(); err != nil {
+		return CommandOutput{}, 1, fmt.Errorf("failed to start command: %v", err)
+	}
+	term.started()
+
+	if stdin != "" {
+		go func() {
+			io.WriteString(term.ptmx, stdin+"\x04")
+		}()
+	}
+
+	// The terminal ends lines with CRLF; scanning lines drops the CR
+	var outputMu sync.Mutex
+	captured := newCappedOutput(outputLimit)
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		scanner := bufio.NewScanner(term.ptmx)
+		for scanner.Scan() {
+			line := []byte(scanner.Text() + "\n")
+			outputMu.Lock()
+			captured.Write(line)
+			outputMu.Unlock()
+			live.WriteStream(database.ChunkTypeStdout, line)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		<-outputDone
+		done <- cmd.Wait()
+	}()
+
+	exitCode, err := waitForCommand(ctx, cmd, done)
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output := captured.String()
+	return CommandOutput{Combined: output, Stdout: output, Truncated: captured.Truncated()}, exitCode, err
+}
@@ -0,0 +1,103 @@
+package terminal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RecentCommand is a finished command kept in a session's in-memory recent buffer
+type RecentCommand struct {
+	Command    string    `json:"command"`
+	Output     string    `json:"output"`
+	ExitCode   int       `json:"exit_code"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration_ms"`
+	WorkingDir string    `json:"working_dir"`
+	Background bool      `json:"background"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// size is the number of bytes an entry counts against the buffer's byte budget
+func (rc RecentCommand) size() int {
+	return len(rc.Command) + len(rc.Output)
+}
+
+// recentCommandBuffer is a ring buffer of recent commands bounded by count and total bytes.
+// It works without the database so database-free deployments still have basic history.
+type recentCommandBuffer struct {
+	mutex      sync.Mutex
+	entries    []RecentCommand
+	totalBytes int
+	maxEntries int // 0 disables the buffer
+	maxBytes   int // 0 means no byte limit
+}
+
+// newRecentCommandBuffer creates a buffer holding at most maxEntries commands and maxBytes bytes
+func newRecentCommandBuffer(maxEntries, maxBytes int) *recentCommandBuffer {
+	return &recentCommandBuffer{
+		entries:    make([]RecentCommand, 0),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// add appends a command, truncating its output from the front if it alone exceeds the byte
+// budget, and evicts the oldest entries until both limits hold again
+func (b *recentCommandBuffer) add(entry RecentCommand) {
+	if b == nil || b.maxEntries <= 0 {
+		return
+	}
+
+	if b.maxBytes > 0 && entry.size() > b.maxBytes {
+		keep := b.maxBytes - len(entry.Command) - 3
+		if keep < 0 {
+			keep = 0
+		}
+		entry.Output = "..." + entry.Output[len(entry.Output)-keep:]
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.entries = append(b.entries, entry)
+	b.totalBytes += entry.size()
+
+	for len(b.entries) > 1 && (len(b.entries) > b.maxEntries || (b.maxBytes > 0 && b.totalBytes > b.maxBytes)) {
+		b.totalBytes -= b.entries[0].size()
+		b.entries[0] = RecentCommand{}
+		b.entries = b.entries[1:]
+	}
+}
+
+// recent returns up to limit entries, newest first; limit <= 0 returns all of them
+func (b *recentCommandBuffer) recent(limit int) []RecentCommand {
+	if b == nil {
+		return []RecentCommand{}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	count := len(b.entries)
+	if limit > 0 && limit < count {
+		count = limit
+	}
+
+	result := make([]RecentCommand, 0, count)
+	for i := len(b.entries) - 1; i >= 0 && len(result) < count; i-- {
+		result = append(result, b.entries[i])
+	}
+	return result
+}
+
+// GetRecentCommands returns up to limit of the session's most recent commands, newest first.
+// The buffer is kept in memory and is available whether or not the database is enabled.
+func (m *Manager) GetRecentCommands(sessionID string, limit int) ([]RecentCommand, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %v", err)
+	}
+
+	return session.recentCommands.recent(limit), nil
+}
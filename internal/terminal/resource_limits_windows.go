@@ -0,0 +1,36 @@
+// Package terminal provides terminal session management.
+// This file stubs the resource limit utilities (M6) on Windows, which has no rlimits or nice values.
+
+package terminal
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ResourceLimits holds resource limit configuration for a process
+type ResourceLimits struct {
+	MaxMemoryMB   int64 // Maximum memory in MB
+	MaxFileSizeMB int64 // Maximum file size in MB
+	Nice          int   // Nice value (-20 to 19)
+	Enabled       bool  // Whether limits are enabled
+}
+
+// errResourceLimitsUnsupported is returned when resource limits are enabled on Windows
+var errResourceLimitsUnsupported = errors.New("resource limits are not supported on Windows")
+
+// applyResourceLimits reports that limits cannot be applied when they are enabled
+func applyResourceLimits(cmd *exec.Cmd, limits ResourceLimits) error {
+	if !limits.Enabled {
+		return nil
+	}
+	return errResourceLimitsUnsupported
+}
+
+// setResourceLimits reports that limits cannot be applied when they are enabled
+func setResourceLimits(pid int, limits ResourceLimits) error {
+	if !limits.Enabled || pid <= 0 {
+		return nil
+	}
+	return errResourceLimitsUnsupported
+}
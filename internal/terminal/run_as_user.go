@@ -0,0 +1,77 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// userCredential is the credential commands run with when run_as_user is set
+type userCredential = syscall.Credential
+
+// ResolveRunAsUser resolves a user name (or numeric UID) into the credential commands should run
+// with. It returns nil when name is empty or is already the server's effective user, and an error
+// when the user does not exist or the server lacks the privileges to switch to it.
+func ResolveRunAsUser(name string) (*syscall.Credential, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr != nil {
+			return nil, fmt.Errorf("unknown user %q: %w", name, err)
+		}
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user ID %q: %w", name, err)
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric UID %q", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric GID %q", name, u.Gid)
+	}
+
+	if int(uid) == os.Geteuid() && int(gid) == os.Getegid() {
+		return nil, nil
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("running commands as %q (uid %d) requires the server to run as root, but its effective uid is %d", name, uid, os.Geteuid())
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if groupIDs, err := u.GroupIds(); err == nil {
+		for _, g := range groupIDs {
+			if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+				cred.Groups = append(cred.Groups, uint32(id))
+			}
+		}
+	}
+	return cred, nil
+}
+
+// applyRunAsUser makes cmd run as the configured run_as_user. It fails when the configured user
+// could not be resolved so commands never silently fall back to the server's own user.
+func (m *Manager) applyRunAsUser(cmd *exec.Cmd) error {
+	if m.runAsErr != nil {
+		return fmt.Errorf("cannot run as configured user: %w", m.runAsErr)
+	}
+	if m.runAsCredential == nil {
+		return nil
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = m.runAsCredential
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunAsUser(t *testing.T) {
+	if cred, err := ResolveRunAsUser(""); cred != nil || err != nil {
+		t.Errorf("Expected empty user to run as self, got %+v, %v", cred, err)
+	}
+	if _, err := ResolveRunAsUser("no-such-user-go-term"); err == nil {
+		t.Error("Expected unknown user to be rejected")
+	}
+	if cred, err := ResolveRunAsUser(fmt.Sprint(os.Geteuid())); cred != nil || err != nil {
+		t.Errorf("Expected the server's own UID to need no credential, got %+v, %v", cred, err)
+	}
+
+	cred, err := ResolveRunAsUser("nobody")
+	if os.Geteuid() != 0 {
+		if err == nil || !strings.Contains(err.Error(), "root") {
+			t.Errorf("Expected switching users without root to fail clearly, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Skipf("nobody user unavailable: %v", err)
+	}
+
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	manager.runAsCredential = cred
+	output, err := manager.ExecuteCommand(session.ID, "id -u")
+	if err != nil {
+		t.Fatalf("Failed to execute command as nobody: %v", err)
+	}
+	if strings.TrimSpace(output) != fmt.Sprint(cred.Uid) {
+		t.Errorf("Expected command to run as uid %d, got %q", cred.Uid, output)
+	}
+
+	manager.runAsErr = errors.New("user vanished")
+	if _, err := manager.ExecuteCommand(session.ID, "id -u"); err == nil {
+		t.Error("Expected commands to be refused when run_as_user cannot be resolved")
+	}
+}
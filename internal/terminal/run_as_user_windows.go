@@ -0,0 +1,27 @@
+package terminal
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// userCredential stands in for the Unix credential; Windows cannot switch users this way
+type userCredential struct{}
+
+// ResolveRunAsUser returns nil when name is empty and an error otherwise, since running commands
+// as another user is not supported on Windows
+func ResolveRunAsUser(name string) (*userCredential, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("running commands as %q is not supported on Windows", name)
+}
+
+// applyRunAsUser fails when a run_as_user was configured, so commands never silently fall back
+// to the server's own user
+func (m *Manager) applyRunAsUser(cmd *exec.Cmd) error {
+	if m.runAsErr != nil {
+		return fmt.Errorf("cannot run as configured user: %w", m.runAsErr)
+	}
+	return nil
+}
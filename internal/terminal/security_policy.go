@@ -0,0 +1,89 @@
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SecurityPolicy tightens the server's security settings for one session and is fixed when the
+// session is created. Blocked commands are added to the global blocklist; each flag can only make
+// the session stricter than the global configuration, so a nil flag keeps the global value.
+type SecurityPolicy struct {
+	BlockedCommands      []string `json:"blocked_commands,omitempty"`
+	EnableSandbox        *bool    `json:"enable_sandbox,omitempty"`         // Only true: run the sandbox checks even when the global sandbox is off
+	AllowNetworkAccess   *bool    `json:"allow_network_access,omitempty"`   // Only false: block network commands even without the sandbox
+	AllowFileSystemWrite *bool    `json:"allow_filesystem_write,omitempty"` // Only false: block file system writes even without the sandbox
+}
+
+// IsEmpty reports whether the policy changes nothing
+func (p *SecurityPolicy) IsEmpty() bool {
+	return p == nil || (len(p.BlockedCommands) == 0 && p.EnableSandbox == nil && p.AllowNetworkAccess == nil && p.AllowFileSystemWrite == nil)
+}
+
+// Validate rejects flags that would loosen the global settings and blank blocklist entries
+func (p *SecurityPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.EnableSandbox != nil && !*p.EnableSandbox {
+		return fmt.Errorf("enable_sandbox can only be set to true; a session policy cannot loosen the global settings")
+	}
+	if p.AllowNetworkAccess != nil && *p.AllowNetworkAccess {
+		return fmt.Errorf("allow_network_access can only be set to false; a session policy cannot loosen the global settings")
+	}
+	if p.AllowFileSystemWrite != nil && *p.AllowFileSystemWrite {
+		return fmt.Errorf("allow_filesystem_write can only be set to false; a session policy cannot loosen the global settings")
+	}
+	for _, blocked := range p.BlockedCommands {
+		if strings.TrimSpace(blocked) == "" {
+			return fmt.Errorf("blocked_commands cannot contain empty entries")
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy so callers cannot change a session's policy after creation
+func (p *SecurityPolicy) clone() *SecurityPolicy {
+	if p.IsEmpty() {
+		return nil
+	}
+	copied := &SecurityPolicy{BlockedCommands: append([]string(nil), p.BlockedCommands...)}
+	if p.EnableSandbox != nil {
+		value := *p.EnableSandbox
+		copied.EnableSandbox = &value
+	}
+	if p.AllowNetworkAccess != nil {
+		value := *p.AllowNetworkAccess
+		copied.AllowNetworkAccess = &value
+	}
+	if p.AllowFileSystemWrite != nil {
+		value := *p.AllowFileSystemWrite
+		copied.AllowFileSystemWrite = &value
+	}
+	return copied
+}
+
+// encodeSecurityPolicy serializes a policy for the sessions table; an empty policy is stored as ""
+func encodeSecurityPolicy(p *SecurityPolicy) string {
+	if p.IsEmpty() {
+		return ""
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeSecurityPolicy parses a policy stored by encodeSecurityPolicy
+func decodeSecurityPolicy(data string) (*SecurityPolicy, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var policy SecurityPolicy
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("invalid stored security policy: %w", err)
+	}
+	return policy.clone(), nil
+}
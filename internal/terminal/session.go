@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -24,47 +26,132 @@ import (
 	"github.com/rama-kairi/go-term/internal/utils"
 )
 
-// H4: shellEscape escapes a string for safe use in shell commands
-// This prevents shell injection attacks by escaping special characters
-func shellEscape(s string) string {
-	// If string is empty, return empty quotes
-	if s == "" {
-		return "''"
-	}
-
-	// Check if string needs escaping
-	needsEscape := false
-	for _, c := range s {
-		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
-			(c >= '0' && c <= '9') || c == '_' || c == '-' ||
-			c == '.' || c == '/' || c == ':') {
-			needsEscape = true
-			break
-		}
-	}
-
-	if !needsEscape {
-		return s
-	}
-
-	// Use single quotes for escaping, escape any existing single quotes
-	return "'" + strings.ReplaceAll(s, "'", "'\"'\"'") + "'"
-}
-
 // BackgroundProcess represents a running background process
 type BackgroundProcess struct {
-	ID           string    `json:"id"`
-	Command      string    `json:"command"`
-	PID          int       `json:"pid"`
-	StartTime    time.Time `json:"start_time"`
-	IsRunning    bool      `json:"is_running"`
-	ExitCode     int       `json:"exit_code,omitempty"`
-	Output       string    `json:"output"`
-	ErrorOutput  string    `json:"error_output"`
+	ID           string      `json:"id"`
+	Command      string      `json:"command"`
+	PID          int         `json:"pid"`
+	StartTime    time.Time   `json:"start_time"`
+	IsRunning    bool        `json:"is_running"`
+	ExitCode     int         `json:"exit_code,omitempty"`
+	ExitStatus   *ExitStatus `json:"exit_status,omitempty"` // How the process ended; nil while it runs
+	Output       string      `json:"output"`
+	ErrorOutput  string      `json:"error_output"`
+	Tags         []string    `json:"tags,omitempty"`      // History tags, explicit and detected from the command
+	PTY          bool        `json:"pty,omitempty"`       // Whether the process runs attached to a pseudo-terminal
+	PTYError     string      `json:"pty_error,omitempty"` // Why the process runs without the requested pseudo-terminal
+	usePTY       bool
 	cmd          *exec.Cmd
+	workingDir   string        // Directory to run in instead of the session's current one, if set
+	env          []string      // Environment to run with instead of the session's, if set
+	done         chan struct{} // Closed once the process has exited and will not be restarted
 	outputBuffer strings.Builder
 	errorBuffer  strings.Builder
 	Mutex        sync.RWMutex `json:"-"` // Exported for access
+
+	// Consecutive identical line collapsing ("<line> (xN)"), disabled by default
+	dedupLines  bool
+	outputDedup lineDedupState
+	errorDedup  lineDedupState
+
+	// Waiters for a pattern in the output, see WaitForOutputPattern
+	outputWatchers []*outputWatcher
+
+	// Bytes written to each stream, for reading output since an offset, see ReadOutputSince
+	outputCursor outputCursor
+	errorCursor  outputCursor
+
+	// Crash-restart state; restartPolicy is nil unless auto-restart was requested
+	RestartCount  int             `json:"restart_count"`
+	Restarts      []RestartRecord `json:"restarts,omitempty"`
+	restartPolicy *RestartPolicy
+	stopRequested bool   // Set on termination so the process is never restarted
+	signalSent    string // Last signal the server sent the process, see noteSignalSent
+}
+
+// RestartPolicy controls automatic restarts of a background process that crashes
+type RestartPolicy struct {
+	MaxRestarts int           // Restarts allowed before giving up
+	Backoff     time.Duration // Delay before each restart
+	MinUptime   time.Duration // Only failures sooner than this are restarted (0 = any failure)
+}
+
+// RestartRecord describes one automatic restart of a background process
+type RestartRecord struct {
+	Attempt     int       `json:"attempt"`
+	ExitCode    int       `json:"exit_code"`
+	Uptime      string    `json:"uptime"`
+	RestartedAt time.Time `json:"restarted_at"`
+}
+
+// RestartPolicy returns the process's restart policy, or nil if it does not auto-restart
+func (bp *BackgroundProcess) RestartPolicy() *RestartPolicy {
+	bp.Mutex.RLock()
+	defer bp.Mutex.RUnlock()
+
+	return bp.restartPolicy
+}
+
+// Running reports whether the process is still running
+func (bp *BackgroundProcess) Running() bool {
+	bp.Mutex.RLock()
+	defer bp.Mutex.RUnlock()
+
+	return bp.IsRunning
+}
+
+// lineDedupState tracks the last line written to an output stream for deduplication
+type lineDedupState struct {
+	lastLine string // Last line without its trailing newline
+	count    int    // Consecutive occurrences of lastLine
+	rendered string // How the last line currently appears at the end of the buffer
+	partial  bool   // Last write did not end with a newline
+}
+
+// SetDedup enables or disables collapsing of consecutive identical output lines
+func (bp *BackgroundProcess) SetDedup(enabled bool) {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+
+	bp.dedupLines = enabled
+}
+
+// appendDedup appends newOutput to current, collapsing consecutive identical lines
+// into a single "<line> (xN)" entry, and returns the updated content
+func appendDedup(current, newOutput string, state *lineDedupState) string {
+	for _, line := range strings.SplitAfter(newOutput, "\n") {
+		if line == "" {
+			continue
+		}
+
+		// A previous partial line is continued by this write; append raw
+		if state.partial {
+			current += line
+			state.lastLine += strings.TrimSuffix(line, "\n")
+			state.count = 1
+			state.rendered = state.lastLine + "\n"
+			state.partial = !strings.HasSuffix(line, "\n")
+			continue
+		}
+
+		text := strings.TrimSuffix(line, "\n")
+		complete := strings.HasSuffix(line, "\n")
+
+		if complete && state.count > 0 && text == state.lastLine && strings.HasSuffix(current, state.rendered) {
+			state.count++
+			current = current[:len(current)-len(state.rendered)]
+			state.rendered = fmt.Sprintf("%s (x%d)\n", text, state.count)
+			current += state.rendered
+			continue
+		}
+
+		current += line
+		state.lastLine = text
+		state.count = 1
+		state.rendered = line
+		state.partial = !complete
+	}
+	return current
 }
 
 // TruncateOutput limits the output to the specified maximum length, keeping the latest content
@@ -75,11 +162,17 @@ func (bp *BackgroundProcess) TruncateOutput(maxLength int) {
 	if len(bp.Output) > maxLength {
 		// Keep the latest content
 		bp.Output = "..." + bp.Output[len(bp.Output)-maxLength+3:]
+		bp.outputBuffer.Reset()
+		bp.outputBuffer.WriteString(bp.Output)
+		bp.outputCursor.truncated = true
 	}
 
 	if len(bp.ErrorOutput) > maxLength {
 		// Keep the latest content
 		bp.ErrorOutput = "..." + bp.ErrorOutput[len(bp.ErrorOutput)-maxLength+3:]
+		bp.errorBuffer.Reset()
+		bp.errorBuffer.WriteString(bp.ErrorOutput)
+		bp.errorCursor.truncated = true
 	}
 }
 
@@ -88,11 +181,26 @@ func (bp *BackgroundProcess) UpdateOutput(newOutput string, maxLength int) {
 	bp.Mutex.Lock()
 	defer bp.Mutex.Unlock()
 
-	bp.outputBuffer.WriteString(newOutput)
-	bp.Output = bp.outputBuffer.String()
+	bp.notifyOutputWatchers(OutputStreamStdout, newOutput)
+
+	if bp.dedupLines {
+		bp.Output = appendDedup(bp.outputBuffer.String(), newOutput, &bp.outputDedup)
+		bp.outputBuffer.Reset()
+		bp.outputBuffer.WriteString(bp.Output)
+	} else {
+		// Drop the oldest content up front so the buffer never grows past the limit
+		if maxLength > 0 && bp.outputBuffer.Len()+len(newOutput) > maxLength {
+			bp.outputCursor.truncated = true
+		}
+		bp.Output = appendBounded(bp.outputBuffer.String(), newOutput, maxLength)
+		bp.outputBuffer.Reset()
+		bp.outputBuffer.WriteString(bp.Output)
+	}
+	bp.outputCursor.written += int64(len(newOutput))
 
 	// Apply length limit if specified
 	if maxLength > 0 && len(bp.Output) > maxLength {
+		bp.outputCursor.truncated = true
 		bp.Output = "..." + bp.Output[len(bp.Output)-maxLength+3:]
 		// Reset buffer with truncated content
 		bp.outputBuffer.Reset()
@@ -105,11 +213,26 @@ func (bp *BackgroundProcess) UpdateErrorOutput(newOutput string, maxLength int)
 	bp.Mutex.Lock()
 	defer bp.Mutex.Unlock()
 
-	bp.errorBuffer.WriteString(newOutput)
-	bp.ErrorOutput = bp.errorBuffer.String()
+	bp.notifyOutputWatchers(OutputStreamStderr, newOutput)
+
+	if bp.dedupLines {
+		bp.ErrorOutput = appendDedup(bp.errorBuffer.String(), newOutput, &bp.errorDedup)
+		bp.errorBuffer.Reset()
+		bp.errorBuffer.WriteString(bp.ErrorOutput)
+	} else {
+		// Drop the oldest content up front so the buffer never grows past the limit
+		if maxLength > 0 && bp.errorBuffer.Len()+len(newOutput) > maxLength {
+			bp.errorCursor.truncated = true
+		}
+		bp.ErrorOutput = appendBounded(bp.errorBuffer.String(), newOutput, maxLength)
+		bp.errorBuffer.Reset()
+		bp.errorBuffer.WriteString(bp.ErrorOutput)
+	}
+	bp.errorCursor.written += int64(len(newOutput))
 
 	// Apply length limit if specified
 	if maxLength > 0 && len(bp.ErrorOutput) > maxLength {
+		bp.errorCursor.truncated = true
 		bp.ErrorOutput = "..." + bp.ErrorOutput[len(bp.ErrorOutput)-maxLength+3:]
 		// Reset buffer with truncated content
 		bp.errorBuffer.Reset()
@@ -131,12 +254,26 @@ type Session struct {
 	SuccessCount  int               `json:"success_count"`
 	TotalDuration time.Duration     `json:"total_duration"`
 
+	// Session-level tightening of the global security settings, fixed at creation (nil when none)
+	SecurityPolicy *SecurityPolicy `json:"security_policy,omitempty"`
+
+	// Create missing cd targets (like mkdir -p) instead of refusing the command
+	AutoCreateDirs bool `json:"auto_create_dirs,omitempty"`
+
 	// Background process tracking
 	BackgroundProcesses map[string]*BackgroundProcess `json:"background_processes,omitempty"`
 
 	// M9: Activity tracking
 	activityTracker *SessionActivityTracker `json:"-"`
 
+	// Recent commands with their output, kept in memory independent of the database
+	recentCommands *recentCommandBuffer
+
+	// Foreground command started last, readable while it runs; liveMu guards only the pointer
+	// since session.mutex can be held for a command's whole run
+	liveMu      sync.Mutex
+	liveCommand *liveCommand
+
 	// Internal fields for session management
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
@@ -148,17 +285,115 @@ type Session struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// Persistent shell state tracking
-	currentDir string
-	shellPid   int
-	shellEnv   map[string]string
+	// Persistent shell state tracking; previousDir is where "cd -" returns to
+	currentDir  string
+	previousDir string
+	shellPid    int
+	shellEnv    map[string]string
+
+	// Shell options (set -o) enabled for every command run in this session
+	shellOptions map[string]bool
+
+	// Command aliases expanded by ExpandAlias; aliasMu guards only the map so aliases can be
+	// resolved while session.mutex is held by a running command
+	aliasMu sync.RWMutex
+	aliases map[string]string
+
+	// Persistent shell execution (session.persistent_shell): shellMu serializes use of the shell's
+	// pipes; the synced maps hold the variables and options last sent to the shell
+	shellMu            sync.Mutex
+	shellReader        *bufio.Reader
+	shellSyncedEnv     map[string]string
+	shellSyncedOptions map[string]bool
+}
+
+// KnownShellOptions lists the `set -o` options that may be toggled per session
+var KnownShellOptions = []string{"errexit", "nounset", "pipefail", "xtrace", "noclobber", "noglob", "allexport"}
+
+// isKnownShellOption reports whether name is in KnownShellOptions
+func isKnownShellOption(name string) bool {
+	for _, option := range KnownShellOptions {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetShellOptions returns the enabled shell options in sorted order
+func (s *Session) GetShellOptions() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.enabledShellOptions()
+}
+
+// enabledShellOptions returns the enabled shell options; the caller must hold the session mutex
+func (s *Session) enabledShellOptions() []string {
+	options := make([]string, 0, len(s.shellOptions))
+	for name, enabled := range s.shellOptions {
+		if enabled {
+			options = append(options, name)
+		}
+	}
+	sort.Strings(options)
+	return options
+}
+
+// shellOptionsPrefix returns the `set -o ... &&` prefix for enabled options, or "" if none.
+// Commands run in a fresh shell, so options are re-applied to every command. The caller must hold
+// s.mutex.
+func (s *Session) shellOptionsPrefix() string {
+	options := s.enabledShellOptions()
+	if len(options) == 0 {
+		return ""
+	}
+	return "set -o " + strings.Join(options, " -o ") + " && "
+}
+
+// commandPrefix returns the prefix run before each command in a fresh shell: OLDPWD set to the
+// session's previous directory so "cd -" goes where the session tracks it, then shellOptionsPrefix.
+// The caller must hold s.mutex and pass the result to the command it runs.
+func (s *Session) commandPrefix() string {
+	if s.previousDir == "" {
+		return s.shellOptionsPrefix()
+	}
+	return "OLDPWD=" + shellEscape(s.previousDir) + " && " + s.shellOptionsPrefix()
 }
 
 // GetCurrentDir returns the current working directory of the session
 func (s *Session) GetCurrentDir() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	return s.currentDir
 }
 
+// GetWorkingDir returns the directory the session was created in, or moved to by RelocateSession
+func (s *Session) GetWorkingDir() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.WorkingDir
+}
+
+// GetPreviousDir returns the directory "cd -" returns to, or "" before the session has changed
+// directory
+func (s *Session) GetPreviousDir() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.previousDir
+}
+
+// ShellPath returns the shell the session was started with, or "" if it has none
+func (s *Session) ShellPath() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.cmd == nil {
+		return ""
+	}
+	return s.cmd.Path
+}
+
 // SetEnvironment sets or updates an environment variable for this session
 func (s *Session) SetEnvironment(key, value string) {
 	s.mutex.Lock()
@@ -258,6 +493,20 @@ type Manager struct {
 	stopCleanup         chan bool
 	stopResourceCleanup chan bool
 	resourceMonitor     *monitoring.ResourceMonitor
+	commandWebhook      *monitoring.CommandWebhook // Optional command completion webhook
+
+	// Credential commands run with when run_as_user is set; runAsErr holds a resolution failure
+	runAsCredential *userCredential
+	runAsErr        error
+
+	// Maintenance routine health, reported by Diagnostics
+	cleanupState         routineState
+	resourceCleanupState routineState
+	cleanupPause         cleanupPause // Lets bulk work suspend both cleanup routines
+
+	activityExport activityExporter // Guards the activity metrics file
+	commandTotals  commandTotals    // Commands completed since the server started, for metrics
+	stuck          stuckProcesses   // Processes that survived SIGKILL, retried by resource cleanup
 
 	// Context for manager-wide cancellation
 	ctx    context.Context
@@ -293,10 +542,39 @@ func NewManager(cfg *config.Config, logger *logger.Logger, db *database.DB) *Man
 	// Start cleanup routines
 	manager.startCleanupRoutine()
 	manager.startResourceCleanupRoutine()
+	if db != nil && cfg.Database.WALCheckpointInterval > 0 {
+		manager.startWALCheckpointRoutine()
+	}
+	if db != nil && cfg.Database.VacuumInterval > 0 {
+		manager.startVacuumRoutine()
+	}
+	if cfg.Monitoring.ActivityMetricsFile != "" && cfg.Monitoring.ActivityMetricsInterval > 0 {
+		manager.startActivityMetricsExportRoutine()
+	}
 
 	// Start resource monitoring
 	manager.resourceMonitor.Start(manager.ctx)
 
+	// Start command completion webhook if configured
+	if cfg.Monitoring.CommandWebhookURL != "" {
+		manager.commandWebhook = monitoring.NewCommandWebhook(
+			cfg.Monitoring.CommandWebhookURL,
+			cfg.Monitoring.CommandWebhookTimeout,
+			cfg.Monitoring.CommandWebhookRetries,
+			logger,
+		)
+	}
+
+	// Resolve the restricted user commands should run as, if configured
+	if cfg.Session.RunAsUser != "" {
+		manager.runAsCredential, manager.runAsErr = ResolveRunAsUser(cfg.Session.RunAsUser)
+		if manager.runAsErr != nil {
+			logger.Error("Failed to resolve run_as_user; commands will be refused", manager.runAsErr, map[string]interface{}{
+				"run_as_user": cfg.Session.RunAsUser,
+			})
+		}
+	}
+
 	return manager
 }
 
@@ -384,10 +662,18 @@ func (m *Manager) detectFromEnvironment() (string, error) {
 	return "", fmt.Errorf("no workspace environment variables found")
 }
 
-// findWorkspaceRoot walks up the directory tree looking for workspace indicators
+// defaultWorkspaceSearchDepth is used when workspace_search_depth is not configured
+const defaultWorkspaceSearchDepth = 10
+
+// findWorkspaceRoot walks up the directory tree looking for workspace indicators, at most
+// workspace_search_depth levels and never above a configured boundary directory
 func (m *Manager) findWorkspaceRoot(startDir string) string {
 	currentDir := startDir
-	maxDepth := 10 // Prevent infinite loop
+	maxDepth := m.config.Session.WorkspaceSearchDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultWorkspaceSearchDepth
+	}
+	boundaries := workspaceBoundaries(m.config.Session.WorkspaceBoundaries)
 
 	for i := 0; i < maxDepth; i++ {
 		// Check for workspace indicators in order of priority
@@ -420,6 +706,13 @@ func (m *Manager) findWorkspaceRoot(startDir string) string {
 			}
 		}
 
+		if boundaries[currentDir] {
+			m.logger.Debug("Stopped workspace search at boundary", map[string]interface{}{
+				"path": currentDir,
+			})
+			break
+		}
+
 		// Move up one directory
 		parentDir := filepath.Dir(currentDir)
 		if parentDir == currentDir {
@@ -432,8 +725,138 @@ func (m *Manager) findWorkspaceRoot(startDir string) string {
 	return ""
 }
 
+// workspaceBoundaries expands environment variables and a leading ~ in the configured boundary
+// directories and returns them as a set of cleaned paths
+func workspaceBoundaries(dirs []string) map[string]bool {
+	boundaries := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		dir = os.ExpandEnv(strings.TrimSpace(dir))
+		if dir == "~" || strings.HasPrefix(dir, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, strings.TrimPrefix(dir, "~"))
+			}
+		}
+		if dir == "" {
+			continue
+		}
+		boundaries[filepath.Clean(dir)] = true
+	}
+	return boundaries
+}
+
+// startSessionShell spawns the session's persistent shell in workingDir and wires up its pipes.
+// The caller must hold the session mutex or own the session exclusively.
+func (m *Manager) startSessionShell(session *Session, workingDir string) error {
+	shell := m.config.Session.Shell
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+		if shell == "" {
+			shell = defaultShell()
+		}
+	}
+
+	// Create shell command with proper working directory
+	cmd := exec.Command(shell)
+	cmd.Dir = workingDir
+	cmd.Env = os.Environ()
+	if err := m.applyRunAsUser(cmd); err != nil {
+		return err
+	}
+
+	// Set up pipes for persistent shell interaction
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	session.cmd = cmd
+	session.stdin = stdin
+	session.stdout = stdout
+	session.stderr = stderr
+
+	// Start the shell
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	session.shellPid = cmd.Process.Pid
+
+	if m.persistentShellEnabled() {
+		return m.preparePersistentShell(session)
+	}
+
+	return nil
+}
+
+// stopSessionShell closes the persistent shell's pipes and kills and reaps the shell.
+// The caller must hold the session mutex.
+func (m *Manager) stopSessionShell(session *Session) {
+	// Close pipes
+	if session.stdin != nil {
+		session.stdin.Close()
+	}
+	if session.stdout != nil {
+		session.stdout.Close()
+	}
+	if session.stderr != nil {
+		session.stderr.Close()
+	}
+
+	// Kill the process
+	if session.cmd != nil && session.cmd.Process != nil {
+		session.cmd.Process.Kill()
+		session.cmd.Wait()
+	}
+}
+
 // CreateSession creates a new terminal session with project association
 func (m *Manager) CreateSession(name string, projectID string, workingDir string) (*Session, error) {
+	return m.CreateSessionWithPolicy(name, projectID, workingDir, nil)
+}
+
+// uniqueSessionName returns name, or if a session of projectID already has it, name with the
+// lowest free numeric suffix ("build-2", "build-3"). Callers hold m.mutex.
+func (m *Manager) uniqueSessionName(name, projectID string) string {
+	taken := make(map[string]bool)
+	for _, session := range m.sessions {
+		if session.ProjectID == projectID {
+			taken[session.Name] = true
+		}
+	}
+	if !taken[name] {
+		return name
+	}
+	for n := 2; ; n++ {
+		if candidate := fmt.Sprintf("%s-%d", name, n); !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// CreateSessionWithPolicy creates a session whose commands are also checked against policy, which
+// may only tighten the global security settings. With session.unique_names, a name already used
+// in the project is suffixed; the session's Name holds the name it was given.
+func (m *Manager) CreateSessionWithPolicy(name string, projectID string, workingDir string, policy *SecurityPolicy) (*Session, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid security policy: %w", err)
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -478,6 +901,10 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 		return nil, fmt.Errorf("invalid project ID: %w", err)
 	}
 
+	if m.config.Session.UniqueNames {
+		name = m.uniqueSessionName(name, projectID)
+	}
+
 	// Set working directory using enhanced detection
 	if workingDir == "" {
 		var err error
@@ -493,6 +920,11 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 		}
 	}
 
+	// Enforce the configured working directory allowlist
+	if !m.config.Security.IsWorkingDirAllowed(workingDir) {
+		return nil, fmt.Errorf("working directory %s is not within the allowed working directories", workingDir)
+	}
+
 	// Ensure working directory exists
 	if err := os.MkdirAll(workingDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create working directory: %w", err)
@@ -513,8 +945,10 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 		CommandCount:        0,
 		SuccessCount:        0,
 		TotalDuration:       0,
+		SecurityPolicy:      policy.clone(),
 		BackgroundProcesses: make(map[string]*BackgroundProcess),
 		activityTracker:     NewSessionActivityTracker(), // M9: Initialize activity tracker
+		recentCommands:      newRecentCommandBuffer(m.config.Session.RecentCommandsLimit, m.config.Session.RecentCommandsMaxBytes),
 		currentDir:          workingDir,
 		shellEnv:            make(map[string]string),
 		ctx:                 sessionCtx,
@@ -531,53 +965,10 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 	}
 
 	// Initialize the persistent shell
-	shell := m.config.Session.Shell
-	if shell == "" {
-		shell = os.Getenv("SHELL")
-		if shell == "" {
-			shell = "/bin/bash"
-		}
-	}
-
-	// Create shell command with proper working directory
-	cmd := exec.Command(shell)
-	cmd.Dir = workingDir
-	cmd.Env = os.Environ()
-
-	// Set up pipes for persistent shell interaction
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		stdin.Close()
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
-	}
-
-	session.cmd = cmd
-	session.stdin = stdin
-	session.stdout = stdout
-	session.stderr = stderr
-
-	// Start the shell
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return nil, fmt.Errorf("failed to start shell: %w", err)
+	if err := m.startSessionShell(session, workingDir); err != nil {
+		return nil, err
 	}
 
-	session.shellPid = cmd.Process.Pid
-
 	// Session initialized successfully
 	m.logger.Info("Session created successfully", map[string]interface{}{
 		"session_id": sessionID,
@@ -591,15 +982,16 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 	if m.database != nil {
 		envJSON, _ := json.Marshal(session.Environment)
 		sessionRecord := &database.SessionRecord{
-			ID:           sessionID,
-			Name:         name,
-			ProjectID:    projectID,
-			WorkingDir:   workingDir,
-			Environment:  string(envJSON),
-			CreatedAt:    session.CreatedAt,
-			LastUsedAt:   session.LastUsedAt,
-			IsActive:     session.IsActive,
-			CommandCount: session.CommandCount,
+			ID:             sessionID,
+			Name:           name,
+			ProjectID:      projectID,
+			WorkingDir:     workingDir,
+			Environment:    string(envJSON),
+			CreatedAt:      session.CreatedAt,
+			LastUsedAt:     session.LastUsedAt,
+			IsActive:       session.IsActive,
+			CommandCount:   session.CommandCount,
+			SecurityPolicy: encodeSecurityPolicy(session.SecurityPolicy),
 		}
 		err := m.database.CreateSession(sessionRecord)
 		if err != nil {
@@ -614,10 +1006,9 @@ func (m *Manager) CreateSession(name string, projectID string, workingDir string
 		}
 	}
 
-	m.logger.LogSessionEvent("created", sessionID, name, map[string]interface{}{
-		"project_id":  projectID,
+	m.recordSessionEvent(SessionEventCreated, "", sessionID, name, projectID, map[string]interface{}{
 		"working_dir": workingDir,
-		"shell":       shell,
+		"shell":       session.cmd.Args[0],
 	})
 
 	return session, nil
@@ -656,19 +1047,146 @@ func (m *Manager) SetSessionEnvironment(sessionID string, envVars map[string]str
 	return nil
 }
 
-// GetSessionEnvironment returns all environment variables for a session
-func (m *Manager) GetSessionEnvironment(sessionID string) (map[string]string, error) {
+// SetProjectSessionsEnvironment sets environment variable(s) on every session in a project and
+// returns the IDs of the sessions updated, sorted
+func (m *Manager) SetProjectSessionsEnvironment(projectID string, envVars map[string]string) []string {
 	m.mutex.RLock()
-	session, exists := m.sessions[sessionID]
-	m.mutex.RUnlock()
-
-	if !exists {
+	var sessions []*Session
+	for _, session := range m.sessions {
+		if session.ProjectID == projectID {
+			sessions = append(sessions, session)
+		}
+	}
+	m.mutex.RUnlock()
+
+	updated := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		session.SetEnvironmentBatch(envVars)
+		updated = append(updated, session.ID)
+	}
+	sort.Strings(updated)
+
+	m.logger.Info("Updated project session environment variables", map[string]interface{}{
+		"project_id": projectID,
+		"sessions":   len(updated),
+		"variables":  len(envVars),
+	})
+
+	return updated
+}
+
+// GetSessionEnvironment returns all environment variables for a session
+func (m *Manager) GetSessionEnvironment(sessionID string) (map[string]string, error) {
+	m.mutex.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mutex.RUnlock()
+
+	if !exists {
 		return nil, fmt.Errorf("session with ID %s not found", sessionID)
 	}
 
 	return session.GetAllEnvironment(), nil
 }
 
+// SetSessionShellOptions enables (true) or disables (false) shell options for a session
+// and returns the resulting set of enabled options
+func (m *Manager) SetSessionShellOptions(sessionID string, options map[string]bool) ([]string, error) {
+	for name := range options {
+		if !isKnownShellOption(name) {
+			return nil, fmt.Errorf("unknown shell option %q (supported: %s)", name, strings.Join(KnownShellOptions, ", "))
+		}
+	}
+
+	m.mutex.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("session with ID %s not found", sessionID)
+	}
+
+	session.mutex.Lock()
+	if session.shellOptions == nil {
+		session.shellOptions = make(map[string]bool)
+	}
+	for name, enabled := range options {
+		if enabled {
+			session.shellOptions[name] = true
+		} else {
+			delete(session.shellOptions, name)
+		}
+	}
+	enabled := session.enabledShellOptions()
+	session.mutex.Unlock()
+
+	m.logger.Info("Updated session shell options", map[string]interface{}{
+		"session_id": sessionID,
+		"enabled":    enabled,
+	})
+
+	return enabled, nil
+}
+
+// GetSessionShellOptions returns the enabled shell options for a session
+func (m *Manager) GetSessionShellOptions(sessionID string) ([]string, error) {
+	m.mutex.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("session with ID %s not found", sessionID)
+	}
+
+	return session.GetShellOptions(), nil
+}
+
+// SetSessionCurrentDir moves a session to an existing directory without running a command
+func (m *Manager) SetSessionCurrentDir(sessionID, dir string) error {
+	m.mutex.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("session with ID %s not found", sessionID)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if !m.config.Security.IsWorkingDirAllowed(dir) {
+		return fmt.Errorf("directory %s is not within the allowed working directories", dir)
+	}
+
+	session.mutex.Lock()
+	if dir != session.currentDir {
+		session.currentDir, session.previousDir = dir, session.currentDir
+	}
+	session.mutex.Unlock()
+
+	return nil
+}
+
+// SetSessionAutoCreateDirs sets whether cd in a session creates missing target directories
+func (m *Manager) SetSessionAutoCreateDirs(sessionID string, enabled bool) error {
+	m.mutex.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("session with ID %s not found", sessionID)
+	}
+
+	session.mutex.Lock()
+	session.AutoCreateDirs = enabled
+	session.mutex.Unlock()
+
+	return nil
+}
+
 // UnsetSessionEnvironment removes environment variable(s) from a session
 func (m *Manager) UnsetSessionEnvironment(sessionID string, keys []string) error {
 	m.mutex.RLock()
@@ -726,6 +1244,12 @@ func (m *Manager) ListSessions() []*Session {
 					session.currentDir = dbSession.WorkingDir
 				}
 
+				if policy, err := decodeSecurityPolicy(dbSession.SecurityPolicy); err == nil {
+					session.SecurityPolicy = policy
+				} else if inMemorySession != nil {
+					session.SecurityPolicy = inMemorySession.SecurityPolicy.clone()
+				}
+
 				sessions = append(sessions, session)
 			}
 			return sessions
@@ -738,17 +1262,18 @@ func (m *Manager) ListSessions() []*Session {
 	for _, session := range m.sessions {
 		// Create a copy to avoid data races
 		sessionCopy := &Session{
-			ID:            session.ID,
-			Name:          session.Name,
-			ProjectID:     session.ProjectID,
-			WorkingDir:    session.WorkingDir,
-			CreatedAt:     session.CreatedAt,
-			LastUsedAt:    session.LastUsedAt,
-			IsActive:      session.IsActive,
-			CommandCount:  session.CommandCount,
-			SuccessCount:  session.SuccessCount,
-			TotalDuration: session.TotalDuration,
-			currentDir:    session.currentDir,
+			ID:             session.ID,
+			Name:           session.Name,
+			ProjectID:      session.ProjectID,
+			WorkingDir:     session.GetWorkingDir(),
+			CreatedAt:      session.CreatedAt,
+			LastUsedAt:     session.LastUsedAt,
+			IsActive:       session.IsActive,
+			CommandCount:   session.CommandCount,
+			SuccessCount:   session.SuccessCount,
+			TotalDuration:  session.TotalDuration,
+			SecurityPolicy: session.SecurityPolicy.clone(),
+			currentDir:     session.currentDir,
 		}
 		sessions = append(sessions, sessionCopy)
 	}
@@ -764,11 +1289,14 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 	}
 
 	session.mutex.Lock()
-	defer session.mutex.Unlock()
-
 	if !session.IsActive {
+		session.mutex.Unlock()
 		return "", fmt.Errorf("session %s is not active", sessionID)
 	}
+	if err := m.prepareCdTargets(session, command); err != nil {
+		session.mutex.Unlock()
+		return "", err
+	}
 
 	startTime := time.Now()
 	session.LastUsedAt = startTime
@@ -778,12 +1306,20 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 		"command":     command,
 		"working_dir": session.currentDir,
 	})
+	prefix := session.commandPrefix()
+	session.mutex.Unlock()
 
 	// Execute the command with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), m.config.Session.DefaultTimeout)
 	defer cancel()
 
-	output, exitCode, err := m.executeCommandInSession(ctx, session, command)
+	live := session.startLiveCommand(command, "", nil)
+	captured, exitCode, err := m.executeCommandInSessionSplit(ctx, session, command, prefix, nil, "", live, m.config.Session.MaxOutputSize)
+	live.finish(exitCode)
+	output := captured.Combined
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 
 	endTime := time.Now()
 	duration := endTime.Sub(startTime)
@@ -794,12 +1330,13 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 
 	// Log command execution
 	m.logger.LogCommand(sessionID, command, duration, success, output, err)
+	m.notifyCommandCompletion(session, command, output, exitCode, success, duration, session.currentDir, false)
 
 	// Store command in database if available
 	if m.database != nil {
 		// Check database health before using it
 		if dbHealthErr := m.database.HealthCheck(); dbHealthErr == nil {
-			dbErr := m.database.StoreCommand(
+			dbErr := m.database.StoreCommandWithTags(
 				sessionID,
 				session.ProjectID,
 				command,
@@ -810,6 +1347,7 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 				endTime,
 				duration,
 				session.currentDir,
+				CommandTags(command, nil),
 			)
 
 			if dbErr != nil {
@@ -827,11 +1365,7 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 	}
 
 	// Update session working directory if command changed it
-	if success && m.isDirectoryChangeCommand(command) {
-		if newDir := m.extractDirectoryFromCommand(command); newDir != "" {
-			session.currentDir = m.resolveDirectoryPath(session.currentDir, newDir)
-		}
-	}
+	m.trackDirectoryChange(session, command, success)
 
 	// Return output and error
 	if err != nil {
@@ -841,8 +1375,46 @@ func (m *Manager) ExecuteCommand(sessionID, command string) (string, error) {
 	return output, nil
 }
 
+// notifyCommandCompletion records a finished command in the session's recent buffer and
+// sends a command completion event to the webhook, if configured
+func (m *Manager) notifyCommandCompletion(session *Session, command, output string, exitCode int, success bool, duration time.Duration, workingDir string, background bool) {
+	m.commandTotals.record(success)
+	session.recentCommands.add(RecentCommand{
+		Command:    command,
+		Output:     output,
+		ExitCode:   exitCode,
+		Success:    success,
+		DurationMs: duration.Milliseconds(),
+		WorkingDir: workingDir,
+		Background: background,
+		Timestamp:  time.Now(),
+	})
+
+	if m.commandWebhook == nil {
+		return
+	}
+
+	m.commandWebhook.Notify(monitoring.CommandEvent{
+		SessionID:  session.ID,
+		ProjectID:  session.ProjectID,
+		Command:    command,
+		Success:    success,
+		ExitCode:   exitCode,
+		DurationMs: duration.Milliseconds(),
+		Output:     output,
+		Background: background,
+		WorkingDir: workingDir,
+	})
+}
+
 // ExecuteCommandWithStreaming executes a command with streaming output (enhanced version of ExecuteCommand)
 func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string, error) {
+	return m.ExecuteCommandWithStreamingAndEnv(sessionID, command, nil)
+}
+
+// ExecuteCommandWithStreamingAndEnv executes a command with streaming output and per-command
+// environment overrides. The overrides apply only to this command; session state is unchanged.
+func (m *Manager) ExecuteCommandWithStreamingAndEnv(sessionID, command string, env map[string]string) (string, error) {
 	m.mutex.RLock()
 	session, exists := m.sessions[sessionID]
 	m.mutex.RUnlock()
@@ -852,7 +1424,12 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 	}
 
 	session.mutex.Lock()
-	defer session.mutex.Unlock()
+	err := m.prepareCdTargets(session, command)
+	prefix := session.commandPrefix()
+	session.mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), m.config.Session.DefaultTimeout)
 	defer cancel()
@@ -860,12 +1437,14 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 	// Record start time for accurate duration tracking
 	startTime := time.Now()
 
-	// Add a small delay to simulate streaming behavior while maintaining session state
-	// This is a transitional implementation that maintains session continuity
-	// while providing the streaming experience
+	// Output is stored as stream chunks under the ID the command is stored with below
+	commandID := uuid.New().String()
+	live := session.startLiveCommand(command, commandID, m.newStreamRecorder(sessionID, commandID, m.config.Session.MaxOutputSize))
+	output, exitCode, err := m.executeCommandInSessionWithStreaming(ctx, session, command, prefix, env, live)
+	live.finish(exitCode)
 
-	// Use the existing session-aware execution but with simulated streaming timing
-	output, exitCode, err := m.executeCommandInSessionWithStreaming(ctx, session, command)
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 
 	// Record end time for accurate duration tracking
 	endTime := time.Now()
@@ -874,22 +1453,17 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 	// Update session last used time
 	session.LastUsedAt = endTime
 
+	m.notifyCommandCompletion(session, command, output, exitCode, err == nil && exitCode == 0, duration, session.currentDir, false)
+
 	// Update working directory if this was a directory change command
-	if m.isDirectoryChangeCommand(command) {
-		targetDir := m.extractDirectoryFromCommand(command)
-		if targetDir != "" {
-			resolved := m.resolveDirectoryPath(session.currentDir, targetDir)
-			if info, err := os.Stat(resolved); err == nil && info.IsDir() {
-				session.currentDir = resolved
-			}
-		}
-	}
+	m.trackDirectoryChange(session, command, err == nil && exitCode == 0)
 
 	// Store command in database if available
 	if m.database != nil {
 		// Check database health before using it
 		if dbHealthErr := m.database.HealthCheck(); dbHealthErr == nil {
-			dbErr := m.database.StoreCommand(
+			dbErr := m.database.StoreCommandWithID(
+				commandID,
 				sessionID,
 				session.ProjectID,
 				command,
@@ -900,6 +1474,7 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 				endTime,
 				duration,
 				session.currentDir,
+				CommandTags(command, nil),
 			)
 
 			if dbErr != nil {
@@ -907,6 +1482,8 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 					"session_id": sessionID,
 					"command":    command,
 				})
+			} else {
+				m.saveStreamChunks(live)
 			}
 		} else {
 			m.logger.Debug("Database not available for storing streaming command", map[string]interface{}{
@@ -932,117 +1509,201 @@ func (m *Manager) ExecuteCommandWithStreaming(sessionID, command string) (string
 	return output, nil
 }
 
-// executeCommandInSessionWithStreaming executes a command with enhanced streaming support
-func (m *Manager) executeCommandInSessionWithStreaming(ctx context.Context, session *Session, command string) (string, int, error) {
-	// For true session persistence with streaming simulation
-	shell := m.config.Session.Shell
-	if shell == "" {
-		// Always use bash for consistent behavior, especially for loop commands
-		shell = "/bin/bash"
+// executeCommandInSessionWithStreaming executes a command like executeCommandInSession, writing its
+// output to live line by line as it is produced so it is recorded as stream chunks
+func (m *Manager) executeCommandInSessionWithStreaming(ctx context.Context, session *Session, command, prefix string, envOverrides map[string]string, live *liveCommand) (string, int, error) {
+	output, exitCode, err := m.executeCommandInSessionSplit(ctx, session, command, prefix, envOverrides, "", live, m.config.Session.MaxOutputSize)
+	return output.Combined, exitCode, err
+}
+
+// IsCommentOnlyCommand reports whether every non-blank line of command is a # comment. A command
+// with no lines at all counts as comment-only.
+func IsCommentOnlyCommand(command string) bool {
+	for _, line := range strings.Split(command, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
 	}
+	return true
+}
 
-	// H4: Escape the current directory to prevent shell injection
-	escapedDir := shellEscape(session.currentDir)
-	fullCommand := fmt.Sprintf("cd %s && %s", escapedDir, command)
+// runnableCommand returns command with the no-op builtin appended when it holds only comments, since
+// a POSIX shell cannot parse the `cd dir && ...` list or `{ ... }` group with nothing in it
+func runnableCommand(command string) string {
+	if posixShell && IsCommentOnlyCommand(command) {
+		return command + "\n" + NoOpCommand
+	}
+	return command
+}
 
-	cmd := exec.CommandContext(ctx, shell, "-c", fullCommand)
-	cmd.Dir = session.WorkingDir
+// buildCommandEnv builds a command environment from the session environment with
+// per-command overrides merged on top. Neither map is modified.
+func buildCommandEnv(sessionEnv, overrides map[string]string) []string {
+	merged := make(map[string]string, len(sessionEnv)+len(overrides))
+	for k, v := range sessionEnv {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
 
-	// Set environment from session
-	env := make([]string, 0, len(session.shellEnv))
-	for k, v := range session.shellEnv {
+	env := make([]string, 0, len(merged))
+	for k, v := range merged {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
-	cmd.Env = env
+	return env
+}
 
-	// Execute command - this will take the actual time the command needs
-	// For sleep or loop commands, this will naturally take the expected time
-	output, err := cmd.CombinedOutput()
-	exitCode := 0
+// CommandOutput holds a foreground command's output both interleaved as it was produced and split
+// by stream. The persistent shell merges the streams, so there everything is reported as stdout.
+type CommandOutput struct {
+	Combined string
+	Stdout   string
+	Stderr   string
 
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = 1
-		}
-	}
+	// Whether output beyond the output limit was dropped from the middle of each stream, leaving
+	// a line that says how many bytes were omitted
+	Truncated bool
+
+	// Set by ExecuteCommandWithOptions once the command is stored in the history
+	CommandID    string // History ID of the stored command
+	Streamed     bool   // Whether output was recorded as stream chunks while the command ran
+	StreamChunks int    // Stream chunks recorded, including the final status chunk
+
+	// Set by ExecuteCommandWithOptions when ExecOptions.PTY requested a pseudo-terminal
+	PTY      bool   // Whether the command ran attached to a pseudo-terminal
+	PTYError string // Why the command ran without the requested pseudo-terminal
+
+	// Why the command was stopped before finishing: TimeoutReasonTotal or TimeoutReasonIdle
+	TimeoutReason string
+}
 
-	return string(output), exitCode, err
+// executeCommandInSession executes a command in the session's persistent shell and returns its
+// combined output. A non-empty stdin is written to the command's standard input, which is then closed.
+// prefix is the session's commandPrefix, which a fresh shell runs before the command.
+func (m *Manager) executeCommandInSession(ctx context.Context, session *Session, command, prefix string, envOverrides map[string]string, stdin string) (string, int, error) {
+	output, exitCode, err := m.executeCommandInSessionSplit(ctx, session, command, prefix, envOverrides, stdin, nil, m.config.Session.MaxOutputSize)
+	return output.Combined, exitCode, err
 }
 
-// executeCommandInSession executes a command in the session's persistent shell
-func (m *Manager) executeCommandInSession(ctx context.Context, session *Session, command string) (string, int, error) {
-	// For true session persistence, we need to use the persistent shell
-	// For now, we'll use a simpler approach that maintains working directory
+// executeCommandInSessionSplit executes a command like executeCommandInSession and also returns its
+// stdout and stderr separately. Output is also written to live as it is produced. Each of the
+// combined output, stdout and stderr keeps at most outputLimit bytes (see cappedOutput). prefix is
+// the session's commandPrefix, built by the caller under session.mutex; the rest of the session
+// state the command needs is read under session.mutex here, so the caller must not hold it.
+func (m *Manager) executeCommandInSessionSplit(ctx context.Context, session *Session, command, prefix string, envOverrides map[string]string, stdin string, live *liveCommand, outputLimit int) (CommandOutput, int, error) {
+	if m.persistentShellEnabled() {
+		captured := newCappedOutput(outputLimit)
+		exitCode, err := m.executeInPersistentShell(ctx, session, command, envOverrides, stdin, live, captured)
+		output := captured.String()
+		return CommandOutput{Combined: output, Stdout: output, Truncated: captured.Truncated()}, exitCode, err
+	}
+
+	// Without persistent_shell each command runs in a fresh shell that only inherits the
+	// working directory, environment and options tracked for the session
 
 	shell := m.config.Session.Shell
 	if shell == "" {
-		// Always use bash for consistent behavior
-		shell = "/bin/bash"
+		// Always use bash (cmd.exe on Windows) for consistent behavior
+		shell = defaultShell()
 	}
 
-	// H4: Escape the current directory to prevent shell injection
-	escapedDir := shellEscape(session.currentDir)
-	fullCommand := fmt.Sprintf("cd %s && %s", escapedDir, command)
-
-	cmd := exec.CommandContext(ctx, shell, "-c", fullCommand)
-	cmd.Dir = session.WorkingDir
+	session.mutex.RLock()
+	fullCommand := sessionScript(shell, session.currentDir, prefix, command)
+	// Set environment from session, with per-command overrides on top
+	env := buildCommandEnv(session.shellEnv, envOverrides)
+	session.mutex.RUnlock()
 
-	// Set environment from session
-	env := make([]string, 0, len(session.shellEnv))
-	for k, v := range session.shellEnv {
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
-	}
+	cmd := newShellCommand(ctx, shell, fullCommand)
+	cmd.Dir = session.GetWorkingDir()
 	cmd.Env = env
 
 	// CRITICAL FIX: Set up proper process group handling for timeout support
 	// This ensures that when the context is cancelled, all child processes are terminated
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true, // Create a new process group
+	setProcessGroup(cmd)
+
+	if err := m.applyRunAsUser(cmd); err != nil {
+		return CommandOutput{}, 1, err
 	}
 
 	// Capture output using pipes
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", 1, fmt.Errorf("failed to create stdout pipe: %v", err)
+		return CommandOutput{}, 1, fmt.Errorf("failed to create stdout pipe: %v", err)
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return "", 1, fmt.Errorf("failed to create stderr pipe: %v", err)
+		return CommandOutput{}, 1, fmt.Errorf("failed to create stderr pipe: %v", err)
+	}
+	var stdinPipe io.WriteCloser
+	if stdin != "" {
+		if stdinPipe, err = cmd.StdinPipe(); err != nil {
+			return CommandOutput{}, 1, fmt.Errorf("failed to create stdin pipe: %v", err)
+		}
 	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return "", 1, fmt.Errorf("failed to start command: %v", err)
+		return CommandOutput{}, 1, fmt.Errorf("failed to start command: %v", err)
+	}
+
+	// Write stdin from its own goroutine so a large payload cannot deadlock against output the
+	// command is blocked writing. Errors mean the command exited or stopped reading early.
+	if stdinPipe != nil {
+		go func() {
+			io.WriteString(stdinPipe, stdin)
+			stdinPipe.Close()
+		}()
 	}
 
-	// Read output in goroutines
-	var outputBuilder strings.Builder
+	// Read output in goroutines, keeping each stream and the interleaved combination
+	var outputMu sync.Mutex
+	combinedOutput, stdoutOutput, stderrOutput := newCappedOutput(outputLimit), newCappedOutput(outputLimit), newCappedOutput(outputLimit)
 	outputDone := make(chan bool, 2)
 
-	go func() {
-		scanner := bufio.NewScanner(stdout)
+	capture := func(pipe io.Reader, streamOutput *cappedOutput, chunkType string) {
+		scanner := bufio.NewScanner(pipe)
 		for scanner.Scan() {
-			outputBuilder.WriteString(scanner.Text() + "\n")
+			line := []byte(scanner.Text() + "\n")
+			outputMu.Lock()
+			streamOutput.Write(line)
+			combinedOutput.Write(line)
+			outputMu.Unlock()
+			live.WriteStream(chunkType, line)
 		}
 		outputDone <- true
-	}()
+	}
+	go capture(stdout, stdoutOutput, database.ChunkTypeStdout)
+	go capture(stderr, stderrOutput, database.ChunkTypeStderr)
 
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			outputBuilder.WriteString(scanner.Text() + "\n")
+	collected := func() CommandOutput {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		return CommandOutput{
+			Combined:  combinedOutput.String(),
+			Stdout:    stdoutOutput.String(),
+			Stderr:    stderrOutput.String(),
+			Truncated: combinedOutput.Truncated(),
 		}
-		outputDone <- true
-	}()
+	}
 
-	// Set up a goroutine to handle command completion
+	// Set up a goroutine to handle command completion. Output must be fully read
+	// before calling Wait, since Wait closes the pipes and would drop unread output.
 	done := make(chan error, 1)
 	go func() {
+		<-outputDone
+		<-outputDone
 		done <- cmd.Wait()
 	}()
 
+	exitCode, err := waitForCommand(ctx, cmd, done)
+	return collected(), exitCode, err
+}
+
+// waitForCommand waits for the result of cmd.Wait on done, or for ctx to end. A cancelled
+// command's process group is killed and exit code 124 returned with the context's error.
+func waitForCommand(ctx context.Context, cmd *exec.Cmd, done <-chan error) (int, error) {
 	// Wait for either completion or context cancellation
 	select {
 	case <-ctx.Done():
@@ -1051,9 +1712,9 @@ func (m *Manager) executeCommandInSession(ctx context.Context, session *Session,
 		if cmd.Process != nil {
 			pgid := cmd.Process.Pid
 			// Send SIGTERM to the entire process group
-			if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+			if err := killProcessGroup(pgid, syscall.SIGTERM); err != nil {
 				// If SIGTERM fails, try SIGKILL
-				syscall.Kill(-pgid, syscall.SIGKILL)
+				killProcessGroup(pgid, syscall.SIGKILL)
 			}
 		}
 
@@ -1063,22 +1724,13 @@ func (m *Manager) executeCommandInSession(ctx context.Context, session *Session,
 		case <-time.After(100 * time.Millisecond):
 			// Force kill if still running
 			if cmd.Process != nil {
-				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				killProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
 			}
 		}
 
-		// Wait for output goroutines to finish
-		go func() {
-			<-outputDone
-			<-outputDone
-		}()
-
-		return outputBuilder.String(), 124, ctx.Err() // Exit code 124 indicates timeout
+		return 124, ctx.Err() // Exit code 124 indicates timeout
 	case err := <-done:
-		// Command completed normally, wait for output to be read
-		<-outputDone
-		<-outputDone
-
+		// Command completed normally and all output has been read
 		exitCode := 0
 		if err != nil {
 			if exitError, ok := err.(*exec.ExitError); ok {
@@ -1088,21 +1740,8 @@ func (m *Manager) executeCommandInSession(ctx context.Context, session *Session,
 			}
 		}
 
-		return outputBuilder.String(), exitCode, err
-	}
-} // isDirectoryChangeCommand checks if the command is a directory change command
-func (m *Manager) isDirectoryChangeCommand(command string) bool {
-	trimmed := strings.TrimSpace(command)
-	return strings.HasPrefix(trimmed, "cd ") || trimmed == "cd"
-}
-
-// extractDirectoryFromCommand extracts the directory path from a cd command
-func (m *Manager) extractDirectoryFromCommand(command string) string {
-	parts := strings.Fields(strings.TrimSpace(command))
-	if len(parts) >= 2 && parts[0] == "cd" {
-		return parts[1]
+		return exitCode, err
 	}
-	return ""
 }
 
 // resolveDirectoryPath resolves a directory path relative to the current directory
@@ -1121,6 +1760,11 @@ func (m *Manager) resolveDirectoryPath(currentDir, targetDir string) string {
 
 // CloseSession closes a terminal session and cleans up resources
 func (m *Manager) CloseSession(sessionID string) error {
+	return m.closeSession(sessionID, SessionEventClosed, CloseReasonRequested)
+}
+
+// closeSession closes a session like CloseSession, recording the lifecycle event and reason
+func (m *Manager) closeSession(sessionID, event, reason string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -1139,26 +1783,13 @@ func (m *Manager) CloseSession(sessionID string) error {
 		session.cancel()
 	}
 
-	// Close pipes
-	if session.stdin != nil {
-		session.stdin.Close()
-	}
-	if session.stdout != nil {
-		session.stdout.Close()
-	}
-	if session.stderr != nil {
-		session.stderr.Close()
-	}
-
-	// Kill the process
-	if session.cmd != nil && session.cmd.Process != nil {
-		session.cmd.Process.Kill()
-		session.cmd.Wait()
-	}
+	// Close the persistent shell
+	m.stopSessionShell(session)
 
 	// Clean up background processes
 	for processID, bgProcess := range session.BackgroundProcesses {
 		if bgProcess.cmd != nil && bgProcess.cmd.Process != nil && bgProcess.IsRunning {
+			bgProcess.noteSignalSent(syscall.SIGKILL)
 			bgProcess.cmd.Process.Kill()
 			bgProcess.cmd.Wait()
 			m.logger.Info("Killed background process", map[string]interface{}{
@@ -1193,8 +1824,7 @@ func (m *Manager) CloseSession(sessionID string) error {
 		successRate = float64(session.SuccessCount) / float64(session.CommandCount)
 	}
 
-	m.logger.LogSessionEvent("closed", sessionID, session.Name, map[string]interface{}{
-		"project_id":       session.ProjectID,
+	m.recordSessionEvent(event, reason, sessionID, session.Name, session.ProjectID, map[string]interface{}{
 		"command_count":    session.CommandCount,
 		"success_count":    session.SuccessCount,
 		"success_rate":     successRate,
@@ -1235,7 +1865,7 @@ func (m *Manager) DeleteProjectSessions(projectID string) ([]string, error) {
 	// Delete each session
 	var deletedSessions []string
 	for _, sessionID := range sessionIDs {
-		if err := m.CloseSession(sessionID); err != nil {
+		if err := m.closeSession(sessionID, SessionEventClosed, CloseReasonProjectDeleted); err != nil {
 			m.logger.Error("Failed to delete session", err, map[string]interface{}{
 				"session_id": sessionID,
 				"project_id": projectID,
@@ -1399,6 +2029,7 @@ func (m *Manager) GetResourceMonitor() *monitoring.ResourceMonitor {
 // startCleanupRoutine starts the automatic cleanup routine for inactive sessions
 func (m *Manager) startCleanupRoutine() {
 	m.cleanupTicker = time.NewTicker(m.config.Session.CleanupInterval)
+	m.cleanupState.running.Store(true)
 
 	go func() {
 		// Panic recovery to prevent server crashes
@@ -1412,11 +2043,16 @@ func (m *Manager) startCleanupRoutine() {
 				m.startCleanupRoutine()
 			}
 		}()
+		defer m.cleanupState.running.Store(false)
 
 		for {
 			select {
 			case <-m.cleanupTicker.C:
+				if m.cleanupPaused() {
+					continue
+				}
 				m.cleanupInactiveSessions()
+				m.cleanupState.recordRun()
 			case <-m.stopCleanup:
 				m.cleanupTicker.Stop()
 				return
@@ -1431,6 +2067,7 @@ func (m *Manager) startCleanupRoutine() {
 // startResourceCleanupRoutine starts the automatic resource cleanup routine
 func (m *Manager) startResourceCleanupRoutine() {
 	m.resourceTicker = time.NewTicker(m.config.Session.ResourceCleanupInterval)
+	m.resourceCleanupState.running.Store(true)
 
 	go func() {
 		// Panic recovery to prevent server crashes
@@ -1444,11 +2081,16 @@ func (m *Manager) startResourceCleanupRoutine() {
 				m.startResourceCleanupRoutine()
 			}
 		}()
+		defer m.resourceCleanupState.running.Store(false)
 
 		for {
 			select {
 			case <-m.resourceTicker.C:
+				if m.cleanupPaused() {
+					continue
+				}
 				m.cleanupResources()
+				m.resourceCleanupState.recordRun()
 			case <-m.stopResourceCleanup:
 				m.resourceTicker.Stop()
 				return
@@ -1460,50 +2102,178 @@ func (m *Manager) startResourceCleanupRoutine() {
 	}()
 }
 
-// cleanupInactiveSessions removes sessions that have been inactive for too long
-func (m *Manager) cleanupInactiveSessions() {
-	m.mutex.RLock()
-	var sessionsToCleanup []string
-	cutoffTime := time.Now().Add(-m.config.Session.DefaultTimeout)
+// startWALCheckpointRoutine periodically checkpoints and truncates the database WAL so it cannot
+// grow unbounded when readers keep SQLite's automatic checkpoints from completing
+func (m *Manager) startWALCheckpointRoutine() {
+	ticker := time.NewTicker(m.config.Database.WALCheckpointInterval)
 
-	for sessionID, session := range m.sessions {
-		session.mutex.RLock()
-		if session.IsActive && session.LastUsedAt.Before(cutoffTime) {
-			sessionsToCleanup = append(sessionsToCleanup, sessionID)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.checkpointWAL()
+			case <-m.ctx.Done():
+				return
+			}
 		}
-		session.mutex.RUnlock()
-	}
-	m.mutex.RUnlock()
+	}()
+}
 
-	// Close inactive sessions
-	for _, sessionID := range sessionsToCleanup {
-		m.logger.Info("Cleaning up inactive session", map[string]interface{}{
-			"session_id": sessionID,
-			"reason":     "inactive_timeout",
-		})
+// checkpointWAL runs one WAL checkpoint, logging when it reclaimed space or could not complete
+func (m *Manager) checkpointWAL() {
+	checkpoint, err := m.database.CheckpointWAL(m.ctx)
+	if err != nil {
+		m.logger.Error("Failed to checkpoint database WAL", err, nil)
+		return
+	}
 
-		if err := m.CloseSession(sessionID); err != nil {
-			m.logger.Error("Failed to cleanup session", err, map[string]interface{}{
-				"session_id": sessionID,
-			})
-		}
+	fields := map[string]interface{}{
+		"size_before_bytes":   checkpoint.SizeBeforeBytes,
+		"size_after_bytes":    checkpoint.SizeAfterBytes,
+		"checkpointed_frames": checkpoint.CheckpointedFrames,
+	}
+	if checkpoint.Busy {
+		m.logger.Warn("Database WAL checkpoint could not complete while the database was busy", fields)
+	} else if checkpoint.SizeBeforeBytes > 0 {
+		m.logger.Debug("Checkpointed database WAL", fields)
 	}
 }
 
-// cleanupResources performs automatic resource cleanup based on configuration limits
-func (m *Manager) cleanupResources() {
-	// C4 FIX: Collect information while holding read lock, then release before operations
+// startVacuumRoutine periodically vacuums and analyzes the database so the file shrinks again
+// after command cleanup deletes history
+func (m *Manager) startVacuumRoutine() {
+	ticker := time.NewTicker(m.config.Database.VacuumInterval)
 
-	// 1. Check if we need to cleanup excess sessions
-	m.mutex.RLock()
-	needSessionCleanup := len(m.sessions) > m.config.Session.MaxSessions
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.vacuumDatabase()
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+}
 
-	// 2. Collect sessions that need background process cleanup
-	type sessionCleanupInfo struct {
-		sessionID           string
-		needsBgCleanup      bool
-		processesToTruncate []string
-	}
+// vacuumDatabase runs one vacuum unless the database is unhealthy or a foreground command is
+// running, logging the space reclaimed. A skipped vacuum waits for the next tick.
+func (m *Manager) vacuumDatabase() {
+	if err := m.database.HealthCheck(); err != nil {
+		m.logger.Warn("Skipping database vacuum: health check failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if m.foregroundCommandRunning() {
+		m.logger.Debug("Skipping database vacuum while a command is running", nil)
+		return
+	}
+
+	result, err := m.database.Vacuum(m.ctx)
+	if err != nil {
+		m.logger.Error("Failed to vacuum database", err, nil)
+		return
+	}
+	if result.Skipped {
+		m.logger.Debug("Skipped database vacuum", map[string]interface{}{
+			"reason": result.SkipReason,
+		})
+		return
+	}
+
+	m.logger.Info("Vacuumed database", map[string]interface{}{
+		"size_before_bytes": result.SizeBeforeBytes,
+		"size_after_bytes":  result.SizeAfterBytes,
+		"reclaimed_bytes":   result.ReclaimedBytes,
+		"duration_ms":       result.DurationMs,
+	})
+}
+
+// foregroundCommandRunning reports whether the command most recently started in any session is
+// still running
+func (m *Manager) foregroundCommandRunning() bool {
+	m.mutex.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mutex.RUnlock()
+
+	for _, session := range sessions {
+		session.liveMu.Lock()
+		live := session.liveCommand
+		session.liveMu.Unlock()
+		if live == nil {
+			continue
+		}
+		live.mutex.Lock()
+		running := live.running
+		live.mutex.Unlock()
+		if running {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCleanupNow runs one pass of the inactive session and resource cleanup routines immediately.
+// It returns false without doing anything while cleanup is paused.
+func (m *Manager) RunCleanupNow() bool {
+	if m.cleanupPaused() {
+		return false
+	}
+	m.cleanupInactiveSessions()
+	m.cleanupResources()
+	return true
+}
+
+// cleanupInactiveSessions removes sessions that have been inactive for too long
+func (m *Manager) cleanupInactiveSessions() {
+	m.mutex.RLock()
+	var sessionsToCleanup []string
+	cutoffTime := time.Now().Add(-m.config.Session.DefaultTimeout)
+
+	for sessionID, session := range m.sessions {
+		session.mutex.RLock()
+		if session.IsActive && session.LastUsedAt.Before(cutoffTime) {
+			sessionsToCleanup = append(sessionsToCleanup, sessionID)
+		}
+		session.mutex.RUnlock()
+	}
+	m.mutex.RUnlock()
+
+	// Close inactive sessions
+	for _, sessionID := range sessionsToCleanup {
+		m.logger.Info("Cleaning up inactive session", map[string]interface{}{
+			"session_id": sessionID,
+			"reason":     "inactive_timeout",
+		})
+
+		if err := m.closeSession(sessionID, SessionEventCleanedUp, CloseReasonInactive); err != nil {
+			m.logger.Error("Failed to cleanup session", err, map[string]interface{}{
+				"session_id": sessionID,
+			})
+		}
+	}
+}
+
+// cleanupResources performs automatic resource cleanup based on configuration limits
+func (m *Manager) cleanupResources() {
+	// C4 FIX: Collect information while holding read lock, then release before operations
+
+	// 1. Check if we need to cleanup excess sessions
+	m.mutex.RLock()
+	needSessionCleanup := len(m.sessions) > m.config.Session.MaxSessions
+
+	// 2. Collect sessions that need background process cleanup
+	type sessionCleanupInfo struct {
+		sessionID           string
+		needsBgCleanup      bool
+		processesToTruncate []string
+	}
 	var cleanupInfos []sessionCleanupInfo
 
 	for sessionID, session := range m.sessions {
@@ -1555,6 +2325,12 @@ func (m *Manager) cleanupResources() {
 		m.cleanupExcessCommands()
 	}
 
+	// 6. Retry killing processes that survived SIGKILL and forget those that are finally gone
+	m.ReapStuckProcesses()
+
+	// 7. Mark processes whose PID disappeared without their exit being seen as stopped
+	m.ReapVanishedProcesses()
+
 	m.logger.Debug("Resource cleanup completed", map[string]interface{}{
 		"active_sessions":      len(m.sessions),
 		"max_sessions":         m.config.Session.MaxSessions,
@@ -1597,7 +2373,7 @@ func (m *Manager) cleanupExcessSessions() {
 
 		// Note: We need to release the read lock before calling CloseSession
 		go func(id string) {
-			if err := m.CloseSession(id); err != nil {
+			if err := m.closeSession(id, SessionEventCleanedUp, CloseReasonMaxSessions); err != nil {
 				m.logger.Error("Failed to cleanup excess session", err, map[string]interface{}{
 					"session_id": id,
 				})
@@ -1632,8 +2408,13 @@ func (m *Manager) cleanupExcessBackgroundProcesses(session *Session) {
 	for i := 0; i < excessCount; i++ {
 		processID := processes[i].id
 		if proc, exists := session.BackgroundProcesses[processID]; exists {
+			proc.Mutex.Lock()
+			proc.stopRequested = true
+			proc.Mutex.Unlock()
+
 			// Kill the process if it's still running
 			if proc.IsRunning && proc.cmd != nil && proc.cmd.Process != nil {
+				proc.noteSignalSent(syscall.SIGKILL)
 				proc.cmd.Process.Kill()
 			}
 			delete(session.BackgroundProcesses, processID)
@@ -1688,6 +2469,19 @@ func (m *Manager) cleanupExcessCommands() {
 			"deleted_count": chunksDeleted,
 		})
 	}
+
+	// Optionally remove rows left behind by sessions that were not deleted cleanly
+	if m.config.Database.CleanupOrphans {
+		orphans, err := m.database.DeleteOrphanedRecords()
+		if err != nil {
+			m.logger.Error("Failed to cleanup orphaned records", err, nil)
+		} else if orphans.Commands > 0 || orphans.StreamChunks > 0 {
+			m.logger.Info("Cleaned up orphaned records", map[string]interface{}{
+				"commands":      orphans.Commands,
+				"stream_chunks": orphans.StreamChunks,
+			})
+		}
+	}
 }
 
 // Shutdown gracefully shuts down the manager
@@ -1705,6 +2499,11 @@ func (m *Manager) Shutdown() {
 		m.resourceMonitor.Stop()
 	}
 
+	// Stop command webhook delivery
+	if m.commandWebhook != nil {
+		m.commandWebhook.Stop()
+	}
+
 	// Close all active sessions
 	m.mutex.RLock()
 	sessionIDs := make([]string, 0, len(m.sessions))
@@ -1714,7 +2513,7 @@ func (m *Manager) Shutdown() {
 	m.mutex.RUnlock()
 
 	for _, sessionID := range sessionIDs {
-		if err := m.CloseSession(sessionID); err != nil {
+		if err := m.closeSession(sessionID, SessionEventClosed, CloseReasonShutdown); err != nil {
 			m.logger.Error("Failed to close session during shutdown", err, map[string]interface{}{
 				"session_id": sessionID,
 			})
@@ -1895,12 +2694,12 @@ func (sat *SessionActivityTracker) RecordCommand(duration time.Duration, command
 	sat.hourlyActivity[now.Hour()]++
 
 	// Categorize command type (extract first word)
-	cmdType := extractCommandType(command)
+	cmdType := ExtractCommandType(command)
 	sat.commandTypes[cmdType]++
 
 	// Track error categories
 	if !success && errorMsg != "" {
-		category := categorizeError(errorMsg)
+		category := CategorizeError(errorMsg)
 		sat.errorCategories[category]++
 	}
 
@@ -1945,8 +2744,8 @@ func (sat *SessionActivityTracker) GetMetrics() (commandTypes map[string]int, er
 	return
 }
 
-// extractCommandType extracts the command type from a command string
-func extractCommandType(command string) string {
+// ExtractCommandType returns the base command name (without path) used to group commands
+func ExtractCommandType(command string) string {
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
 		return "empty"
@@ -1959,8 +2758,8 @@ func extractCommandType(command string) string {
 	return cmd
 }
 
-// categorizeError categorizes an error message into a category
-func categorizeError(errorMsg string) string {
+// CategorizeError maps an error message to a coarse category such as timeout or not_found
+func CategorizeError(errorMsg string) string {
 	lowerErr := strings.ToLower(errorMsg)
 
 	switch {
@@ -1983,32 +2782,267 @@ func categorizeError(errorMsg string) string {
 	}
 }
 
+// ExecOptions configures a foreground command run by ExecuteCommandWithOptions. The zero value runs
+// the command with the configured default timeout, capturing up to max_output_size bytes.
+type ExecOptions struct {
+	// Timeout stops the command once it has run this long; zero or less uses default_timeout
+	Timeout time.Duration
+
+	// IdleTimeout also stops the command once it has produced no output for this long, so Timeout
+	// can be a generous cap for commands that are slow but keep printing progress. Output without a
+	// newline, such as a progress bar redrawn with \r, may not count until a line is complete. Zero
+	// or less disables the idle check.
+	IdleTimeout time.Duration
+
+	// Env holds environment overrides for this command only; session state is unchanged
+	Env map[string]string
+
+	// Stdin is written to the command's standard input, which is then closed so the command sees
+	// end of file
+	Stdin string
+
+	// Tags label the command's history record, along with those detected from the command (see
+	// CommandTags)
+	Tags []string
+
+	// PTY attaches the command to a pseudo-terminal so TTY-sensitive tools behave as in a terminal.
+	// Such a command runs in a fresh shell even with persistent_shell, and its stdout and stderr
+	// are merged. When no pseudo-terminal can be allocated the command runs without one and
+	// PTYError says why.
+	PTY bool
+
+	// MaxOutputBytes caps the output captured, and each of stdout and stderr, instead of
+	// max_output_size; a negative limit captures everything. Past the limit the start and end of
+	// the output are kept and the middle is replaced by a line giving the number of bytes omitted;
+	// the command itself still runs to completion.
+	MaxOutputBytes int
+}
+
 // ExecuteCommandWithTimeout executes a command with a timeout
 func (m *Manager) ExecuteCommandWithTimeout(sessionID, command string, timeout time.Duration) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	output, err := m.ExecuteCommandWithOptions(sessionID, command, ExecOptions{Timeout: timeout})
+	return output.Combined, err
+}
 
+// ExecuteCommandWithOptions executes a command configured by opts and records it in the command
+// history. The output is returned both combined and split into stdout and stderr; TimeoutReason
+// tells which limit stopped the command, if any.
+func (m *Manager) ExecuteCommandWithOptions(sessionID, command string, opts ExecOptions) (CommandOutput, error) {
 	session, err := m.GetSession(sessionID)
 	if err != nil {
-		return "", fmt.Errorf("session not found: %v", err)
+		return CommandOutput{}, fmt.Errorf("session not found: %v", err)
+	}
+
+	timeout, maxOutputBytes := opts.Timeout, opts.MaxOutputBytes
+	if timeout <= 0 {
+		timeout = m.config.Session.DefaultTimeout
+	}
+	if maxOutputBytes == 0 {
+		maxOutputBytes = m.config.Session.MaxOutputSize
+	}
+
+	session.mutex.Lock()
+	err = m.prepareCdTargets(session, command)
+	prefix := session.commandPrefix()
+	session.mutex.Unlock()
+	if err != nil {
+		return CommandOutput{}, err
 	}
 
+	var term *pseudoTerminal
+	ptyError := ""
+	if opts.PTY {
+		var ptyErr error
+		if term, ptyErr = openPseudoTerminal(); ptyErr != nil {
+			ptyError = ptyErr.Error()
+			m.logger.Warn("Running command without the requested pseudo-terminal", map[string]interface{}{
+				"session_id": sessionID,
+				"error":      ptyError,
+			})
+		}
+	}
+
+	// Optionally let the timeout coreutil enforce the limit; the context deadline is
+	// extended past the kill-after grace so it only acts as a safety net. The persistent
+	// shell runs commands in-process, so it relies on the context deadline alone, as do
+	// pseudo-terminal commands, which timeout(1) would move out of the terminal's foreground.
+	ctxTimeout := timeout
+	wrappedCommand, wrapped := command, false
+	if term == nil && !m.persistentShellEnabled() {
+		wrappedCommand, wrapped = m.wrapWithTimeoutCommand(prefix+command, timeout)
+	}
+	if wrapped {
+		ctxTimeout = timeout + m.config.Session.TerminationGracePeriod + time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
+	defer cancel()
+
 	// Use the existing executeCommandInSession method with timeout context
-	output, _, err := m.executeCommandInSession(ctx, session, command)
+	startTime := time.Now()
+	var output CommandOutput
+	var exitCode int
+	commandID := ""
+	if m.database != nil {
+		commandID = uuid.New().String()
+	}
+	live := session.startLiveCommand(command, commandID, m.newStreamRecorder(sessionID, commandID, maxOutputBytes))
+	var idled func() bool
+	if opts.IdleTimeout > 0 {
+		idled = watchIdle(ctx, cancel, live, opts.IdleTimeout)
+	}
+	switch {
+	case term != nil:
+		output, exitCode, err = m.executeCommandInPTY(ctx, session, command, prefix, opts.Env, opts.Stdin, live, term, maxOutputBytes)
+	default:
+		output, exitCode, err = m.executeCommandInSessionSplit(ctx, session, wrappedCommand, prefix, opts.Env, opts.Stdin, live, maxOutputBytes)
+	}
+	output.PTY, output.PTYError = term != nil, ptyError
+	duration := time.Since(startTime)
+
+	// timeout exits 124 on expiry, or 128+9 if it had to escalate to SIGKILL
+	if wrapped && err != nil && (exitCode == 124 || exitCode == 137) && duration >= timeout {
+		exitCode = 124
+		err = fmt.Errorf("command exceeded timeout of %s: %w", timeout, context.DeadlineExceeded)
+	}
+	switch {
+	case err != nil && idled != nil && idled():
+		exitCode = 124
+		err = fmt.Errorf("command produced no output for %s: %w", opts.IdleTimeout, context.DeadlineExceeded)
+		output.TimeoutReason = TimeoutReasonIdle
+	case errors.Is(err, context.DeadlineExceeded):
+		output.TimeoutReason = TimeoutReasonTotal
+	}
+	output.Streamed = live.stream != nil
+	output.StreamChunks = live.finish(exitCode)
+
+	workingDir := session.GetCurrentDir()
+	m.notifyCommandCompletion(session, command, output.Combined, exitCode, err == nil && exitCode == 0, duration, workingDir, false)
+
+	if m.database != nil {
+		if dbErr := m.database.StoreCommandWithID(commandID, sessionID, session.ProjectID, command, output.Combined, exitCode, err == nil && exitCode == 0,
+			startTime, startTime.Add(duration), duration, workingDir, CommandTags(command, opts.Tags)); dbErr != nil {
+			m.logger.Error("Failed to store command in database", dbErr, map[string]interface{}{
+				"session_id": sessionID,
+				"command":    command,
+			})
+		} else {
+			output.CommandID = commandID
+			m.saveStreamChunks(live)
+		}
+	}
+
+	session.mutex.Lock()
+	m.trackDirectoryChange(session, command, err == nil && exitCode == 0)
+	session.mutex.Unlock()
+
 	return output, err
 }
 
+var (
+	timeoutCommandOnce sync.Once
+	timeoutCommandPath string
+)
+
+// wrapWithTimeoutCommand wraps command with `timeout --kill-after=<grace> <seconds>` when
+// UseTimeoutCommand is enabled and the timeout utility is installed. Windows' timeout.exe is an
+// unrelated tool, so commands are never wrapped there.
+func (m *Manager) wrapWithTimeoutCommand(command string, timeout time.Duration) (string, bool) {
+	if !posixShell || !m.config.Session.UseTimeoutCommand || timeout <= 0 {
+		return command, false
+	}
+
+	timeoutCommandOnce.Do(func() {
+		timeoutCommandPath, _ = exec.LookPath("timeout")
+	})
+	if timeoutCommandPath == "" {
+		return command, false
+	}
+
+	shell := m.config.Session.Shell
+	if shell == "" {
+		shell = defaultShell()
+	}
+
+	args := []string{shellEscape(timeoutCommandPath)}
+	if grace := m.config.Session.TerminationGracePeriod; grace > 0 {
+		args = append(args, "--kill-after="+formatTimeoutDuration(grace))
+	}
+	args = append(args, formatTimeoutDuration(timeout), shellEscape(shell), "-c", shellEscape(command))
+
+	return strings.Join(args, " "), true
+}
+
+// formatTimeoutDuration formats a duration in the seconds syntax accepted by timeout(1)
+func formatTimeoutDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// BackgroundOptions configures a background process started by ExecuteCommandInBackgroundWithOptions
+type BackgroundOptions struct {
+	// Restart restarts the process according to the policy when it exits non-zero; nil never
+	// restarts
+	Restart *RestartPolicy
+
+	// Tags label the process's history record, along with those detected from the command (see
+	// CommandTags)
+	Tags []string
+
+	// PTY attaches the process to a pseudo-terminal; its stdout and stderr are then merged into
+	// Output. When no pseudo-terminal can be allocated the process runs without one and its
+	// PTYError says why.
+	PTY bool
+}
+
 // ExecuteCommandInBackground executes a command in background mode with proper process tracking
 func (m *Manager) ExecuteCommandInBackground(sessionID, command string) (string, error) {
+	return m.ExecuteCommandInBackgroundWithOptions(sessionID, command, BackgroundOptions{})
+}
+
+// ExecuteCommandInBackgroundWithOptions starts a background process configured by opts and returns
+// its ID
+func (m *Manager) ExecuteCommandInBackgroundWithOptions(sessionID, command string, opts BackgroundOptions) (string, error) {
+	// Generate unique process ID
+	processID := uuid.New().String()
+
+	// Create background process tracking
+	bgProcess := &BackgroundProcess{
+		ID:         processID,
+		Command:    command,
+		StartTime:  time.Now(),
+		IsRunning:  true,
+		Tags:       CommandTags(command, opts.Tags),
+		usePTY:     opts.PTY,
+		done:       make(chan struct{}),
+		dedupLines: m.config.Session.DedupBackgroundOutput,
+	}
+	if opts.Restart != nil {
+		policyCopy := *opts.Restart
+		bgProcess.restartPolicy = &policyCopy
+	}
+
+	if err := m.startBackgroundProcess(sessionID, bgProcess); err != nil {
+		return "", err
+	}
+
+	// Return immediately for background execution with process ID
+	return processID, nil
+}
+
+// startBackgroundProcess stores bgProcess in the session under its ID and runs its command in
+// the background, restarting it according to its policy
+func (m *Manager) startBackgroundProcess(sessionID string, bgProcess *BackgroundProcess) error {
 	session, err := m.GetSession(sessionID)
 	if err != nil {
-		return "", fmt.Errorf("session not found: %v", err)
+		return fmt.Errorf("session not found: %v", err)
 	}
+	processID := bgProcess.ID
+	command := bgProcess.Command
 
 	// Check if session context is cancelled before starting
 	select {
 	case <-session.ctx.Done():
-		return "", fmt.Errorf("session is shutting down: %v", session.ctx.Err())
+		return fmt.Errorf("session is shutting down: %v", session.ctx.Err())
 	default:
 		// Continue with background process creation
 	}
@@ -2022,29 +3056,19 @@ func (m *Manager) ExecuteCommandInBackground(sessionID, command string) (string,
 		// Check again after cleanup
 		if len(session.BackgroundProcesses) >= m.config.Session.MaxBackgroundProcesses {
 			session.mutex.Unlock()
-			return "", fmt.Errorf("maximum number of background processes (%d) reached for session %s", m.config.Session.MaxBackgroundProcesses, sessionID)
+			return fmt.Errorf("maximum number of background processes (%d) reached for session %s", m.config.Session.MaxBackgroundProcesses, sessionID)
 		}
 	}
-	session.mutex.Unlock()
-
-	// Generate unique process ID
-	processID := uuid.New().String()
-
-	// Create background process tracking
-	bgProcess := &BackgroundProcess{
-		ID:        processID,
-		Command:   command,
-		StartTime: time.Now(),
-		IsRunning: true,
-	}
 
 	// Store background process in session immediately
-	session.mutex.Lock()
 	session.BackgroundProcesses[processID] = bgProcess
 	session.mutex.Unlock()
 
 	// Start the command in the background with proper process tracking
 	go func() {
+		// Every exit path leaves IsRunning false, so waiters see the final state
+		defer close(bgProcess.done)
+
 		// Check context again at start of goroutine
 		select {
 		case <-session.ctx.Done():
@@ -2058,188 +3082,338 @@ func (m *Manager) ExecuteCommandInBackground(sessionID, command string) (string,
 			// Continue with command execution
 		}
 
-		// H1: Use configurable timeout from config instead of hardcoded 24 hours
-		bgTimeout := m.config.Session.BackgroundProcessTimeout
-		if bgTimeout <= 0 {
-			bgTimeout = 4 * time.Hour // Fallback to 4 hours if not configured
-		}
-		ctx, cancel := context.WithTimeout(session.ctx, bgTimeout)
-		defer cancel()
+		for {
+			startTime, exitStatus, execErr, started := m.runBackgroundAttempt(session, bgProcess, processID, command)
+			if !started {
+				return
+			}
+			exitCode := exitStatus.ExitCode
 
-		startTime := time.Now()
+			endTime := time.Now()
+			duration := endTime.Sub(startTime)
 
-		// Prepare command for execution
-		parts := strings.Fields(command)
-		if len(parts) == 0 {
-			m.logger.Error("Empty command provided", nil)
+			// Update background process status
 			bgProcess.Mutex.Lock()
 			bgProcess.IsRunning = false
-			bgProcess.ExitCode = -1
-			bgProcess.ErrorOutput = "Empty command provided"
+			bgProcess.ExitCode = exitCode
+			bgProcess.ExitStatus = &exitStatus
 			bgProcess.Mutex.Unlock()
-			return
-		}
 
-		// Create the command with proper working directory and environment
-		cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
-		cmd.Dir = session.currentDir
+			// Store the command result in history
+			success := execErr == nil && exitCode == 0
+
+			bgProcess.Mutex.RLock()
+			finalOutput := bgProcess.Output
+			bgProcess.Mutex.RUnlock()
+			workingDir := session.GetWorkingDir()
+			m.notifyCommandCompletion(session, command, finalOutput, exitCode, success, duration, workingDir, true)
+
+			// Store in database (check if database is still available)
+			if m.database != nil {
+				// Check database health before using it
+				if dbHealthErr := m.database.HealthCheck(); dbHealthErr == nil {
+					if storeErr := m.database.StoreCommandWithTags(
+						sessionID,
+						session.ProjectID,
+						command,
+						bgProcess.Output,
+						exitCode,
+						success,
+						startTime,
+						endTime,
+						duration,
+						workingDir,
+						bgProcess.Tags,
+					); storeErr != nil {
+						m.logger.Error("Failed to store background command", storeErr)
+					}
+				} else {
+					m.logger.Debug("Database not available for storing background command", map[string]interface{}{
+						"session_id": sessionID,
+						"error":      dbHealthErr.Error(),
+					})
+				}
+			}
 
-		// Set environment variables
-		cmd.Env = make([]string, 0, len(session.Environment))
-		for key, value := range session.Environment {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
-		}
+			m.logger.Info("Background command completed", map[string]interface{}{
+				"session_id": sessionID,
+				"process_id": processID,
+				"command":    command,
+				"success":    success,
+				"duration":   duration.String(),
+			})
 
-		// M6: Apply resource limits if enabled
-		if m.config.Session.EnableResourceLimits {
-			limits := ResourceLimits{
-				MaxMemoryMB:   m.config.Session.MaxProcessMemoryMB,
-				MaxFileSizeMB: m.config.Session.MaxProcessFilesMB,
-				Nice:          m.config.Session.ProcessNice,
-				Enabled:       true,
-			}
-			if err := applyResourceLimits(cmd, limits); err != nil {
-				m.logger.Warn("Failed to apply resource limits (continuing anyway)", map[string]interface{}{
-					"error":      err.Error(),
-					"process_id": processID,
-				})
+			if !m.restartBackgroundProcess(session, bgProcess, exitCode, duration) {
+				return
 			}
 		}
+	}()
 
-		// Create pipes for output capture with proper cleanup
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			m.logger.Error("Failed to create stdout pipe", err)
-			bgProcess.Mutex.Lock()
-			bgProcess.IsRunning = false
-			bgProcess.ExitCode = -1
-			bgProcess.ErrorOutput = fmt.Sprintf("Failed to create stdout pipe: %v", err)
-			bgProcess.Mutex.Unlock()
-			return
-		}
-		defer func() {
-			if stdout != nil {
-				stdout.Close()
-			}
-		}()
+	return nil
+}
 
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			m.logger.Error("Failed to create stderr pipe", err)
-			bgProcess.Mutex.Lock()
-			bgProcess.IsRunning = false
-			bgProcess.ExitCode = -1
-			bgProcess.ErrorOutput = fmt.Sprintf("Failed to create stderr pipe: %v", err)
-			bgProcess.Mutex.Unlock()
-			return
+// restartBackgroundProcess decides whether a background process that just exited should be
+// restarted under its policy. When it should, the restart is recorded and the backoff is
+// waited out before returning true; termination or session shutdown during the wait cancels it.
+func (m *Manager) restartBackgroundProcess(session *Session, bgProcess *BackgroundProcess, exitCode int, uptime time.Duration) bool {
+	bgProcess.Mutex.Lock()
+	policy := bgProcess.restartPolicy
+	if policy == nil || exitCode == 0 || bgProcess.stopRequested || session.ctx.Err() != nil ||
+		bgProcess.RestartCount >= policy.MaxRestarts ||
+		(policy.MinUptime > 0 && uptime >= policy.MinUptime) {
+		bgProcess.Mutex.Unlock()
+		return false
+	}
+	bgProcess.RestartCount++
+	attempt := bgProcess.RestartCount
+	bgProcess.Mutex.Unlock()
+
+	m.logger.Warn("Background process crashed, scheduling restart", map[string]interface{}{
+		"process_id":   bgProcess.ID,
+		"exit_code":    exitCode,
+		"uptime":       uptime.String(),
+		"attempt":      attempt,
+		"max_restarts": policy.MaxRestarts,
+		"backoff":      policy.Backoff.String(),
+	})
+
+	select {
+	case <-session.ctx.Done():
+		return false
+	case <-time.After(policy.Backoff):
+	}
+
+	bgProcess.Mutex.Lock()
+	defer bgProcess.Mutex.Unlock()
+	if bgProcess.stopRequested {
+		return false
+	}
+
+	bgProcess.Restarts = append(bgProcess.Restarts, RestartRecord{
+		Attempt:     attempt,
+		ExitCode:    exitCode,
+		Uptime:      uptime.Round(time.Millisecond).String(),
+		RestartedAt: time.Now(),
+	})
+	bgProcess.IsRunning = true
+	bgProcess.ExitCode = 0
+	bgProcess.ExitStatus = nil
+	return true
+}
+
+// runBackgroundAttempt starts command once for bgProcess and blocks until it exits and its
+// output has been captured, returning how it ended. ok is false when the process could not be
+// started at all.
+func (m *Manager) runBackgroundAttempt(session *Session, bgProcess *BackgroundProcess, processID, command string) (startTime time.Time, exitStatus ExitStatus, execErr error, ok bool) {
+	// H1: Use configurable timeout from config instead of hardcoded 24 hours
+	bgTimeout := m.config.Session.BackgroundProcessTimeout
+	if bgTimeout <= 0 {
+		bgTimeout = 4 * time.Hour // Fallback to 4 hours if not configured
+	}
+	ctx, cancel := context.WithTimeout(session.ctx, bgTimeout)
+	defer cancel()
+
+	startTime = time.Now()
+
+	// Prepare command for execution
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		m.logger.Error("Empty command provided", nil)
+		bgProcess.Mutex.Lock()
+		bgProcess.IsRunning = false
+		bgProcess.ExitCode = -1
+		bgProcess.ErrorOutput = "Empty command provided"
+		bgProcess.Mutex.Unlock()
+		return startTime, ExitStatus{}, nil, false
+	}
+
+	// Create the command with proper working directory and environment
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Dir = session.currentDir
+
+	// Set environment variables
+	cmd.Env = make([]string, 0, len(session.Environment))
+	for key, value := range session.Environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// A relaunched process keeps the directory and environment it originally ran with
+	if bgProcess.workingDir != "" {
+		cmd.Dir = bgProcess.workingDir
+	}
+	if bgProcess.env != nil {
+		cmd.Env = append([]string(nil), bgProcess.env...)
+	}
+
+	// Run in its own process group so termination signals never reach the server. A process
+	// attached to a pseudo-terminal leads a new session, and with it its own process group.
+	var term *pseudoTerminal
+	if bgProcess.usePTY {
+		var ptyErr error
+		if term, ptyErr = openPseudoTerminal(); ptyErr != nil {
+			m.logger.Warn("Running background process without the requested pseudo-terminal", map[string]interface{}{
+				"process_id": processID,
+				"error":      ptyErr.Error(),
+			})
+		} else {
+			defer term.close()
 		}
-		defer func() {
-			if stderr != nil {
-				stderr.Close()
-			}
-		}()
+		bgProcess.Mutex.Lock()
+		bgProcess.PTY = term != nil
+		bgProcess.PTYError = ""
+		if ptyErr != nil {
+			bgProcess.PTYError = ptyErr.Error()
+		}
+		bgProcess.Mutex.Unlock()
+	}
+	if term != nil {
+		term.attach(cmd)
+	} else {
+		setProcessGroup(cmd)
+	}
 
-		// Update background process with cmd reference
+	if err := m.applyRunAsUser(cmd); err != nil {
+		m.logger.Error("Failed to apply run_as_user", err)
 		bgProcess.Mutex.Lock()
-		bgProcess.cmd = cmd
+		bgProcess.IsRunning = false
+		bgProcess.ExitCode = -1
+		bgProcess.ErrorOutput = err.Error()
 		bgProcess.Mutex.Unlock()
+		return startTime, ExitStatus{}, nil, false
+	}
 
-		// Start the command
-		if err := cmd.Start(); err != nil {
-			m.logger.Error("Failed to start background command", err)
-			bgProcess.Mutex.Lock()
-			bgProcess.IsRunning = false
-			bgProcess.ExitCode = -1
-			bgProcess.ErrorOutput = fmt.Sprintf("Failed to start command: %v", err)
-			bgProcess.Mutex.Unlock()
-			return
+	// M6: Apply resource limits if enabled
+	if m.config.Session.EnableResourceLimits {
+		limits := ResourceLimits{
+			MaxMemoryMB:   m.config.Session.MaxProcessMemoryMB,
+			MaxFileSizeMB: m.config.Session.MaxProcessFilesMB,
+			Nice:          m.config.Session.ProcessNice,
+			Enabled:       true,
+		}
+		if err := applyResourceLimits(cmd, limits); err != nil {
+			m.logger.Warn("Failed to apply resource limits (continuing anyway)", map[string]interface{}{
+				"error":      err.Error(),
+				"process_id": processID,
+			})
 		}
+	}
 
-		// Update PID
+	// Create pipes for output capture with proper cleanup. The pseudo-terminal carries both
+	// streams, so it is read as stdout and there is no stderr to capture.
+	var stdout, stderr io.ReadCloser
+	var err error
+	if term != nil {
+		stdout = term.ptmx
+	} else if stdout, err = cmd.StdoutPipe(); err != nil {
+		m.logger.Error("Failed to create stdout pipe", err)
 		bgProcess.Mutex.Lock()
-		bgProcess.PID = cmd.Process.Pid
-		bgProcess.cmd = cmd
+		bgProcess.IsRunning = false
+		bgProcess.ExitCode = -1
+		bgProcess.ErrorOutput = fmt.Sprintf("Failed to create stdout pipe: %v", err)
 		bgProcess.Mutex.Unlock()
+		return startTime, ExitStatus{}, nil, false
+	}
+	defer func() {
+		if stdout != nil {
+			stdout.Close()
+		}
+	}()
 
-		// M6: Apply runtime resource limits (like nice value) after process starts
-		if m.config.Session.EnableResourceLimits && cmd.Process.Pid > 0 {
-			limits := ResourceLimits{
-				MaxMemoryMB:   m.config.Session.MaxProcessMemoryMB,
-				MaxFileSizeMB: m.config.Session.MaxProcessFilesMB,
-				Nice:          m.config.Session.ProcessNice,
-				Enabled:       true,
-			}
-			if err := setResourceLimits(cmd.Process.Pid, limits); err != nil {
-				m.logger.Warn("Failed to apply runtime resource limits", map[string]interface{}{
-					"error":      err.Error(),
-					"process_id": processID,
-					"pid":        cmd.Process.Pid,
-				})
-			} else {
-				m.logger.Debug("Applied resource limits to background process", map[string]interface{}{
-					"process_id":    processID,
-					"pid":           cmd.Process.Pid,
-					"nice":          limits.Nice,
-					"max_memory_mb": limits.MaxMemoryMB,
-					"max_file_mb":   limits.MaxFileSizeMB,
-				})
-			}
+	if term == nil {
+		stderr, err = cmd.StderrPipe()
+	}
+	if err != nil {
+		m.logger.Error("Failed to create stderr pipe", err)
+		bgProcess.Mutex.Lock()
+		bgProcess.IsRunning = false
+		bgProcess.ExitCode = -1
+		bgProcess.ErrorOutput = fmt.Sprintf("Failed to create stderr pipe: %v", err)
+		bgProcess.Mutex.Unlock()
+		return startTime, ExitStatus{}, nil, false
+	}
+	defer func() {
+		if stderr != nil {
+			stderr.Close()
 		}
+	}()
 
-		// Use WaitGroup to wait for output capture goroutines with timeout protection
-		var outputWg sync.WaitGroup
-		outputWg.Add(2)
+	// Update background process with cmd reference and start it under the lock, so a
+	// termination request either sees the new process or prevents it from starting
+	bgProcess.Mutex.Lock()
+	if bgProcess.stopRequested {
+		bgProcess.IsRunning = false
+		bgProcess.Mutex.Unlock()
+		return startTime, ExitStatus{}, nil, false
+	}
+	bgProcess.cmd = cmd
 
-		// C2 FIX: Use buffered channels and proper synchronization to prevent race conditions
-		// Create done channel to signal all goroutines to stop
-		done := make(chan struct{})
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		bgProcess.IsRunning = false
+		bgProcess.ExitCode = -1
+		bgProcess.ErrorOutput = fmt.Sprintf("Failed to start command: %v", err)
+		bgProcess.Mutex.Unlock()
+		m.logger.Error("Failed to start background command", err)
+		return startTime, ExitStatus{}, nil, false
+	}
 
-		// Stdout capture goroutine with proper synchronization
-		go func() {
-			defer outputWg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					m.logger.Error("Panic in stdout capture goroutine", fmt.Errorf("panic: %v", r))
-				}
-			}()
+	// Update PID
+	bgProcess.PID = cmd.Process.Pid
+	bgProcess.Mutex.Unlock()
+	if term != nil {
+		term.started()
+	}
 
-			scanner := bufio.NewScanner(stdout)
-			scanner.Split(bufio.ScanLines)
-
-			// C2 FIX: Use buffered channel to prevent blocking
-			lineChan := make(chan string, 100)
-
-			// Scanner goroutine
-			go func() {
-				defer close(lineChan)
-				for scanner.Scan() {
-					select {
-					case lineChan <- scanner.Text():
-					case <-done:
-						return
-					case <-ctx.Done():
-						return
-					}
-				}
-			}()
+	// M6: Apply runtime resource limits (like nice value) after process starts
+	if m.config.Session.EnableResourceLimits && cmd.Process.Pid > 0 {
+		limits := ResourceLimits{
+			MaxMemoryMB:   m.config.Session.MaxProcessMemoryMB,
+			MaxFileSizeMB: m.config.Session.MaxProcessFilesMB,
+			Nice:          m.config.Session.ProcessNice,
+			Enabled:       true,
+		}
+		if err := setResourceLimits(cmd.Process.Pid, limits); err != nil {
+			m.logger.Warn("Failed to apply runtime resource limits", map[string]interface{}{
+				"error":      err.Error(),
+				"process_id": processID,
+				"pid":        cmd.Process.Pid,
+			})
+		} else {
+			m.logger.Debug("Applied resource limits to background process", map[string]interface{}{
+				"process_id":    processID,
+				"pid":           cmd.Process.Pid,
+				"nice":          limits.Nice,
+				"max_memory_mb": limits.MaxMemoryMB,
+				"max_file_mb":   limits.MaxFileSizeMB,
+			})
+		}
+	}
 
-			// C2 FIX: Drain channel properly until closed or done
-			for {
-				select {
-				case line, ok := <-lineChan:
-					if !ok {
-						return // Channel closed, scanner finished
-					}
-					bgProcess.UpdateOutput(line+"\n", m.config.Session.BackgroundOutputLimit)
-				case <-done:
-					return
-				case <-ctx.Done():
-					return
-				}
+	// Use WaitGroup to wait for output capture goroutines with timeout protection
+	var outputWg sync.WaitGroup
+	outputWg.Add(1)
+
+	// C2 FIX: Use buffered channels and proper synchronization to prevent race conditions
+	// Create done channel to signal all goroutines to stop
+	done := make(chan struct{})
+
+	// Stdout capture goroutine with proper synchronization
+	go func() {
+		defer outputWg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				m.logger.Error("Panic in stdout capture goroutine", fmt.Errorf("panic: %v", r))
 			}
 		}()
 
-		// Stderr capture goroutine with proper synchronization
+		m.captureBackgroundOutput(ctx, done, stdout, func(text string) {
+			bgProcess.UpdateOutput(text, m.config.Session.BackgroundOutputLimit)
+		})
+	}()
+
+	// Stderr capture goroutine with proper synchronization
+	if stderr != nil {
+		outputWg.Add(1)
 		go func() {
 			defer outputWg.Done()
 			defer func() {
@@ -2248,124 +3422,47 @@ func (m *Manager) ExecuteCommandInBackground(sessionID, command string) (string,
 				}
 			}()
 
-			scanner := bufio.NewScanner(stderr)
-			scanner.Split(bufio.ScanLines)
-
-			// C2 FIX: Use buffered channel to prevent blocking
-			lineChan := make(chan string, 100)
-
-			// Scanner goroutine
-			go func() {
-				defer close(lineChan)
-				for scanner.Scan() {
-					select {
-					case lineChan <- scanner.Text():
-					case <-done:
-						return
-					case <-ctx.Done():
-						return
-					}
-				}
-			}()
-
-			// C2 FIX: Drain channel properly until closed or done
-			for {
-				select {
-				case line, ok := <-lineChan:
-					if !ok {
-						return // Channel closed, scanner finished
-					}
-					bgProcess.UpdateErrorOutput(line+"\n", m.config.Session.BackgroundOutputLimit)
-				case <-done:
-					return
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
-
-		// Wait for command completion with timeout protection
-		execErr := cmd.Wait()
-
-		// C2 FIX: Signal done to all goroutines after command completes
-		close(done)
-
-		// Wait for output capture goroutines to complete with timeout
-		outputDone := make(chan struct{})
-		go func() {
-			outputWg.Wait()
-			close(outputDone)
-		}()
-
-		select {
-		case <-outputDone:
-			// Output capture completed normally
-		case <-time.After(30 * time.Second):
-			// Force timeout for output capture
-			m.logger.Warn("Output capture timeout, forcing completion", map[string]interface{}{
-				"process_id": processID,
-				"command":    command,
+			m.captureBackgroundOutput(ctx, done, stderr, func(text string) {
+				bgProcess.UpdateErrorOutput(text, m.config.Session.BackgroundOutputLimit)
 			})
-		}
-
-		endTime := time.Now()
-		duration := endTime.Sub(startTime)
-		exitCode := 0
+		}()
+	}
 
-		if execErr != nil {
-			if exitError, ok := execErr.(*exec.ExitError); ok {
-				exitCode = exitError.ExitCode()
-			} else {
-				exitCode = -1
-			}
-		}
+	// Wait for command completion with timeout protection
+	execErr = cmd.Wait()
 
-		// Update background process status
-		bgProcess.Mutex.Lock()
-		bgProcess.IsRunning = false
-		bgProcess.ExitCode = exitCode
-		bgProcess.Mutex.Unlock()
+	// C2 FIX: Signal done to all goroutines after command completes
+	close(done)
 
-		// Store the command result in history
-		success := execErr == nil && exitCode == 0
-
-		// Store in database (check if database is still available)
-		if m.database != nil {
-			// Check database health before using it
-			if dbHealthErr := m.database.HealthCheck(); dbHealthErr == nil {
-				if storeErr := m.database.StoreCommand(
-					sessionID,
-					session.ProjectID,
-					command,
-					bgProcess.Output,
-					exitCode,
-					success,
-					startTime,
-					endTime,
-					duration,
-					session.WorkingDir,
-				); storeErr != nil {
-					m.logger.Error("Failed to store background command", storeErr)
-				}
-			} else {
-				m.logger.Debug("Database not available for storing background command", map[string]interface{}{
-					"session_id": sessionID,
-					"error":      dbHealthErr.Error(),
-				})
-			}
-		}
+	// Wait for output capture goroutines to complete with timeout
+	outputDone := make(chan struct{})
+	go func() {
+		outputWg.Wait()
+		close(outputDone)
+	}()
 
-		m.logger.Info("Background command completed", map[string]interface{}{
-			"session_id": sessionID,
+	select {
+	case <-outputDone:
+		// Output capture completed normally
+	case <-time.After(30 * time.Second):
+		// Force timeout for output capture
+		m.logger.Warn("Output capture timeout, forcing completion", map[string]interface{}{
 			"process_id": processID,
 			"command":    command,
-			"success":    success,
-			"duration":   duration.String(),
 		})
-	}()
+	}
 
-	// Return immediately for background execution with process ID
-	return processID, nil
+	// The context kills the process when the session closes, which counts as a signal the
+	// server sent, or when background_process_timeout elapses
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded) && session.ctx.Err() == nil
+	if session.ctx.Err() != nil {
+		bgProcess.noteSignalSent(syscall.SIGKILL)
+	}
+	bgProcess.Mutex.RLock()
+	signalSent := bgProcess.signalSent
+	bgProcess.Mutex.RUnlock()
+
+	return startTime, classifyExit(execErr, timedOut, signalSent), execErr, true
 }
 
 // GetBackgroundProcess returns a background process by ID
@@ -2402,6 +3499,77 @@ func (m *Manager) GetBackgroundProcess(sessionID, processID string) (*Background
 	return proc, nil
 }
 
+// WaitForBackgroundReady waits until a background process's output matches the readiness
+// pattern (a regular expression), as WaitForOutputPatternWithContext does. It returns false
+// without error if the timeout elapses first, and an error if the pattern is invalid or the
+// process exits before becoming ready.
+func (m *Manager) WaitForBackgroundReady(ctx context.Context, sessionID, processID, pattern string, timeout time.Duration) (bool, error) {
+	match, err := m.WaitForOutputPatternWithContext(ctx, sessionID, processID, pattern, timeout)
+	if err != nil {
+		return false, err
+	}
+	return match.Matched, nil
+}
+
+// BackgroundProcessWait is the outcome of WaitForBackgroundProcess
+type BackgroundProcessWait struct {
+	Exited      bool          // False when the process was still running when the wait ended
+	ExitCode    int           // Final exit code; only meaningful when Exited
+	Output      string        // Output captured so far
+	ErrorOutput string        // Error output captured so far
+	Waited      time.Duration // How long the call blocked
+}
+
+// WaitForBackgroundProcess blocks until a background process has exited for good, meaning it
+// will not be restarted, or until timeout elapses. A timeout is not an error: the result then
+// reports Exited false with the output captured so far.
+func (m *Manager) WaitForBackgroundProcess(sessionID, processID string, timeout time.Duration) (*BackgroundProcessWait, error) {
+	return m.WaitForBackgroundProcessWithContext(context.Background(), sessionID, processID, timeout)
+}
+
+// WaitForBackgroundProcessWithContext is WaitForBackgroundProcess, returning ctx's error if ctx
+// is cancelled first
+func (m *Manager) WaitForBackgroundProcessWithContext(ctx context.Context, sessionID, processID string, timeout time.Duration) (*BackgroundProcessWait, error) {
+	bgProcess, err := m.GetBackgroundProcess(sessionID, processID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if bgProcess.done != nil {
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+		select {
+		case <-bgProcess.done:
+		case <-deadline.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	bgProcess.Mutex.RLock()
+	defer bgProcess.Mutex.RUnlock()
+
+	wait := &BackgroundProcessWait{
+		Exited:      !bgProcess.IsRunning,
+		Output:      bgProcess.Output,
+		ErrorOutput: bgProcess.ErrorOutput,
+		Waited:      time.Since(start),
+	}
+	if bgProcess.done != nil {
+		select {
+		case <-bgProcess.done:
+		default:
+			wait.Exited = false // Between a crash and its scheduled restart
+		}
+	}
+	if wait.Exited {
+		wait.ExitCode = bgProcess.ExitCode
+	}
+	return wait, nil
+}
+
 // GetAllBackgroundProcesses returns all background processes across all sessions with optional filtering
 func (m *Manager) GetAllBackgroundProcesses(sessionID, projectID string) (map[string]map[string]*BackgroundProcess, error) {
 	m.mutex.RLock()
@@ -2436,9 +3604,52 @@ func (m *Manager) GetAllBackgroundProcesses(sessionID, projectID string) (map[st
 
 // GracefulTerminationConfig holds configuration for graceful process termination
 type GracefulTerminationConfig struct {
-	GracePeriod     time.Duration // Time to wait after SIGTERM before SIGKILL
-	UseProcessGroup bool          // Kill entire process group
-	LogProgress     bool          // Log termination progress
+	GracePeriod     time.Duration     // Time to wait after SIGTERM before SIGKILL
+	UseProcessGroup bool              // Kill entire process group
+	LogProgress     bool              // Log termination progress
+	Steps           []TerminationStep // Ordered signal escalation; empty means SIGTERM -> GracePeriod -> SIGKILL
+	KillTimeout     time.Duration     // Time to wait for the process to be reaped after SIGKILL before reporting it stuck
+}
+
+// TerminationStep is one step of a signal escalation sequence
+type TerminationStep struct {
+	Signal      syscall.Signal
+	GracePeriod time.Duration // Time to wait for the process to exit after sending Signal
+}
+
+// terminationSignals maps accepted signal names to signals
+var terminationSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// ParseTerminationSteps builds an escalation sequence from signal names (e.g. "SIGINT", "TERM"),
+// waiting gracePeriod after each signal
+func ParseTerminationSteps(names []string, gracePeriod time.Duration) ([]TerminationStep, error) {
+	steps := make([]TerminationStep, 0, len(names))
+	for _, name := range names {
+		sig, err := ParseSignal(name)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, TerminationStep{Signal: sig, GracePeriod: gracePeriod})
+	}
+	return steps, nil
+}
+
+// escalationSteps returns the configured steps, always ending with SIGKILL
+func (c GracefulTerminationConfig) escalationSteps() []TerminationStep {
+	steps := c.Steps
+	if len(steps) == 0 {
+		steps = []TerminationStep{{Signal: syscall.SIGTERM, GracePeriod: c.GracePeriod}}
+	}
+	if steps[len(steps)-1].Signal != syscall.SIGKILL {
+		steps = append(steps[:len(steps):len(steps)], TerminationStep{Signal: syscall.SIGKILL})
+	}
+	return steps
 }
 
 // DefaultGracefulTerminationConfig returns default graceful termination settings
@@ -2447,6 +3658,7 @@ func DefaultGracefulTerminationConfig() GracefulTerminationConfig {
 		GracePeriod:     5 * time.Second,
 		UseProcessGroup: true,
 		LogProgress:     true,
+		KillTimeout:     defaultKillTimeout,
 	}
 }
 
@@ -2470,9 +3682,13 @@ func (m *Manager) TerminateBackgroundProcessWithConfig(sessionID, processID stri
 		return fmt.Errorf("background process %s not found in session %s", processID, sessionID)
 	}
 
-	// Get process info while holding the lock
+	// Get process info while holding the lock, and make sure it is never restarted
+	bgProcess.Mutex.Lock()
+	bgProcess.stopRequested = true
 	isRunning := bgProcess.IsRunning
 	cmd := bgProcess.cmd
+	command := bgProcess.Command
+	bgProcess.Mutex.Unlock()
 	pid := 0
 	if cmd != nil && cmd.Process != nil {
 		pid = cmd.Process.Pid
@@ -2480,7 +3696,9 @@ func (m *Manager) TerminateBackgroundProcessWithConfig(sessionID, processID stri
 	session.mutex.Unlock()
 
 	// Terminate the process if it's running
+	var terminateErr error
 	if isRunning && cmd != nil && cmd.Process != nil {
+		exitedGracefully := false
 		if force {
 			// Force kill immediately
 			if config.LogProgress {
@@ -2491,86 +3709,65 @@ func (m *Manager) TerminateBackgroundProcessWithConfig(sessionID, processID stri
 				})
 			}
 
-			if config.UseProcessGroup {
-				// Try to kill the entire process group
-				pgid, err := syscall.Getpgid(pid)
-				if err == nil {
-					syscall.Kill(-pgid, syscall.SIGKILL)
-				} else {
-					cmd.Process.Kill()
-				}
-			} else {
+			bgProcess.noteSignalSent(syscall.SIGKILL)
+			if err := m.signalProcess(cmd, pid, syscall.SIGKILL, config.UseProcessGroup); err != nil {
 				cmd.Process.Kill()
 			}
 		} else {
-			// M7: Graceful termination: SIGTERM -> wait -> SIGKILL
-			if config.LogProgress {
-				m.logger.Info("Sending SIGTERM for graceful shutdown", map[string]interface{}{
-					"session_id":   sessionID,
-					"process_id":   processID,
-					"pid":          pid,
-					"grace_period": config.GracePeriod.String(),
-				})
-			}
-
-			// Send SIGTERM first
-			var termErr error
-			if config.UseProcessGroup {
-				pgid, err := syscall.Getpgid(pid)
-				if err == nil {
-					termErr = syscall.Kill(-pgid, syscall.SIGTERM)
-				} else {
-					termErr = cmd.Process.Signal(syscall.SIGTERM)
-				}
-			} else {
-				termErr = cmd.Process.Signal(syscall.SIGTERM)
-			}
-
-			if termErr != nil {
-				// If SIGTERM fails, go straight to kill
+			// M7: Graceful termination: escalate through the configured signals
+			// (default SIGTERM -> wait -> SIGKILL) until the process exits
+			for _, step := range config.escalationSteps() {
 				if config.LogProgress {
-					m.logger.Warn("SIGTERM failed, force killing", map[string]interface{}{
-						"session_id": sessionID,
-						"process_id": processID,
-						"error":      termErr.Error(),
+					m.logger.Info("Sending termination signal", map[string]interface{}{
+						"session_id":   sessionID,
+						"process_id":   processID,
+						"pid":          pid,
+						"signal":       step.Signal.String(),
+						"grace_period": step.GracePeriod.String(),
 					})
 				}
-				cmd.Process.Kill()
-			} else {
-				// Wait for grace period, checking if process exited
-				exited := m.waitForProcessExit(cmd, config.GracePeriod)
 
-				if !exited {
-					// Process didn't exit gracefully, send SIGKILL
+				bgProcess.noteSignalSent(step.Signal)
+				if sigErr := m.signalProcess(cmd, pid, step.Signal, config.UseProcessGroup); sigErr != nil {
+					// If signalling fails, go straight to kill
 					if config.LogProgress {
-						m.logger.Info("Grace period expired, sending SIGKILL", map[string]interface{}{
-							"session_id":   sessionID,
-							"process_id":   processID,
-							"pid":          pid,
-							"grace_period": config.GracePeriod.String(),
+						m.logger.Warn("Signal failed, force killing", map[string]interface{}{
+							"session_id": sessionID,
+							"process_id": processID,
+							"signal":     step.Signal.String(),
+							"error":      sigErr.Error(),
 						})
 					}
+					bgProcess.noteSignalSent(syscall.SIGKILL)
+					cmd.Process.Kill()
+					break
+				}
 
-					if config.UseProcessGroup {
-						pgid, err := syscall.Getpgid(pid)
-						if err == nil {
-							syscall.Kill(-pgid, syscall.SIGKILL)
-						} else {
-							cmd.Process.Kill()
-						}
-					} else {
-						cmd.Process.Kill()
+				if step.Signal == syscall.SIGKILL {
+					break
+				}
+
+				if m.waitForProcessExit(pid, step.GracePeriod) {
+					exitedGracefully = true
+					if config.LogProgress {
+						m.logger.Info("Process exited gracefully", map[string]interface{}{
+							"session_id": sessionID,
+							"process_id": processID,
+							"pid":        pid,
+							"signal":     step.Signal.String(),
+						})
 					}
-				} else if config.LogProgress {
-					m.logger.Info("Process exited gracefully after SIGTERM", map[string]interface{}{
-						"session_id": sessionID,
-						"process_id": processID,
-						"pid":        pid,
-					})
+					break
 				}
 			}
 		}
 
+		// SIGKILL cannot interrupt a process in uninterruptible sleep, so confirm it was reaped
+		// rather than assuming it died; a stuck process is handed to the resource cleanup routine
+		if !exitedGracefully {
+			terminateErr = m.confirmKilled(sessionID, processID, command, pid, config.KillTimeout)
+		}
+
 		// Update process status
 		bgProcess.Mutex.Lock()
 		bgProcess.IsRunning = false
@@ -2582,23 +3779,143 @@ func (m *Manager) TerminateBackgroundProcessWithConfig(sessionID, processID stri
 	delete(session.BackgroundProcesses, processID)
 	session.mutex.Unlock()
 
-	return nil
+	return terminateErr
 }
 
-// waitForProcessExit waits for a process to exit with a timeout
-func (m *Manager) waitForProcessExit(cmd *exec.Cmd, timeout time.Duration) bool {
-	done := make(chan struct{})
+// DetachBackgroundProcess removes a background process from the session's active list without
+// stopping it. The process is never restarted and is no longer terminated with the session.
+func (m *Manager) DetachBackgroundProcess(sessionID, processID string) (*BackgroundProcess, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %v", err)
+	}
 
-	go func() {
-		cmd.Wait()
-		close(done)
-	}()
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 
-	select {
-	case <-done:
-		return true
-	case <-time.After(timeout):
-		return false
+	bgProcess, exists := session.BackgroundProcesses[processID]
+	if !exists {
+		return nil, fmt.Errorf("background process %s not found in session %s", processID, sessionID)
+	}
+
+	bgProcess.Mutex.Lock()
+	bgProcess.stopRequested = true
+	bgProcess.Mutex.Unlock()
+	delete(session.BackgroundProcesses, processID)
+
+	return bgProcess, nil
+}
+
+// restartStartTimeout bounds how long RestartBackgroundProcess waits for the relaunched PID
+const restartStartTimeout = 5 * time.Second
+
+// BackgroundProcessRestart is the outcome of RestartBackgroundProcess
+type BackgroundProcessRestart struct {
+	ProcessID string
+	Command   string
+	OldPID    int // 0 if the old process was not running
+	NewPID    int
+	StartTime time.Time
+}
+
+// RestartBackgroundProcess terminates a background process, gracefully unless force is set, and
+// relaunches its command under the same process ID, in the directory and with the environment it
+// ran with. Start time, output and exit code start afresh; tags, PTY use and any auto-restart
+// policy carry over. Nothing is relaunched if the old process could not be terminated.
+func (m *Manager) RestartBackgroundProcess(sessionID, processID string, force bool) (*BackgroundProcessRestart, error) {
+	return m.relaunchBackgroundProcess(sessionID, processID, force, "")
+}
+
+// relaunchBackgroundProcess implements RestartBackgroundProcess; a non-empty workingDir relaunches
+// the command there instead of in the directory it ran in
+func (m *Manager) relaunchBackgroundProcess(sessionID, processID string, force bool, workingDir string) (*BackgroundProcessRestart, error) {
+	old, err := m.GetBackgroundProcess(sessionID, processID)
+	if err != nil {
+		return nil, err
+	}
+
+	old.Mutex.RLock()
+	restart := &BackgroundProcessRestart{ProcessID: old.ID, Command: old.Command}
+	if old.IsRunning {
+		restart.OldPID = old.PID
+	}
+	replacement := &BackgroundProcess{
+		ID:         old.ID,
+		Command:    old.Command,
+		IsRunning:  true,
+		Tags:       append([]string(nil), old.Tags...),
+		usePTY:     old.usePTY,
+		done:       make(chan struct{}),
+		dedupLines: old.dedupLines,
+		workingDir: old.workingDir,
+		env:        old.env,
+	}
+	if old.cmd != nil {
+		replacement.workingDir = old.cmd.Dir
+		replacement.env = append([]string(nil), old.cmd.Env...)
+	}
+	if workingDir != "" {
+		replacement.workingDir = workingDir
+	}
+	if old.restartPolicy != nil {
+		policyCopy := *old.restartPolicy
+		replacement.restartPolicy = &policyCopy
+	}
+	old.Mutex.RUnlock()
+
+	if err := m.TerminateBackgroundProcessWithConfig(sessionID, restart.ProcessID, force, DefaultGracefulTerminationConfig()); err != nil {
+		return nil, fmt.Errorf("failed to stop process for restart: %w", err)
+	}
+
+	replacement.StartTime = time.Now()
+	restart.StartTime = replacement.StartTime
+	if err := m.startBackgroundProcess(sessionID, replacement); err != nil {
+		return nil, fmt.Errorf("process stopped but could not be relaunched: %w", err)
+	}
+
+	// The command starts asynchronously; wait for its PID so the caller gets both
+	deadline := time.Now().Add(restartStartTimeout)
+	for {
+		replacement.Mutex.RLock()
+		pid, running, errorOutput := replacement.PID, replacement.IsRunning, replacement.ErrorOutput
+		replacement.Mutex.RUnlock()
+
+		if pid != 0 {
+			restart.NewPID = pid
+			break
+		}
+		if !running {
+			return restart, fmt.Errorf("relaunched process failed to start: %s", errorOutput)
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.logger.Info("Background process restarted", map[string]interface{}{
+		"session_id": sessionID,
+		"process_id": restart.ProcessID,
+		"old_pid":    restart.OldPID,
+		"new_pid":    restart.NewPID,
+		"force":      force,
+	})
+
+	return restart, nil
+}
+
+// waitForProcessExit waits for a process to exit with a timeout. The process is reaped by
+// the goroutine that started it, so exit is detected by polling rather than calling Wait again.
+func (m *Manager) waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := signalPID(pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
 }
 
@@ -0,0 +1,70 @@
+package terminal
+
+import "maps"
+
+// cloneNameSuffix is appended to the source's name when a clone is not given a name
+const cloneNameSuffix = "-copy"
+
+// CloneSession creates a session set up like sourceID: the same project, working directory,
+// current directory, environment, shell options, aliases and security policy, with a fresh ID
+// and shell. Background processes and command history are not copied. An empty newName names the
+// clone after the source with a "-copy" suffix. If the source's current directory is no longer
+// usable the clone stays in the working directory.
+func (m *Manager) CloneSession(sourceID, newName string) (*Session, error) {
+	source, err := m.GetSession(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	source.mutex.RLock()
+	name, projectID, workingDir, currentDir := source.Name, source.ProjectID, source.WorkingDir, source.currentDir
+	policy := source.SecurityPolicy.clone()
+	environment := maps.Clone(source.Environment)
+	shellEnv := maps.Clone(source.shellEnv)
+	shellOptions := maps.Clone(source.shellOptions)
+	source.mutex.RUnlock()
+
+	source.aliasMu.RLock()
+	aliases := maps.Clone(source.aliases)
+	source.aliasMu.RUnlock()
+
+	if newName == "" {
+		newName = name + cloneNameSuffix
+	}
+	clone, err := m.CreateSessionWithPolicy(newName, projectID, workingDir, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.mutex.Lock()
+	if environment != nil {
+		clone.Environment = environment
+	}
+	if shellEnv != nil {
+		clone.shellEnv = shellEnv
+	}
+	clone.shellOptions = shellOptions
+	clone.mutex.Unlock()
+
+	clone.aliasMu.Lock()
+	clone.aliases = aliases
+	clone.aliasMu.Unlock()
+
+	if currentDir != workingDir {
+		if err := m.SetSessionCurrentDir(clone.ID, currentDir); err != nil {
+			m.logger.Warn("Cloned session stays in its working directory", map[string]interface{}{
+				"session_id":  clone.ID,
+				"current_dir": currentDir,
+				"error":       err.Error(),
+			})
+		}
+	}
+
+	m.logger.Info("Session cloned", map[string]interface{}{
+		"source_session_id": sourceID,
+		"session_id":        clone.ID,
+		"variables":         len(environment),
+	})
+
+	return clone, nil
+}
@@ -0,0 +1,54 @@
+package terminal
+
+import (
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// Session lifecycle events, logged and, when database.session_events is enabled, persisted
+const (
+	SessionEventCreated   = "created"
+	SessionEventClosed    = "closed"     // Closed on request, for a project deletion, or at shutdown
+	SessionEventCleanedUp = "cleaned_up" // Closed automatically by a cleanup routine
+	SessionEventRelocated = "relocated"  // Moved to a new working directory
+)
+
+// Reasons recorded with closed and cleaned up events
+const (
+	CloseReasonRequested      = "requested"
+	CloseReasonProjectDeleted = "project_deleted"
+	CloseReasonShutdown       = "server_shutdown"
+	CloseReasonInactive       = "inactive_timeout"
+	CloseReasonMaxSessions    = "max_sessions_exceeded"
+)
+
+// recordSessionEvent logs a session lifecycle event and persists it to the session_events table
+// when enabled. Persisting is best effort: a failure is logged and never fails the operation.
+func (m *Manager) recordSessionEvent(event, reason, sessionID, sessionName, projectID string, details map[string]interface{}) {
+	fields := map[string]interface{}{"project_id": projectID}
+	if reason != "" {
+		fields["reason"] = reason
+	}
+	for key, value := range details {
+		fields[key] = value
+	}
+	m.logger.LogSessionEvent(event, sessionID, sessionName, fields)
+
+	if m.database == nil || !m.config.Database.SessionEvents {
+		return
+	}
+	record := &database.SessionEventRecord{
+		SessionID:   sessionID,
+		SessionName: sessionName,
+		ProjectID:   projectID,
+		Event:       event,
+		Reason:      reason,
+		Details:     details,
+	}
+	if err := m.database.RecordSessionEvent(record, m.config.Database.SessionEventRetention); err != nil {
+		m.logger.Warn("Failed to record session event", map[string]interface{}{
+			"session_id": sessionID,
+			"event":      event,
+			"error":      err.Error(),
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package terminal
+
+import (
+	"fmt"
+	"time"
+)
+
+// SessionHealth describes whether a session's persistent shell is alive and usable
+type SessionHealth struct {
+	SessionID     string    `json:"session_id"`
+	ShellPID      int       `json:"shell_pid"`
+	ShellAlive    bool      `json:"shell_alive"`
+	PipesOpen     bool      `json:"pipes_open"`
+	ContextActive bool      `json:"context_active"` // False once the session has been closed
+	Healthy       bool      `json:"healthy"`
+	Issues        []string  `json:"issues,omitempty"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// CheckSessionHealth verifies that the session's shell process is alive and its pipes are open
+func (m *Manager) CheckSessionHealth(sessionID string) (*SessionHealth, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return session.health(), nil
+}
+
+// RestartSessionShell replaces the session's persistent shell with a fresh one in the session's
+// current directory and returns the resulting health
+func (m *Manager) RestartSessionShell(sessionID string) (*SessionHealth, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.ctx.Err() != nil {
+		return nil, fmt.Errorf("session %s is closed", sessionID)
+	}
+
+	oldPid := session.shellPid
+	m.stopSessionShell(session)
+
+	workingDir := session.currentDir
+	if workingDir == "" {
+		workingDir = session.WorkingDir
+	}
+	if err := m.startSessionShell(session, workingDir); err != nil {
+		return nil, fmt.Errorf("failed to restart shell: %w", err)
+	}
+
+	m.logger.Info("Restarted session shell", map[string]interface{}{
+		"session_id": sessionID,
+		"old_pid":    oldPid,
+		"new_pid":    session.shellPid,
+	})
+
+	return session.health(), nil
+}
+
+// health checks the persistent shell; the caller must hold the session mutex
+func (s *Session) health() *SessionHealth {
+	health := &SessionHealth{
+		SessionID:     s.ID,
+		ShellPID:      s.shellPid,
+		ShellAlive:    processAlive(s.shellPid),
+		PipesOpen:     s.pipesOpen(),
+		ContextActive: s.ctx != nil && s.ctx.Err() == nil,
+		CheckedAt:     time.Now(),
+	}
+
+	if !health.ShellAlive {
+		health.Issues = append(health.Issues, fmt.Sprintf("shell process %d is not running", s.shellPid))
+	}
+	if !health.PipesOpen {
+		health.Issues = append(health.Issues, "shell pipes are closed")
+	}
+	if !health.ContextActive {
+		health.Issues = append(health.Issues, "session has been closed")
+	}
+	health.Healthy = len(health.Issues) == 0
+
+	return health
+}
+
+// pipesOpen reports whether the shell's stdin, stdout and stderr pipes are still open. Zero-length
+// reads and writes fail on closed pipes without blocking or consuming data.
+func (s *Session) pipesOpen() bool {
+	if s.stdin == nil || s.stdout == nil || s.stderr == nil {
+		return false
+	}
+	if _, err := s.stdin.Write(nil); err != nil {
+		return false
+	}
+	if _, err := s.stdout.Read(nil); err != nil {
+		return false
+	}
+	if _, err := s.stderr.Read(nil); err != nil {
+		return false
+	}
+	return true
+}
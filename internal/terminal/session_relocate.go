@@ -0,0 +1,183 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rama-kairi/go-term/internal/config"
+)
+
+// SessionRelocation is the outcome of RelocateSession
+type SessionRelocation struct {
+	SessionID     string
+	OldWorkingDir string
+	NewWorkingDir string
+	OldCurrentDir string
+	NewCurrentDir string
+	Restarted     []ProcessRelocation // Background processes relaunched in the new location
+	NotMoved      []ProcessRelocation // Running background processes left where they were, with the reason
+}
+
+// ProcessRelocation describes one running background process during a relocation
+type ProcessRelocation struct {
+	ProcessID     string
+	Command       string
+	OldWorkingDir string
+	NewWorkingDir string // Empty when the process was not moved
+	OldPID        int
+	NewPID        int
+	Reason        string // Why the process was not moved
+}
+
+// RelocateSession points a session at a new working directory, for when the project it works in
+// has moved. The current directory keeps its place relative to the working directory if that
+// path exists under the new one, and falls back to the new working directory otherwise. The
+// environment, aliases, history and other session state are kept.
+//
+// With restartBackground, running background processes that ran inside the old working directory
+// are restarted in the matching directory under the new one, gracefully unless force is set;
+// processes that ran elsewhere, or whose directory does not exist in the new location, keep
+// running and are reported in NotMoved. Without it every running process is reported there.
+func (m *Manager) RelocateSession(sessionID, newWorkingDir string, restartBackground, force bool) (*SessionRelocation, error) {
+	session, err := m.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	newRoot, err := filepath.Abs(newWorkingDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid working directory %s: %w", newWorkingDir, err)
+	}
+	info, err := os.Stat(newRoot)
+	if err != nil {
+		return nil, fmt.Errorf("directory %s is not accessible: %w", newRoot, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", newRoot)
+	}
+	if !m.config.Security.IsWorkingDirAllowed(newRoot) {
+		return nil, fmt.Errorf("directory %s is not within the allowed working directories", newRoot)
+	}
+
+	session.mutex.Lock()
+	relocation := &SessionRelocation{
+		SessionID:     sessionID,
+		OldWorkingDir: session.WorkingDir,
+		NewWorkingDir: newRoot,
+		OldCurrentDir: session.currentDir,
+		NewCurrentDir: newRoot,
+		Restarted:     []ProcessRelocation{},
+		NotMoved:      []ProcessRelocation{},
+	}
+	if dir, ok := rebaseDir(session.currentDir, session.WorkingDir, newRoot); ok && isDir(dir) {
+		relocation.NewCurrentDir = dir
+	}
+	session.WorkingDir = newRoot
+	session.currentDir = relocation.NewCurrentDir
+	if dir, ok := rebaseDir(session.previousDir, relocation.OldWorkingDir, newRoot); ok {
+		if !isDir(dir) {
+			dir = ""
+		}
+		session.previousDir = dir
+	}
+
+	processes := make([]ProcessRelocation, 0, len(session.BackgroundProcesses))
+	for _, process := range session.BackgroundProcesses {
+		process.Mutex.RLock()
+		if process.IsRunning {
+			dir := process.workingDir
+			if process.cmd != nil {
+				dir = process.cmd.Dir
+			}
+			processes = append(processes, ProcessRelocation{
+				ProcessID:     process.ID,
+				Command:       process.Command,
+				OldWorkingDir: dir,
+				OldPID:        process.PID,
+			})
+		}
+		process.Mutex.RUnlock()
+	}
+	session.mutex.Unlock()
+
+	sort.Slice(processes, func(i, j int) bool { return processes[i].ProcessID < processes[j].ProcessID })
+	for _, process := range processes {
+		if !restartBackground {
+			process.Reason = "restart_background was not requested"
+			relocation.NotMoved = append(relocation.NotMoved, process)
+			continue
+		}
+		dir, ok := rebaseDir(process.OldWorkingDir, relocation.OldWorkingDir, newRoot)
+		if !ok {
+			process.Reason = "runs outside the session's working directory"
+			relocation.NotMoved = append(relocation.NotMoved, process)
+			continue
+		}
+		if !isDir(dir) {
+			process.Reason = fmt.Sprintf("directory %s does not exist", dir)
+			relocation.NotMoved = append(relocation.NotMoved, process)
+			continue
+		}
+
+		restart, err := m.relaunchBackgroundProcess(sessionID, process.ProcessID, force, dir)
+		if err != nil {
+			process.Reason = err.Error()
+			relocation.NotMoved = append(relocation.NotMoved, process)
+			continue
+		}
+		process.NewWorkingDir = dir
+		process.NewPID = restart.NewPID
+		relocation.Restarted = append(relocation.Restarted, process)
+	}
+
+	m.persistWorkingDir(sessionID, newRoot)
+	m.recordSessionEvent(SessionEventRelocated, "", sessionID, session.Name, session.ProjectID, map[string]interface{}{
+		"old_working_dir": relocation.OldWorkingDir,
+		"new_working_dir": newRoot,
+		"restarted":       len(relocation.Restarted),
+		"not_moved":       len(relocation.NotMoved),
+	})
+
+	return relocation, nil
+}
+
+// persistWorkingDir stores a session's new working directory; like other history writes it is
+// best effort
+func (m *Manager) persistWorkingDir(sessionID, workingDir string) {
+	if m.database == nil {
+		return
+	}
+	record, err := m.database.GetSession(sessionID)
+	if err == nil {
+		record.WorkingDir = workingDir
+		err = m.database.UpdateSession(record)
+	}
+	if err != nil {
+		m.logger.Warn("Failed to store relocated working directory", map[string]interface{}{
+			"session_id": sessionID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// rebaseDir maps dir, when it is oldRoot or inside it, to the same place under newRoot
+func rebaseDir(dir, oldRoot, newRoot string) (string, bool) {
+	if dir == "" || oldRoot == "" || !config.IsWithinDir(dir, oldRoot) {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Clean(oldRoot), filepath.Clean(dir))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// The paths only matched once symlinks were resolved; keep the new root itself
+		return newRoot, true
+	}
+	return filepath.Join(newRoot, rel), true
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -1,10 +1,18 @@
 package terminal
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -133,6 +141,35 @@ func TestBackgroundProcess(t *testing.T) {
 			t.Errorf("Expected error output to be limited, got %d", len(bp.ErrorOutput))
 		}
 	})
+	t.Run("DedupOutput", func(t *testing.T) {
+		bp := &BackgroundProcess{ID: "dedup-test", Command: "test"}
+
+		// Raw mode is the default
+		bp.UpdateOutput("retrying\n", 0)
+		bp.UpdateOutput("retrying\n", 0)
+		if bp.Output != "retrying\nretrying\n" {
+			t.Errorf("Expected raw output by default, got %q", bp.Output)
+		}
+
+		bp = &BackgroundProcess{ID: "dedup-test2", Command: "test"}
+		bp.SetDedup(true)
+		for i := 0; i < 3; i++ {
+			bp.UpdateOutput("connection refused, retrying\n", 0)
+		}
+		bp.UpdateOutput("connected\n", 0)
+		bp.UpdateOutput("connected\n", 0)
+
+		expected := "connection refused, retrying (x3)\nconnected (x2)\n"
+		if bp.Output != expected {
+			t.Errorf("Expected output %q, got %q", expected, bp.Output)
+		}
+
+		bp.UpdateErrorOutput("warn\n", 0)
+		bp.UpdateErrorOutput("warn\n", 0)
+		if bp.ErrorOutput != "warn (x2)\n" {
+			t.Errorf("Expected deduplicated error output, got %q", bp.ErrorOutput)
+		}
+	})
 }
 
 // setupTestSession creates a test session for testing
@@ -197,6 +234,93 @@ func setupTestSession(t *testing.T) (*Session, *Manager, func()) {
 }
 
 // TestSession tests basic session functionality
+func TestUniqueSessionNames(t *testing.T) {
+	_, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	create := func(name, projectID string) string {
+		t.Helper()
+		session, err := manager.CreateSession(name, projectID, "/tmp")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		return session.Name
+	}
+
+	// Duplicates are allowed by default
+	if name := create("test-session", "test_project"); name != "test-session" {
+		t.Errorf("Expected a duplicate name by default, got %q", name)
+	}
+
+	manager.config.Session.UniqueNames = true
+	for _, want := range []string{"test-session-2", "test-session-3"} {
+		if name := create("test-session", "test_project"); name != want {
+			t.Errorf("Expected %q, got %q", want, name)
+		}
+	}
+	if name := create("test-session", "other_project"); name != "test-session" {
+		t.Errorf("Expected names to be unique only within a project, got %q", name)
+	}
+}
+
+func TestReadOutputSince(t *testing.T) {
+	t.Run("Incremental", func(t *testing.T) {
+		bp := &BackgroundProcess{ID: "cursor-test"}
+		bp.UpdateOutput("hello\n", 0)
+		chunk, err := bp.ReadOutputSince(OutputStreamStdout, 0)
+		if err != nil || chunk.Data != "hello\n" || chunk.NextOffset != 6 || chunk.Gap {
+			t.Fatalf("Unexpected first chunk %+v (%v)", chunk, err)
+		}
+
+		bp.UpdateOutput("world\n", 0)
+		bp.UpdateErrorOutput("oops\n", 0)
+		if chunk, _ = bp.ReadOutputSince(OutputStreamStdout, chunk.NextOffset); chunk.Data != "world\n" || chunk.NextOffset != 12 {
+			t.Errorf("Expected only the new output, got %+v", chunk)
+		}
+		if chunk, _ = bp.ReadOutputSince(OutputStreamStderr, 0); chunk.Data != "oops\n" || chunk.NextOffset != 5 {
+			t.Errorf("Expected error output to have its own offsets, got %+v", chunk)
+		}
+		if _, err := bp.ReadOutputSince(OutputStreamStdout, 13); err == nil {
+			t.Error("Expected an offset past the end to be rejected")
+		}
+		if _, err := bp.ReadOutputSince(OutputStreamStdout, -1); err == nil {
+			t.Error("Expected a negative offset to be rejected")
+		}
+	})
+
+	t.Run("GapAfterTruncation", func(t *testing.T) {
+		bp := &BackgroundProcess{ID: "cursor-limit"}
+		for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+			bp.UpdateOutput(line, 10)
+		}
+		chunk, err := bp.ReadOutputSince(OutputStreamStdout, 0)
+		if err != nil || !chunk.Gap || chunk.GapBytes != 8 || chunk.Offset != 8 || chunk.Data != "b\ncccc\n" || chunk.NextOffset != 15 {
+			t.Errorf("Expected a gap before the retained output, got %+v (%v)", chunk, err)
+		}
+		if chunk, _ = bp.ReadOutputSince(OutputStreamStdout, 12); chunk.Gap || chunk.Data != "cc\n" {
+			t.Errorf("Expected a retained offset to read without a gap, got %+v", chunk)
+		}
+
+		// Offsets stay valid after cleanup trims the buffer
+		bp.TruncateOutput(6)
+		bp.UpdateOutput("dd\n", 10)
+		if chunk, _ = bp.ReadOutputSince(OutputStreamStdout, 15); chunk.Data != "dd\n" || chunk.NextOffset != 18 {
+			t.Errorf("Expected only output written after the trim, got %+v", chunk)
+		}
+		if chunk, _ = bp.ReadOutputSince(OutputStreamStdout, 0); chunk.GapBytes != 12 || chunk.Data != "cc\ndd\n" {
+			t.Errorf("Expected the gap to grow with the trim, got %+v", chunk)
+		}
+	})
+
+	t.Run("DedupUnavailable", func(t *testing.T) {
+		bp := &BackgroundProcess{ID: "cursor-dedup", dedupLines: true}
+		bp.UpdateOutput("same\n", 0)
+		if _, err := bp.ReadOutputSince(OutputStreamStdout, 0); !errors.Is(err, ErrOutputCursorUnavailable) {
+			t.Errorf("Expected ErrOutputCursorUnavailable, got %v", err)
+		}
+	})
+}
+
 func TestSession(t *testing.T) {
 	session, manager, cleanup := setupTestSession(t)
 	defer cleanup()
@@ -517,6 +641,149 @@ func TestCommandExecution(t *testing.T) {
 			t.Error("Expected session to still be active after multiple commands")
 		}
 	})
+	t.Run("PerCommandEnvOverrides", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		env := map[string]string{"GO_TERM_TEST_VAR": "it's a value"}
+
+		output, err := manager.ExecuteCommandWithOptions(session.ID, "echo \"$GO_TERM_TEST_VAR\"", ExecOptions{Timeout: 5 * time.Second, Env: env})
+		if err != nil {
+			t.Fatalf("Failed to execute command with env: %v", err)
+		}
+		if !strings.Contains(output.Combined, "it's a value") {
+			t.Errorf("Expected output to contain override value, got: %s", output.Combined)
+		}
+
+		streamed, err := manager.ExecuteCommandWithStreamingAndEnv(session.ID, "echo \"$GO_TERM_TEST_VAR\"", env)
+		if err != nil {
+			t.Fatalf("Failed to execute streaming command with env: %v", err)
+		}
+		if !strings.Contains(streamed, "it's a value") {
+			t.Errorf("Expected streaming output to contain override value, got: %s", streamed)
+		}
+
+		// Session environment must be unchanged
+		if _, exists := session.GetEnvironment("GO_TERM_TEST_VAR"); exists {
+			t.Error("Expected per-command env override not to persist in session")
+		}
+	})
+
+	t.Run("ShellOptions", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		// Without pipefail the pipeline succeeds because the last command succeeds
+		if _, err := manager.ExecuteCommand(session.ID, "false | true"); err != nil {
+			t.Fatalf("Expected pipeline to succeed without pipefail: %v", err)
+		}
+
+		enabled, err := manager.SetSessionShellOptions(session.ID, map[string]bool{"pipefail": true, "errexit": true})
+		if err != nil {
+			t.Fatalf("Failed to set shell options: %v", err)
+		}
+		if strings.Join(enabled, ",") != "errexit,pipefail" {
+			t.Errorf("Expected errexit,pipefail enabled, got %v", enabled)
+		}
+
+		if _, err := manager.ExecuteCommand(session.ID, "false | true"); err == nil {
+			t.Error("Expected pipeline to fail with pipefail enabled")
+		}
+
+		enabled, err = manager.SetSessionShellOptions(session.ID, map[string]bool{"pipefail": false})
+		if err != nil {
+			t.Fatalf("Failed to disable shell option: %v", err)
+		}
+		if strings.Join(enabled, ",") != "errexit" {
+			t.Errorf("Expected only errexit enabled, got %v", enabled)
+		}
+
+		if _, err := manager.SetSessionShellOptions(session.ID, map[string]bool{"monitor": true}); err == nil {
+			t.Error("Expected error for unknown shell option")
+		}
+	})
+
+	t.Run("TimeoutCommandWrapper", func(t *testing.T) {
+		if _, err := exec.LookPath("timeout"); err != nil {
+			t.Skip("timeout utility not installed")
+		}
+
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		manager.config.Session.UseTimeoutCommand = true
+		manager.config.Session.TerminationGracePeriod = time.Second
+
+		output, err := manager.ExecuteCommandWithTimeout(session.ID, "echo 'wrapped ok'", 5*time.Second)
+		if err != nil {
+			t.Fatalf("Failed to execute wrapped command: %v", err)
+		}
+		if !strings.Contains(output, "wrapped ok") {
+			t.Errorf("Expected wrapped command output, got: %s", output)
+		}
+
+		start := time.Now()
+		_, err = manager.ExecuteCommandWithTimeout(session.ID, "sleep 10", time.Second)
+		if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected timeout error, got: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 4*time.Second {
+			t.Errorf("Expected timeout to trigger after about 1s, took %s", elapsed)
+		}
+	})
+
+	t.Run("MeasureCommandTimings", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		before := session.CommandCount
+		samples, err := manager.MeasureCommandTimings(context.Background(), session.ID, NoOpCommand, 3)
+		if err != nil {
+			t.Fatalf("Failed to measure no-op timings: %v", err)
+		}
+		if len(samples) != 3 {
+			t.Fatalf("Expected 3 samples, got %d", len(samples))
+		}
+		if session.CommandCount != before {
+			t.Errorf("Expected measurement runs not to count as commands, count went %d -> %d", before, session.CommandCount)
+		}
+
+		if _, err := manager.MeasureCommandTimings(context.Background(), session.ID, "exit 3", 2); err == nil {
+			t.Error("Expected failing command to return an error")
+		}
+
+		// The persistent shell locks the session itself, so measuring must not hold it
+		manager.config.Session.PersistentShell = true
+		defer func() { manager.config.Session.PersistentShell = false }()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if samples, err := manager.MeasureCommandTimings(ctx, session.ID, NoOpCommand, 2); err != nil || len(samples) != 2 {
+			t.Errorf("Expected 2 persistent shell samples, got %d (%v)", len(samples), err)
+		}
+	})
+}
+
+// TestSummarizeDurations tests timing statistics and nearest-rank percentiles
+func TestSummarizeDurations(t *testing.T) {
+	samples := make([]time.Duration, 0, 100)
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := SummarizeDurations(samples)
+	if stats.Samples != 100 || stats.Min != time.Millisecond || stats.Max != 100*time.Millisecond {
+		t.Errorf("Unexpected samples/min/max: %+v", stats)
+	}
+	if stats.Mean != 50500*time.Microsecond {
+		t.Errorf("Expected mean 50.5ms, got %s", stats.Mean)
+	}
+	if stats.P50 != 50*time.Millisecond || stats.P90 != 90*time.Millisecond || stats.P99 != 99*time.Millisecond {
+		t.Errorf("Unexpected percentiles: p50=%s p90=%s p99=%s", stats.P50, stats.P90, stats.P99)
+	}
+
+	if empty := SummarizeDurations(nil); empty.Samples != 0 {
+		t.Errorf("Expected empty stats for no samples, got %+v", empty)
+	}
 }
 
 // TestNewManager tests manager creation
@@ -695,4 +962,2003 @@ func TestWorkingDirectoryDetection(t *testing.T) {
 		// Environment should have at least some basic variables
 		t.Logf("Session environment has %d variables", len(retrievedSession.Environment))
 	})
+
+	t.Run("WorkspaceSearchDepthAndBoundaries", func(t *testing.T) {
+		_, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		defer manager.Shutdown()
+
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write go.mod: %v", err)
+		}
+		deep := filepath.Join(root, "a", "b", "c")
+		if err := os.MkdirAll(deep, 0o755); err != nil {
+			t.Fatalf("Failed to create nested dirs: %v", err)
+		}
+
+		if found := manager.findWorkspaceRoot(deep); found != root {
+			t.Errorf("Expected default depth to find %s, got %q", root, found)
+		}
+
+		manager.config.Session.WorkspaceSearchDepth = 2
+		if found := manager.findWorkspaceRoot(deep); found != "" {
+			t.Errorf("Expected depth 2 to stop before the root, got %q", found)
+		}
+
+		manager.config.Session.WorkspaceSearchDepth = 10
+		manager.config.Session.WorkspaceBoundaries = []string{filepath.Join(root, "a") + "/"}
+		if found := manager.findWorkspaceRoot(deep); found != "" {
+			t.Errorf("Expected boundary to stop the search, got %q", found)
+		}
+	})
+}
+
+// TestTerminationEscalation tests configurable signal escalation for background processes
+func TestTerminationEscalation(t *testing.T) {
+	t.Run("ParseTerminationSteps", func(t *testing.T) {
+		steps, err := ParseTerminationSteps([]string{"SIGINT", "term", "KILL"}, time.Second)
+		if err != nil {
+			t.Fatalf("Failed to parse steps: %v", err)
+		}
+		expected := []syscall.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL}
+		if len(steps) != len(expected) {
+			t.Fatalf("Expected %d steps, got %d", len(expected), len(steps))
+		}
+		for i, sig := range expected {
+			if steps[i].Signal != sig || steps[i].GracePeriod != time.Second {
+				t.Errorf("Step %d: expected %v/1s, got %v/%s", i, sig, steps[i].Signal, steps[i].GracePeriod)
+			}
+		}
+
+		if _, err := ParseTerminationSteps([]string{"SIGUSR9"}, time.Second); err == nil {
+			t.Error("Expected error for unsupported signal")
+		}
+	})
+
+	t.Run("DefaultStepsEndWithKill", func(t *testing.T) {
+		config := DefaultGracefulTerminationConfig()
+		steps := config.escalationSteps()
+		if len(steps) != 2 || steps[0].Signal != syscall.SIGTERM || steps[1].Signal != syscall.SIGKILL {
+			t.Errorf("Expected default SIGTERM -> SIGKILL, got %+v", steps)
+		}
+
+		config.Steps = []TerminationStep{{Signal: syscall.SIGINT, GracePeriod: time.Second}}
+		steps = config.escalationSteps()
+		if len(steps) != 2 || steps[1].Signal != syscall.SIGKILL {
+			t.Errorf("Expected SIGKILL appended to custom steps, got %+v", steps)
+		}
+	})
+
+	t.Run("SIGINTStopsProcess", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.MaxBackgroundProcesses = 1
+
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sleep 30")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		config := DefaultGracefulTerminationConfig()
+		config.Steps = []TerminationStep{{Signal: syscall.SIGINT, GracePeriod: 3 * time.Second}}
+
+		start := time.Now()
+		if err := manager.TerminateBackgroundProcessWithConfig(session.ID, processID, false, config); err != nil {
+			t.Fatalf("Failed to terminate process: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= 3*time.Second {
+			t.Errorf("Expected SIGINT to stop the process before the grace period expired, took %s", elapsed)
+		}
+	})
+}
+
+// TestSessionEventRecording tests that lifecycle events are persisted only when enabled
+func TestSessionEventRecording(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	// The test config leaves recording disabled, so the first session left no event
+	events, err := manager.database.GetSessionEvents(database.SessionEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get session events: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("Expected no events while disabled, got %+v", events)
+	}
+
+	manager.config.Database.SessionEvents = true
+	manager.config.Database.SessionEventRetention = time.Hour
+
+	other, err := manager.CreateSession("other-session", "test_project", "/tmp")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.CloseSession(other.ID); err != nil {
+		t.Fatalf("Failed to close session: %v", err)
+	}
+
+	session.mutex.Lock()
+	session.LastUsedAt = time.Now().Add(-time.Hour)
+	session.mutex.Unlock()
+	manager.cleanupInactiveSessions()
+
+	events, err = manager.database.GetSessionEvents(database.SessionEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get session events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	cleaned, created := events[0], events[2]
+	if cleaned.SessionID != session.ID || cleaned.Event != SessionEventCleanedUp || cleaned.Reason != CloseReasonInactive {
+		t.Errorf("Expected the inactive session to be cleaned up, got %+v", cleaned)
+	}
+	if events[1].SessionID != other.ID || events[1].Event != SessionEventClosed || events[1].Reason != CloseReasonRequested {
+		t.Errorf("Expected the other session to be closed on request, got %+v", events[1])
+	}
+	if created.Event != SessionEventCreated || created.SessionName != "other-session" || created.ProjectID != "test_project" {
+		t.Errorf("Expected a created event for the other session, got %+v", created)
+	}
+	if created.Details["working_dir"] != "/tmp" {
+		t.Errorf("Expected the working directory in the details, got %+v", created.Details)
+	}
+}
+
+func TestStuckProcesses(t *testing.T) {
+	t.Run("ForceKillConfirmsExit", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.MaxBackgroundProcesses = 1
+
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sleep 30")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		if err := manager.TerminateBackgroundProcess(session.ID, processID, true); err != nil {
+			t.Fatalf("Expected a killed process to be reaped, got %v", err)
+		}
+		if stuck := manager.StuckProcesses(); len(stuck) != 0 {
+			t.Errorf("Expected no stuck processes, got %+v", stuck)
+		}
+	})
+
+	t.Run("CleanupRetriesAndReaps", func(t *testing.T) {
+		_, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		pid := cmd.Process.Pid
+
+		manager.stuck.byID = map[string]*StuckProcess{
+			"stuck": {PID: pid, ProcessID: "stuck", DetectedAt: time.Now(), KillAttempts: 1, startTime: processStartTime(pid)},
+		}
+
+		// The first pass finds the process still present and kills it again
+		if reaped := manager.ReapStuckProcesses(); reaped != 0 {
+			t.Fatalf("Expected the live process to stay recorded, reaped %d", reaped)
+		}
+		if stuck := manager.StuckProcesses(); len(stuck) != 1 || stuck[0].KillAttempts != 2 {
+			t.Fatalf("Expected a second kill attempt to be recorded, got %+v", stuck)
+		}
+
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the retried SIGKILL to stop the process")
+		}
+
+		if reaped := manager.ReapStuckProcesses(); reaped != 1 {
+			t.Errorf("Expected the exited process to be reaped, got %d", reaped)
+		}
+		if diag := manager.Diagnostics(); diag.StuckProcesses != 0 {
+			t.Errorf("Expected no stuck processes left, got %d", diag.StuckProcesses)
+		}
+	})
+
+	t.Run("ReusedPIDIsNotKilled", func(t *testing.T) {
+		_, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		if processStartTime(cmd.Process.Pid) == "" {
+			t.Skip("Process start time is not available on this system")
+		}
+
+		manager.stuck.byID = map[string]*StuckProcess{
+			"old": {PID: cmd.Process.Pid, ProcessID: "old", startTime: "another process"},
+		}
+		if reaped := manager.ReapStuckProcesses(); reaped != 1 {
+			t.Errorf("Expected a PID now belonging to another process to be forgotten, got %d", reaped)
+		}
+		if err := signalPID(cmd.Process.Pid, 0); err != nil {
+			t.Errorf("Expected the unrelated process to be left alone, got %v", err)
+		}
+	})
+
+	t.Run("ErrorReportsState", func(t *testing.T) {
+		err := error(&StuckProcessError{
+			Process: StuckProcess{PID: 42, State: "D", StateDescription: describeProcessState("D")},
+			Timeout: 5 * time.Second,
+		})
+		if !strings.Contains(err.Error(), "state D: uninterruptible sleep") {
+			t.Errorf("Expected the process state in the error, got %q", err.Error())
+		}
+		if describeProcessState("") != "" || describeProcessState("?") != "unknown" {
+			t.Error("Unexpected descriptions for missing or unknown states")
+		}
+	})
+}
+
+func TestWaitForBackgroundProcess(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	manager.config.Session.MaxBackgroundProcesses = 3
+
+	t.Run("ReturnsExitCodeAndOutput", func(t *testing.T) {
+		// Background commands are not run through a shell, so the script goes in a file
+		script := filepath.Join(t.TempDir(), "job.sh")
+		if err := os.WriteFile(script, []byte("sleep 0.2\necho finished\nsleep 0.2\nexit 3\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write script: %v", err)
+		}
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sh "+script)
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+
+		wait, err := manager.WaitForBackgroundProcess(session.ID, processID, 5*time.Second)
+		if err != nil {
+			t.Fatalf("WaitForBackgroundProcess failed: %v", err)
+		}
+		if !wait.Exited || wait.ExitCode != 3 || !strings.Contains(wait.Output, "finished") {
+			t.Errorf("Expected exit code 3 with final output, got %+v", wait)
+		}
+		if wait.Waited >= 5*time.Second {
+			t.Errorf("Expected the wait to end when the process exited, waited %s", wait.Waited)
+		}
+	})
+
+	t.Run("TimeoutIsNotAnError", func(t *testing.T) {
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sleep 30")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		defer manager.TerminateBackgroundProcess(session.ID, processID, true)
+
+		wait, err := manager.WaitForBackgroundProcess(session.ID, processID, 200*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected a timeout to return a result, got %v", err)
+		}
+		if wait.Exited {
+			t.Errorf("Expected the process to still be running, got %+v", wait)
+		}
+	})
+
+	t.Run("WaitsThroughRestarts", func(t *testing.T) {
+		processID, err := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "false", BackgroundOptions{Restart: &RestartPolicy{MaxRestarts: 2, Backoff: 50 * time.Millisecond}})
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		proc, _ := manager.GetBackgroundProcess(session.ID, processID)
+
+		wait, err := manager.WaitForBackgroundProcess(session.ID, processID, 5*time.Second)
+		if err != nil {
+			t.Fatalf("WaitForBackgroundProcess failed: %v", err)
+		}
+		proc.Mutex.RLock()
+		restarts := len(proc.Restarts)
+		proc.Mutex.RUnlock()
+		if !wait.Exited || wait.ExitCode != 1 || restarts != 2 {
+			t.Errorf("Expected the wait to end after both restarts with exit code 1, got %+v after %d restarts", wait, restarts)
+		}
+	})
+}
+
+func TestRestartBackgroundProcess(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	manager.config.Session.MaxBackgroundProcesses = 3
+
+	script := filepath.Join(t.TempDir(), "server.sh")
+	if err := os.WriteFile(script, []byte("echo marker=$MARKER\nsleep 30\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	t.Run("KeepsIDAndEnvironment", func(t *testing.T) {
+		session.SetEnvironment("MARKER", "first")
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sh "+script)
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		defer manager.TerminateBackgroundProcess(session.ID, processID, true)
+		if _, err := manager.WaitForOutputPattern(session.ID, processID, "marker=first", 5*time.Second); err != nil {
+			t.Fatalf("Process did not start: %v", err)
+		}
+		old, _ := manager.GetBackgroundProcess(session.ID, processID)
+
+		// The relaunch runs with the environment the process started with, not the session's new one
+		session.SetEnvironment("MARKER", "second")
+		restart, err := manager.RestartBackgroundProcess(session.ID, processID, false)
+		if err != nil {
+			t.Fatalf("RestartBackgroundProcess failed: %v", err)
+		}
+		if restart.ProcessID != processID || restart.OldPID != old.PID || restart.NewPID == 0 || restart.NewPID == restart.OldPID {
+			t.Fatalf("Expected the same ID with a new PID, got %+v", restart)
+		}
+
+		proc, err := manager.GetBackgroundProcess(session.ID, processID)
+		if err != nil {
+			t.Fatalf("Expected the process ID to stay tracked: %v", err)
+		}
+		if proc == old || !proc.StartTime.After(old.StartTime) {
+			t.Errorf("Expected a fresh process record with a later start time")
+		}
+		match, err := manager.WaitForOutputPattern(session.ID, processID, "marker=\\w+", 5*time.Second)
+		if err != nil || match.Match != "marker=first" {
+			t.Errorf("Expected the original environment, got %+v (%v)", match, err)
+		}
+		proc.Mutex.RLock()
+		output := proc.Output
+		proc.Mutex.RUnlock()
+		if strings.Count(output, "marker=") != 1 {
+			t.Errorf("Expected output to start afresh, got %q", output)
+		}
+	})
+
+	t.Run("RelaunchesExitedProcess", func(t *testing.T) {
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "echo done")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		if _, err := manager.WaitForBackgroundProcess(session.ID, processID, 5*time.Second); err != nil {
+			t.Fatalf("WaitForBackgroundProcess failed: %v", err)
+		}
+
+		restart, err := manager.RestartBackgroundProcess(session.ID, processID, true)
+		if err != nil {
+			t.Fatalf("RestartBackgroundProcess failed: %v", err)
+		}
+		if restart.OldPID != 0 || restart.NewPID == 0 {
+			t.Errorf("Expected no old PID and a new one, got %+v", restart)
+		}
+		manager.TerminateBackgroundProcess(session.ID, processID, true)
+	})
+
+	t.Run("UnknownProcess", func(t *testing.T) {
+		if _, err := manager.RestartBackgroundProcess(session.ID, "missing", false); err == nil {
+			t.Error("Expected an unknown process to be rejected")
+		}
+	})
+}
+
+func TestBackgroundProcessExitStatus(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	manager.config.Session.MaxBackgroundProcesses = 5
+
+	dir := t.TempDir()
+	run := func(t *testing.T, body string) *BackgroundProcess {
+		t.Helper()
+		script := filepath.Join(dir, t.Name()[strings.LastIndex(t.Name(), "/")+1:]+".sh")
+		if err := os.WriteFile(script, []byte(body), 0o644); err != nil {
+			t.Fatalf("Failed to write script: %v", err)
+		}
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sh "+script)
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		proc, err := manager.GetBackgroundProcess(session.ID, processID)
+		if err != nil {
+			t.Fatalf("Failed to get background process: %v", err)
+		}
+		return proc
+	}
+	exitStatus := func(t *testing.T, proc *BackgroundProcess) ExitStatus {
+		t.Helper()
+		select {
+		case <-proc.done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Process did not exit")
+		}
+		proc.Mutex.RLock()
+		defer proc.Mutex.RUnlock()
+		if proc.ExitStatus == nil {
+			t.Fatal("Expected an exit status")
+		}
+		return *proc.ExitStatus
+	}
+
+	t.Run("Exited", func(t *testing.T) {
+		status := exitStatus(t, run(t, "exit 0\n"))
+		if status != (ExitStatus{Reason: ExitReasonExited}) {
+			t.Errorf("Unexpected exit status %+v", status)
+		}
+	})
+
+	t.Run("NonZero", func(t *testing.T) {
+		status := exitStatus(t, run(t, "exit 3\n"))
+		if status != (ExitStatus{Reason: ExitReasonNonZero, ExitCode: 3}) {
+			t.Errorf("Unexpected exit status %+v", status)
+		}
+	})
+
+	t.Run("Signaled", func(t *testing.T) {
+		status := exitStatus(t, run(t, "kill -9 $$\n"))
+		if status.Reason != ExitReasonSignaled || status.Signal != "SIGKILL" || status.SignalSent != "" {
+			t.Errorf("Expected a kill the server did not send, got %+v", status)
+		}
+	})
+
+	t.Run("Terminated", func(t *testing.T) {
+		proc := run(t, "echo started\nsleep 30\n")
+		if _, err := manager.WaitForOutputPattern(session.ID, proc.ID, "started", 5*time.Second); err != nil {
+			t.Fatalf("Process did not start: %v", err)
+		}
+		if err := manager.TerminateBackgroundProcess(session.ID, proc.ID, true); err != nil {
+			t.Fatalf("TerminateBackgroundProcess failed: %v", err)
+		}
+		status := exitStatus(t, proc)
+		if status.Reason != ExitReasonTerminated || status.Signal != "SIGKILL" || status.SignalSent != "SIGKILL" {
+			t.Errorf("Expected termination by the server, got %+v", status)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		previous := manager.config.Session.BackgroundProcessTimeout
+		manager.config.Session.BackgroundProcessTimeout = 300 * time.Millisecond
+		defer func() { manager.config.Session.BackgroundProcessTimeout = previous }()
+		status := exitStatus(t, run(t, "sleep 30\n"))
+		if status.Reason != ExitReasonTimeout || status.ExitCode != 124 {
+			t.Errorf("Expected a timeout with exit code 124, got %+v", status)
+		}
+	})
+}
+
+func TestWaitForOutputPattern(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	manager.config.Session.MaxBackgroundProcesses = 3
+
+	t.Run("MatchesOutputBeforeTheWait", func(t *testing.T) {
+		script := filepath.Join(t.TempDir(), "server.sh")
+		if err := os.WriteFile(script, []byte("echo Listening on :3000\nsleep 30\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write script: %v", err)
+		}
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sh "+script)
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		defer manager.TerminateBackgroundProcess(session.ID, processID, true)
+
+		// Let the line be captured before anyone waits for it
+		time.Sleep(300 * time.Millisecond)
+
+		match, err := manager.WaitForOutputPattern(session.ID, processID, `Listening on :\d+`, 5*time.Second)
+		if err != nil {
+			t.Fatalf("WaitForOutputPattern failed: %v", err)
+		}
+		if !match.Matched || match.Match != "Listening on :3000" || match.Stream != OutputStreamStdout {
+			t.Errorf("Expected the earlier output to match, got %+v", match)
+		}
+	})
+
+	t.Run("TimeoutIsNotAnError", func(t *testing.T) {
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sleep 30")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		defer manager.TerminateBackgroundProcess(session.ID, processID, true)
+
+		match, err := manager.WaitForOutputPattern(session.ID, processID, "never printed", 200*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected a timeout to return a result, got %v", err)
+		}
+		if match.Matched {
+			t.Errorf("Expected no match, got %+v", match)
+		}
+	})
+
+	t.Run("ExitWithoutMatch", func(t *testing.T) {
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "echo done")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		if _, err := manager.WaitForOutputPattern(session.ID, processID, "never printed", 5*time.Second); err == nil {
+			t.Error("Expected an error when the process exits without a match")
+		}
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		if _, err := manager.WaitForOutputPattern(session.ID, "missing", "([", time.Second); err == nil {
+			t.Error("Expected an invalid pattern to be rejected")
+		}
+	})
+
+	t.Run("SeesOutputTrimmedByTheLimit", func(t *testing.T) {
+		bp := &BackgroundProcess{done: make(chan struct{})}
+		w := bp.watchOutput(regexp.MustCompile("ready"))
+
+		bp.UpdateOutput("server ready\n", 20)
+		bp.UpdateOutput(strings.Repeat("x", 100)+"\n", 20)
+		if strings.Contains(bp.Output, "ready") {
+			t.Fatalf("Expected the ready line to be trimmed, got %q", bp.Output)
+		}
+		select {
+		case <-w.matched:
+		default:
+			t.Fatal("Expected the watcher to have matched the trimmed line")
+		}
+		if len(bp.outputWatchers) != 0 {
+			t.Errorf("Expected the matched watcher to be removed, %d left", len(bp.outputWatchers))
+		}
+	})
+}
+
+func TestBackgroundRestartPolicy(t *testing.T) {
+	waitStopped := func(t *testing.T, proc *BackgroundProcess) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			proc.Mutex.RLock()
+			done := !proc.IsRunning && proc.RestartCount == len(proc.Restarts)
+			proc.Mutex.RUnlock()
+			if done {
+				// Give a pending restart decision time to happen
+				time.Sleep(100 * time.Millisecond)
+				proc.Mutex.RLock()
+				done = !proc.IsRunning && proc.RestartCount == len(proc.Restarts)
+				proc.Mutex.RUnlock()
+				if done {
+					return
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatal("Background process did not settle")
+	}
+
+	t.Run("RestartsUntilCap", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.MaxBackgroundProcesses = 1
+
+		processID, err := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "false", BackgroundOptions{Restart: &RestartPolicy{MaxRestarts: 2, Backoff: 10 * time.Millisecond}})
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		proc, _ := manager.GetBackgroundProcess(session.ID, processID)
+		waitStopped(t, proc)
+
+		proc.Mutex.RLock()
+		defer proc.Mutex.RUnlock()
+		if proc.RestartCount != 2 || len(proc.Restarts) != 2 || proc.ExitCode != 1 {
+			t.Errorf("Expected 2 restarts ending with exit code 1, got %d restarts (%d records), exit %d", proc.RestartCount, len(proc.Restarts), proc.ExitCode)
+		}
+		if proc.Restarts[0].Attempt != 1 || proc.Restarts[1].Attempt != 2 || proc.Restarts[0].ExitCode != 1 {
+			t.Errorf("Unexpected restart records: %+v", proc.Restarts)
+		}
+	})
+
+	t.Run("NoRestartAfterCleanExitOrMinUptime", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.MaxBackgroundProcesses = 2
+
+		clean, _ := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "true", BackgroundOptions{Restart: &RestartPolicy{MaxRestarts: 3}})
+		// Any real run outlasts a 1ns minimum uptime, so the failure is not restarted
+		late, _ := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "false", BackgroundOptions{Restart: &RestartPolicy{MaxRestarts: 3, MinUptime: time.Nanosecond}})
+
+		for _, processID := range []string{clean, late} {
+			proc, err := manager.GetBackgroundProcess(session.ID, processID)
+			if err != nil {
+				t.Fatalf("Background process missing: %v", err)
+			}
+			waitStopped(t, proc)
+			proc.Mutex.RLock()
+			if proc.RestartCount != 0 {
+				t.Errorf("Expected no restarts for %s, got %d", proc.Command, proc.RestartCount)
+			}
+			proc.Mutex.RUnlock()
+		}
+	})
+
+	t.Run("TerminationStopsRestarts", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.MaxBackgroundProcesses = 1
+
+		processID, _ := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "sleep 30", BackgroundOptions{Restart: &RestartPolicy{MaxRestarts: 3, Backoff: 10 * time.Millisecond}})
+		proc, _ := manager.GetBackgroundProcess(session.ID, processID)
+		time.Sleep(100 * time.Millisecond)
+
+		if err := manager.TerminateBackgroundProcess(session.ID, processID, true); err != nil {
+			t.Fatalf("Failed to terminate process: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		proc.Mutex.RLock()
+		defer proc.Mutex.RUnlock()
+		if proc.RestartCount != 0 || proc.IsRunning {
+			t.Errorf("Expected terminated process to stay stopped, got %d restarts, running %v", proc.RestartCount, proc.IsRunning)
+		}
+	})
+}
+
+func TestBackgroundOutputBackpressure(t *testing.T) {
+	t.Run("AppendBounded", func(t *testing.T) {
+		if got := appendBounded("abc", "def", 10); got != "abcdef" {
+			t.Errorf("Expected untruncated output, got %q", got)
+		}
+		if got := appendBounded("0123456789", "abcd", 10); got != "...789abcd" {
+			t.Errorf("Expected oldest content dropped, got %q", got)
+		}
+		if got := appendBounded("0123", "abcdefghijkl", 10); got != "...fghijkl" {
+			t.Errorf("Expected oversized chunk trimmed to its tail, got %q", got)
+		}
+	})
+
+	t.Run("DropNewestMarksDroppedLines", func(t *testing.T) {
+		_, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		manager.config.Session.BackgroundOutputBuffer = 1
+		manager.config.Session.BackgroundDropPolicy = DropPolicyDropNewest
+
+		var input strings.Builder
+		for i := 0; i < 500; i++ {
+			fmt.Fprintf(&input, "line %d\n", i)
+		}
+
+		var output strings.Builder
+		manager.captureBackgroundOutput(context.Background(), make(chan struct{}), strings.NewReader(input.String()), func(text string) {
+			time.Sleep(time.Millisecond) // Slow consumer
+			output.WriteString(text)
+		})
+
+		if !strings.Contains(output.String(), "lines dropped") {
+			t.Errorf("Expected a dropped lines marker, got %q", output.String())
+		}
+		if !strings.HasPrefix(output.String(), "line 0\n") {
+			t.Errorf("Expected the first line to be kept, got %q", output.String())
+		}
+	})
+
+	t.Run("FastProducerStaysWithinLimit", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+		defer manager.Shutdown()
+		manager.config.Session.MaxBackgroundProcesses = 1
+		manager.config.Session.BackgroundOutputLimit = 1000
+		manager.config.Session.BackgroundDropPolicy = DropPolicyDropOldest
+
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "seq 1 200000")
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		proc, _ := manager.GetBackgroundProcess(session.ID, processID)
+
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			proc.Mutex.RLock()
+			running := proc.IsRunning
+			proc.Mutex.RUnlock()
+			if !running {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond) // Let output capture drain
+
+		proc.Mutex.RLock()
+		defer proc.Mutex.RUnlock()
+		if proc.IsRunning {
+			t.Fatal("Background process did not finish")
+		}
+		if len(proc.Output) > 1000 {
+			t.Errorf("Expected output within 1000 bytes, got %d", len(proc.Output))
+		}
+		if !strings.HasPrefix(proc.Output, "...") {
+			t.Errorf("Expected output truncated from the front, got %q", proc.Output)
+		}
+	})
+}
+
+func TestRecentCommandBuffer(t *testing.T) {
+	t.Run("EvictsByCount", func(t *testing.T) {
+		buffer := newRecentCommandBuffer(2, 0)
+		for _, command := range []string{"one", "two", "three"} {
+			buffer.add(RecentCommand{Command: command})
+		}
+
+		recent := buffer.recent(0)
+		if len(recent) != 2 || recent[0].Command != "three" || recent[1].Command != "two" {
+			t.Errorf("Expected [three two], got %+v", recent)
+		}
+		if limited := buffer.recent(1); len(limited) != 1 || limited[0].Command != "three" {
+			t.Errorf("Expected only the newest command, got %+v", limited)
+		}
+	})
+
+	t.Run("EvictsByBytes", func(t *testing.T) {
+		buffer := newRecentCommandBuffer(10, 20)
+		buffer.add(RecentCommand{Command: "a", Output: "123456789"})
+		buffer.add(RecentCommand{Command: "b", Output: "123456789"})
+		buffer.add(RecentCommand{Command: "c", Output: "123456789"})
+
+		recent := buffer.recent(0)
+		if len(recent) != 2 || recent[1].Command != "b" || buffer.totalBytes != 20 {
+			t.Errorf("Expected the two newest commands within 20 bytes, got %+v (%d bytes)", recent, buffer.totalBytes)
+		}
+	})
+
+	t.Run("TruncatesOversizedOutput", func(t *testing.T) {
+		buffer := newRecentCommandBuffer(10, 10)
+		buffer.add(RecentCommand{Command: "cat", Output: "abcdefghijklmnop"})
+
+		recent := buffer.recent(0)
+		if len(recent) != 1 || recent[0].Output != "...mnop" {
+			t.Errorf("Expected output truncated to its tail, got %+v", recent)
+		}
+	})
+
+	t.Run("DisabledAndWithoutDatabase", func(t *testing.T) {
+		session, manager, cleanup := setupTestSession(t)
+		defer cleanup()
+
+		// The test config leaves the buffer disabled
+		manager.ExecuteCommand(session.ID, "echo hidden")
+		if recent, _ := manager.GetRecentCommands(session.ID, 0); len(recent) != 0 {
+			t.Errorf("Expected disabled buffer to stay empty, got %+v", recent)
+		}
+
+		manager.database = nil
+		manager.config.Session.RecentCommandsLimit = 5
+		enabled, err := manager.CreateSession("recent", "test_project", "/tmp")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		manager.ExecuteCommand(enabled.ID, "echo hello")
+		manager.ExecuteCommand(enabled.ID, "false")
+
+		recent, err := manager.GetRecentCommands(enabled.ID, 0)
+		if err != nil {
+			t.Fatalf("GetRecentCommands failed: %v", err)
+		}
+		if len(recent) != 2 || recent[0].Command != "false" || recent[0].Success || recent[1].Output != "hello\n" {
+			t.Errorf("Unexpected recent commands: %+v", recent)
+		}
+	})
+}
+
+func TestCleanupPause(t *testing.T) {
+	_, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	if _, err := manager.PauseCleanup(time.Minute, "bulk"); err == nil {
+		t.Error("Expected pausing to be rejected when max_cleanup_pause is 0")
+	}
+
+	manager.config.Session.MaxCleanupPause = time.Minute
+	if _, err := manager.PauseCleanup(2*time.Minute, "bulk"); err == nil {
+		t.Error("Expected a pause longer than max_cleanup_pause to be rejected")
+	}
+
+	status, err := manager.PauseCleanup(time.Minute, "bulk")
+	if err != nil || !status.Paused || status.Reason != "bulk" {
+		t.Fatalf("Expected cleanup to be paused, got %+v (%v)", status, err)
+	}
+	if !manager.cleanupPaused() || !manager.Diagnostics().CleanupPause.Paused {
+		t.Error("Expected the pause to be reported")
+	}
+	if !manager.ResumeCleanup() || manager.cleanupPaused() {
+		t.Error("Expected cleanup to resume")
+	}
+	if manager.ResumeCleanup() {
+		t.Error("Expected resuming an unpaused cleanup to report false")
+	}
+
+	if _, err := manager.PauseCleanup(50*time.Millisecond, "short"); err != nil {
+		t.Fatalf("Failed to pause cleanup: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if manager.cleanupPaused() || manager.ResumeCleanup() {
+		t.Error("Expected cleanup to resume automatically after the pause expired")
+	}
+}
+
+// TestCdChainTracking tests that the session directory follows chained cd commands
+func TestCdChainTracking(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.ParseCdChains = true
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+	for _, dir := range []string{"a/b", "with space"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"and_chain", "cd a && cd b && ls", "a/b"},
+		{"missing_target_refused", "cd a && cd missing && cd b", ""},
+		{"semicolon_continues_after_failure", "cd a; cd missing; cd b", "a/b"},
+		{"command_failure_after_cd", "cd a && false && cd b", "a"},
+		{"parent_and_previous", "cd a/b && cd .. && cd -", "a/b"},
+		{"quoted_path", `cd "with space" && pwd`, "with space"},
+		{"pipeline_runs_in_subshell", "cd a | cat", ""},
+		{"variable_not_resolved", "cd a && cd $SOME_DIR", "a"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := manager.SetSessionCurrentDir(session.ID, root); err != nil {
+				t.Fatalf("Failed to reset directory: %v", err)
+			}
+			manager.ExecuteCommandWithTimeout(session.ID, tc.command, 10*time.Second)
+			if got, want := session.GetCurrentDir(), filepath.Join(root, tc.expected); got != want {
+				t.Errorf("Expected directory %s, got %s", want, got)
+			}
+		})
+	}
+
+	t.Run("chains_disabled", func(t *testing.T) {
+		manager.config.Session.ParseCdChains = false
+		defer func() { manager.config.Session.ParseCdChains = true }()
+
+		if err := manager.SetSessionCurrentDir(session.ID, root); err != nil {
+			t.Fatalf("Failed to reset directory: %v", err)
+		}
+		manager.ExecuteCommandWithTimeout(session.ID, "cd a && cd b", 10*time.Second)
+		if got, want := session.GetCurrentDir(), filepath.Join(root, "a"); got != want {
+			t.Errorf("Expected only the leading cd to be tracked (%s), got %s", want, got)
+		}
+	})
+}
+
+// TestCdTargetValidation tests that cd to a missing directory is refused or, with
+// auto_create_dirs, creates it, and that cd -, cd ~ and a bare cd are tracked
+func TestCdTargetValidation(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.ParseCdChains = true
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+	home := filepath.Join(root, "home")
+	if err := os.MkdirAll(filepath.Join(home, "src"), 0o755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(session.ID, map[string]string{"HOME": home}); err != nil {
+		t.Fatalf("Failed to set HOME: %v", err)
+	}
+	reset := func() {
+		if err := manager.SetSessionCurrentDir(session.ID, root); err != nil {
+			t.Fatalf("Failed to reset directory: %v", err)
+		}
+	}
+
+	t.Run("missing_target", func(t *testing.T) {
+		reset()
+		_, err := manager.ExecuteCommandWithTimeout(session.ID, "cd missing && touch created", 10*time.Second)
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Fatalf("Expected a missing directory error, got %v", err)
+		}
+		if got := session.GetCurrentDir(); got != root {
+			t.Errorf("Expected directory to stay %s, got %s", root, got)
+		}
+		if _, err := os.Stat(filepath.Join(root, "created")); !os.IsNotExist(err) {
+			t.Error("Expected the command not to run")
+		}
+		if _, err := manager.ExecuteCommand(session.ID, "cd missing"); err == nil {
+			t.Error("Expected ExecuteCommand to refuse a missing directory")
+		}
+	})
+
+	t.Run("auto_create", func(t *testing.T) {
+		reset()
+		if err := manager.SetSessionAutoCreateDirs(session.ID, true); err != nil {
+			t.Fatalf("Failed to enable auto_create_dirs: %v", err)
+		}
+		defer manager.SetSessionAutoCreateDirs(session.ID, false)
+
+		if _, err := manager.ExecuteCommandWithTimeout(session.ID, "cd new/nested", 10*time.Second); err != nil {
+			t.Fatalf("Expected cd to create the directory, got %v", err)
+		}
+		if got, want := session.GetCurrentDir(), filepath.Join(root, "new", "nested"); got != want {
+			t.Errorf("Expected directory %s, got %s", want, got)
+		}
+	})
+
+	t.Run("auto_create_outside_allowed", func(t *testing.T) {
+		reset()
+		manager.SetSessionAutoCreateDirs(session.ID, true)
+		manager.config.Security.AllowedWorkingDirs = []string{home}
+		defer func() {
+			manager.SetSessionAutoCreateDirs(session.ID, false)
+			manager.config.Security.AllowedWorkingDirs = nil
+		}()
+
+		if _, err := manager.ExecuteCommandWithTimeout(session.ID, "cd outside", 10*time.Second); err == nil {
+			t.Error("Expected cd outside the allowed directories to be refused")
+		}
+		if _, err := os.Stat(filepath.Join(root, "outside")); !os.IsNotExist(err) {
+			t.Error("Expected no directory to be created outside the allowed directories")
+		}
+	})
+
+	t.Run("home", func(t *testing.T) {
+		for _, command := range []string{"cd", "cd ~", "cd ~/src"} {
+			reset()
+			if _, err := manager.ExecuteCommandWithTimeout(session.ID, command, 10*time.Second); err != nil {
+				t.Fatalf("%q failed: %v", command, err)
+			}
+			want := home
+			if command == "cd ~/src" {
+				want = filepath.Join(home, "src")
+			}
+			if got := session.GetCurrentDir(); got != want {
+				t.Errorf("%q: expected directory %s, got %s", command, want, got)
+			}
+		}
+	})
+
+	t.Run("user_home", func(t *testing.T) {
+		account, err := user.Current()
+		if err != nil || account.HomeDir == "" {
+			t.Skip("current user has no home directory")
+		}
+		if info, err := os.Stat(account.HomeDir); err != nil || !info.IsDir() {
+			t.Skip("current user's home directory does not exist")
+		}
+
+		reset()
+		if _, err := manager.ExecuteCommandWithTimeout(session.ID, "cd ~"+account.Username, 10*time.Second); err != nil {
+			t.Fatalf("cd ~%s failed: %v", account.Username, err)
+		}
+		if got := session.GetCurrentDir(); got != account.HomeDir {
+			t.Errorf("Expected cd ~%s to move to %s, got %s", account.Username, account.HomeDir, got)
+		}
+
+		// An unknown user is left to the shell instead of being created as a literal directory
+		reset()
+		manager.SetSessionAutoCreateDirs(session.ID, true)
+		defer manager.SetSessionAutoCreateDirs(session.ID, false)
+		before := session.GetCurrentDir()
+		manager.ExecuteCommandWithTimeout(session.ID, "cd ~no-such-user-goterm", 10*time.Second)
+		if _, err := os.Stat(filepath.Join(before, "~no-such-user-goterm")); !os.IsNotExist(err) {
+			t.Error("Expected no literal ~user directory to be created")
+		}
+		if got := session.GetCurrentDir(); got != before {
+			t.Errorf("Expected the directory to stay %s, got %s", before, got)
+		}
+	})
+
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("previous_across_commands_persistent_%v", persistent), func(t *testing.T) {
+			manager.config.Session.PersistentShell = persistent
+			defer func() { manager.config.Session.PersistentShell = false }()
+
+			reset()
+			if _, err := manager.ExecuteCommandWithTimeout(session.ID, "cd home", 10*time.Second); err != nil {
+				t.Fatalf("cd failed: %v", err)
+			}
+			output, err := manager.ExecuteCommandWithTimeout(session.ID, "cd - && pwd", 10*time.Second)
+			if err != nil {
+				t.Fatalf("cd - failed: %v", err)
+			}
+			if got := session.GetCurrentDir(); got != root {
+				t.Errorf("Expected cd - to return to %s, got %s", root, got)
+			}
+			// cd - prints the directory it moves to before pwd does
+			if lines := strings.Fields(output); len(lines) == 0 || lines[len(lines)-1] != root {
+				t.Errorf("Expected the shell to agree on the previous directory, pwd printed %q", output)
+			}
+		})
+	}
+}
+
+// TestCdHomeAndPrevious tests cd -, cd ~ and a bare cd through ExecuteCommand and
+// ExecuteCommandWithStreaming
+func TestCdHomeAndPrevious(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	tmp, err := filepath.EvalSymlinks(os.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %v", os.TempDir(), err)
+	}
+	original, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+	home := filepath.Join(original, "home")
+	if err := os.MkdirAll(filepath.Join(home, "sub"), 0o755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(session.ID, map[string]string{"HOME": home}); err != nil {
+		t.Fatalf("Failed to set HOME: %v", err)
+	}
+
+	executors := map[string]func(command string) (string, error){
+		"ExecuteCommand": func(command string) (string, error) {
+			return manager.ExecuteCommand(session.ID, command)
+		},
+		"ExecuteCommandWithStreaming": func(command string) (string, error) {
+			return manager.ExecuteCommandWithStreaming(session.ID, command)
+		},
+	}
+	for name, execute := range executors {
+		t.Run(name, func(t *testing.T) {
+			if err := manager.SetSessionCurrentDir(session.ID, original); err != nil {
+				t.Fatalf("Failed to reset directory: %v", err)
+			}
+
+			steps := []struct {
+				command  string
+				dir      string
+				previous string
+			}{
+				{"cd " + tmp, tmp, original},
+				{"cd -", original, tmp},
+				{"cd -", tmp, original},
+				{"cd ~", home, tmp},
+				{"cd " + original, original, home},
+				{"cd", home, original},
+				{"cd ~/sub", filepath.Join(home, "sub"), home},
+			}
+			for _, step := range steps {
+				if _, err := execute(step.command); err != nil {
+					t.Fatalf("%q failed: %v", step.command, err)
+				}
+				if got := session.GetCurrentDir(); got != step.dir {
+					t.Errorf("%q: expected directory %s, got %s", step.command, step.dir, got)
+				}
+				if got := session.GetPreviousDir(); got != step.previous {
+					t.Errorf("%q: expected previous directory %s, got %s", step.command, step.previous, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistentShellExecution(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	// The session's shell was started without the flag, so the first command replaces it
+	manager.config.Session.PersistentShell = true
+
+	run := func(command string) (string, error) {
+		return manager.ExecuteCommandWithTimeout(session.ID, command, 5*time.Second)
+	}
+
+	if _, err := run("export GREETING=hello; greet() { echo \"$GREETING $1\"; }"); err != nil {
+		t.Fatalf("Failed to define state: %v", err)
+	}
+	if output, err := run("greet world"); err != nil || output != "hello world\n" {
+		t.Errorf("Expected the function and variable to persist, got %q (%v)", output, err)
+	}
+
+	if output, _ := run("printf abc"); output != "abc" {
+		t.Errorf("Expected output without a trailing newline to be kept exactly, got %q", output)
+	}
+	if output, _ := run("echo out; echo err >&2"); output != "out\nerr\n" {
+		t.Errorf("Expected stdout and stderr in order, got %q", output)
+	}
+	if output, err := run("cat"); err != nil || output != "" {
+		t.Errorf("Expected stdin to be detached, got %q (%v)", output, err)
+	}
+	if _, err := run("(exit 3)"); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Expected exit status 3, got %v", err)
+	}
+	if output, err := run("# only a comment"); err != nil || output != "" {
+		t.Errorf("Expected a comment-only command to run as a no-op, got %q (%v)", output, err)
+	}
+
+	session.SetEnvironment("SESSION_VAR", "from-session")
+	if output, _ := run("echo $SESSION_VAR"); output != "from-session\n" {
+		t.Errorf("Expected session environment to reach the shell, got %q", output)
+	}
+	output, _ := manager.ExecuteCommandWithOptions(session.ID, "export GREETING=override; echo $GREETING", ExecOptions{Timeout: 5 * time.Second, Env: map[string]string{"ONCE": "1"}})
+	if output.Combined != "override\n" {
+		t.Errorf("Expected override command output, got %q", output.Combined)
+	}
+	if output, _ := run("echo ${ONCE:-unset} $GREETING"); output != "unset hello\n" {
+		t.Errorf("Expected per-command overrides not to persist, got %q", output)
+	}
+
+	// A timed-out command is killed but the shell and its state survive
+	start := time.Now()
+	if _, err := manager.ExecuteCommandWithTimeout(session.ID, "sleep 10", 300*time.Millisecond); err == nil {
+		t.Error("Expected the command to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the timeout to stop the command promptly, took %s", elapsed)
+	}
+	if output, _ := run("echo $GREETING"); output != "hello\n" {
+		t.Errorf("Expected state to survive a timeout, got %q", output)
+	}
+
+	// The session stays usable while a command runs; only the shell itself is held
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run("sleep 1")
+	}()
+	time.Sleep(200 * time.Millisecond)
+	start = time.Now()
+	session.SetEnvironment("WHILE_RUNNING", "1")
+	if dir := session.GetCurrentDir(); dir == "" {
+		t.Error("Expected the current directory while a command runs")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected session accessors not to wait for the running command, took %s", elapsed)
+	}
+	<-done
+
+	// Exiting the shell reports its status and starts a fresh shell
+	if _, err := run("exit 5"); err == nil || !strings.Contains(err.Error(), "status 5") {
+		t.Errorf("Expected the shell exit status to be reported, got %v", err)
+	}
+	if output, err := run("echo ${GREETING:-reset}"); err != nil || output != "reset\n" {
+		t.Errorf("Expected a fresh shell after exit, got %q (%v)", output, err)
+	}
+}
+
+func TestExecuteCommandWithStdin(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persistent=%v", persistent), func(t *testing.T) {
+			session, manager, cleanup := setupTestSession(t)
+			defer cleanup()
+			defer manager.Shutdown()
+			manager.config.Session.PersistentShell = persistent
+
+			run := func(command, stdin string) (string, error) {
+				output, err := manager.ExecuteCommandWithOptions(session.ID, command, ExecOptions{Timeout: 5 * time.Second, Stdin: stdin})
+				return output.Combined, err
+			}
+
+			if output, err := run("cat", "hello\nworld"); err != nil || strings.TrimSuffix(output, "\n") != "hello\nworld" {
+				t.Errorf("Expected cat to echo stdin, got %q (%v)", output, err)
+			}
+			if output, err := run(`read -p "Continue? " answer; echo "answered $answer"`, "y\n"); err != nil || !strings.Contains(output, "answered y") {
+				t.Errorf("Expected the prompt to be answered, got %q (%v)", output, err)
+			}
+
+			// Larger than any pipe buffer, with the output echoed back while stdin is still being written
+			payload := strings.Repeat("0123456789abcdef\n", 64*1024)
+			output, err := run("cat", payload)
+			if err != nil || len(output) != len(payload) {
+				t.Errorf("Expected a %d byte payload to round-trip, got %d bytes (%v)", len(payload), len(output), err)
+			}
+
+			// A command that never reads stdin still times out as usual
+			start := time.Now()
+			if _, err := manager.ExecuteCommandWithOptions(session.ID, "sleep 10", ExecOptions{Timeout: 300 * time.Millisecond, Stdin: payload}); err == nil {
+				t.Error("Expected the command to time out")
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Expected the timeout to be respected, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestSessionCommandAliases(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	define := func(name, command string) {
+		t.Helper()
+		if _, err := manager.SetSessionAlias(session.ID, name, command); err != nil {
+			t.Fatalf("Failed to define alias %q: %v", name, err)
+		}
+	}
+	define("gs", "git status")
+	define("st", "gs --short")
+	define("ls", "ls -la")
+	define("ping", "pong")
+	define("pong", "ping")
+
+	tests := []struct {
+		command  string
+		expanded string
+		aliases  []string
+	}{
+		{"gs", "git status", []string{"gs"}},
+		{"  st -b", "git status --short -b", []string{"st", "gs"}},
+		{"ls /tmp", "ls -la /tmp", []string{"ls"}},
+		{"ping", "ping", []string{"ping", "pong"}},
+		{"echo gs", "", nil},
+		{"gsx", "", nil},
+	}
+	for _, tt := range tests {
+		expansion, err := session.ExpandAlias(tt.command)
+		if err != nil {
+			t.Errorf("ExpandAlias(%q) failed: %v", tt.command, err)
+			continue
+		}
+		if tt.aliases == nil {
+			if expansion != nil {
+				t.Errorf("Expected %q not to be expanded, got %+v", tt.command, expansion)
+			}
+			continue
+		}
+		if expansion == nil || expansion.Expanded != tt.expanded || strings.Join(expansion.Aliases, ",") != strings.Join(tt.aliases, ",") {
+			t.Errorf("ExpandAlias(%q) = %+v, want %q via %v", tt.command, expansion, tt.expanded, tt.aliases)
+		}
+	}
+
+	// A chain longer than the expansion bound is rejected rather than cut short
+	for i := 0; i <= maxAliasExpansions; i++ {
+		define(fmt.Sprintf("a%d", i), fmt.Sprintf("a%d", i+1))
+	}
+	if _, err := session.ExpandAlias("a0"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected a too-deep expansion to fail, got %v", err)
+	}
+
+	aliases, err := manager.SetSessionAlias(session.ID, "gs", "")
+	if err != nil {
+		t.Fatalf("Failed to remove alias: %v", err)
+	}
+	for _, alias := range aliases {
+		if alias.Name == "gs" {
+			t.Error("Expected gs to be removed")
+		}
+	}
+	if _, err := manager.SetSessionAlias(session.ID, "gs", ""); err == nil {
+		t.Error("Expected removing an undefined alias to fail")
+	}
+	if _, err := manager.SetSessionAlias(session.ID, "two words", "echo"); err == nil {
+		t.Error("Expected an alias name with a space to be rejected")
+	}
+	if _, err := manager.GetSessionAliases("missing"); err == nil {
+		t.Error("Expected an error for an unknown session")
+	}
+}
+
+func TestCappedOutput(t *testing.T) {
+	unlimited := newCappedOutput(0)
+	unlimited.Write([]byte(strings.Repeat("x", 1000)))
+	if unlimited.Truncated() || len(unlimited.String()) != 1000 {
+		t.Errorf("Expected a zero limit to keep everything, got %d bytes", len(unlimited.String()))
+	}
+
+	exact := newCappedOutput(10)
+	exact.Write([]byte("0123"))
+	exact.Write([]byte("456789"))
+	if exact.Truncated() || exact.String() != "0123456789" {
+		t.Errorf("Expected output at the limit to be kept whole, got %q", exact.String())
+	}
+
+	// Written a line at a time and in one large write, the head and tail are the same
+	for _, lineByLine := range []bool{true, false} {
+		capped := newCappedOutput(8)
+		text := "head\nmiddle\nmore\nend\n"
+		if lineByLine {
+			for _, line := range strings.SplitAfter(text, "\n") {
+				capped.Write([]byte(line))
+			}
+		} else {
+			capped.Write([]byte(text))
+		}
+		want := "head\n[output truncated, 13 bytes omitted]\nend\n"
+		if !capped.Truncated() || capped.String() != want {
+			t.Errorf("lineByLine=%v: expected %q, got %q", lineByLine, want, capped.String())
+		}
+	}
+
+	// A head cut mid-line still puts the marker on a line of its own
+	capped := newCappedOutput(4)
+	capped.Write([]byte("abcdefgh"))
+	if want := "ab\n[output truncated, 4 bytes omitted]\ngh"; capped.String() != want {
+		t.Errorf("Expected %q, got %q", want, capped.String())
+	}
+}
+
+func TestExecuteCommandWithOutputLimit(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persistent=%v", persistent), func(t *testing.T) {
+			session, manager, cleanup := setupTestSession(t)
+			defer cleanup()
+			defer manager.Shutdown()
+			manager.config.Session.PersistentShell = persistent
+
+			// 1000 numbered lines, then an error at the end that must survive truncation
+			command := "i=0; while [ $i -lt 1000 ]; do echo line$i; i=$((i+1)); done; echo fatal error; (exit 3)"
+			output, err := manager.ExecuteCommandWithOptions(session.ID, command, ExecOptions{Timeout: 10 * time.Second, MaxOutputBytes: 200})
+			if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+				t.Errorf("Expected the command to run to completion and fail, got %v", err)
+			}
+			if !output.Truncated {
+				t.Fatal("Expected the output to be truncated")
+			}
+			if !strings.HasPrefix(output.Combined, "line0\n") || !strings.HasSuffix(output.Combined, "fatal error\n") {
+				t.Errorf("Expected both the start and the end of the output, got %q", output.Combined)
+			}
+			if !strings.Contains(output.Combined, "bytes omitted]\n") || len(output.Combined) > 260 {
+				t.Errorf("Expected about 200 bytes around a truncation line, got %d bytes: %q", len(output.Combined), output.Combined)
+			}
+			if !strings.HasSuffix(output.Stdout, "line999\nfatal error\n") {
+				t.Errorf("Expected stdout to be truncated the same way, got %q", output.Stdout)
+			}
+
+			output, err = manager.ExecuteCommandWithOptions(session.ID, "echo short", ExecOptions{Timeout: 10 * time.Second, MaxOutputBytes: 200})
+			if err != nil || output.Truncated || output.Combined != "short\n" {
+				t.Errorf("Expected output under the limit to be kept whole, got %+v (%v)", output, err)
+			}
+		})
+	}
+}
+
+func TestExecuteCommandWithIdleTimeout(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persistent=%v", persistent), func(t *testing.T) {
+			session, manager, cleanup := setupTestSession(t)
+			defer cleanup()
+			defer manager.Shutdown()
+			manager.config.Session.PersistentShell = persistent
+
+			// A command that keeps printing runs past its idle timeout
+			output, err := manager.ExecuteCommandWithOptions(session.ID, "for i in 1 2 3 4 5 6; do echo $i; sleep 0.2; done",
+				ExecOptions{Timeout: 10 * time.Second, IdleTimeout: 600 * time.Millisecond})
+			if err != nil || output.TimeoutReason != "" || !strings.HasSuffix(output.Combined, "6\n") {
+				t.Errorf("Expected an active command to finish, got %+v (%v)", output, err)
+			}
+
+			start := time.Now()
+			output, err = manager.ExecuteCommandWithOptions(session.ID, "echo started; sleep 5", ExecOptions{Timeout: 10 * time.Second, IdleTimeout: 500 * time.Millisecond})
+			if err == nil || output.TimeoutReason != TimeoutReasonIdle || !strings.Contains(output.Combined, "started") {
+				t.Errorf("Expected a silent command to be stopped as idle, got %+v (%v)", output, err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Expected the idle timeout to stop the command early, took %s", elapsed)
+			}
+
+			output, err = manager.ExecuteCommandWithOptions(session.ID, "while true; do echo tick; sleep 0.1; done", ExecOptions{Timeout: 700 * time.Millisecond, IdleTimeout: 500 * time.Millisecond})
+			if err == nil || output.TimeoutReason != TimeoutReasonTotal {
+				t.Errorf("Expected an active command to be stopped by the total timeout, got %q (%v)", output.TimeoutReason, err)
+			}
+		})
+	}
+}
+
+// TestExportActivityMetrics tests appending activity snapshots and rotating the file
+func TestExportActivityMetrics(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	if _, err := manager.ExportActivityMetrics(); err == nil {
+		t.Error("Expected export to fail without activity_metrics_file")
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics", "activity.jsonl")
+	manager.config.Monitoring.ActivityMetricsFile = path
+	manager.config.Monitoring.ActivityMetricsMaxSizeMB = 1
+	manager.config.Monitoring.ActivityMetricsMaxBackups = 2
+
+	export, err := manager.ExportActivityMetrics()
+	if err != nil {
+		t.Fatalf("ExportActivityMetrics failed: %v", err)
+	}
+	if export.Sessions != 1 || export.Rotated || export.BytesWritten == 0 {
+		t.Errorf("Unexpected export: %+v", export)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	var record struct {
+		Timestamp time.Time `json:"timestamp"`
+		Metrics   struct {
+			SessionID string `json:"session_id"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &record); err != nil {
+		t.Fatalf("Expected a single JSON line, got %q: %v", data, err)
+	}
+	if record.Metrics.SessionID != session.ID || record.Timestamp.IsZero() {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+
+	// Grow the file to the size limit so the next snapshot rotates it
+	if err := os.Truncate(path, 1024*1024); err != nil {
+		t.Fatalf("Failed to grow export: %v", err)
+	}
+	export, err = manager.ExportActivityMetrics()
+	if err != nil || !export.Rotated {
+		t.Fatalf("Expected the file to be rotated, got %+v (%v)", export, err)
+	}
+	if info, err := os.Stat(path + ".1"); err != nil || info.Size() != 1024*1024 {
+		t.Errorf("Expected the previous file to be kept as %s.1", path)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(export.BytesWritten) {
+		t.Errorf("Expected the new file to hold only the latest snapshot")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := rotateFile(path, 2); err != nil {
+			t.Fatalf("rotateFile failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Error("Expected a second backup")
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected backups beyond max_backups to be dropped")
+	}
+}
+
+func TestCommandTags(t *testing.T) {
+	tests := []struct {
+		command  string
+		explicit []string
+		want     []string
+	}{
+		{"echo hello", nil, []string{}},
+		{"git status", nil, []string{"git"}},
+		{"cd web && npm install && git add -A", []string{"Release"}, []string{"git", "npm", "release"}},
+		{"FOO=1 sudo /usr/bin/docker ps | grep api", nil, []string{"docker"}},
+		{"echo 'git push; docker run' 2>&1", nil, []string{}},
+		{"(go test ./... &> out.log) || python3 report.py", nil, []string{"go", "python"}},
+		{"# git is mentioned only in a comment", []string{"git", " git "}, []string{"git"}},
+	}
+
+	for _, tt := range tests {
+		got := CommandTags(tt.command, tt.explicit)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("CommandTags(%q, %v) = %v, want %v", tt.command, tt.explicit, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteCommandWithTagsRecordsHistory(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	if _, err := manager.ExecuteCommandWithOptions(session.ID, "git --version >/dev/null; echo tagged", ExecOptions{Timeout: 10 * time.Second, Tags: []string{"Smoke"}}); err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+
+	records, err := manager.database.SearchCommands(session.ID, "", "", "", nil, time.Time{}, time.Time{}, []string{"smoke", "git"}, 0)
+	if err != nil {
+		t.Fatalf("Failed to search history: %v", err)
+	}
+	if len(records) != 1 || records[0].Tags != `["git","smoke"]` || records[0].Output != "tagged\n" {
+		t.Fatalf("Expected the command to be recorded with explicit and detected tags, got %+v", records)
+	}
+}
+
+func TestGetActiveCommandOutput(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persistent=%v", persistent), func(t *testing.T) {
+			session, manager, cleanup := setupTestSession(t)
+			defer cleanup()
+			defer manager.Shutdown()
+			manager.config.Session.PersistentShell = persistent
+
+			if active, err := manager.GetActiveCommandOutput(session.ID); err != nil || active != nil {
+				t.Fatalf("Expected no active command before any ran, got %+v, %v", active, err)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := manager.ExecuteCommandWithOptions(session.ID, "echo first; sleep 1; echo second; (exit 3)", ExecOptions{Timeout: 10 * time.Second})
+				done <- err
+			}()
+
+			// The first line is readable while the command is still sleeping
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				active, err := manager.GetActiveCommandOutput(session.ID)
+				if err != nil {
+					t.Fatalf("Failed to get active command output: %v", err)
+				}
+				if active != nil && strings.Contains(active.Output, "first") {
+					if !active.Running || active.ExitCode != nil || strings.Contains(active.Output, "second") {
+						t.Fatalf("Expected partial output of a running command, got %+v", active)
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("Output of the running command never appeared, last snapshot %+v", active)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			<-done
+			active, err := manager.GetActiveCommandOutput(session.ID)
+			if err != nil {
+				t.Fatalf("Failed to get active command output: %v", err)
+			}
+			if active.Running || active.ExitCode == nil || *active.ExitCode != 3 {
+				t.Fatalf("Expected the finished command with exit code 3, got %+v", active)
+			}
+			if active.Output != "first\nsecond\n" {
+				t.Fatalf("Expected the complete output without the completion marker, got %q", active.Output)
+			}
+		})
+	}
+
+	_, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	if _, err := manager.GetActiveCommandOutput("missing"); err == nil {
+		t.Fatal("Expected an error for an unknown session")
+	}
+}
+
+func TestExecuteCommandWithPTY(t *testing.T) {
+	if term, err := openPseudoTerminal(); err != nil {
+		t.Skipf("Pseudo-terminals are not available: %v", err)
+	} else {
+		term.close()
+	}
+
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	const ttyCheck = "if [ -t 0 ] && [ -t 1 ]; then echo tty $TERM; else echo notty; fi; echo warning >&2"
+	output, err := manager.ExecuteCommandWithOptions(session.ID, ttyCheck, ExecOptions{Timeout: 10 * time.Second, PTY: true})
+	if err != nil || !output.PTY || output.PTYError != "" {
+		t.Fatalf("Expected the command to run in a pseudo-terminal, got %+v, %v", output, err)
+	}
+	// Both streams arrive through the terminal, with its CRLF line endings normalized
+	if !strings.HasPrefix(output.Stdout, "tty ") || !strings.HasSuffix(output.Stdout, "\nwarning\n") || output.Stderr != "" {
+		t.Errorf("Expected merged terminal output, got stdout %q and stderr %q", output.Stdout, output.Stderr)
+	}
+
+	output, err = manager.ExecuteCommandWithOptions(session.ID, ttyCheck, ExecOptions{Timeout: 10 * time.Second})
+	if err != nil || output.PTY || output.Stdout != "notty\n" {
+		t.Errorf("Expected the default path to run without a terminal, got %+v, %v", output, err)
+	}
+
+	// Stdin is typed into the terminal, followed by end of input
+	output, err = manager.ExecuteCommandWithOptions(session.ID, "read -r answer; echo \"got $answer\"; cat", ExecOptions{Timeout: 10 * time.Second, Stdin: "yes\n", PTY: true})
+	if err != nil || !strings.Contains(output.Stdout, "got yes\n") {
+		t.Errorf("Expected stdin to reach the command, got %+v, %v", output, err)
+	}
+
+	// A command waiting for input that never comes is stopped at the timeout
+	output, err = manager.ExecuteCommandWithOptions(session.ID, "echo waiting; read -r never", ExecOptions{Timeout: time.Second, PTY: true})
+	if !errors.Is(err, context.DeadlineExceeded) || output.Stdout != "waiting\n" {
+		t.Errorf("Expected a timeout after the first line, got %+v, %v", output, err)
+	}
+
+	manager.config.Session.MaxBackgroundProcesses = 1
+	processID, err := manager.ExecuteCommandInBackgroundWithOptions(session.ID, "tty", BackgroundOptions{PTY: true})
+	if err != nil {
+		t.Fatalf("Failed to start background process: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		process, _ := manager.GetBackgroundProcess(session.ID, processID)
+		process.Mutex.RLock()
+		running, pty, out := process.IsRunning, process.PTY, process.Output
+		process.Mutex.RUnlock()
+		if !running {
+			if !pty || !strings.HasPrefix(out, "/dev/") {
+				t.Errorf("Expected the background process to report its terminal, got pty=%v output %q", pty, out)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("Background process did not finish")
+}
+
+func TestStreamChunkRecording(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.EnableStreaming = true
+	manager.config.Session.OutputChunkSize = 8
+
+	output, err := manager.ExecuteCommandWithOptions(session.ID, "echo first line; echo oops >&2; (exit 2)", ExecOptions{Timeout: 10 * time.Second})
+	if err == nil || output.CommandID == "" || !output.Streamed {
+		t.Fatalf("Expected a failed, streamed and stored command, got %+v, %v", output, err)
+	}
+
+	chunks, err := manager.database.GetStreamChunks(output.CommandID)
+	if err != nil {
+		t.Fatalf("Failed to get stream chunks: %v", err)
+	}
+	if len(chunks) != output.StreamChunks {
+		t.Errorf("Expected %d chunks as reported, got %d", output.StreamChunks, len(chunks))
+	}
+
+	var stdout, stderr strings.Builder
+	for i, chunk := range chunks {
+		if chunk.SequenceNum != i+1 {
+			t.Fatalf("Expected sequence numbers 1..n in order, got %d at %d", chunk.SequenceNum, i)
+		}
+		if len(chunk.Content) > 8 && chunk.ChunkType != database.ChunkTypeStatus {
+			t.Errorf("Chunk %d exceeds the chunk size: %q", chunk.SequenceNum, chunk.Content)
+		}
+		switch chunk.ChunkType {
+		case database.ChunkTypeStdout:
+			stdout.WriteString(chunk.Content)
+		case database.ChunkTypeStderr:
+			stderr.WriteString(chunk.Content)
+		}
+	}
+	if stdout.String() != "first line\n" || stderr.String() != "oops\n" {
+		t.Errorf("Expected the chunks to rebuild both streams, got %q and %q", stdout.String(), stderr.String())
+	}
+	if last := chunks[len(chunks)-1]; last.ChunkType != database.ChunkTypeStatus || last.Content != "exit_code=2" {
+		t.Errorf("Expected a final status chunk, got %+v", last)
+	}
+
+	manager.config.Session.EnableStreaming = false
+	output, err = manager.ExecuteCommandWithOptions(session.ID, "echo quiet", ExecOptions{Timeout: 10 * time.Second})
+	if err != nil || output.Streamed || output.CommandID == "" {
+		t.Fatalf("Expected a stored command without streaming, got %+v, %v", output, err)
+	}
+	if chunks, _ := manager.database.GetStreamChunks(output.CommandID); len(chunks) != 0 {
+		t.Errorf("Expected no chunks with streaming disabled, got %d", len(chunks))
+	}
+}
+
+// TestStreamChunkOutputLimit tests that stream chunks stop at the output limit and end with a
+// truncation chunk before the status chunk
+func TestStreamChunkOutputLimit(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.EnableStreaming = true
+	manager.config.Session.OutputChunkSize = 16
+
+	output, err := manager.ExecuteCommandWithOptions(session.ID, "seq 1 1000", ExecOptions{Timeout: 10 * time.Second, MaxOutputBytes: 40})
+	if err != nil || !output.Streamed {
+		t.Fatalf("Expected a streamed command, got %+v, %v", output, err)
+	}
+
+	chunks, err := manager.database.GetStreamChunks(output.CommandID)
+	if err != nil || len(chunks) < 3 {
+		t.Fatalf("Expected output, truncation and status chunks, got %d (%v)", len(chunks), err)
+	}
+	var recorded strings.Builder
+	for _, chunk := range chunks[:len(chunks)-2] {
+		recorded.WriteString(chunk.Content)
+	}
+	if recorded.Len() != 40 {
+		t.Errorf("Expected 40 bytes of output recorded, got %d: %q", recorded.Len(), recorded.String())
+	}
+	seqBytes := 0
+	for i := 1; i <= 1000; i++ {
+		seqBytes += len(fmt.Sprintln(i))
+	}
+	truncated := chunks[len(chunks)-2]
+	if want := fmt.Sprintf(streamTruncatedFormat, seqBytes-40); truncated.ChunkType != database.ChunkTypeStdout || truncated.Content != want {
+		t.Errorf("Expected truncation chunk %q, got %+v", want, truncated)
+	}
+	if last := chunks[len(chunks)-1]; last.ChunkType != database.ChunkTypeStatus || last.Content != "exit_code=0" {
+		t.Errorf("Expected a final status chunk, got %+v", last)
+	}
+}
+
+func TestCreateSessionWithPolicy(t *testing.T) {
+	_, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	disallow := false
+	policy := &SecurityPolicy{AllowNetworkAccess: &disallow, BlockedCommands: []string{"terraform"}}
+	session, err := manager.CreateSessionWithPolicy("policy-session", "test_project", "/tmp", policy)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// The session keeps its own copy
+	policy.BlockedCommands[0] = "changed"
+	if session.SecurityPolicy == nil || session.SecurityPolicy.BlockedCommands[0] != "terraform" {
+		t.Fatalf("Expected the session to keep its policy, got %+v", session.SecurityPolicy)
+	}
+
+	// The policy survives the database round trip
+	record, err := manager.database.GetSession(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to load session record: %v", err)
+	}
+	stored, err := decodeSecurityPolicy(record.SecurityPolicy)
+	if err != nil || stored == nil || stored.AllowNetworkAccess == nil || *stored.AllowNetworkAccess {
+		t.Fatalf("Expected the stored policy to block network access, got %+v (%v)", stored, err)
+	}
+	found := false
+	for _, listed := range manager.ListSessions() {
+		if listed.ID == session.ID {
+			found = listed.SecurityPolicy != nil && len(listed.SecurityPolicy.BlockedCommands) == 1
+		}
+	}
+	if !found {
+		t.Error("Expected ListSessions to report the session's policy")
+	}
+
+	allow := true
+	if _, err := manager.CreateSessionWithPolicy("loose-session", "test_project", "/tmp", &SecurityPolicy{AllowFileSystemWrite: &allow}); err == nil {
+		t.Error("Expected a policy loosening the global settings to be rejected")
+	}
+}
+
+func TestCloneSession(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	subDir, err := os.MkdirTemp("", "clone-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	defer os.RemoveAll(subDir)
+
+	if err := manager.SetSessionEnvironment(session.ID, map[string]string{"APP_ENV": "test"}); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+	if err := manager.UnsetSessionEnvironment(session.ID, []string{"HOME"}); err != nil {
+		t.Fatalf("Failed to unset environment: %v", err)
+	}
+	if _, err := manager.SetSessionShellOptions(session.ID, map[string]bool{"pipefail": true}); err != nil {
+		t.Fatalf("Failed to set shell options: %v", err)
+	}
+	if _, err := manager.SetSessionAlias(session.ID, "gs", "git status"); err != nil {
+		t.Fatalf("Failed to define alias: %v", err)
+	}
+	if err := manager.SetSessionCurrentDir(session.ID, subDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	if _, err := manager.ExecuteCommand(session.ID, "echo hi"); err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	clone, err := manager.CloneSession(session.ID, "")
+	if err != nil {
+		t.Fatalf("CloneSession failed: %v", err)
+	}
+	if clone.ID == session.ID || clone.Name != "test-session-copy" || clone.ProjectID != session.ProjectID || clone.WorkingDir != session.WorkingDir {
+		t.Errorf("Expected a new session in the same project and directory, got %+v", clone)
+	}
+	if clone.GetCurrentDir() != subDir {
+		t.Errorf("Expected the clone in %s, got %s", subDir, clone.GetCurrentDir())
+	}
+	if clone.CommandCount != 0 || len(clone.BackgroundProcesses) != 0 {
+		t.Errorf("Expected no history or background processes to be copied, got %d commands", clone.CommandCount)
+	}
+	if value, _ := clone.GetEnvironment("APP_ENV"); value != "test" {
+		t.Errorf("Expected APP_ENV to be copied, got %q", value)
+	}
+	if _, exists := clone.GetEnvironment("HOME"); exists {
+		t.Error("Expected a variable unset in the source to stay unset")
+	}
+	if options := clone.GetShellOptions(); len(options) != 1 || options[0] != "pipefail" {
+		t.Errorf("Expected pipefail to be copied, got %v", options)
+	}
+	if expansion, _ := clone.ExpandAlias("gs"); expansion == nil || expansion.Expanded != "git status" {
+		t.Errorf("Expected the gs alias to be copied, got %+v", expansion)
+	}
+
+	// The copies are independent of the source
+	clone.SetEnvironment("APP_ENV", "changed")
+	if value, _ := session.GetEnvironment("APP_ENV"); value != "test" {
+		t.Errorf("Expected the source environment to be unchanged, got %q", value)
+	}
+
+	if _, err := manager.CloneSession("missing", "copy"); err == nil {
+		t.Error("Expected cloning an unknown session to fail")
+	}
+}
+
+func TestRelocateSession(t *testing.T) {
+	_, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.MaxBackgroundProcesses = 3
+
+	oldRoot, newRoot, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, dir := range []string{filepath.Join(oldRoot, "web"), filepath.Join(newRoot, "web")} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	script := filepath.Join(outside, "server.sh")
+	if err := os.WriteFile(script, []byte("echo dir=$(pwd)\nsleep 30\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	session, err := manager.CreateSession("relocate-test", "", oldRoot)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	startIn := func(dir string) string {
+		if err := manager.SetSessionCurrentDir(session.ID, dir); err != nil {
+			t.Fatalf("Failed to change directory: %v", err)
+		}
+		processID, err := manager.ExecuteCommandInBackground(session.ID, "sh "+script)
+		if err != nil {
+			t.Fatalf("Failed to start background process: %v", err)
+		}
+		if _, err := manager.WaitForOutputPattern(session.ID, processID, "dir=", 5*time.Second); err != nil {
+			t.Fatalf("Process did not start: %v", err)
+		}
+		return processID
+	}
+	inside := startIn(filepath.Join(oldRoot, "web"))
+	elsewhere := startIn(outside)
+	if err := manager.SetSessionCurrentDir(session.ID, filepath.Join(oldRoot, "web")); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+
+	// The allowlist applies to the new location
+	manager.config.Security.AllowedWorkingDirs = []string{oldRoot, outside}
+	if _, err := manager.RelocateSession(session.ID, newRoot, true, true); err == nil {
+		t.Fatal("Expected a directory outside the allowlist to be rejected")
+	}
+	manager.config.Security.AllowedWorkingDirs = nil
+	if _, err := manager.RelocateSession(session.ID, filepath.Join(newRoot, "missing"), false, false); err == nil {
+		t.Fatal("Expected a missing directory to be rejected")
+	}
+
+	relocation, err := manager.RelocateSession(session.ID, newRoot, true, true)
+	if err != nil {
+		t.Fatalf("RelocateSession failed: %v", err)
+	}
+	if session.GetWorkingDir() != newRoot || session.GetCurrentDir() != filepath.Join(newRoot, "web") {
+		t.Errorf("Expected the session in %s/web, got working dir %s, current dir %s", newRoot, session.GetWorkingDir(), session.GetCurrentDir())
+	}
+	if relocation.OldWorkingDir != oldRoot || relocation.OldCurrentDir != filepath.Join(oldRoot, "web") {
+		t.Errorf("Expected the old directories to be reported, got %+v", relocation)
+	}
+
+	if len(relocation.Restarted) != 1 || relocation.Restarted[0].ProcessID != inside || relocation.Restarted[0].NewWorkingDir != filepath.Join(newRoot, "web") {
+		t.Fatalf("Expected the process inside the old root to be restarted in the new one, got %+v", relocation.Restarted)
+	}
+	match, err := manager.WaitForOutputPattern(session.ID, inside, "dir=\\S+", 5*time.Second)
+	if err != nil || match.Match != "dir="+filepath.Join(newRoot, "web") {
+		t.Errorf("Expected the restarted process to run in the new directory, got %+v (%v)", match, err)
+	}
+	if len(relocation.NotMoved) != 1 || relocation.NotMoved[0].ProcessID != elsewhere || relocation.NotMoved[0].Reason == "" {
+		t.Errorf("Expected the process outside the old root to be left running, got %+v", relocation.NotMoved)
+	}
+	proc, err := manager.GetBackgroundProcess(session.ID, elsewhere)
+	if err != nil {
+		t.Fatalf("Expected the process that was not moved to stay tracked: %v", err)
+	}
+	proc.Mutex.RLock()
+	running := proc.IsRunning
+	proc.Mutex.RUnlock()
+	if !running {
+		t.Error("Expected the process that was not moved to keep running")
+	}
+
+	if record, err := manager.database.GetSession(session.ID); err != nil || record.WorkingDir != newRoot {
+		t.Errorf("Expected the new working directory to be stored, got %+v (%v)", record, err)
+	}
+}
+
+func TestVanishedProcesses(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+
+	if health := manager.CheckBackgroundProcessHealth(); health.Status != "healthy" {
+		t.Fatalf("Expected healthy without background processes, got %+v", health)
+	}
+
+	// A process that has exited and been reaped, but whose record was never marked stopped
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	session.mutex.Lock()
+	session.BackgroundProcesses["vanished"] = &BackgroundProcess{ID: "vanished", Command: "true", PID: cmd.Process.Pid, IsRunning: true}
+	session.BackgroundProcesses["finished"] = &BackgroundProcess{ID: "finished", Command: "true", PID: cmd.Process.Pid}
+	session.mutex.Unlock()
+
+	vanished := manager.VanishedProcesses()
+	if len(vanished) != 1 || vanished[0].ProcessID != "vanished" || vanished[0].SessionID != session.ID {
+		t.Fatalf("Expected only the process marked running to be reported, got %+v", vanished)
+	}
+	health := manager.CheckBackgroundProcessHealth()
+	sessions, _ := health.Details["sessions"].(map[string][]string)
+	if health.Status != "degraded" || len(sessions[session.ID]) != 1 {
+		t.Errorf("Expected a degraded check naming the session, got %+v", health)
+	}
+
+	session.mutex.Lock()
+	delete(session.BackgroundProcesses, "vanished")
+	delete(session.BackgroundProcesses, "finished")
+	session.mutex.Unlock()
+}
+
+func TestReapVanishedProcesses(t *testing.T) {
+	session, manager, cleanup := setupTestSession(t)
+	defer cleanup()
+	defer manager.Shutdown()
+	manager.config.Session.MaxBackgroundProcesses = 3
+	manager.config.Session.BackgroundOutputLimit = 1024
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	process := &BackgroundProcess{ID: "vanished", Command: "server", PID: cmd.Process.Pid, IsRunning: true}
+	process.UpdateOutput("listening\n", 0)
+	session.mutex.Lock()
+	session.BackgroundProcesses[process.ID] = process
+	session.mutex.Unlock()
+
+	// The resource cleanup routine reaps it
+	manager.cleanupResources()
+
+	process.Mutex.RLock()
+	running, exitCode, exitStatus, output := process.IsRunning, process.ExitCode, process.ExitStatus, process.Output
+	process.Mutex.RUnlock()
+	if running || exitCode != -1 || exitStatus == nil || exitStatus.Reason != ExitReasonVanished {
+		t.Errorf("Expected the process to be marked stopped with an unknown exit code, got running=%v code=%d status=%+v", running, exitCode, exitStatus)
+	}
+	if !strings.HasPrefix(output, "listening\n") || !strings.Contains(output, "exit code unknown") {
+		t.Errorf("Expected a note appended to the output, got %q", output)
+	}
+	if reaped := manager.ReapVanishedProcesses(); len(reaped) != 0 {
+		t.Errorf("Expected nothing left to reap, got %+v", reaped)
+	}
+
+	// Processes that are still alive are left alone
+	processID, err := manager.ExecuteCommandInBackground(session.ID, "sleep 30")
+	if err != nil {
+		t.Fatalf("Failed to start background process: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		proc, _ := manager.GetBackgroundProcess(session.ID, processID)
+		proc.Mutex.RLock()
+		pid := proc.PID
+		proc.Mutex.RUnlock()
+		if pid != 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if reaped := manager.ReapVanishedProcesses(); len(reaped) != 0 {
+		t.Errorf("Expected a live process not to be reaped, got %+v", reaped)
+	}
 }
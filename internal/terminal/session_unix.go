@@ -0,0 +1,120 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// posixShell reports whether session commands run in a POSIX shell, which the persistent shell,
+// shell options and the timeout coreutil wrapper rely on
+const posixShell = true
+
+// defaultShell is the shell used when none is configured
+func defaultShell() string {
+	return "/bin/bash"
+}
+
+// H4: shellEscape escapes a string for safe use in shell commands
+// This prevents shell injection attacks by escaping special characters
+func shellEscape(s string) string {
+	// If string is empty, return empty quotes
+	if s == "" {
+		return "''"
+	}
+
+	// Check if string needs escaping
+	needsEscape := false
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || c == '_' || c == '-' ||
+			c == '.' || c == '/' || c == ':') {
+			needsEscape = true
+			break
+		}
+	}
+
+	if !needsEscape {
+		return s
+	}
+
+	// Use single quotes for escaping, escape any existing single quotes
+	return "'" + strings.ReplaceAll(s, "'", "'\"'\"'") + "'"
+}
+
+// sessionScript builds the script that runs command in dir with the session's shell options
+func sessionScript(shell, dir, optionsPrefix, command string) string {
+	// H4: Escape the current directory to prevent shell injection
+	return fmt.Sprintf("cd %s && %s%s", shellEscape(dir), optionsPrefix, runnableCommand(command))
+}
+
+// newShellCommand returns a command that runs script with shell
+func newShellCommand(ctx context.Context, shell, script string) *exec.Cmd {
+	return exec.CommandContext(ctx, shell, "-c", script)
+}
+
+// setProcessGroup starts cmd in its own process group so it and its children can be signalled
+// together without reaching the server
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setControllingTerminal starts cmd in a new session whose controlling terminal is cmd's stdin.
+// A session leader also leads its own process group, and cannot be moved into another one.
+func setControllingTerminal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Setpgid = false
+}
+
+// killProcessGroup sends sig to the process group led by pid
+func killProcessGroup(pid int, sig syscall.Signal) error {
+	return syscall.Kill(-pid, sig)
+}
+
+// signalPID sends sig to pid. Signal 0 only checks that the process exists.
+func signalPID(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
+
+// signalProcess sends sig to the process, or to its whole process group when requested
+func (m *Manager) signalProcess(cmd *exec.Cmd, pid int, sig syscall.Signal, useProcessGroup bool) error {
+	// Only signal the group when the process leads it; otherwise the group may be our own
+	if useProcessGroup {
+		if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+			return syscall.Kill(-pgid, sig)
+		}
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// processAlive reports whether pid exists and has not exited. An exited child that has not been
+// reaped yet (a zombie) still accepts signal 0, so its state is checked as well.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+
+	if fields, err := procStatFields(pid); err == nil {
+		return fields[0] != "Z"
+	}
+	output, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(strings.TrimSpace(string(output)), "Z")
+}
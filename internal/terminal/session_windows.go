@@ -0,0 +1,163 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// posixShell reports whether session commands run in a POSIX shell, which the persistent shell,
+// shell options and the timeout coreutil wrapper rely on
+const posixShell = false
+
+// stillActive is the exit code Windows reports for a process that has not exited (STILL_ACTIVE)
+const stillActive = 259
+
+// defaultShell is the shell used when none is configured: the command interpreter named by
+// COMSPEC, normally cmd.exe
+func defaultShell() string {
+	if comspec := os.Getenv("COMSPEC"); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+}
+
+// isPowerShell reports whether shell is Windows PowerShell or PowerShell Core
+func isPowerShell(shell string) bool {
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	return name == "powershell" || name == "pwsh"
+}
+
+// shellEscape quotes a string for cmd.exe. Double quotes cannot appear in Windows paths, but are
+// doubled so a stray one cannot end the quoted string.
+func shellEscape(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	needsEscape := false
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || c == '_' || c == '-' ||
+			c == '.' || c == '/' || c == ':' || c == '\\') {
+			needsEscape = true
+			break
+		}
+	}
+
+	if !needsEscape {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// powerShellEscape quotes a string as a PowerShell literal, which only needs single quotes doubled
+func powerShellEscape(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sessionScript builds the script that runs command in dir. Session shell options are bash
+// options and do not apply here.
+func sessionScript(shell, dir, optionsPrefix, command string) string {
+	if isPowerShell(shell) {
+		return fmt.Sprintf("Set-Location -LiteralPath %s -ErrorAction Stop; %s", powerShellEscape(dir), command)
+	}
+	return fmt.Sprintf("cd /d %s && %s", shellEscape(dir), command)
+}
+
+// newShellCommand returns a command that runs script with shell: `powershell -Command` for
+// PowerShell, otherwise `cmd.exe /C`
+func newShellCommand(ctx context.Context, shell, script string) *exec.Cmd {
+	if isPowerShell(shell) {
+		return exec.CommandContext(ctx, shell, "-NoProfile", "-NonInteractive", "-Command", script)
+	}
+
+	// cmd.exe does not follow the usual argument quoting rules, so the command line is passed
+	// as-is; /S makes it strip only the outer quotes around script
+	cmd := exec.CommandContext(ctx, shell)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`%s /S /C "%s"`, syscall.EscapeArg(shell), script),
+	}
+	return cmd
+}
+
+// setProcessGroup starts cmd in a new process group so console interrupts sent to the server do
+// not reach it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// setControllingTerminal is a no-op: Windows has no pseudo-terminals, so openPseudoTerminal fails
+// before a command is attached to one
+func setControllingTerminal(cmd *exec.Cmd) {}
+
+// killProcessGroup terminates pid and every process it started. Windows has no signals, so
+// SIGKILL forces termination and anything else asks the processes to close.
+func killProcessGroup(pid int, sig syscall.Signal) error {
+	return taskkill(pid, true, sig == syscall.SIGKILL)
+}
+
+// signalPID terminates pid as killProcessGroup does, without its children. Signal 0 only checks
+// that the process exists and returns ESRCH once it has exited.
+func signalPID(pid int, sig syscall.Signal) error {
+	if sig == 0 {
+		if !processAlive(pid) {
+			return syscall.ESRCH
+		}
+		return nil
+	}
+	return taskkill(pid, false, sig == syscall.SIGKILL)
+}
+
+// taskkill runs taskkill.exe for pid, including its child processes when tree is set
+func taskkill(pid int, tree, force bool) error {
+	args := []string{"/PID", strconv.Itoa(pid)}
+	if tree {
+		args = append(args, "/T")
+	}
+	if force {
+		args = append(args, "/F")
+	}
+
+	if output, err := exec.Command("taskkill", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("taskkill failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// signalProcess terminates the process, together with its child processes when requested
+func (m *Manager) signalProcess(cmd *exec.Cmd, pid int, sig syscall.Signal, useProcessGroup bool) error {
+	if useProcessGroup {
+		return killProcessGroup(pid, sig)
+	}
+	if sig == syscall.SIGKILL {
+		return cmd.Process.Kill()
+	}
+	return signalPID(pid, sig)
+}
+
+// processAlive reports whether pid exists and has not exited
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
@@ -0,0 +1,161 @@
+package terminal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// streamChunkInterval bounds how long output is batched into one stream chunk, so a chunk's
+// timestamp stays close to when its output was produced
+const streamChunkInterval = 250 * time.Millisecond
+
+// streamTruncatedFormat is the content of the chunk recorded after the last one when output beyond
+// the recorder's limit was dropped
+const streamTruncatedFormat = "[output truncated, %d more bytes not recorded]\n"
+
+// streamRecorder splits a foreground command's output into numbered stream chunks as it is
+// produced. Consecutive output of the same type is batched into chunks of up to chunkSize bytes.
+// The chunks reference the command's history record, so they are saved once that is stored, and
+// are held in memory until then; at most limit bytes of output are recorded, the rest is counted
+// and reported in a final truncation chunk. A nil *streamRecorder records nothing.
+type streamRecorder struct {
+	mutex     sync.Mutex
+	sessionID string
+	commandID string
+	chunkSize int
+	limit     int   // Output bytes recorded at most; zero or less records everything
+	recorded  int   // Output bytes recorded so far
+	dropped   int64 // Output bytes past limit that were not recorded
+	chunks    []*database.StreamChunk
+	closed    bool
+
+	// Chunk still being filled, not yet in chunks
+	pendingType  string
+	pendingStart time.Time
+	pending      []byte
+}
+
+// newStreamRecorder returns a recorder for commandID's output keeping at most limit bytes, the same
+// limit as the command's captured output, or nil when streaming is disabled or there is no
+// database to save the chunks to
+func (m *Manager) newStreamRecorder(sessionID, commandID string, limit int) *streamRecorder {
+	if !m.config.Session.EnableStreaming || m.database == nil || commandID == "" {
+		return nil
+	}
+
+	chunkSize := m.config.Session.OutputChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 64 * 1024
+	}
+	return &streamRecorder{sessionID: sessionID, commandID: commandID, chunkSize: chunkSize, limit: limit}
+}
+
+// write adds output of chunkType, starting a new chunk when the type changes, the current chunk
+// is full or it was started more than streamChunkInterval ago. Output past the limit is dropped.
+func (r *streamRecorder) write(chunkType string, p []byte) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	if r.limit > 0 {
+		if room := r.limit - r.recorded; len(p) > room {
+			r.dropped += int64(len(p) - room)
+			p = p[:room]
+		}
+		r.recorded += len(p)
+		if len(p) == 0 {
+			return
+		}
+	}
+
+	now := time.Now()
+	if len(r.pending) > 0 && (r.pendingType != chunkType || now.Sub(r.pendingStart) > streamChunkInterval) {
+		r.endChunkLocked()
+	}
+	for len(p) > 0 {
+		if len(r.pending) == 0 {
+			r.pendingType, r.pendingStart = chunkType, now
+		}
+		n := min(len(p), r.chunkSize-len(r.pending))
+		r.pending = append(r.pending, p[:n]...)
+		p = p[n:]
+		if len(r.pending) >= r.chunkSize {
+			r.endChunkLocked()
+		}
+	}
+}
+
+// close ends the output with a status chunk holding exitCode, preceded by a truncation chunk when
+// output was dropped, and returns the number of chunks recorded. Output written afterwards is
+// ignored.
+func (r *streamRecorder) close(exitCode int) int {
+	if r == nil {
+		return 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.closed {
+		if r.dropped > 0 {
+			// Reported with the type of the last output, where the dropped output would have continued
+			if len(r.pending) == 0 && len(r.chunks) > 0 {
+				r.pendingType = r.chunks[len(r.chunks)-1].ChunkType
+			}
+			r.endChunkLocked()
+			r.pending = fmt.Appendf(r.pending, streamTruncatedFormat, r.dropped)
+			r.pendingStart = time.Now()
+		}
+		r.endChunkLocked()
+		r.pendingType, r.pendingStart = database.ChunkTypeStatus, time.Now()
+		r.pending = fmt.Appendf(r.pending, "exit_code=%d", exitCode)
+		r.endChunkLocked()
+		r.closed = true
+	}
+	return len(r.chunks)
+}
+
+// endChunkLocked numbers the pending chunk and appends it to the recorded chunks. The caller must
+// hold r.mutex.
+func (r *streamRecorder) endChunkLocked() {
+	if len(r.pending) == 0 {
+		return
+	}
+	r.chunks = append(r.chunks, &database.StreamChunk{
+		SessionID:   r.sessionID,
+		CommandID:   r.commandID,
+		ChunkType:   r.pendingType,
+		Content:     string(r.pending),
+		Timestamp:   r.pendingStart,
+		SequenceNum: len(r.chunks) + 1,
+	})
+	r.pending = r.pending[:0]
+}
+
+// saveStreamChunks stores the chunks live's recorder collected, after the command they belong to
+// has been stored in the history. Failures are logged; the command record itself is unaffected.
+func (m *Manager) saveStreamChunks(live *liveCommand) {
+	if live == nil || live.stream == nil {
+		return
+	}
+
+	r := live.stream
+	r.mutex.Lock()
+	chunks := r.chunks
+	r.mutex.Unlock()
+
+	if err := m.database.StoreStreamChunks(chunks); err != nil {
+		m.logger.Error("Failed to store stream chunks", err, map[string]interface{}{
+			"session_id": r.sessionID,
+			"command_id": r.commandID,
+			"chunks":     len(chunks),
+		})
+	}
+}
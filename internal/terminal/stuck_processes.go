@@ -0,0 +1,216 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultKillTimeout is how long termination waits for a process to be reaped after SIGKILL
+const defaultKillTimeout = 5 * time.Second
+
+// StuckProcess describes a process that survived SIGKILL, typically because it is in
+// uninterruptible sleep (e.g. blocked on hung NFS I/O). The cleanup routine keeps trying to kill
+// and reap it until it is gone.
+type StuckProcess struct {
+	SessionID        string    `json:"session_id"`
+	ProcessID        string    `json:"process_id"`
+	Command          string    `json:"command"`
+	PID              int       `json:"pid"`
+	State            string    `json:"state,omitempty"`             // State letter from /proc/<pid>/stat (or ps), e.g. "D"
+	StateDescription string    `json:"state_description,omitempty"` // e.g. "uninterruptible sleep (usually I/O)"
+	DetectedAt       time.Time `json:"detected_at"`
+	LastAttemptAt    time.Time `json:"last_attempt_at"`
+	KillAttempts     int       `json:"kill_attempts"`
+
+	startTime string // Identifies the process so a reused PID is never killed
+}
+
+// StuckProcessError is returned by termination when the process did not exit after SIGKILL
+type StuckProcessError struct {
+	Process StuckProcess
+	Timeout time.Duration
+}
+
+// Error implements the error interface
+func (e *StuckProcessError) Error() string {
+	state := "unknown state"
+	if e.Process.State != "" {
+		state = fmt.Sprintf("state %s: %s", e.Process.State, e.Process.StateDescription)
+	}
+	return fmt.Sprintf("process %d is stuck: still present %s after SIGKILL (%s); cleanup will keep trying to reap it",
+		e.Process.PID, e.Timeout, state)
+}
+
+// stuckProcesses tracks processes that survived SIGKILL, keyed by process ID
+type stuckProcesses struct {
+	mu   sync.Mutex
+	byID map[string]*StuckProcess
+}
+
+// processStateDescriptions explains the state letters of /proc/<pid>/stat and ps
+var processStateDescriptions = map[string]string{
+	"R": "running",
+	"S": "interruptible sleep",
+	"D": "uninterruptible sleep (usually I/O)",
+	"Z": "zombie (exited, not yet reaped)",
+	"T": "stopped",
+	"t": "stopped by debugger",
+	"X": "dead",
+	"I": "idle kernel thread",
+	"U": "uninterruptible wait",
+}
+
+// describeProcessState returns a readable description of a process state letter
+func describeProcessState(state string) string {
+	if description, ok := processStateDescriptions[state]; ok {
+		return description
+	}
+	if state == "" {
+		return ""
+	}
+	return "unknown"
+}
+
+// processState returns pid's state letter from /proc/<pid>/stat, falling back to ps where /proc
+// is unavailable. It returns "" when the state cannot be read.
+func processState(pid int) string {
+	if fields, err := procStatFields(pid); err == nil {
+		return fields[0]
+	}
+	output, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	if stat := strings.TrimSpace(string(output)); stat != "" {
+		return stat[:1]
+	}
+	return ""
+}
+
+// processStartTime returns a value identifying when pid started, or "" if it cannot be read
+func processStartTime(pid int) string {
+	if fields, err := procStatFields(pid); err == nil {
+		// starttime is field 22 of /proc/<pid>/stat; fields start at field 3 (state)
+		if len(fields) > 19 {
+			return fields[19]
+		}
+		return ""
+	} else if !os.IsNotExist(err) {
+		return ""
+	}
+	output, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// confirmKilled waits up to timeout for a process sent SIGKILL to be reaped. A process that is
+// still present is recorded as stuck and reported with a *StuckProcessError.
+func (m *Manager) confirmKilled(sessionID, processID, command string, pid int, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultKillTimeout
+	}
+	if m.waitForProcessExit(pid, timeout) {
+		return nil
+	}
+
+	state := processState(pid)
+	now := time.Now()
+	stuck := StuckProcess{
+		SessionID:        sessionID,
+		ProcessID:        processID,
+		Command:          command,
+		PID:              pid,
+		State:            state,
+		StateDescription: describeProcessState(state),
+		DetectedAt:       now,
+		LastAttemptAt:    now,
+		KillAttempts:     1,
+		startTime:        processStartTime(pid),
+	}
+
+	s := &m.stuck
+	s.mu.Lock()
+	if s.byID == nil {
+		s.byID = make(map[string]*StuckProcess)
+	}
+	recorded := stuck
+	s.byID[processID] = &recorded
+	s.mu.Unlock()
+
+	m.logger.Warn("Process did not exit after SIGKILL", map[string]interface{}{
+		"session_id": sessionID,
+		"process_id": processID,
+		"pid":        pid,
+		"state":      state,
+		"timeout":    timeout.String(),
+	})
+
+	return &StuckProcessError{Process: stuck, Timeout: timeout}
+}
+
+// StuckProcesses returns the processes that survived SIGKILL and have not been reaped yet,
+// oldest first
+func (m *Manager) StuckProcesses() []StuckProcess {
+	s := &m.stuck
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]StuckProcess, 0, len(s.byID))
+	for _, stuck := range s.byID {
+		list = append(list, *stuck)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DetectedAt.Before(list[j].DetectedAt)
+	})
+	return list
+}
+
+// ReapStuckProcesses sends SIGKILL again to every stuck process and forgets those that have
+// exited (or whose PID now belongs to another process). It returns how many were reaped.
+func (m *Manager) ReapStuckProcesses() int {
+	s := &m.stuck
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reaped := 0
+	for processID, stuck := range s.byID {
+		if !m.stuckProcessPresent(stuck) {
+			delete(s.byID, processID)
+			reaped++
+			m.logger.Info("Stuck process has exited", map[string]interface{}{
+				"session_id":    stuck.SessionID,
+				"process_id":    processID,
+				"pid":           stuck.PID,
+				"kill_attempts": stuck.KillAttempts,
+				"stuck_for":     time.Since(stuck.DetectedAt).Round(time.Second).String(),
+			})
+			continue
+		}
+
+		// Signal the group too; with no group led by the PID the call simply fails
+		killProcessGroup(stuck.PID, syscall.SIGKILL)
+		signalPID(stuck.PID, syscall.SIGKILL)
+		stuck.KillAttempts++
+		stuck.LastAttemptAt = time.Now()
+		stuck.State = processState(stuck.PID)
+		stuck.StateDescription = describeProcessState(stuck.State)
+	}
+	return reaped
+}
+
+// stuckProcessPresent reports whether the stuck process still exists as the same process
+func (m *Manager) stuckProcessPresent(stuck *StuckProcess) bool {
+	if err := signalPID(stuck.PID, 0); err == syscall.ESRCH {
+		return false
+	}
+	return stuck.startTime == "" || processStartTime(stuck.PID) == stuck.startTime
+}
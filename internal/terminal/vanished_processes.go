@@ -0,0 +1,127 @@
+package terminal
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/rama-kairi/go-term/internal/monitoring"
+)
+
+// VanishedProcess describes a background process still marked running whose PID no longer
+// exists, meaning its exit was never recorded
+type VanishedProcess struct {
+	SessionID string `json:"session_id"`
+	ProcessID string `json:"process_id"`
+	Command   string `json:"command"`
+	PID       int    `json:"pid"`
+}
+
+// VanishedProcesses returns background processes marked running whose PID no longer exists,
+// ordered by session and process ID
+func (m *Manager) VanishedProcesses() []VanishedProcess {
+	type candidate struct {
+		process *BackgroundProcess
+		info    VanishedProcess
+	}
+
+	var candidates []candidate
+	m.mutex.RLock()
+	for sessionID, session := range m.sessions {
+		session.mutex.RLock()
+		for _, process := range session.BackgroundProcesses {
+			process.Mutex.RLock()
+			if process.IsRunning && process.PID > 0 {
+				candidates = append(candidates, candidate{process, VanishedProcess{
+					SessionID: sessionID,
+					ProcessID: process.ID,
+					Command:   process.Command,
+					PID:       process.PID,
+				}})
+			}
+			process.Mutex.RUnlock()
+		}
+		session.mutex.RUnlock()
+	}
+	m.mutex.RUnlock()
+
+	vanished := []VanishedProcess{}
+	for _, c := range candidates {
+		if err := signalPID(c.info.PID, 0); err != syscall.ESRCH {
+			continue
+		}
+		// A process that has just been reaped is marked stopped right after; only report it if
+		// it is still marked running once its PID is known to be gone
+		c.process.Mutex.RLock()
+		running := c.process.IsRunning && c.process.PID == c.info.PID
+		c.process.Mutex.RUnlock()
+		if running {
+			vanished = append(vanished, c.info)
+		}
+	}
+
+	sort.Slice(vanished, func(i, j int) bool {
+		if vanished[i].SessionID != vanished[j].SessionID {
+			return vanished[i].SessionID < vanished[j].SessionID
+		}
+		return vanished[i].ProcessID < vanished[j].ProcessID
+	})
+	return vanished
+}
+
+// ReapVanishedProcesses marks background processes whose PID no longer exists as stopped, with
+// exit reason vanished and an unknown exit code, and notes it at the end of their output. This
+// happens when the goroutine waiting on a process never returns, e.g. because a child it left
+// behind still holds its output pipes. It returns the processes it marked.
+func (m *Manager) ReapVanishedProcesses() []VanishedProcess {
+	reaped := []VanishedProcess{}
+	for _, info := range m.VanishedProcesses() {
+		process, err := m.GetBackgroundProcess(info.SessionID, info.ProcessID)
+		if err != nil {
+			continue
+		}
+
+		process.Mutex.Lock()
+		if !process.IsRunning || process.PID != info.PID {
+			process.Mutex.Unlock()
+			continue
+		}
+		process.IsRunning = false
+		process.ExitCode = unknownExitCode
+		process.ExitStatus = &ExitStatus{Reason: ExitReasonVanished, ExitCode: unknownExitCode}
+		process.Mutex.Unlock()
+
+		process.UpdateOutput(fmt.Sprintf("\n[process %d is gone but its exit was not observed; exit code unknown]\n", info.PID), m.config.Session.BackgroundOutputLimit)
+
+		m.logger.Warn("Background process vanished", map[string]interface{}{
+			"session_id": info.SessionID,
+			"process_id": info.ProcessID,
+			"pid":        info.PID,
+			"command":    info.Command,
+		})
+		reaped = append(reaped, info)
+	}
+	return reaped
+}
+
+// CheckBackgroundProcessHealth reports background processes marked running whose PID no longer
+// exists as degraded, with the affected sessions and processes in the details
+func (m *Manager) CheckBackgroundProcessHealth() monitoring.ComponentHealth {
+	vanished := m.VanishedProcesses()
+	if len(vanished) == 0 {
+		return monitoring.ComponentHealth{Status: "healthy"}
+	}
+
+	sessions := make(map[string][]string)
+	for _, process := range vanished {
+		sessions[process.SessionID] = append(sessions[process.SessionID], process.ProcessID)
+	}
+	return monitoring.ComponentHealth{
+		Status:  "degraded",
+		Message: fmt.Sprintf("%d background process(es) in %d session(s) are marked running but their PID no longer exists", len(vanished), len(sessions)),
+		Details: map[string]interface{}{
+			"vanished_processes": vanished,
+			"sessions":           sessions,
+		},
+	}
+}
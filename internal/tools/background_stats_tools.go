@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// GetBackgroundProcessStatsArgs represents arguments for summarizing background processes
+type GetBackgroundProcessStatsArgs struct {
+	SessionID string `json:"session_id,omitempty" jsonschema:"description=Optional: Only count processes of this session. Leave empty for the whole server."`
+	ProjectID string `json:"project_id,omitempty" jsonschema:"description=Optional: Only count processes of sessions in this project. Leave empty for the whole server."`
+}
+
+// LongestRunningProcess is the running background process that started first
+type LongestRunningProcess struct {
+	ProcessID string `json:"process_id"`
+	SessionID string `json:"session_id"`
+	Command   string `json:"command"`
+	PID       int    `json:"pid"`
+	StartTime string `json:"start_time"`
+	Uptime    string `json:"uptime"`
+}
+
+// SessionBackgroundCapacity is how much of max_background_processes a session uses. Completed
+// processes count until they are cleaned up, as they do when a new process is started.
+type SessionBackgroundCapacity struct {
+	SessionID    string  `json:"session_id"`
+	SessionName  string  `json:"session_name"`
+	ProjectID    string  `json:"project_id"`
+	Processes    int     `json:"processes"` // Tracked processes, running or completed
+	Running      int     `json:"running"`
+	Limit        int     `json:"limit"`
+	Available    int     `json:"available"`     // Processes that can start before the limit is reached
+	UsagePercent float64 `json:"usage_percent"` // Processes as a percentage of the limit
+	AtLimit      bool    `json:"at_limit"`
+}
+
+// GetBackgroundProcessStatsResult is a server-wide summary of background processes
+type GetBackgroundProcessStatsResult struct {
+	TotalCount     int                         `json:"total_count"`
+	RunningCount   int                         `json:"running_count"`
+	CompletedCount int                         `json:"completed_count"`
+	SessionCount   int                         `json:"session_count"` // Sessions with at least one process
+	ProjectCount   int                         `json:"project_count"`
+	ProjectStats   map[string]int              `json:"project_stats"`
+	OutputBytes    int64                       `json:"output_bytes"` // Captured stdout and stderr held in memory
+	LongestRunning *LongestRunningProcess      `json:"longest_running,omitempty"`
+	Sessions       []SessionBackgroundCapacity `json:"sessions"` // Fullest first
+	SessionLimit   int                         `json:"session_limit"`
+	Summary        string                      `json:"summary"`
+}
+
+// GetBackgroundProcessStats summarizes background processes across sessions: running and completed
+// counts, the longest-running process, the output held in memory and how close each session is
+// to max_background_processes
+func (t *TerminalTools) GetBackgroundProcessStats(ctx context.Context, req *mcp.CallToolRequest, args GetBackgroundProcessStatsArgs) (*mcp.CallToolResult, GetBackgroundProcessStatsResult, error) {
+	allSessionProcesses, err := t.manager.GetAllBackgroundProcesses(args.SessionID, args.ProjectID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to get background processes: %v", err)), GetBackgroundProcessStatsResult{}, nil
+	}
+
+	limit := t.config.Session.MaxBackgroundProcesses
+	result := GetBackgroundProcessStatsResult{
+		ProjectStats: make(map[string]int),
+		Sessions:     []SessionBackgroundCapacity{},
+		SessionLimit: limit,
+	}
+	var longestStart time.Time
+
+	for sessionID, processes := range allSessionProcesses {
+		session, err := t.manager.GetSession(sessionID)
+		if err != nil {
+			continue // Deleted since the processes were collected
+		}
+
+		capacity := SessionBackgroundCapacity{
+			SessionID:   session.ID,
+			SessionName: session.Name,
+			ProjectID:   session.ProjectID,
+			Processes:   len(processes),
+			Limit:       limit,
+		}
+		for processID, bgProcess := range processes {
+			bgProcess.Mutex.RLock()
+			result.OutputBytes += int64(len(bgProcess.Output) + len(bgProcess.ErrorOutput))
+			if bgProcess.IsRunning {
+				capacity.Running++
+				if result.LongestRunning == nil || bgProcess.StartTime.Before(longestStart) {
+					longestStart = bgProcess.StartTime
+					result.LongestRunning = &LongestRunningProcess{
+						ProcessID: processID,
+						SessionID: session.ID,
+						Command:   bgProcess.Command,
+						PID:       bgProcess.PID,
+						StartTime: bgProcess.StartTime.Format(time.RFC3339),
+					}
+				}
+			}
+			bgProcess.Mutex.RUnlock()
+		}
+
+		if limit > 0 {
+			capacity.Available = max(limit-capacity.Processes, 0)
+			capacity.UsagePercent = float64(capacity.Processes) * 100 / float64(limit)
+			capacity.AtLimit = capacity.Processes >= limit
+		}
+		result.Sessions = append(result.Sessions, capacity)
+		result.TotalCount += capacity.Processes
+		result.RunningCount += capacity.Running
+		result.ProjectStats[session.ProjectID] += capacity.Processes
+	}
+
+	if result.LongestRunning != nil {
+		result.LongestRunning.Uptime = time.Since(longestStart).Round(time.Second).String()
+	}
+	sort.Slice(result.Sessions, func(i, j int) bool {
+		a, b := result.Sessions[i], result.Sessions[j]
+		if a.Processes != b.Processes {
+			return a.Processes > b.Processes
+		}
+		return a.SessionID < b.SessionID
+	})
+
+	result.CompletedCount = result.TotalCount - result.RunningCount
+	result.SessionCount = len(result.Sessions)
+	result.ProjectCount = len(result.ProjectStats)
+	result.Summary = fmt.Sprintf("Total: %d processes (%d running, %d completed) across %d sessions and %d projects, %d bytes of output held",
+		result.TotalCount, result.RunningCount, result.CompletedCount, result.SessionCount, result.ProjectCount, result.OutputBytes)
+	if len(result.Sessions) > 0 && result.Sessions[0].AtLimit {
+		result.Summary += fmt.Sprintf("; session %s is at the limit of %d", result.Sessions[0].SessionID, limit)
+	}
+
+	return createJSONResult(result), result, nil
+}
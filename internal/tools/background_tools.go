@@ -2,10 +2,16 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // CheckBackgroundProcess checks the output and status of background processes for agents
@@ -15,6 +21,17 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 		"process_id": args.ProcessID,
 	})
 
+	if args.HeadLines < 0 || args.TailLines < 0 {
+		return createErrorResult("head_lines and tail_lines cannot be negative"), CheckBackgroundProcessResult{}, nil
+	}
+	if args.HeadLines > 0 && args.TailLines > 0 {
+		return createErrorResult("Specify either head_lines or tail_lines, not both"), CheckBackgroundProcessResult{}, nil
+	}
+	incremental := args.OutputOffset != nil || args.ErrorOutputOffset != nil
+	if incremental && (args.HeadLines > 0 || args.TailLines > 0) {
+		return createErrorResult("output_offset and error_output_offset cannot be combined with head_lines or tail_lines"), CheckBackgroundProcessResult{}, nil
+	}
+
 	// Get the background process directly from session tracking
 	bgProcess, err := t.manager.GetBackgroundProcess(args.SessionID, args.ProcessID)
 	if err != nil {
@@ -32,6 +49,8 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 			}, nil // Don't return error to allow graceful handling
 	}
 
+	restartPolicy := bgProcess.RestartPolicy()
+
 	// Thread-safe access to background process data
 	bgProcess.Mutex.RLock()
 	processID := bgProcess.ID
@@ -40,10 +59,39 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 	startTime := bgProcess.StartTime
 	isRunning := bgProcess.IsRunning
 	exitCode := bgProcess.ExitCode
-	output := bgProcess.Output
-	errorOutput := bgProcess.ErrorOutput
+	exitStatus := bgProcess.ExitStatus
+	restartCount := bgProcess.RestartCount
+	restarts := append([]terminal.RestartRecord(nil), bgProcess.Restarts...)
+	usesPTY, ptyError := bgProcess.PTY, bgProcess.PTYError
 	bgProcess.Mutex.RUnlock()
 
+	// Output and the offsets it ends at are read together so the next incremental read neither
+	// repeats nor skips anything
+	output, errorOutput, nextOutputOffset, nextErrorOutputOffset := bgProcess.OutputWithOffsets()
+	var outputGapBytes, errorOutputGapBytes int64
+	if incremental {
+		var offset, errorOffset int64
+		if args.OutputOffset != nil {
+			offset = *args.OutputOffset
+		}
+		if args.ErrorOutputOffset != nil {
+			errorOffset = *args.ErrorOutputOffset
+		}
+		chunk, err := bgProcess.ReadOutputSince(terminal.OutputStreamStdout, offset)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Cannot read output since offset: %v", err)), CheckBackgroundProcessResult{}, nil
+		}
+		errorChunk, err := bgProcess.ReadOutputSince(terminal.OutputStreamStderr, errorOffset)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Cannot read error output since offset: %v", err)), CheckBackgroundProcessResult{}, nil
+		}
+		output, nextOutputOffset, outputGapBytes = chunk.Data, chunk.NextOffset, chunk.GapBytes
+		errorOutput, nextErrorOutputOffset, errorOutputGapBytes = errorChunk.Data, errorChunk.NextOffset, errorChunk.GapBytes
+	}
+
+	output, outputLines := sliceOutputLines(output, args.HeadLines, args.TailLines)
+	errorOutput, errorOutputLines := sliceOutputLines(errorOutput, args.HeadLines, args.TailLines)
+
 	// Calculate duration
 	var duration string
 	if isRunning {
@@ -56,7 +104,10 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 	// Determine status
 	status := "running"
 	if !isRunning {
-		if exitCode == 0 {
+		// A restart is counted when scheduled and recorded once the backoff has passed
+		if restartCount > len(restarts) {
+			status = "restarting"
+		} else if exitCode == 0 {
 			status = "completed"
 		} else {
 			status = "failed"
@@ -75,6 +126,30 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 		PID:         pid,
 		Status:      status,
 		LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+
+		OutputLines:      outputLines,
+		ErrorOutputLines: errorOutputLines,
+
+		PTY:      usesPTY,
+		PTYError: ptyError,
+
+		NextOutputOffset:      nextOutputOffset,
+		NextErrorOutputOffset: nextErrorOutputOffset,
+		OutputGapBytes:        outputGapBytes,
+		ErrorOutputGapBytes:   errorOutputGapBytes,
+	}
+	if restartPolicy != nil {
+		result.AutoRestart = true
+		result.RestartCount = restartCount
+		result.MaxRestarts = restartPolicy.MaxRestarts
+		result.Restarts = restarts
+	}
+	if !isRunning && exitStatus != nil {
+		code := exitStatus.ExitCode
+		result.ExitCode = &code
+		result.ExitReason = exitStatus.Reason
+		result.Signal = exitStatus.Signal
+		result.SignalSent = exitStatus.SignalSent
 	}
 
 	// Create response message
@@ -83,13 +158,28 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 		statusMsg = fmt.Sprintf("Background process %s is running (PID: %d). Command: %s", processID[:8], pid, command)
 	} else {
 		statusMsg = fmt.Sprintf("Background process %s has %s with exit code %d. Command: %s", processID[:8], status, exitCode, command)
+		if result.ExitReason != "" {
+			statusMsg += fmt.Sprintf("\nExit reason: %s", result.ExitReason)
+			if result.Signal != "" {
+				statusMsg += fmt.Sprintf(" (%s)", result.Signal)
+			}
+		}
+	}
+	if restartPolicy != nil {
+		statusMsg += fmt.Sprintf("\nAuto-restarts: %d of %d", restartCount, restartPolicy.MaxRestarts)
 	}
 
+	if outputGapBytes > 0 {
+		statusMsg += fmt.Sprintf("\n\n[%d bytes of output were dropped by the output limit before they were read]", outputGapBytes)
+	}
 	if output != "" {
-		statusMsg += fmt.Sprintf("\n\nOutput:\n%s", output)
+		statusMsg += fmt.Sprintf("\n\nOutput%s:\n%s", lineSliceLabel(args.HeadLines, args.TailLines, outputLines), output)
+	}
+	if errorOutputGapBytes > 0 {
+		statusMsg += fmt.Sprintf("\n\n[%d bytes of error output were dropped by the output limit before they were read]", errorOutputGapBytes)
 	}
 	if errorOutput != "" {
-		statusMsg += fmt.Sprintf("\n\nError Output:\n%s", errorOutput)
+		statusMsg += fmt.Sprintf("\n\nError Output%s:\n%s", lineSliceLabel(args.HeadLines, args.TailLines, errorOutputLines), errorOutput)
 	}
 
 	return &mcp.CallToolResult{
@@ -102,10 +192,113 @@ func (t *TerminalTools) CheckBackgroundProcess(ctx context.Context, req *mcp.Cal
 	}, result, nil
 }
 
+// WaitForBackgroundProcess blocks until a background process exits or the timeout elapses, so
+// callers do not have to poll check_background_process
+func (t *TerminalTools) WaitForBackgroundProcess(ctx context.Context, req *mcp.CallToolRequest, args WaitForBackgroundProcessArgs) (*mcp.CallToolResult, WaitForBackgroundProcessResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), WaitForBackgroundProcessResult{}, nil
+	}
+	if err := validateSessionID(args.ProcessID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid process ID: %v", err)), WaitForBackgroundProcessResult{}, nil
+	}
+	if args.HeadLines < 0 || args.TailLines < 0 {
+		return createErrorResult("head_lines and tail_lines cannot be negative"), WaitForBackgroundProcessResult{}, nil
+	}
+	if args.HeadLines > 0 && args.TailLines > 0 {
+		return createErrorResult("Specify either head_lines or tail_lines, not both"), WaitForBackgroundProcessResult{}, nil
+	}
+
+	bgProcess, err := t.manager.GetBackgroundProcess(args.SessionID, args.ProcessID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Background process not found: %v", err)), WaitForBackgroundProcessResult{}, nil
+	}
+	bgProcess.Mutex.RLock()
+	command := bgProcess.Command
+	bgProcess.Mutex.RUnlock()
+
+	timeoutSeconds := runCommandTimeout(args.Timeout)
+	wait, err := t.manager.WaitForBackgroundProcessWithContext(ctx, args.SessionID, args.ProcessID, time.Duration(timeoutSeconds)*time.Second)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to wait for background process: %v", err)), WaitForBackgroundProcessResult{}, nil
+	}
+
+	// The PID changes when an auto-restarting process is restarted, so read it after the wait
+	bgProcess.Mutex.RLock()
+	pid := bgProcess.PID
+	bgProcess.Mutex.RUnlock()
+
+	output, outputLines := sliceOutputLines(wait.Output, args.HeadLines, args.TailLines)
+	errorOutput, errorOutputLines := sliceOutputLines(wait.ErrorOutput, args.HeadLines, args.TailLines)
+
+	result := WaitForBackgroundProcessResult{
+		SessionID:        args.SessionID,
+		ProcessID:        args.ProcessID,
+		Command:          command,
+		PID:              pid,
+		Exited:           wait.Exited,
+		Output:           output,
+		ErrorOutput:      errorOutput,
+		OutputLines:      outputLines,
+		ErrorOutputLines: errorOutputLines,
+		WaitedSeconds:    wait.Waited.Round(time.Millisecond).Seconds(),
+		TimeoutUsed:      timeoutSeconds,
+	}
+	switch {
+	case !wait.Exited:
+		result.Status = "still_running"
+		result.Message = fmt.Sprintf("Background process %s is still running after %d seconds. Call wait_for_background_process again to keep waiting, or terminate_background_process to stop it.", args.ProcessID[:8], timeoutSeconds)
+	case wait.ExitCode == 0:
+		result.Status = "completed"
+		result.ExitCode = wait.ExitCode
+		result.Message = fmt.Sprintf("Background process %s completed with exit code 0", args.ProcessID[:8])
+	default:
+		result.Status = "failed"
+		result.ExitCode = wait.ExitCode
+		result.Message = fmt.Sprintf("Background process %s failed with exit code %d", args.ProcessID[:8], wait.ExitCode)
+	}
+
+	t.logger.Info("Waited for background process", map[string]interface{}{
+		"session_id": args.SessionID,
+		"process_id": args.ProcessID,
+		"status":     result.Status,
+		"waited":     wait.Waited.String(),
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// sliceOutputLines returns the first head or last tail lines of text (the whole text when both
+// are zero) together with the total number of lines in text
+func sliceOutputLines(text string, head, tail int) (string, int) {
+	if text == "" {
+		return "", 0
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	total := len(lines)
+	switch {
+	case head > 0 && head < total:
+		return strings.Join(lines[:head], "\n") + "\n", total
+	case tail > 0 && tail < total:
+		return strings.Join(lines[total-tail:], "\n") + "\n", total
+	}
+	return text, total
+}
+
+// lineSliceLabel describes which lines of an output buffer are shown, or "" when it is shown in full
+func lineSliceLabel(head, tail, total int) string {
+	switch {
+	case head > 0 && head < total:
+		return fmt.Sprintf(" (first %d of %d lines)", head, total)
+	case tail > 0 && tail < total:
+		return fmt.Sprintf(" (last %d of %d lines)", tail, total)
+	}
+	return ""
+}
+
 // RunBackgroundProcess starts a command as a background process with security validation
 func (t *TerminalTools) RunBackgroundProcess(ctx context.Context, req *mcp.CallToolRequest, args RunBackgroundProcessArgs) (*mcp.CallToolResult, RunBackgroundProcessResult, error) {
 	// H2: Check rate limit first
-	if err := t.CheckRateLimit(); err != nil {
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
 		return createErrorResult(err.Error()), RunBackgroundProcessResult{}, nil
 	}
 
@@ -120,17 +313,55 @@ func (t *TerminalTools) RunBackgroundProcess(ctx context.Context, req *mcp.CallT
 		return createErrorResult(fmt.Sprintf("Session not found: %v. Use 'list_terminal_sessions' to see all available sessions.", err)), RunBackgroundProcessResult{}, nil
 	}
 
+	if err := validateCommandText(args.Command, t.config.Security.AllowCommentOnlyCommands); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid command: %v", err)), RunBackgroundProcessResult{}, nil
+	}
+
 	// SECURITY: Validate command before starting background process (C1 fix)
-	if err := t.security.ValidateCommand(args.Command); err != nil {
+	decision := t.evaluateCommandForSession(args.SessionID, args.Command)
+	if !decision.Allowed {
 		t.logger.LogSecurityEvent("blocked_background_command", args.Command, "high", map[string]interface{}{
-			"session_id": args.SessionID,
-			"reason":     err.Error(),
+			"session_id":   args.SessionID,
+			"reason":       decision.Reason,
+			"rule_type":    decision.RuleType,
+			"matched_rule": decision.MatchedRule,
 		})
-		return createErrorResult(fmt.Sprintf("Command blocked by security policy: %v", err)), RunBackgroundProcessResult{}, nil
+		t.recordBlockedCommand(args.SessionID, args.Command, "run_background_process", decision)
+		blockedResult := RunBackgroundProcessResult{SessionID: args.SessionID, ProjectID: session.ProjectID, Command: args.Command, Security: &decision}
+		return createErrorResult(fmt.Sprintf("Command blocked by security policy: %s (rule type: %s)", decision.Reason, decision.RuleType)), blockedResult, nil
+	}
+	t.logSecurityDecision(args.SessionID, args.Command, decision)
+
+	// Reject a bad readiness pattern before anything is started
+	readyPattern := args.WaitForPattern
+	if readyPattern == "" {
+		readyPattern = args.ReadyPattern
+	} else if args.ReadyPattern != "" && args.ReadyPattern != args.WaitForPattern {
+		return createErrorResult("wait_for_pattern and ready_pattern are the same option; give only one"), RunBackgroundProcessResult{}, nil
+	}
+	if readyPattern != "" {
+		if _, err := regexp.Compile(readyPattern); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid wait_for_pattern: %v", err)), RunBackgroundProcessResult{}, nil
+		}
+	}
+
+	var restartPolicy *terminal.RestartPolicy
+	if args.AutoRestart {
+		var err error
+		if restartPolicy, err = t.backgroundRestartPolicy(args); err != nil {
+			return createErrorResult(err.Error()), RunBackgroundProcessResult{}, nil
+		}
+	} else if args.MaxRestarts != 0 || args.RestartBackoffSeconds != 0 {
+		return createErrorResult("max_restarts and restart_backoff_seconds require auto_restart"), RunBackgroundProcessResult{}, nil
+	}
+
+	if err := validateCommandTags(args.Tags); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid tags: %v", err)), RunBackgroundProcessResult{}, nil
 	}
+	tags := terminal.CommandTags(args.Command, args.Tags)
 
 	// Start the background process
-	processID, err := t.manager.ExecuteCommandInBackground(args.SessionID, args.Command)
+	processID, err := t.manager.ExecuteCommandInBackgroundWithOptions(args.SessionID, args.Command, terminal.BackgroundOptions{Restart: restartPolicy, Tags: tags, PTY: args.UsePTY})
 	if err != nil {
 		return createErrorResult(fmt.Sprintf("Failed to start background process: %v", err)), RunBackgroundProcessResult{}, nil
 	}
@@ -148,11 +379,42 @@ func (t *TerminalTools) RunBackgroundProcess(ctx context.Context, req *mcp.CallT
 		ProcessID:         processID,
 		Command:           args.Command,
 		StartTime:         time.Now().Format(time.RFC3339),
-		WorkingDir:        session.WorkingDir,
+		WorkingDir:        session.GetWorkingDir(),
 		Success:           true,
 		Message:           fmt.Sprintf("Background process started successfully. Process ID: %s", processID),
 		BackgroundCount:   backgroundCount,
 		MaxBackgroundProc: t.config.Session.MaxBackgroundProcesses,
+		Security:          &decision,
+		Tags:              tags,
+	}
+	if restartPolicy != nil {
+		result.Message += fmt.Sprintf(" (auto-restart up to %d times, %s backoff)", restartPolicy.MaxRestarts, restartPolicy.Backoff)
+	}
+	if args.UsePTY {
+		result.Message += ". A pseudo-terminal was requested; check_background_process reports whether it is attached"
+	}
+
+	// Optionally wait until the process reports it is ready
+	if readyPattern != "" {
+		timeout := t.readinessTimeout(args.ReadyTimeout)
+		waitStart := time.Now()
+		match, waitErr := t.manager.WaitForOutputPatternWithContext(ctx, args.SessionID, processID, readyPattern, timeout)
+		ready := match != nil && match.Matched
+		result.Ready = &ready
+		result.ReadyWaitTime = time.Since(waitStart).Round(time.Millisecond).String()
+		if ready {
+			result.ReadyMatch = match.Match
+		}
+
+		switch {
+		case ready:
+			result.Message += fmt.Sprintf(". Ready after %s", result.ReadyWaitTime)
+		case waitErr != nil:
+			result.Success = false
+			result.Message += fmt.Sprintf(". Not ready: %v", waitErr)
+		default:
+			result.Message += fmt.Sprintf(". Ready pattern not seen within %s; the process is still running", timeout)
+		}
 	}
 
 	t.logger.Info("Background process started", map[string]interface{}{
@@ -166,6 +428,36 @@ func (t *TerminalTools) RunBackgroundProcess(ctx context.Context, req *mcp.CallT
 	return createJSONResult(result), result, nil
 }
 
+// backgroundRestartPolicy builds the crash-restart policy for a background process from its
+// arguments, applying defaults and the configured minimum uptime
+func (t *TerminalTools) backgroundRestartPolicy(args RunBackgroundProcessArgs) (*terminal.RestartPolicy, error) {
+	if args.MaxRestarts < 0 {
+		return nil, fmt.Errorf("max_restarts cannot be negative")
+	}
+	if args.RestartBackoffSeconds < 0 {
+		return nil, fmt.Errorf("restart_backoff_seconds cannot be negative")
+	}
+
+	maxRestarts := args.MaxRestarts
+	if maxRestarts == 0 {
+		maxRestarts = DefaultMaxRestarts
+	}
+	if maxRestarts > MaxAutoRestarts {
+		maxRestarts = MaxAutoRestarts
+	}
+
+	backoff := args.RestartBackoffSeconds
+	if backoff == 0 {
+		backoff = DefaultRestartBackoff
+	}
+
+	return &terminal.RestartPolicy{
+		MaxRestarts: maxRestarts,
+		Backoff:     time.Duration(backoff) * time.Second,
+		MinUptime:   t.config.Session.RestartMinUptime,
+	}, nil
+}
+
 // ListBackgroundProcesses lists all background processes with filtering options
 func (t *TerminalTools) ListBackgroundProcesses(ctx context.Context, req *mcp.CallToolRequest, args ListBackgroundProcessesArgs) (*mcp.CallToolResult, ListBackgroundProcessesResult, error) {
 	// Get all background processes using the manager method
@@ -190,19 +482,20 @@ func (t *TerminalTools) ListBackgroundProcesses(ctx context.Context, req *mcp.Ca
 			bgProcess.Mutex.RLock()
 
 			processInfo := BackgroundProcessInfo{
-				ProcessID:   processID,
-				SessionID:   session.ID,
-				SessionName: session.Name,
-				ProjectID:   session.ProjectID,
-				Command:     bgProcess.Command,
-				PID:         bgProcess.PID,
-				StartTime:   bgProcess.StartTime.Format(time.RFC3339),
-				Duration:    time.Since(bgProcess.StartTime).String(),
-				IsRunning:   bgProcess.IsRunning,
-				ExitCode:    bgProcess.ExitCode,
-				WorkingDir:  session.WorkingDir,
-				OutputSize:  len(bgProcess.Output),
-				ErrorSize:   len(bgProcess.ErrorOutput),
+				ProcessID:    processID,
+				SessionID:    session.ID,
+				SessionName:  session.Name,
+				ProjectID:    session.ProjectID,
+				Command:      bgProcess.Command,
+				PID:          bgProcess.PID,
+				StartTime:    bgProcess.StartTime.Format(time.RFC3339),
+				Duration:     time.Since(bgProcess.StartTime).String(),
+				IsRunning:    bgProcess.IsRunning,
+				ExitCode:     bgProcess.ExitCode,
+				WorkingDir:   session.GetWorkingDir(),
+				OutputSize:   len(bgProcess.Output),
+				ErrorSize:    len(bgProcess.ErrorOutput),
+				RestartCount: bgProcess.RestartCount,
 			}
 
 			allProcesses = append(allProcesses, processInfo)
@@ -252,6 +545,19 @@ func (t *TerminalTools) TerminateBackgroundProcess(ctx context.Context, req *mcp
 		return createErrorResult(fmt.Sprintf("Invalid process ID: %v", err)), TerminateBackgroundProcessResult{}, nil
 	}
 
+	// Build the signal escalation sequence
+	termConfig := terminal.DefaultGracefulTerminationConfig()
+	if args.GraceSecs > 0 {
+		termConfig.GracePeriod = time.Duration(args.GraceSecs) * time.Second
+	}
+	if len(args.Signals) > 0 {
+		steps, err := terminal.ParseTerminationSteps(args.Signals, termConfig.GracePeriod)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid signals: %v", err)), TerminateBackgroundProcessResult{}, nil
+		}
+		termConfig.Steps = steps
+	}
+
 	// Get the background process info before termination
 	bgProcess, err := t.manager.GetBackgroundProcess(args.SessionID, args.ProcessID)
 	if err != nil {
@@ -268,11 +574,19 @@ func (t *TerminalTools) TerminateBackgroundProcess(ctx context.Context, req *mcp
 	bgProcess.Mutex.RUnlock()
 
 	// Attempt to terminate the process using the manager method
-	err = t.manager.TerminateBackgroundProcess(args.SessionID, args.ProcessID, args.Force)
+	err = t.manager.TerminateBackgroundProcessWithConfig(args.SessionID, args.ProcessID, args.Force, termConfig)
 	terminated := err == nil
 
+	var stuckErr *terminal.StuckProcessError
+	stuck := errors.As(err, &stuckErr)
+	state := ""
+
 	message := ""
-	if terminated {
+	if stuck {
+		state = formatProcessState(stuckErr.Process)
+		message = fmt.Sprintf("Background process %s (PID: %d) did not exit within %s of SIGKILL and is stuck in state %s. It is no longer tracked by the session; cleanup will keep trying to kill and reap it.",
+			args.ProcessID[:8], pid, stuckErr.Timeout, state)
+	} else if terminated {
 		if args.Force {
 			message = fmt.Sprintf("Force killed background process %s (PID: %d)", args.ProcessID[:8], pid)
 		} else {
@@ -290,6 +604,9 @@ func (t *TerminalTools) TerminateBackgroundProcess(ctx context.Context, req *mcp
 		WasRunning:  wasRunning,
 		Terminated:  terminated,
 		Force:       args.Force,
+		Signals:     args.Signals,
+		Stuck:       stuck,
+		State:       state,
 		Message:     message,
 		FinalOutput: finalOutput,
 		FinalError:  finalError,
@@ -300,8 +617,172 @@ func (t *TerminalTools) TerminateBackgroundProcess(ctx context.Context, req *mcp
 		"process_id":  args.ProcessID,
 		"was_running": wasRunning,
 		"terminated":  terminated,
+		"stuck":       stuck,
 		"force":       args.Force,
 	})
 
 	return createJSONResult(result), result, nil
 }
+
+// RestartBackgroundProcess terminates a background process and relaunches its command under the
+// same process ID, in the directory and with the environment it ran with
+func (t *TerminalTools) RestartBackgroundProcess(ctx context.Context, req *mcp.CallToolRequest, args RestartBackgroundProcessArgs) (*mcp.CallToolResult, RestartBackgroundProcessResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), RestartBackgroundProcessResult{}, nil
+	}
+	if err := validateSessionID(args.ProcessID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid process ID: %v", err)), RestartBackgroundProcessResult{}, nil
+	}
+
+	// The relaunched command is checked against the current policy like any new command
+	bgProcess, err := t.manager.GetBackgroundProcess(args.SessionID, args.ProcessID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Background process not found: %v", err)), RestartBackgroundProcessResult{}, nil
+	}
+	bgProcess.Mutex.RLock()
+	command := bgProcess.Command
+	bgProcess.Mutex.RUnlock()
+	if decision := t.evaluateCommandForSession(args.SessionID, command); !decision.Allowed {
+		t.recordBlockedCommand(args.SessionID, command, "restart_background_process", decision)
+		return createErrorResult(fmt.Sprintf("Command blocked by security policy: %s (rule type: %s)", decision.Reason, decision.RuleType)), RestartBackgroundProcessResult{}, nil
+	}
+
+	restart, err := t.manager.RestartBackgroundProcess(args.SessionID, args.ProcessID, args.Force)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to restart background process: %v", err)), RestartBackgroundProcessResult{}, nil
+	}
+
+	result := RestartBackgroundProcessResult{
+		SessionID: args.SessionID,
+		ProcessID: restart.ProcessID,
+		Command:   restart.Command,
+		OldPID:    restart.OldPID,
+		NewPID:    restart.NewPID,
+		StartTime: restart.StartTime.Format(time.RFC3339),
+		Force:     args.Force,
+		Message:   fmt.Sprintf("Restarted background process %s (PID %d -> %d)", restart.ProcessID[:8], restart.OldPID, restart.NewPID),
+	}
+	if restart.OldPID == 0 {
+		result.Message = fmt.Sprintf("Background process %s had exited; relaunched with PID %d", restart.ProcessID[:8], restart.NewPID)
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// formatProcessState describes a stuck process's state, e.g. "D (uninterruptible sleep (usually I/O))"
+func formatProcessState(proc terminal.StuckProcess) string {
+	if proc.State == "" {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s)", proc.State, proc.StateDescription)
+}
+
+// ArchiveBackgroundProcessArgs represents arguments for archiving a background process's output
+type ArchiveBackgroundProcessArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session containing the background process."`
+	ProcessID string `json:"process_id" jsonschema:"required,description=The UUID4 identifier of the background process to archive."`
+	Remove    bool   `json:"remove,omitempty" jsonschema:"description=Remove the process from the active list while leaving it running. Default: false."`
+	Terminate bool   `json:"terminate,omitempty" jsonschema:"description=Terminate the process after archiving its output. Default: false."`
+	Force     bool   `json:"force,omitempty" jsonschema:"description=With terminate, force kill (SIGKILL) instead of terminating gracefully."`
+}
+
+// ArchiveBackgroundProcessResult represents the result of archiving a background process
+type ArchiveBackgroundProcessResult struct {
+	SessionID   string `json:"session_id"`
+	ProcessID   string `json:"process_id"`
+	Command     string `json:"command"`
+	PID         int    `json:"pid"`
+	ArchivePath string `json:"archive_path"` // File holding the archived stdout and stderr
+	OutputBytes int    `json:"output_bytes"`
+	IsRunning   bool   `json:"is_running"` // Whether the process is still running after archiving
+	Removed     bool   `json:"removed"`    // No longer listed or managed by the session
+	Terminated  bool   `json:"terminated"`
+	Message     string `json:"message"`
+}
+
+// ArchiveBackgroundProcess snapshots a background process's output to a file and optionally stops
+// tracking or terminates it, separating "done watching" from "kill it"
+func (t *TerminalTools) ArchiveBackgroundProcess(ctx context.Context, req *mcp.CallToolRequest, args ArchiveBackgroundProcessArgs) (*mcp.CallToolResult, ArchiveBackgroundProcessResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), ArchiveBackgroundProcessResult{}, nil
+	}
+	if err := validateSessionID(args.ProcessID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid process ID: %v", err)), ArchiveBackgroundProcessResult{}, nil
+	}
+	if args.Force && !args.Terminate {
+		return createErrorResult("force only applies together with terminate"), ArchiveBackgroundProcessResult{}, nil
+	}
+
+	bgProcess, err := t.manager.GetBackgroundProcess(args.SessionID, args.ProcessID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Background process not found: %v", err)), ArchiveBackgroundProcessResult{}, nil
+	}
+
+	bgProcess.Mutex.RLock()
+	command := bgProcess.Command
+	pid := bgProcess.PID
+	startTime := bgProcess.StartTime
+	output := bgProcess.Output
+	errorOutput := bgProcess.ErrorOutput
+	bgProcess.Mutex.RUnlock()
+
+	archivedAt := time.Now()
+	archiveDir := filepath.Join(t.config.Database.DataDir, "archives", args.SessionID)
+	archivePath := filepath.Join(archiveDir, fmt.Sprintf("%s-%s.log", args.ProcessID, archivedAt.Format("20060102-150405")))
+	var archive strings.Builder
+	fmt.Fprintf(&archive, "# command: %s\n# pid: %d\n# started: %s\n# archived: %s\n\n## stdout\n%s\n## stderr\n%s",
+		command, pid, startTime.Format(time.RFC3339), archivedAt.Format(time.RFC3339), output, errorOutput)
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to create archive directory: %v", err)), ArchiveBackgroundProcessResult{}, nil
+	}
+	if err := os.WriteFile(archivePath, []byte(archive.String()), 0o644); err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to write archive: %v", err)), ArchiveBackgroundProcessResult{}, nil
+	}
+
+	result := ArchiveBackgroundProcessResult{
+		SessionID:   args.SessionID,
+		ProcessID:   args.ProcessID,
+		Command:     command,
+		PID:         pid,
+		ArchivePath: archivePath,
+		OutputBytes: len(output) + len(errorOutput),
+	}
+
+	switch {
+	case args.Terminate:
+		if err := t.manager.TerminateBackgroundProcess(args.SessionID, args.ProcessID, args.Force); err != nil {
+			return createErrorResult(fmt.Sprintf("Output archived to %s but termination failed: %v", archivePath, err)), result, nil
+		}
+		result.Terminated = true
+		result.Removed = true
+	case args.Remove:
+		if _, err := t.manager.DetachBackgroundProcess(args.SessionID, args.ProcessID); err != nil {
+			return createErrorResult(fmt.Sprintf("Output archived to %s but the process could not be removed: %v", archivePath, err)), result, nil
+		}
+		result.Removed = true
+	}
+
+	bgProcess.Mutex.RLock()
+	result.IsRunning = bgProcess.IsRunning
+	bgProcess.Mutex.RUnlock()
+
+	switch {
+	case result.Terminated:
+		result.Message = fmt.Sprintf("Archived output of process %s to %s and terminated it", args.ProcessID[:8], archivePath)
+	case result.Removed && result.IsRunning:
+		result.Message = fmt.Sprintf("Archived output of process %s to %s; it keeps running untracked as PID %d", args.ProcessID[:8], archivePath, pid)
+	default:
+		result.Message = fmt.Sprintf("Archived output of process %s to %s", args.ProcessID[:8], archivePath)
+	}
+
+	t.logger.Info("Background process archived", map[string]interface{}{
+		"session_id":   args.SessionID,
+		"process_id":   args.ProcessID,
+		"archive_path": archivePath,
+		"removed":      result.Removed,
+		"terminated":   result.Terminated,
+		"is_running":   result.IsRunning,
+	})
+
+	return createJSONResult(result), result, nil
+}
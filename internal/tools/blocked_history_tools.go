@@ -0,0 +1,162 @@
+// Package tools provides MCP tool handlers for reviewing blocked command history
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// --- Blocked History Types ---
+
+// BlockedCommandEntry is one command attempt rejected by the security policy
+type BlockedCommandEntry struct {
+	SessionID   string `json:"session_id"`
+	Command     string `json:"command"`
+	Source      string `json:"source"`
+	RuleType    string `json:"rule_type"`
+	MatchedRule string `json:"matched_rule,omitempty"`
+	Reason      string `json:"reason"`
+	Timestamp   string `json:"timestamp"` // RFC3339 formatted string
+}
+
+// GetBlockedCommandHistoryArgs represents arguments for listing blocked command attempts
+type GetBlockedCommandHistoryArgs struct {
+	SessionID string `json:"session_id,omitempty" jsonschema:"description=Only return attempts from this session (default: all sessions)"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"description=Maximum number of attempts to return, newest first (default: 50, max: 500)"`
+}
+
+// GetBlockedCommandHistoryResult represents recent blocked command attempts
+type GetBlockedCommandHistoryResult struct {
+	SessionID      string                `json:"session_id,omitempty"`
+	Blocked        []BlockedCommandEntry `json:"blocked"`
+	Count          int                   `json:"count"`
+	RuleTypeCounts map[string]int        `json:"rule_type_counts"`
+	RetentionLimit int                   `json:"retention_limit"` // Attempts kept in total; 0 means recording is disabled
+	Message        string                `json:"message"`
+}
+
+// ClearBlockedHistoryArgs represents arguments for clearing blocked command history
+type ClearBlockedHistoryArgs struct {
+	SessionID string `json:"session_id,omitempty" jsonschema:"description=Only clear attempts from this session (default: clear all)"`
+}
+
+// ClearBlockedHistoryResult represents the result of clearing blocked command history
+type ClearBlockedHistoryResult struct {
+	SessionID string `json:"session_id,omitempty"`
+	Cleared   int64  `json:"cleared"`
+	Message   string `json:"message"`
+}
+
+// recordBlockedCommand persists a blocked attempt so policy can be tuned later. Failures are
+// logged rather than returned; the command is blocked either way.
+func (t *TerminalTools) recordBlockedCommand(sessionID, command, source string, decision SecurityDecision) {
+	if t.database == nil || t.config.Security.BlockedHistoryLimit <= 0 {
+		return
+	}
+
+	record := &database.BlockedCommandRecord{
+		SessionID:   sessionID,
+		Command:     command,
+		Source:      source,
+		RuleType:    decision.RuleType,
+		MatchedRule: decision.MatchedRule,
+		Reason:      decision.Reason,
+	}
+	if err := t.database.RecordBlockedCommand(record, t.config.Security.BlockedHistoryLimit); err != nil {
+		t.logger.Warn("Failed to record blocked command", map[string]interface{}{
+			"session_id": sessionID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// --- MCP Tool Handlers ---
+
+// GetBlockedCommandHistory returns recent command attempts blocked by the security policy
+func (t *TerminalTools) GetBlockedCommandHistory(ctx context.Context, req *mcp.CallToolRequest, args GetBlockedCommandHistoryArgs) (*mcp.CallToolResult, GetBlockedCommandHistoryResult, error) {
+	if t.database == nil {
+		return createErrorResult("Blocked command history is not available: database is not configured"), GetBlockedCommandHistoryResult{}, nil
+	}
+
+	if args.SessionID != "" {
+		if err := validateSessionID(args.SessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetBlockedCommandHistoryResult{}, nil
+		}
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultBlockedHistoryLimit
+	}
+	if limit > MaxBlockedHistoryLimit {
+		limit = MaxBlockedHistoryLimit
+	}
+
+	records, err := t.database.GetBlockedCommands(args.SessionID, limit)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to get blocked command history: %v", err)), GetBlockedCommandHistoryResult{}, nil
+	}
+
+	result := GetBlockedCommandHistoryResult{
+		SessionID:      args.SessionID,
+		Blocked:        make([]BlockedCommandEntry, 0, len(records)),
+		RuleTypeCounts: make(map[string]int),
+		RetentionLimit: t.config.Security.BlockedHistoryLimit,
+	}
+	for _, record := range records {
+		result.Blocked = append(result.Blocked, BlockedCommandEntry{
+			SessionID:   record.SessionID,
+			Command:     record.Command,
+			Source:      record.Source,
+			RuleType:    record.RuleType,
+			MatchedRule: record.MatchedRule,
+			Reason:      record.Reason,
+			Timestamp:   record.Timestamp.Format(time.RFC3339),
+		})
+		result.RuleTypeCounts[record.RuleType]++
+	}
+	result.Count = len(result.Blocked)
+	result.Message = fmt.Sprintf("Found %d blocked command attempts", result.Count)
+
+	return createJSONResult(result), result, nil
+}
+
+// ClearBlockedHistory deletes recorded blocked command attempts
+func (t *TerminalTools) ClearBlockedHistory(ctx context.Context, req *mcp.CallToolRequest, args ClearBlockedHistoryArgs) (*mcp.CallToolResult, ClearBlockedHistoryResult, error) {
+	// H2: Check rate limit
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), ClearBlockedHistoryResult{}, nil
+	}
+
+	if t.database == nil {
+		return createErrorResult("Blocked command history is not available: database is not configured"), ClearBlockedHistoryResult{}, nil
+	}
+
+	if args.SessionID != "" {
+		if err := validateSessionID(args.SessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), ClearBlockedHistoryResult{}, nil
+		}
+	}
+
+	cleared, err := t.database.ClearBlockedCommands(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to clear blocked command history: %v", err)), ClearBlockedHistoryResult{}, nil
+	}
+
+	t.logger.LogSecurityEvent("blocked_history_cleared", fmt.Sprintf("Cleared %d blocked command records", cleared), "low", map[string]interface{}{
+		"session_id": args.SessionID,
+		"cleared":    cleared,
+	})
+
+	result := ClearBlockedHistoryResult{
+		SessionID: args.SessionID,
+		Cleared:   cleared,
+		Message:   fmt.Sprintf("Cleared %d blocked command attempts", cleared),
+	}
+
+	return createJSONResult(result), result, nil
+}
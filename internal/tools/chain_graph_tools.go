@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Chain graph output formats
+const (
+	ChainGraphFormatJSON = "json"
+	ChainGraphFormatDOT  = "dot"
+)
+
+// GetProcessChainGraphArgs represents arguments for exporting a process chain as a graph
+type GetProcessChainGraphArgs struct {
+	ChainID string `json:"chain_id" jsonschema:"required,description=Chain ID to export"`
+	Format  string `json:"format,omitempty" jsonschema:"description=Output format: json (adjacency list, the default) or dot (Graphviz DOT source in addition to the adjacency list)"`
+}
+
+// ChainGraphNode is one step of a process chain
+type ChainGraphNode struct {
+	ID           string   `json:"id"`
+	Index        int      `json:"index"`
+	Name         string   `json:"name"`
+	Command      string   `json:"command"`
+	DependsOn    []string `json:"depends_on"` // Nodes that must be ready before this one starts
+	Readiness    string   `json:"readiness"`  // What makes the step ready for the steps that depend on it
+	ReadyPattern string   `json:"ready_pattern,omitempty"`
+	ReadyTimeout int      `json:"ready_timeout,omitempty"`
+	WaitSeconds  int      `json:"wait_seconds,omitempty"`
+	Status       string   `json:"status"`
+	ProcessID    string   `json:"process_id,omitempty"` // Set once the step has started
+}
+
+// ChainGraphEdge is a dependency between two chain steps
+type ChainGraphEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition"` // Readiness of From that To waits for
+}
+
+// GetProcessChainGraphResult is a process chain as a dependency graph
+type GetProcessChainGraphResult struct {
+	ChainID   string           `json:"chain_id"`
+	Name      string           `json:"name"`
+	SessionID string           `json:"session_id"`
+	Status    string           `json:"status"`
+	Started   bool             `json:"started"`
+	Nodes     []ChainGraphNode `json:"nodes"`
+	Edges     []ChainGraphEdge `json:"edges"`
+	DOT       string           `json:"dot,omitempty"`
+}
+
+// GetProcessChainGraph exports a process chain's steps as a dependency graph, so the chain can be
+// reviewed before it runs. Each step waits for the steps in its depends_on to be ready, or, in a
+// chain without depends_on, for its predecessor. Once the chain has started each node carries its
+// current status and process ID.
+func (t *TerminalTools) GetProcessChainGraph(ctx context.Context, req *mcp.CallToolRequest, args GetProcessChainGraphArgs) (*mcp.CallToolResult, GetProcessChainGraphResult, error) {
+	if args.Format == "" {
+		args.Format = ChainGraphFormatJSON
+	}
+	if args.Format != ChainGraphFormatJSON && args.Format != ChainGraphFormatDOT {
+		return createErrorResult(fmt.Sprintf("Invalid format '%s'. Valid values: %s, %s", args.Format, ChainGraphFormatJSON, ChainGraphFormatDOT)), GetProcessChainGraphResult{}, nil
+	}
+
+	chain, exists := t.dependencyManager.ChainSnapshot(args.ChainID)
+	if !exists {
+		return createErrorResult(fmt.Sprintf("Chain not found: %s", args.ChainID)), GetProcessChainGraphResult{}, nil
+	}
+
+	// Validated when the chain was created
+	deps, _ := chainDependencies(chain.Processes)
+
+	result := GetProcessChainGraphResult{
+		ChainID:   chain.ID,
+		Name:      chain.Name,
+		SessionID: chain.SessionID,
+		Status:    chain.Status,
+		Started:   chain.Status != "pending",
+		Nodes:     make([]ChainGraphNode, len(chain.Processes)),
+		Edges:     []ChainGraphEdge{},
+	}
+	for i, proc := range chain.Processes {
+		node := ChainGraphNode{
+			ID:           chainNodeID(i),
+			Index:        i,
+			Name:         proc.Name,
+			Command:      proc.Command,
+			DependsOn:    []string{},
+			Readiness:    chainStepReadiness(proc, t.readinessTimeout(proc.ReadyTimeout).String()),
+			ReadyPattern: proc.ReadyPattern,
+			ReadyTimeout: proc.ReadyTimeout,
+			WaitSeconds:  proc.WaitSeconds,
+			Status:       proc.Status,
+			ProcessID:    proc.ProcessID,
+		}
+		result.Nodes[i] = node
+	}
+	for i, stepDeps := range deps {
+		for _, j := range stepDeps {
+			dep := result.Nodes[j]
+			result.Nodes[i].DependsOn = append(result.Nodes[i].DependsOn, dep.ID)
+			result.Edges = append(result.Edges, ChainGraphEdge{From: dep.ID, To: result.Nodes[i].ID, Condition: dep.Readiness})
+		}
+	}
+
+	if args.Format == ChainGraphFormatDOT {
+		result.DOT = chainGraphDOT(result)
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// chainNodeID names the node of chain step i; step names need not be unique
+func chainNodeID(i int) string {
+	return fmt.Sprintf("step%d", i)
+}
+
+// chainStepReadiness describes what a chain step must reach before the steps that depend on it
+// start, in the order startChainProcess checks it
+func chainStepReadiness(proc ChainedProcess, readyTimeout string) string {
+	var conditions []string
+	if proc.ReadyPattern != "" {
+		conditions = append(conditions, fmt.Sprintf("output matches %q within %s", proc.ReadyPattern, readyTimeout))
+	}
+	if proc.WaitSeconds > 0 {
+		conditions = append(conditions, fmt.Sprintf("%ds elapsed", proc.WaitSeconds))
+	}
+	conditions = append(conditions, "still running")
+	return strings.Join(conditions, ", then ")
+}
+
+// chainGraphDOT renders a chain graph as Graphviz DOT source
+func chainGraphDOT(graph GetProcessChainGraphResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(graph.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%d: %s\n%s\n[%s]", node.Index, node.Name, node.Command, node.Status)
+		fmt.Fprintf(&b, "  %s [label=%s];\n", node.ID, dotQuote(label))
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", edge.From, edge.To, dotQuote(edge.Condition))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes s as a DOT string, escaping quotes, backslashes and newlines
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,106 @@
+// Package tools provides MCP tool handlers for per-session command aliases
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+// --- Command Alias Types ---
+
+// SetCommandAliasArgs represents arguments for defining or removing a session command alias
+type SetCommandAliasArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The session to define the alias in"`
+	Name      string `json:"name" jsonschema:"required,description=Alias name: a single word such as gs"`
+	Command   string `json:"command,omitempty" jsonschema:"description=What the alias expands to, e.g. git status. Leave empty to remove the alias."`
+}
+
+// ListCommandAliasesArgs represents arguments for listing a session's command aliases
+type ListCommandAliasesArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The session whose aliases to list"`
+}
+
+// CommandAliasesResult represents the result of command alias operations
+type CommandAliasesResult struct {
+	Success   bool                    `json:"success"`
+	SessionID string                  `json:"session_id"`
+	Operation string                  `json:"operation"`
+	Aliases   []terminal.CommandAlias `json:"aliases"`
+	Count     int                     `json:"count"`
+	Message   string                  `json:"message,omitempty"`
+}
+
+// --- MCP Tool Handlers ---
+
+// SetCommandAlias defines, replaces or removes a command alias in a session. run_command expands
+// an alias at the start of a command before the command is validated.
+func (t *TerminalTools) SetCommandAlias(ctx context.Context, req *mcp.CallToolRequest, args SetCommandAliasArgs) (*mcp.CallToolResult, CommandAliasesResult, error) {
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), CommandAliasesResult{Operation: "set", Message: err.Error()}, nil
+	}
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), CommandAliasesResult{Operation: "set"}, nil
+	}
+	if len(args.Command) > t.config.Session.MaxCommandLength {
+		msg := fmt.Sprintf("alias command is too long: %d characters (max %d)", len(args.Command), t.config.Session.MaxCommandLength)
+		return createErrorResult(msg), CommandAliasesResult{SessionID: args.SessionID, Operation: "set", Message: msg}, nil
+	}
+
+	aliases, err := t.manager.SetSessionAlias(args.SessionID, args.Name, args.Command)
+	if err != nil {
+		result := CommandAliasesResult{SessionID: args.SessionID, Operation: "set", Message: err.Error()}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	message := fmt.Sprintf("Alias '%s' now expands to '%s'", args.Name, args.Command)
+	if args.Command == "" {
+		message = fmt.Sprintf("Alias '%s' removed", args.Name)
+	}
+	result := CommandAliasesResult{
+		Success:   true,
+		SessionID: args.SessionID,
+		Operation: "set",
+		Aliases:   aliases,
+		Count:     len(aliases),
+		Message:   message,
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// ListCommandAliases returns the command aliases defined in a session
+func (t *TerminalTools) ListCommandAliases(ctx context.Context, req *mcp.CallToolRequest, args ListCommandAliasesArgs) (*mcp.CallToolResult, CommandAliasesResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), CommandAliasesResult{Operation: "list"}, nil
+	}
+
+	aliases, err := t.manager.GetSessionAliases(args.SessionID)
+	if err != nil {
+		result := CommandAliasesResult{SessionID: args.SessionID, Operation: "list", Message: err.Error()}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	result := CommandAliasesResult{
+		Success:   true,
+		SessionID: args.SessionID,
+		Operation: "list",
+		Aliases:   aliases,
+		Count:     len(aliases),
+		Message:   fmt.Sprintf("%d alias(es) defined", len(aliases)),
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// expandCommandAlias expands a session alias at the start of command, returning nil when there is
+// none. A session that does not exist expands nothing; the caller reports it when looking it up.
+func (t *TerminalTools) expandCommandAlias(sessionID, command string) (*terminal.AliasExpansion, error) {
+	session, err := t.manager.GetSession(sessionID)
+	if err != nil {
+		return nil, nil
+	}
+	return session.ExpandAlias(command)
+}
@@ -8,21 +8,36 @@ import (
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 	"github.com/rama-kairi/go-term/internal/tracing"
 )
 
 // RunCommand executes a foreground command in the specified terminal session
 func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest, args RunCommandArgs) (*mcp.CallToolResult, RunCommandResult, error) {
+	return t.runCommand(ctx, req, args, true)
+}
+
+// runCommand runs a command for RunCommand. checkRateLimit is false for callers such as
+// RunCommands that already charged the session's rate limit for the whole batch.
+func (t *TerminalTools) runCommand(ctx context.Context, req *mcp.CallToolRequest, args RunCommandArgs, checkRateLimit bool) (*mcp.CallToolResult, RunCommandResult, error) {
 	// M10: Start tracing span for command execution
 	ctx, span := t.tracer.StartSpanWithKind(ctx, "run_command", tracing.SpanKindServer)
 	defer span.End()
 	span.SetAttribute(tracing.AttrSessionID, args.SessionID)
 	span.SetAttribute(tracing.AttrCommand, args.Command)
 
+	// A dry run only validates, so it counts against nothing, not even the rate limit
+	if args.DryRun {
+		span.SetAttribute("command.dry_run", true)
+		return t.dryRunCommand(args)
+	}
+
 	// H2: Check rate limit first
-	if err := t.CheckRateLimit(); err != nil {
-		span.SetStatus(tracing.StatusError, "rate limited")
-		return createErrorResult(err.Error()), RunCommandResult{}, nil
+	if checkRateLimit {
+		if err := t.CheckRateLimit(args.SessionID); err != nil {
+			span.SetStatus(tracing.StatusError, "rate limited")
+			return createErrorResult(err.Error()), RunCommandResult{}, nil
+		}
 	}
 
 	// Validate input
@@ -30,23 +45,69 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 		return createErrorResult(fmt.Sprintf("Invalid session ID: %v. Tip: Session ID must be a valid UUID4. Use 'list_terminal_sessions' to find valid session IDs, or create a new session with 'create_terminal_session'.", err)), RunCommandResult{}, nil
 	}
 
-	if err := t.security.ValidateCommand(args.Command); err != nil {
+	// Blank and comment-only commands are input mistakes, not security events
+	if err := validateCommandText(args.Command, t.config.Security.AllowCommentOnlyCommands); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid command: %v. Tip: Provide a shell command to run.", err)), RunCommandResult{}, nil
+	}
+
+	// Aliases are expanded first so the command validated is the one that runs
+	alias, err := t.expandCommandAlias(args.SessionID, args.Command)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid command: %v. Tip: Use 'list_command_aliases' to check the session's aliases.", err)), RunCommandResult{}, nil
+	}
+	if alias != nil {
+		args.Command = alias.Expanded
+		span.SetAttribute(tracing.AttrCommand, args.Command)
+	}
+
+	decision := t.evaluateCommandForSession(args.SessionID, args.Command)
+	if !decision.Allowed {
 		t.logger.LogSecurityEvent("command_blocked", fmt.Sprintf("Command blocked: %s", args.Command), "medium", map[string]interface{}{
-			"session_id": args.SessionID,
-			"command":    args.Command,
-			"reason":     err.Error(),
+			"session_id":   args.SessionID,
+			"command":      args.Command,
+			"reason":       decision.Reason,
+			"rule_type":    decision.RuleType,
+			"matched_rule": decision.MatchedRule,
 		})
-		return createErrorResult(fmt.Sprintf("Command blocked for security reasons: %v. Tip: Check if the command contains restricted characters or operations. Review security settings or use a different approach.", err)), RunCommandResult{}, nil
+		t.recordBlockedCommand(args.SessionID, args.Command, "run_command", decision)
+		blockedResult := RunCommandResult{SessionID: args.SessionID, Command: args.Command, Security: &decision, Alias: alias}
+		return createErrorResult(fmt.Sprintf("Command blocked for security reasons: %s (rule type: %s). Tip: Check if the command contains restricted characters or operations. Review security settings or use a different approach.", decision.Reason, decision.RuleType)), blockedResult, nil
 	}
+	t.logSecurityDecision(args.SessionID, args.Command, decision)
 
-	// Determine timeout value
-	timeoutSeconds := args.Timeout
-	if timeoutSeconds <= 0 {
-		timeoutSeconds = 60 // Default 60 seconds
+	if err := validateEnvOverrides(args.Env); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid env: %v. Tip: Environment variable names must be non-empty and cannot contain '='.", err)), RunCommandResult{}, nil
 	}
-	if timeoutSeconds > 300 {
-		timeoutSeconds = 300 // Maximum 5 minutes
+
+	if err := validateCommandTags(args.Tags); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid tags: %v", err)), RunCommandResult{}, nil
+	}
+
+	if args.MaxOutputBytes < 0 {
+		return createErrorResult("max_output_bytes cannot be negative. Tip: Omit it or pass 0 to use the server's max_output_size."), RunCommandResult{}, nil
 	}
+
+	if args.IdleTimeout < 0 {
+		return createErrorResult("idle_timeout cannot be negative. Tip: Omit it to use the server's command_idle_timeout."), RunCommandResult{}, nil
+	}
+
+	// Commands that fork into the background return at once while their process keeps running untracked
+	var daemon *DaemonWarning
+	daemonReason, backgrounded := detectDaemonizing(args.Command)
+	if daemonReason != "" {
+		handling := t.config.Session.DaemonCommandHandling
+		if handling == "" {
+			handling = DaemonHandlingWarn
+		}
+		daemon = newDaemonWarning(daemonReason, handling)
+		if handling == DaemonHandlingReject {
+			rejected := RunCommandResult{SessionID: args.SessionID, Command: args.Command, Daemon: daemon}
+			return createErrorResult(fmt.Sprintf("Command rejected: it %s and would keep running untracked after run_command returns. Tip: Use 'run_background_process' for long-running processes.", daemonReason)), rejected, nil
+		}
+	}
+
+	// Determine timeout values; an idle timeout lets an active command run past the usual maximum
+	timeoutSeconds, idleSeconds := t.runCommandTimeouts(args.Timeout, args.IdleTimeout)
 	timeout := time.Duration(timeoutSeconds) * time.Second
 
 	// Verify session exists
@@ -55,9 +116,23 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 		return createErrorResult(fmt.Sprintf("Session not found: %v. Tip: Use 'list_terminal_sessions' to see all available sessions and their IDs. Make sure to create a session first with 'create_terminal_session'.", err)), RunCommandResult{}, nil
 	}
 
+	// Destructive commands may be refused in the server's own directories
+	currentWorkingDir := session.GetCurrentDir()
+	protectedDir, rejectProtected := t.checkProtectedDir(currentWorkingDir, args.Command, args.AllowProtectedDir)
+	if rejectProtected {
+		t.logger.LogSecurityEvent("protected_dir_blocked", fmt.Sprintf("Command blocked in protected directory: %s", args.Command), "medium", map[string]interface{}{
+			"session_id":  args.SessionID,
+			"command":     args.Command,
+			"working_dir": currentWorkingDir,
+			"protected":   protectedDir.Path,
+			"destructive": protectedDir.Destructive,
+		})
+		rejected := RunCommandResult{SessionID: args.SessionID, Command: args.Command, WorkingDir: currentWorkingDir, Alias: alias, ProtectedDir: protectedDir}
+		return createErrorResult(fmt.Sprintf("Command rejected: it %s and the session is in %s (%s). Tip: Change to another directory, or set allow_protected_dir if the change is intended.", protectedDir.Destructive, protectedDir.Reason, protectedDir.Path)), rejected, nil
+	}
+
 	// Detect package manager and project type using current directory
 	packageManager := ""
-	currentWorkingDir := session.GetCurrentDir()
 	projectType := t.packageManager.DetectProjectType(currentWorkingDir)
 	if pm, err := t.packageManager.DetectPackageManager(currentWorkingDir); err == nil && pm != nil {
 		packageManager = pm.Name
@@ -68,28 +143,57 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 
 	// Execute the command in foreground with timeout
 	startTime := time.Now()
-	var output, errorOutput string
+	var output, errorOutput, combinedOutput string
 	var success bool
 	var exitCode int
 	var totalChunks int
 	streamingUsed := false
 	timedOut := false
 
-	// Use timeout for command execution
-	output, err = t.manager.ExecuteCommandWithTimeout(args.SessionID, enhancedCommand, timeout)
+	// Use timeout for command execution; env overrides and stdin apply to this command only
+	executedCommand := enhancedCommand
+	capturePID := daemon != nil && backgrounded && daemon.Handling == DaemonHandlingCapturePID
+	if capturePID {
+		executedCommand = withDaemonPIDCapture(enhancedCommand)
+	}
+	tags := terminal.CommandTags(enhancedCommand, args.Tags)
+	outputLimit := runCommandOutputLimit(args.MaxOutputBytes, t.config.Session.MaxOutputSize)
+	captured, err := t.manager.ExecuteCommandWithOptions(args.SessionID, executedCommand, terminal.ExecOptions{
+		Timeout:        timeout,
+		IdleTimeout:    time.Duration(idleSeconds) * time.Second,
+		Env:            args.Env,
+		Stdin:          args.Stdin,
+		Tags:           tags,
+		PTY:            args.UsePTY,
+		MaxOutputBytes: outputLimit,
+	})
+	output, errorOutput, combinedOutput = captured.Stdout, captured.Stderr, captured.Combined
+	streamingUsed, totalChunks = captured.Streamed, captured.StreamChunks
+	if capturePID {
+		output, daemon.PID = extractDaemonPID(output)
+		combinedOutput, _ = extractDaemonPID(combinedOutput)
+	}
 	success = err == nil
 	exitCode = 0
 
 	if err != nil {
-		errorOutput = err.Error()
+		// Failures that wrote nothing to stderr report the error itself
+		if errorOutput == "" {
+			errorOutput = err.Error()
+		}
 		exitCode = 1
 
 		// Check if error is due to timeout
-		if strings.Contains(err.Error(), "context deadline exceeded") ||
+		if captured.TimeoutReason != "" ||
+			strings.Contains(err.Error(), "context deadline exceeded") ||
 			strings.Contains(err.Error(), "timeout") ||
 			strings.Contains(err.Error(), "signal: killed") {
 			timedOut = true
-			errorOutput = fmt.Sprintf("Command timed out after %d seconds: %v", timeoutSeconds, err)
+			// Keep whatever the command wrote to stderr before it was stopped
+			errorOutput = captured.Stderr + fmt.Sprintf("Command timed out after %d seconds: %v", timeoutSeconds, err)
+			if captured.TimeoutReason == terminal.TimeoutReasonIdle {
+				errorOutput = captured.Stderr + fmt.Sprintf("Command stopped after producing no output for %d seconds: %v", idleSeconds, err)
+			}
 			exitCode = 124 // Standard timeout exit code
 		}
 	}
@@ -109,18 +213,48 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 		Command:        enhancedCommand,
 		Output:         output,
 		ErrorOutput:    errorOutput,
+		CombinedOutput: combinedOutput,
 		Success:        success,
 		ExitCode:       exitCode,
 		Duration:       duration.String(),
-		WorkingDir:     session.WorkingDir,
+		WorkingDir:     session.GetWorkingDir(),
 		CommandCount:   commandCount,
 		HistoryID:      fmt.Sprintf("%s_%d", args.SessionID[:8], commandCount),
+		CommandID:      captured.CommandID,
 		StreamingUsed:  streamingUsed,
 		TotalChunks:    totalChunks,
 		PackageManager: packageManager,
 		ProjectType:    projectType,
 		TimeoutUsed:    timeoutSeconds,
 		TimedOut:       timedOut,
+		TimeoutReason:  captured.TimeoutReason,
+		IdleTimeout:    idleSeconds,
+		Truncated:      captured.Truncated,
+		Alias:          alias,
+		Security:       &decision,
+		Daemon:         daemon,
+		ProtectedDir:   protectedDir,
+		Tags:           tags,
+		PTY:            captured.PTY,
+		PTYError:       captured.PTYError,
+	}
+
+	if protectedDir != nil && protectedDir.Destructive != "" {
+		t.logger.Warn("Destructive command ran in a protected directory", map[string]interface{}{
+			"session_id":  args.SessionID,
+			"command":     args.Command,
+			"protected":   protectedDir.Path,
+			"destructive": protectedDir.Destructive,
+			"overridden":  protectedDir.Overridden,
+		})
+	}
+	if daemon != nil {
+		t.logger.Warn("Foreground command may leave an untracked background process", map[string]interface{}{
+			"session_id": args.SessionID,
+			"command":    args.Command,
+			"reason":     daemon.Reason,
+			"pid":        daemon.PID,
+		})
 	}
 
 	// Create response
@@ -140,13 +274,15 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 		"project_type":    projectType,
 		"timeout_used":    timeoutSeconds,
 		"timed_out":       timedOut,
+		"timeout_reason":  captured.TimeoutReason,
+		"truncated":       captured.Truncated,
 	})
 
 	// M10: Update span with execution details
 	span.SetAttributes(map[string]interface{}{
 		tracing.AttrExitCode:     exitCode,
 		tracing.AttrOutputSize:   len(output),
-		tracing.AttrWorkingDir:   session.WorkingDir,
+		tracing.AttrWorkingDir:   session.GetWorkingDir(),
 		tracing.AttrProjectID:    session.ProjectID,
 		tracing.AttrIsBackground: false,
 	})
@@ -165,3 +301,175 @@ func (t *TerminalTools) RunCommand(ctx context.Context, req *mcp.CallToolRequest
 		IsError: false,
 	}, result, nil
 }
+
+// runCommandTimeout returns the timeout in seconds run_command uses for a requested timeout
+func runCommandTimeout(seconds int) int {
+	if seconds <= 0 {
+		return 60 // Default 60 seconds
+	}
+	if seconds > 300 {
+		return 300 // Maximum 5 minutes
+	}
+	return seconds
+}
+
+// runCommandTimeouts returns the total and idle timeouts in seconds run_command uses for the
+// requested ones. An idle timeout, requested or command_idle_timeout, raises the cap on the total
+// timeout from 5 minutes to command_max_timeout, which is also its default.
+func (t *TerminalTools) runCommandTimeouts(timeout, idleTimeout int) (int, int) {
+	if idleTimeout <= 0 {
+		idleTimeout = int(t.config.Session.CommandIdleTimeout / time.Second)
+	}
+	if idleTimeout <= 0 {
+		return runCommandTimeout(timeout), 0
+	}
+
+	maxSeconds := int(t.config.Session.CommandMaxTimeout / time.Second)
+	if maxSeconds <= 0 {
+		maxSeconds = 300
+	}
+	if timeout <= 0 || timeout > maxSeconds {
+		timeout = maxSeconds
+	}
+	return timeout, idleTimeout
+}
+
+// runCommandOutputLimit returns the bytes of output run_command captures for a requested limit,
+// which may lower max_output_size but not raise it
+func runCommandOutputLimit(requested, maxOutputSize int) int {
+	if requested <= 0 || requested > maxOutputSize {
+		return maxOutputSize
+	}
+	return requested
+}
+
+// dryRunCommand checks args.Command the way RunCommand would and detects the session's package
+// manager and project type, without running the command. Nothing is recorded: no history row, no
+// command count and no blocked command entry. A command that would be rejected is reported through
+// ValidationError rather than as a tool error, so the caller can reword it.
+func (t *TerminalTools) dryRunCommand(args RunCommandArgs) (*mcp.CallToolResult, RunCommandResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v. Tip: Session ID must be a valid UUID4. Use 'list_terminal_sessions' to find valid session IDs.", err)), RunCommandResult{}, nil
+	}
+	session, err := t.manager.GetSession(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v. Tip: Use 'list_terminal_sessions' to see all available sessions and their IDs.", err)), RunCommandResult{}, nil
+	}
+
+	alias, err := session.ExpandAlias(args.Command)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid command: %v. Tip: Use 'list_command_aliases' to check the session's aliases.", err)), RunCommandResult{}, nil
+	}
+	if alias != nil {
+		args.Command = alias.Expanded
+	}
+
+	currentWorkingDir := session.GetCurrentDir()
+	timeoutSeconds, idleSeconds := t.runCommandTimeouts(args.Timeout, args.IdleTimeout)
+	result := RunCommandResult{
+		SessionID:    args.SessionID,
+		ProjectID:    session.ProjectID,
+		Command:      args.Command,
+		WorkingDir:   currentWorkingDir,
+		CommandCount: session.CommandCount,
+		ProjectType:  t.packageManager.DetectProjectType(currentWorkingDir),
+		TimeoutUsed:  timeoutSeconds,
+		IdleTimeout:  idleSeconds,
+		Alias:        alias,
+		DryRun:       true,
+	}
+	if pm, err := t.packageManager.DetectPackageManager(currentWorkingDir); err == nil && pm != nil {
+		result.PackageManager = pm.Name
+	}
+
+	result.ValidationError = t.dryRunValidationError(args, &result)
+	if result.ValidationError == "" {
+		result.Command = t.enhanceCommandWithPackageManager(args.Command, currentWorkingDir)
+		result.Tags = terminal.CommandTags(result.Command, args.Tags)
+		result.Success = true
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// dryRunValidationError runs RunCommand's validation of args and returns why the command would be
+// rejected, or "" if it would run. The security decision, daemon warning and protected directory
+// warning are set on result.
+func (t *TerminalTools) dryRunValidationError(args RunCommandArgs, result *RunCommandResult) string {
+	if err := validateCommandText(args.Command, t.config.Security.AllowCommentOnlyCommands); err != nil {
+		return fmt.Sprintf("Invalid command: %v", err)
+	}
+
+	decision := t.evaluateCommandForSession(args.SessionID, args.Command)
+	result.Security = &decision
+	if !decision.Allowed {
+		return fmt.Sprintf("Command blocked for security reasons: %s (rule type: %s)", decision.Reason, decision.RuleType)
+	}
+
+	if err := validateEnvOverrides(args.Env); err != nil {
+		return fmt.Sprintf("Invalid env: %v", err)
+	}
+	if err := validateCommandTags(args.Tags); err != nil {
+		return fmt.Sprintf("Invalid tags: %v", err)
+	}
+	if args.MaxOutputBytes < 0 {
+		return "max_output_bytes cannot be negative"
+	}
+	if args.IdleTimeout < 0 {
+		return "idle_timeout cannot be negative"
+	}
+
+	if daemonReason, _ := detectDaemonizing(args.Command); daemonReason != "" {
+		handling := t.config.Session.DaemonCommandHandling
+		if handling == "" {
+			handling = DaemonHandlingWarn
+		}
+		result.Daemon = newDaemonWarning(daemonReason, handling)
+		if handling == DaemonHandlingReject {
+			return fmt.Sprintf("Command rejected: it %s and would keep running untracked after run_command returns", daemonReason)
+		}
+	}
+
+	protectedDir, rejectProtected := t.checkProtectedDir(result.WorkingDir, args.Command, args.AllowProtectedDir)
+	result.ProtectedDir = protectedDir
+	if rejectProtected {
+		return fmt.Sprintf("Command rejected: it %s and the session is in %s (%s)", protectedDir.Destructive, protectedDir.Reason, protectedDir.Path)
+	}
+	return ""
+}
+
+// GetActiveCommandOutput returns the output captured so far for the session's foreground command, so
+// a long-running run_command can be watched from another call before it completes
+func (t *TerminalTools) GetActiveCommandOutput(ctx context.Context, req *mcp.CallToolRequest, args GetActiveCommandOutputArgs) (*mcp.CallToolResult, GetActiveCommandOutputResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetActiveCommandOutputResult{}, nil
+	}
+	if args.TailLines < 0 {
+		return createErrorResult("tail_lines cannot be negative"), GetActiveCommandOutputResult{}, nil
+	}
+
+	active, err := t.manager.GetActiveCommandOutput(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to get active command output: %v", err)), GetActiveCommandOutputResult{}, nil
+	}
+
+	result := GetActiveCommandOutputResult{SessionID: args.SessionID}
+	if active == nil {
+		result.Message = "No foreground command has run in this session yet"
+		return createJSONResult(result), result, nil
+	}
+
+	result.Found = true
+	result.ActiveCommand = active
+	active.Output, result.OutputLines = sliceOutputLines(active.Output, 0, args.TailLines)
+
+	if active.Running {
+		result.Message = fmt.Sprintf("Command is still running after %s; showing output captured so far%s",
+			active.Elapsed, lineSliceLabel(0, args.TailLines, result.OutputLines))
+	} else {
+		result.Message = fmt.Sprintf("Command finished with exit code %d after %s%s",
+			*active.ExitCode, active.Elapsed, lineSliceLabel(0, args.TailLines, result.OutputLines))
+	}
+
+	return createJSONResult(result), result, nil
+}
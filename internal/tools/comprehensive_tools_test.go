@@ -2,10 +2,21 @@ package tools
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rama-kairi/go-term/internal/config"
@@ -71,6 +82,17 @@ func TestCreateSessionTool(t *testing.T) {
 	if response.ProjectID == "" {
 		t.Error("Expected project ID to be set")
 	}
+	if response.RequestedName != "" {
+		t.Errorf("Expected no requested_name for an unchanged name, got %q", response.RequestedName)
+	}
+
+	// With unique names a second session of the same name in the project is suffixed
+	tools.config.Session.UniqueNames = true
+	args.ProjectID = response.ProjectID
+	_, duplicate, _ := tools.CreateSession(ctx, req, args)
+	if duplicate.Name != "test-session-2" || duplicate.RequestedName != "test-session" {
+		t.Errorf("Expected 'test-session-2' renamed from 'test-session', got %q from %q", duplicate.Name, duplicate.RequestedName)
+	}
 }
 
 func TestRunCommandTool(t *testing.T) {
@@ -188,6 +210,22 @@ func TestCheckBackgroundProcessTool(t *testing.T) {
 	if response.ProcessID != processID {
 		t.Errorf("Expected process ID %s, got %s", processID, response.ProcessID)
 	}
+	if response.ExitCode == nil || *response.ExitCode != 0 || response.ExitReason != "exited" || response.Signal != "" {
+		t.Errorf("Expected a clean exit, got exit_code=%v exit_reason=%q signal=%q", response.ExitCode, response.ExitReason, response.Signal)
+	}
+
+	// A process that exits nonzero reports its code alongside the legacy status string
+	failingID, err := manager.ExecuteCommandInBackground(session.ID, "false")
+	if err != nil {
+		t.Fatalf("Failed to start background process: %v", err)
+	}
+	if _, err := manager.WaitForBackgroundProcess(session.ID, failingID, 5*time.Second); err != nil {
+		t.Fatalf("WaitForBackgroundProcess failed: %v", err)
+	}
+	_, response, _ = tools.CheckBackgroundProcess(ctx, req, CheckBackgroundProcessArgs{SessionID: session.ID, ProcessID: failingID})
+	if response.Status != "failed" || response.ExitCode == nil || *response.ExitCode == 0 || response.ExitReason != "nonzero_exit" {
+		t.Errorf("Expected a nonzero exit, got status=%q exit_code=%v exit_reason=%q", response.Status, response.ExitCode, response.ExitReason)
+	}
 }
 
 func TestListBackgroundProcessesTool(t *testing.T) {
@@ -221,6 +259,41 @@ func TestListBackgroundProcessesTool(t *testing.T) {
 	}
 }
 
+func TestCloneSessionTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	source, err := manager.CreateSession("dev-server", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(source.ID, map[string]string{"PORT": "8080"}); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+
+	ctx := context.Background()
+	result, cloned, _ := tools.CloneSession(ctx, nil, CloneSessionArgs{SourceSessionID: source.ID, Name: "tests"})
+	if result.IsError {
+		t.Fatalf("CloneSession failed: %+v", result)
+	}
+	if cloned.SourceSessionID != source.ID || cloned.SessionID == source.ID || cloned.Name != "tests" || cloned.WorkingDir != tempDir {
+		t.Errorf("Expected a new session named tests in %s, got %+v", tempDir, cloned)
+	}
+	if !cloned.EnvironmentMatches || cloned.EnvironmentCopied == 0 {
+		t.Errorf("Expected the environment to be duplicated, got %+v", cloned)
+	}
+
+	_, output, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: cloned.SessionID, Command: "echo $PORT"})
+	if strings.TrimSpace(output.Output) != "8080" {
+		t.Errorf("Expected the cloned session to see PORT=8080, got %q", output.Output)
+	}
+
+	if result, _, _ := tools.CloneSession(ctx, nil, CloneSessionArgs{SourceSessionID: "not-a-uuid"}); !result.IsError {
+		t.Error("Expected an invalid source session ID to be rejected")
+	}
+}
+
 func TestListSessionsTool(t *testing.T) {
 	tools, manager, tempDir := setupTestToolsEnvironment(t)
 	defer os.RemoveAll(tempDir)
@@ -274,6 +347,55 @@ func TestListSessionsTool(t *testing.T) {
 	}
 }
 
+func TestListSessionsSortAndFilter(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	quiet, err := manager.CreateSession("sort-test-quiet", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	busy, err := manager.CreateSession("sort-test-busy", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	manager.ExecuteCommand(quiet.ID, "echo one")
+	for i := 0; i < 3; i++ {
+		manager.ExecuteCommand(busy.ID, "echo busy")
+	}
+	manager.ExecuteCommand(busy.ID, "false")
+
+	ctx := context.Background()
+
+	_, response, err := tools.ListSessions(ctx, nil, ListSessionsArgs{SortBy: "by_commands"})
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(response.Sessions) < 2 || response.Sessions[0].ID != busy.ID {
+		t.Fatalf("Expected busiest session first, got %+v", response.Sessions)
+	}
+	if response.Sessions[0].FailureCount != 1 {
+		t.Errorf("Expected 1 failure for busy session, got %d", response.Sessions[0].FailureCount)
+	}
+
+	_, response, _ = tools.ListSessions(ctx, nil, ListSessionsArgs{MinCommands: 2})
+	if response.Count != 1 || response.Sessions[0].ID != busy.ID {
+		t.Errorf("Expected only busy session with min_commands=2, got %d sessions", response.Count)
+	}
+
+	_, response, _ = tools.ListSessions(ctx, nil, ListSessionsArgs{HasBackground: true})
+	if response.Count != 0 {
+		t.Errorf("Expected no sessions with background processes, got %d", response.Count)
+	}
+
+	result, _, _ := tools.ListSessions(ctx, nil, ListSessionsArgs{SortBy: "by_name"})
+	if !result.IsError {
+		t.Error("Expected error for invalid sort_by")
+	}
+}
+
 func TestDeleteSessionTool(t *testing.T) {
 	tools, manager, tempDir := setupTestToolsEnvironment(t)
 	defer os.RemoveAll(tempDir)
@@ -356,6 +478,27 @@ func TestSearchHistoryTool(t *testing.T) {
 	if len(response.Results) == 0 {
 		t.Error("Expected to find commands in history")
 	}
+
+	if _, err := time.Parse(time.RFC3339, response.Results[0].Timestamp); err != nil {
+		t.Errorf("Expected RFC3339 timestamps by default, got %q", response.Results[0].Timestamp)
+	}
+
+	args.TimeFormat = "unix_ms"
+	_, response, _ = tools.SearchHistory(ctx, req, args)
+	if ms, err := strconv.ParseInt(response.Results[0].Timestamp, 10, 64); err != nil || time.Since(time.UnixMilli(ms)) > time.Minute {
+		t.Errorf("Expected a recent unix_ms timestamp, got %q", response.Results[0].Timestamp)
+	}
+
+	args.TimeFormat = "2006-01-02"
+	_, response, _ = tools.SearchHistory(ctx, req, args)
+	if _, err := time.Parse("2006-01-02", response.Results[0].Timestamp); err != nil {
+		t.Errorf("Expected a Go layout timestamp, got %q", response.Results[0].Timestamp)
+	}
+
+	args.TimeFormat = "epoch"
+	if result, _, _ := tools.SearchHistory(ctx, req, args); !result.IsError {
+		t.Error("Expected an invalid time_format to be rejected")
+	}
 }
 
 func TestTerminateBackgroundProcessTool(t *testing.T) {
@@ -403,81 +546,3718 @@ func TestTerminateBackgroundProcessTool(t *testing.T) {
 	}
 }
 
-func TestValidateHelpers(t *testing.T) {
-	// Test validateSessionName
-	tests := []struct {
-		name        string
-		sessionName string
-		expectError bool
-	}{
-		{"valid name", "test-session", false},
-		{"valid with underscores", "test_session_123", false},
-		{"empty name", "", true},
-		{"too short", "ab", false},
-		{"too long", string(make([]byte, 200)), true},
-		{"invalid characters", "test session!", true},
+func TestCheckBackgroundProcessLineLimits(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	session, err := manager.CreateSession("line-limit-test", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validateSessionName(tt.sessionName)
-			if tt.expectError && err == nil {
-				t.Errorf("Expected error for session name '%s'", tt.sessionName)
-			}
-			if !tt.expectError && err != nil {
-				t.Errorf("Expected no error for session name '%s', got: %v", tt.sessionName, err)
-			}
+	// Keep the process running so its output is checked while it is still tracked
+	var lines strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&lines, "%d\n", i)
+	}
+	logFile := filepath.Join(tempDir, "chatty.log")
+	if err := os.WriteFile(logFile, []byte(lines.String()), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	ctx := context.Background()
+	_, started, err := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID: session.ID,
+		Command:   "tail -n 50 -f " + logFile,
+	})
+	if err != nil || started.ProcessID == "" {
+		t.Fatalf("RunBackgroundProcess failed: %v", err)
+	}
+	defer tools.TerminateBackgroundProcess(ctx, nil, TerminateBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID, Force: true})
+
+	check := func(head, tail int) CheckBackgroundProcessResult {
+		_, checked, _ := tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{
+			SessionID: session.ID,
+			ProcessID: started.ProcessID,
+			HeadLines: head,
+			TailLines: tail,
 		})
+		return checked
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for check(0, 0).OutputLines < 50 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
 	}
 
-	// Test validateSessionID
-	validUUID := "123e4567-e89b-12d3-a456-426614174000"
-	invalidUUID := "not-a-uuid"
+	if full := check(0, 0); full.OutputLines != 50 || strings.Count(full.Output, "\n") != 50 {
+		t.Fatalf("Expected 50 lines of output, got %d", full.OutputLines)
+	}
+	if tail := check(0, 3); tail.Output != "48\n49\n50\n" || tail.OutputLines != 50 {
+		t.Errorf("Expected the last 3 of 50 lines, got %q (%d lines)", tail.Output, tail.OutputLines)
+	}
+	if head := check(2, 0); head.Output != "1\n2\n" || head.OutputLines != 50 {
+		t.Errorf("Expected the first 2 of 50 lines, got %q (%d lines)", head.Output, head.OutputLines)
+	}
+	if all := check(0, 100); all.OutputLines != 50 || strings.Count(all.Output, "\n") != 50 {
+		t.Errorf("Expected a tail longer than the output to return it all, got %d lines", strings.Count(all.Output, "\n"))
+	}
 
-	if err := validateSessionID(validUUID); err != nil {
-		t.Errorf("Expected valid UUID to pass validation, got: %v", err)
+	result, _, _ := tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{SessionID: session.ID, HeadLines: 1, TailLines: 1})
+	if !result.IsError {
+		t.Error("Expected head_lines and tail_lines together to be rejected")
+	}
+}
+
+func TestCheckBackgroundProcessOffsets(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	session, err := manager.CreateSession("offset-test", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
 	}
 
-	if err := validateSessionID(invalidUUID); err == nil {
-		t.Error("Expected invalid UUID to fail validation")
+	logFile := filepath.Join(tempDir, "server.log")
+	if err := os.WriteFile(logFile, []byte("boot\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	ctx := context.Background()
+	_, started, err := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "tail -n +1 -f " + logFile})
+	if err != nil || started.ProcessID == "" {
+		t.Fatalf("RunBackgroundProcess failed: %v", err)
+	}
+	defer tools.TerminateBackgroundProcess(ctx, nil, TerminateBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID, Force: true})
+
+	check := func(offset *int64) (*mcp.CallToolResult, CheckBackgroundProcessResult) {
+		result, checked, _ := tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{
+			SessionID:    session.ID,
+			ProcessID:    started.ProcessID,
+			OutputOffset: offset,
+		})
+		return result, checked
+	}
+	waitForOffset := func(want int64) CheckBackgroundProcessResult {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, checked := check(nil)
+			if checked.NextOutputOffset >= want || time.Now().After(deadline) {
+				return checked
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	first := waitForOffset(5)
+	if first.Output != "boot\n" || first.NextOutputOffset != 5 {
+		t.Fatalf("Expected the first line with offset 5, got %q at %d", first.Output, first.NextOutputOffset)
+	}
+
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	file.WriteString("ready\n")
+	file.Close()
+	waitForOffset(11)
+
+	offset := first.NextOutputOffset
+	_, next := check(&offset)
+	if next.Output != "ready\n" || next.NextOutputOffset != 11 || next.OutputGapBytes != 0 {
+		t.Errorf("Expected only the new line, got %q at %d (gap %d)", next.Output, next.NextOutputOffset, next.OutputGapBytes)
+	}
+	offset = next.NextOutputOffset
+	if _, idle := check(&offset); idle.Output != "" || idle.NextOutputOffset != 11 {
+		t.Errorf("Expected no new output, got %q at %d", idle.Output, idle.NextOutputOffset)
+	}
+
+	offset = 100
+	if result, _ := check(&offset); !result.IsError {
+		t.Error("Expected an offset past the end of the output to be rejected")
+	}
+	offset = 0
+	result, _, _ := tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID, OutputOffset: &offset, TailLines: 1})
+	if !result.IsError {
+		t.Error("Expected an offset with tail_lines to be rejected")
 	}
 }
 
-func TestCreateJSONResult(t *testing.T) {
-	testData := map[string]interface{}{
-		"test": "value",
-		"num":  42,
+func TestRestartBackgroundProcessTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	session, err := manager.CreateSession("restart-test", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
 	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
 
-	result := createJSONResult(testData)
+	ctx := context.Background()
+	_, started, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "sleep 30"})
+	if started.ProcessID == "" {
+		t.Fatal("RunBackgroundProcess did not start the process")
+	}
+	time.Sleep(100 * time.Millisecond)
 
+	result, restarted, _ := tools.RestartBackgroundProcess(ctx, nil, RestartBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID, Force: true})
 	if result.IsError {
-		t.Error("Expected result to not be an error")
+		t.Fatalf("RestartBackgroundProcess failed: %+v", result)
+	}
+	if restarted.ProcessID != started.ProcessID || restarted.OldPID == 0 || restarted.NewPID == 0 || restarted.OldPID == restarted.NewPID {
+		t.Errorf("Expected the same process ID with old and new PIDs, got %+v", restarted)
 	}
 
-	if len(result.Content) != 1 {
-		t.Errorf("Expected 1 content item, got %d", len(result.Content))
+	_, list, _ := tools.ListBackgroundProcesses(ctx, nil, ListBackgroundProcessesArgs{SessionID: session.ID})
+	if list.TotalCount != 1 || list.Processes[0].ProcessID != started.ProcessID || list.Processes[0].PID != restarted.NewPID {
+		t.Errorf("Expected the restarted process listed under its ID, got %+v", list)
+	}
+
+	if result, _, _ := tools.RestartBackgroundProcess(ctx, nil, RestartBackgroundProcessArgs{SessionID: session.ID, ProcessID: "not-a-process"}); !result.IsError {
+		t.Error("Expected an invalid process ID to be rejected")
 	}
 }
 
-func TestCreateErrorResult(t *testing.T) {
-	errorMsg := "test error message"
-	result := createErrorResult(errorMsg)
+func TestWaitForBackgroundProcessTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
 
-	if !result.IsError {
-		t.Error("Expected result to be an error")
+	session, err := manager.CreateSession("wait-test", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
 	}
 
-	if len(result.Content) != 1 {
-		t.Errorf("Expected 1 content item, got %d", len(result.Content))
+	// Background commands are not run through a shell, so the script goes in a file. It sleeps
+	// before exiting so its output is captured before the pipes close.
+	script := filepath.Join(tempDir, "job.sh")
+	if err := os.WriteFile(script, []byte("echo one\necho two\nsleep 0.2\nexit 2\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
 	}
 
-	textContent, ok := result.Content[0].(*mcp.TextContent)
-	if !ok {
-		t.Error("Expected text content")
+	ctx := context.Background()
+	_, started, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "sh " + script})
+	if started.ProcessID == "" {
+		t.Fatal("RunBackgroundProcess did not start the process")
 	}
 
-	if textContent.Text != "Error: "+errorMsg {
-		t.Errorf("Expected error message 'Error: %s', got '%s'", errorMsg, textContent.Text)
+	result, waited, _ := tools.WaitForBackgroundProcess(ctx, nil, WaitForBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID, Timeout: 5, TailLines: 1})
+	if result.IsError {
+		t.Fatalf("WaitForBackgroundProcess failed: %+v", result)
+	}
+	if waited.Status != "failed" || !waited.Exited || waited.ExitCode != 2 {
+		t.Errorf("Expected a failed exit with code 2, got %+v", waited)
+	}
+	if waited.Output != "two\n" || waited.OutputLines != 2 {
+		t.Errorf("Expected the last of 2 output lines, got %q (%d lines)", waited.Output, waited.OutputLines)
+	}
+
+	_, running, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "sleep 30"})
+	defer tools.TerminateBackgroundProcess(ctx, nil, TerminateBackgroundProcessArgs{SessionID: session.ID, ProcessID: running.ProcessID, Force: true})
+
+	result, waited, _ = tools.WaitForBackgroundProcess(ctx, nil, WaitForBackgroundProcessArgs{SessionID: session.ID, ProcessID: running.ProcessID, Timeout: 1})
+	if result.IsError || waited.Status != "still_running" || waited.Exited {
+		t.Errorf("Expected still_running after the timeout without an error, got %+v", waited)
+	}
+}
+
+func TestGetBackgroundProcessStats(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+	tools.config.Session.MaxBackgroundProcesses = 2
+
+	first, err := manager.CreateSession("stats-first", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	second, err := manager.CreateSession("stats-second", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(first.ID, true, 0)
+	defer manager.TerminateAllBackgroundProcesses(second.ID, true, 0)
+
+	ctx := context.Background()
+	_, oldest, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: first.ID, Command: "sleep 30"})
+	time.Sleep(50 * time.Millisecond)
+	// The script sleeps before exiting so its output is captured before the pipes close
+	script := filepath.Join(tempDir, "job.sh")
+	if err := os.WriteFile(script, []byte("echo finished\nsleep 0.2\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	_, done, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: first.ID, Command: "sh " + script})
+	tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: second.ID, Command: "sleep 30"})
+	if _, waited, _ := tools.WaitForBackgroundProcess(ctx, nil, WaitForBackgroundProcessArgs{SessionID: first.ID, ProcessID: done.ProcessID, Timeout: 5}); !waited.Exited {
+		t.Fatalf("Expected the echo process to exit, got %+v", waited)
+	}
+
+	result, stats, _ := tools.GetBackgroundProcessStats(ctx, nil, GetBackgroundProcessStatsArgs{})
+	if result.IsError {
+		t.Fatalf("GetBackgroundProcessStats failed: %+v", result)
+	}
+	if stats.TotalCount != 3 || stats.RunningCount != 2 || stats.CompletedCount != 1 || stats.SessionCount != 2 || stats.SessionLimit != 2 {
+		t.Errorf("Expected 3 processes, 2 running, across 2 sessions, got %+v", stats)
+	}
+	if stats.LongestRunning == nil || stats.LongestRunning.ProcessID != oldest.ProcessID {
+		t.Errorf("Expected %s as the longest-running process, got %+v", oldest.ProcessID, stats.LongestRunning)
+	}
+	if stats.OutputBytes < int64(len("finished\n")) {
+		t.Errorf("Expected the echo output to be counted, got %d bytes", stats.OutputBytes)
+	}
+	full := stats.Sessions[0]
+	if full.SessionID != first.ID || !full.AtLimit || full.Available != 0 || full.UsagePercent != 100 || full.Running != 1 {
+		t.Errorf("Expected the first session listed first at its limit, got %+v", full)
+	}
+	if half := stats.Sessions[1]; half.AtLimit || half.Available != 1 || half.UsagePercent != 50 {
+		t.Errorf("Expected the second session at half its limit, got %+v", half)
+	}
+
+	_, stats, _ = tools.GetBackgroundProcessStats(ctx, nil, GetBackgroundProcessStatsArgs{SessionID: second.ID})
+	if stats.TotalCount != 1 || stats.SessionCount != 1 || stats.Sessions[0].SessionID != second.ID {
+		t.Errorf("Expected only the second session's process, got %+v", stats)
+	}
+}
+
+func TestArchiveBackgroundProcess(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+	tools.config.Database.DataDir = tempDir
+
+	session, err := manager.CreateSession("archive-test", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Background commands are not run through a shell, so use tail -f as a long-running process
+	logFile := filepath.Join(tempDir, "server.log")
+	if err := os.WriteFile(logFile, []byte("build finished\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	ctx := context.Background()
+	var processIDs []string
+	for i := 0; i < 2; i++ {
+		_, started, err := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+			SessionID:    session.ID,
+			Command:      "tail -f " + logFile,
+			ReadyPattern: "build finished",
+			ReadyTimeout: 5,
+		})
+		if err != nil || started.ProcessID == "" {
+			t.Fatalf("RunBackgroundProcess failed: %v", err)
+		}
+		processIDs = append(processIDs, started.ProcessID)
+	}
+
+	// Remove leaves the process running but no longer tracked by the session
+	result, archived, _ := tools.ArchiveBackgroundProcess(ctx, nil, ArchiveBackgroundProcessArgs{
+		SessionID: session.ID,
+		ProcessID: processIDs[0],
+		Remove:    true,
+	})
+	if result.IsError || !archived.Removed || !archived.IsRunning || archived.Terminated {
+		t.Fatalf("Expected the process to be removed but still running, got %+v", archived)
+	}
+	if process, err := os.FindProcess(archived.PID); err == nil {
+		defer process.Kill()
+	}
+	content, err := os.ReadFile(archived.ArchivePath)
+	if err != nil || !strings.Contains(string(content), "build finished") || !strings.HasPrefix(archived.ArchivePath, tempDir) {
+		t.Errorf("Expected the output archived under the data dir, got %s (%v)", archived.ArchivePath, err)
+	}
+	if _, err := manager.GetBackgroundProcess(session.ID, processIDs[0]); err == nil {
+		t.Error("Expected the removed process to be gone from the session")
+	}
+
+	_, archived, _ = tools.ArchiveBackgroundProcess(ctx, nil, ArchiveBackgroundProcessArgs{
+		SessionID: session.ID,
+		ProcessID: processIDs[1],
+		Terminate: true,
+		Force:     true,
+	})
+	if !archived.Terminated || archived.IsRunning {
+		t.Errorf("Expected the process to be terminated, got %+v", archived)
+	}
+
+	if result, _, _ := tools.ArchiveBackgroundProcess(ctx, nil, ArchiveBackgroundProcessArgs{
+		SessionID: session.ID,
+		ProcessID: processIDs[1],
+	}); !result.IsError {
+		t.Error("Expected archiving an unknown process to fail")
+	}
+}
+
+func TestGetRateLimitStatusTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	// Replace the limiter with a small one so it can be drained quickly
+	tools.rateLimiter = NewRateLimiter(60, 2)
+
+	ctx := context.Background()
+	_, status, err := tools.GetRateLimitStatus(ctx, nil, GetRateLimitStatusArgs{})
+	if err != nil {
+		t.Fatalf("GetRateLimitStatus failed: %v", err)
+	}
+	if len(status.Categories) != 1 {
+		t.Fatalf("Expected 1 rate limit category, got %d", len(status.Categories))
+	}
+	global := status.Categories[0]
+	if global.Burst != 2 || global.RatePerMinute != 60 || global.Limited {
+		t.Errorf("Unexpected initial status: %+v", global)
+	}
+
+	// Drain the bucket
+	for i := 0; i < 2; i++ {
+		if err := tools.CheckRateLimit(""); err != nil {
+			t.Fatalf("Expected call %d to be allowed: %v", i+1, err)
+		}
+	}
+
+	_, status, _ = tools.GetRateLimitStatus(ctx, nil, GetRateLimitStatusArgs{})
+	global = status.Categories[0]
+	if !global.Limited {
+		t.Errorf("Expected limiter to report limited after draining, got %+v", global)
+	}
+	if global.NextTokenInSeconds <= 0 || global.NextTokenInSeconds > 1 {
+		t.Errorf("Expected next token within 1 second, got %.2f", global.NextTokenInSeconds)
+	}
+}
+
+func TestWorkspaceSnapshotTools(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.workspaceStore = NewWorkspaceSnapshotStore(tempDir)
+	ctx := context.Background()
+
+	subDir := filepath.Join(tempDir, "sub")
+	if err := os.MkdirAll(subDir, 0o755); err != nil {
+		t.Fatalf("Failed to create sub dir: %v", err)
+	}
+
+	kept, err := manager.CreateSession("kept", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	removed, err := manager.CreateSession("removed", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(removed.ID, map[string]string{"WS_VAR": "saved"}); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+	if err := manager.SetSessionCurrentDir(removed.ID, subDir); err != nil {
+		t.Fatalf("Failed to set current dir: %v", err)
+	}
+	if _, err := manager.SetSessionShellOptions(kept.ID, map[string]bool{"pipefail": true}); err != nil {
+		t.Fatalf("Failed to set shell options: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(kept.ID, map[string]string{"WS_VAR": "saved"}); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+
+	_, saved, err := tools.SaveWorkspaceSnapshot(ctx, nil, SaveWorkspaceSnapshotArgs{Name: "setup"})
+	if err != nil {
+		t.Fatalf("SaveWorkspaceSnapshot failed: %v", err)
+	}
+	if saved.SessionCount != 2 {
+		t.Fatalf("Expected 2 sessions in snapshot, got %d", saved.SessionCount)
+	}
+
+	// Diverge from the snapshot: drop one session and change the other
+	if err := manager.CloseSession(removed.ID); err != nil {
+		t.Fatalf("Failed to close session: %v", err)
+	}
+	if err := manager.SetSessionEnvironment(kept.ID, map[string]string{"WS_VAR": "changed"}); err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+	if _, err := manager.SetSessionShellOptions(kept.ID, map[string]bool{"pipefail": false}); err != nil {
+		t.Fatalf("Failed to set shell options: %v", err)
+	}
+
+	_, restored, err := tools.RestoreWorkspaceSnapshot(ctx, nil, RestoreWorkspaceSnapshotArgs{SnapshotID: "setup"})
+	if err != nil {
+		t.Fatalf("RestoreWorkspaceSnapshot failed: %v", err)
+	}
+	if restored.Created != 1 || restored.Updated != 1 || restored.Failed != 0 {
+		t.Fatalf("Unexpected restore counts: %+v", restored)
+	}
+
+	for _, outcome := range restored.Sessions {
+		switch outcome.SnapshotSessionID {
+		case kept.ID:
+			if outcome.Action != "updated" || outcome.SessionID != kept.ID {
+				t.Errorf("Expected kept session to be updated in place, got %+v", outcome)
+			}
+			if len(outcome.Conflicts) == 0 {
+				t.Error("Expected environment conflict to be reported for kept session")
+			}
+			if value, _ := kept.GetEnvironment("WS_VAR"); value != "saved" {
+				t.Errorf("Expected WS_VAR restored to 'saved', got %q", value)
+			}
+			if options := kept.GetShellOptions(); len(options) != 1 || options[0] != "pipefail" {
+				t.Errorf("Expected pipefail restored, got %v", options)
+			}
+		case removed.ID:
+			if outcome.Action != "created" || outcome.SessionID == removed.ID {
+				t.Fatalf("Expected removed session to be recreated with a new ID, got %+v", outcome)
+			}
+			session, err := manager.GetSession(outcome.SessionID)
+			if err != nil {
+				t.Fatalf("Recreated session not found: %v", err)
+			}
+			if value, _ := session.GetEnvironment("WS_VAR"); value != "saved" {
+				t.Errorf("Expected WS_VAR restored to 'saved', got %q", value)
+			}
+			if session.GetCurrentDir() != subDir {
+				t.Errorf("Expected current dir %s, got %s", subDir, session.GetCurrentDir())
+			}
+		default:
+			t.Errorf("Unexpected outcome: %+v", outcome)
+		}
+	}
+
+	_, _, err = tools.RestoreWorkspaceSnapshot(ctx, nil, RestoreWorkspaceSnapshotArgs{SnapshotID: "missing"})
+	if err != nil {
+		t.Fatalf("RestoreWorkspaceSnapshot returned error: %v", err)
+	}
+}
+
+func TestListSessionSnapshotsFilters(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.snapshotManager = NewSnapshotManager(tempDir)
+	ctx := context.Background()
+
+	first, err := manager.CreateSession("first", "project_alpha", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	second, err := manager.CreateSession("second", "project_beta", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Save and list concurrently; every save must get a distinct ID
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			sessionID, name := first.ID, fmt.Sprintf("alpha-build-%d", i)
+			if i%2 == 1 {
+				sessionID, name = second.ID, fmt.Sprintf("beta-deploy-%d", i)
+			}
+			result, _, err := tools.SaveSessionSnapshot(ctx, nil, SaveSessionSnapshotArgs{SessionID: sessionID, Name: name})
+			if err != nil || result.IsError {
+				t.Errorf("SaveSessionSnapshot failed: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{})
+		}()
+	}
+	wg.Wait()
+
+	_, all, _ := tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{})
+	if all.Count != 10 || all.TotalCount != 10 {
+		t.Fatalf("Expected 10 snapshots, got count=%d total=%d", all.Count, all.TotalCount)
+	}
+	for i := 1; i < len(all.Snapshots); i++ {
+		if all.Snapshots[i].CreatedAt.After(all.Snapshots[i-1].CreatedAt) {
+			t.Error("Expected snapshots sorted newest first")
+			break
+		}
+	}
+
+	_, byProject, _ := tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{ProjectID: "project_beta"})
+	if byProject.Count != 5 || byProject.TotalCount != 10 {
+		t.Errorf("Expected 5 of 10 snapshots for project_beta, got %d of %d", byProject.Count, byProject.TotalCount)
+	}
+	for _, snapshot := range byProject.Snapshots {
+		if snapshot.SessionID != second.ID {
+			t.Errorf("Unexpected snapshot in project filter: %+v", snapshot)
+		}
+	}
+
+	_, byName, _ := tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{NameContains: "BUILD", Sort: "oldest"})
+	if byName.Count != 5 {
+		t.Errorf("Expected 5 snapshots matching 'BUILD', got %d", byName.Count)
+	}
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	_, byTime, _ := tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{CreatedAfter: future})
+	if byTime.Count != 0 {
+		t.Errorf("Expected no snapshots created after %s, got %d", future, byTime.Count)
+	}
+
+	result, _, _ := tools.ListSessionSnapshots(ctx, nil, ListSnapshotsArgs{CreatedBefore: "yesterday"})
+	if !result.IsError {
+		t.Error("Expected error for invalid created_before")
+	}
+}
+
+func TestListAllSnapshots(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.snapshotManager = NewSnapshotManager(tempDir)
+	tools.workspaceStore = NewWorkspaceSnapshotStore(tempDir)
+	ctx := context.Background()
+
+	alpha, err := manager.CreateSession("alpha", "project_alpha", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := manager.CreateSession("beta", "project_beta", tempDir); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, sessionSnapshot, err := tools.SaveSessionSnapshot(ctx, nil, SaveSessionSnapshotArgs{SessionID: alpha.ID, Name: "shared"})
+	if err != nil || result.IsError {
+		t.Fatalf("SaveSessionSnapshot failed: %v %v", err, result.Content)
+	}
+	if _, _, err := tools.SaveWorkspaceSnapshot(ctx, nil, SaveWorkspaceSnapshotArgs{Name: "shared"}); err != nil {
+		t.Fatalf("SaveWorkspaceSnapshot failed: %v", err)
+	}
+
+	_, listed, err := tools.ListAllSnapshots(ctx, nil, ListAllSnapshotsArgs{})
+	if err != nil || listed.Count != 2 || listed.TotalCount != 2 {
+		t.Fatalf("Expected both snapshots, got %+v (%v)", listed, err)
+	}
+	if listed.TotalByType[SnapshotTypeSession] != 1 || listed.TotalByType[SnapshotTypeWorkspace] != 1 {
+		t.Errorf("Unexpected totals per type: %v", listed.TotalByType)
+	}
+
+	_, listed, _ = tools.ListAllSnapshots(ctx, nil, ListAllSnapshotsArgs{Type: SnapshotTypeSession})
+	if listed.Count != 1 || listed.Snapshots[0].Type != SnapshotTypeSession || listed.CountByType[SnapshotTypeWorkspace] != 0 {
+		t.Errorf("Expected only the session snapshot, got %+v", listed)
+	}
+	if listed.Snapshots[0].RestoreTool != "restore_session_snapshot" {
+		t.Errorf("Unexpected restore tool %q", listed.Snapshots[0].RestoreTool)
+	}
+
+	// Only the workspace bundle holds a session of project_beta
+	_, listed, _ = tools.ListAllSnapshots(ctx, nil, ListAllSnapshotsArgs{ProjectID: "project_beta"})
+	if listed.Count != 1 || listed.Snapshots[0].Type != SnapshotTypeWorkspace || len(listed.Snapshots[0].SessionIDs) != 2 {
+		t.Errorf("Expected the workspace snapshot to match by project, got %+v", listed)
+	}
+
+	result, _, _ = tools.ListAllSnapshots(ctx, nil, ListAllSnapshotsArgs{Type: "template"})
+	if !result.IsError {
+		t.Error("Expected an unknown type to be rejected")
+	}
+
+	result, _, _ = tools.GetSnapshot(ctx, nil, GetSnapshotArgs{SnapshotID: "shared"})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "pass type") {
+		t.Errorf("Expected a name used by both types to be ambiguous, got %+v", result.Content)
+	}
+	_, fetched, _ := tools.GetSnapshot(ctx, nil, GetSnapshotArgs{SnapshotID: "shared", Type: SnapshotTypeWorkspace})
+	if fetched.Type != SnapshotTypeWorkspace || fetched.Workspace == nil || fetched.Session != nil || fetched.RestoreTool != "restore_workspace_snapshot" {
+		t.Errorf("Expected the workspace snapshot, got %+v", fetched)
+	}
+	_, fetched, _ = tools.GetSnapshot(ctx, nil, GetSnapshotArgs{SnapshotID: sessionSnapshot.ID})
+	if fetched.Type != SnapshotTypeSession || fetched.Session == nil || fetched.Session.SessionID != alpha.ID {
+		t.Errorf("Expected the session snapshot by ID, got %+v", fetched)
+	}
+
+	result, _, _ = tools.GetSnapshot(ctx, nil, GetSnapshotArgs{SnapshotID: "missing"})
+	if !result.IsError {
+		t.Error("Expected an unknown snapshot to be reported")
+	}
+}
+
+func TestPreviewRedaction(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	result, preview, err := tools.PreviewRedaction(ctx, nil, PreviewRedactionArgs{Text: "export API_KEY=abc123\nAuthorization: Bearer abcdefghijk"})
+	if err != nil || result.IsError {
+		t.Fatalf("PreviewRedaction failed: %v %v", err, result.Content)
+	}
+	if preview.Redacted != "export API_KEY=[REDACTED]\nAuthorization: Bearer [REDACTED]" || !preview.Changed {
+		t.Errorf("Unexpected redaction: %q", preview.Redacted)
+	}
+	if preview.PatternCounts["secret_assignment"] != 1 || preview.PatternCounts["authorization_header"] != 1 || preview.Matches[0].Line != 1 {
+		t.Errorf("Unexpected matches: %+v", preview.Matches)
+	}
+
+	_, preview, _ = tools.PreviewRedaction(ctx, nil, PreviewRedactionArgs{Text: "make build"})
+	if preview.Changed || preview.MatchCount != 0 || preview.Matches == nil {
+		t.Errorf("Expected harmless text to pass unchanged, got %+v", preview)
+	}
+
+	result, _, _ = tools.PreviewRedaction(ctx, nil, PreviewRedactionArgs{})
+	if !result.IsError {
+		t.Error("Expected empty text to be rejected")
+	}
+
+	if commands, err := tools.database.SearchCommands("", "", "", "", nil, time.Time{}, time.Time{}, nil, 0); err != nil || len(commands) != 0 {
+		t.Errorf("Expected the preview to store nothing, got %d commands (%v)", len(commands), err)
+	}
+}
+
+func TestRestoreSessionSnapshot(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.snapshotManager = NewSnapshotManager(tempDir)
+	otherServer := NewSnapshotManager(tempDir)
+	ctx := context.Background()
+
+	projectDir := filepath.Join(tempDir, "project")
+	subDir := filepath.Join(projectDir, "src")
+	if err := os.MkdirAll(subDir, 0o755); err != nil {
+		t.Fatalf("Failed to create dirs: %v", err)
+	}
+	source, err := manager.CreateSession("source", "restore_proj", projectDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	source.SetEnvironmentBatch(map[string]string{"APP_MODE": "test", "PATH": "/snapshot/bin"})
+	if err := manager.SetSessionCurrentDir(source.ID, subDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	_, saved, _ := tools.CreateSessionSnapshot(ctx, nil, CreateSnapshotArgs{SessionID: source.ID, Name: "checkpoint"})
+
+	// Restoring into an existing session overwrites colliding environment keys
+	target, err := manager.CreateSession("target", "restore_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	result, restored, _ := tools.RestoreSessionSnapshot(ctx, nil, RestoreSnapshotArgs{SnapshotID: saved.SnapshotID, TargetSessionID: target.ID})
+	if result.IsError || restored.SessionID != target.ID || restored.NewSessionID != "" {
+		t.Fatalf("Expected the snapshot restored into the target session, got %+v", restored)
+	}
+	if target.GetCurrentDir() != subDir || restored.WorkingDir != subDir {
+		t.Errorf("Expected directory %s, got %s", subDir, target.GetCurrentDir())
+	}
+	if value, _ := target.GetEnvironment("PATH"); value != "/snapshot/bin" {
+		t.Errorf("Expected PATH overwritten by the snapshot, got %q", value)
+	}
+	changes := strings.Join(restored.AppliedChanges, "\n")
+	if !strings.Contains(changes, "overwrote environment PATH") || !strings.Contains(changes, "set environment APP_MODE") {
+		t.Errorf("Expected environment changes to be listed, got %v", restored.AppliedChanges)
+	}
+
+	// Without a target a new session is created; a vanished directory falls back to home
+	if err := os.RemoveAll(subDir); err != nil {
+		t.Fatalf("Failed to remove dir: %v", err)
+	}
+	_, restored, _ = tools.RestoreSessionSnapshot(ctx, nil, RestoreSnapshotArgs{SnapshotID: "checkpoint"})
+	home, _ := os.UserHomeDir()
+	if restored.NewSessionID == "" || restored.WorkingDir != home || len(restored.Warnings) != 1 {
+		t.Errorf("Expected a new session in the home directory with a warning, got %+v", restored)
+	}
+
+	// Snapshots written after a manager loaded its directory are read from disk
+	if _, err := otherServer.loadSnapshot(saved.SnapshotID); err != nil {
+		t.Errorf("Expected snapshot to load from disk: %v", err)
+	}
+	if result, _, _ := tools.RestoreSessionSnapshot(ctx, nil, RestoreSnapshotArgs{SnapshotID: "../missing"}); !result.IsError {
+		t.Error("Expected an unknown snapshot to be rejected")
+	}
+}
+
+func TestGetEnvironmentDriftSince(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.snapshotManager = NewSnapshotManager(tempDir)
+	ctx := context.Background()
+
+	session, err := manager.CreateSession("drift", "drift_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	session.SetEnvironmentBatch(map[string]string{"APP_MODE": "test", "OLD_FLAG": "1", "API_TOKEN": "abc123"})
+	_, saved, _ := tools.CreateSessionSnapshot(ctx, nil, CreateSnapshotArgs{SessionID: session.ID, Name: "before"})
+
+	_, drift, _ := tools.GetEnvironmentDriftSince(ctx, nil, EnvironmentDriftArgs{SnapshotID: saved.SnapshotID})
+	if drift.DriftCount != 0 || drift.SessionID != session.ID {
+		t.Fatalf("Expected no drift right after the snapshot, got %+v", drift)
+	}
+
+	session.SetEnvironmentBatch(map[string]string{"APP_MODE": "prod", "NEW_VAR": "x", "API_TOKEN": "def456"})
+	session.UnsetEnvironment("OLD_FLAG")
+
+	result, drift, _ := tools.GetEnvironmentDriftSince(ctx, nil, EnvironmentDriftArgs{SnapshotID: "before", SessionID: session.ID})
+	if result.IsError {
+		t.Fatalf("Expected drift to be reported, got error")
+	}
+	if drift.DriftCount != 4 || drift.Added["NEW_VAR"] != "x" || drift.Removed["OLD_FLAG"] != "1" || len(drift.Changed) != 2 {
+		t.Fatalf("Expected 1 added, 1 removed and 2 changed, got %+v", drift)
+	}
+	for _, change := range drift.Changed {
+		switch change.Key {
+		case "API_TOKEN":
+			if change.Snapshot != redactedEnvValue || change.Current != redactedEnvValue {
+				t.Errorf("Expected secret values redacted, got %+v", change)
+			}
+		case "APP_MODE":
+			if change.Snapshot != "test" || change.Current != "prod" {
+				t.Errorf("Expected APP_MODE test -> prod, got %+v", change)
+			}
+		default:
+			t.Errorf("Unexpected change %+v", change)
+		}
+	}
+
+	result, _, _ = tools.GetEnvironmentDriftSince(ctx, nil, EnvironmentDriftArgs{SnapshotID: "missing"})
+	if !result.IsError {
+		t.Error("Expected error for an unknown snapshot")
+	}
+}
+
+func TestCancelSessionProcessChains(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("chains", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, started, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "servers",
+		Processes: []ChainedProcess{{Name: "a", Command: "sleep 30"}, {Name: "b", Command: "sleep 30"}},
+	})
+	_, pending, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "later",
+		Processes: []ChainedProcess{{Name: "c", Command: "sleep 30"}},
+	})
+	if started.ChainID == "" || pending.ChainID == "" {
+		t.Fatal("Failed to create process chains")
+	}
+
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: started.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		chain, _ := tools.dependencyManager.ChainSnapshot(started.ChainID)
+		if chain.Status == "completed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Chain did not start all processes, status %s", chain.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	_, result, err := tools.CancelSessionProcessChains(ctx, nil, CancelSessionProcessChainsArgs{SessionID: session.ID, Force: true})
+	if err != nil {
+		t.Fatalf("CancelSessionProcessChains failed: %v", err)
+	}
+	if result.ChainsCancelled != 2 || result.ProcessesStopped != 2 || len(result.Errors) != 0 {
+		t.Fatalf("Expected 2 chains cancelled and 2 processes stopped, got %+v", result)
+	}
+
+	for _, chainID := range []string{started.ChainID, pending.ChainID} {
+		if chain, _ := tools.dependencyManager.ChainSnapshot(chainID); chain.Status != "cancelled" {
+			t.Errorf("Expected chain %s to be cancelled, got %s", chainID, chain.Status)
+		}
+	}
+	if processes, _ := manager.GetAllBackgroundProcesses(session.ID, ""); len(processes[session.ID]) != 0 {
+		t.Errorf("Expected no background processes left, got %d", len(processes[session.ID]))
+	}
+
+	// A second call finds nothing left to cancel
+	_, result, _ = tools.CancelSessionProcessChains(ctx, nil, CancelSessionProcessChainsArgs{SessionID: session.ID})
+	if result.ChainsCancelled != 0 {
+		t.Errorf("Expected no chains on second cancel, got %d", result.ChainsCancelled)
+	}
+}
+
+func TestGetProcessChainGraph(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("chain-graph", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	_, created, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "stack",
+		Processes: []ChainedProcess{
+			{Name: "db", Command: "sleep 30"},
+			{Name: `api "v2"`, Command: "sleep 30", WaitSeconds: 1},
+		},
+	})
+	if created.ChainID == "" {
+		t.Fatal("Failed to create process chain")
+	}
+
+	result, graph, err := tools.GetProcessChainGraph(ctx, nil, GetProcessChainGraphArgs{ChainID: created.ChainID, Format: "dot"})
+	if err != nil || result.IsError {
+		t.Fatalf("GetProcessChainGraph failed: %v %v", err, result.Content)
+	}
+	if graph.Started || len(graph.Nodes) != 2 || len(graph.Edges) != 1 {
+		t.Fatalf("Unexpected graph before start: %+v", graph)
+	}
+	if edge := graph.Edges[0]; edge.From != "step0" || edge.To != "step1" || edge.Condition != "still running" {
+		t.Errorf("Unexpected edge %+v", edge)
+	}
+	if len(graph.Nodes[0].DependsOn) != 0 || !slices.Equal(graph.Nodes[1].DependsOn, []string{"step0"}) {
+		t.Errorf("Expected the second step to depend on the first, got %+v", graph.Nodes)
+	}
+	if graph.Nodes[1].Readiness != "1s elapsed, then still running" || graph.Nodes[0].Status != "pending" || graph.Nodes[0].ProcessID != "" {
+		t.Errorf("Unexpected node %+v", graph.Nodes[1])
+	}
+	if !strings.Contains(graph.DOT, "step0 -> step1") || !strings.Contains(graph.DOT, `api \"v2\"`) {
+		t.Errorf("Unexpected DOT output:\n%s", graph.DOT)
+	}
+
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+	defer tools.CancelSessionProcessChains(ctx, nil, CancelSessionProcessChainsArgs{SessionID: session.ID, Force: true})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, graph, _ = tools.GetProcessChainGraph(ctx, nil, GetProcessChainGraphArgs{ChainID: created.ChainID})
+		if graph.Status == "completed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Chain did not complete, status %s", graph.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !graph.Started || graph.DOT != "" {
+		t.Errorf("Expected a started chain without DOT output, got %+v", graph)
+	}
+	for _, node := range graph.Nodes {
+		if node.Status != "ready" || node.ProcessID == "" {
+			t.Errorf("Expected each step ready with a process ID, got %+v", node)
+		}
+	}
+
+	if result, _, _ := tools.GetProcessChainGraph(ctx, nil, GetProcessChainGraphArgs{ChainID: created.ChainID, Format: "svg"}); !result.IsError {
+		t.Error("Expected an invalid format to be rejected")
+	}
+	if result, _, _ := tools.GetProcessChainGraph(ctx, nil, GetProcessChainGraphArgs{ChainID: "missing"}); !result.IsError {
+		t.Error("Expected an unknown chain to be rejected")
+	}
+}
+
+func TestProcessChainDependencies(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("chain-deps", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer tools.CancelSessionProcessChains(ctx, nil, CancelSessionProcessChainsArgs{SessionID: session.ID, Force: true})
+
+	invalid := map[string][]ChainedProcess{
+		"cycle": {
+			{Name: "a", Command: "true", DependsOn: []string{"c"}},
+			{Name: "b", Command: "true", DependsOn: []string{"a"}},
+			{Name: "c", Command: "true", DependsOn: []string{"b"}},
+		},
+		"unknown dependency": {{Name: "a", Command: "true", DependsOn: []string{"missing"}}},
+		"self dependency":    {{Name: "a", Command: "true", DependsOn: []string{"a"}}},
+		"duplicate names":    {{Name: "a", Command: "true"}, {Name: "a", Command: "true", DependsOn: []string{"a"}}},
+	}
+	for name, processes := range invalid {
+		if result, _, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{SessionID: session.ID, Name: "invalid", Processes: processes}); !result.IsError {
+			t.Errorf("Expected a chain with a %s to be rejected", name)
+		}
+	}
+	if _, err := chainDependencies(invalid["cycle"]); err == nil || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("Expected the cycle to be named, got %v", err)
+	}
+
+	// The database and cache start together; the app waits for both. Background commands are
+	// not run through a shell, so tail -f stands in for the servers and the test decides when
+	// each becomes ready by writing to its log.
+	logs := map[string]string{"db": filepath.Join(tempDir, "db.log"), "cache": filepath.Join(tempDir, "cache.log")}
+	for _, path := range logs {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write log file: %v", err)
+		}
+	}
+	_, created, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "stack",
+		Processes: []ChainedProcess{
+			{Name: "db", Command: "tail -f " + logs["db"], ReadyPattern: "db ready", ReadyTimeout: 10},
+			{Name: "cache", Command: "tail -f " + logs["cache"], ReadyPattern: "cache ready", ReadyTimeout: 10},
+			{Name: "app", Command: "sleep 30", DependsOn: []string{"db", "cache"}, BlockedOn: []string{"made up"}},
+		},
+	})
+	if created.ChainID == "" {
+		t.Fatal("Failed to create process chain")
+	}
+	// blocked_on is output only, so a value passed in is dropped
+	if stored, _ := tools.dependencyManager.ChainSnapshot(created.ChainID); stored.Processes[2].BlockedOn != nil {
+		t.Errorf("Expected blocked_on passed to create_process_chain to be dropped, got %v", stored.Processes[2].BlockedOn)
+	}
+	_, graph, _ := tools.GetProcessChainGraph(ctx, nil, GetProcessChainGraphArgs{ChainID: created.ChainID})
+	if len(graph.Edges) != 2 || len(graph.Nodes[1].DependsOn) != 0 || !slices.Equal(graph.Nodes[2].DependsOn, []string{"step0", "step1"}) {
+		t.Errorf("Expected the app to depend on the database and cache only, got %+v", graph)
+	}
+
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+	waitForChain := func(done func(chain *ProcessChain) bool) *ProcessChain {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, chain, _ := tools.GetProcessChainStatus(ctx, nil, GetProcessChainStatusArgs{ChainID: created.ChainID})
+			if done(chain) {
+				return chain
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Chain did not reach the expected state: %+v", chain)
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+	}
+
+	chain := waitForChain(func(chain *ProcessChain) bool {
+		return chain.Processes[0].Status == "running" && chain.Processes[1].Status == "running"
+	})
+	if app := chain.Processes[2]; app.Status != "pending" || !slices.Equal(app.BlockedOn, []string{"db", "cache"}) {
+		t.Errorf("Expected the app blocked on the database and cache, got %+v", app)
+	}
+
+	if err := os.WriteFile(logs["db"], []byte("db ready\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	chain = waitForChain(func(chain *ProcessChain) bool { return chain.Processes[0].Status == "ready" })
+	if app := chain.Processes[2]; app.Status != "pending" || !slices.Equal(app.BlockedOn, []string{"cache"}) {
+		t.Errorf("Expected the app blocked on the cache only, got %+v", app)
+	}
+
+	if err := os.WriteFile(logs["cache"], []byte("cache ready\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	chain = waitForChain(func(chain *ProcessChain) bool { return chain.Status != "running" })
+	if chain.Status != "completed" {
+		t.Fatalf("Expected the chain to complete, got %s: %s", chain.Status, chain.Error)
+	}
+	for _, proc := range chain.Processes {
+		if proc.Status != "ready" || proc.ProcessID == "" || len(proc.BlockedOn) != 0 {
+			t.Errorf("Expected each step ready, got %+v", proc)
+		}
+	}
+	tools.CancelSessionProcessChains(ctx, nil, CancelSessionProcessChainsArgs{SessionID: session.ID, Force: true})
+
+	// A failed dependency keeps its dependents from starting
+	_, created, _ = tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "broken",
+		Processes: []ChainedProcess{
+			{Name: "db", Command: "false", ReadyPattern: "never printed", ReadyTimeout: 2},
+			{Name: "app", Command: "sleep 30", DependsOn: []string{"db"}},
+		},
+	})
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+	chain = waitForChain(func(chain *ProcessChain) bool { return chain.Status != "running" })
+	if app := chain.Processes[1]; chain.Status != "failed" || app.Status != "pending" || app.ProcessID != "" || !slices.Equal(app.BlockedOn, []string{"db"}) {
+		t.Errorf("Expected the chain to fail without starting the app, got %+v", chain)
+	}
+}
+
+func TestStopProcessChain(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("chain-stop", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	if order := chainStopOrder([][]int{nil, {0}, {1}}); !slices.Equal(order, []int{2, 1, 0}) {
+		t.Errorf("Expected a sequential chain stopped last step first, got %v", order)
+	}
+
+	waitForChain := func(chainID string, done func(chain *ProcessChain) bool) *ProcessChain {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, chain, _ := tools.GetProcessChainStatus(ctx, nil, GetProcessChainStatusArgs{ChainID: chainID})
+			if done(chain) {
+				return chain
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Chain did not reach the expected state: %+v", chain)
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+	}
+
+	// Background commands are not run through a shell, so tail -f stands in for the servers
+	dbLog := filepath.Join(tempDir, "db.log")
+	if err := os.WriteFile(dbLog, []byte("db ready\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	_, created, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "stack",
+		Processes: []ChainedProcess{
+			{Name: "app", Command: "sleep 30", DependsOn: []string{"db", "cache"}},
+			{Name: "db", Command: "tail -f " + dbLog, ReadyPattern: "db ready"},
+			{Name: "cache", Command: "sleep 30"},
+		},
+	})
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+	waitForChain(created.ChainID, func(chain *ProcessChain) bool { return chain.Status == "completed" })
+
+	result, stopped, _ := tools.StopProcessChain(ctx, nil, StopProcessChainArgs{ChainID: created.ChainID})
+	if result.IsError || stopped.PreviousStatus != "completed" || len(stopped.Terminated) != 3 || len(stopped.Failed) != 0 {
+		t.Fatalf("Expected all three processes terminated, got %+v", stopped)
+	}
+	if stopped.Terminated[0].Name != "app" {
+		t.Errorf("Expected the app stopped before its dependencies, got %+v", stopped.Terminated)
+	}
+	_, chain, _ := tools.GetProcessChainStatus(ctx, nil, GetProcessChainStatusArgs{ChainID: created.ChainID})
+	if chain.Status != "stopped" {
+		t.Errorf("Expected the chain marked stopped, got %s", chain.Status)
+	}
+	for _, proc := range chain.Processes {
+		bgProc, err := manager.GetBackgroundProcess(session.ID, proc.ProcessID)
+		if proc.Status != "stopped" || (err == nil && bgProc.IsRunning) {
+			t.Errorf("Expected %s stopped, got status %s", proc.Name, proc.Status)
+		}
+	}
+	if result, _, _ := tools.StopProcessChain(ctx, nil, StopProcessChainArgs{ChainID: created.ChainID}); !result.IsError {
+		t.Error("Expected stopping a stopped chain to be rejected")
+	}
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); !result.IsError {
+		t.Error("Expected a stopped chain not to start again")
+	}
+
+	// Stopped mid-startup: the app never starts once its dependency is terminated
+	slowLog := filepath.Join(tempDir, "slow.log")
+	if err := os.WriteFile(slowLog, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	_, created, _ = tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "starting",
+		Processes: []ChainedProcess{
+			{Name: "db", Command: "tail -f " + slowLog, ReadyPattern: "db ready", ReadyTimeout: 10},
+			{Name: "app", Command: "sleep 30"},
+		},
+	})
+	if result, _, _ := tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: created.ChainID}); result.IsError {
+		t.Fatalf("Failed to start chain: %v", result.Content)
+	}
+	waitForChain(created.ChainID, func(chain *ProcessChain) bool { return chain.Processes[0].Status == "running" })
+
+	_, stopped, _ = tools.StopProcessChain(ctx, nil, StopProcessChainArgs{ChainID: created.ChainID})
+	if stopped.PreviousStatus != "running" || len(stopped.Terminated) != 1 || !slices.Equal(stopped.NotStarted, []string{"app"}) {
+		t.Fatalf("Expected the database terminated and the app not started, got %+v", stopped)
+	}
+	time.Sleep(200 * time.Millisecond)
+	_, chain, _ = tools.GetProcessChainStatus(ctx, nil, GetProcessChainStatusArgs{ChainID: created.ChainID})
+	if chain.Status != "stopped" || chain.Processes[1].Status != "cancelled" || chain.Processes[1].ProcessID != "" {
+		t.Errorf("Expected the chain to stay stopped with the app cancelled, got %+v", chain)
+	}
+
+	if result, _, _ := tools.StopProcessChain(ctx, nil, StopProcessChainArgs{ChainID: "missing"}); !result.IsError {
+		t.Error("Expected an unknown chain to be rejected")
+	}
+}
+
+func TestBackgroundReadinessWait(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	// Waits without an explicit timeout use the configured default
+	tools.config.Session.DefaultReadinessTimeout = 500 * time.Millisecond
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("readiness", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	// Background commands are not run through a shell, so use tail -f as a long-running server
+	logFile := filepath.Join(tempDir, "server.log")
+	if err := os.WriteFile(logFile, []byte("server listening on 8080\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	_, ready, err := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:    session.ID,
+		Command:      "tail -f " + logFile,
+		ReadyPattern: "listening on [0-9]+",
+		ReadyTimeout: 5,
+	})
+	if err != nil {
+		t.Fatalf("RunBackgroundProcess failed: %v", err)
+	}
+	if ready.Ready == nil || !*ready.Ready || ready.ReadyMatch != "listening on 8080" {
+		t.Errorf("Expected process to become ready, got %+v", ready)
+	}
+
+	// wait_for_pattern is the same option; output printed long before the wait still counts
+	_, ready, _ = tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:      session.ID,
+		Command:        "tail -f " + logFile,
+		WaitForPattern: "listening on [0-9]+",
+		ReadyTimeout:   5,
+	})
+	if ready.Ready == nil || !*ready.Ready {
+		t.Errorf("Expected wait_for_pattern to see the process become ready, got %+v", ready)
+	}
+	manager.TerminateBackgroundProcess(session.ID, ready.ProcessID, true)
+
+	conflict, _, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:      session.ID,
+		Command:        "sleep 10",
+		WaitForPattern: "ready",
+		ReadyPattern:   "listening",
+	})
+	if !conflict.IsError {
+		t.Error("Expected different wait_for_pattern and ready_pattern to be rejected")
+	}
+
+	start := time.Now()
+	_, notReady, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:    session.ID,
+		Command:      "sleep 10",
+		ReadyPattern: "never printed",
+	})
+	if notReady.Ready == nil || *notReady.Ready || !notReady.Success {
+		t.Errorf("Expected running process that is not ready, got %+v", notReady)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected default readiness timeout of 500ms, waited %s", elapsed)
+	}
+
+	result, _, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:    session.ID,
+		Command:      "sleep 10",
+		ReadyPattern: "([",
+	})
+	if !result.IsError {
+		t.Error("Expected invalid ready_pattern to be rejected")
+	}
+
+	// Chains apply the same default when a process has no ready_timeout
+	_, chain, _ := tools.CreateProcessChain(ctx, nil, CreateProcessChainArgs{
+		SessionID: session.ID,
+		Name:      "slow",
+		Processes: []ChainedProcess{{Name: "server", Command: "sleep 10", ReadyPattern: "never printed"}},
+	})
+	tools.StartProcessChain(ctx, nil, StartProcessChainArgs{ChainID: chain.ChainID})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		status, _ := tools.dependencyManager.ChainSnapshot(chain.ChainID)
+		if status.Status == "failed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected chain to fail readiness within the default timeout, status %s", status.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestBackgroundAutoRestart(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("restart", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	if result, _, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "false", MaxRestarts: 2}); !result.IsError {
+		t.Error("Expected max_restarts without auto_restart to be rejected")
+	}
+
+	result, started, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID:             session.ID,
+		Command:               "false",
+		AutoRestart:           true,
+		MaxRestarts:           1,
+		RestartBackoffSeconds: 1,
+	})
+	if result.IsError {
+		t.Fatalf("Failed to start background process: %v", result.Content)
+	}
+
+	var check CheckBackgroundProcessResult
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, check, _ = tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID})
+		if check.Status == "failed" && check.RestartCount == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !check.AutoRestart || check.RestartCount != 1 || check.MaxRestarts != 1 || len(check.Restarts) != 1 || check.Status != "failed" {
+		t.Errorf("Expected one recorded restart before failing, got %+v", check)
+	}
+}
+
+func TestGetSessionReport(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("report", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	// ExecuteCommand records each run in the history database
+	for _, command := range []string{"echo one", "echo one", "ls", "ls /nonexistent-report-dir"} {
+		manager.ExecuteCommand(session.ID, command)
+	}
+	if result, _, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "sleep 5"}); result.IsError {
+		t.Fatalf("Failed to start background process: %v", result.Content)
+	}
+
+	result, response, err := tools.GetSessionReport(ctx, nil, GetSessionReportArgs{SessionID: session.ID, TopN: 1})
+	if err != nil || result.IsError {
+		t.Fatalf("GetSessionReport failed: %v %v", err, result.Content)
+	}
+
+	report := response.Report
+	if report.TotalCommands != 4 || report.FailedCommands != 1 || report.HistoryAnalyzed != 4 || report.ErrorCategories["not_found"] != 1 {
+		t.Errorf("Unexpected command counts: %+v", report)
+	}
+	if len(report.CommandTypes) != 2 || report.CommandTypes[0].Type != "echo" {
+		t.Errorf("Unexpected command types: %+v", report.CommandTypes)
+	}
+	for _, entry := range report.CommandTypes {
+		if entry.Type == "ls" && entry.Failures != 1 {
+			t.Errorf("Expected one ls failure, got %+v", entry)
+		}
+	}
+	if len(report.TopCommands) != 1 || report.TopCommands[0].Command != "echo one" || report.TopCommands[0].Count != 2 {
+		t.Errorf("Unexpected top commands: %+v", report.TopCommands)
+	}
+	if len(report.KeyFailures) != 1 || report.KeyFailures[0].Command != "ls /nonexistent-report-dir" || report.KeyFailures[0].ErrorSnippet == "" {
+		t.Errorf("Unexpected key failures: %+v", report.KeyFailures)
+	}
+	if len(report.KeySuccesses) != 1 {
+		t.Errorf("Expected one key success with top_n 1, got %d", len(report.KeySuccesses))
+	}
+	if len(report.DirectoriesTouched) != 1 {
+		t.Errorf("Expected one directory touched, got %v", report.DirectoriesTouched)
+	}
+	if len(report.BackgroundProcesses) != 1 || report.BackgroundProcesses[0].Command != "sleep 5" {
+		t.Errorf("Unexpected background processes: %+v", report.BackgroundProcesses)
+	}
+
+	// Same state, same report
+	_, again, _ := tools.GetSessionReport(ctx, nil, GetSessionReportArgs{SessionID: session.ID, TopN: 1})
+	if fmt.Sprint(again.Report.CommandTypes, again.Report.TopCommands, again.Report.KeyFailures) != fmt.Sprint(report.CommandTypes, report.TopCommands, report.KeyFailures) {
+		t.Error("Expected report to be deterministic")
+	}
+
+	if result, _, _ := tools.GetSessionReport(ctx, nil, GetSessionReportArgs{SessionID: "00000000-0000-4000-8000-000000000000"}); !result.IsError {
+		t.Error("Expected error for unknown session")
+	}
+
+	// A long multi-byte error is cut on a character boundary
+	entry := toReportCommand(&database.CommandRecord{ErrorOutput: "x" + strings.Repeat("é", reportErrorSnippetLength)})
+	if !utf8.ValidString(entry.ErrorSnippet) || !strings.HasSuffix(entry.ErrorSnippet, "é...") {
+		t.Errorf("Expected a valid UTF-8 snippet, got %q", entry.ErrorSnippet)
+	}
+}
+
+func TestGetSessionRecentCommands(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("recent", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	for _, command := range []string{"echo first", "echo second"} {
+		if result, _, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: command}); result.IsError {
+			t.Fatalf("RunCommand failed: %v", result.Content)
+		}
+	}
+
+	result, recent, err := tools.GetSessionRecentCommands(ctx, nil, GetSessionRecentCommandsArgs{SessionID: session.ID, Limit: 1})
+	if err != nil || result.IsError {
+		t.Fatalf("GetSessionRecentCommands failed: %v %v", err, result.Content)
+	}
+	if recent.Count != 1 || recent.Commands[0].Command != "echo second" || recent.Commands[0].Output != "second\n" || recent.Capacity != tools.config.Session.RecentCommandsLimit {
+		t.Errorf("Unexpected recent commands: %+v", recent)
+	}
+}
+
+func TestGetManagerDiagnostics(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	if result, _, _ := tools.GetManagerDiagnostics(ctx, nil, GetManagerDiagnosticsArgs{}); !result.IsError {
+		t.Error("Expected diagnostics to require debug mode")
+	}
+
+	tools.config.Server.Debug = true
+	session, err := manager.CreateSession("diagnostics", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+	if _, err := manager.ExecuteCommandInBackground(session.ID, "sleep 5"); err != nil {
+		t.Fatalf("Failed to start background process: %v", err)
+	}
+	if err := tools.CheckRateLimit(session.ID); err != nil {
+		t.Fatalf("Expected the call to be allowed: %v", err)
+	}
+
+	result, diag, err := tools.GetManagerDiagnostics(ctx, nil, GetManagerDiagnosticsArgs{})
+	if err != nil || result.IsError {
+		t.Fatalf("GetManagerDiagnostics failed: %v %v", err, result.Content)
+	}
+	if diag.Manager.Sessions != 1 || diag.Manager.ActiveSessions != 1 || diag.Manager.BackgroundProcesses != 1 {
+		t.Errorf("Unexpected manager counters: %+v", diag.Manager)
+	}
+	if diag.Manager.Goroutines == 0 || !diag.Manager.DatabaseAttached || diag.Manager.ShuttingDown {
+		t.Errorf("Unexpected manager state: %+v", diag.Manager)
+	}
+	if !diag.Manager.CleanupRoutine.Running || !diag.Manager.ResourceCleanupRoutine.Running {
+		t.Errorf("Expected cleanup routines to be running: %+v", diag.Manager)
+	}
+	if diag.ResourceMonitor == nil || len(diag.RateLimiters) != 1 || diag.RateLimiters[0].Category != "session:"+session.ID ||
+		diag.RateLimiters[0].Burst != tools.config.Session.RateLimitBurst {
+		t.Errorf("Expected resource monitor and session rate limiter snapshots, got %+v %+v", diag.ResourceMonitor, diag.RateLimiters)
+	}
+}
+
+func TestSimulateResourcePressure(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	args := SimulateResourcePressureArgs{Confirm: true, Goroutines: 150, MemoryMB: 8, Sessions: 2, BackgroundProcesses: 2, RunCleanup: true}
+	if result, _, _ := tools.SimulateResourcePressure(ctx, nil, args); !result.IsError {
+		t.Error("Expected simulation to require debug mode")
+	}
+
+	tools.config.Server.Debug = true
+	if result, _, _ := tools.SimulateResourcePressure(ctx, nil, SimulateResourcePressureArgs{Goroutines: 10}); !result.IsError {
+		t.Error("Expected simulation to require confirmation")
+	}
+	if result, _, _ := tools.SimulateResourcePressure(ctx, nil, SimulateResourcePressureArgs{Confirm: true, MemoryMB: maxSimulatedMemoryMB + 1}); !result.IsError {
+		t.Error("Expected oversized memory_mb to be rejected")
+	}
+
+	result, simulation, err := tools.SimulateResourcePressure(ctx, nil, args)
+	if err != nil || result.IsError {
+		t.Fatalf("SimulateResourcePressure failed: %v %v", err, result.Content)
+	}
+	if simulation.Applied != (SimulatedPressure{Goroutines: 150, MemoryMB: 8, Sessions: 2, BackgroundProcesses: 2}) {
+		t.Errorf("Unexpected applied pressure: %+v", simulation.Applied)
+	}
+	if len(simulation.LeaksDetected) != 1 || simulation.LeaksDetected[0] != "goroutine" {
+		t.Errorf("Expected the goroutine leak check to fire, got %v", simulation.LeaksDetected)
+	}
+	if !simulation.CleanupRan {
+		t.Error("Expected the cleanup pass to run")
+	}
+	if during, before := simulation.During["active_sessions"].(int), simulation.Before["active_sessions"].(int); during != before+2 {
+		t.Errorf("Expected 2 extra sessions during the simulation, got %d before and %d during", before, during)
+	}
+	if after := simulation.After["active_sessions"].(int); after != 0 {
+		t.Errorf("Expected dummy sessions to be removed, got %d", after)
+	}
+	if len(manager.ListSessions()) != 0 {
+		t.Errorf("Expected no sessions after the simulation, got %d", len(manager.ListSessions()))
+	}
+}
+
+func TestValidateHelpers(t *testing.T) {
+	// Test validateSessionName
+	tests := []struct {
+		name        string
+		sessionName string
+		expectError bool
+	}{
+		{"valid name", "test-session", false},
+		{"valid with underscores", "test_session_123", false},
+		{"empty name", "", true},
+		{"too short", "ab", false},
+		{"too long", string(make([]byte, 200)), true},
+		{"invalid characters", "test session!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSessionName(tt.sessionName)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for session name '%s'", tt.sessionName)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error for session name '%s', got: %v", tt.sessionName, err)
+			}
+		})
+	}
+
+	// Test validateSessionID
+	validUUID := "123e4567-e89b-12d3-a456-426614174000"
+	invalidUUID := "not-a-uuid"
+
+	if err := validateSessionID(validUUID); err != nil {
+		t.Errorf("Expected valid UUID to pass validation, got: %v", err)
+	}
+
+	if err := validateSessionID(invalidUUID); err == nil {
+		t.Error("Expected invalid UUID to fail validation")
+	}
+}
+
+func TestCreateJSONResult(t *testing.T) {
+	testData := map[string]interface{}{
+		"test": "value",
+		"num":  42,
+	}
+
+	result := createJSONResult(testData)
+
+	if result.IsError {
+		t.Error("Expected result to not be an error")
+	}
+
+	if len(result.Content) != 1 {
+		t.Errorf("Expected 1 content item, got %d", len(result.Content))
+	}
+}
+
+func TestCreateErrorResult(t *testing.T) {
+	errorMsg := "test error message"
+	result := createErrorResult(errorMsg)
+
+	if !result.IsError {
+		t.Error("Expected result to be an error")
+	}
+
+	if len(result.Content) != 1 {
+		t.Errorf("Expected 1 content item, got %d", len(result.Content))
+	}
+
+	textContent, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Error("Expected text content")
+	}
+
+	if textContent.Text != "Error: "+errorMsg {
+		t.Errorf("Expected error message 'Error: %s', got '%s'", errorMsg, textContent.Text)
+	}
+}
+
+func TestKillProcessByPID(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("killpid", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	defer manager.TerminateAllBackgroundProcesses(session.ID, true, 0)
+
+	// Background commands run without a shell, so spawn one explicitly to get an untracked child
+	result, started, _ := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{
+		SessionID: session.ID,
+		Command:   "sh -c sleep${IFS}30&wait",
+	})
+	if result.IsError {
+		t.Fatalf("Failed to start background process: %v", result.Content)
+	}
+
+	var parentPID, childPID int
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && childPID == 0 {
+		_, check, _ := tools.CheckBackgroundProcess(ctx, nil, CheckBackgroundProcessArgs{SessionID: session.ID, ProcessID: started.ProcessID})
+		parentPID = check.PID
+		if parentPID > 0 {
+			if out, err := exec.Command("pgrep", "-P", strconv.Itoa(parentPID)).Output(); err == nil {
+				childPID, _ = strconv.Atoi(strings.Fields(string(out))[0])
+			}
+		}
+		if childPID == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	if childPID == 0 {
+		t.Fatal("Background process did not spawn a child")
+	}
+
+	for _, pid := range []int{1, os.Getpid(), parentPID} {
+		if result, _, _ := tools.KillProcessByPID(ctx, nil, KillProcessByPIDArgs{SessionID: session.ID, PID: pid}); !result.IsError {
+			t.Errorf("Expected PID %d to be refused", pid)
+		}
+	}
+
+	if result, _, _ := tools.KillProcessByPID(ctx, nil, KillProcessByPIDArgs{SessionID: session.ID, PID: childPID, Signal: "SIGFOO"}); !result.IsError {
+		t.Error("Expected unsupported signal to be rejected")
+	}
+
+	result, killed, _ := tools.KillProcessByPID(ctx, nil, KillProcessByPIDArgs{SessionID: session.ID, PID: childPID, Signal: "kill"})
+	if result.IsError {
+		t.Fatalf("Expected child PID to be killed: %v", result.Content)
+	}
+	if !killed.Killed || killed.AncestorPID != parentPID || killed.Signal != "SIGKILL" {
+		t.Errorf("Unexpected kill result: %+v", killed)
+	}
+}
+
+func TestBlockedCommandHistory(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("blocked", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if result, _, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "shutdown now"}); !result.IsError {
+		t.Fatal("Expected shutdown to be blocked")
+	}
+	if result, _, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo allowed"}); result.IsError {
+		t.Fatalf("Expected echo to be allowed: %v", result.Content)
+	}
+
+	_, history, _ := tools.GetBlockedCommandHistory(ctx, nil, GetBlockedCommandHistoryArgs{SessionID: session.ID})
+	if history.Count != 1 || history.Blocked[0].Command != "shutdown now" || history.Blocked[0].Source != "run_command" {
+		t.Fatalf("Expected the blocked shutdown to be recorded, got %+v", history)
+	}
+	if history.Blocked[0].RuleType == "" || history.RuleTypeCounts[history.Blocked[0].RuleType] != 1 {
+		t.Errorf("Expected the matched rule type to be counted, got %+v", history.RuleTypeCounts)
+	}
+
+	_, cleared, _ := tools.ClearBlockedHistory(ctx, nil, ClearBlockedHistoryArgs{SessionID: session.ID})
+	if cleared.Cleared != 1 {
+		t.Errorf("Expected 1 record cleared, got %d", cleared.Cleared)
+	}
+	if _, history, _ = tools.GetBlockedCommandHistory(ctx, nil, GetBlockedCommandHistoryArgs{}); history.Count != 0 {
+		t.Errorf("Expected empty history after clearing, got %d", history.Count)
+	}
+}
+
+func TestGetSessionEvents(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	kept, err := manager.CreateSession("kept", "events_project", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	deleted, err := manager.CreateSession("deleted", "events_project", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.CloseSession(deleted.ID); err != nil {
+		t.Fatalf("Failed to close session: %v", err)
+	}
+
+	_, events, _ := tools.GetSessionEvents(ctx, nil, GetSessionEventsArgs{ProjectID: "events_project"})
+	if events.Count != 3 || events.EventCounts["created"] != 2 || events.EventCounts["closed"] != 1 {
+		t.Fatalf("Expected 2 created and 1 closed event, got %+v", events)
+	}
+	if !events.Enabled || events.Retention == "" {
+		t.Errorf("Expected recording enabled with a retention, got %+v", events)
+	}
+	if events.Events[0].SessionID != deleted.ID || events.Events[0].Reason != "requested" {
+		t.Errorf("Expected the close to be the newest event, got %+v", events.Events[0])
+	}
+
+	_, events, _ = tools.GetSessionEvents(ctx, nil, GetSessionEventsArgs{SessionID: kept.ID, Event: "created"})
+	if events.Count != 1 || events.Events[0].SessionName != "kept" {
+		t.Errorf("Expected the kept session's created event, got %+v", events)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if _, events, _ = tools.GetSessionEvents(ctx, nil, GetSessionEventsArgs{StartTime: future}); events.Count != 0 {
+		t.Errorf("Expected no events after %s, got %d", future, events.Count)
+	}
+
+	if result, _, _ := tools.GetSessionEvents(ctx, nil, GetSessionEventsArgs{Event: "renamed"}); !result.IsError {
+		t.Error("Expected an unknown event to be rejected")
+	}
+	if result, _, _ := tools.GetSessionEvents(ctx, nil, GetSessionEventsArgs{StartTime: "yesterday"}); !result.IsError {
+		t.Error("Expected an invalid start_time to be rejected")
+	}
+}
+
+func TestDiagnoseEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script executables are not supported on Windows")
+	}
+
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	projectDir := filepath.Join(tempDir, "project")
+	binDir := filepath.Join(tempDir, "bin")
+	for _, dir := range []string{projectDir, binDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "go.mod"), []byte("module example.com/demo\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "git"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("Failed to create fake git: %v", err)
+	}
+
+	session, err := manager.CreateSession("diagnose", "", projectDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	missingDir := filepath.Join(tempDir, "missing")
+	session.SetEnvironment("PATH", strings.Join([]string{binDir, missingDir}, string(os.PathListSeparator)))
+	session.SetEnvironment("GOPATH", filepath.Join(tempDir, "gopath"))
+	session.SetEnvironment("VIRTUAL_ENV", "password=hunter2")
+
+	ctx := context.Background()
+	_, diag, _ := tools.DiagnoseEnvironment(ctx, nil, DiagnoseEnvironmentArgs{SessionID: session.ID, Tools: []string{"cargo"}})
+	if diag.ProjectType != "go" || diag.Shell == "" {
+		t.Errorf("Expected a go project with a shell, got %+v", diag)
+	}
+	foundGit := false
+	for _, tool := range diag.Tools {
+		if tool.Name == "git" {
+			foundGit = tool.Found && tool.Path == filepath.Join(binDir, "git")
+		}
+	}
+	if !foundGit {
+		t.Errorf("Expected git to be found on the session's PATH, got %+v", diag.Tools)
+	}
+	for _, name := range []string{"go", "cargo", "node"} {
+		if !slices.Contains(diag.Missing, name) {
+			t.Errorf("Expected %s to be missing, got %v", name, diag.Missing)
+		}
+	}
+	if len(diag.PathEntries) != 2 || !diag.PathEntries[0].Exists || diag.PathEntries[1].Exists {
+		t.Errorf("Expected the missing PATH directory to be flagged, got %+v", diag.PathEntries)
+	}
+	issues := strings.Join(diag.Issues, "\n")
+	if !strings.Contains(issues, missingDir) || !strings.Contains(issues, "go project but go not found") {
+		t.Errorf("Expected issues for the missing directory and toolchain, got %v", diag.Issues)
+	}
+	if diag.Variables["GOPATH"] != filepath.Join(tempDir, "gopath") || diag.Variables["VIRTUAL_ENV"] != redactedEnvValue {
+		t.Errorf("Expected GOPATH reported and the secret-looking value redacted, got %v", diag.Variables)
+	}
+
+	if result, _, _ := tools.DiagnoseEnvironment(ctx, nil, DiagnoseEnvironmentArgs{SessionID: session.ID, Tools: []string{"../bin/sh"}}); !result.IsError {
+		t.Error("Expected a tool path to be rejected")
+	}
+}
+
+func TestCheckSessionHealth(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("health", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, check, _ := tools.CheckSessionHealth(ctx, nil, CheckSessionHealthArgs{SessionID: session.ID})
+	if !check.Usable || !check.Health.ShellAlive || !check.Health.PipesOpen || check.Restarted {
+		t.Fatalf("Expected a new session to be healthy, got %+v", check)
+	}
+
+	oldPID := check.Health.ShellPID
+	shellProcess, err := os.FindProcess(oldPID)
+	if err == nil {
+		err = shellProcess.Kill()
+	}
+	if err != nil {
+		t.Fatalf("Failed to kill shell: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, check, _ = tools.CheckSessionHealth(ctx, nil, CheckSessionHealthArgs{SessionID: session.ID}); !check.Health.ShellAlive {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if check.Usable || check.Health.ShellAlive || len(check.Health.Issues) == 0 {
+		t.Fatalf("Expected the dead shell to be reported, got %+v", check)
+	}
+
+	_, list, _ := tools.ListSessions(ctx, nil, ListSessionsArgs{})
+	if len(list.Sessions) != 1 || list.Sessions[0].ShellHealthy {
+		t.Errorf("Expected list_terminal_sessions to report the unhealthy shell, got %+v", list.Sessions)
+	}
+
+	_, check, _ = tools.CheckSessionHealth(ctx, nil, CheckSessionHealthArgs{SessionID: session.ID, RestartShell: true})
+	if !check.Restarted || !check.Usable || check.OldPID != oldPID || check.Health.ShellPID == oldPID {
+		t.Errorf("Expected the shell to be restarted, got %+v", check)
+	}
+}
+
+func TestSetProjectSessionsEnvironment(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	first, err := manager.CreateSession("env-one", "shared_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	second, err := manager.CreateSession("env-two", "shared_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	other, err := manager.CreateSession("env-other", "other_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, updated, _ := tools.SetProjectSessionsEnvironment(ctx, nil, SetProjectEnvironmentArgs{
+		ProjectID: "shared_proj",
+		Variables: map[string]string{"SHARED_VALUE": "42"},
+	})
+	if result.IsError || updated.SessionsUpdated != 2 {
+		t.Fatalf("Expected 2 sessions updated, got %+v", updated)
+	}
+
+	for _, id := range []string{first.ID, second.ID} {
+		env, _ := manager.GetSessionEnvironment(id)
+		if env["SHARED_VALUE"] != "42" {
+			t.Errorf("Expected SHARED_VALUE in session %s", id)
+		}
+	}
+	if env, _ := manager.GetSessionEnvironment(other.ID); env["SHARED_VALUE"] != "" {
+		t.Error("Expected sessions in other projects to be untouched")
+	}
+
+	if result, _, _ := tools.SetProjectSessionsEnvironment(ctx, nil, SetProjectEnvironmentArgs{ProjectID: "missing_proj", Variables: map[string]string{"A": "1"}}); !result.IsError {
+		t.Error("Expected a project without sessions to be reported")
+	}
+}
+
+func TestParseDotEnv(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"",
+		"PLAIN=value",
+		"export EXPORTED=yes",
+		`DOUBLE="line one\nline \"two\""`,
+		"SINGLE='literal \\n $HOME'",
+		"URL=http://example.com/#anchor # trailing comment",
+		"EMPTY=",
+		"PLAIN=override",
+		"not a pair",
+		"1BAD=value",
+		`UNTERMINATED="open`,
+		`TRAILING="quoted" junk`,
+	}, "\n")
+
+	variables, keys, warnings, err := parseDotEnv(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseDotEnv failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":    "override",
+		"EXPORTED": "yes",
+		"DOUBLE":   "line one\nline \"two\"",
+		"SINGLE":   `literal \n $HOME`,
+		"URL":      "http://example.com/#anchor",
+		"EMPTY":    "",
+	}
+	for key, want := range expected {
+		if got, ok := variables[key]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if len(variables) != len(expected) {
+		t.Errorf("Unexpected variables: %v", variables)
+	}
+	if strings.Join(keys, ",") != "PLAIN,EXPORTED,DOUBLE,SINGLE,URL,EMPTY" {
+		t.Errorf("Unexpected key order: %v", keys)
+	}
+	if len(warnings) != 4 || !strings.HasPrefix(warnings[0], "line 10:") {
+		t.Errorf("Expected 4 warnings starting at line 10, got %v", warnings)
+	}
+}
+
+func TestAppendSessionEnvironmentFromFile(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(projectDir, "config"), 0755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "config", ".env"), []byte("export APP_PORT=8080\nbroken line\nAPP_NAME=\"demo app\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	outside := filepath.Join(tempDir, "outside.env")
+	if err := os.WriteFile(outside, []byte("SECRET=1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(projectDir, "linked.env")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	session, err := manager.CreateSession("dotenv", "", projectDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, imported, _ := tools.AppendSessionEnvironmentFromFile(ctx, nil, AppendEnvironmentFromFileArgs{SessionID: session.ID, Path: "config/.env"})
+	if result.IsError || !imported.Success {
+		t.Fatalf("Import failed: %+v", imported)
+	}
+	if imported.Count != 2 || len(imported.Warnings) != 1 {
+		t.Errorf("Expected 2 keys and 1 warning, got %+v", imported)
+	}
+	env, _ := manager.GetSessionEnvironment(session.ID)
+	if env["APP_PORT"] != "8080" || env["APP_NAME"] != "demo app" {
+		t.Errorf("Unexpected session environment: %v", env)
+	}
+
+	for _, path := range []string{"../outside.env", "linked.env", outside, "missing.env", "config"} {
+		if result, _, _ := tools.AppendSessionEnvironmentFromFile(ctx, nil, AppendEnvironmentFromFileArgs{SessionID: session.ID, Path: path}); !result.IsError {
+			t.Errorf("Expected import of %s to be rejected", path)
+		}
+	}
+
+	tools.config.Security.AllowAbsoluteEnvFiles = true
+	if result, _, _ := tools.AppendSessionEnvironmentFromFile(ctx, nil, AppendEnvironmentFromFileArgs{SessionID: session.ID, Path: outside}); result.IsError {
+		t.Errorf("Expected absolute path to be accepted when allowed: %v", result.Content)
+	}
+	tools.config.Security.AllowedWorkingDirs = []string{projectDir}
+	if result, _, _ := tools.AppendSessionEnvironmentFromFile(ctx, nil, AppendEnvironmentFromFileArgs{SessionID: session.ID, Path: outside}); !result.IsError {
+		t.Error("Expected absolute path outside allowed_working_dirs to be rejected")
+	}
+}
+
+func TestImportExportCommandTemplates(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	path := filepath.Join(tempDir, "templates.json")
+
+	_, exported, _ := tools.ExportCommandTemplates(ctx, nil, ExportTemplatesArgs{Path: path, Category: "go"})
+	if exported.Count != 4 || exported.Path != path {
+		t.Fatalf("Expected 4 go templates written to %s, got %+v", path, exported)
+	}
+
+	result, imported, _ := tools.ImportCommandTemplates(ctx, nil, ImportTemplatesArgs{Path: path, OnConflict: "rename"})
+	if result.IsError || imported.Added != 4 {
+		t.Fatalf("Expected 4 renamed imports, got %+v", imported)
+	}
+	if _, exists := tools.templateManager.GetTemplate("go-build-2"); !exists {
+		t.Errorf("Expected renamed template go-build-2, got %+v", imported.Outcomes)
+	}
+
+	_, imported, _ = tools.ImportCommandTemplates(ctx, nil, ImportTemplatesArgs{
+		Templates: []CommandTemplate{
+			{Name: "go-build", Command: "go build -race ./..."},
+			{Name: "release", Command: "make release VERSION={{version}}"},
+			{Name: "broken", Command: ""},
+		},
+	})
+	if imported.Added != 1 || imported.Skipped != 1 || imported.Failed != 1 {
+		t.Errorf("Expected 1 added, 1 skipped, 1 failed, got %+v", imported)
+	}
+	if tmpl, _ := tools.templateManager.GetTemplate("go-build"); tmpl.Command != "go build ./..." {
+		t.Errorf("Expected skip to keep the existing template, got %q", tmpl.Command)
+	}
+
+	_, imported, _ = tools.ImportCommandTemplates(ctx, nil, ImportTemplatesArgs{
+		Templates:  []CommandTemplate{{Name: "go-build", Command: "go build -race ./..."}},
+		OnConflict: "overwrite",
+	})
+	if imported.Outcomes[0].Action != "overwritten" {
+		t.Errorf("Expected template to be overwritten, got %+v", imported.Outcomes)
+	}
+	if tmpl, _ := tools.templateManager.GetTemplate("go-build"); tmpl.Command != "go build -race ./..." {
+		t.Errorf("Expected overwritten command, got %q", tmpl.Command)
+	}
+
+	if result, _, _ := tools.ImportCommandTemplates(ctx, nil, ImportTemplatesArgs{OnConflict: "merge"}); !result.IsError {
+		t.Error("Expected an invalid conflict policy to be rejected")
+	}
+}
+
+func TestUpdateAndDeleteCommandTemplates(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	if result, _, _ := tools.CreateCommandTemplate(ctx, nil, CreateCommandTemplateArgs{
+		Name: "deploy", Command: "make deploy", Description: "Deploy", Category: "ops",
+	}); result.IsError {
+		t.Fatal("Failed to create template")
+	}
+
+	result, updated, _ := tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "deploy", Command: "make deploy ENV={{env}}"})
+	if result.IsError {
+		t.Fatalf("Expected update to succeed")
+	}
+	if updated.Template.Command != "make deploy ENV={{env}}" || updated.Template.Description != "Deploy" || updated.Template.Category != "ops" {
+		t.Errorf("Expected only the command to change, got %+v", updated.Template)
+	}
+	if len(updated.Updated) != 1 || updated.Updated[0] != "command" {
+		t.Errorf("Expected updated fields [command], got %v", updated.Updated)
+	}
+
+	if result, _, _ := tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "deploy", Command: "   "}); !result.IsError {
+		t.Error("Expected a blank command to be rejected")
+	}
+	if tmpl, _ := tools.templateManager.GetTemplate("deploy"); tmpl.Command != "make deploy ENV={{env}}" {
+		t.Errorf("Expected rejected update to leave the template unchanged, got %q", tmpl.Command)
+	}
+	if result, _, _ := tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "missing", Command: "true"}); !result.IsError {
+		t.Error("Expected updating a missing template to fail")
+	}
+
+	_, deleted, _ := tools.DeleteCommandTemplate(ctx, nil, DeleteTemplateArgs{Name: "deploy"})
+	if !deleted.Existed {
+		t.Errorf("Expected deleted template to have existed, got %+v", deleted)
+	}
+	if _, exists := tools.templateManager.GetTemplate("deploy"); exists {
+		t.Error("Expected template to be gone after delete")
+	}
+	_, deleted, _ = tools.DeleteCommandTemplate(ctx, nil, DeleteTemplateArgs{Name: "deploy"})
+	if deleted.Existed {
+		t.Error("Expected second delete to report the template did not exist")
+	}
+}
+
+func TestRunCommandInSessions(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		session, err := manager.CreateSession(fmt.Sprintf("fanout-%d", i), "fanout_proj", tempDir)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		ids = append(ids, session.ID)
+	}
+
+	result, fanOut, _ := tools.RunCommandInSessions(ctx, nil, RunCommandInSessionsArgs{
+		ProjectID:   "fanout_proj",
+		Command:     "echo fanned",
+		Concurrency: 3,
+	})
+	if result.IsError || fanOut.Total != 3 || fanOut.Succeeded != 3 {
+		t.Fatalf("Expected 3 successful runs, got %+v", fanOut)
+	}
+	for _, outcome := range fanOut.Results {
+		if outcome.Result == nil || !strings.Contains(outcome.Result.Output, "fanned") {
+			t.Errorf("Expected output for session %s, got %+v", outcome.SessionID, outcome)
+		}
+	}
+	for _, id := range ids {
+		commands, err := manager.GetRecentCommands(id, 10)
+		if err != nil || len(commands) != 1 {
+			t.Errorf("Expected the command in session %s history, got %d (%v)", id, len(commands), err)
+		}
+	}
+
+	_, fanOut, _ = tools.RunCommandInSessions(ctx, nil, RunCommandInSessionsArgs{
+		SessionIDs:  []string{ids[0], "00000000-0000-4000-8000-000000000000", ids[1]},
+		Command:     "true",
+		StopOnError: true,
+	})
+	if fanOut.Succeeded != 1 || fanOut.Failed != 1 || fanOut.Skipped != 1 {
+		t.Errorf("Expected 1 succeeded, 1 failed, 1 skipped, got %+v", fanOut)
+	}
+
+	if result, _, _ := tools.RunCommandInSessions(ctx, nil, RunCommandInSessionsArgs{Command: "true"}); !result.IsError {
+		t.Error("Expected missing targets to be rejected")
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("sequence", "sequence_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "pkg"), 0o755); err != nil {
+		t.Fatalf("Failed to create pkg: %v", err)
+	}
+
+	result, sequence, _ := tools.RunCommands(ctx, nil, RunCommandsArgs{
+		SessionID: session.ID,
+		Commands:  []string{"cd pkg", "pwd", "echo built > out.txt"},
+	})
+	if result.IsError || !sequence.Success || sequence.Succeeded != 3 {
+		t.Fatalf("Expected 3 successful commands, got %+v", sequence)
+	}
+	if out := sequence.Results[1].Result; out == nil || !strings.Contains(out.Output, "pkg") {
+		t.Errorf("Expected the cd to carry over to the next command, got %+v", sequence.Results[1])
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "pkg", "out.txt")); err != nil {
+		t.Errorf("Expected the last command to run in pkg: %v", err)
+	}
+	if !strings.HasSuffix(sequence.CurrentDir, "pkg") {
+		t.Errorf("Expected current_dir to end in pkg, got %s", sequence.CurrentDir)
+	}
+	if commands, err := manager.GetRecentCommands(session.ID, 10); err != nil || len(commands) != 3 {
+		t.Errorf("Expected each command in history, got %d (%v)", len(commands), err)
+	}
+
+	_, sequence, _ = tools.RunCommands(ctx, nil, RunCommandsArgs{
+		SessionID:     session.ID,
+		Commands:      []string{"true", "exit 3", "echo unreachable"},
+		StopOnFailure: true,
+	})
+	if sequence.Success || sequence.Succeeded != 1 || sequence.Failed != 1 || sequence.Skipped != 1 {
+		t.Errorf("Expected 1 succeeded, 1 failed, 1 skipped, got %+v", sequence)
+	}
+	if sequence.Results[2].Status != "skipped" || sequence.Results[2].Result != nil {
+		t.Errorf("Expected the command after the failure to be skipped, got %+v", sequence.Results[2])
+	}
+
+	_, sequence, _ = tools.RunCommands(ctx, nil, RunCommandsArgs{
+		SessionID: session.ID,
+		Commands:  []string{"false", "true"},
+	})
+	if sequence.Success || sequence.Failed != 1 || sequence.Succeeded != 1 {
+		t.Errorf("Expected every command to run without stop_on_failure, got %+v", sequence)
+	}
+
+	for _, args := range []RunCommandsArgs{
+		{SessionID: session.ID},
+		{SessionID: session.ID, Commands: []string{"true", " "}},
+		{SessionID: "00000000-0000-4000-8000-000000000000", Commands: []string{"true"}},
+	} {
+		if result, _, _ := tools.RunCommands(ctx, nil, args); !result.IsError {
+			t.Errorf("Expected %+v to be rejected", args)
+		}
+	}
+
+	// A sequence longer than the rate limit burst counts once, so every command runs
+	tools.sessionLimiters = newKeyedRateLimiters(1, 2)
+	long := make([]string, 12)
+	for i := range long {
+		long[i] = "true"
+	}
+	_, sequence, _ = tools.RunCommands(ctx, nil, RunCommandsArgs{SessionID: session.ID, Commands: long})
+	if !sequence.Success || sequence.Succeeded != len(long) {
+		t.Errorf("Expected a long sequence to run under one rate limit token, got %+v", sequence)
+	}
+
+	tools.config.Session.MaxSequenceCommands = len(long) - 1
+	if result, _, _ := tools.RunCommands(ctx, nil, RunCommandsArgs{SessionID: session.ID, Commands: long}); !result.IsError {
+		t.Error("Expected a sequence over max_sequence_commands to be rejected")
+	}
+}
+
+func TestDiffSecurityPolicy(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	if result, _, _ := tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{}); !result.IsError {
+		t.Error("Expected an error without a source config file")
+	}
+
+	// A partial file: persisting must not fill in the sections it leaves to the defaults
+	configDir := filepath.Join(tempDir, "conf")
+	if err := os.Mkdir(configDir, 0o755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	configPath := filepath.Join(configDir, "config.json")
+	partial, err := json.Marshal(map[string]interface{}{
+		"server":   map[string]string{"name": "custom-server"},
+		"security": tools.config.Security,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode config file: %v", err)
+	}
+	if err := os.WriteFile(configPath, partial, 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	tools.config.SourceFile = configPath
+
+	_, diff, _ := tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{})
+	if !diff.InSync {
+		t.Fatalf("Expected runtime policy to match the file, got %+v", diff)
+	}
+
+	removed := tools.config.Security.BlockedCommands[0]
+	tools.config.Security.BlockedCommands = append(tools.config.Security.BlockedCommands[1:], "shutdown-now")
+	tools.config.Security.AllowNetworkAccess = !tools.config.Security.AllowNetworkAccess
+
+	_, diff, _ = tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{})
+	if diff.InSync || len(diff.BlockedCommands.Added) != 1 || diff.BlockedCommands.Added[0] != "shutdown-now" {
+		t.Errorf("Expected shutdown-now as an added blocked command, got %+v", diff.BlockedCommands)
+	}
+	if len(diff.BlockedCommands.Removed) != 1 || diff.BlockedCommands.Removed[0] != removed {
+		t.Errorf("Expected %q as a removed blocked command, got %+v", removed, diff.BlockedCommands)
+	}
+	if len(diff.ChangedSettings) != 1 || diff.ChangedSettings[0].Setting != "allow_network_access" {
+		t.Errorf("Expected allow_network_access to be reported, got %+v", diff.ChangedSettings)
+	}
+
+	if result, _, _ := tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{Persist: true}); !result.IsError {
+		t.Error("Expected persist without confirm to be rejected")
+	}
+
+	_, diff, _ = tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{Persist: true, Confirm: true})
+	if !diff.Persisted {
+		t.Fatalf("Expected the runtime policy to be persisted, got %+v", diff)
+	}
+	if _, diff, _ = tools.DiffSecurityPolicy(ctx, nil, DiffSecurityPolicyArgs{}); !diff.InSync {
+		t.Errorf("Expected the policies to match after persisting, got %+v", diff)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read persisted config: %v", err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		t.Fatalf("Persisted config is not valid JSON: %v", err)
+	}
+	if len(sections) != 2 || !strings.Contains(string(sections["server"]), "custom-server") {
+		t.Errorf("Expected only the security section to change, got %s", data)
+	}
+	if info, err := os.Stat(configPath); err != nil {
+		t.Errorf("Failed to stat persisted config: %v", err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the config file to keep its permissions, got %v", info.Mode())
+	}
+	if entries, _ := os.ReadDir(configDir); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left next to the config, got %d entries", len(entries))
+	}
+}
+
+// TestDaemonizingCommandHandling tests detection and handling of commands that fork into the background
+func TestDaemonizingCommandHandling(t *testing.T) {
+	detection := []struct {
+		command      string
+		flagged      bool
+		backgrounded bool
+	}{
+		{"sleep 10 &", true, true},
+		{"python -m http.server > /dev/null 2>&1 &", true, true},
+		{"nohup ./server", true, false},
+		{"docker run -d nginx", true, false},
+		{"redis-server --daemonize yes", true, false},
+		{"make && make test", false, false},
+		{"go test ./... 2>&1 | tee out.log", false, false},
+		{"echo 'a & b'", false, false},
+		{"ls &> files.txt", false, false},
+		{"docker run nginx", false, false},
+	}
+	for _, tc := range detection {
+		reason, backgrounded := detectDaemonizing(tc.command)
+		if (reason != "") != tc.flagged || backgrounded != tc.backgrounded {
+			t.Errorf("detectDaemonizing(%q) = %q, %v; want flagged=%v backgrounded=%v", tc.command, reason, backgrounded, tc.flagged, tc.backgrounded)
+		}
+	}
+
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("daemon-test", "daemon_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, result, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo plain"})
+	if result.Daemon != nil {
+		t.Errorf("Expected no daemon warning for a plain command, got %+v", result.Daemon)
+	}
+
+	_, result, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "sleep 0.1 &"})
+	if result.Daemon == nil || result.Daemon.Handling != DaemonHandlingWarn || result.Daemon.Limitation == "" || result.Daemon.PID != 0 {
+		t.Errorf("Expected a warning without a PID, got %+v", result.Daemon)
+	}
+
+	tools.config.Session.DaemonCommandHandling = DaemonHandlingCapturePID
+	_, result, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo started; sleep 0.1 &"})
+	if result.Daemon == nil || result.Daemon.PID <= 0 {
+		t.Errorf("Expected the background job's PID to be captured, got %+v", result.Daemon)
+	}
+	if strings.Contains(result.Output, daemonPIDMarker) || !strings.Contains(result.Output, "started") {
+		t.Errorf("Expected the PID marker to be stripped from output, got %q", result.Output)
+	}
+
+	tools.config.Session.DaemonCommandHandling = DaemonHandlingReject
+	callResult, result, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "nohup sleep 0.1"})
+	if !callResult.IsError || result.Daemon == nil || result.Output != "" {
+		t.Errorf("Expected the daemonizing command to be rejected, got %+v", result)
+	}
+}
+
+func TestGetSuccessRateTrend(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	session, err := manager.CreateSession("trend-test", "trend_proj", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Four hours of builds: passing for the first two, then mostly failing
+	now := time.Now().UTC().Truncate(time.Hour)
+	rates := []struct{ passed, failed int }{{4, 0}, {4, 0}, {1, 3}, {1, 3}}
+	for hour, rate := range rates {
+		at := now.Add(time.Duration(hour-len(rates)+1) * time.Hour)
+		for i := 0; i < rate.passed+rate.failed; i++ {
+			err := tools.database.CreateCommand(&database.CommandRecord{
+				ID:         fmt.Sprintf("trend-%d-%d", hour, i),
+				SessionID:  session.ID,
+				ProjectID:  "trend_proj",
+				Command:    "go build ./...",
+				Success:    i < rate.passed,
+				WorkingDir: tempDir,
+				Timestamp:  at.Add(time.Duration(i) * time.Minute),
+			})
+			if err != nil {
+				t.Fatalf("Failed to store command: %v", err)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	result, trend, _ := tools.GetSuccessRateTrend(ctx, nil, GetSuccessRateTrendArgs{ProjectID: "trend_proj", Interval: "hourly", Periods: 6})
+	if result.IsError {
+		t.Fatalf("Expected trend to succeed")
+	}
+	if len(trend.Buckets) != 4 || trend.TotalCommands != 16 {
+		t.Fatalf("Expected 4 buckets with 16 commands, got %d buckets and %d commands", len(trend.Buckets), trend.TotalCommands)
+	}
+	if trend.Trend != "degrading" || trend.Change > -0.5 {
+		t.Errorf("Expected a degrading trend, got %s (%.2f)", trend.Trend, trend.Change)
+	}
+	if len(trend.Regressions) != 1 || !trend.Regressions[0].Start.Equal(trend.Buckets[2].Start) {
+		t.Errorf("Expected one regression at the third bucket, got %+v", trend.Regressions)
+	}
+
+	// Only the latest bucket falls inside a one-period window
+	_, trend, _ = tools.GetSuccessRateTrend(ctx, nil, GetSuccessRateTrendArgs{SessionID: session.ID, Interval: "hourly", Periods: 1})
+	if len(trend.Buckets) != 1 || trend.Trend != "insufficient_data" {
+		t.Errorf("Expected a single bucket with insufficient data, got %+v", trend)
+	}
+
+	if result, _, _ := tools.GetSuccessRateTrend(ctx, nil, GetSuccessRateTrendArgs{Interval: "weekly"}); !result.IsError {
+		t.Error("Expected an invalid interval to be rejected")
+	}
+}
+
+func TestTemplateExpansionCache(t *testing.T) {
+	tm := NewTemplateManager(2)
+	if err := tm.AddTemplate(&CommandTemplate{Name: "greet", Command: "echo {{greeting}} {{name}}", Variables: map[string]string{"greeting": "hello"}}); err != nil {
+		t.Fatalf("Failed to add template: %v", err)
+	}
+
+	vars := map[string]string{"name": "world"}
+	for i := 0; i < 3; i++ {
+		if cmd, err := tm.ExpandTemplate("greet", vars); err != nil || cmd != "echo hello world" {
+			t.Fatalf("Unexpected expansion %q (%v)", cmd, err)
+		}
+	}
+	if tm.cache.hits != 2 || tm.cache.misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d and %d", tm.cache.hits, tm.cache.misses)
+	}
+
+	// Updating the template drops its cached expansions
+	if _, err := tm.UpdateTemplate("greet", "echo {{greeting}}, {{name}}!", "", ""); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if cmd, _ := tm.ExpandTemplate("greet", vars); cmd != "echo hello, world!" {
+		t.Errorf("Expected the updated command after invalidation, got %q", cmd)
+	}
+
+	// The least recently used expansion is evicted once the cache is full
+	tm.ExpandTemplate("greet", map[string]string{"name": "a"})
+	tm.ExpandTemplate("greet", map[string]string{"name": "b"})
+	if tm.cache.order.Len() != 2 {
+		t.Errorf("Expected the cache bounded at 2 entries, got %d", tm.cache.order.Len())
+	}
+	if _, cached := tm.cache.entries[expansionCacheKey("greet", vars)]; cached {
+		t.Error("Expected the oldest expansion to be evicted")
+	}
+
+	if !tm.DeleteTemplate("greet") || tm.cache.order.Len() != 0 {
+		t.Errorf("Expected delete to clear the template's expansions, %d left", tm.cache.order.Len())
+	}
+	if _, err := tm.ExpandTemplate("greet", vars); err == nil {
+		t.Error("Expected a deleted template not to be served from the cache")
+	}
+
+	// Concurrent expansions share the cache safely
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tm.ExpandTemplate("git-status", nil)
+			tm.ExpandTemplate("npm-test", map[string]string{"n": fmt.Sprint(i % 3)})
+		}(i)
+	}
+	wg.Wait()
+
+	disabled := NewTemplateManager(0)
+	if cmd, err := disabled.ExpandTemplate("npm-test", nil); err != nil || cmd != "npm test" || disabled.cache != nil {
+		t.Errorf("Expected expansion without a cache, got %q (%v)", cmd, err)
+	}
+}
+
+func TestRunCommandStdin(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("stdin", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, response, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "cat", Stdin: "echoed text\n"})
+	if result.IsError || !response.Success || response.Output != "echoed text\n" {
+		t.Errorf("Expected cat to echo stdin, got %+v", response)
+	}
+
+	result, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{
+		SessionID: session.ID,
+		Command:   `read -p "Overwrite? [y/n] " answer && [ "$answer" = y ] && echo overwritten`,
+		Stdin:     "y\n",
+	})
+	if result.IsError || !strings.Contains(response.Output, "overwritten") {
+		t.Errorf("Expected the prompt to be answered from stdin, got %+v", response)
+	}
+}
+
+func TestCheckpointWAL(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := manager.CreateSession(fmt.Sprintf("wal-%d", i), "", tempDir); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	result, checkpoint, err := tools.CheckpointWAL(ctx, nil, CheckpointWALArgs{})
+	if err != nil || result.IsError {
+		t.Fatalf("CheckpointWAL failed: %v %v", err, result.Content)
+	}
+	if checkpoint.Busy || checkpoint.SizeAfterBytes != 0 || checkpoint.ReclaimedBytes != checkpoint.SizeBeforeBytes || checkpoint.Interval != "5m0s" {
+		t.Errorf("Expected the WAL to be truncated, got %+v", checkpoint)
+	}
+
+	tools.database = nil
+	if result, _, _ := tools.CheckpointWAL(ctx, nil, CheckpointWALArgs{}); !result.IsError {
+		t.Error("Expected an error when the database is disabled")
+	}
+}
+
+func TestExportActivityMetricsTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	if result, _, _ := tools.ExportActivityMetrics(ctx, nil, ExportActivityMetricsArgs{}); !result.IsError {
+		t.Error("Expected export to fail without activity_metrics_file")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.CreateSession(fmt.Sprintf("activity-%d", i), "", tempDir); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	tools.config.Monitoring.ActivityMetricsFile = filepath.Join(tempDir, "activity.jsonl")
+
+	result, export, err := tools.ExportActivityMetrics(ctx, nil, ExportActivityMetricsArgs{})
+	if err != nil || result.IsError {
+		t.Fatalf("ExportActivityMetrics failed: %v %v", err, result.Content)
+	}
+	if export.Sessions != 2 || export.Path != tools.config.Monitoring.ActivityMetricsFile || export.Interval != "5m0s" {
+		t.Errorf("Unexpected export: %+v", export)
+	}
+
+	data, err := os.ReadFile(export.Path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected one line per session, got %d", len(lines))
+	}
+}
+
+func TestSearchCommandOutputAcrossSessions(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	api, err := manager.CreateSession("search-api", "search_api", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	worker, err := manager.CreateSession("search-worker", "search_worker", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	manager.ExecuteCommand(api.ID, "printf 'starting\\nERROR: connection refused\\n'")
+	manager.ExecuteCommand(worker.ID, "printf 'error: Connection Refused by peer\\n'")
+	manager.ExecuteCommand(worker.ID, "echo all good")
+
+	result, search, err := tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{Pattern: "connection refused"})
+	if err != nil || result.IsError {
+		t.Fatalf("SearchCommandOutput failed: %v %v", err, result.Content)
+	}
+	if search.TotalMatches != 2 || search.SessionsMatched != 2 {
+		t.Fatalf("Expected matches in both sessions, got %+v", search)
+	}
+	for _, match := range search.Matches {
+		if match.SessionName == "" || match.ProjectID == "" {
+			t.Errorf("Expected session and project context, got %+v", match)
+		}
+	}
+
+	_, search, _ = tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{Pattern: "connection refused", ProjectID: "search_worker"})
+	if search.TotalMatches != 1 || search.Matches[0].SessionID != worker.ID {
+		t.Errorf("Expected only the worker match, got %+v", search.Matches)
+	}
+
+	_, search, _ = tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{Pattern: "^ERROR:", IsRegex: true, CaseSensitive: true})
+	if search.TotalMatches != 1 || search.Matches[0].SessionID != api.ID || search.Matches[0].LineNumber != 2 {
+		t.Errorf("Expected one case-sensitive regex match, got %+v", search.Matches)
+	}
+
+	_, search, _ = tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{Pattern: "refused", MaxResults: 1})
+	if search.TotalMatches != 1 || !search.Truncated {
+		t.Errorf("Expected results capped at 1, got %+v", search)
+	}
+
+	if result, _, _ := tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{Pattern: "(", IsRegex: true}); !result.IsError {
+		t.Error("Expected an invalid regex to be rejected")
+	}
+	if result, _, _ := tools.SearchCommandOutput(ctx, nil, SearchOutputArgs{}); !result.IsError {
+		t.Error("Expected an empty pattern to be rejected")
+	}
+}
+
+func TestSearchCommandOutputRanking(t *testing.T) {
+	now := time.Now()
+	commands := []*database.CommandRecord{
+		{ID: "c-old", Command: "make", Output: "fail\nfail\nfail", Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "c-new", Command: "make", Output: "ok\nfail", Timestamp: now},
+		{ID: "c-tie-b", Command: "make", Output: "fail\nfail", Timestamp: now.Add(-time.Hour)},
+		{ID: "c-tie-a", Command: "make", Output: "fail\nfail", Timestamp: now.Add(-time.Hour)},
+		{ID: "c-none", Command: "make", Output: "ok", Timestamp: now},
+	}
+	commandOrder := func(result SearchOutputResult) []string {
+		var ids []string
+		for _, match := range result.Matches {
+			if len(ids) == 0 || ids[len(ids)-1] != match.CommandID {
+				ids = append(ids, match.CommandID)
+			}
+		}
+		return ids
+	}
+
+	cases := []struct {
+		sortBy string
+		want   []string
+	}{
+		{SearchSortRecency, []string{"c-new", "c-tie-a", "c-tie-b", "c-old"}},
+		{SearchSortRelevance, []string{"c-old", "c-tie-a", "c-tie-b", "c-new"}},
+	}
+	for _, tc := range cases {
+		// The order must not depend on the number of workers scanning the outputs
+		for _, workers := range []int{1, 3, 16} {
+			result, err := searchCommandOutputsInternal(commands, SearchOutputArgs{Pattern: "fail", SortBy: tc.sortBy}, "", workers)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			if got := commandOrder(result); !slices.Equal(got, tc.want) {
+				t.Errorf("sort_by %s with %d workers: expected %v, got %v", tc.sortBy, workers, tc.want, got)
+			}
+			if result.TotalMatches != 8 || result.Matches[0].LineMatches == 0 {
+				t.Errorf("sort_by %s: unexpected matches %+v", tc.sortBy, result.Matches)
+			}
+		}
+	}
+
+	result, _ := searchCommandOutputsInternal(commands, SearchOutputArgs{Pattern: "fail", SortBy: SearchSortRelevance, MaxResults: 3}, "", 4)
+	if !result.Truncated || len(result.Matches) != 3 || result.Matches[2].CommandID != "c-old" || result.Matches[2].LineMatches != 3 {
+		t.Errorf("Expected the most relevant command's matches first, got %+v", result.Matches)
+	}
+}
+
+func TestSearchCommandOutputSortByValidation(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	if result, _, _ := tools.SearchCommandOutput(context.Background(), nil, SearchOutputArgs{Pattern: "x", SortBy: "oldest"}); !result.IsError {
+		t.Error("Expected an invalid sort_by to be rejected")
+	}
+}
+
+func TestSearchHistoryRegex(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("history-regex", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	manager.ExecuteCommand(session.ID, "echo 'build 42 passed'")
+	manager.ExecuteCommand(session.ID, "echo 'build failed'")
+
+	result, search, err := tools.SearchHistory(ctx, nil, SearchHistoryArgs{OutputRegex: `build \d+`})
+	if err != nil || result.IsError {
+		t.Fatalf("SearchHistory failed: %v %v", err, result.Content)
+	}
+	if search.TotalFound != 1 || search.RegexStats == nil || search.RegexStats.RowsScanned != 2 {
+		t.Fatalf("Expected 1 match out of 2 scanned, got %d (%+v)", search.TotalFound, search.RegexStats)
+	}
+	matches := search.Results[0].RegexMatches
+	if len(matches) != 1 || matches[0].Field != "output" || len(matches[0].Offsets) != 1 {
+		t.Errorf("Unexpected regex matches: %+v", matches)
+	}
+
+	result, _, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{CommandRegex: "echo ["})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "invalid command_regex") {
+		t.Errorf("Expected a validation error for an invalid regex, got %+v", result.Content)
+	}
+
+	_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{Command: "echo"})
+	if search.TotalFound != 2 || search.RegexStats != nil || search.Results[0].RegexMatches != nil {
+		t.Errorf("Expected plain searches to be unchanged, got %+v", search)
+	}
+}
+
+func TestSearchHistoryOffset(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("history-offset", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	for _, command := range []string{"echo one", "echo two", "echo three"} {
+		manager.ExecuteCommand(session.ID, command)
+	}
+
+	result, search, err := tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Limit: 2})
+	if err != nil || result.IsError {
+		t.Fatalf("SearchHistory failed: %v %v", err, result.Content)
+	}
+	if search.TotalFound != 2 || search.TotalCount == nil || *search.TotalCount != 3 || !search.HasMore {
+		t.Fatalf("Expected the first page of 2 out of 3 with more to come, got %+v", search)
+	}
+	first := search.Results[0].ID
+
+	_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Limit: 2, Offset: 2})
+	if search.TotalFound != 1 || search.HasMore || search.Offset != 2 || search.Results[0].ID == first {
+		t.Errorf("Expected a last page of 1, got %+v", search)
+	}
+
+	result, _, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{Offset: maxHistoryOffset + 1})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "Invalid offset") {
+		t.Errorf("Expected an offset past the maximum to be rejected, got %+v", result.Content)
+	}
+	result, _, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{CommandRegex: "^echo", Offset: 1})
+	if !result.IsError {
+		t.Error("Expected offset to be rejected for regex searches")
+	}
+}
+
+func TestSearchHistoryFields(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("history-fields", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	manager.ExecuteCommand(session.ID, "echo fields")
+	manager.ExecuteCommand(session.ID, "false")
+
+	result, search, err := tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Fields: []string{"command", "success", "command"}})
+	if err != nil || result.IsError {
+		t.Fatalf("SearchHistory failed: %v %v", err, result.Content)
+	}
+	if search.TotalFound != 2 || len(search.Rows) != 2 || len(search.Results) != 0 {
+		t.Fatalf("Expected 2 rows and no full results, got %+v", search)
+	}
+	for _, row := range search.Rows {
+		if len(row) != 2 || row["command"] == nil || row["success"] == nil {
+			t.Errorf("Expected only command and success, got %v", row)
+		}
+	}
+
+	result, _, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{Fields: []string{"command", "exit_status"}})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "unknown field") {
+		t.Errorf("Expected an unknown field to be rejected, got %+v", result.Content)
+	}
+	result, _, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{Fields: []string{"output"}})
+	if !result.IsError {
+		t.Error("Expected output without include_output to be rejected")
+	}
+	_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Fields: []string{"output"}, IncludeOutput: true, Success: boolPtr(true)})
+	if len(search.Rows) != 1 || !strings.Contains(fmt.Sprint(search.Rows[0]["output"]), "fields") {
+		t.Errorf("Expected output of the successful command, got %+v", search.Rows)
+	}
+
+	// Without fields the full records are returned as before
+	_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID})
+	if len(search.Results) != 2 || search.Rows != nil {
+		t.Errorf("Expected full results without fields, got %+v", search)
+	}
+}
+
+func TestRunCommandTags(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("command-tags", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, run, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "git --version; echo release", Tags: []string{"Release"}})
+	if err != nil || result.IsError {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+	if strings.Join(run.Tags, ",") != "git,release" {
+		t.Errorf("Expected explicit and detected tags, got %v", run.Tags)
+	}
+	tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo untagged"})
+
+	result, bg, err := tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.ID, Command: "echo background", Tags: []string{"release"}})
+	if err != nil || result.IsError {
+		t.Fatalf("RunBackgroundProcess failed: %v %v", err, result.Content)
+	}
+	if strings.Join(bg.Tags, ",") != "release" {
+		t.Errorf("Expected the background process tags to be reported, got %v", bg.Tags)
+	}
+
+	// The background command is recorded once it exits
+	var search SearchHistoryResult
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Tags: []string{"release"}})
+		if search.TotalFound == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if search.TotalFound != 2 {
+		t.Fatalf("Expected the foreground and background commands tagged release, got %d", search.TotalFound)
+	}
+
+	_, search, _ = tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID, Tags: []string{"release", "git"}})
+	if search.TotalFound != 1 || search.Results[0].Command != "git --version; echo release" {
+		t.Errorf("Expected only the git command to carry both tags, got %+v", search.Results)
+	}
+
+	result, _, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo hi", Tags: []string{" "}})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "Invalid tags") {
+		t.Errorf("Expected blank tags to be rejected, got %+v", result.Content)
+	}
+}
+
+func TestProjectRateLimit(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	// A slow refill so drained buckets stay drained for the rest of the test
+	tools.config.Session.ProjectRateLimitPerMinute = 1
+	tools.rateLimiter = NewRateLimiter(1, 3)
+	tools.projectLimiters = newKeyedRateLimiters(1, 2)
+
+	busy, err := manager.CreateSession("busy", "busy_project", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	quiet, err := manager.CreateSession("quiet", "quiet_project", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := tools.CheckRateLimit(busy.ID); err != nil {
+			t.Fatalf("Expected call %d to be allowed: %v", i+1, err)
+		}
+	}
+	var limitErr *RateLimitError
+	if err := tools.CheckRateLimit(busy.ID); !errors.As(err, &limitErr) || limitErr.Limiter != "project" || limitErr.ProjectID != "busy_project" {
+		t.Fatalf("Expected the project limiter to reject the busy project, got %v", err)
+	}
+
+	// The busy project used 2 of the 3 global tokens, leaving one for the other project
+	if err := tools.CheckRateLimit(quiet.ID); err != nil {
+		t.Fatalf("Expected the quiet project to be allowed: %v", err)
+	}
+	if err := tools.CheckRateLimit(quiet.ID); !errors.As(err, &limitErr) || limitErr.Limiter != "global" {
+		t.Fatalf("Expected the global limiter to reject the call, got %v", err)
+	}
+
+	_, status, _ := tools.GetRateLimitStatus(context.Background(), nil, GetRateLimitStatusArgs{})
+	byCategory := make(map[string]RateLimitCategoryStatus)
+	for _, category := range status.Categories {
+		byCategory[category.Category] = category
+	}
+	if len(status.Categories) != 5 || status.Categories[0].Category != "global" || !byCategory["project:busy_project"].Limited {
+		t.Fatalf("Expected global, per-session and per-project categories, got %+v", status.Categories)
+	}
+	// The globally rejected call was not charged to the quiet project
+	if quietStatus, ok := byCategory["project:quiet_project"]; !ok || quietStatus.AvailableTokens < 1 {
+		t.Errorf("Expected the quiet project to keep a token, got %+v", quietStatus)
+	}
+
+	rejections := tools.RateLimitRejections()
+	if rejections["project"] != 1 || rejections["global"] != 1 || rejections["session"] != 0 {
+		t.Errorf("Expected one project and one global rejection, got %v", rejections)
+	}
+}
+
+func TestRelocateSessionTool(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+	ctx := context.Background()
+
+	session, err := manager.CreateSession("relocate", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	newRoot := t.TempDir()
+
+	// Restarting background processes needs confirmation
+	result, _, _ := tools.RelocateSession(ctx, nil, RelocateSessionArgs{SessionID: session.ID, NewWorkingDir: newRoot, RestartBackground: true})
+	if !result.IsError {
+		t.Fatal("Expected restart_background without confirm to be rejected")
+	}
+	if workingDir := session.GetWorkingDir(); workingDir != tempDir {
+		t.Errorf("Expected a rejected call to leave the session in place, got %s", workingDir)
+	}
+
+	result, relocated, _ := tools.RelocateSession(ctx, nil, RelocateSessionArgs{SessionID: session.ID, NewWorkingDir: newRoot})
+	if result.IsError {
+		t.Fatalf("RelocateSession failed: %+v", result)
+	}
+	if relocated.OldWorkingDir != tempDir || relocated.NewWorkingDir != newRoot || relocated.NewCurrentDir != newRoot {
+		t.Errorf("Expected the session to move to %s, got %+v", newRoot, relocated)
+	}
+	if relocated.Restarted == nil || relocated.NotMoved == nil {
+		t.Errorf("Expected empty process lists rather than null, got %+v", relocated)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	session, err := manager.CreateSession("metrics", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	manager.ExecuteCommand(session.ID, "echo one")
+	manager.ExecuteCommand(session.ID, "echo two")
+	manager.ExecuteCommand(session.ID, "false")
+
+	metrics := tools.ServerMetrics()
+	if metrics.Sessions != 1 || metrics.ActiveSessions != 1 {
+		t.Errorf("Expected one active session, got %d sessions, %d active", metrics.Sessions, metrics.ActiveSessions)
+	}
+	if metrics.CommandsTotal != 3 || metrics.CommandsSuccessful != 2 {
+		t.Errorf("Expected 3 commands with 2 successful, got %d and %d", metrics.CommandsTotal, metrics.CommandsSuccessful)
+	}
+	if len(metrics.RateLimitRejections) != 3 || metrics.Goroutines <= 0 {
+		t.Errorf("Expected rejections for every limiter and a goroutine count, got %+v", metrics)
+	}
+}
+
+func TestSessionRateLimit(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	// A slow refill so drained buckets stay drained for the rest of the test
+	tools.config.Session.RateLimitPerMinute = 1
+	tools.sessionLimiters = newKeyedRateLimiters(1, 2)
+
+	sessionA, err := manager.CreateSession("session-a", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	sessionB, err := manager.CreateSession("session-b", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := tools.CheckRateLimit(sessionA.ID); err != nil {
+			t.Fatalf("Expected call %d to be allowed: %v", i+1, err)
+		}
+	}
+	var limitErr *RateLimitError
+	if err := tools.CheckRateLimit(sessionA.ID); !errors.As(err, &limitErr) || limitErr.Limiter != "session" || limitErr.SessionID != sessionA.ID {
+		t.Fatalf("Expected session A to hit its own limit, got %v", err)
+	}
+
+	// Session A being limited does not block session B
+	for i := 0; i < 2; i++ {
+		if err := tools.CheckRateLimit(sessionB.ID); err != nil {
+			t.Fatalf("Expected session B call %d to be allowed: %v", i+1, err)
+		}
+	}
+
+	// Unknown sessions share the bucket of calls without a session rather than getting their own
+	if err := tools.CheckRateLimit("no-such-session"); err != nil {
+		t.Fatalf("Expected a call without a valid session to be allowed: %v", err)
+	}
+	if tools.sessionLimiters.has("no-such-session") || !tools.sessionLimiters.has("") {
+		t.Errorf("Expected unknown sessions to use the shared bucket, got %v", tools.sessionLimiters.keys())
+	}
+
+	// With a global bound, session B is also stopped once the global bucket runs out
+	tools.rateLimiter = NewRateLimiter(1, 1)
+	sessionC, err := manager.CreateSession("session-c", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := tools.CheckRateLimit(sessionC.ID); err != nil {
+		t.Fatalf("Expected the first call under the global bound to be allowed: %v", err)
+	}
+	if err := tools.CheckRateLimit(sessionC.ID); !errors.As(err, &limitErr) || limitErr.Limiter != "global" {
+		t.Fatalf("Expected the global limiter to reject the call, got %v", err)
+	}
+	if tokens := tools.sessionLimiters.get(sessionC.ID).Snapshot().AvailableTokens; tokens < 1 {
+		t.Errorf("Expected the globally rejected call to be refunded to the session, got %.2f tokens", tokens)
+	}
+
+	// Deleting a session drops its bucket, and buckets of sessions removed some other way are
+	// pruned when the next session bucket is created
+	if result, _, _ := tools.DeleteSession(context.Background(), nil, DeleteSessionArgs{SessionID: sessionA.ID, Confirm: true}); result.IsError {
+		t.Fatalf("DeleteSession failed: %v", result.Content)
+	}
+	if tools.sessionLimiters.has(sessionA.ID) {
+		t.Error("Expected the deleted session's bucket to be removed")
+	}
+	if err := manager.DeleteSession(sessionB.ID); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	sessionD, err := manager.CreateSession("session-d", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	tools.rateLimiter = nil
+	if err := tools.CheckRateLimit(sessionD.ID); err != nil {
+		t.Fatalf("Expected a new session to be allowed: %v", err)
+	}
+	if keys := tools.sessionLimiters.keys(); len(keys) != 3 || tools.sessionLimiters.has(sessionB.ID) {
+		t.Errorf("Expected buckets for the shared bucket and sessions C and D only, got %v", keys)
+	}
+}
+
+func TestCommandAliases(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("aliases", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, set, err := tools.SetCommandAlias(ctx, nil, SetCommandAliasArgs{SessionID: session.ID, Name: "greet", Command: "echo hello"})
+	if err != nil || result.IsError || !set.Success || set.Count != 1 {
+		t.Fatalf("SetCommandAlias failed: %v %v", err, result.Content)
+	}
+	tools.SetCommandAlias(ctx, nil, SetCommandAliasArgs{SessionID: session.ID, Name: "halt", Command: "shutdown"})
+
+	_, listed, _ := tools.ListCommandAliases(ctx, nil, ListCommandAliasesArgs{SessionID: session.ID})
+	if listed.Count != 2 || listed.Aliases[0].Name != "greet" || listed.Aliases[0].Command != "echo hello" {
+		t.Errorf("Expected both aliases sorted by name, got %+v", listed.Aliases)
+	}
+
+	_, ran, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "greet world"})
+	if !ran.Success || ran.Output != "hello world\n" || ran.Command != "echo hello world" {
+		t.Errorf("Expected the alias to be expanded, got %+v", ran)
+	}
+	if ran.Alias == nil || ran.Alias.Original != "greet world" || ran.Alias.Expanded != "echo hello world" {
+		t.Errorf("Expected the expansion to be reported, got %+v", ran.Alias)
+	}
+
+	_, ran, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo greet"})
+	if ran.Alias != nil || ran.Output != "greet\n" {
+		t.Errorf("Expected only the first word to be expanded, got %+v", ran)
+	}
+
+	// The expansion, not the alias name, is what security validation sees
+	result, blocked, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "halt now"})
+	if !result.IsError || blocked.Alias == nil || blocked.Command != "shutdown now" {
+		t.Errorf("Expected the expanded command to be blocked, got %+v", blocked)
+	}
+	_, dry, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "halt now", DryRun: true})
+	if dry.Success || dry.Alias == nil || !strings.Contains(dry.ValidationError, "blocked for security reasons") {
+		t.Errorf("Expected the dry run to validate the expansion, got %+v", dry)
+	}
+
+	result, set, _ = tools.SetCommandAlias(ctx, nil, SetCommandAliasArgs{SessionID: session.ID, Name: "greet"})
+	if result.IsError || set.Count != 1 {
+		t.Errorf("Expected the alias to be removed, got %+v", set)
+	}
+}
+
+func TestRunCommandDryRun(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	if err := os.WriteFile(filepath.Join(tempDir, "go.mod"), []byte("module example.com/dryrun\n"), 0644); err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+	session, err := manager.CreateSession("dry-run", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, dry, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "touch created.txt", DryRun: true})
+	if err != nil || result.IsError {
+		t.Fatalf("Dry run failed: %v %v", err, result.Content)
+	}
+	if !dry.DryRun || !dry.Success || dry.ValidationError != "" || dry.Output != "" || dry.ProjectType != "go" || dry.Security == nil {
+		t.Errorf("Expected a successful dry run detecting a go project, got %+v", dry)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "created.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the dry run not to execute the command")
+	}
+
+	_, dry, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "shutdown now", DryRun: true})
+	if dry.Success || !strings.Contains(dry.ValidationError, "blocked for security reasons") || dry.Security == nil || dry.Security.Allowed {
+		t.Errorf("Expected the dry run to report the security block, got %+v", dry)
+	}
+	_, dry, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "# just a comment", DryRun: true})
+	if dry.Success || !strings.Contains(dry.ValidationError, "Invalid command") {
+		t.Errorf("Expected the dry run to report the invalid command, got %+v", dry)
+	}
+
+	// Nothing was recorded: no history, no command count and no blocked command entry
+	updated, _ := manager.GetSession(session.ID)
+	if updated.CommandCount != 0 {
+		t.Errorf("Expected the command count to stay 0, got %d", updated.CommandCount)
+	}
+	if _, search, _ := tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID}); search.TotalFound != 0 {
+		t.Errorf("Expected no history rows, got %d", search.TotalFound)
+	}
+	if _, blocked, _ := tools.GetBlockedCommandHistory(ctx, nil, GetBlockedCommandHistoryArgs{SessionID: session.ID}); blocked.Count != 0 {
+		t.Errorf("Expected no blocked command entries, got %d", blocked.Count)
+	}
+
+	if result, _, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: "not-a-session", Command: "ls", DryRun: true}); !result.IsError {
+		t.Error("Expected a dry run with an invalid session ID to fail")
+	}
+}
+
+func TestSessionSecurityPolicy(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	_, open, _ := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "open", WorkingDir: tempDir})
+	result, locked, _ := tools.CreateSession(ctx, nil, CreateSessionArgs{
+		Name:       "locked",
+		WorkingDir: tempDir,
+		SecurityPolicy: &terminal.SecurityPolicy{
+			AllowNetworkAccess: boolPtr(false),
+			BlockedCommands:    []string{"terraform"},
+		},
+	})
+	if result.IsError || locked.SecurityPolicy == nil {
+		t.Fatalf("Expected the session to be created with its policy, got %+v", locked)
+	}
+
+	// The global default allows network commands; the session's policy blocks them
+	if err := tools.ValidateCommandForSession(open.SessionID, "curl https://example.com"); err != nil {
+		t.Errorf("Expected curl allowed by the global settings, got %v", err)
+	}
+	if err := tools.ValidateCommandForSession(locked.SessionID, "curl https://example.com"); err == nil || !strings.Contains(err.Error(), "network access not allowed") {
+		t.Errorf("Expected curl rejected by the session policy, got %v", err)
+	}
+	_, dry, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: locked.SessionID, Command: "curl https://example.com", DryRun: true})
+	if dry.Security == nil || dry.Security.RuleType != RuleTypeNetworkAccess {
+		t.Errorf("Expected run_command to apply the session policy, got %+v", dry.Security)
+	}
+
+	// Blocklists are merged with the global one
+	if err := tools.ValidateCommandForSession(locked.SessionID, "terraform apply"); err == nil {
+		t.Error("Expected the session blocklist to apply")
+	}
+	if err := tools.ValidateCommandForSession(locked.SessionID, "shutdown now"); err == nil {
+		t.Error("Expected the global blocklist to still apply")
+	}
+	if err := tools.ValidateCommandForSession(open.SessionID, "terraform apply"); err != nil {
+		t.Errorf("Expected other sessions unaffected by the session blocklist, got %v", err)
+	}
+
+	// A policy cannot loosen the global settings
+	result, _, _ = tools.CreateSession(ctx, nil, CreateSessionArgs{
+		Name:           "loose",
+		WorkingDir:     tempDir,
+		SecurityPolicy: &terminal.SecurityPolicy{EnableSandbox: boolPtr(false)},
+	})
+	if !result.IsError {
+		t.Error("Expected a policy disabling the sandbox to be rejected")
+	}
+
+	_, listed, _ := tools.ListSessions(ctx, nil, ListSessionsArgs{})
+	for _, info := range listed.Sessions {
+		if (info.ID == locked.SessionID) != (info.SecurityPolicy != nil) {
+			t.Errorf("Expected only the locked session to list a policy, got %+v for %s", info.SecurityPolicy, info.Name)
+		}
+	}
+}
+
+func TestCreateSessionAutoCreateDirs(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	_, plain, _ := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "plain", WorkingDir: tempDir})
+	result, auto, _ := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "auto", WorkingDir: tempDir, AutoCreateDirs: true})
+	if result.IsError || !auto.AutoCreateDirs {
+		t.Fatalf("Expected the session to be created with auto_create_dirs, got %+v", auto)
+	}
+
+	_, refused, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: plain.SessionID, Command: "cd missing && pwd"})
+	if refused.Success || !strings.Contains(refused.ErrorOutput, "does not exist") {
+		t.Errorf("Expected cd to a missing directory to fail without auto_create_dirs, got %+v", refused)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "missing")); !os.IsNotExist(err) {
+		t.Error("Expected no directory to be created without auto_create_dirs")
+	}
+
+	if _, created, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: auto.SessionID, Command: "cd build/out && pwd"}); !created.Success {
+		t.Errorf("Expected cd to create the directory, got %+v", created)
+	}
+	if info, err := os.Stat(filepath.Join(tempDir, "build", "out")); err != nil || !info.IsDir() {
+		t.Errorf("Expected build/out to be created, got %v", err)
+	}
+}
+
+func TestRunCommandWithPTY(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("pty", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	const ttyCheck = "if [ -t 1 ]; then echo tty; else echo notty; fi"
+	result, ran, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: ttyCheck, UsePTY: true})
+	if err != nil || result.IsError {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+	if ran.PTYError != "" {
+		t.Skipf("Pseudo-terminals are not available: %s", ran.PTYError)
+	}
+	if !ran.PTY || !ran.Success || ran.Output != "tty\n" {
+		t.Errorf("Expected the command to see a terminal, got %+v", ran)
+	}
+
+	_, ran, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: ttyCheck})
+	if ran.PTY || ran.Output != "notty\n" {
+		t.Errorf("Expected no terminal by default, got %+v", ran)
+	}
+}
+
+func TestRunCommandSeparatesStderr(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("streams", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, response, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo artifact; sleep 0.1; echo warning >&2; sleep 0.1; echo done"})
+	if !response.Success || response.Output != "artifact\ndone\n" || response.ErrorOutput != "warning\n" {
+		t.Errorf("Expected stdout and stderr to be split, got output %q and error output %q", response.Output, response.ErrorOutput)
+	}
+	if response.CombinedOutput != "artifact\nwarning\ndone\n" {
+		t.Errorf("Expected the combined output to interleave both streams, got %q", response.CombinedOutput)
+	}
+
+	// A failure with no stderr still explains itself
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "exit 3"})
+	if response.Success || !strings.Contains(response.ErrorOutput, "exit status 3") {
+		t.Errorf("Expected the exit status in the error output, got %+v", response)
+	}
+}
+
+func TestRunCommandMaxOutputBytes(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("output-limit", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, response, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "seq 1 2000", MaxOutputBytes: 100})
+	if err != nil || result.IsError || !response.Success {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+	if !response.Truncated || !strings.HasPrefix(response.Output, "1\n2\n") || !strings.HasSuffix(response.Output, "1999\n2000\n") {
+		t.Errorf("Expected the start and end of the output around a truncation line, got %+v", response)
+	}
+	if !strings.Contains(response.Output, "[output truncated, ") {
+		t.Errorf("Expected a truncation line in the output, got %q", response.Output)
+	}
+
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "seq 1 3"})
+	if response.Truncated || response.Output != "1\n2\n3\n" {
+		t.Errorf("Expected output under the default limit to be kept whole, got %+v", response)
+	}
+
+	result, _, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "seq 1 3", MaxOutputBytes: -1})
+	if !result.IsError {
+		t.Error("Expected a negative max_output_bytes to be rejected")
+	}
+
+	// The server's max_output_size can be lowered per command but not raised
+	for requested, want := range map[int]int{0: 1000, 10: 10, 5000: 1000} {
+		if got := runCommandOutputLimit(requested, 1000); got != want {
+			t.Errorf("runCommandOutputLimit(%d, 1000) = %d, want %d", requested, got, want)
+		}
+	}
+}
+
+func TestRunCommandIdleTimeout(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("idle-timeout", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, response, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo started; sleep 10", IdleTimeout: 1})
+	if !response.TimedOut || response.TimeoutReason != "idle" || response.ExitCode != 124 || response.IdleTimeout != 1 {
+		t.Errorf("Expected the command to be stopped as idle, got %+v", response)
+	}
+	if !strings.Contains(response.ErrorOutput, "no output for 1 seconds") || response.TimeoutUsed != 1800 {
+		t.Errorf("Expected the idle message and the 30m default cap, got %q (timeout %d)", response.ErrorOutput, response.TimeoutUsed)
+	}
+
+	result, _, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo hi", IdleTimeout: -1})
+	if !result.IsError {
+		t.Error("Expected a negative idle_timeout to be rejected")
+	}
+
+	// Without an idle timeout the usual 5 minute cap applies; with one, command_max_timeout does
+	tools.config.Session.CommandMaxTimeout = time.Hour
+	for _, tt := range []struct{ timeout, idle, wantTimeout, wantIdle int }{
+		{0, 0, 60, 0},
+		{900, 0, 300, 0},
+		{0, 30, 3600, 30},
+		{900, 30, 900, 30},
+		{9000, 30, 3600, 30},
+	} {
+		if timeout, idle := tools.runCommandTimeouts(tt.timeout, tt.idle); timeout != tt.wantTimeout || idle != tt.wantIdle {
+			t.Errorf("runCommandTimeouts(%d, %d) = %d, %d, want %d, %d", tt.timeout, tt.idle, timeout, idle, tt.wantTimeout, tt.wantIdle)
+		}
+	}
+	tools.config.Session.CommandIdleTimeout = 45 * time.Second
+	if timeout, idle := tools.runCommandTimeouts(0, 0); timeout != 3600 || idle != 45 {
+		t.Errorf("Expected command_idle_timeout to apply by default, got %d, %d", timeout, idle)
+	}
+}
+
+func TestProtectedDirGuard(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("protected-dir", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	notes := filepath.Join(tempDir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("keep"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Outside a protected directory nothing is reported
+	_, response, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo hi"})
+	if response.ProtectedDir != nil {
+		t.Errorf("Expected no protected directory warning, got %+v", response.ProtectedDir)
+	}
+
+	tools.config.Security.ProtectedPaths = []string{tempDir}
+	tools.config.Security.ServerDirGuard = ServerDirGuardWarn
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo hi > out.txt"})
+	if !response.Success || response.ProtectedDir == nil || response.ProtectedDir.Destructive == "" || response.ProtectedDir.Handling != ServerDirGuardWarn {
+		t.Errorf("Expected warn to run the command and flag it, got %+v", response)
+	}
+
+	tools.config.Security.ServerDirGuard = ServerDirGuardBlock
+	result, response, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "rm notes.txt"})
+	if !result.IsError || response.ProtectedDir == nil || response.ProtectedDir.Overridden {
+		t.Errorf("Expected block to reject rm, got %+v", response)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("Expected the rejected rm to leave the file, got %v", err)
+	}
+
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "cat notes.txt 2>/dev/null"})
+	if !response.Success || response.ProtectedDir == nil || response.ProtectedDir.Destructive != "" {
+		t.Errorf("Expected block to let a read-only command run, got %+v", response)
+	}
+
+	_, dry, _ := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "sed -i s/keep/drop/ notes.txt", DryRun: true})
+	if dry.ValidationError == "" || dry.ProtectedDir == nil {
+		t.Errorf("Expected a dry run to report the rejection, got %+v", dry)
+	}
+
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "rm notes.txt", AllowProtectedDir: true})
+	if !response.Success || response.ProtectedDir == nil || !response.ProtectedDir.Overridden {
+		t.Errorf("Expected allow_protected_dir to override block, got %+v", response)
+	}
+
+	tools.config.Security.ServerDirGuard = ServerDirGuardOff
+	_, response, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "rm -f out.txt"})
+	if !response.Success || response.ProtectedDir != nil {
+		t.Errorf("Expected off to skip the guard, got %+v", response)
+	}
+
+	for command, destructive := range map[string]bool{
+		"ls -la":             false,
+		"go test ./... 2>&1": false,
+		"echo x >/dev/null":  false,
+		"echo '>' x":         false,
+		"echo x >> log.txt":  true,
+		"mv a b":             true,
+		"git reset --hard":   true,
+		"ls | sudo tee f":    true,
+	} {
+		if got := detectDestructive(command) != ""; got != destructive {
+			t.Errorf("detectDestructive(%q) = %v, want %v", command, got, destructive)
+		}
+	}
+}
+
+func TestGetActiveCommandOutput(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("active-output", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	_, active, _ := tools.GetActiveCommandOutput(ctx, nil, GetActiveCommandOutputArgs{SessionID: session.ID})
+	if active.Found {
+		t.Fatalf("Expected no command before any ran, got %+v", active)
+	}
+
+	result, _, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo one; echo two; echo three"})
+	if err != nil || result.IsError {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+
+	result, active, _ = tools.GetActiveCommandOutput(ctx, nil, GetActiveCommandOutputArgs{SessionID: session.ID, TailLines: 1})
+	if result.IsError || !active.Found {
+		t.Fatalf("Expected the last command's output, got %v", result.Content)
+	}
+	if active.ActiveCommand.Running || active.ActiveCommand.ExitCode == nil || *active.ActiveCommand.ExitCode != 0 {
+		t.Errorf("Expected the finished command with exit code 0, got %+v", active.ActiveCommand)
+	}
+	if active.ActiveCommand.Output != "three\n" || active.OutputLines != 3 {
+		t.Errorf("Expected the last of 3 lines, got %q (%d lines)", active.ActiveCommand.Output, active.OutputLines)
+	}
+
+	if result, _, _ := tools.GetActiveCommandOutput(ctx, nil, GetActiveCommandOutputArgs{SessionID: session.ID, TailLines: -1}); !result.IsError {
+		t.Error("Expected negative tail_lines to be rejected")
+	}
+}
+
+func TestGetCommandByID(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("command-by-id", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if result, _, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "seq 1 2000"}); err != nil || result.IsError {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+
+	_, search, _ := tools.SearchHistory(ctx, nil, SearchHistoryArgs{SessionID: session.ID})
+	if search.TotalFound != 1 || search.Results[0].Output != "" {
+		t.Fatalf("Expected one result without output, got %+v", search.Results)
+	}
+
+	result, fetched, err := tools.GetCommandByID(ctx, nil, GetCommandByIDArgs{CommandID: search.Results[0].ID})
+	if err != nil || result.IsError {
+		t.Fatalf("GetCommandByID failed: %v %v", err, result.Content)
+	}
+	if !strings.HasPrefix(fetched.Command.Output, "1\n2\n") || !strings.HasSuffix(fetched.Command.Output, "1999\n2000\n") {
+		t.Errorf("Expected the full output, got %d bytes", len(fetched.Command.Output))
+	}
+	if fetched.WorkingDir != session.WorkingDir || fetched.Duration == "" {
+		t.Errorf("Expected the working dir and duration, got %q %q", fetched.WorkingDir, fetched.Duration)
+	}
+
+	result, _, _ = tools.GetCommandByID(ctx, nil, GetCommandByIDArgs{CommandID: "no-such-command"})
+	if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "No command with ID no-such-command") {
+		t.Errorf("Expected a not-found error, got %v", result.Content)
+	}
+	if result, _, _ := tools.GetCommandByID(ctx, nil, GetCommandByIDArgs{CommandID: "  "}); !result.IsError {
+		t.Error("Expected an empty command_id to be rejected")
+	}
+}
+
+func TestExportHistoryAsScript(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("script-export", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	for _, command := range []string{"mkdir -p sub", "cd sub", "echo replayed > out.txt", "false"} {
+		if result, _, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: command}); err != nil || result.IsError {
+			t.Fatalf("RunCommand %q failed: %v %v", command, err, result.Content)
+		}
+	}
+	subDir := filepath.Join(session.WorkingDir, "sub")
+
+	result, exported, err := tools.ExportHistoryAsScript(ctx, nil, ExportHistoryAsScriptArgs{SessionID: session.ID, IncludeTimestamps: true})
+	if err != nil || result.IsError {
+		t.Fatalf("ExportHistoryAsScript failed: %v %v", err, result.Content)
+	}
+	if exported.CommandCount != 4 || !strings.HasPrefix(exported.Script, "#!/usr/bin/env bash\n") || !strings.Contains(exported.Script, "\nset -e\n") {
+		t.Errorf("Expected a script with all 4 commands, got %+v", exported)
+	}
+	order := []string{"cd " + shellEscape(session.WorkingDir) + "\n", "mkdir -p sub\n", "cd sub\n", "cd " + shellEscape(subDir) + "\n", "echo replayed > out.txt\n", "{\nfalse\n} || true\n"}
+	position := 0
+	for _, part := range order {
+		index := strings.Index(exported.Script[position:], part)
+		if index < 0 {
+			t.Fatalf("Expected %q after position %d in script:\n%s", part, position, exported.Script)
+		}
+		position += index + len(part)
+	}
+	if !strings.Contains(exported.Script, "# Exited with code 1") || strings.Count(exported.Script, "\n# 20") != 4 {
+		t.Errorf("Expected a failure comment and a timestamp per command, got:\n%s", exported.Script)
+	}
+
+	// Written to a file, the script reproduces the work from scratch
+	os.RemoveAll(subDir)
+	scriptPath := filepath.Join(tempDir, "replay.sh")
+	_, exported, _ = tools.ExportHistoryAsScript(ctx, nil, ExportHistoryAsScriptArgs{SessionID: session.ID, SuccessfulOnly: true, Path: scriptPath})
+	if exported.CommandCount != 3 || exported.FailedSkipped != 1 || exported.Path != scriptPath || strings.Contains(exported.Script, "false") {
+		t.Errorf("Expected the failed command to be left out, got %+v", exported)
+	}
+	if output, err := exec.Command(scriptPath).CombinedOutput(); err != nil {
+		t.Fatalf("Exported script failed: %v %s", err, output)
+	}
+	if data, err := os.ReadFile(filepath.Join(subDir, "out.txt")); err != nil || string(data) != "replayed\n" {
+		t.Errorf("Expected the script to recreate out.txt, got %q (%v)", data, err)
+	}
+
+	if result, _, _ := tools.ExportHistoryAsScript(ctx, nil, ExportHistoryAsScriptArgs{}); !result.IsError {
+		t.Error("Expected a session or project filter to be required")
+	}
+}
+
+func TestExportSessionHistory(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.config.Database.DataDir = tempDir
+	ctx := context.Background()
+	session, err := manager.CreateSession("history-export", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	commands := []string{"echo 'a|b'", `printf 'x,"y"\nz\n'`, "false"}
+	for _, command := range commands {
+		if result, _, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: command}); err != nil || result.IsError {
+			t.Fatalf("RunCommand %q failed: %v %v", command, err, result.Content)
+		}
+	}
+
+	result, exported, err := tools.ExportSessionHistory(ctx, nil, ExportSessionHistoryArgs{SessionID: session.ID})
+	if err != nil || result.IsError {
+		t.Fatalf("ExportSessionHistory failed: %v %v", err, result.Content)
+	}
+	if exported.Format != "json" || exported.RowCount != 3 || !strings.HasPrefix(exported.Path, filepath.Join(tempDir, "exports", session.ID)) {
+		t.Fatalf("Expected a JSON export of 3 rows in the data directory, got %+v", exported)
+	}
+	data, err := os.ReadFile(exported.Path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil || len(rows) != 3 {
+		t.Fatalf("Expected 3 JSON rows, got %d (%v)", len(rows), err)
+	}
+	if rows[0]["command"] != commands[0] || rows[2]["success"] != false || rows[2]["exit_code"] != float64(1) || rows[0]["output"] != nil {
+		t.Errorf("Expected rows oldest first without output, got %v", rows)
+	}
+
+	csvPath := filepath.Join(tempDir, "history.csv")
+	_, exported, _ = tools.ExportSessionHistory(ctx, nil, ExportSessionHistoryArgs{SessionID: session.ID, Format: "csv", IncludeOutput: true, Path: csvPath})
+	if exported.Path != csvPath || exported.RowCount != 3 {
+		t.Fatalf("Expected a CSV export at %s, got %+v", csvPath, exported)
+	}
+	file, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to open CSV export: %v", err)
+	}
+	records, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil || len(records) != 4 || len(records[0]) != 8 {
+		t.Fatalf("Expected a header and 3 rows of 8 fields, got %v (%v)", records, err)
+	}
+	if records[2][0] != commands[1] || records[2][6] != "x,\"y\"\nz\n" {
+		t.Errorf("Expected quoted fields to round-trip, got %q", records[2])
+	}
+
+	_, exported, _ = tools.ExportSessionHistory(ctx, nil, ExportSessionHistoryArgs{SessionID: session.ID, Format: "markdown", IncludeOutput: true})
+	data, err = os.ReadFile(exported.Path)
+	if err != nil || !strings.HasSuffix(exported.Path, ".md") {
+		t.Fatalf("Failed to read Markdown export %s: %v", exported.Path, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a header, separator and 3 rows, got:\n%s", data)
+	}
+	for _, line := range lines {
+		if cells := strings.Count(line, "|") - strings.Count(line, `\|`); cells != 9 {
+			t.Errorf("Expected 9 unescaped pipes in %q, got %d", line, cells)
+		}
+	}
+	if !strings.Contains(lines[2], `echo 'a\|b'`) || !strings.Contains(lines[3], `x,"y"<br>z<br>`) {
+		t.Errorf("Expected pipes escaped and newlines replaced, got:\n%s", data)
+	}
+
+	if result, _, _ := tools.ExportSessionHistory(ctx, nil, ExportSessionHistoryArgs{SessionID: session.ID, Format: "xml"}); !result.IsError {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestGetCommandStream(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	session, err := manager.CreateSession("command-stream", "", tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	result, ran, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.ID, Command: "echo out; echo err >&2; (exit 3)"})
+	if err != nil || result.IsError {
+		t.Fatalf("RunCommand failed: %v %v", err, result.Content)
+	}
+	if ran.CommandID == "" || !ran.StreamingUsed || ran.TotalChunks == 0 {
+		t.Fatalf("Expected a streamed command with an ID, got %+v", ran)
+	}
+
+	result, stream, err := tools.GetCommandStream(ctx, nil, GetCommandStreamArgs{CommandID: ran.CommandID})
+	if err != nil || result.IsError {
+		t.Fatalf("GetCommandStream failed: %v %v", err, result.Content)
+	}
+	if stream.Count != ran.TotalChunks || !stream.Complete || stream.ExitCode == nil || *stream.ExitCode != 3 {
+		t.Fatalf("Expected %d chunks ending with exit code 3, got %+v", ran.TotalChunks, stream)
+	}
+	if stream.LastSequence != stream.Chunks[len(stream.Chunks)-1].SequenceNum {
+		t.Errorf("Expected last_sequence %d, got %d", stream.Chunks[len(stream.Chunks)-1].SequenceNum, stream.LastSequence)
+	}
+
+	_, rest, _ := tools.GetCommandStream(ctx, nil, GetCommandStreamArgs{CommandID: ran.CommandID, AfterSequence: 1})
+	if rest.Count != stream.Count-1 || (rest.Count > 0 && rest.Chunks[0].SequenceNum != 2) {
+		t.Errorf("Expected the chunks after sequence 1, got %+v", rest.Chunks)
+	}
+	_, done, _ := tools.GetCommandStream(ctx, nil, GetCommandStreamArgs{CommandID: ran.CommandID, AfterSequence: stream.LastSequence})
+	if done.Count != 0 || done.Chunks == nil {
+		t.Errorf("Expected an empty chunk list past the end, got %+v", done)
+	}
+
+	result, _, _ = tools.GetCommandStream(ctx, nil, GetCommandStreamArgs{CommandID: "no-such-command"})
+	if !result.IsError {
+		t.Error("Expected an unknown command_id to be rejected")
+	}
+	if result, _, _ := tools.GetCommandStream(ctx, nil, GetCommandStreamArgs{CommandID: ran.CommandID, AfterSequence: -1}); !result.IsError {
+		t.Error("Expected a negative after_sequence to be rejected")
+	}
+}
+
+func TestCreateCommandTemplateInfersCategory(t *testing.T) {
+	tools, manager, tempDir := setupTestToolsEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	cases := []struct {
+		name     string
+		command  string
+		category string
+		want     string
+		inferred bool
+	}{
+		{"git-fetch", "git fetch --all", "", "git", true},
+		{"npx-lint", "npx eslint .", "", "nodejs", true},
+		{"compose-down", "/usr/local/bin/docker-compose down", "", "docker", true},
+		{"make-release", "make release", "", "make", true},
+		{"explicit", "git tag {{version}}", "release", "release", false},
+		{"placeholder", "{{tool}} --version", "", "", false},
+	}
+	for _, tc := range cases {
+		result, template, _ := tools.CreateCommandTemplate(ctx, nil, CreateCommandTemplateArgs{Name: tc.name, Command: tc.command, Category: tc.category})
+		if result.IsError {
+			t.Fatalf("Failed to create template %s: %v", tc.name, result.Content)
+		}
+		if template.Category != tc.want || template.CategoryInferred != tc.inferred {
+			t.Errorf("%s: expected category %q (inferred=%v), got %q (inferred=%v)", tc.name, tc.want, tc.inferred, template.Category, template.CategoryInferred)
+		}
+	}
+
+	_, updated, _ := tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "git-fetch", Command: "docker pull nginx"})
+	if updated.Template.Category != "docker" || !updated.Template.CategoryInferred || !slices.Contains(updated.Updated, "category") {
+		t.Errorf("Expected a new command to re-infer the category, got %+v", updated)
+	}
+
+	_, updated, _ = tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "explicit", Command: "docker tag app:{{version}}"})
+	if updated.Template.Category != "release" || updated.Template.CategoryInferred {
+		t.Errorf("Expected an explicit category to survive a command change, got %+v", updated.Template)
+	}
+
+	_, updated, _ = tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "make-release", Category: "ops"})
+	if updated.Template.Category != "ops" || updated.Template.CategoryInferred {
+		t.Errorf("Expected an explicit category to clear the inferred flag, got %+v", updated.Template)
+	}
+	_, updated, _ = tools.UpdateCommandTemplate(ctx, nil, UpdateTemplateArgs{Name: "make-release", Command: "git push --tags"})
+	if updated.Template.Category != "ops" {
+		t.Errorf("Expected a category set by update to survive a command change, got %q", updated.Template.Category)
+	}
+
+	tools.config.Session.InferTemplateCategory = false
+	_, template, _ := tools.CreateCommandTemplate(ctx, nil, CreateCommandTemplateArgs{Name: "git-gc", Command: "git gc"})
+	if template.Category != "" || template.CategoryInferred {
+		t.Errorf("Expected no category with inference disabled, got %q", template.Category)
 	}
 }
@@ -14,6 +14,22 @@ const (
 	MaxBackgroundProcesses   = 3
 	BackgroundOutputLimit    = 2000 // characters
 
+	// Background process auto-restart defaults
+	DefaultMaxRestarts    = 3
+	MaxAutoRestarts       = 100
+	DefaultRestartBackoff = 1 // seconds
+
+	// Blocked command history query limits
+	DefaultBlockedHistoryLimit = 50
+	MaxBlockedHistoryLimit     = 500
+
+	// Session event query limits
+	DefaultSessionEventsLimit = 50
+	MaxSessionEventsLimit     = 500
+
+	// Extra executables diagnose_environment may be asked to look for
+	MaxDiagnosticTools = 20
+
 	// Rate limiting defaults
 	DefaultRateLimitPerMinute = 60
 	DefaultRateLimitBurst     = 10
@@ -35,6 +51,20 @@ const (
 	// Session cleanup
 	InactiveSessionTimeout = 60 // minutes
 
+	// Dotenv imports
+	MaxEnvFileSize = 1024 * 1024 // bytes
+
+	// Recent commands scanned when searching output across all sessions
+	CrossSessionSearchScanLimit = 1000
+
+	// search_command_output sort_by values
+	SearchSortRecency   = "recency"
+	SearchSortRelevance = "relevance"
+
+	// Command history tags given to run_command and run_background_process
+	MaxCommandTags      = 20
+	MaxCommandTagLength = 64
+
 	// UUID validation pattern
 	UUIDPattern = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
 )
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Daemon command handling modes (session.daemon_command_handling)
+const (
+	DaemonHandlingWarn       = "warn"
+	DaemonHandlingReject     = "reject"
+	DaemonHandlingCapturePID = "capture_pid"
+)
+
+// daemonPIDMarker prefixes the line that reports $! when capture_pid is enabled
+const daemonPIDMarker = "__GO_TERM_DAEMON_PID__="
+
+// daemonLimitation is reported with every flagged command so the agent knows what the server cannot see
+const daemonLimitation = "Foreground execution only tracks the shell it starts. A process that forks into the background keeps running after the command returns, is not listed by list_background_processes and is not stopped when the session is deleted. A backgrounded process that keeps stdout open also makes the command wait until it exits or the timeout kills it."
+
+// daemonizingPatterns match commands that detach from the calling shell on their own
+var daemonizingPatterns = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`(^|[;&|(]\s*)(nohup|setsid|disown|daemonize|start-stop-daemon)\b`), "detaches the process from the shell"},
+	{regexp.MustCompile(`\bdocker(-compose|\s+compose)?\s+(run|up|start)\b.*\s(-d|--detach)\b`), "starts detached containers"},
+	{regexp.MustCompile(`\bpodman\s+(run|start)\b.*\s(-d|--detach)\b`), "starts detached containers"},
+	{regexp.MustCompile(`\b(pm2|forever)\s+start\b`), "hands the process to a process manager"},
+	{regexp.MustCompile(`\b(screen\s+-\w*d\w*m|tmux\s+new(-session)?\b.*\s-d\b)`), "starts a detached terminal multiplexer session"},
+	{regexp.MustCompile(`\bredis-server\b.*--daemonize\s+yes\b`), "runs redis as a daemon"},
+	{regexp.MustCompile(`\bmongod\b.*--fork\b`), "forks mongod into the background"},
+	{regexp.MustCompile(`\bpg_ctl\b.*\bstart\b`), "starts postgres as a daemon"},
+	{regexp.MustCompile(`\b(systemctl|service)\b.*\b(start|restart)\b`), "starts a system service"},
+}
+
+// DaemonWarning flags a foreground command whose process may outlive it untracked
+type DaemonWarning struct {
+	Reason     string `json:"reason"`
+	Handling   string `json:"handling"`             // warn, reject or capture_pid
+	PID        int    `json:"pid,omitempty"`        // PID of the last '&' job when capture_pid is enabled
+	Suggestion string `json:"suggestion"`           // What to do instead
+	Limitation string `json:"limitation,omitempty"` // What the server cannot track
+}
+
+// detectDaemonizing reports why command may leave a process running after it returns, and
+// whether that is because it backgrounds a job with '&'
+func detectDaemonizing(command string) (reason string, backgrounded bool) {
+	if hasBackgroundOperator(command) {
+		return "runs a job in the background with '&'", true
+	}
+	for _, entry := range daemonizingPatterns {
+		if entry.pattern.MatchString(command) {
+			return entry.reason, false
+		}
+	}
+	return "", false
+}
+
+// hasBackgroundOperator reports whether command uses '&' as a control operator, ignoring
+// quoted text, '&&' and redirections such as '2>&1' and '&>'
+func hasBackgroundOperator(command string) bool {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '&':
+			if i+1 < len(command) && (command[i+1] == '&' || command[i+1] == '>') {
+				i++
+				continue
+			}
+			if i > 0 && (command[i-1] == '>' || command[i-1] == '<' || command[i-1] == '|') {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// newDaemonWarning builds the warning for a flagged command under the configured handling
+func newDaemonWarning(reason, handling string) *DaemonWarning {
+	return &DaemonWarning{
+		Reason:     fmt.Sprintf("Command %s", reason),
+		Handling:   handling,
+		Suggestion: "Use run_background_process for long-running processes so they are tracked, their output is captured and they are stopped with the session",
+		Limitation: daemonLimitation,
+	}
+}
+
+// withDaemonPIDCapture appends a line that prints the PID of the last background job
+func withDaemonPIDCapture(command string) string {
+	return command + "\necho \"" + daemonPIDMarker + "$!\""
+}
+
+// extractDaemonPID removes the capture line from output and returns the PID it reported
+func extractDaemonPID(output string) (string, int) {
+	idx := strings.LastIndex(output, daemonPIDMarker)
+	if idx < 0 {
+		return output, 0
+	}
+	rest := output[idx+len(daemonPIDMarker):]
+	line, after, _ := strings.Cut(rest, "\n")
+	pid, _ := strconv.Atoi(strings.TrimSpace(line))
+	return output[:idx] + after, pid
+}
@@ -3,10 +3,13 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/tracing"
 )
 
 // F7: ProcessDependency represents a dependency between background processes
@@ -28,7 +31,7 @@ type ProcessChain struct {
 	Description string           `json:"description"`
 	SessionID   string           `json:"session_id"`
 	Processes   []ChainedProcess `json:"processes"`
-	Status      string           `json:"status"` // pending, running, completed, failed
+	Status      string           `json:"status"` // pending, running, completed, failed, cancelled, stopped
 	StartedAt   time.Time        `json:"started_at,omitempty"`
 	CompletedAt time.Time        `json:"completed_at,omitempty"`
 	Error       string           `json:"error,omitempty"`
@@ -39,9 +42,17 @@ type ChainedProcess struct {
 	Name         string `json:"name"`
 	Command      string `json:"command"`
 	ReadyPattern string `json:"ready_pattern,omitempty"` // Pattern indicating process is ready
+	ReadyTimeout int    `json:"ready_timeout,omitempty"` // Seconds to wait for ReadyPattern (default: configured readiness timeout)
 	WaitSeconds  int    `json:"wait_seconds,omitempty"`  // Wait this many seconds before next
 	ProcessID    string `json:"process_id,omitempty"`    // Set after starting
-	Status       string `json:"status"`                  // pending, starting, running, ready, failed
+	Status       string `json:"status"`                  // pending, starting, running, ready, failed, cancelled, stopped
+
+	// Names of the steps that must be ready before this one starts. When no step in a chain sets
+	// it, each step depends on the one before it.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Dependencies not yet ready, reported by get_process_chain_status for pending steps. Output
+	// only: CreateChain drops any value passed in.
+	BlockedOn []string `json:"blocked_on,omitempty"`
 }
 
 // F7: DependencyManager manages process dependencies
@@ -100,16 +111,119 @@ func (dm *DependencyManager) CreateChain(chain *ProcessChain) error {
 		return fmt.Errorf("chain must have at least one process")
 	}
 
+	if _, err := chainDependencies(chain.Processes); err != nil {
+		return err
+	}
+
 	chain.ID = fmt.Sprintf("chain-%s-%d", chain.Name, time.Now().Unix())
 	chain.Status = "pending"
 	for i := range chain.Processes {
 		chain.Processes[i].Status = "pending"
+		chain.Processes[i].BlockedOn = nil
 	}
 
 	dm.chains[chain.ID] = chain
 	return nil
 }
 
+// chainDependencies returns, for each step of a chain, the indices of the steps it depends on.
+// Chains where no step sets depends_on run in order, each step depending on the previous one.
+// Otherwise step names must be unique, every dependency must name another step, and the
+// dependencies must not form a cycle.
+func chainDependencies(processes []ChainedProcess) ([][]int, error) {
+	deps := make([][]int, len(processes))
+
+	explicit := false
+	for _, proc := range processes {
+		if len(proc.DependsOn) > 0 {
+			explicit = true
+			break
+		}
+	}
+	if !explicit {
+		for i := 1; i < len(processes); i++ {
+			deps[i] = []int{i - 1}
+		}
+		return deps, nil
+	}
+
+	index := make(map[string]int, len(processes))
+	for i, proc := range processes {
+		if _, exists := index[proc.Name]; exists {
+			return nil, fmt.Errorf("process names must be unique when depends_on is used: %q appears more than once", proc.Name)
+		}
+		index[proc.Name] = i
+	}
+	for i, proc := range processes {
+		seen := make(map[int]bool, len(proc.DependsOn))
+		for _, name := range proc.DependsOn {
+			j, exists := index[name]
+			switch {
+			case !exists:
+				return nil, fmt.Errorf("process %q depends on unknown process %q", proc.Name, name)
+			case j == i:
+				return nil, fmt.Errorf("process %q cannot depend on itself", proc.Name)
+			case !seen[j]:
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	if cycle := findChainCycle(deps); cycle != nil {
+		names := make([]string, len(cycle))
+		for k, i := range cycle {
+			names[k] = processes[i].Name
+		}
+		return nil, fmt.Errorf("dependency cycle: %s", strings.Join(names, " -> "))
+	}
+	return deps, nil
+}
+
+// findChainCycle returns the steps of a dependency cycle, starting and ending with the same
+// step, or nil if there is none
+func findChainCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(deps))
+	var path []int
+
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range deps[i] {
+			switch state[j] {
+			case visiting:
+				for k, step := range path {
+					if step == j {
+						return append(append([]int(nil), path[k:]...), j)
+					}
+				}
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := range deps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
 // GetChain retrieves a chain by ID
 func (dm *DependencyManager) GetChain(chainID string) (*ProcessChain, bool) {
 	dm.mu.RLock()
@@ -119,6 +233,20 @@ func (dm *DependencyManager) GetChain(chainID string) (*ProcessChain, bool) {
 	return chain, exists
 }
 
+// ChainSnapshot returns a copy of a chain taken under the lock, safe to read while the chain runs
+func (dm *DependencyManager) ChainSnapshot(chainID string) (ProcessChain, bool) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	chain, exists := dm.chains[chainID]
+	if !exists {
+		return ProcessChain{}, false
+	}
+	snapshot := *chain
+	snapshot.Processes = append([]ChainedProcess(nil), chain.Processes...)
+	return snapshot, true
+}
+
 // ListChains returns all chains
 func (dm *DependencyManager) ListChains() []*ProcessChain {
 	dm.mu.RLock()
@@ -137,6 +265,10 @@ func (dm *DependencyManager) UpdateChainStatus(chainID, status, errorMsg string)
 	defer dm.mu.Unlock()
 
 	if chain, exists := dm.chains[chainID]; exists {
+		// A cancelled or stopped chain keeps its status even if its runner reports later
+		if isChainAbortedStatus(chain.Status) {
+			return
+		}
 		chain.Status = status
 		if errorMsg != "" {
 			chain.Error = errorMsg
@@ -162,6 +294,170 @@ func (dm *DependencyManager) UpdateProcessStatus(chainID string, processIndex in
 	}
 }
 
+// CancelledChain describes a chain cancelled in bulk and the processes it had started
+type CancelledChain struct {
+	ChainID        string   `json:"chain_id"`
+	Name           string   `json:"name"`
+	PreviousStatus string   `json:"previous_status"`
+	ProcessIDs     []string `json:"process_ids,omitempty"`
+}
+
+// CancelSessionChains marks every chain belonging to a session as cancelled and returns
+// the processes each one had started. Chains that are already cancelled or stopped are skipped.
+func (dm *DependencyManager) CancelSessionChains(sessionID string) []CancelledChain {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	var cancelled []CancelledChain
+	for _, chain := range dm.chains {
+		if chain.SessionID != sessionID || isChainAbortedStatus(chain.Status) {
+			continue
+		}
+
+		entry := CancelledChain{
+			ChainID:        chain.ID,
+			Name:           chain.Name,
+			PreviousStatus: chain.Status,
+		}
+		for i := range chain.Processes {
+			if chain.Processes[i].ProcessID != "" {
+				entry.ProcessIDs = append(entry.ProcessIDs, chain.Processes[i].ProcessID)
+			}
+			if chain.Processes[i].Status == "pending" || chain.Processes[i].Status == "starting" {
+				chain.Processes[i].Status = "cancelled"
+			}
+		}
+
+		chain.Status = "cancelled"
+		chain.Error = "cancelled"
+		chain.CompletedAt = time.Now()
+		cancelled = append(cancelled, entry)
+	}
+
+	sort.Slice(cancelled, func(i, j int) bool { return cancelled[i].ChainID < cancelled[j].ChainID })
+	return cancelled
+}
+
+// IsChainHalted reports whether a chain has been cancelled, stopped or has failed, after which no
+// more of its steps start
+func (dm *DependencyManager) IsChainHalted(chainID string) bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	chain, exists := dm.chains[chainID]
+	return exists && (isChainAbortedStatus(chain.Status) || chain.Status == "failed")
+}
+
+// IsChainAborted reports whether a chain has been cancelled or stopped, so a step still starting
+// should give up and terminate anything it started
+func (dm *DependencyManager) IsChainAborted(chainID string) bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	chain, exists := dm.chains[chainID]
+	return exists && isChainAbortedStatus(chain.Status)
+}
+
+// isChainAbortedStatus reports whether a chain status means it was cancelled or stopped
+func isChainAbortedStatus(status string) bool {
+	return status == "cancelled" || status == "stopped"
+}
+
+// ChainStepProcess identifies the process a chain step started
+type ChainStepProcess struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	ProcessID string `json:"process_id"`
+	Error     string `json:"error,omitempty"` // Why the process could not be stopped
+}
+
+// StoppedChain describes a chain marked stopped and the processes its steps started
+type StoppedChain struct {
+	ChainID        string
+	Name           string
+	SessionID      string
+	PreviousStatus string
+	Started        []ChainStepProcess // Dependents before the steps they depend on
+	NotStarted     []string           // Steps that had not started, now cancelled
+}
+
+// StopChain marks a chain stopped so no more of its steps start, cancels the steps that have not
+// started, and returns the processes its steps started, dependents before their dependencies.
+// A step caught mid-start is among NotStarted; its runner terminates the process it started.
+func (dm *DependencyManager) StopChain(chainID string) (*StoppedChain, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	chain, exists := dm.chains[chainID]
+	if !exists {
+		return nil, fmt.Errorf("chain not found: %s", chainID)
+	}
+	if isChainAbortedStatus(chain.Status) {
+		return nil, fmt.Errorf("chain is already %s", chain.Status)
+	}
+
+	stopped := &StoppedChain{
+		ChainID:        chain.ID,
+		Name:           chain.Name,
+		SessionID:      chain.SessionID,
+		PreviousStatus: chain.Status,
+		Started:        []ChainStepProcess{},
+		NotStarted:     []string{},
+	}
+	deps, _ := chainDependencies(chain.Processes)
+	for _, i := range chainStopOrder(deps) {
+		proc := &chain.Processes[i]
+		if proc.ProcessID != "" {
+			stopped.Started = append(stopped.Started, ChainStepProcess{Index: i, Name: proc.Name, ProcessID: proc.ProcessID})
+			continue
+		}
+		if proc.Status == "pending" || proc.Status == "starting" {
+			proc.Status = "cancelled"
+			stopped.NotStarted = append(stopped.NotStarted, proc.Name)
+		}
+	}
+
+	chain.Status = "stopped"
+	chain.CompletedAt = time.Now()
+	return stopped, nil
+}
+
+// chainStopOrder returns the steps of a chain in the order to stop them: the reverse of an order
+// in which every step comes after its dependencies
+func chainStopOrder(deps [][]int) []int {
+	remaining := make([]int, len(deps))
+	dependents := make([][]int, len(deps))
+	for i, stepDeps := range deps {
+		remaining[i] = len(stepDeps)
+		for _, j := range stepDeps {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var queue, order []int
+	for i := range deps {
+		if remaining[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, i)
+		for _, dependent := range dependents[i] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	for a, b := 0, len(order)-1; a < b; a, b = a+1, b-1 {
+		order[a], order[b] = order[b], order[a]
+	}
+	return order
+}
+
 // =============================================================================
 // F7: Dependency Tool Handlers
 // =============================================================================
@@ -171,7 +467,7 @@ type CreateProcessChainArgs struct {
 	SessionID   string           `json:"session_id" jsonschema:"required,description=Session ID to run processes in"`
 	Name        string           `json:"name" jsonschema:"required,description=Name for the process chain"`
 	Description string           `json:"description,omitempty" jsonschema:"description=Description of the chain"`
-	Processes   []ChainedProcess `json:"processes" jsonschema:"required,description=List of processes to run in order"`
+	Processes   []ChainedProcess `json:"processes" jsonschema:"required,description=List of processes to run in order, or as a graph when steps set depends_on"`
 }
 
 // CreateProcessChainResult represents the result of creating a chain
@@ -192,7 +488,7 @@ type StartProcessChainArgs struct {
 type StartProcessChainResult struct {
 	ChainID    string   `json:"chain_id"`
 	Status     string   `json:"status"`
-	ProcessIDs []string `json:"process_ids"`
+	ProcessIDs []string `json:"process_ids"` // Empty: steps start asynchronously, see get_process_chain_status
 	Message    string   `json:"message"`
 }
 
@@ -201,6 +497,40 @@ type GetProcessChainStatusArgs struct {
 	ChainID string `json:"chain_id" jsonschema:"required,description=Chain ID to check"`
 }
 
+// CancelSessionProcessChainsArgs represents arguments for cancelling all chains in a session
+type CancelSessionProcessChainsArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=Session whose process chains should be cancelled"`
+	Force     bool   `json:"force,omitempty" jsonschema:"description=Kill started processes immediately instead of terminating gracefully"`
+}
+
+// CancelSessionProcessChainsResult represents the result of cancelling a session's chains
+type CancelSessionProcessChainsResult struct {
+	SessionID        string           `json:"session_id"`
+	ChainsCancelled  int              `json:"chains_cancelled"`
+	ProcessesStopped int              `json:"processes_stopped"`
+	Chains           []CancelledChain `json:"chains"`
+	Errors           []string         `json:"errors,omitempty"`
+	Message          string           `json:"message"`
+}
+
+// StopProcessChainArgs represents arguments for stopping a process chain
+type StopProcessChainArgs struct {
+	ChainID string `json:"chain_id" jsonschema:"required,description=Chain ID to stop"`
+}
+
+// StopProcessChainResult represents the result of stopping a process chain
+type StopProcessChainResult struct {
+	ChainID        string             `json:"chain_id"`
+	Name           string             `json:"name"`
+	PreviousStatus string             `json:"previous_status"`
+	Status         string             `json:"status"`
+	Terminated     []ChainStepProcess `json:"terminated"`     // In the order they were stopped, dependents first
+	AlreadyExited  []ChainStepProcess `json:"already_exited"` // Started but no longer running
+	Failed         []ChainStepProcess `json:"failed"`         // Could not be stopped, with the error
+	NotStarted     []string           `json:"not_started"`    // Steps cancelled before they started
+	Message        string             `json:"message"`
+}
+
 // CreateProcessChain creates a new process chain with dependencies
 func (t *TerminalTools) CreateProcessChain(ctx context.Context, req *mcp.CallToolRequest, args CreateProcessChainArgs) (*mcp.CallToolResult, CreateProcessChainResult, error) {
 	// Validate session exists
@@ -247,63 +577,271 @@ func (t *TerminalTools) StartProcessChain(ctx context.Context, req *mcp.CallTool
 		return createErrorResult(fmt.Sprintf("Chain is already %s", chain.Status)), StartProcessChainResult{}, nil
 	}
 
+	// The runner works from a copy of the steps, since their statuses change under the lock while
+	// it runs; dependencies were validated when the chain was created
+	snapshot, _ := t.dependencyManager.ChainSnapshot(args.ChainID)
+	steps := snapshot.Processes
+	deps, _ := chainDependencies(steps)
+
 	// Update chain status
 	t.dependencyManager.UpdateChainStatus(args.ChainID, "running", "")
 	chain.StartedAt = time.Now()
 
-	var processIDs []string
+	// The chain's span is the parent of one span per process, so a trace shows the whole startup
+	chainCtx, chainSpan := t.tracer.StartSpan(context.Background(), "process_chain")
+	chainSpan.SetAttributes(map[string]interface{}{
+		"chain.id":            chain.ID,
+		"chain.name":          chain.Name,
+		"chain.process_count": len(chain.Processes),
+		tracing.AttrSessionID: chain.SessionID,
+	})
 
-	// Start processes in order with dependency handling
+	// Each step starts once the steps it depends on are ready, so independent branches start in
+	// parallel. After a failure or cancellation no further steps start; their IDs are reported
+	// by get_process_chain_status as they start.
 	go func() {
-		for i, proc := range chain.Processes {
-			t.dependencyManager.UpdateProcessStatus(args.ChainID, i, "starting", "")
-
-			// Start the background process
-			processID, err := t.manager.ExecuteCommandInBackground(chain.SessionID, proc.Command)
-			if err != nil {
-				t.dependencyManager.UpdateProcessStatus(args.ChainID, i, "failed", "")
-				t.dependencyManager.UpdateChainStatus(args.ChainID, "failed", fmt.Sprintf("Process %d failed: %v", i, err))
-				return
-			}
+		defer chainSpan.End()
 
-			processIDs = append(processIDs, processID)
-			t.dependencyManager.UpdateProcessStatus(args.ChainID, i, "running", processID)
+		ready := make([]bool, len(steps))
+		finished := make([]chan struct{}, len(steps))
+		for i := range finished {
+			finished[i] = make(chan struct{})
+		}
 
-			// Wait for ready pattern or fixed delay
-			if proc.WaitSeconds > 0 {
-				time.Sleep(time.Duration(proc.WaitSeconds) * time.Second)
-			}
+		var wg sync.WaitGroup
+		for i, proc := range steps {
+			wg.Add(1)
+			go func(i int, proc ChainedProcess) {
+				defer wg.Done()
+				defer close(finished[i])
+
+				for _, j := range deps[i] {
+					<-finished[j]
+					if !ready[j] {
+						return
+					}
+				}
+				if t.dependencyManager.IsChainHalted(args.ChainID) {
+					return
+				}
+
+				if _, ok := t.startChainProcess(chainCtx, chain, i, proc); ok {
+					ready[i] = true
+				} else if !t.dependencyManager.IsChainAborted(args.ChainID) {
+					chainSpan.SetStatus(tracing.StatusError, fmt.Sprintf("process %d (%s) failed", i, proc.Name))
+				}
+			}(i, proc)
+		}
+		wg.Wait()
 
-			// Check if process is still running
-			bgProc, err := t.manager.GetBackgroundProcess(chain.SessionID, processID)
-			if err != nil || !bgProc.IsRunning {
-				t.dependencyManager.UpdateProcessStatus(args.ChainID, i, "failed", processID)
-				t.dependencyManager.UpdateChainStatus(args.ChainID, "failed", fmt.Sprintf("Process %d exited unexpectedly", i))
+		for _, ok := range ready {
+			if !ok {
+				if t.dependencyManager.IsChainAborted(args.ChainID) {
+					chainSpan.AddEvent("chain_cancelled")
+				}
 				return
 			}
-
-			t.dependencyManager.UpdateProcessStatus(args.ChainID, i, "ready", processID)
 		}
-
 		t.dependencyManager.UpdateChainStatus(args.ChainID, "completed", "")
+		chainSpan.SetStatus(tracing.StatusOK, "all processes ready")
 	}()
 
 	result := StartProcessChainResult{
-		ChainID:    chain.ID,
-		Status:     "running",
-		ProcessIDs: processIDs,
-		Message:    fmt.Sprintf("Started process chain '%s'", chain.Name),
+		ChainID: chain.ID,
+		Status:  "running",
+		Message: fmt.Sprintf("Started process chain '%s'", chain.Name),
 	}
 
 	return createJSONResult(result), result, nil
 }
 
-// GetProcessChainStatus gets the current status of a process chain
+// startChainProcess starts process i of a chain and waits until it is ready, recording a child
+// span of the chain's span. It reports false when the chain was cancelled or stopped or the process failed,
+// in which case the chain status has already been updated.
+func (t *TerminalTools) startChainProcess(chainCtx context.Context, chain *ProcessChain, i int, proc ChainedProcess) (string, bool) {
+	_, span := t.tracer.StartSpan(chainCtx, "chain_process")
+	defer span.End()
+	span.SetAttributes(map[string]interface{}{
+		"chain.id":            chain.ID,
+		"process.index":       i,
+		"process.name":        proc.Name,
+		tracing.AttrCommand:   proc.Command,
+		tracing.AttrSessionID: chain.SessionID,
+	})
+
+	fail := func(processID, message string) (string, bool) {
+		t.dependencyManager.UpdateProcessStatus(chain.ID, i, "failed", processID)
+		t.dependencyManager.UpdateChainStatus(chain.ID, "failed", fmt.Sprintf("Process %d %s", i, message))
+		span.SetStatus(tracing.StatusError, message)
+		return processID, false
+	}
+	cancelled := func(processID string) (string, bool) {
+		span.AddEvent("chain_cancelled")
+		return processID, false
+	}
+
+	if t.dependencyManager.IsChainAborted(chain.ID) {
+		return cancelled("")
+	}
+	t.dependencyManager.UpdateProcessStatus(chain.ID, i, "starting", "")
+
+	// Start the background process
+	processID, err := t.manager.ExecuteCommandInBackground(chain.SessionID, proc.Command)
+	if err != nil {
+		return fail("", fmt.Sprintf("failed: %v", err))
+	}
+	span.SetAttribute("process.id", processID)
+
+	// The chain may have been cancelled while this process was starting
+	if t.dependencyManager.IsChainAborted(chain.ID) {
+		t.manager.TerminateBackgroundProcess(chain.SessionID, processID, false)
+		return cancelled(processID)
+	}
+	t.dependencyManager.UpdateProcessStatus(chain.ID, i, "running", processID)
+
+	// Wait for ready pattern or fixed delay
+	if proc.ReadyPattern != "" {
+		timeout := t.readinessTimeout(proc.ReadyTimeout)
+		ready, err := t.manager.WaitForBackgroundReady(context.Background(), chain.SessionID, processID, proc.ReadyPattern, timeout)
+		if t.dependencyManager.IsChainAborted(chain.ID) {
+			return cancelled(processID)
+		}
+		if !ready {
+			reason := fmt.Sprintf("ready pattern not seen within %s", timeout)
+			if err != nil {
+				reason = err.Error()
+			}
+			return fail(processID, "not ready: "+reason)
+		}
+	}
+	if proc.WaitSeconds > 0 {
+		time.Sleep(time.Duration(proc.WaitSeconds) * time.Second)
+	}
+	if t.dependencyManager.IsChainAborted(chain.ID) {
+		return cancelled(processID)
+	}
+
+	// Check if process is still running
+	bgProc, err := t.manager.GetBackgroundProcess(chain.SessionID, processID)
+	if err != nil || !bgProc.Running() {
+		return fail(processID, "exited unexpectedly")
+	}
+
+	t.dependencyManager.UpdateProcessStatus(chain.ID, i, "ready", processID)
+	span.SetStatus(tracing.StatusOK, "ready")
+	return processID, true
+}
+
+// GetProcessChainStatus gets the current status of a process chain. Pending steps list the
+// dependencies they are still waiting on in blocked_on.
 func (t *TerminalTools) GetProcessChainStatus(ctx context.Context, req *mcp.CallToolRequest, args GetProcessChainStatusArgs) (*mcp.CallToolResult, *ProcessChain, error) {
-	chain, exists := t.dependencyManager.GetChain(args.ChainID)
+	chain, exists := t.dependencyManager.ChainSnapshot(args.ChainID)
 	if !exists {
 		return createErrorResult(fmt.Sprintf("Chain not found: %s", args.ChainID)), nil, nil
 	}
 
-	return createJSONResult(chain), chain, nil
+	deps, _ := chainDependencies(chain.Processes)
+	for i := range chain.Processes {
+		if chain.Processes[i].Status != "pending" {
+			continue
+		}
+		for _, j := range deps[i] {
+			if chain.Processes[j].Status != "ready" {
+				chain.Processes[i].BlockedOn = append(chain.Processes[i].BlockedOn, chain.Processes[j].Name)
+			}
+		}
+	}
+
+	return createJSONResult(chain), &chain, nil
+}
+
+// StopProcessChain stops a chain: no more of its steps start, and the processes its steps started
+// are terminated gracefully, dependents before the steps they depend on
+func (t *TerminalTools) StopProcessChain(ctx context.Context, req *mcp.CallToolRequest, args StopProcessChainArgs) (*mcp.CallToolResult, StopProcessChainResult, error) {
+	stopped, err := t.dependencyManager.StopChain(args.ChainID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to stop chain: %v", err)), StopProcessChainResult{}, nil
+	}
+
+	result := StopProcessChainResult{
+		ChainID:        stopped.ChainID,
+		Name:           stopped.Name,
+		PreviousStatus: stopped.PreviousStatus,
+		Status:         "stopped",
+		Terminated:     []ChainStepProcess{},
+		AlreadyExited:  []ChainStepProcess{},
+		Failed:         []ChainStepProcess{},
+		NotStarted:     stopped.NotStarted,
+	}
+	for _, step := range stopped.Started {
+		bgProc, err := t.manager.GetBackgroundProcess(stopped.SessionID, step.ProcessID)
+		if err != nil || !bgProc.Running() {
+			result.AlreadyExited = append(result.AlreadyExited, step)
+			continue
+		}
+		if err := t.manager.TerminateBackgroundProcess(stopped.SessionID, step.ProcessID, false); err != nil {
+			step.Error = err.Error()
+			result.Failed = append(result.Failed, step)
+			continue
+		}
+		t.dependencyManager.UpdateProcessStatus(stopped.ChainID, step.Index, "stopped", "")
+		result.Terminated = append(result.Terminated, step)
+	}
+
+	result.Message = fmt.Sprintf("Stopped process chain '%s': %d process(es) terminated, %d already exited, %d failed to stop, %d step(s) not started",
+		stopped.Name, len(result.Terminated), len(result.AlreadyExited), len(result.Failed), len(result.NotStarted))
+
+	t.logger.Info("Process chain stopped", map[string]interface{}{
+		"chain_id":        stopped.ChainID,
+		"session_id":      stopped.SessionID,
+		"previous_status": stopped.PreviousStatus,
+		"terminated":      len(result.Terminated),
+		"failed":          len(result.Failed),
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// CancelSessionProcessChains cancels every process chain in a session and stops the processes they started
+func (t *TerminalTools) CancelSessionProcessChains(ctx context.Context, req *mcp.CallToolRequest, args CancelSessionProcessChainsArgs) (*mcp.CallToolResult, CancelSessionProcessChainsResult, error) {
+	// H2: Check rate limit
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), CancelSessionProcessChainsResult{}, nil
+	}
+
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), CancelSessionProcessChainsResult{}, nil
+	}
+
+	cancelled := t.dependencyManager.CancelSessionChains(args.SessionID)
+
+	result := CancelSessionProcessChainsResult{
+		SessionID:       args.SessionID,
+		ChainsCancelled: len(cancelled),
+		Chains:          cancelled,
+	}
+
+	for _, chain := range cancelled {
+		for _, processID := range chain.ProcessIDs {
+			bgProc, err := t.manager.GetBackgroundProcess(args.SessionID, processID)
+			if err != nil || !bgProc.Running() {
+				continue // Already exited or cleaned up
+			}
+			if err := t.manager.TerminateBackgroundProcess(args.SessionID, processID, args.Force); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", chain.ChainID, processID, err))
+				continue
+			}
+			result.ProcessesStopped++
+		}
+	}
+
+	result.Message = fmt.Sprintf("Cancelled %d process chain(s) and stopped %d process(es)", result.ChainsCancelled, result.ProcessesStopped)
+
+	t.logger.Info("Session process chains cancelled", map[string]interface{}{
+		"session_id":        args.SessionID,
+		"chains_cancelled":  result.ChainsCancelled,
+		"processes_stopped": result.ProcessesStopped,
+	})
+
+	return createJSONResult(result), result, nil
 }
@@ -0,0 +1,266 @@
+// Package tools provides MCP tool handlers for debugging the server's internal state
+package tools
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/monitoring"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+// --- Manager Diagnostics Types ---
+
+// GetManagerDiagnosticsArgs represents arguments for getting manager diagnostics (none required)
+type GetManagerDiagnosticsArgs struct{}
+
+// ManagerDiagnosticsResult is a one-stop debug view of the server's internal state
+type ManagerDiagnosticsResult struct {
+	Manager         terminal.ManagerDiagnostics `json:"manager"`
+	ResourceMonitor *monitoring.ResourceMetrics `json:"resource_monitor,omitempty"` // Latest recorded sample
+	RateLimiters    []RateLimitCategoryStatus   `json:"rate_limiters"`              // Global, session and project limiters
+	Message         string                      `json:"message"`
+}
+
+// --- Resource Pressure Simulation Types ---
+
+// Upper bounds for simulated resource pressure, so a mistyped argument cannot take the server down
+const (
+	maxSimulatedGoroutines = 10000
+	maxSimulatedMemoryMB   = 1024
+	maxSimulatedSessions   = 20
+	maxSimulatedProcesses  = 20
+	maxSimulatedHold       = 60 * time.Second
+)
+
+// SimulateResourcePressureArgs represents arguments for simulating resource pressure
+type SimulateResourcePressureArgs struct {
+	Confirm             bool `json:"confirm" jsonschema:"required,description=Must be true; the simulation deliberately consumes server resources"`
+	Goroutines          int  `json:"goroutines,omitempty" jsonschema:"description=Number of idle goroutines to start (max 10000)"`
+	MemoryMB            int  `json:"memory_mb,omitempty" jsonschema:"description=Megabytes of memory to allocate and hold (max 1024)"`
+	Sessions            int  `json:"sessions,omitempty" jsonschema:"description=Number of dummy sessions to create (max 20)"`
+	BackgroundProcesses int  `json:"background_processes,omitempty" jsonschema:"description=Number of idle background processes to start across the dummy sessions (max 20)"`
+	HoldSeconds         int  `json:"hold_seconds,omitempty" jsonschema:"description=How long to hold the pressure before releasing it (max 60)"`
+	RunCleanup          bool `json:"run_cleanup,omitempty" jsonschema:"description=Run one pass of the cleanup routines while the pressure is applied"`
+}
+
+// SimulatedPressure records how much pressure was actually applied
+type SimulatedPressure struct {
+	Goroutines          int `json:"goroutines"`
+	MemoryMB            int `json:"memory_mb"`
+	Sessions            int `json:"sessions"`
+	BackgroundProcesses int `json:"background_processes"`
+}
+
+// SimulateResourcePressureResult reports resource usage before, during and after the simulation
+type SimulateResourcePressureResult struct {
+	Applied       SimulatedPressure      `json:"applied"`
+	Before        map[string]interface{} `json:"before"`
+	During        map[string]interface{} `json:"during"`
+	After         map[string]interface{} `json:"after"`
+	LeaksDetected []string               `json:"leaks_detected"` // Leak checks that fired while the pressure was applied
+	CleanupRan    bool                   `json:"cleanup_ran"`
+	Actions       []string               `json:"actions"`
+	Message       string                 `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// GetManagerDiagnostics returns internal counters for debugging; only available in debug mode
+func (t *TerminalTools) GetManagerDiagnostics(ctx context.Context, req *mcp.CallToolRequest, args GetManagerDiagnosticsArgs) (*mcp.CallToolResult, ManagerDiagnosticsResult, error) {
+	if !t.config.Server.Debug {
+		return createErrorResult("Manager diagnostics are only available in debug mode. Start the server with --debug or TERMINAL_MCP_DEBUG=true."), ManagerDiagnosticsResult{}, nil
+	}
+
+	result := ManagerDiagnosticsResult{
+		Manager:      t.manager.Diagnostics(),
+		RateLimiters: t.rateLimitCategories(),
+	}
+	if resourceMonitor := t.manager.GetResourceMonitor(); resourceMonitor != nil {
+		metrics := resourceMonitor.GetCurrentMetrics()
+		result.ResourceMonitor = &metrics
+	}
+
+	result.Message = fmt.Sprintf("%d session(s), %d background process(es) (%d running), %d goroutine(s)",
+		result.Manager.Sessions, result.Manager.BackgroundProcesses, result.Manager.RunningBackgroundProcesses, result.Manager.Goroutines)
+
+	return createJSONResult(result), result, nil
+}
+
+// SimulateResourcePressure temporarily starts idle goroutines, allocates memory and creates dummy
+// sessions and background processes so operators can watch the leak detection and cleanup paths
+// react, then releases everything. Only available in debug mode and with confirm set.
+func (t *TerminalTools) SimulateResourcePressure(ctx context.Context, req *mcp.CallToolRequest, args SimulateResourcePressureArgs) (*mcp.CallToolResult, SimulateResourcePressureResult, error) {
+	if !t.config.Server.Debug {
+		return createErrorResult("Resource pressure simulation is only available in debug mode. Start the server with --debug or TERMINAL_MCP_DEBUG=true."), SimulateResourcePressureResult{}, nil
+	}
+	if !args.Confirm {
+		return createErrorResult("Resource pressure simulation requires confirmation (set confirm: true)"), SimulateResourcePressureResult{}, nil
+	}
+
+	if args.Goroutines < 0 || args.MemoryMB < 0 || args.Sessions < 0 || args.BackgroundProcesses < 0 || args.HoldSeconds < 0 {
+		return createErrorResult("Simulation amounts cannot be negative"), SimulateResourcePressureResult{}, nil
+	}
+	if args.Goroutines > maxSimulatedGoroutines {
+		return createErrorResult(fmt.Sprintf("goroutines cannot exceed %d", maxSimulatedGoroutines)), SimulateResourcePressureResult{}, nil
+	}
+	if args.MemoryMB > maxSimulatedMemoryMB {
+		return createErrorResult(fmt.Sprintf("memory_mb cannot exceed %d", maxSimulatedMemoryMB)), SimulateResourcePressureResult{}, nil
+	}
+	if args.Sessions > maxSimulatedSessions {
+		return createErrorResult(fmt.Sprintf("sessions cannot exceed %d", maxSimulatedSessions)), SimulateResourcePressureResult{}, nil
+	}
+	if args.BackgroundProcesses > maxSimulatedProcesses {
+		return createErrorResult(fmt.Sprintf("background_processes cannot exceed %d", maxSimulatedProcesses)), SimulateResourcePressureResult{}, nil
+	}
+	hold := time.Duration(args.HoldSeconds) * time.Second
+	if hold > maxSimulatedHold {
+		return createErrorResult(fmt.Sprintf("hold_seconds cannot exceed %d", int(maxSimulatedHold.Seconds()))), SimulateResourcePressureResult{}, nil
+	}
+
+	resourceMonitor := t.manager.GetResourceMonitor()
+	if resourceMonitor == nil {
+		return createErrorResult("Resource monitor not available"), SimulateResourcePressureResult{}, nil
+	}
+
+	result := SimulateResourcePressureResult{
+		Before:        resourceMonitor.Sample(),
+		LeaksDetected: []string{},
+		Actions:       []string{},
+	}
+
+	// Idle goroutines park on release until the simulation ends
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < args.Goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-release
+		}()
+	}
+	result.Applied.Goroutines = args.Goroutines
+
+	// Touch every page so the allocation is really resident, not just reserved
+	memory := make([][]byte, 0, args.MemoryMB)
+	for i := 0; i < args.MemoryMB; i++ {
+		chunk := make([]byte, 1024*1024)
+		for j := range chunk {
+			chunk[j] = byte(j)
+		}
+		memory = append(memory, chunk)
+	}
+	result.Applied.MemoryMB = len(memory)
+
+	// Background processes need a session, so create one when only processes were requested
+	sessionCount := args.Sessions
+	if sessionCount == 0 && args.BackgroundProcesses > 0 {
+		sessionCount = 1
+	}
+	var sessionIDs []string
+	for i := 0; i < sessionCount; i++ {
+		session, err := t.manager.CreateSession(fmt.Sprintf("resource-pressure-%d", i+1), "", "")
+		if err != nil {
+			result.Actions = append(result.Actions, fmt.Sprintf("Stopped creating dummy sessions: %v", err))
+			break
+		}
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+	result.Applied.Sessions = len(sessionIDs)
+
+	if len(sessionIDs) > 0 {
+		idle := idleCommand(hold + time.Minute)
+		for i := 0; i < args.BackgroundProcesses; i++ {
+			if _, err := t.manager.ExecuteCommandInBackground(sessionIDs[i%len(sessionIDs)], idle); err != nil {
+				result.Actions = append(result.Actions, fmt.Sprintf("Stopped starting background processes: %v", err))
+				break
+			}
+			result.Applied.BackgroundProcesses++
+		}
+	}
+
+	result.Actions = append(result.Actions, fmt.Sprintf("Applied %d goroutine(s), %d MB, %d session(s), %d background process(es)",
+		result.Applied.Goroutines, result.Applied.MemoryMB, result.Applied.Sessions, result.Applied.BackgroundProcesses))
+
+	if hold > 0 {
+		select {
+		case <-time.After(hold):
+		case <-ctx.Done():
+			result.Actions = append(result.Actions, "Hold interrupted by cancellation")
+		}
+	}
+
+	result.During = resourceMonitor.Sample()
+	if leak, ok := result.During["potential_goroutine_leak"].(bool); ok && leak {
+		result.LeaksDetected = append(result.LeaksDetected, "goroutine")
+	}
+	if leak, ok := result.During["potential_memory_leak"].(bool); ok && leak {
+		result.LeaksDetected = append(result.LeaksDetected, "memory")
+	}
+
+	if args.RunCleanup {
+		result.CleanupRan = t.manager.RunCleanupNow()
+		if result.CleanupRan {
+			result.Actions = append(result.Actions, "Ran one pass of the cleanup routines")
+		} else {
+			result.Actions = append(result.Actions, "Skipped the cleanup pass because cleanup is paused")
+		}
+	}
+
+	// Release everything, including sessions the cleanup pass may already have removed
+	close(release)
+	wg.Wait()
+	runtime.KeepAlive(memory) // The allocation becomes collectable from here on
+
+	removed := 0
+	for _, sessionID := range sessionIDs {
+		if !t.manager.SessionExists(sessionID) {
+			continue
+		}
+		// Kill the idle commands' process groups first; closing the session only kills the shell,
+		// and waiting on it blocks while its orphaned child still holds the output pipes
+		if err := t.manager.TerminateAllBackgroundProcesses(sessionID, true, 0); err != nil {
+			t.logger.Warn("Failed to stop dummy background processes", map[string]interface{}{
+				"session_id": sessionID,
+				"error":      err.Error(),
+			})
+		}
+		if err := t.manager.DeleteSession(sessionID); err != nil {
+			t.logger.Error("Failed to delete dummy session", err, map[string]interface{}{
+				"session_id": sessionID,
+			})
+			continue
+		}
+		removed++
+	}
+	result.Actions = append(result.Actions, fmt.Sprintf("Released goroutines and memory, deleted %d dummy session(s)", removed))
+
+	resourceMonitor.ForceGC()
+	result.After = resourceMonitor.Sample()
+
+	result.Message = fmt.Sprintf("Resource pressure simulation completed; %d leak check(s) fired while pressure was applied", len(result.LeaksDetected))
+
+	t.logger.Info("Resource pressure simulation completed", map[string]interface{}{
+		"goroutines":           result.Applied.Goroutines,
+		"memory_mb":            result.Applied.MemoryMB,
+		"sessions":             result.Applied.Sessions,
+		"background_processes": result.Applied.BackgroundProcesses,
+		"leaks_detected":       result.LeaksDetected,
+		"cleanup_ran":          result.CleanupRan,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// idleCommand returns a shell command that does nothing for roughly d
+func idleCommand(d time.Duration) string {
+	seconds := int(d.Seconds())
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf("ping -n %d 127.0.0.1 >NUL", seconds+1)
+	}
+	return fmt.Sprintf("sleep %d", seconds)
+}
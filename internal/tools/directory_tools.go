@@ -0,0 +1,104 @@
+// Package tools provides MCP tool handlers for working directory validation
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// --- Working Directory Validation Types ---
+
+// ValidateWorkingDirectoryArgs represents arguments for validating a candidate working directory
+type ValidateWorkingDirectoryArgs struct {
+	Path string `json:"path" jsonschema:"required,description=Directory path to validate before creating a session"`
+}
+
+// ValidateWorkingDirectoryResult represents the verdict for a candidate working directory
+type ValidateWorkingDirectoryResult struct {
+	Path            string   `json:"path"`          // Path as provided
+	ResolvedPath    string   `json:"resolved_path"` // Absolute, cleaned path
+	Valid           bool     `json:"valid"`         // True if a session can be created here
+	Exists          bool     `json:"exists"`
+	IsDirectory     bool     `json:"is_directory"`
+	Readable        bool     `json:"readable"`
+	WithinAllowlist bool     `json:"within_allowlist"`
+	ProjectType     string   `json:"project_type,omitempty"`
+	PackageManager  string   `json:"package_manager,omitempty"`
+	Issues          []string `json:"issues,omitempty"`
+	Message         string   `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// ValidateWorkingDirectory checks whether a path is usable as a session working directory
+func (t *TerminalTools) ValidateWorkingDirectory(ctx context.Context, req *mcp.CallToolRequest, args ValidateWorkingDirectoryArgs) (*mcp.CallToolResult, ValidateWorkingDirectoryResult, error) {
+	if args.Path == "" {
+		return createErrorResult("path is required"), ValidateWorkingDirectoryResult{}, nil
+	}
+
+	resolved, err := filepath.Abs(args.Path)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid path: %v", err)), ValidateWorkingDirectoryResult{}, nil
+	}
+
+	result := ValidateWorkingDirectoryResult{
+		Path:            args.Path,
+		ResolvedPath:    resolved,
+		WithinAllowlist: t.config.Security.IsWorkingDirAllowed(resolved),
+		Issues:          []string{},
+	}
+
+	if !result.WithinAllowlist {
+		result.Issues = append(result.Issues, "path is not within the configured allowed working directories")
+	}
+
+	info, err := os.Stat(resolved)
+	switch {
+	case os.IsNotExist(err):
+		result.Issues = append(result.Issues, "directory does not exist (create_terminal_session would create it)")
+	case err != nil:
+		result.Issues = append(result.Issues, fmt.Sprintf("cannot stat path: %v", err))
+	default:
+		result.Exists = true
+		result.IsDirectory = info.IsDir()
+		if !result.IsDirectory {
+			result.Issues = append(result.Issues, "path exists but is not a directory")
+		}
+	}
+
+	if result.IsDirectory {
+		if dir, err := os.Open(resolved); err == nil {
+			_, readErr := dir.Readdirnames(1)
+			dir.Close()
+			result.Readable = readErr == nil || readErr == io.EOF
+		}
+		if !result.Readable {
+			result.Issues = append(result.Issues, "directory is not readable")
+		}
+
+		result.ProjectType = t.packageManager.DetectProjectType(resolved)
+		if pm, err := t.packageManager.DetectPackageManager(resolved); err == nil && pm != nil {
+			result.PackageManager = pm.Name
+		}
+	}
+
+	result.Valid = result.Exists && result.IsDirectory && result.Readable && result.WithinAllowlist
+	if result.Valid {
+		result.Message = fmt.Sprintf("%s is a valid working directory", resolved)
+	} else {
+		result.Message = fmt.Sprintf("%s is not a valid working directory: %d issue(s) found", resolved, len(result.Issues))
+	}
+
+	t.logger.Debug("Working directory validated", map[string]interface{}{
+		"path":   resolved,
+		"valid":  result.Valid,
+		"issues": len(result.Issues),
+	})
+
+	return createJSONResult(result), result, nil
+}
@@ -0,0 +1,185 @@
+// Package tools provides MCP tool handlers for diagnosing a session's environment
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/utils"
+)
+
+// --- Environment Diagnostic Types ---
+
+// DiagnoseEnvironmentArgs represents arguments for diagnosing a session's environment
+type DiagnoseEnvironmentArgs struct {
+	SessionID string   `json:"session_id" jsonschema:"required,description=The session whose environment to diagnose"`
+	Tools     []string `json:"tools,omitempty" jsonschema:"description=Optional: Extra executables to look for besides the common ones (max 20)"`
+}
+
+// ToolAvailability reports whether an executable is on the session's PATH
+type ToolAvailability struct {
+	Name  string `json:"name"`
+	Found bool   `json:"found"`
+	Path  string `json:"path,omitempty"`
+}
+
+// PathEntry is one directory of the session's PATH
+type PathEntry struct {
+	Dir    string `json:"dir"`
+	Exists bool   `json:"exists"`
+}
+
+// DiagnoseEnvironmentResult is a snapshot of a session's environment for troubleshooting
+// "command not found" errors
+type DiagnoseEnvironmentResult struct {
+	SessionID      string             `json:"session_id"`
+	WorkingDir     string             `json:"working_dir"`
+	ProjectType    string             `json:"project_type"`
+	PackageManager string             `json:"package_manager,omitempty"`
+	Shell          string             `json:"shell"`
+	PathEntries    []PathEntry        `json:"path_entries"`
+	Tools          []ToolAvailability `json:"tools"`
+	Missing        []string           `json:"missing"`
+	Variables      map[string]string  `json:"variables,omitempty"` // Toolchain variables that are set; secrets are redacted
+	Issues         []string           `json:"issues"`
+	Message        string             `json:"message"`
+}
+
+// diagnosticTools are looked for in every diagnosis
+var diagnosticTools = []string{"git", "node", "npm", "python3", "python", "go", "make", "docker"}
+
+// projectToolchains lists, per detected project type, executables of which at least one is needed
+var projectToolchains = map[string][]string{
+	"nodejs": {"node"},
+	"python": {"python3", "python"},
+	"go":     {"go"},
+	"rust":   {"cargo"},
+	"java":   {"java"},
+	"ruby":   {"ruby"},
+	"php":    {"php"},
+}
+
+// diagnosticVariables are toolchain variables reported when set in the session
+var diagnosticVariables = []string{"SHELL", "HOME", "GOPATH", "GOROOT", "NODE_PATH", "VIRTUAL_ENV", "JAVA_HOME"}
+
+// executableNamePattern matches bare executable names; paths are not looked up
+var executableNamePattern = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+
+// --- MCP Tool Handlers ---
+
+// DiagnoseEnvironment reports a session's PATH, shell, which common tools its PATH provides and
+// the working directory's project type. Executables are looked up in the session's own PATH, so
+// the report matches what commands run in the session will find.
+func (t *TerminalTools) DiagnoseEnvironment(ctx context.Context, req *mcp.CallToolRequest, args DiagnoseEnvironmentArgs) (*mcp.CallToolResult, DiagnoseEnvironmentResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), DiagnoseEnvironmentResult{}, nil
+	}
+	if len(args.Tools) > MaxDiagnosticTools {
+		return createErrorResult(fmt.Sprintf("Too many tools: %d (max %d)", len(args.Tools), MaxDiagnosticTools)), DiagnoseEnvironmentResult{}, nil
+	}
+	for _, name := range args.Tools {
+		if !executableNamePattern.MatchString(name) {
+			return createErrorResult(fmt.Sprintf("Invalid tool name %q: give a bare executable name such as 'cargo'", name)), DiagnoseEnvironmentResult{}, nil
+		}
+	}
+
+	session, err := t.manager.GetSession(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v. Use 'list_terminal_sessions' to see all available sessions.", err)), DiagnoseEnvironmentResult{}, nil
+	}
+
+	env := session.GetAllEnvironment()
+	workingDir := session.GetCurrentDir()
+	result := DiagnoseEnvironmentResult{
+		SessionID:   args.SessionID,
+		WorkingDir:  workingDir,
+		ProjectType: t.packageManager.DetectProjectType(workingDir),
+		Shell:       session.ShellPath(),
+		PathEntries: []PathEntry{},
+		Tools:       []ToolAvailability{},
+		Missing:     []string{},
+		Variables:   make(map[string]string),
+		Issues:      []string{},
+	}
+	if pm, err := t.packageManager.DetectPackageManager(workingDir); err == nil && pm != nil {
+		result.PackageManager = pm.Name
+	}
+	if result.Shell == "" {
+		result.Issues = append(result.Issues, "session has no shell process")
+	}
+
+	// PATH entries, flagging directories that do not exist and duplicates
+	pathList, hasPath := env["PATH"]
+	if !hasPath || pathList == "" {
+		result.Issues = append(result.Issues, "PATH is not set in the session")
+	}
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			continue
+		}
+		info, statErr := os.Stat(dir)
+		entry := PathEntry{Dir: dir, Exists: statErr == nil && info.IsDir()}
+		result.PathEntries = append(result.PathEntries, entry)
+		if !entry.Exists {
+			result.Issues = append(result.Issues, fmt.Sprintf("PATH entry %s does not exist", dir))
+		}
+		if seen[dir] {
+			result.Issues = append(result.Issues, fmt.Sprintf("PATH entry %s is listed more than once", dir))
+		}
+		seen[dir] = true
+	}
+
+	// Common tools, the project's toolchain and any requested extras, each looked up once
+	names := append([]string{}, diagnosticTools...)
+	names = append(names, projectToolchains[result.ProjectType]...)
+	names = append(names, args.Tools...)
+	found := make(map[string]bool)
+	checked := make(map[string]bool)
+	for _, name := range names {
+		if checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		availability := ToolAvailability{Name: name}
+		if path, err := utils.LookPathIn(name, pathList); err == nil {
+			availability.Found = true
+			availability.Path = path
+			found[name] = true
+		} else {
+			result.Missing = append(result.Missing, name)
+		}
+		result.Tools = append(result.Tools, availability)
+	}
+
+	if toolchain := projectToolchains[result.ProjectType]; len(toolchain) > 0 {
+		available := false
+		for _, name := range toolchain {
+			available = available || found[name]
+		}
+		if !available {
+			result.Issues = append(result.Issues, fmt.Sprintf("%s project but %s not found on the session's PATH",
+				result.ProjectType, strings.Join(toolchain, " or ")))
+		}
+	}
+
+	// Values that look like secrets are redacted, as in other environment results
+	for _, key := range diagnosticVariables {
+		if value, ok := env[key]; ok {
+			result.Variables[key] = redactEnvValue(key, value)
+		}
+	}
+
+	sort.Strings(result.Missing)
+	result.Message = fmt.Sprintf("%d of %d tools found on PATH (%d entries); %d issue(s)",
+		len(result.Tools)-len(result.Missing), len(result.Tools), len(result.PathEntries), len(result.Issues))
+
+	return createJSONResult(result), result, nil
+}
@@ -2,10 +2,18 @@
 package tools
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/logger"
 )
 
 // --- Environment Variable Types ---
@@ -28,6 +36,40 @@ type UnsetEnvironmentArgs struct {
 	Keys      []string `json:"keys" jsonschema:"description=List of environment variable keys to remove"`
 }
 
+// SetProjectEnvironmentArgs represents arguments for setting environment variables across a project
+type SetProjectEnvironmentArgs struct {
+	ProjectID string            `json:"project_id" jsonschema:"description=The project whose sessions should receive the variables"`
+	Variables map[string]string `json:"variables" jsonschema:"description=Map of environment variable names to values"`
+}
+
+// ProjectEnvironmentResult represents the result of a project-wide environment update
+type ProjectEnvironmentResult struct {
+	Success         bool              `json:"success"`
+	ProjectID       string            `json:"project_id"`
+	SessionsUpdated int               `json:"sessions_updated"`
+	SessionIDs      []string          `json:"session_ids,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	Message         string            `json:"message,omitempty"`
+}
+
+// AppendEnvironmentFromFileArgs represents arguments for importing a dotenv file into a session
+type AppendEnvironmentFromFileArgs struct {
+	SessionID string `json:"session_id" jsonschema:"description=The session ID to set environment variables for"`
+	Path      string `json:"path" jsonschema:"description=Path to a dotenv file, relative to the session's current directory"`
+}
+
+// EnvironmentFileResult represents the result of importing a dotenv file. Only the keys are
+// reported since .env files commonly hold secrets.
+type EnvironmentFileResult struct {
+	Success   bool     `json:"success"`
+	SessionID string   `json:"session_id"`
+	Path      string   `json:"path,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"` // Malformed lines that were skipped
+	Count     int      `json:"count"`
+	Message   string   `json:"message,omitempty"`
+}
+
 // EnvironmentResult represents the result of environment operations
 type EnvironmentResult struct {
 	Success   bool              `json:"success"`
@@ -38,19 +80,242 @@ type EnvironmentResult struct {
 	Count     int               `json:"count,omitempty"`
 }
 
+// checkEnvironmentVariables rejects empty variable names and logs attempts to set potentially
+// dangerous variables; scopeKey and scopeID identify the session or project in the log
+func (t *TerminalTools) checkEnvironmentVariables(variables map[string]string, scopeKey, scopeID string) error {
+	dangerousVars := []string{"PATH", "LD_PRELOAD", "LD_LIBRARY_PATH", "DYLD_LIBRARY_PATH", "DYLD_INSERT_LIBRARIES"}
+
+	for key := range variables {
+		if key == "" {
+			return fmt.Errorf("empty variable name is not allowed")
+		}
+
+		// Check for potentially dangerous variables
+		for _, dangerous := range dangerousVars {
+			if key == dangerous {
+				t.logger.Warn("Attempt to set potentially dangerous environment variable", map[string]interface{}{
+					scopeKey:   scopeID,
+					"variable": key,
+				})
+				// Allow but log - user may have valid reasons
+			}
+		}
+	}
+	return nil
+}
+
+// environmentDiff lists the keys by which an environment differs from a base, each sorted
+type environmentDiff struct {
+	added   []string // Only in the environment
+	removed []string // Only in the base
+	changed []string // In both with different values
+}
+
+// diffEnvironment compares current against base
+func diffEnvironment(base, current map[string]string) environmentDiff {
+	var diff environmentDiff
+	for key, value := range current {
+		baseValue, exists := base[key]
+		switch {
+		case !exists:
+			diff.added = append(diff.added, key)
+		case baseValue != value:
+			diff.changed = append(diff.changed, key)
+		}
+	}
+	for key := range base {
+		if _, exists := current[key]; !exists {
+			diff.removed = append(diff.removed, key)
+		}
+	}
+	sort.Strings(diff.added)
+	sort.Strings(diff.removed)
+	sort.Strings(diff.changed)
+	return diff
+}
+
+// redactedEnvValue replaces environment values that look like secrets in tool results
+const redactedEnvValue = "[REDACTED]"
+
+// redactEnvValue hides the whole value when the variable's name or value looks like a credential
+// to the log redaction rules
+func redactEnvValue(key, value string) string {
+	assignment := key + "=" + value
+	if logger.RedactSecrets(assignment) != assignment {
+		return redactedEnvValue
+	}
+	return value
+}
+
+// envKeyPattern matches the variable names a POSIX shell accepts
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseDotEnv parses dotenv-format KEY=VALUE lines. Blank lines, # comments and `export` prefixes
+// are ignored; double-quoted values support \n, \t, \r, \" and \\ escapes while single-quoted values
+// are literal. Malformed lines are skipped and reported as warnings. keys lists each variable
+// once, in the order first seen; later assignments win.
+func parseDotEnv(r io.Reader) (variables map[string]string, keys []string, warnings []string, err error) {
+	variables = make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxEnvFileSize)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		key, rawValue, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("line %d: missing '='", lineNumber))
+			continue
+		}
+		if !envKeyPattern.MatchString(key) {
+			warnings = append(warnings, fmt.Sprintf("line %d: invalid variable name %q", lineNumber, key))
+			continue
+		}
+
+		value, valueErr := parseDotEnvValue(strings.TrimSpace(rawValue))
+		if valueErr != nil {
+			warnings = append(warnings, fmt.Sprintf("line %d: %v", lineNumber, valueErr))
+			continue
+		}
+
+		if _, exists := variables[key]; !exists {
+			keys = append(keys, key)
+		}
+		variables[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	return variables, keys, warnings, nil
+}
+
+// parseDotEnvValue unquotes a dotenv value and strips any trailing comment
+func parseDotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	quote := raw[0]
+	if quote != '"' && quote != '\'' {
+		// Unquoted: a # starts a comment only after whitespace, so URLs with fragments survive
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+				raw = raw[:i]
+				break
+			}
+		}
+		return strings.TrimSpace(raw), nil
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		if c == quote {
+			rest := strings.TrimSpace(raw[i+1:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected text after closing quote")
+			}
+			return value.String(), nil
+		}
+		if c == '\\' && quote == '"' && i+1 < len(raw) {
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			case '"', '\\':
+				value.WriteByte(raw[i])
+			default:
+				value.WriteByte('\\')
+				value.WriteByte(raw[i])
+			}
+			continue
+		}
+		value.WriteByte(c)
+	}
+	return "", fmt.Errorf("unterminated quoted value")
+}
+
+// resolveEnvFilePath resolves path against the session's current directory and rejects files
+// outside it. Absolute paths are only accepted when allow_absolute_env_files is set, and must
+// then be inside the allowed working directories.
+func (t *TerminalTools) resolveEnvFilePath(currentDir, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		if !t.config.Security.AllowAbsoluteEnvFiles {
+			return "", fmt.Errorf("absolute paths are not allowed; use a path relative to the session directory or enable allow_absolute_env_files")
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot access env file: %w", err)
+		}
+		if !t.config.Security.IsWorkingDirAllowed(filepath.Dir(resolved)) {
+			return "", fmt.Errorf("env file %s is outside the allowed working directories", resolved)
+		}
+		return resolved, nil
+	}
+
+	// Resolve symlinks on both sides so a link inside the directory cannot point outside it
+	base, err := filepath.EvalSymlinks(currentDir)
+	if err != nil {
+		return "", fmt.Errorf("cannot access session directory: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(base, path))
+	if err != nil {
+		return "", fmt.Errorf("cannot access env file: %w", err)
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("env file %s resolves outside the session directory", path)
+	}
+	return resolved, nil
+}
+
+// readEnvFile opens a dotenv file, refusing directories and files over MaxEnvFileSize
+func readEnvFile(path string) (variables map[string]string, keys []string, warnings []string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if info.Size() > MaxEnvFileSize {
+		return nil, nil, nil, fmt.Errorf("env file is %d bytes, larger than the %d byte limit", info.Size(), MaxEnvFileSize)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+	return parseDotEnv(file)
+}
+
 // --- MCP Tool Handlers ---
 
 // SetSessionEnvironment sets or updates environment variables for a session
 func (t *TerminalTools) SetSessionEnvironment(ctx context.Context, req *mcp.CallToolRequest, args SetEnvironmentArgs) (*mcp.CallToolResult, EnvironmentResult, error) {
 	// Rate limit check
-	if !t.rateLimiter.Allow() {
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
 		result := EnvironmentResult{
 			Success:   false,
 			SessionID: args.SessionID,
 			Operation: "set",
-			Message:   "rate limit exceeded, please try again later",
+			Message:   err.Error(),
 		}
-		return createErrorResult("rate limit exceeded"), result, nil
+		return createErrorResult(err.Error()), result, nil
 	}
 
 	// Validate input
@@ -74,28 +339,14 @@ func (t *TerminalTools) SetSessionEnvironment(ctx context.Context, req *mcp.Call
 	}
 
 	// Validate variable names (security check)
-	for key := range args.Variables {
-		if key == "" {
-			result := EnvironmentResult{
-				Success:   false,
-				SessionID: args.SessionID,
-				Operation: "set",
-				Message:   "empty variable name is not allowed",
-			}
-			return createErrorResult("empty variable name is not allowed"), result, nil
-		}
-
-		// Check for potentially dangerous variables
-		dangerousVars := []string{"PATH", "LD_PRELOAD", "LD_LIBRARY_PATH", "DYLD_LIBRARY_PATH", "DYLD_INSERT_LIBRARIES"}
-		for _, dangerous := range dangerousVars {
-			if key == dangerous {
-				t.logger.Warn("Attempt to set potentially dangerous environment variable", map[string]interface{}{
-					"session_id": args.SessionID,
-					"variable":   key,
-				})
-				// Allow but log - user may have valid reasons
-			}
+	if err := t.checkEnvironmentVariables(args.Variables, "session_id", args.SessionID); err != nil {
+		result := EnvironmentResult{
+			Success:   false,
+			SessionID: args.SessionID,
+			Operation: "set",
+			Message:   err.Error(),
 		}
+		return createErrorResult(err.Error()), result, nil
 	}
 
 	// Set environment variables
@@ -187,14 +438,14 @@ func (t *TerminalTools) GetSessionEnvironment(ctx context.Context, req *mcp.Call
 // UnsetSessionEnvironment removes environment variables from a session
 func (t *TerminalTools) UnsetSessionEnvironment(ctx context.Context, req *mcp.CallToolRequest, args UnsetEnvironmentArgs) (*mcp.CallToolResult, EnvironmentResult, error) {
 	// Rate limit check
-	if !t.rateLimiter.Allow() {
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
 		result := EnvironmentResult{
 			Success:   false,
 			SessionID: args.SessionID,
 			Operation: "unset",
-			Message:   "rate limit exceeded, please try again later",
+			Message:   err.Error(),
 		}
-		return createErrorResult("rate limit exceeded"), result, nil
+		return createErrorResult(err.Error()), result, nil
 	}
 
 	// Validate input
@@ -247,3 +498,135 @@ func (t *TerminalTools) UnsetSessionEnvironment(ctx context.Context, req *mcp.Ca
 
 	return createJSONResult(result), result, nil
 }
+
+// SetProjectSessionsEnvironment sets or updates environment variables for every session in a project
+func (t *TerminalTools) SetProjectSessionsEnvironment(ctx context.Context, req *mcp.CallToolRequest, args SetProjectEnvironmentArgs) (*mcp.CallToolResult, ProjectEnvironmentResult, error) {
+	// Rate limit check
+	if err := t.CheckProjectRateLimit(args.ProjectID); err != nil {
+		result := ProjectEnvironmentResult{
+			Success:   false,
+			ProjectID: args.ProjectID,
+			Message:   err.Error(),
+		}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	// Validate input
+	if args.ProjectID == "" {
+		result := ProjectEnvironmentResult{
+			Success: false,
+			Message: "project_id is required",
+		}
+		return createErrorResult("project_id is required"), result, nil
+	}
+
+	if len(args.Variables) == 0 {
+		result := ProjectEnvironmentResult{
+			Success:   false,
+			ProjectID: args.ProjectID,
+			Message:   "at least one variable is required",
+		}
+		return createErrorResult("at least one variable is required"), result, nil
+	}
+
+	if err := t.checkEnvironmentVariables(args.Variables, "project_id", args.ProjectID); err != nil {
+		result := ProjectEnvironmentResult{
+			Success:   false,
+			ProjectID: args.ProjectID,
+			Message:   err.Error(),
+		}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	updated := t.manager.SetProjectSessionsEnvironment(args.ProjectID, args.Variables)
+	if len(updated) == 0 {
+		result := ProjectEnvironmentResult{
+			Success:   false,
+			ProjectID: args.ProjectID,
+			Message:   fmt.Sprintf("no sessions found for project '%s'", args.ProjectID),
+		}
+		return createErrorResult(result.Message), result, nil
+	}
+
+	result := ProjectEnvironmentResult{
+		Success:         true,
+		ProjectID:       args.ProjectID,
+		SessionsUpdated: len(updated),
+		SessionIDs:      updated,
+		Variables:       args.Variables,
+		Message:         fmt.Sprintf("Successfully set %d environment variable(s) in %d session(s)", len(args.Variables), len(updated)),
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// AppendSessionEnvironmentFromFile imports variables from a dotenv file into a session. Malformed
+// lines are skipped with a warning instead of failing the whole import.
+func (t *TerminalTools) AppendSessionEnvironmentFromFile(ctx context.Context, req *mcp.CallToolRequest, args AppendEnvironmentFromFileArgs) (*mcp.CallToolResult, EnvironmentFileResult, error) {
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), EnvironmentFileResult{SessionID: args.SessionID, Message: err.Error()}, nil
+	}
+
+	if args.SessionID == "" {
+		return createErrorResult("session_id is required"), EnvironmentFileResult{Message: "session_id is required"}, nil
+	}
+	if args.Path == "" {
+		return createErrorResult("path is required"), EnvironmentFileResult{SessionID: args.SessionID, Message: "path is required"}, nil
+	}
+
+	session, err := t.manager.GetSession(args.SessionID)
+	if err != nil {
+		return createErrorResult(err.Error()), EnvironmentFileResult{SessionID: args.SessionID, Message: err.Error()}, nil
+	}
+
+	path, err := t.resolveEnvFilePath(session.GetCurrentDir(), args.Path)
+	if err != nil {
+		t.logger.Warn("Rejected env file import", map[string]interface{}{
+			"session_id": args.SessionID,
+			"path":       args.Path,
+			"error":      err.Error(),
+		})
+		return createErrorResult(err.Error()), EnvironmentFileResult{SessionID: args.SessionID, Path: args.Path, Message: err.Error()}, nil
+	}
+
+	variables, keys, warnings, err := readEnvFile(path)
+	if err != nil {
+		message := fmt.Sprintf("failed to read env file: %v", err)
+		return createErrorResult(message), EnvironmentFileResult{SessionID: args.SessionID, Path: path, Message: message}, nil
+	}
+
+	if err := t.checkEnvironmentVariables(variables, "session_id", args.SessionID); err != nil {
+		return createErrorResult(err.Error()), EnvironmentFileResult{SessionID: args.SessionID, Path: path, Message: err.Error()}, nil
+	}
+	if len(warnings) > 0 {
+		t.logger.Warn("Skipped malformed env file lines", map[string]interface{}{
+			"session_id": args.SessionID,
+			"path":       path,
+			"warnings":   warnings,
+		})
+	}
+
+	session.SetEnvironmentBatch(variables)
+
+	result := EnvironmentFileResult{
+		Success:   true,
+		SessionID: args.SessionID,
+		Path:      path,
+		Keys:      keys,
+		Warnings:  warnings,
+		Count:     len(keys),
+		Message:   fmt.Sprintf("Set %d environment variable(s) from %s", len(keys), path),
+	}
+	if len(warnings) > 0 {
+		result.Message += fmt.Sprintf(" (%d malformed line(s) skipped)", len(warnings))
+	}
+
+	t.logger.Info("Environment variables imported from file", map[string]interface{}{
+		"session_id": args.SessionID,
+		"path":       path,
+		"count":      len(keys),
+		"skipped":    len(warnings),
+	})
+
+	return createJSONResult(result), result, nil
+}
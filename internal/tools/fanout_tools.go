@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// RunCommandInSessionsArgs represents arguments for running one command across several sessions
+type RunCommandInSessionsArgs struct {
+	SessionIDs  []string `json:"session_ids,omitempty" jsonschema:"description=Sessions to run the command in"`
+	ProjectID   string   `json:"project_id,omitempty" jsonschema:"description=Run the command in every session of this project instead of listing session_ids"`
+	Command     string   `json:"command" jsonschema:"required,description=The command to run in each session"`
+	Timeout     int      `json:"timeout,omitempty" jsonschema:"description=Per-session timeout in seconds (default 60, max 300)"`
+	Concurrency int      `json:"concurrency,omitempty" jsonschema:"description=Sessions to run in at once (default 1 = sequential, capped by max_fan_out_concurrency)"`
+	StopOnError bool     `json:"stop_on_error,omitempty" jsonschema:"description=Skip the remaining sessions after the first failure (sequential runs only)"`
+}
+
+// SessionCommandOutcome reports the result of the fan-out command in a single session
+type SessionCommandOutcome struct {
+	SessionID string            `json:"session_id"`
+	Status    string            `json:"status"` // succeeded, failed, or skipped
+	Error     string            `json:"error,omitempty"`
+	Result    *RunCommandResult `json:"result,omitempty"`
+}
+
+// RunCommandInSessionsResult represents the aggregate result of a fan-out command
+type RunCommandInSessionsResult struct {
+	Command     string                  `json:"command"`
+	ProjectID   string                  `json:"project_id,omitempty"`
+	Total       int                     `json:"total"`
+	Succeeded   int                     `json:"succeeded"`
+	Failed      int                     `json:"failed"`
+	Skipped     int                     `json:"skipped"`
+	Concurrency int                     `json:"concurrency"`
+	Duration    string                  `json:"duration"`
+	Results     []SessionCommandOutcome `json:"results"`
+	Message     string                  `json:"message"`
+}
+
+// RunCommandInSessions runs a command in several sessions through RunCommand, so each run gets the usual validation and history
+func (t *TerminalTools) RunCommandInSessions(ctx context.Context, req *mcp.CallToolRequest, args RunCommandInSessionsArgs) (*mcp.CallToolResult, RunCommandInSessionsResult, error) {
+	if strings.TrimSpace(args.Command) == "" {
+		return createErrorResult("command is required"), RunCommandInSessionsResult{}, nil
+	}
+	if (len(args.SessionIDs) == 0) == (args.ProjectID == "") {
+		return createErrorResult("Provide either session_ids or project_id"), RunCommandInSessionsResult{}, nil
+	}
+
+	sessionIDs := args.SessionIDs
+	if args.ProjectID != "" {
+		for _, session := range t.manager.ListSessionsByProject(args.ProjectID) {
+			sessionIDs = append(sessionIDs, session.ID)
+		}
+		if len(sessionIDs) == 0 {
+			return createErrorResult(fmt.Sprintf("No sessions found for project '%s'", args.ProjectID)), RunCommandInSessionsResult{}, nil
+		}
+	}
+
+	// Run once per session even if it is listed twice
+	seen := make(map[string]bool, len(sessionIDs))
+	unique := sessionIDs[:0:0]
+	for _, id := range sessionIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sessionIDs = unique
+
+	concurrency := args.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > t.config.Session.MaxFanOutConcurrency {
+		concurrency = t.config.Session.MaxFanOutConcurrency
+	}
+	if concurrency > len(sessionIDs) {
+		concurrency = len(sessionIDs)
+	}
+
+	startTime := time.Now()
+	outcomes := make([]SessionCommandOutcome, len(sessionIDs))
+
+	if concurrency == 1 {
+		failed := false
+		for i, id := range sessionIDs {
+			if failed && args.StopOnError {
+				outcomes[i] = SessionCommandOutcome{SessionID: id, Status: "skipped", Error: "skipped after an earlier failure"}
+				continue
+			}
+			outcomes[i] = t.runFanOutCommand(ctx, req, id, args)
+			failed = failed || outcomes[i].Status == "failed"
+		}
+	} else {
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, id := range sessionIDs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, id string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				outcomes[i] = t.runFanOutCommand(ctx, req, id, args)
+			}(i, id)
+		}
+		wg.Wait()
+	}
+
+	result := RunCommandInSessionsResult{
+		Command:     args.Command,
+		ProjectID:   args.ProjectID,
+		Total:       len(sessionIDs),
+		Concurrency: concurrency,
+		Duration:    time.Since(startTime).String(),
+		Results:     outcomes,
+	}
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case "succeeded":
+			result.Succeeded++
+		case "failed":
+			result.Failed++
+		default:
+			result.Skipped++
+		}
+	}
+	result.Message = fmt.Sprintf("Command ran in %d session(s): %d succeeded, %d failed, %d skipped",
+		result.Total, result.Succeeded, result.Failed, result.Skipped)
+
+	t.logger.Info("Fan-out command executed", map[string]interface{}{
+		"command":     args.Command,
+		"project_id":  args.ProjectID,
+		"sessions":    result.Total,
+		"succeeded":   result.Succeeded,
+		"failed":      result.Failed,
+		"skipped":     result.Skipped,
+		"concurrency": concurrency,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// runFanOutCommand runs the fan-out command in one session and classifies the outcome
+func (t *TerminalTools) runFanOutCommand(ctx context.Context, req *mcp.CallToolRequest, sessionID string, args RunCommandInSessionsArgs) SessionCommandOutcome {
+	callResult, runResult, _ := t.RunCommand(ctx, req, RunCommandArgs{
+		SessionID: sessionID,
+		Command:   args.Command,
+		Timeout:   args.Timeout,
+	})
+
+	outcome := SessionCommandOutcome{SessionID: sessionID}
+	outcome.Status, outcome.Error, outcome.Result = classifyRunCommand(callResult, runResult)
+	return outcome
+}
+
+// classifyRunCommand turns a RunCommand call into a succeeded or failed status, the error to
+// report, and the run result when the command actually ran
+func classifyRunCommand(callResult *mcp.CallToolResult, runResult RunCommandResult) (string, string, *RunCommandResult) {
+	if callResult != nil && callResult.IsError {
+		// Rejected before running: rate limit, validation, security or unknown session
+		errorText := ""
+		if len(callResult.Content) > 0 {
+			if text, ok := callResult.Content[0].(*mcp.TextContent); ok {
+				errorText = text.Text
+			}
+		}
+		return "failed", errorText, nil
+	}
+
+	if runResult.Success {
+		return "succeeded", "", &runResult
+	}
+	return "failed", runResult.ErrorOutput, &runResult
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // Helper functions for validation and result creation
@@ -46,6 +47,51 @@ func validateSessionID(sessionID string) error {
 	return nil
 }
 
+// validateCommandText rejects commands that would only spawn a shell that does nothing: empty or
+// whitespace-only commands and, unless allowCommentOnly is set, commands made only of # comments
+func validateCommandText(command string, allowCommentOnly bool) error {
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("command cannot be empty or whitespace-only")
+	}
+	if !allowCommentOnly && terminal.IsCommentOnlyCommand(command) {
+		return fmt.Errorf("command contains only comments and would not run anything")
+	}
+	return nil
+}
+
+// validateCommandTags checks the explicit history tags given for a command
+func validateCommandTags(tags []string) error {
+	if len(tags) > MaxCommandTags {
+		return fmt.Errorf("at most %d tags are allowed, got %d", MaxCommandTags, len(tags))
+	}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return fmt.Errorf("tags cannot be empty")
+		}
+		if len(tag) > MaxCommandTagLength {
+			return fmt.Errorf("tag %q exceeds %d characters", tag, MaxCommandTagLength)
+		}
+	}
+	return nil
+}
+
+// validateEnvOverrides validates per-command environment variable names
+func validateEnvOverrides(env map[string]string) error {
+	for key, value := range env {
+		if key == "" {
+			return fmt.Errorf("empty environment variable name is not allowed")
+		}
+		if strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name: %q", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("environment variable %s contains a NUL byte", key)
+		}
+	}
+	return nil
+}
+
 // createJSONResult creates a JSON result for tool responses
 func createJSONResult(data interface{}) *mcp.CallToolResult {
 	resultJSON, _ := json.MarshalIndent(data, "", "  ")
@@ -115,7 +161,7 @@ func getSearchInstructions() SearchInstructions {
 			{
 				Description: "Search for Docker commands in a specific project",
 				Query: SearchHistoryArgs{
-					Command:   "docker",
+					Tags:      []string{"docker"},
 					ProjectID: "my_project_a7b3c9",
 					Limit:     20,
 				},
@@ -131,15 +177,21 @@ func getSearchInstructions() SearchInstructions {
 		},
 		Tips: []string{
 			"Use partial text matching for both commands and output",
+			"Use command_regex or output_regex for Go regular expressions; regex_matches gives the matched offsets for highlighting",
+			"Use tags to find commands labelled at run time or auto-tagged by tool (git, npm, docker, go, ...); all given tags must match",
 			"Combine multiple filters to narrow down results",
 			"Use time filters to focus on recent activity",
 			"Set include_output=true when searching by output content",
+			"Leave include_output off and pass a result's id to get_command_output to fetch just the output you need",
+			"Pass fields (e.g. command and success) to scan large result sets with only the fields you need",
+			"Page through large result sets with offset while has_more is true; total_count gives the number of matches",
 			"Use project_id to focus on specific projects",
 			"Sort by duration to find long-running commands",
 		},
 		Limits: SearchLimits{
 			MaxResults:     1000,
 			DefaultResults: 100,
+			MaxOffset:      maxHistoryOffset,
 			TimeFormat:     time.RFC3339,
 		},
 	}
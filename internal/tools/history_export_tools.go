@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// History export formats (export_session_history's format argument)
+const (
+	HistoryExportJSON     = "json"
+	HistoryExportCSV      = "csv"
+	HistoryExportMarkdown = "markdown"
+)
+
+// historyExportExtensions maps each export format to its file extension
+var historyExportExtensions = map[string]string{
+	HistoryExportJSON:     ".json",
+	HistoryExportCSV:      ".csv",
+	HistoryExportMarkdown: ".md",
+}
+
+// ExportSessionHistoryArgs represents arguments for exporting a session's command history to a file
+type ExportSessionHistoryArgs struct {
+	SessionID     string `json:"session_id" jsonschema:"required,description=Session whose command history is exported"`
+	Format        string `json:"format,omitempty" jsonschema:"description=File format: json (default) csv or markdown"`
+	IncludeOutput bool   `json:"include_output,omitempty" jsonschema:"description=Add output and error_output columns"`
+	Limit         int    `json:"limit,omitempty" jsonschema:"description=Export at most this many of the most recent commands (default: 1000 max: 1000)"`
+	Path          string `json:"path,omitempty" jsonschema:"description=File to write; defaults to exports/<session_id>/ under the data directory"`
+}
+
+// ExportSessionHistoryResult represents a command history export written to a file
+type ExportSessionHistoryResult struct {
+	SessionID string `json:"session_id"`
+	Format    string `json:"format"`
+	Path      string `json:"path"`
+	RowCount  int    `json:"row_count"`
+	Bytes     int    `json:"bytes"`
+	Message   string `json:"message"`
+}
+
+// historyExportRow is one command in an export, oldest first
+type historyExportRow struct {
+	Command     string `json:"command"`
+	Success     bool   `json:"success"`
+	ExitCode    int    `json:"exit_code"`
+	DurationMs  int64  `json:"duration_ms"`
+	Timestamp   string `json:"timestamp"`
+	WorkingDir  string `json:"working_dir"`
+	Output      string `json:"output,omitempty"`
+	ErrorOutput string `json:"error_output,omitempty"`
+}
+
+// ExportSessionHistory writes a session's recorded commands, oldest first, to a JSON, CSV or
+// Markdown file for reporting and sharing
+func (t *TerminalTools) ExportSessionHistory(ctx context.Context, req *mcp.CallToolRequest, args ExportSessionHistoryArgs) (*mcp.CallToolResult, ExportSessionHistoryResult, error) {
+	if t.database == nil {
+		return createErrorResult("Command history is not available: database is not configured"), ExportSessionHistoryResult{}, nil
+	}
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), ExportSessionHistoryResult{}, nil
+	}
+
+	format := strings.ToLower(strings.TrimSpace(args.Format))
+	if format == "" {
+		format = HistoryExportJSON
+	}
+	extension, ok := historyExportExtensions[format]
+	if !ok {
+		return createErrorResult(fmt.Sprintf("Invalid format: %q. Use 'json', 'csv' or 'markdown'", args.Format)), ExportSessionHistoryResult{}, nil
+	}
+
+	limit := args.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	// Newest first, so the limit keeps the most recent commands
+	records, err := t.database.SearchCommands(args.SessionID, "", "", "", nil, time.Time{}, time.Time{}, nil, limit)
+	if err != nil {
+		t.logger.Error("Failed to read command history for export", err, map[string]interface{}{
+			"session_id": args.SessionID,
+		})
+		return createErrorResult(fmt.Sprintf("Failed to read command history: %v", err)), ExportSessionHistoryResult{}, nil
+	}
+
+	rows := make([]historyExportRow, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		rows = append(rows, newHistoryExportRow(records[i], args.IncludeOutput))
+	}
+
+	var content []byte
+	switch format {
+	case HistoryExportJSON:
+		content, err = json.MarshalIndent(rows, "", "  ")
+	case HistoryExportCSV:
+		content, err = historyCSV(rows, args.IncludeOutput)
+	case HistoryExportMarkdown:
+		content = historyMarkdown(rows, args.IncludeOutput)
+	}
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to render %s export: %v", format, err)), ExportSessionHistoryResult{}, nil
+	}
+
+	path := args.Path
+	if path == "" {
+		exportDir := filepath.Join(t.config.Database.DataDir, "exports", args.SessionID)
+		if err := os.MkdirAll(exportDir, 0o755); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to create export directory: %v", err)), ExportSessionHistoryResult{}, nil
+		}
+		path = filepath.Join(exportDir, "history-"+time.Now().Format("20060102-150405")+extension)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to write export file: %v", err)), ExportSessionHistoryResult{}, nil
+	}
+
+	result := ExportSessionHistoryResult{
+		SessionID: args.SessionID,
+		Format:    format,
+		Path:      path,
+		RowCount:  len(rows),
+		Bytes:     len(content),
+		Message:   fmt.Sprintf("Exported %d command(s) as %s to %s", len(rows), format, path),
+	}
+
+	t.logger.Info("Command history exported", map[string]interface{}{
+		"session_id": args.SessionID,
+		"format":     format,
+		"path":       path,
+		"count":      len(rows),
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// newHistoryExportRow converts a command record into an export row
+func newHistoryExportRow(record *database.CommandRecord, includeOutput bool) historyExportRow {
+	row := historyExportRow{
+		Command:    record.Command,
+		Success:    record.Success,
+		ExitCode:   record.ExitCode,
+		DurationMs: record.Duration,
+		Timestamp:  record.Timestamp.Format(time.RFC3339),
+		WorkingDir: record.WorkingDir,
+	}
+	if includeOutput {
+		row.Output = record.Output
+		row.ErrorOutput = record.ErrorOutput
+	}
+	return row
+}
+
+// historyExportColumns returns the column names of a CSV or Markdown export
+func historyExportColumns(includeOutput bool) []string {
+	columns := []string{"command", "success", "exit_code", "duration_ms", "timestamp", "working_dir"}
+	if includeOutput {
+		columns = append(columns, "output", "error_output")
+	}
+	return columns
+}
+
+// fields returns the row's values in historyExportColumns order
+func (row historyExportRow) fields(includeOutput bool) []string {
+	fields := []string{
+		row.Command,
+		strconv.FormatBool(row.Success),
+		strconv.Itoa(row.ExitCode),
+		strconv.FormatInt(row.DurationMs, 10),
+		row.Timestamp,
+		row.WorkingDir,
+	}
+	if includeOutput {
+		fields = append(fields, row.Output, row.ErrorOutput)
+	}
+	return fields
+}
+
+// historyCSV renders rows as CSV with a header; encoding/csv quotes fields holding commas, quotes
+// or newlines
+func historyCSV(rows []historyExportRow, includeOutput bool) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(historyExportColumns(includeOutput)); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.fields(includeOutput)); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// markdownCellReplacer keeps a value inside its table cell: pipes would end the cell and newlines
+// the row
+var markdownCellReplacer = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// historyMarkdown renders rows as a Markdown table
+func historyMarkdown(rows []historyExportRow, includeOutput bool) []byte {
+	columns := historyExportColumns(includeOutput)
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		fields := row.fields(includeOutput)
+		for i, field := range fields {
+			fields[i] = markdownCellReplacer.Replace(field)
+		}
+		b.WriteString("| " + strings.Join(fields, " | ") + " |\n")
+	}
+	return []byte(b.String())
+}
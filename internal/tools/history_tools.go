@@ -2,12 +2,209 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
+const (
+	// followHistoryDefaultWait is the default time FollowHistory blocks waiting for new commands
+	followHistoryDefaultWait = 10
+	// followHistoryMaxWait bounds how long a single FollowHistory call may block
+	followHistoryMaxWait = 30
+	// followHistoryPollInterval is how often the database is polled while waiting
+	followHistoryPollInterval = 500 * time.Millisecond
+	// maxHistoryOffset bounds how deep SearchHistory pages; SQLite still reads every skipped row
+	maxHistoryOffset = 10000
+)
+
+// Named timestamp formats accepted by the history tools' time_format argument; any other value
+// is used as a Go time layout
+const (
+	timeFormatRFC3339 = "rfc3339"
+	timeFormatUnix    = "unix"
+	timeFormatUnixMs  = "unix_ms"
+)
+
+// FollowHistoryArgs represents arguments for following command history
+type FollowHistoryArgs struct {
+	SessionID   string `json:"session_id,omitempty" jsonschema:"description,Only follow commands from this session. Leave empty to follow all sessions."`
+	ProjectID   string `json:"project_id,omitempty" jsonschema:"description,Only follow commands from this project. Leave empty to follow all projects."`
+	Since       int64  `json:"since,omitempty" jsonschema:"description,Cursor returned as next_cursor by a previous call. Omit or 0 to start from the latest recorded command."`
+	WaitSeconds int    `json:"wait_seconds,omitempty" jsonschema:"description,Maximum seconds to block waiting for new commands (default: 10 max: 30)."`
+	Limit       int    `json:"limit,omitempty" jsonschema:"description,Maximum number of commands to return (default: 100 max: 1000)."`
+	TimeFormat  string `json:"time_format,omitempty" jsonschema:"description,Timestamp format: rfc3339 (default) unix unix_ms or a Go time layout."`
+}
+
+// FollowHistoryResult represents the result of following command history
+type FollowHistoryResult struct {
+	Commands   []*database.CommandResult `json:"commands"`
+	Count      int                       `json:"count"`
+	NextCursor int64                     `json:"next_cursor"`
+	TimedOut   bool                      `json:"timed_out"`
+	Waited     string                    `json:"waited"`
+}
+
+// GetCommandByIDArgs represents arguments for fetching one command record from history
+type GetCommandByIDArgs struct {
+	CommandID  string `json:"command_id" jsonschema:"required,description=ID of the command as returned in run_command's command_id or the id field of search_terminal_history results"`
+	TimeFormat string `json:"time_format,omitempty" jsonschema:"description=Timestamp format: rfc3339 (default) unix unix_ms or a Go time layout."`
+}
+
+// GetCommandByIDResult represents a complete command record with its full output
+type GetCommandByIDResult struct {
+	Command    *database.CommandResult `json:"command"`
+	WorkingDir string                  `json:"working_dir"`
+	Duration   string                  `json:"duration"` // Human-readable form of command.duration_ms
+	Message    string                  `json:"message"`
+}
+
+// GetCommandStreamArgs represents arguments for replaying a command's recorded output stream
+type GetCommandStreamArgs struct {
+	CommandID     string `json:"command_id" jsonschema:"required,description=ID of the command as returned in run_command's command_id or get_active_command_output"`
+	AfterSequence int    `json:"after_sequence,omitempty" jsonschema:"description=Only return chunks after this sequence number; pass the previous call's last_sequence to page through a long stream"`
+}
+
+// GetCommandStreamResult represents a command's output stream chunks in the order they were produced
+type GetCommandStreamResult struct {
+	CommandID    string                  `json:"command_id"`
+	Chunks       []*database.StreamChunk `json:"chunks"`
+	Count        int                     `json:"count"`
+	LastSequence int                     `json:"last_sequence"`       // Sequence number of the last chunk returned, or after_sequence if none
+	Complete     bool                    `json:"complete"`            // The final status chunk has been recorded
+	ExitCode     *int                    `json:"exit_code,omitempty"` // From the status chunk, once complete
+	Message      string                  `json:"message"`
+}
+
+// GetSessionRecentCommandsArgs represents arguments for reading a session's in-memory recent commands
+type GetSessionRecentCommandsArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=Session whose recent commands to return"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"description=Maximum number of commands to return, newest first (default: all buffered)"`
+}
+
+// GetSessionRecentCommandsResult represents a session's in-memory recent commands
+type GetSessionRecentCommandsResult struct {
+	SessionID string                   `json:"session_id"`
+	Commands  []terminal.RecentCommand `json:"commands"`
+	Count     int                      `json:"count"`
+	Capacity  int                      `json:"capacity"`  // Configured maximum number of buffered commands
+	MaxBytes  int                      `json:"max_bytes"` // Configured byte budget, 0 if unlimited
+	Message   string                   `json:"message"`
+}
+
+// ExportHistoryAsScriptArgs represents arguments for exporting command history as a shell script
+type ExportHistoryAsScriptArgs struct {
+	SessionID         string `json:"session_id,omitempty" jsonschema:"description=Only export commands from this session"`
+	ProjectID         string `json:"project_id,omitempty" jsonschema:"description=Only export commands from this project"`
+	SuccessfulOnly    bool   `json:"successful_only,omitempty" jsonschema:"description=Leave out commands that failed. Otherwise failed commands are kept with their failure ignored so the script runs past them."`
+	IncludeTimestamps bool   `json:"include_timestamps,omitempty" jsonschema:"description=Precede each command with a comment giving when it ran"`
+	Limit             int    `json:"limit,omitempty" jsonschema:"description=Export at most this many of the most recent matching commands (default: 1000 max: 1000)"`
+	Path              string `json:"path,omitempty" jsonschema:"description=File to write the script to, made executable (omit to return it inline only)"`
+}
+
+// ExportHistoryAsScriptResult represents command history rendered as a runnable shell script
+type ExportHistoryAsScriptResult struct {
+	Script        string `json:"script"`
+	CommandCount  int    `json:"command_count"`  // Commands in the script
+	FailedSkipped int    `json:"failed_skipped"` // Failed commands left out by successful_only
+	Path          string `json:"path,omitempty"` // File the script was written to
+	Message       string `json:"message"`
+}
+
+// timestampFormatter returns a function formatting timestamps as requested by a time_format
+// argument: "rfc3339" (the default), "unix", "unix_ms", or a Go layout such as "2006-01-02 15:04"
+func timestampFormatter(format string) (func(time.Time) string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", timeFormatRFC3339:
+		return func(ts time.Time) string { return ts.Format(time.RFC3339) }, nil
+	case timeFormatUnix:
+		return func(ts time.Time) string { return strconv.FormatInt(ts.Unix(), 10) }, nil
+	case timeFormatUnixMs:
+		return func(ts time.Time) string { return strconv.FormatInt(ts.UnixMilli(), 10) }, nil
+	}
+
+	// A layout without any reference-time element formats to itself
+	if time.Now().Format(format) == format {
+		return nil, fmt.Errorf("invalid time_format %q: use rfc3339, unix, unix_ms or a Go layout such as 2006-01-02 15:04:05", format)
+	}
+	return func(ts time.Time) string { return ts.Format(format) }, nil
+}
+
+// searchHistoryFields are the command fields search_terminal_history's fields argument can select,
+// named as in the full results
+var searchHistoryFields = []string{
+	"id", "session_id", "project_id", "command", "output", "error_output", "success",
+	"exit_code", "duration_ms", "working_dir", "timestamp", "tags", "regex_matches",
+}
+
+// validateHistoryFields rejects unknown field names and output fields requested without
+// include_output, and returns the fields without duplicates
+func validateHistoryFields(fields []string, includeOutput bool) ([]string, error) {
+	known := make(map[string]bool, len(searchHistoryFields))
+	for _, field := range searchHistoryFields {
+		known[field] = true
+	}
+
+	selected := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field %q; valid fields: %s", field, strings.Join(searchHistoryFields, ", "))
+		}
+		if (field == "output" || field == "error_output") && !includeOutput {
+			return nil, fmt.Errorf("field %q requires include_output=true", field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			selected = append(selected, field)
+		}
+	}
+	return selected, nil
+}
+
+// selectHistoryFields reduces each command to the given fields
+func selectHistoryFields(commands []*database.CommandResult, fields []string) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, len(commands))
+	for i, cmd := range commands {
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]interface{}
+		if err := json.Unmarshal(data, &full); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := full[field]; ok {
+				row[field] = value
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// formatCommandResults converts command records for a response, formatting timestamps with formatTime
+func formatCommandResults(records []*database.CommandRecord, formatTime func(time.Time) string) []*database.CommandResult {
+	results := make([]*database.CommandResult, len(records))
+	for i, record := range records {
+		results[i] = record.ToCommandResult()
+		results[i].Timestamp = formatTime(record.Timestamp)
+	}
+	return results
+}
+
 // SearchHistory searches through command history across all sessions and projects
 func (t *TerminalTools) SearchHistory(ctx context.Context, req *mcp.CallToolRequest, args SearchHistoryArgs) (*mcp.CallToolResult, SearchHistoryResult, error) {
 	startTime := time.Now()
@@ -30,6 +227,18 @@ func (t *TerminalTools) SearchHistory(ctx context.Context, req *mcp.CallToolRequ
 		}
 	}
 
+	formatTime, err := timestampFormatter(args.TimeFormat)
+	if err != nil {
+		return createErrorResult(err.Error()), SearchHistoryResult{}, nil
+	}
+
+	var fields []string
+	if len(args.Fields) > 0 {
+		if fields, err = validateHistoryFields(args.Fields, args.IncludeOutput); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid fields: %v", err)), SearchHistoryResult{}, nil
+		}
+	}
+
 	// Apply default limits
 	limit := args.Limit
 	if limit <= 0 {
@@ -39,22 +248,92 @@ func (t *TerminalTools) SearchHistory(ctx context.Context, req *mcp.CallToolRequ
 		limit = 1000
 	}
 
-	// Execute database search
-	commands, err := t.database.SearchCommandsFormatted(
-		args.SessionID,
-		args.ProjectID,
-		args.Command,
-		args.Output,
-		args.Success,
-		startTimeFilter,
-		endTimeFilter,
-		limit,
-	)
-	if err != nil {
-		t.logger.Error("Failed to search command history", err, map[string]interface{}{
-			"query": args,
-		})
-		return createErrorResult(fmt.Sprintf("Search failed: %v", err)), SearchHistoryResult{}, nil
+	if args.Offset < 0 || args.Offset > maxHistoryOffset {
+		return createErrorResult(fmt.Sprintf("Invalid offset %d: must be between 0 and %d; narrow the search with filters to reach older commands", args.Offset, maxHistoryOffset)), SearchHistoryResult{}, nil
+	}
+	isRegex := args.CommandRegex != "" || args.OutputRegex != ""
+	if isRegex && args.Offset > 0 {
+		return createErrorResult("offset is not supported with command_regex or output_regex; narrow the search with start_time or end_time instead"), SearchHistoryResult{}, nil
+	}
+
+	// Execute database search; regex patterns are matched in Go after the SQL filters
+	var commands []*database.CommandResult
+	var regexStats *database.RegexSearchStats
+	totalCount := -1
+	if isRegex {
+		matches, stats, err := t.database.SearchCommandsRegex(
+			args.SessionID,
+			args.ProjectID,
+			args.Command,
+			args.Output,
+			args.Success,
+			startTimeFilter,
+			endTimeFilter,
+			args.Tags,
+			args.CommandRegex,
+			args.OutputRegex,
+			limit,
+		)
+		var regexErr *database.InvalidRegexError
+		if errors.As(err, &regexErr) {
+			return createErrorResult(fmt.Sprintf("Invalid search: %v", regexErr)), SearchHistoryResult{}, nil
+		}
+		if err != nil {
+			t.logger.Error("Failed to search command history", err, map[string]interface{}{
+				"query": args,
+			})
+			return createErrorResult(fmt.Sprintf("Search failed: %v", err)), SearchHistoryResult{}, nil
+		}
+
+		records := make([]*database.CommandRecord, len(matches))
+		for i, match := range matches {
+			records[i] = match.CommandRecord
+		}
+		commands = formatCommandResults(records, formatTime)
+		for i, match := range matches {
+			commands[i].RegexMatches = match.Matches
+		}
+		regexStats = &stats
+	} else {
+		records, err := t.database.SearchCommandsPage(
+			args.SessionID,
+			args.ProjectID,
+			args.Command,
+			args.Output,
+			args.Success,
+			startTimeFilter,
+			endTimeFilter,
+			args.Tags,
+			limit,
+			args.Offset,
+		)
+		if err == nil {
+			totalCount, err = t.database.CountCommands(
+				args.SessionID,
+				args.ProjectID,
+				args.Command,
+				args.Output,
+				args.Success,
+				startTimeFilter,
+				endTimeFilter,
+				args.Tags,
+			)
+		}
+		if err != nil {
+			t.logger.Error("Failed to search command history", err, map[string]interface{}{
+				"query": args,
+			})
+			return createErrorResult(fmt.Sprintf("Search failed: %v", err)), SearchHistoryResult{}, nil
+		}
+		commands = formatCommandResults(records, formatTime)
+	}
+
+	// Output is left out unless asked for; get_command_output fetches a single command's output
+	if !args.IncludeOutput {
+		for _, cmd := range commands {
+			cmd.Output = ""
+			cmd.ErrorOutput = ""
+		}
 	}
 
 	// Calculate stats
@@ -72,7 +351,26 @@ func (t *TerminalTools) SearchHistory(ctx context.Context, req *mcp.CallToolRequ
 		SearchTime:   time.Since(startTime).String(),
 		ProjectStats: projectStats,
 		SessionStats: sessionStats,
+		RegexStats:   regexStats,
 		Instructions: getSearchInstructions(),
+		Offset:       args.Offset,
+	}
+	if totalCount >= 0 {
+		result.TotalCount = &totalCount
+		result.HasMore = args.Offset+len(commands) < totalCount
+	} else if regexStats != nil {
+		// A full page may have more matches behind it; a short page scanned everything it could
+		result.HasMore = len(commands) >= limit
+	}
+
+	// Selected fields replace the full records to keep large scans small
+	if len(fields) > 0 {
+		rows, err := selectHistoryFields(commands, fields)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to select fields: %v", err)), SearchHistoryResult{}, nil
+		}
+		result.Rows = rows
+		result.Results = []*database.CommandResult{}
 	}
 
 	t.logger.Info("Command history search completed", map[string]interface{}{
@@ -84,3 +382,321 @@ func (t *TerminalTools) SearchHistory(ctx context.Context, req *mcp.CallToolRequ
 
 	return createJSONResult(result), result, nil
 }
+
+// FollowHistory returns commands recorded after the given cursor, blocking briefly until new
+// commands arrive, the wait time elapses, or the client disconnects (long-poll).
+func (t *TerminalTools) FollowHistory(ctx context.Context, req *mcp.CallToolRequest, args FollowHistoryArgs) (*mcp.CallToolResult, FollowHistoryResult, error) {
+	if t.database == nil {
+		return createErrorResult("Command history is not available: database is not configured"), FollowHistoryResult{}, nil
+	}
+
+	formatTime, err := timestampFormatter(args.TimeFormat)
+	if err != nil {
+		return createErrorResult(err.Error()), FollowHistoryResult{}, nil
+	}
+
+	waitSeconds := args.WaitSeconds
+	if waitSeconds <= 0 {
+		waitSeconds = followHistoryDefaultWait
+	}
+	if waitSeconds > followHistoryMaxWait {
+		waitSeconds = followHistoryMaxWait
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	cursor := args.Since
+	if cursor <= 0 {
+		latest, err := t.database.GetLatestCommandCursor()
+		if err != nil {
+			t.logger.Error("Failed to get latest command cursor", err, nil)
+			return createErrorResult(fmt.Sprintf("Failed to follow history: %v", err)), FollowHistoryResult{}, nil
+		}
+		cursor = latest
+	}
+
+	startTime := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(waitSeconds)*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(followHistoryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		records, nextCursor, err := t.database.GetCommandsAfter(cursor, args.SessionID, args.ProjectID, limit)
+		if err != nil {
+			t.logger.Error("Failed to follow command history", err, map[string]interface{}{
+				"since": cursor,
+			})
+			return createErrorResult(fmt.Sprintf("Failed to follow history: %v", err)), FollowHistoryResult{}, nil
+		}
+
+		if len(records) > 0 {
+			commands := formatCommandResults(records, formatTime)
+
+			result := FollowHistoryResult{
+				Commands:   commands,
+				Count:      len(commands),
+				NextCursor: nextCursor,
+				Waited:     time.Since(startTime).String(),
+			}
+			return createJSONResult(result), result, nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			// Either the wait elapsed or the client went away; the deferred cancel and
+			// ticker stop release everything held by this call.
+			if ctx.Err() != nil {
+				t.logger.Debug("Follow history request cancelled by client", map[string]interface{}{
+					"since": cursor,
+				})
+			}
+			result := FollowHistoryResult{
+				Commands:   []*database.CommandResult{},
+				NextCursor: cursor,
+				TimedOut:   true,
+				Waited:     time.Since(startTime).String(),
+			}
+			return createJSONResult(result), result, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetCommandByID returns one command from history with its complete, untruncated output, so a
+// search can leave output out and the one needed can be fetched afterwards
+func (t *TerminalTools) GetCommandByID(ctx context.Context, req *mcp.CallToolRequest, args GetCommandByIDArgs) (*mcp.CallToolResult, GetCommandByIDResult, error) {
+	if t.database == nil {
+		return createErrorResult("Command history is not available: database is not configured"), GetCommandByIDResult{}, nil
+	}
+
+	commandID := strings.TrimSpace(args.CommandID)
+	if commandID == "" {
+		return createErrorResult("command_id is required. Tip: Use search_terminal_history to find command IDs."), GetCommandByIDResult{}, nil
+	}
+
+	formatTime, err := timestampFormatter(args.TimeFormat)
+	if err != nil {
+		return createErrorResult(err.Error()), GetCommandByIDResult{}, nil
+	}
+
+	record, err := t.database.GetCommand(commandID)
+	if errors.Is(err, database.ErrCommandNotFound) {
+		return createErrorResult(fmt.Sprintf("No command with ID %s in history. Tip: Command IDs are run_command's command_id or the id field of search_terminal_history results; old commands may have been removed by history cleanup.", commandID)), GetCommandByIDResult{}, nil
+	}
+	if err != nil {
+		t.logger.Error("Failed to get command from history", err, map[string]interface{}{
+			"command_id": commandID,
+		})
+		return createErrorResult(fmt.Sprintf("Failed to get command: %v", err)), GetCommandByIDResult{}, nil
+	}
+
+	duration := time.Duration(record.Duration) * time.Millisecond
+	result := GetCommandByIDResult{
+		Command:    formatCommandResults([]*database.CommandRecord{record}, formatTime)[0],
+		WorkingDir: record.WorkingDir,
+		Duration:   duration.String(),
+		Message: fmt.Sprintf("Command %s ran in %s for %s and exited with code %d (%d bytes of output)",
+			record.ID, record.WorkingDir, duration, record.ExitCode, len(record.Output)+len(record.ErrorOutput)),
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// GetCommandStream replays the stream chunks recorded for a command while it ran, in order. Chunks
+// are saved once the command finishes; get_active_command_output covers output still being produced.
+func (t *TerminalTools) GetCommandStream(ctx context.Context, req *mcp.CallToolRequest, args GetCommandStreamArgs) (*mcp.CallToolResult, GetCommandStreamResult, error) {
+	if t.database == nil {
+		return createErrorResult("Command streams are not available: database is not configured"), GetCommandStreamResult{}, nil
+	}
+
+	commandID := strings.TrimSpace(args.CommandID)
+	if commandID == "" {
+		return createErrorResult("command_id is required. Tip: run_command returns the command_id of each command it runs."), GetCommandStreamResult{}, nil
+	}
+	if args.AfterSequence < 0 {
+		return createErrorResult("after_sequence cannot be negative"), GetCommandStreamResult{}, nil
+	}
+
+	chunks, err := t.database.GetStreamChunksAfter(commandID, args.AfterSequence)
+	if err != nil {
+		t.logger.Error("Failed to get command stream", err, map[string]interface{}{
+			"command_id": commandID,
+		})
+		return createErrorResult(fmt.Sprintf("Failed to get command stream: %v", err)), GetCommandStreamResult{}, nil
+	}
+
+	result := GetCommandStreamResult{
+		CommandID:    commandID,
+		Chunks:       chunks,
+		Count:        len(chunks),
+		LastSequence: args.AfterSequence,
+	}
+	if result.Chunks == nil {
+		result.Chunks = []*database.StreamChunk{}
+	}
+
+	for _, chunk := range chunks {
+		result.LastSequence = chunk.SequenceNum
+		if chunk.ChunkType == database.ChunkTypeStatus {
+			result.Complete = true
+			if value, ok := strings.CutPrefix(chunk.Content, "exit_code="); ok {
+				if exitCode, err := strconv.Atoi(value); err == nil {
+					result.ExitCode = &exitCode
+				}
+			}
+		}
+	}
+
+	switch {
+	case len(chunks) > 0 && result.Complete:
+		result.Message = fmt.Sprintf("Returned %d chunk(s); the command has finished", len(chunks))
+	case len(chunks) > 0:
+		result.Message = fmt.Sprintf("Returned %d chunk(s) without a status chunk; the stream was not saved completely", len(chunks))
+	case args.AfterSequence > 0:
+		result.Message = fmt.Sprintf("No chunks after sequence %d", args.AfterSequence)
+	default:
+		// Nothing recorded: either the ID is wrong or the command ran without streaming
+		if _, err := t.database.GetCommand(commandID); errors.Is(err, database.ErrCommandNotFound) {
+			return createErrorResult(fmt.Sprintf("No command or stream with ID %s. Tip: Use the command_id returned by run_command; stream chunks older than a day are removed by cleanup.", commandID)), GetCommandStreamResult{}, nil
+		}
+		result.Message = "The command was recorded without streaming (enable_streaming is off or it ran through a path that does not stream); use get_command_output for its output"
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// GetSessionRecentCommands returns a session's recent commands from its in-memory buffer. Unlike
+// search_terminal_history this works when the database is disabled.
+func (t *TerminalTools) GetSessionRecentCommands(ctx context.Context, req *mcp.CallToolRequest, args GetSessionRecentCommandsArgs) (*mcp.CallToolResult, GetSessionRecentCommandsResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetSessionRecentCommandsResult{}, nil
+	}
+
+	commands, err := t.manager.GetRecentCommands(args.SessionID, args.Limit)
+	if err != nil {
+		return createErrorResult(err.Error()), GetSessionRecentCommandsResult{}, nil
+	}
+
+	result := GetSessionRecentCommandsResult{
+		SessionID: args.SessionID,
+		Commands:  commands,
+		Count:     len(commands),
+		Capacity:  t.config.Session.RecentCommandsLimit,
+		MaxBytes:  t.config.Session.RecentCommandsMaxBytes,
+		Message:   fmt.Sprintf("Returned %d recent command(s), newest first", len(commands)),
+	}
+	if result.Capacity == 0 {
+		result.Message = "Recent command buffer is disabled (recent_commands_limit is 0)"
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// ExportHistoryAsScript renders recorded commands as a shell script that replays them in the order
+// they ran, so work done in a session can be reproduced without the server. The script stops at the
+// first failing command (set -e) and changes directory wherever the recorded working directory does.
+func (t *TerminalTools) ExportHistoryAsScript(ctx context.Context, req *mcp.CallToolRequest, args ExportHistoryAsScriptArgs) (*mcp.CallToolResult, ExportHistoryAsScriptResult, error) {
+	if t.database == nil {
+		return createErrorResult("Command history is not available: database is not configured"), ExportHistoryAsScriptResult{}, nil
+	}
+	if args.SessionID == "" && args.ProjectID == "" {
+		return createErrorResult("session_id or project_id is required. Tip: Use list_terminal_sessions to find them."), ExportHistoryAsScriptResult{}, nil
+	}
+	if args.SessionID != "" {
+		if err := validateSessionID(args.SessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), ExportHistoryAsScriptResult{}, nil
+		}
+	}
+
+	limit := args.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	// Newest first, so the limit keeps the most recent commands
+	records, err := t.database.SearchCommands(args.SessionID, args.ProjectID, "", "", nil, time.Time{}, time.Time{}, nil, limit)
+	if err != nil {
+		t.logger.Error("Failed to read command history for script export", err, map[string]interface{}{
+			"session_id": args.SessionID,
+			"project_id": args.ProjectID,
+		})
+		return createErrorResult(fmt.Sprintf("Failed to read command history: %v", err)), ExportHistoryAsScriptResult{}, nil
+	}
+
+	var commands []*database.CommandRecord
+	result := ExportHistoryAsScriptResult{}
+	for i := len(records) - 1; i >= 0; i-- {
+		if args.SuccessfulOnly && !records[i].Success {
+			result.FailedSkipped++
+			continue
+		}
+		commands = append(commands, records[i])
+	}
+	result.CommandCount = len(commands)
+	result.Script = historyScript(commands, args)
+	result.Message = fmt.Sprintf("Exported %d command(s) as a shell script", len(commands))
+	if result.FailedSkipped > 0 {
+		result.Message += fmt.Sprintf("; %d failed command(s) left out", result.FailedSkipped)
+	}
+
+	if args.Path != "" {
+		if err := os.WriteFile(args.Path, []byte(result.Script), 0o755); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to write script file: %v", err)), ExportHistoryAsScriptResult{}, nil
+		}
+		result.Path = args.Path
+		result.Message += fmt.Sprintf(" to %s", args.Path)
+
+		t.logger.Info("Command history exported as script", map[string]interface{}{
+			"path":       args.Path,
+			"session_id": args.SessionID,
+			"project_id": args.ProjectID,
+			"count":      len(commands),
+		})
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// historyScript renders commands, oldest first, as a bash script. Failed commands are grouped and
+// followed by || true so set -e does not stop the replay there.
+func historyScript(commands []*database.CommandRecord, args ExportHistoryAsScriptArgs) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# Replays command history recorded by go-term")
+	if args.SessionID != "" {
+		fmt.Fprintf(&b, " for session %s", args.SessionID)
+	}
+	if args.ProjectID != "" {
+		fmt.Fprintf(&b, " in project %s", args.ProjectID)
+	}
+	b.WriteString("\nset -e\n")
+
+	workingDir := ""
+	for _, cmd := range commands {
+		b.WriteString("\n")
+		if cmd.WorkingDir != "" && cmd.WorkingDir != workingDir {
+			fmt.Fprintf(&b, "cd %s\n", shellEscape(cmd.WorkingDir))
+			workingDir = cmd.WorkingDir
+		}
+		if args.IncludeTimestamps {
+			fmt.Fprintf(&b, "# %s\n", cmd.Timestamp.Format(time.RFC3339))
+		}
+
+		command := strings.TrimRight(cmd.Command, "\n")
+		if cmd.Success {
+			b.WriteString(command + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "# Exited with code %d when recorded; the failure is ignored here\n", cmd.ExitCode)
+		b.WriteString("{\n" + command + "\n} || true\n")
+	}
+	return b.String()
+}
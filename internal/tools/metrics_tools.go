@@ -4,8 +4,11 @@ package tools
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+	"github.com/rama-kairi/go-term/internal/monitoring"
 	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
@@ -78,6 +81,37 @@ func (t *TerminalTools) GetSessionActivityMetrics(ctx context.Context, req *mcp.
 	return createJSONResult(result), result, nil
 }
 
+// ExportActivityMetricsArgs represents arguments for exporting session activity metrics (none required)
+type ExportActivityMetricsArgs struct{}
+
+// ExportActivityMetricsResult represents the result of an on-demand activity metrics export
+type ExportActivityMetricsResult struct {
+	terminal.ActivityMetricsExport
+	Interval string `json:"interval"` // Periodic export interval
+	Message  string `json:"message"`
+}
+
+// ExportActivityMetrics appends a snapshot of every session's activity metrics to the configured
+// activity metrics file without waiting for the next periodic export
+func (t *TerminalTools) ExportActivityMetrics(ctx context.Context, req *mcp.CallToolRequest, args ExportActivityMetricsArgs) (*mcp.CallToolResult, ExportActivityMetricsResult, error) {
+	export, err := t.manager.ExportActivityMetrics()
+	if err != nil {
+		t.logger.Error("Failed to export session activity metrics", err, nil)
+		return createErrorResult(fmt.Sprintf("Failed to export activity metrics: %v", err)), ExportActivityMetricsResult{}, nil
+	}
+
+	result := ExportActivityMetricsResult{
+		ActivityMetricsExport: *export,
+		Interval:              t.config.Monitoring.ActivityMetricsInterval.String(),
+		Message:               fmt.Sprintf("Appended activity metrics for %d session(s) to %s", export.Sessions, export.Path),
+	}
+	if export.Rotated {
+		result.Message += " after rotating the previous file"
+	}
+
+	return createJSONResult(result), result, nil
+}
+
 // calculateMetricsSummary aggregates metrics across all sessions
 func calculateMetricsSummary(metrics []*terminal.SessionActivityMetrics) *MetricsSummary {
 	summary := &MetricsSummary{
@@ -130,3 +164,170 @@ func calculateMetricsSummary(metrics []*terminal.SessionActivityMetrics) *Metric
 
 	return summary
 }
+
+// --- Success Rate Trend ---
+
+const (
+	// trendChangeThreshold is how far the later half of the series must move from the earlier
+	// half before the trend is reported as improving or degrading
+	trendChangeThreshold = 0.05
+	// regressionDropThreshold flags a bucket whose success rate fell this much from the previous one
+	regressionDropThreshold = 0.2
+	// maxTrendPeriods bounds how many buckets a single query may cover
+	maxTrendPeriods = 720
+)
+
+// defaultTrendPeriods is the lookback, in buckets, when periods is not given
+var defaultTrendPeriods = map[string]int{
+	database.TrendIntervalHourly: 24,
+	database.TrendIntervalDaily:  14,
+}
+
+// GetSuccessRateTrendArgs represents arguments for computing a success rate trend
+type GetSuccessRateTrendArgs struct {
+	SessionID string `json:"session_id,omitempty" jsonschema:"description=Only include commands from this session"`
+	ProjectID string `json:"project_id,omitempty" jsonschema:"description=Only include commands from this project"`
+	Interval  string `json:"interval,omitempty" jsonschema:"description=Bucket size: hourly or daily (default daily)"`
+	Periods   int    `json:"periods,omitempty" jsonschema:"description=Number of buckets to look back (default 24 hourly or 14 daily, max 720)"`
+}
+
+// SuccessRateRegression marks a bucket whose success rate dropped sharply from the previous one
+type SuccessRateRegression struct {
+	Start        time.Time `json:"start"`
+	PreviousRate float64   `json:"previous_rate"`
+	SuccessRate  float64   `json:"success_rate"`
+}
+
+// GetSuccessRateTrendResult represents a success rate series and its direction
+type GetSuccessRateTrendResult struct {
+	Interval           string                        `json:"interval"`
+	Since              time.Time                     `json:"since"`
+	Buckets            []*database.SuccessRateBucket `json:"buckets"` // Oldest first; buckets without commands are omitted
+	TotalCommands      int                           `json:"total_commands"`
+	OverallSuccessRate float64                       `json:"overall_success_rate"`
+	Trend              string                        `json:"trend"`  // improving, degrading, stable or insufficient_data
+	Change             float64                       `json:"change"` // Later half success rate minus earlier half
+	Regressions        []SuccessRateRegression       `json:"regressions,omitempty"`
+	Message            string                        `json:"message"`
+}
+
+// GetSuccessRateTrend buckets command history into hourly or daily windows and reports the
+// success rate of each, so regressions such as a dependency change breaking builds stand out
+func (t *TerminalTools) GetSuccessRateTrend(ctx context.Context, req *mcp.CallToolRequest, args GetSuccessRateTrendArgs) (*mcp.CallToolResult, GetSuccessRateTrendResult, error) {
+	if t.database == nil {
+		return createErrorResult("Database is disabled"), GetSuccessRateTrendResult{}, nil
+	}
+
+	interval := args.Interval
+	if interval == "" {
+		interval = database.TrendIntervalDaily
+	}
+	bucketSize := time.Hour
+	switch interval {
+	case database.TrendIntervalHourly:
+	case database.TrendIntervalDaily:
+		bucketSize = 24 * time.Hour
+	default:
+		return createErrorResult(fmt.Sprintf("Invalid interval %q: use hourly or daily", args.Interval)), GetSuccessRateTrendResult{}, nil
+	}
+
+	periods := args.Periods
+	if periods <= 0 {
+		periods = defaultTrendPeriods[interval]
+	}
+	if periods > maxTrendPeriods {
+		periods = maxTrendPeriods
+	}
+
+	if args.SessionID != "" {
+		if err := validateSessionID(args.SessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetSuccessRateTrendResult{}, nil
+		}
+	}
+
+	// Start at the beginning of the oldest bucket so it is counted in full
+	since := time.Now().UTC().Truncate(bucketSize).Add(-time.Duration(periods-1) * bucketSize)
+	buckets, err := t.database.GetSuccessRateTrend(args.SessionID, args.ProjectID, interval, since)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to compute success rate trend: %v", err)), GetSuccessRateTrendResult{}, nil
+	}
+	if buckets == nil {
+		buckets = []*database.SuccessRateBucket{}
+	}
+
+	result := GetSuccessRateTrendResult{
+		Interval: interval,
+		Since:    since,
+		Buckets:  buckets,
+	}
+	successful := 0
+	for i, bucket := range buckets {
+		result.TotalCommands += bucket.Total
+		successful += bucket.Successful
+		if i > 0 && buckets[i-1].SuccessRate-bucket.SuccessRate >= regressionDropThreshold {
+			result.Regressions = append(result.Regressions, SuccessRateRegression{
+				Start:        bucket.Start,
+				PreviousRate: buckets[i-1].SuccessRate,
+				SuccessRate:  bucket.SuccessRate,
+			})
+		}
+	}
+	if result.TotalCommands > 0 {
+		result.OverallSuccessRate = float64(successful) / float64(result.TotalCommands)
+	}
+	result.Trend, result.Change = successRateTrend(buckets)
+
+	result.Message = fmt.Sprintf("%d command(s) in %d %s bucket(s): trend %s", result.TotalCommands, len(buckets), interval, result.Trend)
+	if len(result.Regressions) > 0 {
+		result.Message += fmt.Sprintf(", %d regression(s) detected", len(result.Regressions))
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// successRateTrend compares the combined success rate of the later half of buckets with the
+// earlier half. At least two buckets are needed to call a direction.
+func successRateTrend(buckets []*database.SuccessRateBucket) (string, float64) {
+	if len(buckets) < 2 {
+		return "insufficient_data", 0
+	}
+
+	rate := func(part []*database.SuccessRateBucket) float64 {
+		total, successful := 0, 0
+		for _, bucket := range part {
+			total += bucket.Total
+			successful += bucket.Successful
+		}
+		return float64(successful) / float64(total)
+	}
+
+	half := len(buckets) / 2
+	change := rate(buckets[len(buckets)-half:]) - rate(buckets[:half])
+	switch {
+	case change >= trendChangeThreshold:
+		return "improving", change
+	case change <= -trendChangeThreshold:
+		return "degrading", change
+	}
+	return "stable", change
+}
+
+// ServerMetrics gathers the values the Prometheus metrics endpoint exposes: session counts from
+// GetSessionStats, background processes from the manager's diagnostics, command totals since
+// start and the calls each rate limiter has rejected
+func (t *TerminalTools) ServerMetrics() monitoring.ServerMetrics {
+	stats := t.manager.GetSessionStats()
+	diag := t.manager.Diagnostics()
+	total, successful := t.manager.CommandTotals()
+
+	return monitoring.ServerMetrics{
+		Sessions:                   stats.TotalSessions,
+		ActiveSessions:             stats.ActiveSessions,
+		CommandsTotal:              total,
+		CommandsSuccessful:         successful,
+		BackgroundProcesses:        diag.BackgroundProcesses,
+		RunningBackgroundProcesses: diag.RunningBackgroundProcesses,
+		RateLimitRejections:        t.RateLimitRejections(),
+		Goroutines:                 diag.Goroutines,
+	}
+}
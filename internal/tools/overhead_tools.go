@@ -0,0 +1,135 @@
+// Package tools provides MCP tool handlers for measuring command execution overhead
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+const (
+	defaultOverheadIterations = 10
+	maxOverheadIterations     = 100
+)
+
+// --- Execution Overhead Types ---
+
+// MeasureExecutionOverheadArgs represents arguments for measuring per-command overhead
+type MeasureExecutionOverheadArgs struct {
+	SessionID  string `json:"session_id" jsonschema:"required,description=Session to measure; runs use its working directory, environment and shell options"`
+	Iterations int    `json:"iterations,omitempty" jsonschema:"description=Number of runs per measurement (default 10, max 100)"`
+	Command    string `json:"command,omitempty" jsonschema:"description=Optional workload command to time alongside the no-op so its work can be separated from the fixed overhead"`
+}
+
+// TimingStats summarizes timing samples in milliseconds
+type TimingStats struct {
+	Samples int     `json:"samples"`
+	MeanMs  float64 `json:"mean_ms"`
+	MinMs   float64 `json:"min_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P90Ms   float64 `json:"p90_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// MeasureExecutionOverheadResult reports fixed per-command overhead and optional workload timings
+type MeasureExecutionOverheadResult struct {
+	SessionID      string       `json:"session_id"`
+	ExecutionModel string       `json:"execution_model"` // How commands are run, e.g. fresh_shell
+	Iterations     int          `json:"iterations"`
+	NoOpCommand    string       `json:"noop_command"`
+	Overhead       TimingStats  `json:"overhead"` // Process spawn + teardown for a no-op command
+	Command        string       `json:"command,omitempty"`
+	CommandTimings *TimingStats `json:"command_timings,omitempty"`
+	// Mean workload time minus mean overhead, floored at zero
+	EstimatedWorkMs float64 `json:"estimated_work_ms,omitempty"`
+	Message         string  `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// MeasureExecutionOverhead times a no-op command to quantify the fixed cost of the fresh-shell model
+func (t *TerminalTools) MeasureExecutionOverhead(ctx context.Context, req *mcp.CallToolRequest, args MeasureExecutionOverheadArgs) (*mcp.CallToolResult, MeasureExecutionOverheadResult, error) {
+	// H2: Check rate limit
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), MeasureExecutionOverheadResult{}, nil
+	}
+
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), MeasureExecutionOverheadResult{}, nil
+	}
+
+	iterations := args.Iterations
+	if iterations <= 0 {
+		iterations = defaultOverheadIterations
+	}
+	if iterations > maxOverheadIterations {
+		iterations = maxOverheadIterations
+	}
+
+	if args.Command != "" {
+		if decision := t.evaluateCommandForSession(args.SessionID, args.Command); !decision.Allowed {
+			t.recordBlockedCommand(args.SessionID, args.Command, "measure_execution_overhead", decision)
+			return createErrorResult(fmt.Sprintf("Command blocked for security reasons: %s (rule type: %s)", decision.Reason, decision.RuleType)), MeasureExecutionOverheadResult{}, nil
+		}
+	}
+
+	overheadSamples, err := t.manager.MeasureCommandTimings(ctx, args.SessionID, terminal.NoOpCommand, iterations)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to measure overhead: %v", err)), MeasureExecutionOverheadResult{}, nil
+	}
+	overhead := toTimingStats(terminal.SummarizeDurations(overheadSamples))
+
+	result := MeasureExecutionOverheadResult{
+		SessionID:      args.SessionID,
+		ExecutionModel: "fresh_shell",
+		Iterations:     iterations,
+		NoOpCommand:    terminal.NoOpCommand,
+		Overhead:       overhead,
+		Message:        fmt.Sprintf("Mean fixed overhead %.2fms (p50 %.2fms, p99 %.2fms) over %d runs", overhead.MeanMs, overhead.P50Ms, overhead.P99Ms, iterations),
+	}
+
+	if args.Command != "" {
+		commandSamples, err := t.manager.MeasureCommandTimings(ctx, args.SessionID, args.Command, iterations)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to time command: %v", err)), MeasureExecutionOverheadResult{}, nil
+		}
+		commandStats := toTimingStats(terminal.SummarizeDurations(commandSamples))
+		result.Command = args.Command
+		result.CommandTimings = &commandStats
+		if work := commandStats.MeanMs - overhead.MeanMs; work > 0 {
+			result.EstimatedWorkMs = work
+		}
+		result.Message += fmt.Sprintf("; estimated command work %.2fms", result.EstimatedWorkMs)
+	}
+
+	t.logger.Info("Measured execution overhead", map[string]interface{}{
+		"session_id":       args.SessionID,
+		"iterations":       iterations,
+		"mean_overhead_ms": overhead.MeanMs,
+		"p99_overhead_ms":  overhead.P99Ms,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// toTimingStats converts duration stats to millisecond values
+func toTimingStats(stats terminal.DurationStats) TimingStats {
+	return TimingStats{
+		Samples: stats.Samples,
+		MeanMs:  durationMs(stats.Mean),
+		MinMs:   durationMs(stats.Min),
+		MaxMs:   durationMs(stats.Max),
+		P50Ms:   durationMs(stats.P50),
+		P90Ms:   durationMs(stats.P90),
+		P99Ms:   durationMs(stats.P99),
+	}
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
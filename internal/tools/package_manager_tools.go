@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/utils"
+)
+
+// ListAvailablePackageManagersArgs represents arguments for probing package manager executables
+type ListAvailablePackageManagersArgs struct {
+	Refresh bool `json:"refresh,omitempty" jsonschema:"description=Probe PATH again instead of using the briefly cached result"`
+}
+
+// ListAvailablePackageManagersResult lists which package manager executables are installed on the host
+type ListAvailablePackageManagersResult struct {
+	Available []string                 `json:"available"` // Names of installed executables
+	Managers  []utils.ExecutableStatus `json:"managers"`
+	ProbedAt  string                   `json:"probed_at"`
+	Cached    bool                     `json:"cached"` // True when the probe was served from cache
+	Message   string                   `json:"message"`
+}
+
+// ListAvailablePackageManagers reports which known package managers are on PATH and their versions,
+// so an agent can check for a tool such as pnpm before running it
+func (t *TerminalTools) ListAvailablePackageManagers(ctx context.Context, req *mcp.CallToolRequest, args ListAvailablePackageManagersArgs) (*mcp.CallToolResult, ListAvailablePackageManagersResult, error) {
+	start := time.Now()
+	managers, probedAt := t.packageManager.ProbeExecutables(ctx, args.Refresh)
+
+	result := ListAvailablePackageManagersResult{
+		Available: []string{},
+		Managers:  managers,
+		ProbedAt:  probedAt.Format(time.RFC3339),
+		Cached:    probedAt.Before(start),
+	}
+	for _, manager := range managers {
+		if manager.Available {
+			result.Available = append(result.Available, manager.Name)
+		}
+	}
+	result.Message = fmt.Sprintf("%d of %d known package managers are available", len(result.Available), len(managers))
+
+	return createJSONResult(result), result, nil
+}
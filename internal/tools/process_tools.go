@@ -0,0 +1,77 @@
+// Package tools provides MCP tool handlers for session-scoped process control
+package tools
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+// --- Process Kill Types ---
+
+// KillProcessByPIDArgs represents arguments for killing an untracked process by OS PID
+type KillProcessByPIDArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=Session whose process tree must contain the PID"`
+	PID       int    `json:"pid" jsonschema:"required,description=OS process ID to signal; must descend from the session's shell or one of its running background processes"`
+	Signal    string `json:"signal,omitempty" jsonschema:"description=Signal to send: SIGTERM (default), SIGINT, SIGHUP, SIGQUIT or SIGKILL"`
+}
+
+// KillProcessByPIDResult represents the result of killing a process by PID
+type KillProcessByPIDResult struct {
+	SessionID   string `json:"session_id"`
+	PID         int    `json:"pid"`
+	Signal      string `json:"signal"`
+	Killed      bool   `json:"killed"`
+	AncestorPID int    `json:"ancestor_pid,omitempty"`
+	Ancestor    string `json:"ancestor,omitempty"`
+	Message     string `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// KillProcessByPID signals a process that escaped tracking, provided it belongs to the session's
+// process tree; arbitrary host processes are refused
+func (t *TerminalTools) KillProcessByPID(ctx context.Context, req *mcp.CallToolRequest, args KillProcessByPIDArgs) (*mcp.CallToolResult, KillProcessByPIDResult, error) {
+	// H2: Check rate limit
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), KillProcessByPIDResult{}, nil
+	}
+
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), KillProcessByPIDResult{}, nil
+	}
+
+	sig := syscall.SIGTERM
+	if args.Signal != "" {
+		parsed, err := terminal.ParseSignal(args.Signal)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid signal: %v", err)), KillProcessByPIDResult{}, nil
+		}
+		sig = parsed
+	}
+
+	kill, err := t.manager.KillSessionProcess(args.SessionID, args.PID, sig)
+	if err != nil {
+		t.logger.LogSecurityEvent("kill_pid_refused", fmt.Sprintf("Refused to signal PID %d", args.PID), "medium", map[string]interface{}{
+			"session_id": args.SessionID,
+			"pid":        args.PID,
+			"error":      err.Error(),
+		})
+		return createErrorResult(fmt.Sprintf("Failed to kill process: %v", err)), KillProcessByPIDResult{}, nil
+	}
+
+	result := KillProcessByPIDResult{
+		SessionID:   args.SessionID,
+		PID:         kill.PID,
+		Signal:      kill.Signal,
+		Killed:      true,
+		AncestorPID: kill.AncestorPID,
+		Ancestor:    kill.Ancestor,
+		Message:     fmt.Sprintf("Sent %s to PID %d (descendant of %s, PID %d)", kill.Signal, kill.PID, kill.Ancestor, kill.AncestorPID),
+	}
+
+	return createJSONResult(result), result, nil
+}
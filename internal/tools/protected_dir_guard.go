@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rama-kairi/go-term/internal/config"
+)
+
+// Server directory guard modes (security.server_dir_guard)
+const (
+	ServerDirGuardOff   = "off"
+	ServerDirGuardWarn  = "warn"
+	ServerDirGuardBlock = "block"
+)
+
+// destructivePatterns match commands that delete, overwrite or change files in place
+var destructivePatterns = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`(^|[;&|(]\s*)(sudo\s+)?(rm|rmdir|unlink|shred|truncate)\b`), "deletes or truncates files"},
+	{regexp.MustCompile(`(^|[;&|(]\s*)(sudo\s+)?(mv|cp|install|rsync|dd|ln)\b`), "moves or overwrites files"},
+	{regexp.MustCompile(`(^|[;&|(]\s*)(sudo\s+)?(chmod|chown|chgrp)\b`), "changes file permissions or ownership"},
+	{regexp.MustCompile(`\b(sed|perl)\s([^;&|]*\s)?(-\w*i|--in-place)\b`), "edits files in place"},
+	{regexp.MustCompile(`\bgit\s+(clean|restore|reset\s+--hard|checkout\s+--)`), "discards files or changes in the checkout"},
+	{regexp.MustCompile(`(^|[;&|(]\s*)(sudo\s+)?tee\b`), "writes files"},
+}
+
+// ProtectedDirWarning flags a command run in the server's own directories or a protected path
+type ProtectedDirWarning struct {
+	Path        string `json:"path"`                  // Protected directory holding the working directory
+	Reason      string `json:"reason"`                // What the directory is
+	Destructive string `json:"destructive,omitempty"` // How the command may modify files, when it looks like it does
+	Handling    string `json:"handling"`              // warn or block
+	Overridden  bool   `json:"overridden,omitempty"`  // allow_protected_dir let a destructive command run under block
+}
+
+// protectedDir is a directory guarded by server_dir_guard and why
+type protectedDir struct {
+	path   string
+	reason string
+}
+
+// protectedDirs returns the directories server_dir_guard covers: the directory holding the
+// server's executable, its data directory and the configured protected paths
+func (t *TerminalTools) protectedDirs() []protectedDir {
+	var dirs []protectedDir
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, protectedDir{path: filepath.Dir(exe), reason: "the server's installation directory"})
+	}
+	if t.config.Database.DataDir != "" {
+		dirs = append(dirs, protectedDir{path: t.config.Database.DataDir, reason: "the server's data directory"})
+	}
+	for _, path := range t.config.Security.ProtectedPaths {
+		if path != "" {
+			dirs = append(dirs, protectedDir{path: path, reason: "a configured protected path"})
+		}
+	}
+	return dirs
+}
+
+// checkProtectedDir returns a warning when workingDir is inside a protected directory, and
+// whether the command must be rejected: under block, a destructive command is rejected unless
+// override is set. It returns nil when the guard is off or the directory is not protected.
+func (t *TerminalTools) checkProtectedDir(workingDir, command string, override bool) (*ProtectedDirWarning, bool) {
+	handling := t.config.Security.ServerDirGuard
+	if handling == "" {
+		handling = ServerDirGuardWarn
+	}
+	if handling == ServerDirGuardOff || workingDir == "" {
+		return nil, false
+	}
+
+	for _, dir := range t.protectedDirs() {
+		if !config.IsWithinDir(workingDir, dir.path) {
+			continue
+		}
+		warning := &ProtectedDirWarning{
+			Path:        dir.path,
+			Reason:      dir.reason,
+			Destructive: detectDestructive(command),
+			Handling:    handling,
+		}
+		if handling == ServerDirGuardBlock && warning.Destructive != "" {
+			if !override {
+				return warning, true
+			}
+			warning.Overridden = true
+		}
+		return warning, false
+	}
+	return nil, false
+}
+
+// detectDestructive reports how command may delete or modify files, or "" if it looks harmless
+func detectDestructive(command string) string {
+	for _, entry := range destructivePatterns {
+		if entry.pattern.MatchString(command) {
+			return entry.reason
+		}
+	}
+	if hasFileRedirection(command) {
+		return "redirects output into a file"
+	}
+	return ""
+}
+
+// hasFileRedirection reports whether command redirects output into a file with '>' or '>>',
+// ignoring quoted text, descriptor duplication such as '2>&1' and /dev/null, /dev/stdout and
+// /dev/stderr
+func hasFileRedirection(command string) bool {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '>':
+			j := i + 1
+			if j < len(command) && (command[j] == '>' || command[j] == '|') {
+				j++
+			}
+			if j < len(command) && command[j] == '&' {
+				i = j
+				continue
+			}
+			target := strings.TrimLeft(command[j:], " \t")
+			if end := strings.IndexAny(target, " \t;&|()<>\n"); end >= 0 {
+				target = target[:end]
+			}
+			switch target {
+			case "/dev/null", "/dev/stdout", "/dev/stderr":
+				i = j - 1
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
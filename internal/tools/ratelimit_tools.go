@@ -0,0 +1,123 @@
+// Package tools provides MCP tool handlers for rate limit introspection (H2)
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// --- Rate Limit Types ---
+
+// GetRateLimitStatusArgs represents arguments for getting rate limit status (none required)
+type GetRateLimitStatusArgs struct{}
+
+// RateLimitCategoryStatus describes the headroom of a single rate limiter
+type RateLimitCategoryStatus struct {
+	Category            string  `json:"category"`
+	AvailableTokens     float64 `json:"available_tokens"`
+	Burst               int     `json:"burst"`
+	RatePerMinute       int     `json:"rate_per_minute"`
+	NextTokenInSeconds  float64 `json:"next_token_in_seconds"`  // 0 if a call can be made now
+	FullRefillInSeconds float64 `json:"full_refill_in_seconds"` // Time until the burst is fully available again
+	Limited             bool    `json:"limited"`                // True if the next call would be rejected
+}
+
+// RateLimitStatusResult represents the result of getting rate limit status
+type RateLimitStatusResult struct {
+	Categories []RateLimitCategoryStatus `json:"categories"`
+	Message    string                    `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// GetRateLimitStatus reports the current rate limiter headroom so agents can pace their calls
+func (t *TerminalTools) GetRateLimitStatus(ctx context.Context, req *mcp.CallToolRequest, args GetRateLimitStatusArgs) (*mcp.CallToolResult, RateLimitStatusResult, error) {
+	categories := t.rateLimitCategories()
+
+	var message string
+	if t.rateLimiter != nil {
+		global := categories[0]
+		message = fmt.Sprintf("%d call(s) available now", int(math.Floor(global.AvailableTokens)))
+		if global.Limited {
+			message = fmt.Sprintf("Rate limited: next call available in %.1f seconds", global.NextTokenInSeconds)
+		}
+	} else {
+		message = fmt.Sprintf("No global limit; each session may make %d call(s) per minute", t.config.Session.RateLimitPerMinute)
+	}
+
+	limitedSessions, limitedProjects := 0, 0
+	for _, status := range categories {
+		if !status.Limited {
+			continue
+		}
+		switch {
+		case status.Category == rateLimitCategoryNoSession || strings.HasPrefix(status.Category, "session:"):
+			limitedSessions++
+		case strings.HasPrefix(status.Category, "project:"):
+			limitedProjects++
+		}
+	}
+	if limitedSessions > 0 {
+		message += fmt.Sprintf("; %d session(s) currently limited", limitedSessions)
+	}
+	if limitedProjects > 0 {
+		message += fmt.Sprintf("; %d project(s) currently limited", limitedProjects)
+	}
+
+	result := RateLimitStatusResult{
+		Categories: categories,
+		Message:    message,
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// rateLimitCategoryNoSession is the category of the bucket shared by calls without a session
+const rateLimitCategoryNoSession = "no_session"
+
+// rateLimitCategories returns the status of the global limiter when enabled, then of each session
+// and project limiter created so far
+func (t *TerminalTools) rateLimitCategories() []RateLimitCategoryStatus {
+	var categories []RateLimitCategoryStatus
+	if t.rateLimiter != nil {
+		categories = append(categories, rateLimitCategoryStatus(rateLimiterGlobal, t.rateLimiter))
+	}
+	for _, sessionID := range t.sessionLimiters.keys() {
+		category := "session:" + sessionID
+		if sessionID == "" {
+			category = rateLimitCategoryNoSession
+		}
+		categories = append(categories, rateLimitCategoryStatus(category, t.sessionLimiters.get(sessionID)))
+	}
+	for _, projectID := range t.projectLimiters.keys() {
+		categories = append(categories, rateLimitCategoryStatus("project:"+projectID, t.projectLimiters.get(projectID)))
+	}
+	if categories == nil {
+		categories = []RateLimitCategoryStatus{}
+	}
+	return categories
+}
+
+// rateLimitCategoryStatus builds the status of one rate limiter
+func rateLimitCategoryStatus(category string, rl *RateLimiter) RateLimitCategoryStatus {
+	snapshot := rl.Snapshot()
+
+	fullRefill := 0.0
+	if snapshot.RefillRate > 0 && snapshot.AvailableTokens < snapshot.MaxTokens {
+		fullRefill = (snapshot.MaxTokens - snapshot.AvailableTokens) / snapshot.RefillRate
+	}
+
+	return RateLimitCategoryStatus{
+		Category:            category,
+		AvailableTokens:     math.Round(snapshot.AvailableTokens*100) / 100,
+		Burst:               int(snapshot.MaxTokens),
+		RatePerMinute:       int(math.Round(snapshot.RefillRate * 60)),
+		NextTokenInSeconds:  math.Round(snapshot.TimeUntilNext.Seconds()*100) / 100,
+		FullRefillInSeconds: math.Round(fullRefill*100) / 100,
+		Limited:             snapshot.AvailableTokens < 1,
+	}
+}
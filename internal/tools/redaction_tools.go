@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/logger"
+)
+
+// maxRedactionPreviewBytes bounds the sample text preview_redaction accepts
+const maxRedactionPreviewBytes = 1024 * 1024
+
+// redactionScope lists where the secret patterns are applied
+var redactionScope = []string{
+	"command output echoed to the log (logging.tee_command_output)",
+	"commands written to the log",
+	"environment values that look like secrets in tool results",
+}
+
+// PreviewRedactionArgs represents arguments for previewing secret redaction
+type PreviewRedactionArgs struct {
+	Text string `json:"text" jsonschema:"required,description=Sample text to redact; it is not stored or logged"`
+}
+
+// PreviewRedactionResult shows sample text with secrets redacted and what matched
+type PreviewRedactionResult struct {
+	Redacted      string               `json:"redacted"`
+	Changed       bool                 `json:"changed"`
+	Matches       []logger.SecretMatch `json:"matches"` // Spans in the original text, ordered by position
+	MatchCount    int                  `json:"match_count"`
+	PatternCounts map[string]int       `json:"pattern_counts"`
+	AppliesTo     []string             `json:"applies_to"`
+	Message       string               `json:"message"`
+}
+
+// PreviewRedaction applies the secret patterns used for log redaction to sample text and reports
+// which patterns matched where, so the rules can be checked against real-looking output. Nothing is
+// stored, and the text is kept out of the log.
+func (t *TerminalTools) PreviewRedaction(ctx context.Context, req *mcp.CallToolRequest, args PreviewRedactionArgs) (*mcp.CallToolResult, PreviewRedactionResult, error) {
+	if args.Text == "" {
+		return createErrorResult("text is required"), PreviewRedactionResult{}, nil
+	}
+	if len(args.Text) > maxRedactionPreviewBytes {
+		return createErrorResult(fmt.Sprintf("text is %d bytes; preview at most %d bytes at a time", len(args.Text), maxRedactionPreviewBytes)), PreviewRedactionResult{}, nil
+	}
+
+	redacted := logger.RedactSecrets(args.Text)
+	matches := logger.FindSecrets(args.Text)
+	if matches == nil {
+		matches = []logger.SecretMatch{}
+	}
+
+	result := PreviewRedactionResult{
+		Redacted:      redacted,
+		Changed:       redacted != args.Text,
+		Matches:       matches,
+		MatchCount:    len(matches),
+		PatternCounts: make(map[string]int),
+		AppliesTo:     redactionScope,
+	}
+	for _, match := range matches {
+		result.PatternCounts[match.Pattern]++
+	}
+	if result.Changed {
+		result.Message = fmt.Sprintf("%d secret(s) would be redacted by %d pattern(s)", len(matches), len(result.PatternCounts))
+	} else {
+		result.Message = "No secrets matched; the text would be logged unchanged"
+	}
+
+	return createJSONResult(result), result, nil
+}
@@ -0,0 +1,341 @@
+// Package tools provides MCP tool handlers for session handoff reports
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+	"github.com/rama-kairi/go-term/internal/terminal"
+	"github.com/rama-kairi/go-term/internal/utils"
+)
+
+const (
+	defaultReportHistoryLimit = 500
+	maxReportHistoryLimit     = 5000
+	defaultReportTopN         = 5
+	maxReportTopN             = 50
+	reportErrorSnippetLength  = 200
+)
+
+// --- Session Report Types ---
+
+// GetSessionReportArgs represents arguments for generating a session report
+type GetSessionReportArgs struct {
+	SessionID    string `json:"session_id" jsonschema:"required,description=Session to summarize"`
+	HistoryLimit int    `json:"history_limit,omitempty" jsonschema:"description=Maximum number of recent history entries to analyze (default 500, max 5000)"`
+	TopN         int    `json:"top_n,omitempty" jsonschema:"description=Number of entries in top commands, key successes and key failures (default 5, max 50)"`
+}
+
+// ReportCommandType summarizes commands sharing the same base command
+type ReportCommandType struct {
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+	Failures int    `json:"failures"`
+}
+
+// ReportCommandFrequency is a command line and how often it was run
+type ReportCommandFrequency struct {
+	Command string `json:"command"`
+	Count   int    `json:"count"`
+}
+
+// ReportCommand is a single notable command from history
+type ReportCommand struct {
+	Command      string `json:"command"`
+	ExitCode     int    `json:"exit_code"`
+	DurationMs   int64  `json:"duration_ms"`
+	WorkingDir   string `json:"working_dir"`
+	Timestamp    string `json:"timestamp"`
+	ErrorSnippet string `json:"error_snippet,omitempty"`
+}
+
+// ReportBackgroundProcess summarizes a background process started in the session
+type ReportBackgroundProcess struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	PID       int    `json:"pid"`
+	StartTime string `json:"start_time"`
+	IsRunning bool   `json:"is_running"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+// SessionReport is a deterministic summary of what a session has done
+type SessionReport struct {
+	SessionID          string  `json:"session_id"`
+	SessionName        string  `json:"session_name"`
+	ProjectID          string  `json:"project_id"`
+	WorkingDir         string  `json:"working_dir"`
+	CurrentDir         string  `json:"current_dir"`
+	CreatedAt          string  `json:"created_at"`
+	LastActivity       string  `json:"last_activity"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+	TotalCommands      int     `json:"total_commands"`
+	SuccessfulCommands int     `json:"successful_commands"`
+	FailedCommands     int     `json:"failed_commands"`
+	SuccessRate        float64 `json:"success_rate"`
+	TotalExecutionMs   int64   `json:"total_execution_ms"`
+
+	CommandTypes        []ReportCommandType       `json:"command_types"`
+	TopCommands         []ReportCommandFrequency  `json:"top_commands"`
+	KeySuccesses        []ReportCommand           `json:"key_successes"` // Longest-running successful commands
+	KeyFailures         []ReportCommand           `json:"key_failures"`  // Most recent failed commands
+	DirectoriesTouched  []string                  `json:"directories_touched"`
+	ErrorCategories     map[string]int            `json:"error_categories"`
+	BackgroundProcesses []ReportBackgroundProcess `json:"background_processes"`
+
+	HistoryAnalyzed  int  `json:"history_analyzed"`
+	HistoryTruncated bool `json:"history_truncated"` // True when older history was not analyzed
+}
+
+// GetSessionReportResult represents the result of generating a session report
+type GetSessionReportResult struct {
+	Report  SessionReport `json:"report"`
+	Message string        `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// GetSessionReport aggregates history and activity metrics into a structured handoff report
+func (t *TerminalTools) GetSessionReport(ctx context.Context, req *mcp.CallToolRequest, args GetSessionReportArgs) (*mcp.CallToolResult, GetSessionReportResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetSessionReportResult{}, nil
+	}
+
+	session, err := t.manager.GetSession(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v", err)), GetSessionReportResult{}, nil
+	}
+
+	metrics, err := t.manager.GetSessionActivityMetrics(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to get session metrics: %v", err)), GetSessionReportResult{}, nil
+	}
+
+	historyLimit := args.HistoryLimit
+	if historyLimit <= 0 {
+		historyLimit = defaultReportHistoryLimit
+	}
+	if historyLimit > maxReportHistoryLimit {
+		historyLimit = maxReportHistoryLimit
+	}
+
+	topN := args.TopN
+	if topN <= 0 {
+		topN = defaultReportTopN
+	}
+	if topN > maxReportTopN {
+		topN = maxReportTopN
+	}
+
+	var history []*database.CommandRecord
+	if t.database != nil {
+		history, err = t.database.SearchCommands(args.SessionID, "", "", "", nil, time.Time{}, time.Time{}, nil, historyLimit)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to get command history: %v", err)), GetSessionReportResult{}, nil
+		}
+	}
+
+	report := SessionReport{
+		SessionID:        metrics.SessionID,
+		SessionName:      metrics.SessionName,
+		ProjectID:        metrics.ProjectID,
+		WorkingDir:       session.GetWorkingDir(),
+		CurrentDir:       session.GetCurrentDir(),
+		CreatedAt:        session.CreatedAt.Format(time.RFC3339),
+		LastActivity:     metrics.LastCommandTime.Format(time.RFC3339),
+		DurationSeconds:  metrics.SessionDuration.Seconds(),
+		HistoryAnalyzed:  len(history),
+		HistoryTruncated: len(history) >= historyLimit,
+	}
+
+	summarizeReportHistory(&report, history, topN)
+
+	// The in-memory counters outlive the history window when history is truncated or
+	// not persisted, so prefer them whenever they cover more commands
+	if metrics.TotalCommands > report.TotalCommands {
+		report.TotalCommands = metrics.TotalCommands
+		report.SuccessfulCommands = metrics.SuccessfulCommands
+		report.FailedCommands = metrics.FailedCommands
+		report.TotalExecutionMs = metrics.TotalExecutionTime.Milliseconds()
+		report.ErrorCategories = metrics.ErrorCategories
+	}
+	if report.ErrorCategories == nil {
+		report.ErrorCategories = make(map[string]int)
+	}
+	if report.TotalCommands > 0 {
+		report.SuccessRate = float64(report.SuccessfulCommands) / float64(report.TotalCommands)
+	}
+
+	report.BackgroundProcesses = t.reportBackgroundProcesses(args.SessionID)
+
+	result := GetSessionReportResult{
+		Report: report,
+		Message: fmt.Sprintf("Session '%s' ran %d command(s) (%d failed) across %d director(ies) and started %d background process(es)",
+			report.SessionName, report.TotalCommands, report.FailedCommands, len(report.DirectoriesTouched), len(report.BackgroundProcesses)),
+	}
+
+	t.logger.Info("Generated session report", map[string]interface{}{
+		"session_id":       args.SessionID,
+		"history_analyzed": report.HistoryAnalyzed,
+		"total_commands":   report.TotalCommands,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// summarizeReportHistory fills the counts and sections derived from history. History is
+// expected newest first, as returned by SearchCommands; all orderings have explicit
+// tie-breaks so the same history always produces the same report.
+func summarizeReportHistory(report *SessionReport, history []*database.CommandRecord, topN int) {
+	types := make(map[string]*ReportCommandType)
+	frequency := make(map[string]int)
+	dirs := make(map[string]bool)
+	var successes, failures []*database.CommandRecord
+
+	report.ErrorCategories = make(map[string]int)
+	for _, record := range history {
+		report.TotalCommands++
+		report.TotalExecutionMs += record.Duration
+		if record.Success {
+			report.SuccessfulCommands++
+		} else {
+			report.FailedCommands++
+			report.ErrorCategories[terminal.CategorizeError(reportErrorText(record))]++
+		}
+
+		cmdType := terminal.ExtractCommandType(record.Command)
+		entry, ok := types[cmdType]
+		if !ok {
+			entry = &ReportCommandType{Type: cmdType}
+			types[cmdType] = entry
+		}
+		entry.Count++
+		if !record.Success {
+			entry.Failures++
+		}
+
+		frequency[strings.TrimSpace(record.Command)]++
+		if record.WorkingDir != "" {
+			dirs[record.WorkingDir] = true
+		}
+
+		if record.Success {
+			successes = append(successes, record)
+		} else {
+			failures = append(failures, record)
+		}
+	}
+
+	report.CommandTypes = make([]ReportCommandType, 0, len(types))
+	for _, entry := range types {
+		report.CommandTypes = append(report.CommandTypes, *entry)
+	}
+	sort.Slice(report.CommandTypes, func(i, j int) bool {
+		a, b := report.CommandTypes[i], report.CommandTypes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Type < b.Type
+	})
+
+	report.TopCommands = make([]ReportCommandFrequency, 0, len(frequency))
+	for command, count := range frequency {
+		report.TopCommands = append(report.TopCommands, ReportCommandFrequency{Command: command, Count: count})
+	}
+	sort.Slice(report.TopCommands, func(i, j int) bool {
+		a, b := report.TopCommands[i], report.TopCommands[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Command < b.Command
+	})
+	if len(report.TopCommands) > topN {
+		report.TopCommands = report.TopCommands[:topN]
+	}
+
+	report.DirectoriesTouched = make([]string, 0, len(dirs))
+	for dir := range dirs {
+		report.DirectoriesTouched = append(report.DirectoriesTouched, dir)
+	}
+	sort.Strings(report.DirectoriesTouched)
+
+	// Long-running successes are usually the builds, installs and test runs worth mentioning
+	sort.SliceStable(successes, func(i, j int) bool {
+		return successes[i].Duration > successes[j].Duration
+	})
+	report.KeySuccesses = make([]ReportCommand, 0, topN)
+	for i := 0; i < len(successes) && i < topN; i++ {
+		report.KeySuccesses = append(report.KeySuccesses, toReportCommand(successes[i]))
+	}
+
+	report.KeyFailures = make([]ReportCommand, 0, topN)
+	for i := 0; i < len(failures) && i < topN; i++ {
+		report.KeyFailures = append(report.KeyFailures, toReportCommand(failures[i]))
+	}
+}
+
+// reportBackgroundProcesses lists background processes still tracked for a session, oldest first
+func (t *TerminalTools) reportBackgroundProcesses(sessionID string) []ReportBackgroundProcess {
+	processes := make([]ReportBackgroundProcess, 0)
+
+	all, err := t.manager.GetAllBackgroundProcesses(sessionID, "")
+	if err != nil {
+		return processes
+	}
+
+	for _, proc := range all[sessionID] {
+		proc.Mutex.RLock()
+		processes = append(processes, ReportBackgroundProcess{
+			ID:        proc.ID,
+			Command:   proc.Command,
+			PID:       proc.PID,
+			StartTime: proc.StartTime.Format(time.RFC3339),
+			IsRunning: proc.IsRunning,
+			ExitCode:  proc.ExitCode,
+		})
+		proc.Mutex.RUnlock()
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		if processes[i].StartTime != processes[j].StartTime {
+			return processes[i].StartTime < processes[j].StartTime
+		}
+		return processes[i].ID < processes[j].ID
+	})
+
+	return processes
+}
+
+// reportErrorText returns the most informative error text recorded for a command
+func reportErrorText(record *database.CommandRecord) string {
+	if text := strings.TrimSpace(record.ErrorOutput); text != "" {
+		return text
+	}
+	return strings.TrimSpace(record.Output)
+}
+
+// toReportCommand converts a history record into a report entry
+func toReportCommand(record *database.CommandRecord) ReportCommand {
+	entry := ReportCommand{
+		Command:    record.Command,
+		ExitCode:   record.ExitCode,
+		DurationMs: record.Duration,
+		WorkingDir: record.WorkingDir,
+		Timestamp:  record.Timestamp.Format(time.RFC3339),
+	}
+
+	if !record.Success {
+		snippet := reportErrorText(record)
+		if len(snippet) > reportErrorSnippetLength {
+			snippet = utils.TruncateHead(snippet, reportErrorSnippetLength) + "..."
+		}
+		entry.ErrorSnippet = snippet
+	}
+
+	return entry
+}
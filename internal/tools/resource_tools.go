@@ -3,11 +3,14 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // GetResourceStatusArgs represents the arguments for getting resource status
@@ -187,11 +190,12 @@ type ForceCleanupArgs struct {
 
 // ForceCleanupResult represents the result of forcing resource cleanup
 type ForceCleanupResult struct {
-	Status         string                 `json:"status"`
-	Message        string                 `json:"message"`
-	CleanupActions []string               `json:"cleanup_actions"`
-	BeforeMetrics  map[string]interface{} `json:"before_metrics"`
-	AfterMetrics   map[string]interface{} `json:"after_metrics"`
+	Status         string                  `json:"status"`
+	Message        string                  `json:"message"`
+	CleanupActions []string                `json:"cleanup_actions"`
+	BeforeMetrics  map[string]interface{}  `json:"before_metrics"`
+	AfterMetrics   map[string]interface{}  `json:"after_metrics"`
+	StuckProcesses []terminal.StuckProcess `json:"stuck_processes,omitempty"` // Processes that survived SIGKILL and are not reaped yet
 }
 
 // ForceCleanup performs aggressive resource cleanup to address potential leaks
@@ -252,6 +256,7 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 		// Terminate all background processes
 		sessions := t.manager.ListSessions()
 		processesTerminated := 0
+		processesStuck := 0
 		terminationErrors := 0
 
 		for _, session := range sessions {
@@ -259,6 +264,11 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 			for processID, process := range session.BackgroundProcesses {
 				if process.IsRunning {
 					if err := t.manager.TerminateBackgroundProcess(session.ID, processID, true); err != nil {
+						var stuckErr *terminal.StuckProcessError
+						if errors.As(err, &stuckErr) {
+							processesStuck++
+							continue
+						}
 						terminationErrors++
 						t.logger.Error("Failed to terminate background process", err, map[string]interface{}{
 							"session_id": session.ID,
@@ -276,6 +286,10 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 		} else {
 			cleanupActions = append(cleanupActions, fmt.Sprintf("Terminated %d background processes", processesTerminated))
 		}
+		if processesStuck > 0 {
+			cleanupActions = append(cleanupActions, fmt.Sprintf("%d background processes did not exit after SIGKILL and are stuck", processesStuck))
+		}
+		cleanupActions = append(cleanupActions, t.reapStuckProcessesAction())
 
 	case "all":
 		resourceMonitor.ForceGC()
@@ -305,6 +319,7 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 		}
 
 		cleanupActions = append(cleanupActions, fmt.Sprintf("Terminated %d background processes", processesTerminated))
+		cleanupActions = append(cleanupActions, t.reapStuckProcessesAction())
 		cleanupActions = append(cleanupActions, fmt.Sprintf("Cleaned up %d inactive sessions", inactiveSessions))
 		cleanupActions = append(cleanupActions, "Full resource cleanup performed")
 
@@ -324,6 +339,10 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 		CleanupActions: cleanupActions,
 		BeforeMetrics:  beforeMetrics,
 		AfterMetrics:   afterMetrics,
+		StuckProcesses: t.manager.StuckProcesses(),
+	}
+	if len(result.StuckProcesses) > 0 {
+		result.Message = fmt.Sprintf("Resource cleanup completed; %d process(es) survived SIGKILL and are still stuck", len(result.StuckProcesses))
 	}
 
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
@@ -346,3 +365,185 @@ func (t *TerminalTools) ForceCleanup(ctx context.Context, req *mcp.CallToolReque
 		Content: content,
 	}, result, nil
 }
+
+// reapStuckProcessesAction retries killing processes that survived SIGKILL and describes the outcome
+func (t *TerminalTools) reapStuckProcessesAction() string {
+	reaped := t.manager.ReapStuckProcesses()
+	return fmt.Sprintf("Reaped %d stuck processes, %d still stuck", reaped, len(t.manager.StuckProcesses()))
+}
+
+// GetDatabasePoolStatsArgs represents the arguments for getting database pool statistics
+type GetDatabasePoolStatsArgs struct{}
+
+// GetDatabasePoolStatsResult represents database connection pool statistics
+type GetDatabasePoolStatsResult struct {
+	MaxOpenConnections int    `json:"max_open_connections"` // Pool limit from database.max_connections
+	OpenConnections    int    `json:"open_connections"`     // In use plus idle
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`    // Queries that had to wait for a free connection
+	WaitDuration       string `json:"wait_duration"` // Total time spent waiting
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+	Message            string `json:"message"`
+}
+
+// GetDatabasePoolStats reports the database connection pool usage so the pool size can be tuned
+func (t *TerminalTools) GetDatabasePoolStats(ctx context.Context, req *mcp.CallToolRequest, args GetDatabasePoolStatsArgs) (*mcp.CallToolResult, GetDatabasePoolStatsResult, error) {
+	if t.database == nil {
+		return createErrorResult("Database is disabled"), GetDatabasePoolStatsResult{}, nil
+	}
+
+	stats := t.database.PoolStats()
+	result := GetDatabasePoolStatsResult{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		Message:            fmt.Sprintf("%d of %d database connections in use", stats.InUse, stats.MaxOpenConnections),
+	}
+	if stats.WaitCount > 0 {
+		result.Message += fmt.Sprintf("; %d queries waited %s for a connection, consider raising max_connections", stats.WaitCount, stats.WaitDuration)
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// CleanupOrphanedRecordsArgs represents the arguments for cleaning up orphaned database records
+type CleanupOrphanedRecordsArgs struct {
+	Confirm bool `json:"confirm,omitempty" jsonschema:"description=Delete the orphaned records; without it they are only counted"`
+}
+
+// CleanupOrphanedRecordsResult reports orphaned command and stream chunk rows
+type CleanupOrphanedRecordsResult struct {
+	Found   database.OrphanedRecords  `json:"found"`
+	Deleted *database.OrphanedRecords `json:"deleted,omitempty"` // Set when confirm was true
+	Message string                    `json:"message"`
+}
+
+// CleanupOrphanedRecords finds command and stream chunk rows whose session no longer exists and,
+// with confirm, deletes them
+func (t *TerminalTools) CleanupOrphanedRecords(ctx context.Context, req *mcp.CallToolRequest, args CleanupOrphanedRecordsArgs) (*mcp.CallToolResult, CleanupOrphanedRecordsResult, error) {
+	if t.database == nil {
+		return createErrorResult("Database is disabled"), CleanupOrphanedRecordsResult{}, nil
+	}
+
+	found, err := t.database.FindOrphanedRecords()
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to find orphaned records: %v", err)), CleanupOrphanedRecordsResult{}, nil
+	}
+	result := CleanupOrphanedRecordsResult{Found: *found}
+
+	switch {
+	case found.Commands == 0 && found.StreamChunks == 0:
+		result.Message = "No orphaned records found"
+	case !args.Confirm:
+		result.Message = fmt.Sprintf("Found %d orphaned commands and %d orphaned stream chunks; set confirm=true to delete them", found.Commands, found.StreamChunks)
+	default:
+		deleted, err := t.database.DeleteOrphanedRecords()
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to delete orphaned records: %v", err)), result, nil
+		}
+		result.Deleted = deleted
+		result.Message = fmt.Sprintf("Deleted %d orphaned commands and %d orphaned stream chunks", deleted.Commands, deleted.StreamChunks)
+
+		t.logger.Info("Orphaned database records deleted", map[string]interface{}{
+			"commands":      deleted.Commands,
+			"stream_chunks": deleted.StreamChunks,
+		})
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// CheckpointWALArgs represents the arguments for checkpointing the database WAL
+type CheckpointWALArgs struct{}
+
+// CheckpointWALResult reports a WAL checkpoint and the space it reclaimed
+type CheckpointWALResult struct {
+	database.WALCheckpoint
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+	Interval       string `json:"interval"` // How often the checkpoint also runs automatically ("0s" when disabled)
+	Message        string `json:"message"`
+}
+
+// CheckpointWAL copies the database write-ahead log back into the database and truncates it
+func (t *TerminalTools) CheckpointWAL(ctx context.Context, req *mcp.CallToolRequest, args CheckpointWALArgs) (*mcp.CallToolResult, CheckpointWALResult, error) {
+	if t.database == nil {
+		return createErrorResult("Database is disabled"), CheckpointWALResult{}, nil
+	}
+
+	checkpoint, err := t.database.CheckpointWAL(ctx)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to checkpoint WAL: %v", err)), CheckpointWALResult{}, nil
+	}
+
+	result := CheckpointWALResult{
+		WALCheckpoint:  *checkpoint,
+		ReclaimedBytes: max(checkpoint.SizeBeforeBytes-checkpoint.SizeAfterBytes, 0),
+		Interval:       t.config.Database.WALCheckpointInterval.String(),
+	}
+	if checkpoint.Busy {
+		result.Message = fmt.Sprintf("Checkpointed %d of %d WAL frames, but the WAL could not be truncated while other connections were using it; try again later", checkpoint.CheckpointedFrames, checkpoint.LogFrames)
+	} else {
+		result.Message = fmt.Sprintf("Checkpointed %d WAL frames and truncated the WAL from %d to %d bytes", checkpoint.CheckpointedFrames, checkpoint.SizeBeforeBytes, checkpoint.SizeAfterBytes)
+	}
+
+	t.logger.Info("Database WAL checkpointed", map[string]interface{}{
+		"busy":                checkpoint.Busy,
+		"checkpointed_frames": checkpoint.CheckpointedFrames,
+		"size_before_bytes":   checkpoint.SizeBeforeBytes,
+		"size_after_bytes":    checkpoint.SizeAfterBytes,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// PauseCleanupArgs represents the arguments for pausing the automatic cleanup routines
+type PauseCleanupArgs struct {
+	DurationSeconds int    `json:"duration_seconds" jsonschema:"required,description=How long to pause cleanup before it resumes on its own (capped by max_cleanup_pause)"`
+	Reason          string `json:"reason,omitempty" jsonschema:"description=Why cleanup is paused, recorded in the logs"`
+}
+
+// ResumeCleanupArgs represents the arguments for resuming the automatic cleanup routines
+type ResumeCleanupArgs struct{}
+
+// CleanupPauseResult represents the cleanup pause state after a pause or resume
+type CleanupPauseResult struct {
+	terminal.CleanupPauseStatus
+	MaxPause string `json:"max_pause"`
+	Message  string `json:"message"`
+}
+
+// PauseCleanup suspends automatic session and resource cleanup so a bulk operation is not interrupted
+func (t *TerminalTools) PauseCleanup(ctx context.Context, req *mcp.CallToolRequest, args PauseCleanupArgs) (*mcp.CallToolResult, CleanupPauseResult, error) {
+	status, err := t.manager.PauseCleanup(time.Duration(args.DurationSeconds)*time.Second, args.Reason)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to pause cleanup: %v", err)), CleanupPauseResult{}, nil
+	}
+
+	result := CleanupPauseResult{
+		CleanupPauseStatus: status,
+		MaxPause:           t.config.Session.MaxCleanupPause.String(),
+		Message:            fmt.Sprintf("Automatic cleanup paused until %s; call resume_cleanup when the bulk operation finishes", status.Until),
+	}
+	return createJSONResult(result), result, nil
+}
+
+// ResumeCleanup lifts a cleanup pause before it expires
+func (t *TerminalTools) ResumeCleanup(ctx context.Context, req *mcp.CallToolRequest, args ResumeCleanupArgs) (*mcp.CallToolResult, CleanupPauseResult, error) {
+	result := CleanupPauseResult{
+		MaxPause: t.config.Session.MaxCleanupPause.String(),
+		Message:  "Automatic cleanup was not paused",
+	}
+	if t.manager.ResumeCleanup() {
+		result.Message = "Automatic cleanup resumed"
+	}
+	return createJSONResult(result), result, nil
+}
@@ -12,34 +12,40 @@ import (
 
 // F6: SearchOutputArgs represents arguments for searching command output
 type SearchOutputArgs struct {
-	SessionID      string `json:"session_id,omitempty" jsonschema:"description=Search outputs in a specific session"`
+	SessionID      string `json:"session_id,omitempty" jsonschema:"description=Search outputs in a specific session; omit to search across all sessions"`
 	ProjectID      string `json:"project_id,omitempty" jsonschema:"description=Search outputs in a specific project"`
 	Pattern        string `json:"pattern" jsonschema:"required,description=Text or regex pattern to search for in command outputs"`
 	IsRegex        bool   `json:"is_regex,omitempty" jsonschema:"description=Treat pattern as regular expression"`
 	CaseSensitive  bool   `json:"case_sensitive,omitempty" jsonschema:"description=Case sensitive search (default: false)"`
 	MaxResults     int    `json:"max_results,omitempty" jsonschema:"description=Maximum number of results to return (default: 50)"`
 	IncludeContext int    `json:"include_context,omitempty" jsonschema:"description=Number of lines of context around match (default: 2)"`
+	SortBy         string `json:"sort_by,omitempty" jsonschema:"description=Result order: recency (newest commands first, the default) or relevance (commands with the most matching lines first)"`
 }
 
 // SearchOutputMatch represents a single match in the output
 type SearchOutputMatch struct {
 	CommandID   string   `json:"command_id"`
 	SessionID   string   `json:"session_id"`
+	SessionName string   `json:"session_name,omitempty"` // Empty once the session has been closed
+	ProjectID   string   `json:"project_id,omitempty"`
 	Command     string   `json:"command"`
 	LineNumber  int      `json:"line_number"`
 	MatchedText string   `json:"matched_text"`
 	Context     []string `json:"context,omitempty"`
 	Timestamp   string   `json:"timestamp"`
+	LineMatches int      `json:"line_matches"` // Matching lines in this command's output, the relevance score
 }
 
 // SearchOutputResult represents the result of searching outputs
 type SearchOutputResult struct {
-	Pattern      string              `json:"pattern"`
-	IsRegex      bool                `json:"is_regex"`
-	TotalMatches int                 `json:"total_matches"`
-	Matches      []SearchOutputMatch `json:"matches"`
-	SearchTime   string              `json:"search_time"`
-	Truncated    bool                `json:"truncated"`
+	Pattern         string              `json:"pattern"`
+	IsRegex         bool                `json:"is_regex"`
+	SortBy          string              `json:"sort_by,omitempty"`
+	TotalMatches    int                 `json:"total_matches"`
+	SessionsMatched int                 `json:"sessions_matched"` // Distinct sessions with at least one match
+	Matches         []SearchOutputMatch `json:"matches"`
+	SearchTime      string              `json:"search_time"`
+	Truncated       bool                `json:"truncated"`
 }
 
 // SearchOutput searches through command outputs for a pattern
@@ -110,6 +116,7 @@ func (t *TerminalTools) SearchOutput(ctx context.Context, req *mcp.CallToolReque
 		nil,         // any success status
 		time.Time{}, // no start time
 		time.Time{}, // no end time
+		nil,         // any tags
 		500,         // get more commands to search through
 	)
 	if err != nil {
@@ -0,0 +1,149 @@
+// Package tools provides MCP tool handlers for auditing the runtime security policy against the config file
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/config"
+)
+
+// --- Security Policy Diff Types ---
+
+// SecurityListDiff lists entries the runtime policy has beyond, or is missing from, the config file
+type SecurityListDiff struct {
+	Added   []string `json:"added,omitempty"`   // In the runtime policy only
+	Removed []string `json:"removed,omitempty"` // In the config file only
+}
+
+// SecuritySettingChange is a scalar security setting whose runtime value differs from the config file
+type SecuritySettingChange struct {
+	Setting string      `json:"setting"`
+	Runtime interface{} `json:"runtime"`
+	File    interface{} `json:"file"`
+}
+
+// DiffSecurityPolicyArgs represents arguments for diffing the runtime security policy
+type DiffSecurityPolicyArgs struct {
+	Persist bool `json:"persist,omitempty" jsonschema:"description=Write the runtime security policy back to the config file"`
+	Confirm bool `json:"confirm,omitempty" jsonschema:"description=Must be true together with persist to overwrite the config file"`
+}
+
+// DiffSecurityPolicyResult represents the differences between the runtime and configured security policy
+type DiffSecurityPolicyResult struct {
+	ConfigFile         string                  `json:"config_file"`
+	InSync             bool                    `json:"in_sync"`
+	BlockedCommands    SecurityListDiff        `json:"blocked_commands"`
+	AllowedCommands    SecurityListDiff        `json:"allowed_commands"`
+	AllowedWorkingDirs SecurityListDiff        `json:"allowed_working_dirs"`
+	ChangedSettings    []SecuritySettingChange `json:"changed_settings,omitempty"`
+	Persisted          bool                    `json:"persisted"`
+	Message            string                  `json:"message"`
+}
+
+// --- Diff Helpers ---
+
+// diffStringLists returns the entries only in runtime (added) and only in file (removed)
+func diffStringLists(runtime, file []string) SecurityListDiff {
+	inRuntime := make(map[string]bool, len(runtime))
+	for _, entry := range runtime {
+		inRuntime[entry] = true
+	}
+	inFile := make(map[string]bool, len(file))
+	for _, entry := range file {
+		inFile[entry] = true
+	}
+
+	var diff SecurityListDiff
+	for entry := range inRuntime {
+		if !inFile[entry] {
+			diff.Added = append(diff.Added, entry)
+		}
+	}
+	for entry := range inFile {
+		if !inRuntime[entry] {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// diffSecuritySettings compares the scalar security settings
+func diffSecuritySettings(runtime, file config.SecurityConfig) []SecuritySettingChange {
+	settings := []SecuritySettingChange{
+		{Setting: "enable_sandbox", Runtime: runtime.EnableSandbox, File: file.EnableSandbox},
+		{Setting: "allow_network_access", Runtime: runtime.AllowNetworkAccess, File: file.AllowNetworkAccess},
+		{Setting: "allow_filesystem_write", Runtime: runtime.AllowFileSystemWrite, File: file.AllowFileSystemWrite},
+		{Setting: "max_processes", Runtime: runtime.MaxProcesses, File: file.MaxProcesses},
+		{Setting: "max_memory_mb", Runtime: runtime.MaxMemoryMB, File: file.MaxMemoryMB},
+		{Setting: "max_cpu_percent", Runtime: runtime.MaxCPUPercent, File: file.MaxCPUPercent},
+		{Setting: "log_decisions", Runtime: runtime.LogDecisions, File: file.LogDecisions},
+		{Setting: "blocked_history_limit", Runtime: runtime.BlockedHistoryLimit, File: file.BlockedHistoryLimit},
+	}
+
+	var changed []SecuritySettingChange
+	for _, setting := range settings {
+		if setting.Runtime != setting.File {
+			changed = append(changed, setting)
+		}
+	}
+	return changed
+}
+
+// --- MCP Tool Handlers ---
+
+// DiffSecurityPolicy compares the security policy the server is enforcing with the one in its config file,
+// optionally writing the runtime policy back to the file
+func (t *TerminalTools) DiffSecurityPolicy(ctx context.Context, req *mcp.CallToolRequest, args DiffSecurityPolicyArgs) (*mcp.CallToolResult, DiffSecurityPolicyResult, error) {
+	if t.config.SourceFile == "" {
+		return createErrorResult("The server was not started from a config file, so there is nothing to compare against"), DiffSecurityPolicyResult{}, nil
+	}
+	if args.Persist && !args.Confirm {
+		return createErrorResult("Persisting overwrites the config file's security section; set confirm=true to proceed"), DiffSecurityPolicyResult{}, nil
+	}
+
+	fileConfig, err := config.LoadFile(t.config.SourceFile)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to read config file %s: %v", t.config.SourceFile, err)), DiffSecurityPolicyResult{}, nil
+	}
+
+	runtime := t.config.Security
+	result := DiffSecurityPolicyResult{
+		ConfigFile:         t.config.SourceFile,
+		BlockedCommands:    diffStringLists(runtime.BlockedCommands, fileConfig.Security.BlockedCommands),
+		AllowedCommands:    diffStringLists(runtime.AllowedCommands, fileConfig.Security.AllowedCommands),
+		AllowedWorkingDirs: diffStringLists(runtime.AllowedWorkingDirs, fileConfig.Security.AllowedWorkingDirs),
+		ChangedSettings:    diffSecuritySettings(runtime, fileConfig.Security),
+	}
+
+	differences := len(result.ChangedSettings)
+	for _, diff := range []SecurityListDiff{result.BlockedCommands, result.AllowedCommands, result.AllowedWorkingDirs} {
+		differences += len(diff.Added) + len(diff.Removed)
+	}
+	result.InSync = differences == 0
+	result.Message = fmt.Sprintf("Runtime security policy differs from %s in %d place(s)", t.config.SourceFile, differences)
+	if result.InSync {
+		result.Message = fmt.Sprintf("Runtime security policy matches %s", t.config.SourceFile)
+	}
+
+	if args.Persist && !result.InSync {
+		// Only the file's "security" key is replaced; its other keys are kept verbatim, without the
+		// defaults LoadFile filled in
+		if err := config.SaveSecurityToFile(t.config.SourceFile, runtime); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to write config file %s: %v", t.config.SourceFile, err)), result, nil
+		}
+		result.Persisted = true
+		result.Message = fmt.Sprintf("Runtime security policy written to %s (%d difference(s) resolved)", t.config.SourceFile, differences)
+
+		t.logger.LogSecurityEvent("security_policy_persisted", "Runtime security policy written to config file", "medium", map[string]interface{}{
+			"config_file": t.config.SourceFile,
+			"differences": differences,
+		})
+	}
+
+	return createJSONResult(result), result, nil
+}
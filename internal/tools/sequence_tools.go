@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// RunCommandsArgs represents arguments for running an ordered list of commands in one session
+type RunCommandsArgs struct {
+	SessionID     string   `json:"session_id" jsonschema:"required,description=Session to run the commands in"`
+	Commands      []string `json:"commands" jsonschema:"required,description=Commands to run in order, e.g. npm ci, npm run build, npm test"`
+	StopOnFailure bool     `json:"stop_on_failure,omitempty" jsonschema:"description=Skip the remaining commands after the first one that fails"`
+	Timeout       int      `json:"timeout,omitempty" jsonschema:"description=Per-command timeout in seconds (default 60, max 300)"`
+}
+
+// CommandStepOutcome reports the result of one command in a sequence
+type CommandStepOutcome struct {
+	Index   int               `json:"index"`
+	Command string            `json:"command"`
+	Status  string            `json:"status"` // succeeded, failed, or skipped
+	Error   string            `json:"error,omitempty"`
+	Result  *RunCommandResult `json:"result,omitempty"`
+}
+
+// RunCommandsResult represents the aggregate result of a command sequence
+type RunCommandsResult struct {
+	SessionID     string               `json:"session_id"`
+	Success       bool                 `json:"success"` // Every command ran and succeeded
+	Total         int                  `json:"total"`
+	Succeeded     int                  `json:"succeeded"`
+	Failed        int                  `json:"failed"`
+	Skipped       int                  `json:"skipped"`
+	StopOnFailure bool                 `json:"stop_on_failure"`
+	CurrentDir    string               `json:"current_dir"` // Session directory after the sequence, following any cd
+	Duration      string               `json:"duration"`
+	Results       []CommandStepOutcome `json:"results"`
+	Message       string               `json:"message"`
+}
+
+// RunCommands runs commands one after another in a session, so each gets the usual validation and
+// history and a cd in one step carries over to the next. The batch counts once against the rate
+// limit, so a long sequence is not cut short by the session's burst.
+func (t *TerminalTools) RunCommands(ctx context.Context, req *mcp.CallToolRequest, args RunCommandsArgs) (*mcp.CallToolResult, RunCommandsResult, error) {
+	if len(args.Commands) == 0 {
+		return createErrorResult("commands must list at least one command"), RunCommandsResult{}, nil
+	}
+	if maxCommands := t.config.Session.MaxSequenceCommands; len(args.Commands) > maxCommands {
+		return createErrorResult(fmt.Sprintf("commands lists %d commands, more than the maximum of %d. Tip: Split the sequence into several run_commands calls.", len(args.Commands), maxCommands)), RunCommandsResult{}, nil
+	}
+	for i, command := range args.Commands {
+		if strings.TrimSpace(command) == "" {
+			return createErrorResult(fmt.Sprintf("commands[%d] is empty", i)), RunCommandsResult{}, nil
+		}
+	}
+	if _, err := t.manager.GetSession(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v. Tip: Use 'list_terminal_sessions' to see all available sessions and their IDs.", err)), RunCommandsResult{}, nil
+	}
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), RunCommandsResult{}, nil
+	}
+
+	startTime := time.Now()
+	outcomes := make([]CommandStepOutcome, len(args.Commands))
+	failed := false
+	for i, command := range args.Commands {
+		outcomes[i] = CommandStepOutcome{Index: i, Command: command}
+		if failed && args.StopOnFailure {
+			outcomes[i].Status = "skipped"
+			outcomes[i].Error = "skipped after an earlier failure"
+			continue
+		}
+
+		callResult, runResult, _ := t.runCommand(ctx, req, RunCommandArgs{
+			SessionID: args.SessionID,
+			Command:   command,
+			Timeout:   args.Timeout,
+		}, false)
+		outcomes[i].Status, outcomes[i].Error, outcomes[i].Result = classifyRunCommand(callResult, runResult)
+		failed = failed || outcomes[i].Status == "failed"
+	}
+
+	result := RunCommandsResult{
+		SessionID:     args.SessionID,
+		Total:         len(outcomes),
+		StopOnFailure: args.StopOnFailure,
+		Duration:      time.Since(startTime).String(),
+		Results:       outcomes,
+	}
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case "succeeded":
+			result.Succeeded++
+		case "failed":
+			result.Failed++
+		default:
+			result.Skipped++
+		}
+	}
+	result.Success = result.Succeeded == result.Total
+	if session, err := t.manager.GetSession(args.SessionID); err == nil {
+		result.CurrentDir = session.GetCurrentDir()
+	}
+	result.Message = fmt.Sprintf("Ran %d command(s): %d succeeded, %d failed, %d skipped",
+		result.Total, result.Succeeded, result.Failed, result.Skipped)
+
+	t.logger.Info("Command sequence executed", map[string]interface{}{
+		"session_id":      args.SessionID,
+		"commands":        result.Total,
+		"succeeded":       result.Succeeded,
+		"failed":          result.Failed,
+		"skipped":         result.Skipped,
+		"stop_on_failure": args.StopOnFailure,
+	})
+
+	return createJSONResult(result), result, nil
+}
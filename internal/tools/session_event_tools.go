@@ -0,0 +1,132 @@
+// Package tools provides MCP tool handlers for reviewing session lifecycle events
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/database"
+)
+
+// --- Session Event Types ---
+
+// SessionEventEntry is one recorded session lifecycle event
+type SessionEventEntry struct {
+	SessionID   string                 `json:"session_id"`
+	SessionName string                 `json:"session_name"`
+	ProjectID   string                 `json:"project_id"`
+	Event       string                 `json:"event"`
+	Reason      string                 `json:"reason,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Timestamp   string                 `json:"timestamp"` // RFC3339 formatted string
+}
+
+// GetSessionEventsArgs represents arguments for listing session lifecycle events
+type GetSessionEventsArgs struct {
+	SessionID string `json:"session_id,omitempty" jsonschema:"description=Only return events of this session"`
+	ProjectID string `json:"project_id,omitempty" jsonschema:"description=Only return events of sessions in this project"`
+	Event     string `json:"event,omitempty" jsonschema:"description=Only return this event: created, closed or cleaned_up"`
+	Reason    string `json:"reason,omitempty" jsonschema:"description=Only return events with this reason, e.g. inactive_timeout"`
+	StartTime string `json:"start_time,omitempty" jsonschema:"description=Only return events at or after this time (ISO 8601 format: 2006-01-02T15:04:05Z)"`
+	EndTime   string `json:"end_time,omitempty" jsonschema:"description=Only return events at or before this time (ISO 8601 format: 2006-01-02T15:04:05Z)"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"description=Maximum number of events to return, newest first (default: 50, max: 500)"`
+}
+
+// GetSessionEventsResult represents recorded session lifecycle events
+type GetSessionEventsResult struct {
+	Events      []SessionEventEntry `json:"events"`
+	Count       int                 `json:"count"`
+	EventCounts map[string]int      `json:"event_counts"`
+	Enabled     bool                `json:"enabled"`             // Whether new events are being recorded
+	Retention   string              `json:"retention,omitempty"` // How long events are kept
+	Message     string              `json:"message"`
+}
+
+// validSessionEvents are the events the terminal manager records
+var validSessionEvents = map[string]bool{
+	"created":    true,
+	"closed":     true,
+	"cleaned_up": true,
+	"relocated":  true,
+}
+
+// --- MCP Tool Handlers ---
+
+// GetSessionEvents returns recorded session lifecycle events matching the filters
+func (t *TerminalTools) GetSessionEvents(ctx context.Context, req *mcp.CallToolRequest, args GetSessionEventsArgs) (*mcp.CallToolResult, GetSessionEventsResult, error) {
+	if t.database == nil {
+		return createErrorResult("Session events are not available: database is not configured"), GetSessionEventsResult{}, nil
+	}
+
+	if args.SessionID != "" {
+		if err := validateSessionID(args.SessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), GetSessionEventsResult{}, nil
+		}
+	}
+	if args.Event != "" && !validSessionEvents[args.Event] {
+		return createErrorResult(fmt.Sprintf("Invalid event %q: must be created, closed or cleaned_up", args.Event)), GetSessionEventsResult{}, nil
+	}
+
+	filter := database.SessionEventFilter{
+		SessionID: args.SessionID,
+		ProjectID: args.ProjectID,
+		Event:     args.Event,
+		Reason:    args.Reason,
+		Limit:     args.Limit,
+	}
+	if args.StartTime != "" {
+		since, err := time.Parse(time.RFC3339, args.StartTime)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid start_time format. Use ISO 8601 format: %s. Example: %s", time.RFC3339, time.Now().Add(-24*time.Hour).Format(time.RFC3339))), GetSessionEventsResult{}, nil
+		}
+		filter.Since = since
+	}
+	if args.EndTime != "" {
+		until, err := time.Parse(time.RFC3339, args.EndTime)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid end_time format. Use ISO 8601 format: %s. Example: %s", time.RFC3339, time.Now().Format(time.RFC3339))), GetSessionEventsResult{}, nil
+		}
+		filter.Until = until
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultSessionEventsLimit
+	}
+	if filter.Limit > MaxSessionEventsLimit {
+		filter.Limit = MaxSessionEventsLimit
+	}
+
+	records, err := t.database.GetSessionEvents(filter)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to get session events: %v", err)), GetSessionEventsResult{}, nil
+	}
+
+	result := GetSessionEventsResult{
+		Events:      make([]SessionEventEntry, 0, len(records)),
+		EventCounts: make(map[string]int),
+		Enabled:     t.config.Database.SessionEvents,
+	}
+	if result.Enabled {
+		result.Retention = t.config.Database.SessionEventRetention.String()
+	}
+	for _, record := range records {
+		result.Events = append(result.Events, SessionEventEntry{
+			SessionID:   record.SessionID,
+			SessionName: record.SessionName,
+			ProjectID:   record.ProjectID,
+			Event:       record.Event,
+			Reason:      record.Reason,
+			Details:     record.Details,
+			Timestamp:   record.Timestamp.Format(time.RFC3339),
+		})
+		result.EventCounts[record.Event]++
+	}
+	result.Count = len(result.Events)
+	result.Message = fmt.Sprintf("Found %d session events", result.Count)
+	if !result.Enabled {
+		result.Message += " (recording is disabled; set database.session_events to enable it)"
+	}
+
+	return createJSONResult(result), result, nil
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"sort"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // CreateSession creates a new terminal session with project association and comprehensive documentation
 func (t *TerminalTools) CreateSession(ctx context.Context, req *mcp.CallToolRequest, args CreateSessionArgs) (*mcp.CallToolResult, CreateSessionResult, error) {
 	// H2: Check rate limit first
-	if err := t.CheckRateLimit(); err != nil {
+	if err := t.CheckProjectRateLimit(args.ProjectID); err != nil {
 		return createErrorResult(err.Error()), CreateSessionResult{}, nil
 	}
 
@@ -21,7 +25,7 @@ func (t *TerminalTools) CreateSession(ctx context.Context, req *mcp.CallToolRequ
 	}
 
 	// Create session with simplified API - let session manager handle workspace detection and project ID generation
-	session, err := t.manager.CreateSession(args.Name, args.ProjectID, args.WorkingDir)
+	session, err := t.manager.CreateSessionWithPolicy(args.Name, args.ProjectID, args.WorkingDir, args.SecurityPolicy)
 	if err != nil {
 		t.logger.Error("Failed to create session", err, map[string]interface{}{
 			"session_name": args.Name,
@@ -30,19 +34,30 @@ func (t *TerminalTools) CreateSession(ctx context.Context, req *mcp.CallToolRequ
 		})
 		return createErrorResult(fmt.Sprintf("Failed to create session: %v", err)), CreateSessionResult{}, nil
 	}
+	if args.AutoCreateDirs {
+		if err := t.manager.SetSessionAutoCreateDirs(session.ID, true); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to enable auto_create_dirs: %v", err)), CreateSessionResult{}, nil
+		}
+	}
 
 	// Parse project ID for detailed information
 	projectInfo := t.projectGen.ParseProjectID(session.ProjectID)
 	instructions := t.projectGen.GetProjectIDInstructions()
 
 	result := CreateSessionResult{
-		SessionID:    session.ID,
-		Name:         session.Name,
-		ProjectID:    session.ProjectID,
-		WorkingDir:   session.WorkingDir,
-		Message:      fmt.Sprintf("Terminal session '%s' created successfully with ID: %s in project: %s", session.Name, session.ID, session.ProjectID),
-		ProjectInfo:  projectInfo,
-		Instructions: instructions,
+		SessionID:      session.ID,
+		Name:           session.Name,
+		ProjectID:      session.ProjectID,
+		WorkingDir:     session.GetWorkingDir(),
+		SecurityPolicy: session.SecurityPolicy,
+		AutoCreateDirs: args.AutoCreateDirs,
+		Message:        fmt.Sprintf("Terminal session '%s' created successfully with ID: %s in project: %s", session.Name, session.ID, session.ProjectID),
+		ProjectInfo:    projectInfo,
+		Instructions:   instructions,
+	}
+	if session.Name != args.Name {
+		result.RequestedName = args.Name
+		result.Message += fmt.Sprintf(" (renamed from '%s', which the project already uses)", args.Name)
 	}
 
 	// Create comprehensive response with usage instructions
@@ -54,9 +69,10 @@ func (t *TerminalTools) CreateSession(ctx context.Context, req *mcp.CallToolRequ
 	}
 
 	t.logger.Info("Session created successfully", map[string]interface{}{
-		"session_id":  session.ID,
-		"project_id":  session.ProjectID,
-		"working_dir": session.WorkingDir,
+		"session_id":      session.ID,
+		"project_id":      session.ProjectID,
+		"working_dir":     session.GetWorkingDir(),
+		"security_policy": session.SecurityPolicy != nil,
 	})
 
 	return &mcp.CallToolResult{
@@ -65,11 +81,166 @@ func (t *TerminalTools) CreateSession(ctx context.Context, req *mcp.CallToolRequ
 	}, result, nil
 }
 
+// CloneSession creates a session with the working directory, current directory, environment,
+// shell options, aliases and security policy of an existing one, but a fresh ID and shell and no
+// background processes or history, e.g. to run tests next to a dev server
+func (t *TerminalTools) CloneSession(ctx context.Context, req *mcp.CallToolRequest, args CloneSessionArgs) (*mcp.CallToolResult, CloneSessionResult, error) {
+	if err := validateSessionID(args.SourceSessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid source session ID: %v. Tip: Use 'list_terminal_sessions' to find valid session IDs.", err)), CloneSessionResult{}, nil
+	}
+	source, err := t.manager.GetSession(args.SourceSessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v. Tip: Use 'list_terminal_sessions' to see all available sessions and their IDs.", err)), CloneSessionResult{}, nil
+	}
+	if err := t.CheckProjectRateLimit(source.ProjectID); err != nil {
+		return createErrorResult(err.Error()), CloneSessionResult{}, nil
+	}
+	if args.Name != "" {
+		if err := validateSessionName(args.Name); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid session name: %v. Tip: Session names should be 3-100 characters, alphanumeric with underscores and hyphens only.", err)), CloneSessionResult{}, nil
+		}
+	}
+
+	clone, err := t.manager.CloneSession(args.SourceSessionID, args.Name)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to clone session: %v", err)), CloneSessionResult{}, nil
+	}
+
+	cloneEnv := clone.GetAllEnvironment()
+	aliases, _ := t.manager.GetSessionAliases(clone.ID)
+	result := CloneSessionResult{
+		SourceSessionID:    source.ID,
+		SessionID:          clone.ID,
+		Name:               clone.Name,
+		ProjectID:          clone.ProjectID,
+		WorkingDir:         clone.GetWorkingDir(),
+		CurrentDir:         clone.GetCurrentDir(),
+		EnvironmentCopied:  len(cloneEnv),
+		EnvironmentMatches: maps.Equal(source.GetAllEnvironment(), cloneEnv),
+		ShellOptions:       clone.GetShellOptions(),
+		AliasesCopied:      len(aliases),
+		SecurityPolicy:     clone.SecurityPolicy,
+		Message:            fmt.Sprintf("Session '%s' (%s) cloned from %s with %d environment variables", clone.Name, clone.ID, source.ID, len(cloneEnv)),
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// RelocateSession moves a session to a new working directory after its project was moved,
+// keeping its environment and history, and optionally restarts its background processes there
+func (t *TerminalTools) RelocateSession(ctx context.Context, req *mcp.CallToolRequest, args RelocateSessionArgs) (*mcp.CallToolResult, RelocateSessionResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v. Tip: Use 'list_terminal_sessions' to find valid session IDs.", err)), RelocateSessionResult{}, nil
+	}
+	if args.NewWorkingDir == "" {
+		return createErrorResult("new_working_dir is required"), RelocateSessionResult{}, nil
+	}
+	if args.RestartBackground && !args.Confirm {
+		return createErrorResult("Restarting background processes requires confirmation. Set 'confirm' to true. Tip: Without restart_background the session moves and its processes keep running where they are."), RelocateSessionResult{}, nil
+	}
+
+	relocation, err := t.manager.RelocateSession(args.SessionID, args.NewWorkingDir, args.RestartBackground, args.Force)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to relocate session: %v", err)), RelocateSessionResult{}, nil
+	}
+
+	result := RelocateSessionResult{
+		SessionID:     relocation.SessionID,
+		OldWorkingDir: relocation.OldWorkingDir,
+		NewWorkingDir: relocation.NewWorkingDir,
+		OldCurrentDir: relocation.OldCurrentDir,
+		NewCurrentDir: relocation.NewCurrentDir,
+		Restarted:     relocatedProcesses(relocation.Restarted),
+		NotMoved:      relocatedProcesses(relocation.NotMoved),
+		Message:       fmt.Sprintf("Session moved from %s to %s", relocation.OldWorkingDir, relocation.NewWorkingDir),
+	}
+	if len(result.Restarted) > 0 || len(result.NotMoved) > 0 {
+		result.Message += fmt.Sprintf("; %d background process(es) restarted, %d left running where they were", len(result.Restarted), len(result.NotMoved))
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// relocatedProcesses converts the manager's process relocations for the tool result
+func relocatedProcesses(processes []terminal.ProcessRelocation) []RelocatedProcess {
+	converted := make([]RelocatedProcess, len(processes))
+	for i, process := range processes {
+		converted[i] = RelocatedProcess{
+			ProcessID:     process.ProcessID,
+			Command:       process.Command,
+			OldWorkingDir: process.OldWorkingDir,
+			NewWorkingDir: process.NewWorkingDir,
+			OldPID:        process.OldPID,
+			NewPID:        process.NewPID,
+			Reason:        process.Reason,
+		}
+	}
+	return converted
+}
+
+// sessionSortFuncs maps ListSessions sort_by values to "sorts before" comparisons
+var sessionSortFuncs = map[string]func(a, b *terminal.Session) bool{
+	"by_commands": func(a, b *terminal.Session) bool {
+		return a.CommandCount > b.CommandCount
+	},
+	"by_failures": func(a, b *terminal.Session) bool {
+		return a.CommandCount-a.SuccessCount > b.CommandCount-b.SuccessCount
+	},
+	"by_last_used": func(a, b *terminal.Session) bool {
+		return a.LastUsedAt.After(b.LastUsedAt)
+	},
+	"by_idle": func(a, b *terminal.Session) bool {
+		return a.LastUsedAt.Before(b.LastUsedAt)
+	},
+}
+
 // ListSessions lists all terminal sessions with enhanced information and statistics
 func (t *TerminalTools) ListSessions(ctx context.Context, req *mcp.CallToolRequest, args ListSessionsArgs) (*mcp.CallToolResult, ListSessionsResult, error) {
+	sortLess, ok := sessionSortFuncs[args.SortBy]
+	if args.SortBy != "" && !ok {
+		return createErrorResult(fmt.Sprintf("Invalid sort_by '%s'. Valid values: by_commands, by_failures, by_last_used, by_idle", args.SortBy)), ListSessionsResult{}, nil
+	}
+
 	sessions := t.manager.ListSessions()
 	stats := t.manager.GetSessionStats()
 
+	// Count running background processes per session
+	runningBackground := make(map[string]int)
+	if allProcesses, err := t.manager.GetAllBackgroundProcesses("", ""); err == nil {
+		for sessionID, processes := range allProcesses {
+			for _, process := range processes {
+				process.Mutex.RLock()
+				if process.IsRunning {
+					runningBackground[sessionID]++
+				}
+				process.Mutex.RUnlock()
+			}
+		}
+	}
+
+	// Apply filters
+	filtered := make([]*terminal.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if args.ActiveOnly && !session.IsActive {
+			continue
+		}
+		if args.HasBackground && runningBackground[session.ID] == 0 {
+			continue
+		}
+		if session.CommandCount < args.MinCommands {
+			continue
+		}
+		filtered = append(filtered, session)
+	}
+	sessions = filtered
+
+	if sortLess != nil {
+		sort.SliceStable(sessions, func(i, j int) bool {
+			return sortLess(sessions[i], sessions[j])
+		})
+	}
+
+	now := time.Now()
 	sessionInfos := make([]SessionInfo, len(sessions))
 	projectStats := make(map[string]ProjectSummary)
 
@@ -80,17 +251,22 @@ func (t *TerminalTools) ListSessions(ctx context.Context, req *mcp.CallToolReque
 		}
 
 		sessionInfos[i] = SessionInfo{
-			ID:            session.ID,
-			Name:          session.Name,
-			ProjectID:     session.ProjectID,
-			WorkingDir:    session.WorkingDir,
-			CreatedAt:     session.CreatedAt.Format("2006-01-02 15:04:05"),
-			LastUsedAt:    session.LastUsedAt.Format("2006-01-02 15:04:05"),
-			IsActive:      session.IsActive,
-			CommandCount:  session.CommandCount,
-			SuccessCount:  session.SuccessCount,
-			SuccessRate:   successRate,
-			TotalDuration: session.TotalDuration.String(),
+			ID:                     session.ID,
+			Name:                   session.Name,
+			ProjectID:              session.ProjectID,
+			WorkingDir:             session.GetWorkingDir(),
+			CreatedAt:              session.CreatedAt.Format("2006-01-02 15:04:05"),
+			LastUsedAt:             session.LastUsedAt.Format("2006-01-02 15:04:05"),
+			IsActive:               session.IsActive,
+			CommandCount:           session.CommandCount,
+			SuccessCount:           session.SuccessCount,
+			SuccessRate:            successRate,
+			TotalDuration:          session.TotalDuration.String(),
+			FailureCount:           session.CommandCount - session.SuccessCount,
+			IdleTime:               now.Sub(session.LastUsedAt).Round(time.Second).String(),
+			BackgroundProcessCount: runningBackground[session.ID],
+			ShellHealthy:           shellHealthy(t.manager, session.ID),
+			SecurityPolicy:         session.SecurityPolicy,
 		}
 
 		// Update project statistics
@@ -128,6 +304,56 @@ func (t *TerminalTools) ListSessions(ctx context.Context, req *mcp.CallToolReque
 	}, result, nil
 }
 
+// shellHealthy reports whether a session's shell is alive, for list_terminal_sessions
+func shellHealthy(manager *terminal.Manager, sessionID string) bool {
+	health, err := manager.CheckSessionHealth(sessionID)
+	return err == nil && health.Healthy
+}
+
+// CheckSessionHealth verifies a session's shell process is alive and its pipes are open,
+// optionally restarting the shell when it is not
+func (t *TerminalTools) CheckSessionHealth(ctx context.Context, req *mcp.CallToolRequest, args CheckSessionHealthArgs) (*mcp.CallToolResult, CheckSessionHealthResult, error) {
+	if err := validateSessionID(args.SessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), CheckSessionHealthResult{}, nil
+	}
+
+	health, err := t.manager.CheckSessionHealth(args.SessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v. Use 'list_terminal_sessions' to see all available sessions.", err)), CheckSessionHealthResult{}, nil
+	}
+
+	result := CheckSessionHealthResult{}
+	if !health.Healthy && args.RestartShell && health.ContextActive {
+		// H2: Check rate limit before changing the session
+		if err := t.CheckRateLimit(args.SessionID); err != nil {
+			return createErrorResult(err.Error()), CheckSessionHealthResult{}, nil
+		}
+
+		oldPID := health.ShellPID
+		health, err = t.manager.RestartSessionShell(args.SessionID)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to restart shell: %v", err)), CheckSessionHealthResult{}, nil
+		}
+		result.Restarted = true
+		result.OldPID = oldPID
+	}
+
+	result.Health = *health
+	result.Usable = health.Healthy
+	switch {
+	case result.Restarted:
+		result.Message = fmt.Sprintf("Shell restarted (PID %d -> %d)", result.OldPID, health.ShellPID)
+	case health.Healthy:
+		result.Message = "Session shell is healthy"
+	case !health.ContextActive:
+		result.Message = "Session has been closed; create a new session"
+	default:
+		result.Message = "Session shell is unhealthy; call again with restart_shell=true to start a fresh shell"
+	}
+
+	return createJSONResult(result), result, nil
+}
+
 // DeleteSession deletes terminal sessions (individual or project-wide) with confirmation
 func (t *TerminalTools) DeleteSession(ctx context.Context, req *mcp.CallToolRequest, args DeleteSessionArgs) (*mcp.CallToolResult, DeleteSessionResult, error) {
 	// Require confirmation
@@ -167,6 +393,7 @@ func (t *TerminalTools) DeleteSession(ctx context.Context, req *mcp.CallToolRequ
 			return createErrorResult(fmt.Sprintf("Failed to delete session: %v", err)), DeleteSessionResult{}, nil
 		}
 
+		t.ForgetSessionRateLimit(args.SessionID)
 		deletedCount = 1
 		message = fmt.Sprintf("Successfully deleted session %s", args.SessionID)
 
@@ -188,6 +415,9 @@ func (t *TerminalTools) DeleteSession(ctx context.Context, req *mcp.CallToolRequ
 			return createErrorResult(fmt.Sprintf("Failed to delete project sessions: %v", err)), DeleteSessionResult{}, nil
 		}
 
+		for _, sessionID := range deletedSessions {
+			t.ForgetSessionRateLimit(sessionID)
+		}
 		deletedCount = len(deletedSessions)
 		if deletedCount == 0 {
 			message = fmt.Sprintf("No sessions found for project %s", args.ProjectID)
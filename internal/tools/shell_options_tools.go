@@ -0,0 +1,114 @@
+// Package tools provides MCP tool handlers for per-session shell options
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+// --- Shell Option Types ---
+
+// GetShellOptionsArgs represents arguments for getting session shell options
+type GetShellOptionsArgs struct {
+	SessionID string `json:"session_id" jsonschema:"description=The session ID to get shell options for"`
+}
+
+// SetShellOptionsArgs represents arguments for setting session shell options
+type SetShellOptionsArgs struct {
+	SessionID string   `json:"session_id" jsonschema:"description=The session ID to set shell options for"`
+	Enable    []string `json:"enable,omitempty" jsonschema:"description=Shell options to enable (set -o), e.g. errexit, pipefail"`
+	Disable   []string `json:"disable,omitempty" jsonschema:"description=Shell options to disable (set +o)"`
+}
+
+// ShellOptionsResult represents the result of shell option operations
+type ShellOptionsResult struct {
+	Success   bool     `json:"success"`
+	SessionID string   `json:"session_id"`
+	Operation string   `json:"operation"`
+	Enabled   []string `json:"enabled"`
+	Available []string `json:"available"`
+	Message   string   `json:"message,omitempty"`
+}
+
+// --- MCP Tool Handlers ---
+
+// GetShellOptions returns the shell options enabled for a session
+func (t *TerminalTools) GetShellOptions(ctx context.Context, req *mcp.CallToolRequest, args GetShellOptionsArgs) (*mcp.CallToolResult, ShellOptionsResult, error) {
+	if args.SessionID == "" {
+		return createErrorResult("session_id is required"), ShellOptionsResult{Operation: "get", Message: "session_id is required"}, nil
+	}
+
+	enabled, err := t.manager.GetSessionShellOptions(args.SessionID)
+	if err != nil {
+		result := ShellOptionsResult{
+			SessionID: args.SessionID,
+			Operation: "get",
+			Message:   err.Error(),
+		}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	result := ShellOptionsResult{
+		Success:   true,
+		SessionID: args.SessionID,
+		Operation: "get",
+		Enabled:   enabled,
+		Available: terminal.KnownShellOptions,
+		Message:   fmt.Sprintf("%d shell option(s) enabled", len(enabled)),
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// SetShellOptions enables or disables shell options for a session; they apply to subsequent commands
+func (t *TerminalTools) SetShellOptions(ctx context.Context, req *mcp.CallToolRequest, args SetShellOptionsArgs) (*mcp.CallToolResult, ShellOptionsResult, error) {
+	// H2: Check rate limit first
+	if err := t.CheckRateLimit(args.SessionID); err != nil {
+		return createErrorResult(err.Error()), ShellOptionsResult{Operation: "set", Message: err.Error()}, nil
+	}
+
+	if args.SessionID == "" {
+		return createErrorResult("session_id is required"), ShellOptionsResult{Operation: "set", Message: "session_id is required"}, nil
+	}
+
+	if len(args.Enable) == 0 && len(args.Disable) == 0 {
+		return createErrorResult("at least one option to enable or disable is required"), ShellOptionsResult{SessionID: args.SessionID, Operation: "set"}, nil
+	}
+
+	options := make(map[string]bool, len(args.Enable)+len(args.Disable))
+	for _, name := range args.Disable {
+		options[name] = false
+	}
+	for _, name := range args.Enable {
+		if _, conflict := options[name]; conflict {
+			msg := fmt.Sprintf("option %q cannot be both enabled and disabled", name)
+			return createErrorResult(msg), ShellOptionsResult{SessionID: args.SessionID, Operation: "set", Message: msg}, nil
+		}
+		options[name] = true
+	}
+
+	enabled, err := t.manager.SetSessionShellOptions(args.SessionID, options)
+	if err != nil {
+		result := ShellOptionsResult{
+			SessionID: args.SessionID,
+			Operation: "set",
+			Available: terminal.KnownShellOptions,
+			Message:   err.Error(),
+		}
+		return createErrorResult(err.Error()), result, nil
+	}
+
+	result := ShellOptionsResult{
+		Success:   true,
+		SessionID: args.SessionID,
+		Operation: "set",
+		Enabled:   enabled,
+		Available: terminal.KnownShellOptions,
+		Message:   fmt.Sprintf("Shell options updated; %d option(s) enabled", len(enabled)),
+	}
+
+	return createJSONResult(result), result, nil
+}
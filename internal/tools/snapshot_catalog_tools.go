@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Snapshot types listed by list_all_snapshots
+const (
+	SnapshotTypeSession   = "session"
+	SnapshotTypeWorkspace = "workspace"
+)
+
+// snapshotRestoreTools names the tool that restores each snapshot type
+var snapshotRestoreTools = map[string]string{
+	SnapshotTypeSession:   "restore_session_snapshot",
+	SnapshotTypeWorkspace: "restore_workspace_snapshot",
+}
+
+// SnapshotSummary describes a snapshot of any type
+type SnapshotSummary struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"` // session or workspace
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	SessionID   string    `json:"session_id,omitempty"`  // Session snapshots: the session it was taken from
+	ProjectID   string    `json:"project_id,omitempty"`  // Session snapshots: the session's project
+	SessionIDs  []string  `json:"session_ids,omitempty"` // Workspace snapshots: the sessions it holds
+	RestoreTool string    `json:"restore_tool"`
+}
+
+// ListAllSnapshotsArgs represents arguments for listing snapshots of every type
+type ListAllSnapshotsArgs struct {
+	Type          string `json:"type,omitempty" jsonschema:"description=Only include snapshots of this type: session or workspace"`
+	SessionID     string `json:"session_id,omitempty" jsonschema:"description=Only include snapshots of this session (workspace snapshots that hold it are included)"`
+	ProjectID     string `json:"project_id,omitempty" jsonschema:"description=Only include snapshots from this project (workspace snapshots with a session in it are included)"`
+	NameContains  string `json:"name_contains,omitempty" jsonschema:"description=Only include snapshots whose name contains this text (case-insensitive)"`
+	CreatedAfter  string `json:"created_after,omitempty" jsonschema:"description=Only include snapshots created at or after this RFC3339 time"`
+	CreatedBefore string `json:"created_before,omitempty" jsonschema:"description=Only include snapshots created at or before this RFC3339 time"`
+	Sort          string `json:"sort,omitempty" jsonschema:"description=Sort by creation time: newest (default) or oldest"`
+}
+
+// ListAllSnapshotsResult represents the result of listing snapshots of every type
+type ListAllSnapshotsResult struct {
+	Snapshots   []SnapshotSummary `json:"snapshots"`
+	Count       int               `json:"count"`         // Snapshots matching the filters
+	TotalCount  int               `json:"total_count"`   // All stored snapshots
+	CountByType map[string]int    `json:"count_by_type"` // Matching snapshots per type
+	TotalByType map[string]int    `json:"total_by_type"` // Stored snapshots per type
+}
+
+// GetSnapshotArgs represents arguments for fetching a snapshot of any type
+type GetSnapshotArgs struct {
+	SnapshotID string `json:"snapshot_id" jsonschema:"required,description=Snapshot ID or name"`
+	Type       string `json:"type,omitempty" jsonschema:"description=Snapshot type when a name is used by both: session or workspace"`
+}
+
+// GetSnapshotResult holds one snapshot; Session or Workspace is set according to Type
+type GetSnapshotResult struct {
+	Type        string             `json:"type"`
+	Summary     SnapshotSummary    `json:"summary"`
+	Session     *SessionSnapshot   `json:"session,omitempty"`
+	Workspace   *WorkspaceSnapshot `json:"workspace,omitempty"`
+	RestoreTool string             `json:"restore_tool"`
+}
+
+// matchesWorkspace reports whether a workspace snapshot satisfies the filter; session and project
+// filters match when any session in the bundle does
+func (f SnapshotFilter) matchesWorkspace(snapshot *WorkspaceSnapshot) bool {
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(snapshot.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && snapshot.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && snapshot.CreatedAt.After(f.CreatedBefore) {
+		return false
+	}
+	if f.SessionID == "" && f.ProjectID == "" {
+		return true
+	}
+	for _, state := range snapshot.Sessions {
+		if (f.SessionID == "" || state.SessionID == f.SessionID) && (f.ProjectID == "" || state.ProjectID == f.ProjectID) {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeSessionSnapshot describes a session snapshot for list_all_snapshots
+func summarizeSessionSnapshot(snapshot *SessionSnapshot) SnapshotSummary {
+	return SnapshotSummary{
+		ID:          snapshot.ID,
+		Type:        SnapshotTypeSession,
+		Name:        snapshot.Name,
+		Description: snapshot.Description,
+		CreatedAt:   snapshot.CreatedAt,
+		SessionID:   snapshot.SessionID,
+		ProjectID:   snapshot.ProjectID,
+		RestoreTool: snapshotRestoreTools[SnapshotTypeSession],
+	}
+}
+
+// summarizeWorkspaceSnapshot describes a workspace snapshot for list_all_snapshots
+func summarizeWorkspaceSnapshot(snapshot *WorkspaceSnapshot) SnapshotSummary {
+	sessionIDs := make([]string, len(snapshot.Sessions))
+	for i, state := range snapshot.Sessions {
+		sessionIDs[i] = state.SessionID
+	}
+	return SnapshotSummary{
+		ID:          snapshot.ID,
+		Type:        SnapshotTypeWorkspace,
+		Name:        snapshot.Name,
+		Description: snapshot.Description,
+		CreatedAt:   snapshot.CreatedAt,
+		SessionIDs:  sessionIDs,
+		RestoreTool: snapshotRestoreTools[SnapshotTypeWorkspace],
+	}
+}
+
+// validateSnapshotType checks an optional snapshot type argument
+func validateSnapshotType(snapshotType string) error {
+	switch snapshotType {
+	case "", SnapshotTypeSession, SnapshotTypeWorkspace:
+		return nil
+	}
+	return fmt.Errorf("invalid type: %q. Use '%s' or '%s'", snapshotType, SnapshotTypeSession, SnapshotTypeWorkspace)
+}
+
+// ListAllSnapshots lists session and workspace snapshots together, each tagged with its type
+func (t *TerminalTools) ListAllSnapshots(ctx context.Context, req *mcp.CallToolRequest, args ListAllSnapshotsArgs) (*mcp.CallToolResult, ListAllSnapshotsResult, error) {
+	if err := validateSnapshotType(args.Type); err != nil {
+		return createErrorResult(err.Error()), ListAllSnapshotsResult{}, nil
+	}
+
+	filter := SnapshotFilter{
+		SessionID:    args.SessionID,
+		ProjectID:    args.ProjectID,
+		NameContains: args.NameContains,
+	}
+
+	var err error
+	if args.CreatedAfter != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, args.CreatedAfter); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid created_after: %v. Use RFC3339, e.g. 2024-01-02T15:04:05Z", err)), ListAllSnapshotsResult{}, nil
+		}
+	}
+	if args.CreatedBefore != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, args.CreatedBefore); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid created_before: %v. Use RFC3339, e.g. 2024-01-02T15:04:05Z", err)), ListAllSnapshotsResult{}, nil
+		}
+	}
+
+	switch args.Sort {
+	case "", "newest":
+	case "oldest":
+		filter.OldestFirst = true
+	default:
+		return createErrorResult(fmt.Sprintf("Invalid sort: %q. Use 'newest' or 'oldest'", args.Sort)), ListAllSnapshotsResult{}, nil
+	}
+
+	workspaces, err := t.workspaceStore.List()
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to list workspace snapshots: %v", err)), ListAllSnapshotsResult{}, nil
+	}
+	sessions, sessionTotal := t.snapshotManager.FilterSnapshots(filter)
+
+	result := ListAllSnapshotsResult{
+		Snapshots: []SnapshotSummary{},
+		CountByType: map[string]int{
+			SnapshotTypeSession:   0,
+			SnapshotTypeWorkspace: 0,
+		},
+		TotalByType: map[string]int{
+			SnapshotTypeSession:   sessionTotal,
+			SnapshotTypeWorkspace: len(workspaces),
+		},
+	}
+
+	if args.Type != SnapshotTypeWorkspace {
+		for _, snapshot := range sessions {
+			result.Snapshots = append(result.Snapshots, summarizeSessionSnapshot(snapshot))
+		}
+		result.CountByType[SnapshotTypeSession] = len(sessions)
+	}
+	if args.Type != SnapshotTypeSession {
+		for _, snapshot := range workspaces {
+			if filter.matchesWorkspace(snapshot) {
+				result.Snapshots = append(result.Snapshots, summarizeWorkspaceSnapshot(snapshot))
+				result.CountByType[SnapshotTypeWorkspace]++
+			}
+		}
+	}
+
+	sort.SliceStable(result.Snapshots, func(i, j int) bool {
+		a, b := result.Snapshots[i], result.Snapshots[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			if filter.OldestFirst {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	result.Count = len(result.Snapshots)
+	result.TotalCount = sessionTotal + len(workspaces)
+
+	return createJSONResult(result), result, nil
+}
+
+// GetSnapshot fetches a session or workspace snapshot by ID or name. A name used by snapshots of
+// both types must be disambiguated with type.
+func (t *TerminalTools) GetSnapshot(ctx context.Context, req *mcp.CallToolRequest, args GetSnapshotArgs) (*mcp.CallToolResult, GetSnapshotResult, error) {
+	if args.SnapshotID == "" {
+		return createErrorResult("snapshot_id is required"), GetSnapshotResult{}, nil
+	}
+	if err := validateSnapshotType(args.Type); err != nil {
+		return createErrorResult(err.Error()), GetSnapshotResult{}, nil
+	}
+
+	var session *SessionSnapshot
+	var workspace *WorkspaceSnapshot
+	if args.Type != SnapshotTypeWorkspace {
+		session, _ = t.snapshotManager.loadSnapshot(args.SnapshotID)
+	}
+	if args.Type != SnapshotTypeSession {
+		workspace, _ = t.workspaceStore.Load(args.SnapshotID)
+	}
+
+	var result GetSnapshotResult
+	switch {
+	case session != nil && workspace != nil:
+		return createErrorResult(fmt.Sprintf("%q matches session snapshot %s and workspace snapshot %s; pass type to choose one", args.SnapshotID, session.ID, workspace.ID)), GetSnapshotResult{}, nil
+	case session != nil:
+		result = GetSnapshotResult{Type: SnapshotTypeSession, Summary: summarizeSessionSnapshot(session), Session: session}
+	case workspace != nil:
+		result = GetSnapshotResult{Type: SnapshotTypeWorkspace, Summary: summarizeWorkspaceSnapshot(workspace), Workspace: workspace}
+	default:
+		return createErrorResult(fmt.Sprintf("snapshot not found: %s", args.SnapshotID)), GetSnapshotResult{}, nil
+	}
+	result.RestoreTool = result.Summary.RestoreTool
+
+	return createJSONResult(result), result, nil
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // F2: SessionSnapshot represents a saved session state
@@ -32,9 +34,40 @@ type SessionSnapshot struct {
 type SnapshotManager struct {
 	snapshots   map[string]*SessionSnapshot
 	snapshotDir string
+	seq         uint64 // Disambiguates snapshots created within the same second
 	mu          sync.RWMutex
 }
 
+// SnapshotFilter selects snapshots by metadata; zero-valued fields match everything
+type SnapshotFilter struct {
+	SessionID     string
+	ProjectID     string
+	NameContains  string // Case-insensitive substring of the snapshot name
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	OldestFirst   bool // Sort by creation time ascending instead of newest first
+}
+
+// matches reports whether a snapshot satisfies the filter
+func (f SnapshotFilter) matches(snapshot *SessionSnapshot) bool {
+	if f.SessionID != "" && snapshot.SessionID != f.SessionID {
+		return false
+	}
+	if f.ProjectID != "" && snapshot.ProjectID != f.ProjectID {
+		return false
+	}
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(snapshot.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && snapshot.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && snapshot.CreatedAt.After(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
 // NewSnapshotManager creates a new snapshot manager
 func NewSnapshotManager(dataDir string) *SnapshotManager {
 	snapshotDir := filepath.Join(dataDir, "snapshots")
@@ -83,13 +116,17 @@ func (sm *SnapshotManager) CreateSnapshot(snapshot *SessionSnapshot) error {
 	defer sm.mu.Unlock()
 
 	snapshot.CreatedAt = time.Now()
+	if snapshot.ID == "" {
+		sm.seq++
+		snapshot.ID = fmt.Sprintf("snap-%s-%d", snapshot.CreatedAt.Format("20060102-150405"), sm.seq)
+	}
 	sm.snapshots[snapshot.ID] = snapshot
 
 	// Save to disk
 	return sm.saveSnapshot(snapshot)
 }
 
-// saveSnapshot saves a snapshot to disk
+// saveSnapshot saves a snapshot to disk; the caller must hold the write lock
 func (sm *SnapshotManager) saveSnapshot(snapshot *SessionSnapshot) error {
 	data, err := json.MarshalIndent(snapshot, "", "  ")
 	if err != nil {
@@ -120,6 +157,32 @@ func (sm *SnapshotManager) GetSnapshot(idOrName string) (*SessionSnapshot, bool)
 	return nil, false
 }
 
+// loadSnapshot returns a snapshot by ID or name, reading it from disk if it was saved after
+// this manager loaded the snapshot directory
+func (sm *SnapshotManager) loadSnapshot(idOrName string) (*SessionSnapshot, error) {
+	if snapshot, exists := sm.GetSnapshot(idOrName); exists {
+		return snapshot, nil
+	}
+
+	// Only plain IDs map to files; anything with a path separator cannot be a snapshot ID
+	if idOrName == "" || strings.ContainsAny(idOrName, `/\`) || strings.Contains(idOrName, "..") {
+		return nil, fmt.Errorf("snapshot not found: %s", idOrName)
+	}
+	data, err := os.ReadFile(filepath.Join(sm.snapshotDir, idOrName+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot not found: %s", idOrName)
+	}
+	var snapshot SessionSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot %s is corrupt: %w", idOrName, err)
+	}
+
+	sm.mu.Lock()
+	sm.snapshots[snapshot.ID] = &snapshot
+	sm.mu.Unlock()
+	return &snapshot, nil
+}
+
 // ListSnapshots returns all snapshots
 func (sm *SnapshotManager) ListSnapshots() []*SessionSnapshot {
 	sm.mu.RLock()
@@ -132,6 +195,29 @@ func (sm *SnapshotManager) ListSnapshots() []*SessionSnapshot {
 	return result
 }
 
+// FilterSnapshots returns snapshots matching filter sorted by creation time, along with
+// the total number of snapshots, both taken under a single read lock
+func (sm *SnapshotManager) FilterSnapshots(filter SnapshotFilter) ([]*SessionSnapshot, int) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	result := make([]*SessionSnapshot, 0, len(sm.snapshots))
+	for _, s := range sm.snapshots {
+		if filter.matches(s) {
+			result = append(result, s)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if filter.OldestFirst {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, len(sm.snapshots)
+}
+
 // DeleteSnapshot removes a snapshot
 func (sm *SnapshotManager) DeleteSnapshot(id string) error {
 	sm.mu.Lock()
@@ -170,27 +256,66 @@ type CreateSnapshotResult struct {
 }
 
 // ListSnapshotsArgs represents arguments for listing snapshots
-type ListSnapshotsArgs struct{}
+type ListSnapshotsArgs struct {
+	SessionID     string `json:"session_id,omitempty" jsonschema:"description=Only include snapshots of this session"`
+	ProjectID     string `json:"project_id,omitempty" jsonschema:"description=Only include snapshots from this project"`
+	NameContains  string `json:"name_contains,omitempty" jsonschema:"description=Only include snapshots whose name contains this text (case-insensitive)"`
+	CreatedAfter  string `json:"created_after,omitempty" jsonschema:"description=Only include snapshots created at or after this RFC3339 time"`
+	CreatedBefore string `json:"created_before,omitempty" jsonschema:"description=Only include snapshots created at or before this RFC3339 time"`
+	Sort          string `json:"sort,omitempty" jsonschema:"description=Sort by creation time: newest (default) or oldest"`
+}
 
 // ListSnapshotsResult represents the result of listing snapshots
 type ListSnapshotsResult struct {
-	Snapshots []*SessionSnapshot `json:"snapshots"`
-	Count     int                `json:"count"`
+	Snapshots  []*SessionSnapshot `json:"snapshots"`
+	Count      int                `json:"count"`       // Snapshots matching the filters
+	TotalCount int                `json:"total_count"` // All stored snapshots
 }
 
 // RestoreSnapshotArgs represents arguments for restoring a snapshot
 type RestoreSnapshotArgs struct {
-	SnapshotID string `json:"snapshot_id" jsonschema:"required,description=Snapshot ID or name to restore"`
-	NewName    string `json:"new_name,omitempty" jsonschema:"description=Name for the restored session (optional)"`
+	SnapshotID      string `json:"snapshot_id" jsonschema:"required,description=Snapshot ID or name to restore"`
+	TargetSessionID string `json:"target_session_id,omitempty" jsonschema:"description=Existing session to restore into; a new session is created when omitted"`
+	NewName         string `json:"new_name,omitempty" jsonschema:"description=Name for the restored session when a new one is created (optional)"`
 }
 
 // RestoreSnapshotResult represents the result of restoring a snapshot
 type RestoreSnapshotResult struct {
-	NewSessionID string `json:"new_session_id"`
-	SnapshotID   string `json:"snapshot_id"`
-	RestoredName string `json:"restored_name"`
-	WorkingDir   string `json:"working_dir"`
-	Message      string `json:"message"`
+	SessionID      string   `json:"session_id"`               // Session the snapshot was applied to
+	NewSessionID   string   `json:"new_session_id,omitempty"` // Set when a new session was created
+	SnapshotID     string   `json:"snapshot_id"`
+	RestoredName   string   `json:"restored_name"`
+	WorkingDir     string   `json:"working_dir"` // Directory the session is now in
+	AppliedChanges []string `json:"applied_changes"`
+	Warnings       []string `json:"warnings,omitempty"`
+	Message        string   `json:"message"`
+}
+
+// EnvironmentDriftArgs represents arguments for comparing a session's environment with a snapshot
+type EnvironmentDriftArgs struct {
+	SnapshotID string `json:"snapshot_id" jsonschema:"required,description=Snapshot ID or name to compare against"`
+	SessionID  string `json:"session_id,omitempty" jsonschema:"description=Session to compare; defaults to the session the snapshot was taken from"`
+}
+
+// EnvironmentChange is a variable whose value differs from the snapshot
+type EnvironmentChange struct {
+	Key      string `json:"key"`
+	Snapshot string `json:"snapshot"`
+	Current  string `json:"current"`
+}
+
+// EnvironmentDriftResult lists how a session's environment has changed since a snapshot. Values
+// that look like secrets are redacted.
+type EnvironmentDriftResult struct {
+	SnapshotID        string              `json:"snapshot_id"`
+	SnapshotName      string              `json:"snapshot_name"`
+	SnapshotCreatedAt time.Time           `json:"snapshot_created_at"`
+	SessionID         string              `json:"session_id"`
+	Added             map[string]string   `json:"added"`   // Set in the session but not in the snapshot
+	Removed           map[string]string   `json:"removed"` // In the snapshot but no longer set, with the snapshot value
+	Changed           []EnvironmentChange `json:"changed"`
+	DriftCount        int                 `json:"drift_count"`
+	Message           string              `json:"message"`
 }
 
 // CreateSessionSnapshot creates a snapshot of the current session state
@@ -201,15 +326,14 @@ func (t *TerminalTools) CreateSessionSnapshot(ctx context.Context, req *mcp.Call
 		return createErrorResult(fmt.Sprintf("Session not found: %v", err)), CreateSnapshotResult{}, nil
 	}
 
-	// Create snapshot
+	// Create snapshot; the snapshot manager assigns a unique ID
 	snapshot := &SessionSnapshot{
-		ID:           fmt.Sprintf("snap-%s", time.Now().Format("20060102-150405")),
 		Name:         args.Name,
 		SessionID:    session.ID,
 		ProjectID:    session.ProjectID,
-		WorkingDir:   session.WorkingDir,
+		WorkingDir:   session.GetWorkingDir(),
 		CurrentDir:   session.GetCurrentDir(),
-		Environment:  session.Environment,
+		Environment:  session.GetAllEnvironment(),
 		CommandCount: session.CommandCount,
 		Description:  args.Description,
 		Tags:         args.Tags,
@@ -238,63 +362,189 @@ func (t *TerminalTools) CreateSessionSnapshot(ctx context.Context, req *mcp.Call
 
 // ListSessionSnapshots lists all available snapshots
 func (t *TerminalTools) ListSessionSnapshots(ctx context.Context, req *mcp.CallToolRequest, args ListSnapshotsArgs) (*mcp.CallToolResult, ListSnapshotsResult, error) {
-	snapshots := t.snapshotManager.ListSnapshots()
+	filter := SnapshotFilter{
+		SessionID:    args.SessionID,
+		ProjectID:    args.ProjectID,
+		NameContains: args.NameContains,
+	}
+
+	var err error
+	if args.CreatedAfter != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, args.CreatedAfter); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid created_after: %v. Use RFC3339, e.g. 2024-01-02T15:04:05Z", err)), ListSnapshotsResult{}, nil
+		}
+	}
+	if args.CreatedBefore != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, args.CreatedBefore); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid created_before: %v. Use RFC3339, e.g. 2024-01-02T15:04:05Z", err)), ListSnapshotsResult{}, nil
+		}
+	}
+
+	switch args.Sort {
+	case "", "newest":
+	case "oldest":
+		filter.OldestFirst = true
+	default:
+		return createErrorResult(fmt.Sprintf("Invalid sort: %q. Use 'newest' or 'oldest'", args.Sort)), ListSnapshotsResult{}, nil
+	}
+
+	snapshots, total := t.snapshotManager.FilterSnapshots(filter)
 
 	result := ListSnapshotsResult{
-		Snapshots: snapshots,
-		Count:     len(snapshots),
+		Snapshots:  snapshots,
+		Count:      len(snapshots),
+		TotalCount: total,
 	}
 
 	return createJSONResult(result), result, nil
 }
 
-// RestoreSessionSnapshot restores a session from a snapshot
+// RestoreSessionSnapshot applies a snapshot's directory and environment to an existing session,
+// or to a new session when no target is given
 func (t *TerminalTools) RestoreSessionSnapshot(ctx context.Context, req *mcp.CallToolRequest, args RestoreSnapshotArgs) (*mcp.CallToolResult, RestoreSnapshotResult, error) {
-	// Get the snapshot
-	snapshot, exists := t.snapshotManager.GetSnapshot(args.SnapshotID)
-	if !exists {
-		return createErrorResult(fmt.Sprintf("Snapshot not found: %s", args.SnapshotID)), RestoreSnapshotResult{}, nil
+	snapshot, err := t.snapshotManager.loadSnapshot(args.SnapshotID)
+	if err != nil {
+		return createErrorResult(err.Error()), RestoreSnapshotResult{}, nil
 	}
 
-	// Determine session name
-	sessionName := args.NewName
-	if sessionName == "" {
-		sessionName = fmt.Sprintf("%s-restored", snapshot.Name)
+	result := RestoreSnapshotResult{
+		SnapshotID:     snapshot.ID,
+		AppliedChanges: []string{},
 	}
 
-	// Create new session from snapshot
-	session, err := t.manager.CreateSession(sessionName, snapshot.ProjectID, snapshot.WorkingDir)
-	if err != nil {
-		return createErrorResult(fmt.Sprintf("Failed to create session: %v", err)), RestoreSnapshotResult{}, nil
+	// The saved directory may have been removed since the snapshot was taken
+	targetDir := snapshot.CurrentDir
+	if targetDir == "" {
+		targetDir = snapshot.WorkingDir
 	}
-
-	// Restore environment variables
-	for key, value := range snapshot.Environment {
-		session.Environment[key] = value
+	if info, statErr := os.Stat(targetDir); statErr != nil || !info.IsDir() {
+		home, homeErr := os.UserHomeDir()
+		if homeErr != nil {
+			return createErrorResult(fmt.Sprintf("Snapshot directory %s no longer exists and the home directory is unknown: %v", targetDir, homeErr)), RestoreSnapshotResult{}, nil
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("directory %s no longer exists; using home directory %s", targetDir, home))
+		targetDir = home
 	}
 
-	// Change to the saved current directory
-	if snapshot.CurrentDir != "" && snapshot.CurrentDir != snapshot.WorkingDir {
-		_, _ = t.manager.ExecuteCommandWithTimeout(session.ID, fmt.Sprintf("cd %s", shellEscape(snapshot.CurrentDir)), 5*time.Second)
+	var session *terminal.Session
+	if args.TargetSessionID != "" {
+		if err := validateSessionID(args.TargetSessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Invalid target session ID: %v", err)), RestoreSnapshotResult{}, nil
+		}
+		if session, err = t.manager.GetSession(args.TargetSessionID); err != nil {
+			return createErrorResult(fmt.Sprintf("Target session not found: %v", err)), RestoreSnapshotResult{}, nil
+		}
+		result.RestoredName = session.Name
+	} else {
+		result.RestoredName = args.NewName
+		if result.RestoredName == "" {
+			result.RestoredName = fmt.Sprintf("%s-restored", snapshot.Name)
+		}
+		workingDir := snapshot.WorkingDir
+		if info, statErr := os.Stat(workingDir); statErr != nil || !info.IsDir() {
+			workingDir = targetDir
+		}
+		if session, err = t.manager.CreateSession(result.RestoredName, snapshot.ProjectID, workingDir); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to create session: %v", err)), RestoreSnapshotResult{}, nil
+		}
+		result.NewSessionID = session.ID
+		result.AppliedChanges = append(result.AppliedChanges, fmt.Sprintf("created session %s in %s", session.ID, workingDir))
+	}
+	result.SessionID = session.ID
+
+	// Saved values win over whatever the session (or the system defaults it inherited) has now
+	if len(snapshot.Environment) > 0 {
+		diff := diffEnvironment(session.GetAllEnvironment(), snapshot.Environment)
+		session.SetEnvironmentBatch(snapshot.Environment)
+		for _, key := range diff.added {
+			result.AppliedChanges = append(result.AppliedChanges, fmt.Sprintf("set environment %s", key))
+		}
+		for _, key := range diff.changed {
+			result.AppliedChanges = append(result.AppliedChanges, fmt.Sprintf("overwrote environment %s", key))
+		}
 	}
 
-	result := RestoreSnapshotResult{
-		NewSessionID: session.ID,
-		SnapshotID:   snapshot.ID,
-		RestoredName: sessionName,
-		WorkingDir:   snapshot.CurrentDir,
-		Message:      fmt.Sprintf("Session restored from snapshot '%s'", snapshot.Name),
+	if current := session.GetCurrentDir(); current != targetDir {
+		if err := t.manager.SetSessionCurrentDir(session.ID, targetDir); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("current directory not restored: %v", err))
+		} else {
+			result.AppliedChanges = append(result.AppliedChanges, fmt.Sprintf("changed directory from %s to %s", current, targetDir))
+		}
 	}
+	result.WorkingDir = session.GetCurrentDir()
+	result.Message = fmt.Sprintf("Snapshot '%s' restored into session %s with %d change(s)", snapshot.Name, session.ID, len(result.AppliedChanges))
 
 	t.logger.Info("Session restored from snapshot", map[string]interface{}{
-		"snapshot_id":    snapshot.ID,
-		"new_session_id": session.ID,
-		"name":           sessionName,
+		"snapshot_id": snapshot.ID,
+		"session_id":  session.ID,
+		"created":     result.NewSessionID != "",
+		"changes":     len(result.AppliedChanges),
+		"warnings":    len(result.Warnings),
 	})
 
 	return createJSONResult(result), result, nil
 }
 
+// GetEnvironmentDriftSince reports the environment variables a session added, removed, or changed
+// since a snapshot was taken, without restoring anything
+func (t *TerminalTools) GetEnvironmentDriftSince(ctx context.Context, req *mcp.CallToolRequest, args EnvironmentDriftArgs) (*mcp.CallToolResult, EnvironmentDriftResult, error) {
+	if args.SnapshotID == "" {
+		return createErrorResult("snapshot_id is required"), EnvironmentDriftResult{}, nil
+	}
+	snapshot, err := t.snapshotManager.loadSnapshot(args.SnapshotID)
+	if err != nil {
+		return createErrorResult(err.Error()), EnvironmentDriftResult{}, nil
+	}
+
+	sessionID := args.SessionID
+	if sessionID == "" {
+		sessionID = snapshot.SessionID
+	}
+	if err := validateSessionID(sessionID); err != nil {
+		return createErrorResult(fmt.Sprintf("Invalid session ID: %v", err)), EnvironmentDriftResult{}, nil
+	}
+	session, err := t.manager.GetSession(sessionID)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Session not found: %v", err)), EnvironmentDriftResult{}, nil
+	}
+
+	current := session.GetAllEnvironment()
+	diff := diffEnvironment(snapshot.Environment, current)
+
+	result := EnvironmentDriftResult{
+		SnapshotID:        snapshot.ID,
+		SnapshotName:      snapshot.Name,
+		SnapshotCreatedAt: snapshot.CreatedAt,
+		SessionID:         session.ID,
+		Added:             make(map[string]string, len(diff.added)),
+		Removed:           make(map[string]string, len(diff.removed)),
+		Changed:           make([]EnvironmentChange, 0, len(diff.changed)),
+		DriftCount:        len(diff.added) + len(diff.removed) + len(diff.changed),
+	}
+	for _, key := range diff.added {
+		result.Added[key] = redactEnvValue(key, current[key])
+	}
+	for _, key := range diff.removed {
+		result.Removed[key] = redactEnvValue(key, snapshot.Environment[key])
+	}
+	for _, key := range diff.changed {
+		result.Changed = append(result.Changed, EnvironmentChange{
+			Key:      key,
+			Snapshot: redactEnvValue(key, snapshot.Environment[key]),
+			Current:  redactEnvValue(key, current[key]),
+		})
+	}
+
+	if result.DriftCount == 0 {
+		result.Message = fmt.Sprintf("Session %s environment matches snapshot '%s'", session.ID, snapshot.Name)
+	} else {
+		result.Message = fmt.Sprintf("Session %s environment drifted from snapshot '%s': %d added, %d removed, %d changed",
+			session.ID, snapshot.Name, len(diff.added), len(diff.removed), len(diff.changed))
+	}
+
+	return createJSONResult(result), result, nil
+}
+
 // shellEscape escapes a string for safe use in shell (duplicated for package scope)
 func shellEscape(s string) string {
 	if s == "" {
@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// templateExpansionCache is a bounded LRU of expanded template commands keyed by template name
+// and a hash of the variables. It has no lock of its own; the TemplateManager's mutex guards it.
+type templateExpansionCache struct {
+	capacity int
+	order    *list.List // Front is most recently used
+	entries  map[string]*list.Element
+	hits     int
+	misses   int
+}
+
+// cachedExpansion is one expanded command in the cache
+type cachedExpansion struct {
+	key      string
+	template string
+	command  string
+}
+
+// newTemplateExpansionCache returns a cache holding up to capacity expansions, or nil when
+// capacity is not positive so caching is disabled
+func newTemplateExpansionCache(capacity int) *templateExpansionCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &templateExpansionCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// expansionCacheKey identifies an expansion by template name and variables; map order does not matter
+func expansionCacheKey(name string, variables map[string]string) string {
+	keys := make([]string, 0, len(variables))
+	for key := range variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(variables[key]))
+		hash.Write([]byte{0})
+	}
+	return name + "\x00" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns the cached command for key and marks it most recently used
+func (c *templateExpansionCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedExpansion).command, true
+}
+
+// put stores an expansion, evicting the least recently used entry when full
+func (c *templateExpansionCache) put(key, template, command string) {
+	if c == nil {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cachedExpansion).command = command
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedExpansion{key: key, template: template, command: command})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedExpansion).key)
+	}
+}
+
+// invalidate drops every cached expansion of the named template
+func (c *templateExpansionCache) invalidate(template string) {
+	if c == nil {
+		return
+	}
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*cachedExpansion); entry.template == template {
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+		}
+		element = next
+	}
+}
@@ -2,12 +2,16 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
 )
 
 // F1: CommandTemplate represents a pre-defined command template
@@ -19,18 +23,24 @@ type CommandTemplate struct {
 	Variables   map[string]string `json:"variables,omitempty"` // Variable placeholders and defaults
 	Tags        []string          `json:"tags,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
+
+	// Set when no category was given and Category was inferred from the command
+	CategoryInferred bool `json:"category_inferred,omitempty"`
 }
 
 // F1: TemplateManager manages command templates/aliases
 type TemplateManager struct {
 	templates map[string]*CommandTemplate
+	cache     *templateExpansionCache // nil when expansion caching is disabled
 	mu        sync.RWMutex
 }
 
-// NewTemplateManager creates a new template manager with default templates
-func NewTemplateManager() *TemplateManager {
+// NewTemplateManager creates a new template manager with default templates. Up to cacheSize
+// expansions are cached; 0 disables the cache.
+func NewTemplateManager(cacheSize int) *TemplateManager {
 	tm := &TemplateManager{
 		templates: make(map[string]*CommandTemplate),
+		cache:     newTemplateExpansionCache(cacheSize),
 	}
 
 	// Add default templates for common operations
@@ -84,6 +94,57 @@ func (tm *TemplateManager) addDefaultTemplates() {
 	}
 }
 
+// templateCategories maps command types to the categories the default templates use; other command
+// types become their own category
+var templateCategories = map[string]string{
+	"npm":            "nodejs",
+	"npx":            "nodejs",
+	"yarn":           "nodejs",
+	"pnpm":           "nodejs",
+	"bun":            "nodejs",
+	"node":           "nodejs",
+	"python":         "python",
+	"python3":        "python",
+	"pip":            "python",
+	"pip3":           "python",
+	"uv":             "python",
+	"poetry":         "python",
+	"pytest":         "python",
+	"go":             "go",
+	"git":            "git",
+	"docker":         "docker",
+	"docker-compose": "docker",
+	"df":             "system",
+	"du":             "system",
+	"find":           "system",
+	"lsof":           "system",
+	"ps":             "system",
+}
+
+// inferTemplateCategory derives a template category from the command it runs, or returns "" when
+// the command does not start with a plain command name (e.g. a {{variable}} or an assignment)
+func inferTemplateCategory(command string) string {
+	cmdType := terminal.ExtractCommandType(command)
+	if cmdType == "empty" || strings.ContainsAny(cmdType, "{}=$") {
+		return ""
+	}
+	cmdType = strings.ToLower(cmdType)
+	if category, ok := templateCategories[cmdType]; ok {
+		return category
+	}
+	return cmdType
+}
+
+// inferMissingCategory gives a template without a category one inferred from its command, unless
+// inference is disabled. An explicit category is never replaced.
+func (t *TerminalTools) inferMissingCategory(template *CommandTemplate) {
+	if template.Category != "" || !t.config.Session.InferTemplateCategory {
+		return
+	}
+	template.Category = inferTemplateCategory(template.Command)
+	template.CategoryInferred = template.Category != ""
+}
+
 // AddTemplate adds a new command template
 func (tm *TemplateManager) AddTemplate(template *CommandTemplate) error {
 	tm.mu.Lock()
@@ -98,6 +159,7 @@ func (tm *TemplateManager) AddTemplate(template *CommandTemplate) error {
 
 	template.CreatedAt = time.Now()
 	tm.templates[template.Name] = template
+	tm.cache.invalidate(template.Name)
 	return nil
 }
 
@@ -131,21 +193,65 @@ func (tm *TemplateManager) DeleteTemplate(name string) bool {
 
 	if _, exists := tm.templates[name]; exists {
 		delete(tm.templates, name)
+		tm.cache.invalidate(name)
 		return true
 	}
 	return false
 }
 
-// ExpandTemplate expands a template with given variables
+// UpdateTemplate replaces the command, description and category of an existing template, keeping
+// any field passed as empty. A category that was inferred is inferred again from a new command
+// unless a category is passed. The stored template is replaced rather than mutated so callers
+// holding the previous value are unaffected.
+func (tm *TemplateManager) UpdateTemplate(name, command, description, category string) (*CommandTemplate, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	existing, exists := tm.templates[name]
+	if !exists {
+		return nil, fmt.Errorf("template '%s' not found", name)
+	}
+
+	updated := *existing
+	if command != "" {
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("template command cannot be empty")
+		}
+		updated.Command = command
+	}
+	if description != "" {
+		updated.Description = description
+	}
+	if category != "" {
+		updated.Category = category
+		updated.CategoryInferred = false
+	} else if updated.CategoryInferred && updated.Command != existing.Command {
+		updated.Category = inferTemplateCategory(updated.Command)
+		updated.CategoryInferred = updated.Category != ""
+	}
+
+	tm.templates[name] = &updated
+	tm.cache.invalidate(name)
+	return &updated, nil
+}
+
+// ExpandTemplate expands a template with given variables. Results are cached per template and
+// variable set until the template is updated or deleted; the write lock is held because a cache
+// hit reorders the LRU.
 func (tm *TemplateManager) ExpandTemplate(name string, variables map[string]string) (string, error) {
-	tm.mu.RLock()
-	t, exists := tm.templates[name]
-	tm.mu.RUnlock()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 
+	t, exists := tm.templates[name]
 	if !exists {
 		return "", fmt.Errorf("template '%s' not found", name)
 	}
 
+	cacheKey := expansionCacheKey(name, variables)
+	if cmd, ok := tm.cache.get(cacheKey); ok {
+		return cmd, nil
+	}
+
 	// Start with the template command
 	cmd := t.Command
 
@@ -164,6 +270,7 @@ func (tm *TemplateManager) ExpandTemplate(name string, variables map[string]stri
 		cmd = strings.ReplaceAll(cmd, placeholder, value)
 	}
 
+	tm.cache.put(cacheKey, name, cmd)
 	return cmd, nil
 }
 
@@ -188,7 +295,7 @@ type AddTemplateArgs struct {
 	Name        string            `json:"name" jsonschema:"required,description=Unique name for the template"`
 	Command     string            `json:"command" jsonschema:"required,description=The command to execute"`
 	Description string            `json:"description,omitempty" jsonschema:"description=Description of what the template does"`
-	Category    string            `json:"category,omitempty" jsonschema:"description=Category for the template"`
+	Category    string            `json:"category,omitempty" jsonschema:"description=Category for the template (inferred from the command when omitted)"`
 	Variables   map[string]string `json:"variables,omitempty" jsonschema:"description=Variable placeholders with default values"`
 }
 
@@ -233,6 +340,8 @@ func (t *TerminalTools) AddCommandTemplate(ctx context.Context, req *mcp.CallToo
 		Variables:   args.Variables,
 	}
 
+	t.inferMissingCategory(template)
+
 	if err := t.templateManager.AddTemplate(template); err != nil {
 		return createErrorResult(err.Error()), nil, nil
 	}
@@ -261,3 +370,304 @@ func (t *TerminalTools) ExecuteCommandTemplate(ctx context.Context, req *mcp.Cal
 		Timeout:   args.Timeout,
 	})
 }
+
+// UpdateTemplateArgs represents arguments for editing a template
+type UpdateTemplateArgs struct {
+	Name        string `json:"name" jsonschema:"required,description=Name of the template to update"`
+	Command     string `json:"command,omitempty" jsonschema:"description=New command (omit to keep the current one)"`
+	Description string `json:"description,omitempty" jsonschema:"description=New description (omit to keep the current one)"`
+	Category    string `json:"category,omitempty" jsonschema:"description=New category (omit to keep the current one)"`
+}
+
+// UpdateTemplateResult represents the result of editing a template
+type UpdateTemplateResult struct {
+	Template *CommandTemplate `json:"template"`
+	Updated  []string         `json:"updated"` // Fields that were changed
+	Message  string           `json:"message"`
+}
+
+// DeleteTemplateArgs represents arguments for deleting a template
+type DeleteTemplateArgs struct {
+	Name string `json:"name" jsonschema:"required,description=Name of the template to delete"`
+}
+
+// DeleteTemplateResult represents the result of deleting a template
+type DeleteTemplateResult struct {
+	Name    string `json:"name"`
+	Existed bool   `json:"existed"`
+	Message string `json:"message"`
+}
+
+// UpdateCommandTemplate edits an existing template, keeping fields that are left empty
+func (t *TerminalTools) UpdateCommandTemplate(ctx context.Context, req *mcp.CallToolRequest, args UpdateTemplateArgs) (*mcp.CallToolResult, UpdateTemplateResult, error) {
+	if args.Name == "" {
+		return createErrorResult("template name cannot be empty"), UpdateTemplateResult{}, nil
+	}
+
+	previous, exists := t.templateManager.GetTemplate(args.Name)
+	if !exists {
+		return createErrorResult(fmt.Sprintf("Template not found: %s", args.Name)), UpdateTemplateResult{}, nil
+	}
+
+	template, err := t.templateManager.UpdateTemplate(args.Name, args.Command, args.Description, args.Category)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to update template: %v", err)), UpdateTemplateResult{}, nil
+	}
+
+	updated := []string{}
+	if template.Command != previous.Command {
+		updated = append(updated, "command")
+	}
+	if template.Description != previous.Description {
+		updated = append(updated, "description")
+	}
+	if template.Category != previous.Category {
+		updated = append(updated, "category")
+	}
+
+	result := UpdateTemplateResult{
+		Template: template,
+		Updated:  updated,
+		Message:  fmt.Sprintf("Template '%s' updated (%d field(s) changed)", args.Name, len(updated)),
+	}
+
+	t.logger.Info("Command template updated", map[string]interface{}{
+		"name":    args.Name,
+		"updated": updated,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// DeleteCommandTemplate removes a template and reports whether it existed
+func (t *TerminalTools) DeleteCommandTemplate(ctx context.Context, req *mcp.CallToolRequest, args DeleteTemplateArgs) (*mcp.CallToolResult, DeleteTemplateResult, error) {
+	if args.Name == "" {
+		return createErrorResult("template name cannot be empty"), DeleteTemplateResult{}, nil
+	}
+
+	result := DeleteTemplateResult{
+		Name:    args.Name,
+		Existed: t.templateManager.DeleteTemplate(args.Name),
+	}
+	if result.Existed {
+		result.Message = fmt.Sprintf("Template '%s' deleted", args.Name)
+		t.logger.Info("Command template deleted", map[string]interface{}{
+			"name": args.Name,
+		})
+	} else {
+		result.Message = fmt.Sprintf("Template '%s' did not exist", args.Name)
+	}
+
+	return createJSONResult(result), result, nil
+}
+
+// =============================================================================
+// Template Import/Export
+// =============================================================================
+
+// Conflict policies for importing a template whose name already exists
+const (
+	TemplateConflictSkip      = "skip"
+	TemplateConflictOverwrite = "overwrite"
+	TemplateConflictRename    = "rename"
+)
+
+// ImportTemplatesArgs represents arguments for importing command templates
+type ImportTemplatesArgs struct {
+	Path       string            `json:"path,omitempty" jsonschema:"description=Path to a JSON file containing an array of templates"`
+	Templates  []CommandTemplate `json:"templates,omitempty" jsonschema:"description=Inline array of templates to import instead of a file"`
+	OnConflict string            `json:"on_conflict,omitempty" jsonschema:"description=What to do when a template name already exists: skip (default), overwrite or rename"`
+}
+
+// TemplateImportOutcome reports what happened to a single imported template
+type TemplateImportOutcome struct {
+	Name       string `json:"name"`
+	ImportedAs string `json:"imported_as,omitempty"` // Differs from Name when renamed
+	Action     string `json:"action"`                // added, overwritten, renamed, skipped or failed
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportTemplatesResult represents the result of importing command templates
+type ImportTemplatesResult struct {
+	Source   string                  `json:"source"`
+	Added    int                     `json:"added"`
+	Skipped  int                     `json:"skipped"`
+	Failed   int                     `json:"failed"`
+	Outcomes []TemplateImportOutcome `json:"outcomes"`
+	Message  string                  `json:"message"`
+}
+
+// ExportTemplatesArgs represents arguments for exporting command templates
+type ExportTemplatesArgs struct {
+	Path     string   `json:"path,omitempty" jsonschema:"description=File to write the templates to as JSON (omit to return them inline)"`
+	Category string   `json:"category,omitempty" jsonschema:"description=Only export templates in this category"`
+	Names    []string `json:"names,omitempty" jsonschema:"description=Only export templates with these names"`
+}
+
+// ExportTemplatesResult represents the result of exporting command templates
+type ExportTemplatesResult struct {
+	Templates []*CommandTemplate `json:"templates"`
+	Count     int                `json:"count"`
+	Path      string             `json:"path,omitempty"`
+	Message   string             `json:"message"`
+}
+
+// validateImportedTemplate checks a template before it is imported
+func validateImportedTemplate(template CommandTemplate) error {
+	if strings.TrimSpace(template.Name) == "" {
+		return fmt.Errorf("template name cannot be empty")
+	}
+	if strings.ContainsAny(template.Name, " \t\n") {
+		return fmt.Errorf("template name cannot contain whitespace")
+	}
+	if strings.TrimSpace(template.Command) == "" {
+		return fmt.Errorf("template command cannot be empty")
+	}
+	if strings.Count(template.Command, "{{") != strings.Count(template.Command, "}}") {
+		return fmt.Errorf("template command has unbalanced {{ }} placeholders")
+	}
+	return nil
+}
+
+// availableTemplateName returns name, or name with the first free numeric suffix if it is taken
+func (tm *TemplateManager) availableTemplateName(name string) string {
+	if _, exists := tm.GetTemplate(name); !exists {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if _, exists := tm.GetTemplate(candidate); !exists {
+			return candidate
+		}
+	}
+}
+
+// ImportCommandTemplates adds templates from a JSON file or an inline array, resolving name conflicts per on_conflict
+func (t *TerminalTools) ImportCommandTemplates(ctx context.Context, req *mcp.CallToolRequest, args ImportTemplatesArgs) (*mcp.CallToolResult, ImportTemplatesResult, error) {
+	policy := strings.ToLower(strings.TrimSpace(args.OnConflict))
+	if policy == "" {
+		policy = TemplateConflictSkip
+	}
+	if policy != TemplateConflictSkip && policy != TemplateConflictOverwrite && policy != TemplateConflictRename {
+		return createErrorResult(fmt.Sprintf("Invalid on_conflict %q: must be skip, overwrite or rename", args.OnConflict)), ImportTemplatesResult{}, nil
+	}
+
+	templates := args.Templates
+	source := "inline"
+	if args.Path != "" {
+		if len(args.Templates) > 0 {
+			return createErrorResult("Provide either path or templates, not both"), ImportTemplatesResult{}, nil
+		}
+		data, err := os.ReadFile(args.Path)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to read template file: %v", err)), ImportTemplatesResult{}, nil
+		}
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return createErrorResult(fmt.Sprintf("Template file must contain a JSON array of templates: %v", err)), ImportTemplatesResult{}, nil
+		}
+		source = args.Path
+	}
+	if len(templates) == 0 {
+		return createErrorResult("No templates to import"), ImportTemplatesResult{}, nil
+	}
+
+	result := ImportTemplatesResult{
+		Source:   source,
+		Outcomes: make([]TemplateImportOutcome, 0, len(templates)),
+	}
+
+	for _, template := range templates {
+		outcome := TemplateImportOutcome{Name: template.Name}
+
+		if err := validateImportedTemplate(template); err != nil {
+			outcome.Action = "failed"
+			outcome.Error = err.Error()
+			result.Failed++
+			result.Outcomes = append(result.Outcomes, outcome)
+			continue
+		}
+
+		outcome.Action = "added"
+		if _, exists := t.templateManager.GetTemplate(template.Name); exists {
+			switch policy {
+			case TemplateConflictSkip:
+				outcome.Action = "skipped"
+				result.Skipped++
+				result.Outcomes = append(result.Outcomes, outcome)
+				continue
+			case TemplateConflictOverwrite:
+				outcome.Action = "overwritten"
+			case TemplateConflictRename:
+				template.Name = t.templateManager.availableTemplateName(template.Name)
+				outcome.Action = "renamed"
+			}
+		}
+
+		imported := template
+		if err := t.templateManager.AddTemplate(&imported); err != nil {
+			outcome.Action = "failed"
+			outcome.Error = err.Error()
+			result.Failed++
+		} else {
+			outcome.ImportedAs = imported.Name
+			result.Added++
+		}
+		result.Outcomes = append(result.Outcomes, outcome)
+	}
+
+	result.Message = fmt.Sprintf("Imported %d template(s) from %s: %d skipped, %d failed",
+		result.Added, source, result.Skipped, result.Failed)
+
+	t.logger.Info("Command templates imported", map[string]interface{}{
+		"source":      source,
+		"on_conflict": policy,
+		"added":       result.Added,
+		"skipped":     result.Skipped,
+		"failed":      result.Failed,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// ExportCommandTemplates returns templates as a portable JSON array, optionally writing them to a file
+func (t *TerminalTools) ExportCommandTemplates(ctx context.Context, req *mcp.CallToolRequest, args ExportTemplatesArgs) (*mcp.CallToolResult, ExportTemplatesResult, error) {
+	wanted := make(map[string]bool, len(args.Names))
+	for _, name := range args.Names {
+		wanted[name] = true
+	}
+
+	templates := make([]*CommandTemplate, 0)
+	for _, tmpl := range t.templateManager.ListTemplates(args.Category) {
+		if len(wanted) == 0 || wanted[tmpl.Name] {
+			templates = append(templates, tmpl)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	result := ExportTemplatesResult{
+		Templates: templates,
+		Count:     len(templates),
+		Message:   fmt.Sprintf("Exported %d template(s)", len(templates)),
+	}
+
+	if args.Path != "" {
+		data, err := json.MarshalIndent(templates, "", "  ")
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to encode templates: %v", err)), ExportTemplatesResult{}, nil
+		}
+		if err := os.WriteFile(args.Path, data, 0o644); err != nil {
+			return createErrorResult(fmt.Sprintf("Failed to write template file: %v", err)), ExportTemplatesResult{}, nil
+		}
+		result.Path = args.Path
+		result.Message = fmt.Sprintf("Exported %d template(s) to %s", len(templates), args.Path)
+
+		t.logger.Info("Command templates exported", map[string]interface{}{
+			"path":  args.Path,
+			"count": len(templates),
+		})
+	}
+
+	return createJSONResult(result), result, nil
+}
@@ -2,9 +2,14 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -58,6 +63,17 @@ func (rl *RateLimiter) Allow() bool {
 	return false
 }
 
+// refund returns a token consumed by a call that another limiter then rejected
+func (rl *RateLimiter) refund() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.tokens++
+	if rl.tokens > rl.maxTokens {
+		rl.tokens = rl.maxTokens
+	}
+}
+
 // GetTokens returns current available tokens (for monitoring)
 func (rl *RateLimiter) GetTokens() float64 {
 	rl.mu.Lock()
@@ -65,6 +81,188 @@ func (rl *RateLimiter) GetTokens() float64 {
 	return rl.tokens
 }
 
+// RateLimiterSnapshot is a point-in-time view of a rate limiter's state
+type RateLimiterSnapshot struct {
+	AvailableTokens float64       // Tokens available now, including refill since the last request
+	MaxTokens       float64       // Burst size
+	RefillRate      float64       // Tokens per second
+	TimeUntilNext   time.Duration // Zero if a token is available now
+}
+
+// Snapshot returns the current limiter state without consuming a token
+func (rl *RateLimiter) Snapshot() RateLimiterSnapshot {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	tokens := rl.tokens + time.Since(rl.lastRefill).Seconds()*rl.refillRate
+	if tokens > rl.maxTokens {
+		tokens = rl.maxTokens
+	}
+
+	var untilNext time.Duration
+	if tokens < 1 && rl.refillRate > 0 {
+		untilNext = time.Duration((1 - tokens) / rl.refillRate * float64(time.Second))
+	}
+
+	return RateLimiterSnapshot{
+		AvailableTokens: tokens,
+		MaxTokens:       rl.maxTokens,
+		RefillRate:      rl.refillRate,
+		TimeUntilNext:   untilNext,
+	}
+}
+
+// Limiter names reported by RateLimitError
+const (
+	rateLimiterSession = "session"
+	rateLimiterProject = "project"
+	rateLimiterGlobal  = "global"
+)
+
+// rateLimitRejections counts the calls each rate limiter has rejected since the server started
+type rateLimitRejections struct {
+	session atomic.Int64
+	project atomic.Int64
+	global  atomic.Int64
+}
+
+// record counts one call rejected by the named limiter
+func (r *rateLimitRejections) record(limiter string) {
+	switch limiter {
+	case rateLimiterSession:
+		r.session.Add(1)
+	case rateLimiterProject:
+		r.project.Add(1)
+	case rateLimiterGlobal:
+		r.global.Add(1)
+	}
+}
+
+// RateLimitRejections returns the number of calls each limiter ("session", "project" and
+// "global") has rejected since the server started
+func (t *TerminalTools) RateLimitRejections() map[string]int64 {
+	return map[string]int64{
+		rateLimiterSession: t.rejections.session.Load(),
+		rateLimiterProject: t.rejections.project.Load(),
+		rateLimiterGlobal:  t.rejections.global.Load(),
+	}
+}
+
+// RateLimitError reports which rate limiter rejected a call
+type RateLimitError struct {
+	Limiter       string // "session", "project" or "global"
+	SessionID     string // Session whose limiter was exceeded, empty for calls without a session
+	ProjectID     string // Project whose limiter was exceeded, for the project limiter
+	RatePerMinute int
+}
+
+func (e *RateLimitError) Error() string {
+	switch e.Limiter {
+	case rateLimiterSession:
+		if e.SessionID == "" {
+			return fmt.Sprintf("rate limit exceeded for calls without a session. Please slow down your requests. Current limit: %d calls per minute", e.RatePerMinute)
+		}
+		return fmt.Sprintf("rate limit exceeded for session %s. Please slow down requests in this session; other sessions are not affected. Current limit: %d calls per minute per session",
+			e.SessionID, e.RatePerMinute)
+	case rateLimiterProject:
+		return fmt.Sprintf("project rate limit exceeded for project %s. Please slow down requests for this project. Current limit: %d calls per minute per project",
+			e.ProjectID, e.RatePerMinute)
+	}
+	return fmt.Sprintf("global rate limit exceeded. Please slow down your requests across all sessions. Current limit: %d calls per minute", e.RatePerMinute)
+}
+
+// keyedRateLimiters holds one token bucket per key (a session or project ID) so a single busy
+// session or project cannot starve the others. Buckets are created on a key's first call.
+type keyedRateLimiters struct {
+	ratePerMinute int
+	burst         int
+	limiters      map[string]*RateLimiter
+	mu            sync.Mutex
+}
+
+// newKeyedRateLimiters returns per-key limiters, or nil when ratePerMinute is not positive so
+// limiting by that key is disabled
+func newKeyedRateLimiters(ratePerMinute, burst int) *keyedRateLimiters {
+	if ratePerMinute <= 0 {
+		return nil
+	}
+	return &keyedRateLimiters{
+		ratePerMinute: ratePerMinute,
+		burst:         burst,
+		limiters:      make(map[string]*RateLimiter),
+	}
+}
+
+// get returns the limiter of key, creating it on first use
+func (k *keyedRateLimiters) get(key string) *RateLimiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	limiter, ok := k.limiters[key]
+	if !ok {
+		limiter = NewRateLimiter(k.ratePerMinute, k.burst)
+		k.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// has reports whether key already has a limiter
+func (k *keyedRateLimiters) has(key string) bool {
+	if k == nil {
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, ok := k.limiters[key]
+	return ok
+}
+
+// remove drops the limiter of key
+func (k *keyedRateLimiters) remove(key string) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.limiters, key)
+}
+
+// prune drops the limiters whose key keep rejects and returns how many were dropped
+func (k *keyedRateLimiters) prune(keep func(key string) bool) int {
+	if k == nil {
+		return 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	pruned := 0
+	for key := range k.limiters {
+		if !keep(key) {
+			delete(k.limiters, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// keys returns the keys that have a limiter, sorted
+func (k *keyedRateLimiters) keys() []string {
+	if k == nil {
+		return nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make([]string, 0, len(k.limiters))
+	for key := range k.limiters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // TerminalTools contains all MCP tools for terminal management with enhanced features
 type TerminalTools struct {
 	manager           *terminal.Manager
@@ -74,16 +272,21 @@ type TerminalTools struct {
 	security          *SecurityValidator
 	projectGen        *utils.ProjectIDGenerator
 	packageManager    *utils.PackageManagerDetector
-	rateLimiter       *RateLimiter       // H2: Rate limiter for tool calls
-	templateManager   *TemplateManager   // F1: Command templates manager
-	snapshotManager   *SnapshotManager   // F2: Session snapshots manager
-	dependencyManager *DependencyManager // F7: Process dependency manager
-	tracer            *tracing.Tracer    // M10: Command execution tracing
+	sessionLimiters   *keyedRateLimiters      // H2: Per-session rate limiters for tool calls
+	projectLimiters   *keyedRateLimiters      // Per-project rate limiters; nil when disabled
+	rateLimiter       *RateLimiter            // Global rate limit across all sessions; nil when disabled
+	rejections        rateLimitRejections     // Calls rejected by each limiter, for metrics
+	templateManager   *TemplateManager        // F1: Command templates manager
+	snapshotManager   *SnapshotManager        // F2: Session snapshots manager
+	workspaceStore    *WorkspaceSnapshotStore // Whole-workspace snapshot bundles
+	dependencyManager *DependencyManager      // F7: Process dependency manager
+	tracer            *tracing.Tracer         // M10: Command execution tracing
+	spanExporter      *tracing.BatchProcessor // OTLP span export; nil when no endpoint is configured
 }
 
 // NewTerminalTools creates a new instance of terminal tools with enhanced features
 func NewTerminalTools(manager *terminal.Manager, cfg *config.Config, logger *logger.Logger, db *database.DB) *TerminalTools {
-	return &TerminalTools{
+	t := &TerminalTools{
 		manager:           manager,
 		config:            cfg,
 		logger:            logger,
@@ -91,22 +294,140 @@ func NewTerminalTools(manager *terminal.Manager, cfg *config.Config, logger *log
 		security:          NewSecurityValidator(cfg),
 		projectGen:        utils.NewProjectIDGenerator(),
 		packageManager:    utils.NewPackageManagerDetector(),
-		rateLimiter:       NewRateLimiter(cfg.Session.RateLimitPerMinute, cfg.Session.RateLimitBurst),
-		templateManager:   NewTemplateManager(),
+		sessionLimiters:   newKeyedRateLimiters(cfg.Session.RateLimitPerMinute, cfg.Session.RateLimitBurst),
+		projectLimiters:   newKeyedRateLimiters(cfg.Session.ProjectRateLimitPerMinute, cfg.Session.ProjectRateLimitBurst),
+		rateLimiter:       newGlobalRateLimiter(cfg.Session.GlobalRateLimitPerMinute, cfg.Session.GlobalRateLimitBurst),
+		templateManager:   NewTemplateManager(cfg.Session.TemplateCacheSize),
 		snapshotManager:   NewSnapshotManager(cfg.Database.DataDir),
+		workspaceStore:    NewWorkspaceSnapshotStore(cfg.Database.DataDir),
 		dependencyManager: NewDependencyManager(),
 		tracer:            tracing.NewTracer("go-term"),
 	}
+
+	if cfg.Monitoring.OTLPEndpoint != "" {
+		exporter := tracing.NewOTLPExporter(cfg.Monitoring.OTLPEndpoint, cfg.Monitoring.OTLPHeaders, cfg.Monitoring.OTLPTimeout, "go-term")
+		t.spanExporter = tracing.NewBatchProcessor(exporter, tracing.BatchOptions{
+			BatchSize:     cfg.Monitoring.OTLPBatchSize,
+			FlushInterval: cfg.Monitoring.OTLPFlushInterval,
+			MaxRetries:    cfg.Monitoring.OTLPMaxRetries,
+			OnError: func(err error, spans int) {
+				logger.Warn("Failed to export trace spans", map[string]interface{}{
+					"endpoint": cfg.Monitoring.OTLPEndpoint,
+					"spans":    spans,
+					"error":    err.Error(),
+				})
+			},
+		})
+		t.tracer.AddSpanProcessor(t.spanExporter)
+	}
+
+	return t
+}
+
+// Shutdown flushes spans waiting for export and stops the exporter
+func (t *TerminalTools) Shutdown() {
+	if err := t.tracer.Shutdown(); err != nil {
+		t.logger.Warn("Failed to shut down tracing", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// readinessTimeout returns the requested readiness wait, falling back to the configured default
+func (t *TerminalTools) readinessTimeout(seconds int) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return t.config.Session.DefaultReadinessTimeout
+}
+
+// newGlobalRateLimiter returns the limiter bounding calls across all sessions, or nil when
+// ratePerMinute is not positive so there is no global bound
+func newGlobalRateLimiter(ratePerMinute, burst int) *RateLimiter {
+	if ratePerMinute <= 0 {
+		return nil
+	}
+	return NewRateLimiter(ratePerMinute, burst)
+}
+
+// CheckRateLimit checks the rate limit of the session and, when enabled, the limit of the
+// session's project and the global limit. Calls without a session, or naming a session that does
+// not exist, share one bucket. It returns a *RateLimitError naming the limiter that was exceeded.
+func (t *TerminalTools) CheckRateLimit(sessionID string) error {
+	sessionKey, projectID := "", ""
+	if sessionID != "" {
+		if session, err := t.manager.GetSession(sessionID); err == nil {
+			sessionKey, projectID = sessionID, session.ProjectID
+		}
+	}
+	return t.checkRateLimits(sessionKey, projectID)
+}
+
+// CheckProjectRateLimit checks the rate limit for a call made on behalf of projectID without a
+// session, such as creating one. An empty project ID skips the project limit.
+func (t *TerminalTools) CheckProjectRateLimit(projectID string) error {
+	return t.checkRateLimits("", projectID)
+}
+
+// ForgetSessionRateLimit drops the rate limiter of a deleted session
+func (t *TerminalTools) ForgetSessionRateLimit(sessionID string) {
+	if sessionID != "" {
+		t.sessionLimiters.remove(sessionID)
+	}
+}
+
+// sessionRateLimiter returns the limiter of sessionKey. Creating a bucket first drops those of
+// sessions that have since been deleted, so buckets do not pile up for sessions removed by idle
+// cleanup rather than delete_session.
+func (t *TerminalTools) sessionRateLimiter(sessionKey string) *RateLimiter {
+	if sessionKey != "" && !t.sessionLimiters.has(sessionKey) {
+		t.sessionLimiters.prune(func(key string) bool {
+			return key == "" || t.manager.SessionExists(key)
+		})
+	}
+	return t.sessionLimiters.get(sessionKey)
+}
+
+// rateLimitCheck is one limiter a call has to pass
+type rateLimitCheck struct {
+	limiter *RateLimiter
+	err     *RateLimitError // Returned when the limiter rejects the call
 }
 
-// CheckRateLimit checks if the rate limit is exceeded and returns an error if so
-func (t *TerminalTools) CheckRateLimit() error {
-	if !t.rateLimiter.Allow() {
+// checkRateLimits takes a token from the session's, the project's and the global limiter in that
+// order. A call rejected by one limiter gets its tokens back from the limiters it already passed.
+func (t *TerminalTools) checkRateLimits(sessionKey, projectID string) error {
+	checks := []rateLimitCheck{{
+		limiter: t.sessionRateLimiter(sessionKey),
+		err:     &RateLimitError{Limiter: rateLimiterSession, SessionID: sessionKey, RatePerMinute: t.config.Session.RateLimitPerMinute},
+	}}
+	if projectID != "" && t.projectLimiters != nil {
+		checks = append(checks, rateLimitCheck{
+			limiter: t.projectLimiters.get(projectID),
+			err:     &RateLimitError{Limiter: rateLimiterProject, ProjectID: projectID, RatePerMinute: t.config.Session.ProjectRateLimitPerMinute},
+		})
+	}
+	if t.rateLimiter != nil {
+		checks = append(checks, rateLimitCheck{
+			limiter: t.rateLimiter,
+			err:     &RateLimitError{Limiter: rateLimiterGlobal, RatePerMinute: t.config.Session.GlobalRateLimitPerMinute},
+		})
+	}
+
+	for i, check := range checks {
+		if check.limiter.Allow() {
+			continue
+		}
+		// The call is rejected, so it must not count against the limiters it passed either
+		for _, passed := range checks[:i] {
+			passed.limiter.refund()
+		}
+		t.rejections.record(check.err.Limiter)
 		t.logger.Warn("Rate limit exceeded", map[string]interface{}{
-			"available_tokens": t.rateLimiter.GetTokens(),
+			"limiter":          check.err.Limiter,
+			"session_id":       check.err.SessionID,
+			"project_id":       check.err.ProjectID,
+			"available_tokens": check.limiter.GetTokens(),
 		})
-		return fmt.Errorf("rate limit exceeded. Please slow down your requests. Current limit: %d calls per minute",
-			t.config.Session.RateLimitPerMinute)
+		return check.err
 	}
 	return nil
 }
@@ -120,7 +441,7 @@ type CreateCommandTemplateArgs struct {
 	Name        string `json:"name" jsonschema:"required,description=Unique name for the template"`
 	Command     string `json:"command" jsonschema:"required,description=Command template with optional {{variable}} placeholders"`
 	Description string `json:"description,omitempty" jsonschema:"description=Description of what the template does"`
-	Category    string `json:"category,omitempty" jsonschema:"description=Category for organizing templates"`
+	Category    string `json:"category,omitempty" jsonschema:"description=Category for organizing templates (inferred from the command when omitted)"`
 }
 
 // CreateCommandTemplate creates a new command template
@@ -131,14 +452,16 @@ func (t *TerminalTools) CreateCommandTemplate(ctx context.Context, req *mcp.Call
 		Description: args.Description,
 		Category:    args.Category,
 	}
+	t.inferMissingCategory(template)
 
 	if err := t.templateManager.AddTemplate(template); err != nil {
 		return createErrorResult(fmt.Sprintf("Failed to create template: %v", err)), nil, nil
 	}
 
 	t.logger.Info("Command template created", map[string]interface{}{
-		"name":     args.Name,
-		"category": args.Category,
+		"name":              args.Name,
+		"category":          template.Category,
+		"category_inferred": template.CategoryInferred,
 	})
 
 	return createJSONResult(template), template, nil
@@ -179,37 +502,120 @@ func (t *TerminalTools) ExpandCommandTemplate(ctx context.Context, req *mcp.Call
 // F6: Output Search Tool Wrapper
 // =============================================================================
 
-// SearchCommandOutput searches through command outputs
+// SearchCommandOutput searches through command outputs. Without a session_id it searches the
+// most recent commands of every session, optionally narrowed to one project.
 func (t *TerminalTools) SearchCommandOutput(ctx context.Context, req *mcp.CallToolRequest, args SearchOutputArgs) (*mcp.CallToolResult, SearchOutputResult, error) {
-	// Get session to validate it exists
-	session, err := t.manager.GetSession(args.SessionID)
-	if err != nil {
-		return createErrorResult(fmt.Sprintf("Session not found: %v", err)), SearchOutputResult{}, nil
+	if args.Pattern == "" {
+		return createErrorResult("Search pattern cannot be empty"), SearchOutputResult{}, nil
+	}
+	if args.SortBy == "" {
+		args.SortBy = SearchSortRecency
+	}
+	if args.SortBy != SearchSortRecency && args.SortBy != SearchSortRelevance {
+		return createErrorResult(fmt.Sprintf("Invalid sort_by '%s'. Valid values: %s, %s", args.SortBy, SearchSortRecency, SearchSortRelevance)), SearchOutputResult{}, nil
+	}
+	if t.database == nil {
+		return createErrorResult("Command history database is not enabled"), SearchOutputResult{}, nil
 	}
 
-	// Get command history from database using SearchCommands
-	maxResults := args.MaxResults
-	if maxResults <= 0 {
-		maxResults = 100
+	var workingDir string
+	var scanLimit int
+	if args.SessionID != "" {
+		// Get session to validate it exists
+		session, err := t.manager.GetSession(args.SessionID)
+		if err != nil {
+			return createErrorResult(fmt.Sprintf("Session not found: %v", err)), SearchOutputResult{}, nil
+		}
+		workingDir = session.GetWorkingDir()
+
+		if args.MaxResults <= 0 {
+			args.MaxResults = 100
+		}
+		scanLimit = args.MaxResults
+	} else {
+		// Cross-session searches scan a fixed window of recent commands and cap the matches
+		if args.MaxResults <= 0 {
+			args.MaxResults = DefaultSearchLimit
+		}
+		if args.MaxResults > MaxSearchLimit {
+			args.MaxResults = MaxSearchLimit
+		}
+		scanLimit = CrossSessionSearchScanLimit
 	}
-	commands, err := t.database.SearchCommands(args.SessionID, "", "", "", nil, time.Time{}, time.Time{}, maxResults)
+
+	// Get command history from database using SearchCommands
+	commands, err := t.database.SearchCommands(args.SessionID, args.ProjectID, "", "", nil, time.Time{}, time.Time{}, nil, scanLimit)
 	if err != nil {
 		return createErrorResult(fmt.Sprintf("Failed to get command history: %v", err)), SearchOutputResult{}, nil
 	}
 
 	// Perform search through the outputs
-	result := searchCommandOutputsInternal(commands, args, session.WorkingDir)
+	result, err := searchCommandOutputsInternal(commands, args, workingDir, t.config.Database.OutputSearchWorkers)
+	if err != nil {
+		return createErrorResult(err.Error()), SearchOutputResult{}, nil
+	}
+
+	// Name the sessions that are still open so matches can be placed without another lookup
+	sessionNames := make(map[string]string)
+	for i := range result.Matches {
+		sessionID := result.Matches[i].SessionID
+		name, seen := sessionNames[sessionID]
+		if !seen {
+			if session, err := t.manager.GetSession(sessionID); err == nil {
+				name = session.Name
+			}
+			sessionNames[sessionID] = name
+		}
+		result.Matches[i].SessionName = name
+	}
+	result.SessionsMatched = len(sessionNames)
+
+	if args.SessionID == "" {
+		t.logger.Info("Cross-session output search completed", map[string]interface{}{
+			"pattern":          args.Pattern,
+			"project_id":       args.ProjectID,
+			"matches":          result.TotalMatches,
+			"sessions_matched": result.SessionsMatched,
+		})
+	}
 
 	return createJSONResult(result), result, nil
 }
 
-// searchCommandOutputsInternal performs the actual search through command outputs
-func searchCommandOutputsInternal(commands []*database.CommandRecord, args SearchOutputArgs, workingDir string) SearchOutputResult {
-	var matches []SearchOutputMatch
-	pattern := args.Pattern
+// outputLineMatcher returns a function reporting whether an output line matches the search
+// pattern, honoring the regex and case sensitivity options
+func outputLineMatcher(args SearchOutputArgs) (func(string) bool, error) {
+	if args.IsRegex {
+		flags := ""
+		if !args.CaseSensitive {
+			flags = "(?i)"
+		}
+		re, err := regexp.Compile(flags + args.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	if args.CaseSensitive {
+		return func(line string) bool {
+			return strings.Contains(line, args.Pattern)
+		}, nil
+	}
+	pattern := strings.ToLower(args.Pattern)
+	return func(line string) bool {
+		return strings.Contains(strings.ToLower(line), pattern)
+	}, nil
+}
 
-	if !args.CaseSensitive {
-		pattern = strings.ToLower(pattern)
+// searchCommandOutputsInternal performs the actual search through command outputs. The outputs
+// are scanned by up to workers goroutines; matches are then ordered by args.SortBy, newest
+// commands first for recency and most matching lines first for relevance. Ties are broken by
+// recency and then command ID, so the order never depends on how the scan was scheduled.
+func searchCommandOutputsInternal(commands []*database.CommandRecord, args SearchOutputArgs, workingDir string, workers int) (SearchOutputResult, error) {
+	matchLine, err := outputLineMatcher(args)
+	if err != nil {
+		return SearchOutputResult{}, err
 	}
 
 	contextLines := args.IncludeContext
@@ -217,46 +623,54 @@ func searchCommandOutputsInternal(commands []*database.CommandRecord, args Searc
 		contextLines = 2
 	}
 
-	for _, cmd := range commands {
-		output := cmd.Output
-		searchOutput := output
-		if !args.CaseSensitive {
-			searchOutput = strings.ToLower(output)
+	// Each worker writes only the slots of the commands it scanned
+	perCommand := make([][]SearchOutputMatch, len(commands))
+	if workers > len(commands) {
+		workers = len(commands)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				perCommand[i] = searchCommandOutput(commands[i], matchLine, contextLines)
+			}
+		}()
+	}
+	for i := range commands {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Order the commands with matches, keeping each command's matches in line order
+	var ranked []int
+	for i, found := range perCommand {
+		if len(found) > 0 {
+			ranked = append(ranked, i)
 		}
-
-		if strings.Contains(searchOutput, pattern) {
-			// Find the line numbers with matches
-			lines := strings.Split(output, "\n")
-			for lineNum, line := range lines {
-				searchLine := line
-				if !args.CaseSensitive {
-					searchLine = strings.ToLower(line)
-				}
-				if strings.Contains(searchLine, pattern) {
-					match := SearchOutputMatch{
-						CommandID:   cmd.ID,
-						SessionID:   cmd.SessionID,
-						Command:     cmd.Command,
-						LineNumber:  lineNum + 1,
-						MatchedText: line,
-						Timestamp:   cmd.Timestamp.Format(time.RFC3339),
-					}
-
-					// Add context lines
-					start := lineNum - contextLines
-					if start < 0 {
-						start = 0
-					}
-					end := lineNum + contextLines + 1
-					if end > len(lines) {
-						end = len(lines)
-					}
-					match.Context = lines[start:end]
-
-					matches = append(matches, match)
-				}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		x, y := commands[ranked[a]], commands[ranked[b]]
+		if args.SortBy == SearchSortRelevance {
+			if nx, ny := len(perCommand[ranked[a]]), len(perCommand[ranked[b]]); nx != ny {
+				return nx > ny
 			}
 		}
+		if !x.Timestamp.Equal(y.Timestamp) {
+			return x.Timestamp.After(y.Timestamp)
+		}
+		return x.ID < y.ID
+	})
+
+	var matches []SearchOutputMatch
+	for _, i := range ranked {
+		matches = append(matches, perCommand[i]...)
 	}
 
 	truncated := false
@@ -269,11 +683,55 @@ func searchCommandOutputsInternal(commands []*database.CommandRecord, args Searc
 	return SearchOutputResult{
 		Pattern:      args.Pattern,
 		IsRegex:      args.IsRegex,
+		SortBy:       args.SortBy,
 		TotalMatches: len(matches),
 		Matches:      matches,
 		SearchTime:   time.Now().Format(time.RFC3339),
 		Truncated:    truncated,
+	}, nil
+}
+
+// searchCommandOutput returns the matching lines of one command's output with their context
+func searchCommandOutput(cmd *database.CommandRecord, matchLine func(string) bool, contextLines int) []SearchOutputMatch {
+	if cmd.Output == "" {
+		return nil
 	}
+
+	var matches []SearchOutputMatch
+	lines := strings.Split(cmd.Output, "\n")
+	for lineNum, line := range lines {
+		if !matchLine(line) {
+			continue
+		}
+
+		match := SearchOutputMatch{
+			CommandID:   cmd.ID,
+			SessionID:   cmd.SessionID,
+			ProjectID:   cmd.ProjectID,
+			Command:     cmd.Command,
+			LineNumber:  lineNum + 1,
+			MatchedText: line,
+			Timestamp:   cmd.Timestamp.Format(time.RFC3339),
+		}
+
+		// Add context lines
+		start := lineNum - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := lineNum + contextLines + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		match.Context = lines[start:end]
+
+		matches = append(matches, match)
+	}
+
+	for i := range matches {
+		matches[i].LineMatches = len(matches)
+	}
+	return matches
 }
 
 // =============================================================================
@@ -295,15 +753,18 @@ func (t *TerminalTools) SaveSessionSnapshot(ctx context.Context, req *mcp.CallTo
 	}
 
 	snapshot := &SessionSnapshot{
-		SessionID:   args.SessionID,
-		Name:        args.Name,
-		Description: args.Description,
-		WorkingDir:  session.WorkingDir,
-		Environment: session.Environment,
-		CreatedAt:   time.Now(),
+		SessionID:    args.SessionID,
+		Name:         args.Name,
+		Description:  args.Description,
+		ProjectID:    session.ProjectID,
+		WorkingDir:   session.GetWorkingDir(),
+		CurrentDir:   session.GetCurrentDir(),
+		Environment:  session.GetAllEnvironment(),
+		CommandCount: session.CommandCount,
 	}
 
-	if err := t.snapshotManager.saveSnapshot(snapshot); err != nil {
+	// CreateSnapshot assigns the ID and registers the snapshot under the manager's lock
+	if err := t.snapshotManager.CreateSnapshot(snapshot); err != nil {
 		return createErrorResult(fmt.Sprintf("Failed to save snapshot: %v", err)), nil, nil
 	}
 
@@ -326,14 +787,95 @@ func NewSecurityValidator(cfg *config.Config) *SecurityValidator {
 	return &SecurityValidator{config: cfg}
 }
 
+// Security rule types reported in a SecurityDecision
+const (
+	RuleTypeEmptyCommand     = "empty_command"
+	RuleTypeMaxLength        = "max_length"
+	RuleTypeBlockedCommand   = "blocked_command"
+	RuleTypeDangerousPattern = "dangerous_pattern"
+	RuleTypeNetworkAccess    = "network_access"
+	RuleTypeFilesystemWrite  = "filesystem_write"
+)
+
+// SecurityDecision describes why a command was allowed or blocked
+type SecurityDecision struct {
+	Allowed     bool   `json:"allowed"`
+	RuleType    string `json:"rule_type,omitempty"`    // Category of the rule that blocked the command
+	MatchedRule string `json:"matched_rule,omitempty"` // Blocklist entry or pattern that matched
+	Reason      string `json:"reason,omitempty"`
+}
+
+// blocked builds a decision rejecting a command
+func blocked(ruleType, matchedRule, reason string) SecurityDecision {
+	return SecurityDecision{Allowed: false, RuleType: ruleType, MatchedRule: matchedRule, Reason: reason}
+}
+
 // ValidateCommand validates a command against security policies
 func (s *SecurityValidator) ValidateCommand(command string) error {
-	if command == "" {
-		return fmt.Errorf("command cannot be empty")
+	decision := s.EvaluateCommand(command)
+	if !decision.Allowed {
+		return errors.New(decision.Reason)
+	}
+	return nil
+}
+
+// EvaluateCommand checks a command against security policies and reports which rule, if any, blocked it
+func (s *SecurityValidator) EvaluateCommand(command string) SecurityDecision {
+	return s.EvaluateCommandWithPolicy(command, nil)
+}
+
+// securityRules are the checks a command goes through: the global settings, tightened by a
+// session's policy
+type securityRules struct {
+	blockedCommands      []string
+	sandbox              bool // Check dangerous patterns
+	blockNetwork         bool
+	blockFileSystemWrite bool
+}
+
+// rulesFor combines the global settings with policy. Blocklists are merged, and a session flag
+// applies even when the global sandbox is off.
+func (s *SecurityValidator) rulesFor(policy *terminal.SecurityPolicy) securityRules {
+	global := s.config.Security
+	rules := securityRules{
+		blockedCommands:      global.BlockedCommands,
+		sandbox:              global.EnableSandbox,
+		blockNetwork:         global.EnableSandbox && !global.AllowNetworkAccess,
+		blockFileSystemWrite: global.EnableSandbox && !global.AllowFileSystemWrite,
+	}
+	if policy == nil {
+		return rules
+	}
+
+	if len(policy.BlockedCommands) > 0 {
+		rules.blockedCommands = append(append([]string(nil), global.BlockedCommands...), policy.BlockedCommands...)
+	}
+	if policy.EnableSandbox != nil && *policy.EnableSandbox {
+		rules.sandbox = true
+		rules.blockNetwork = rules.blockNetwork || !global.AllowNetworkAccess
+		rules.blockFileSystemWrite = rules.blockFileSystemWrite || !global.AllowFileSystemWrite
+	}
+	if policy.AllowNetworkAccess != nil && !*policy.AllowNetworkAccess {
+		rules.blockNetwork = true
+	}
+	if policy.AllowFileSystemWrite != nil && !*policy.AllowFileSystemWrite {
+		rules.blockFileSystemWrite = true
+	}
+	return rules
+}
+
+// EvaluateCommandWithPolicy checks a command against the global security settings tightened by a
+// session's policy; a nil policy applies the global settings alone
+func (s *SecurityValidator) EvaluateCommandWithPolicy(command string, policy *terminal.SecurityPolicy) SecurityDecision {
+	rules := s.rulesFor(policy)
+
+	if err := validateCommandText(command, s.config.Security.AllowCommentOnlyCommands); err != nil {
+		return blocked(RuleTypeEmptyCommand, "", err.Error())
 	}
 
 	if len(command) > s.config.Session.MaxCommandLength {
-		return fmt.Errorf("command cannot exceed %d characters", s.config.Session.MaxCommandLength)
+		return blocked(RuleTypeMaxLength, strconv.Itoa(s.config.Session.MaxCommandLength),
+			fmt.Sprintf("command cannot exceed %d characters", s.config.Session.MaxCommandLength))
 	}
 
 	// Check for blocked commands using word boundaries to avoid false positives
@@ -342,8 +884,8 @@ func (s *SecurityValidator) ValidateCommand(command string) error {
 	// Split command into words for more precise validation
 	commandWords := strings.Fields(lowerCommand)
 
-	for _, blocked := range s.config.Security.BlockedCommands {
-		blockedLower := strings.ToLower(blocked)
+	for _, blockedCmd := range rules.blockedCommands {
+		blockedLower := strings.ToLower(blockedCmd)
 
 		// Single-word blocked commands: check word-by-word with word boundaries
 		if !strings.ContainsAny(blockedLower, " -/") {
@@ -352,7 +894,7 @@ func (s *SecurityValidator) ValidateCommand(command string) error {
 				cleanWord := strings.Trim(word, ";&|(){}[]<>\"'`")
 
 				if cleanWord == blockedLower {
-					return fmt.Errorf("command contains blocked operation: %s", blocked)
+					return blocked(RuleTypeBlockedCommand, blockedCmd, fmt.Sprintf("command contains blocked operation: %s", blockedCmd))
 				}
 			}
 			continue
@@ -361,12 +903,12 @@ func (s *SecurityValidator) ValidateCommand(command string) error {
 		// Multi-word or pattern-based blocked commands: check for exact substring match
 		// with word boundary awareness for patterns like "rm -rf /"
 		if s.containsBlockedPattern(lowerCommand, blockedLower) {
-			return fmt.Errorf("command contains blocked operation: %s", blocked)
+			return blocked(RuleTypeBlockedCommand, blockedCmd, fmt.Sprintf("command contains blocked operation: %s", blockedCmd))
 		}
 	}
 
 	// Additional security checks
-	if s.config.Security.EnableSandbox {
+	if rules.sandbox {
 		// Check for potentially dangerous patterns using word boundaries
 		dangerousPatterns := []string{
 			"rm -rf /",
@@ -381,34 +923,66 @@ func (s *SecurityValidator) ValidateCommand(command string) error {
 
 		for _, pattern := range dangerousPatterns {
 			if s.containsBlockedPattern(lowerCommand, pattern) {
-				return fmt.Errorf("command contains potentially dangerous pattern: %s", pattern)
+				return blocked(RuleTypeDangerousPattern, pattern, fmt.Sprintf("command contains potentially dangerous pattern: %s", pattern))
 			}
 		}
 
-		// Check for network access if not allowed
-		if !s.config.Security.AllowNetworkAccess {
-			networkCommands := []string{"wget", "curl", "ssh", "scp", "rsync", "nc", "netcat", "telnet"}
-			for _, netCmd := range networkCommands {
-				if s.isCommandPresent(lowerCommand, netCmd) {
-					return fmt.Errorf("network access not allowed: %s", netCmd)
-				}
+	}
+
+	// Check for network access if not allowed
+	if rules.blockNetwork {
+		networkCommands := []string{"wget", "curl", "ssh", "scp", "rsync", "nc", "netcat", "telnet"}
+		for _, netCmd := range networkCommands {
+			if s.isCommandPresent(lowerCommand, netCmd) {
+				return blocked(RuleTypeNetworkAccess, netCmd, fmt.Sprintf("network access not allowed: %s", netCmd))
 			}
 		}
+	}
 
-		// Check for file system write operations if not allowed
-		if !s.config.Security.AllowFileSystemWrite {
-			writeCommands := []string{"rm", "mv", "cp", "touch", "mkdir", "rmdir"}
-			for _, writeCmd := range writeCommands {
-				if s.isCommandPresent(lowerCommand, writeCmd) {
-					return fmt.Errorf("file system write operations not allowed: %s", writeCmd)
-				}
+	// Check for file system write operations if not allowed
+	if rules.blockFileSystemWrite {
+		writeCommands := []string{"rm", "mv", "cp", "touch", "mkdir", "rmdir"}
+		for _, writeCmd := range writeCommands {
+			if s.isCommandPresent(lowerCommand, writeCmd) {
+				return blocked(RuleTypeFilesystemWrite, writeCmd, fmt.Sprintf("file system write operations not allowed: %s", writeCmd))
 			}
 		}
 	}
 
+	return SecurityDecision{Allowed: true}
+}
+
+// evaluateCommandForSession checks a command against the settings that apply to a session. An
+// unknown session gets the global settings; callers report the missing session themselves.
+func (t *TerminalTools) evaluateCommandForSession(sessionID, command string) SecurityDecision {
+	var policy *terminal.SecurityPolicy
+	if session, err := t.manager.GetSession(sessionID); err == nil {
+		policy = session.SecurityPolicy
+	}
+	return t.security.EvaluateCommandWithPolicy(command, policy)
+}
+
+// ValidateCommandForSession validates a command against the global security settings tightened by
+// the session's own policy
+func (t *TerminalTools) ValidateCommandForSession(sessionID, command string) error {
+	decision := t.evaluateCommandForSession(sessionID, command)
+	if !decision.Allowed {
+		return errors.New(decision.Reason)
+	}
 	return nil
 }
 
+// logSecurityDecision records allowed commands when security decision logging is enabled
+func (t *TerminalTools) logSecurityDecision(sessionID, command string, decision SecurityDecision) {
+	if !decision.Allowed || !t.config.Security.LogDecisions {
+		return
+	}
+	t.logger.LogSecurityEvent("command_allowed", command, "low", map[string]interface{}{
+		"session_id": sessionID,
+		"command":    command,
+	})
+}
+
 // containsBlockedPattern checks if a command contains a blocked pattern with awareness of context.
 // It uses substring matching but ensures the pattern is not part of a larger word in most cases.
 func (s *SecurityValidator) containsBlockedPattern(command, pattern string) bool {
@@ -447,21 +1021,86 @@ type CreateSessionArgs struct {
 	Name       string `json:"name" jsonschema:"required,description=Simple descriptive name for the terminal session"`
 	ProjectID  string `json:"project_id,omitempty" jsonschema:"description=Optional: Custom project ID to group related sessions. Auto-generated from directory name if not provided."`
 	WorkingDir string `json:"working_dir,omitempty" jsonschema:"description=Optional: Starting directory for the session. Uses current directory if not specified."`
+
+	SecurityPolicy *terminal.SecurityPolicy `json:"security_policy,omitempty" jsonschema:"description=Optional: Session-level security policy that can only tighten the global settings"`
+	AutoCreateDirs bool                     `json:"auto_create_dirs,omitempty" jsonschema:"description=Optional: Create missing directories (like mkdir -p) when a command cds into them instead of refusing the command. Directories are only created within the allowed working directories."`
 }
 
 // CreateSessionResult represents the result of creating a terminal session with project info
 type CreateSessionResult struct {
-	SessionID    string                      `json:"session_id"`
-	Name         string                      `json:"name"`
-	ProjectID    string                      `json:"project_id"`
-	WorkingDir   string                      `json:"working_dir"`
-	Message      string                      `json:"message"`
-	ProjectInfo  utils.ProjectIDInfo         `json:"project_info"`
-	Instructions utils.ProjectIDInstructions `json:"instructions"`
+	SessionID      string                      `json:"session_id"`
+	Name           string                      `json:"name"`                     // Name assigned, suffixed when session.unique_names avoided a duplicate
+	RequestedName  string                      `json:"requested_name,omitempty"` // Name asked for, when it differs from Name
+	ProjectID      string                      `json:"project_id"`
+	WorkingDir     string                      `json:"working_dir"`
+	SecurityPolicy *terminal.SecurityPolicy    `json:"security_policy,omitempty"`
+	AutoCreateDirs bool                        `json:"auto_create_dirs,omitempty"`
+	Message        string                      `json:"message"`
+	ProjectInfo    utils.ProjectIDInfo         `json:"project_info"`
+	Instructions   utils.ProjectIDInstructions `json:"instructions"`
+}
+
+// CloneSessionArgs represents arguments for cloning a terminal session
+type CloneSessionArgs struct {
+	SourceSessionID string `json:"source_session_id" jsonschema:"required,description=The session to copy the working directory, environment, shell options and aliases from"`
+	Name            string `json:"name,omitempty" jsonschema:"description=Optional: Name of the new session. Defaults to the source's name with a -copy suffix."`
+}
+
+// CloneSessionResult represents the result of cloning a terminal session
+type CloneSessionResult struct {
+	SourceSessionID    string                   `json:"source_session_id"`
+	SessionID          string                   `json:"session_id"`
+	Name               string                   `json:"name"`
+	ProjectID          string                   `json:"project_id"`
+	WorkingDir         string                   `json:"working_dir"`
+	CurrentDir         string                   `json:"current_dir"`
+	EnvironmentCopied  int                      `json:"environment_copied"`  // Variables in the new session
+	EnvironmentMatches bool                     `json:"environment_matches"` // Whether the new session's environment equals the source's
+	ShellOptions       []string                 `json:"shell_options,omitempty"`
+	AliasesCopied      int                      `json:"aliases_copied"`
+	SecurityPolicy     *terminal.SecurityPolicy `json:"security_policy,omitempty"`
+	Message            string                   `json:"message"`
+}
+
+// RelocateSessionArgs represents arguments for moving a session to a new working directory
+type RelocateSessionArgs struct {
+	SessionID         string `json:"session_id" jsonschema:"required,description=The session to relocate"`
+	NewWorkingDir     string `json:"new_working_dir" jsonschema:"required,description=Existing directory the session's project now lives in; must be within allowed_working_dirs"`
+	RestartBackground bool   `json:"restart_background,omitempty" jsonschema:"description=Restart running background processes in the matching directory under new_working_dir (requires confirm)"`
+	Force             bool   `json:"force,omitempty" jsonschema:"description=Kill background processes immediately instead of stopping them gracefully before the restart"`
+	Confirm           bool   `json:"confirm,omitempty" jsonschema:"description=Must be true together with restart_background"`
+}
+
+// RelocatedProcess describes a running background process during a session relocation
+type RelocatedProcess struct {
+	ProcessID     string `json:"process_id"`
+	Command       string `json:"command"`
+	OldWorkingDir string `json:"old_working_dir"`
+	NewWorkingDir string `json:"new_working_dir,omitempty"`
+	OldPID        int    `json:"old_pid"`
+	NewPID        int    `json:"new_pid,omitempty"`
+	Reason        string `json:"reason,omitempty"` // Why the process was not moved
+}
+
+// RelocateSessionResult represents the result of moving a session to a new working directory
+type RelocateSessionResult struct {
+	SessionID     string             `json:"session_id"`
+	OldWorkingDir string             `json:"old_working_dir"`
+	NewWorkingDir string             `json:"new_working_dir"`
+	OldCurrentDir string             `json:"old_current_dir"`
+	NewCurrentDir string             `json:"new_current_dir"`
+	Restarted     []RelocatedProcess `json:"restarted"`
+	NotMoved      []RelocatedProcess `json:"not_moved"` // Still running where they were
+	Message       string             `json:"message"`
 }
 
 // ListSessionsArgs represents arguments for listing terminal sessions (no args needed)
-type ListSessionsArgs struct{}
+type ListSessionsArgs struct {
+	SortBy        string `json:"sort_by,omitempty" jsonschema:"description=Optional sort order: by_commands, by_failures, by_last_used or by_idle. Omit to keep the default order."`
+	ActiveOnly    bool   `json:"active_only,omitempty" jsonschema:"description=Only include active sessions"`
+	HasBackground bool   `json:"has_background,omitempty" jsonschema:"description=Only include sessions with running background processes"`
+	MinCommands   int    `json:"min_commands,omitempty" jsonschema:"description=Only include sessions with at least this many commands"`
+}
 
 // SessionInfo represents comprehensive session information for listing
 type SessionInfo struct {
@@ -477,6 +1116,14 @@ type SessionInfo struct {
 	SuccessCount  int               `json:"success_count"`
 	SuccessRate   float64           `json:"success_rate"`
 	TotalDuration string            `json:"total_duration"`
+	FailureCount  int               `json:"failure_count"`
+	IdleTime      string            `json:"idle_time"`
+	// Running background processes in this session
+	BackgroundProcessCount int `json:"background_process_count"`
+	// Whether the session's shell process is alive with its pipes open
+	ShellHealthy bool `json:"shell_healthy"`
+	// Session-level tightening of the global security settings
+	SecurityPolicy *terminal.SecurityPolicy `json:"security_policy,omitempty"`
 }
 
 // ListSessionsResult represents the enhanced result of listing terminal sessions
@@ -487,6 +1134,21 @@ type ListSessionsResult struct {
 	ProjectStats map[string]ProjectSummary `json:"project_stats"`
 }
 
+// CheckSessionHealthArgs represents arguments for checking a session's shell health
+type CheckSessionHealthArgs struct {
+	SessionID    string `json:"session_id" jsonschema:"required,description=The session ID to check"`
+	RestartShell bool   `json:"restart_shell,omitempty" jsonschema:"description=Replace the shell with a fresh one if it is unhealthy (default: false)"`
+}
+
+// CheckSessionHealthResult represents the health of a session's shell
+type CheckSessionHealthResult struct {
+	Health    terminal.SessionHealth `json:"health"`
+	Usable    bool                   `json:"usable"`
+	Restarted bool                   `json:"restarted"`
+	OldPID    int                    `json:"old_shell_pid,omitempty"` // Set when the shell was restarted
+	Message   string                 `json:"message"`
+}
+
 // ProjectSummary provides a summary of sessions per project
 type ProjectSummary struct {
 	ProjectID     string `json:"project_id"`
@@ -512,9 +1174,17 @@ type DeleteSessionResult struct {
 
 // RunCommandArgs represents arguments for running a foreground command
 type RunCommandArgs struct {
-	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the terminal session to run the command in. Use list_terminal_sessions to see available sessions."`
-	Command   string `json:"command" jsonschema:"required,description=The command to execute in the terminal session. Will be validated for security before execution. Directory changes (cd) persist across commands. This tool only runs foreground commands - use run_background_process for long-running processes."`
-	Timeout   int    `json:"timeout,omitempty" jsonschema:"description=Optional: Command timeout in seconds. Default: 60 seconds. Maximum: 300 seconds (5 minutes). Set to 0 to use default timeout."`
+	SessionID         string            `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the terminal session to run the command in. Use list_terminal_sessions to see available sessions."`
+	Command           string            `json:"command" jsonschema:"required,description=The command to execute in the terminal session. Will be validated for security before execution. Directory changes (cd) persist across commands. This tool only runs foreground commands - use run_background_process for long-running processes."`
+	Timeout           int               `json:"timeout,omitempty" jsonschema:"description=Optional: Command timeout in seconds. Default: 60 seconds. Maximum: 300 seconds (5 minutes), or command_max_timeout with an idle timeout. Set to 0 to use default timeout."`
+	Env               map[string]string `json:"env,omitempty" jsonschema:"description=Optional: Extra environment variables for this command only. Merged on top of the session environment without modifying it."`
+	Stdin             string            `json:"stdin,omitempty" jsonschema:"description=Optional: Text written to the command's standard input, which is closed afterwards. Use to answer prompts or pipe data into interactive commands."`
+	Tags              []string          `json:"tags,omitempty" jsonschema:"description=Optional: Labels stored with the command in history for filtering with search_history. Tools such as git npm and docker are tagged automatically."`
+	DryRun            bool              `json:"dry_run,omitempty" jsonschema:"description=Optional: Only validate the command and detect the package manager and project type without running it. Nothing is recorded."`
+	UsePTY            bool              `json:"use_pty,omitempty" jsonschema:"description=Optional: Run the command attached to a pseudo-terminal so TTY-sensitive tools behave as in a terminal. Stdout and stderr are then merged into output."`
+	MaxOutputBytes    int               `json:"max_output_bytes,omitempty" jsonschema:"description=Optional: Maximum bytes of output to capture. Beyond it the start and end are kept and the middle is replaced by an '[output truncated, N bytes omitted]' line. Default and maximum: the server's max_output_size."`
+	IdleTimeout       int               `json:"idle_timeout,omitempty" jsonschema:"description=Optional: Stop the command once it has produced no output for this many seconds. timeout then caps the total run time and may go up to the server's command_max_timeout (30 minutes by default), which is also the default."`
+	AllowProtectedDir bool              `json:"allow_protected_dir,omitempty" jsonschema:"description=Optional: Run a destructive command even though the session is in the server's installation or data directory or a protected path and server_dir_guard is block."`
 }
 
 // RunCommandResult represents the result of running a foreground command
@@ -523,25 +1193,69 @@ type RunCommandResult struct {
 	ProjectID      string `json:"project_id"`                // Project identifier
 	Command        string `json:"command"`                   // The executed command
 	Output         string `json:"output"`                    // Standard output
-	ErrorOutput    string `json:"error_output,omitempty"`    // Error output if any
+	ErrorOutput    string `json:"error_output,omitempty"`    // Standard error, or the error itself if the command failed silently
+	CombinedOutput string `json:"combined_output,omitempty"` // Stdout and stderr interleaved as they were written
 	Success        bool   `json:"success"`                   // Whether command succeeded
 	ExitCode       int    `json:"exit_code"`                 // Exit code from command
 	Duration       string `json:"duration"`                  // Time taken to execute
 	WorkingDir     string `json:"working_dir"`               // Working directory during execution
 	CommandCount   int    `json:"command_count"`             // Total commands run in session
 	HistoryID      string `json:"history_id"`                // ID for this command in history
+	CommandID      string `json:"command_id,omitempty"`      // Stored history record, for get_command_output and get_command_stream
 	StreamingUsed  bool   `json:"streaming_used"`            // Whether real-time streaming was used
 	TotalChunks    int    `json:"total_chunks,omitempty"`    // Number of stream chunks if streaming was used
 	PackageManager string `json:"package_manager,omitempty"` // Detected package manager used
 	ProjectType    string `json:"project_type,omitempty"`    // Detected project type
 	TimeoutUsed    int    `json:"timeout_used"`              // Timeout value used in seconds
 	TimedOut       bool   `json:"timed_out"`                 // Whether command was terminated due to timeout
+	TimeoutReason  string `json:"timeout_reason,omitempty"`  // Which limit stopped the command: total or idle
+	IdleTimeout    int    `json:"idle_timeout,omitempty"`    // Idle timeout used in seconds, if any
+	Truncated      bool   `json:"truncated"`                 // Whether output beyond max_output_bytes was omitted
+	// Set when the command started with a session alias; command holds the expansion
+	Alias *terminal.AliasExpansion `json:"alias,omitempty"`
+	// Security decision for the command, reported on both success and rejection
+	Security *SecurityDecision `json:"security,omitempty"`
+	// Set when the command forks into the background and may leave an untracked process running
+	Daemon *DaemonWarning `json:"daemon,omitempty"`
+	// Set when the command runs in the server's own directories or a protected path
+	ProtectedDir *ProtectedDirWarning `json:"protected_dir,omitempty"`
+	// History tags recorded with the command, explicit and detected from the command
+	Tags []string `json:"tags,omitempty"`
+	// Set for a dry run, which validates the command without running or recording it
+	DryRun bool `json:"dry_run,omitempty"`
+	// Why a dry run's command would be rejected; empty when it would run
+	ValidationError string `json:"validation_error,omitempty"`
+	// Whether the command ran attached to a pseudo-terminal, and why not when use_pty was set
+	PTY      bool   `json:"pty,omitempty"`
+	PTYError string `json:"pty_error,omitempty"`
+}
+
+// GetActiveCommandOutputArgs represents arguments for reading a running foreground command's output
+type GetActiveCommandOutputArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session running the command"`
+	TailLines int    `json:"tail_lines,omitempty" jsonschema:"description=Optional: Return only the last N lines of the output captured so far"`
+}
+
+// GetActiveCommandOutputResult represents the output captured so far for a session's foreground command
+type GetActiveCommandOutputResult struct {
+	SessionID     string                        `json:"session_id"`
+	Found         bool                          `json:"found"`                    // Whether a foreground command has run in the session
+	ActiveCommand *terminal.ActiveCommandOutput `json:"active_command,omitempty"` // The command started last and its output so far
+	OutputLines   int                           `json:"output_lines,omitempty"`   // Lines captured so far, before any tail_lines limit
+	Message       string                        `json:"message"`
 }
 
 // CheckBackgroundProcessArgs represents arguments for checking background process status
 type CheckBackgroundProcessArgs struct {
 	SessionID string `json:"session_id" jsonschema:"required,description,The UUID4 identifier of the session running the background process."`
 	ProcessID string `json:"process_id,omitempty" jsonschema:"description,Optional background process ID. If not provided will check the latest background process for the session."`
+	// Optional line limits applied to both output and error output; at most one may be set
+	HeadLines int `json:"head_lines,omitempty" jsonschema:"description=Optional: Return only the first N lines of output and error output"`
+	TailLines int `json:"tail_lines,omitempty" jsonschema:"description=Optional: Return only the last N lines of output and error output"`
+	// Optional byte offsets for incremental reads; when either is set only output captured since
+	// the offsets is returned (a missing offset reads its stream from the start)
+	OutputOffset      *int64 `json:"output_offset,omitempty" jsonschema:"description=Optional: Return only output captured at or after this offset (next_output_offset of the previous check)"`
+	ErrorOutputOffset *int64 `json:"error_output_offset,omitempty" jsonschema:"description=Optional: Return only error output captured at or after this offset (next_error_output_offset of the previous check)"`
 }
 
 // CheckBackgroundProcessResult represents the result of checking a background process
@@ -555,14 +1269,78 @@ type CheckBackgroundProcessResult struct {
 	Duration    string `json:"duration"`
 	Command     string `json:"command"`
 	PID         int    `json:"pid,omitempty"`
-	Status      string `json:"status"` // "running", "completed", "failed", "not_found"
+	Status      string `json:"status"` // "running", "restarting", "completed", "failed", "not_found"
 	LastChecked string `json:"last_checked"`
+	// How the process ended, present once it has exited: exit_reason is one of exited,
+	// nonzero_exit, timeout (exit code 124), signaled (killed by a signal the server did not
+	// send, e.g. the OOM killer), terminated (stopped by the server) or vanished (the PID
+	// disappeared without the exit being seen; exit code -1)
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	ExitReason string `json:"exit_reason,omitempty"`
+	Signal     string `json:"signal,omitempty"`      // Signal that ended the process
+	SignalSent string `json:"signal_sent,omitempty"` // Last signal the server sent the process
+	// Line counts of the full buffers, so a head/tail slice shows how much was left out
+	OutputLines      int `json:"output_lines"`
+	ErrorOutputLines int `json:"error_output_lines"`
+	// Crash-restart details, present only for processes started with auto_restart
+	AutoRestart  bool                     `json:"auto_restart,omitempty"`
+	RestartCount int                      `json:"restart_count,omitempty"`
+	MaxRestarts  int                      `json:"max_restarts,omitempty"`
+	Restarts     []terminal.RestartRecord `json:"restarts,omitempty"`
+	// Whether the process runs attached to a pseudo-terminal, and why not when one was requested
+	PTY      bool   `json:"pty,omitempty"`
+	PTYError string `json:"pty_error,omitempty"`
+	// Offsets to pass as output_offset and error_output_offset to read only newer output next
+	// time. A gap means background_output_limit dropped output before it could be read.
+	NextOutputOffset      int64 `json:"next_output_offset"`
+	NextErrorOutputOffset int64 `json:"next_error_output_offset"`
+	OutputGapBytes        int64 `json:"output_gap_bytes,omitempty"`
+	ErrorOutputGapBytes   int64 `json:"error_output_gap_bytes,omitempty"`
+}
+
+// WaitForBackgroundProcessArgs represents arguments for waiting until a background process exits
+type WaitForBackgroundProcessArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session running the background process."`
+	ProcessID string `json:"process_id" jsonschema:"required,description=The background process to wait for."`
+	Timeout   int    `json:"timeout,omitempty" jsonschema:"description=Optional: Seconds to wait. Default: 60 seconds. Maximum: 300 seconds (5 minutes)."`
+	HeadLines int    `json:"head_lines,omitempty" jsonschema:"description=Optional: Return only the first N lines of output and error output"`
+	TailLines int    `json:"tail_lines,omitempty" jsonschema:"description=Optional: Return only the last N lines of output and error output"`
+}
+
+// WaitForBackgroundProcessResult represents the result of waiting for a background process
+type WaitForBackgroundProcessResult struct {
+	SessionID        string  `json:"session_id"`
+	ProcessID        string  `json:"process_id"`
+	Command          string  `json:"command"`
+	PID              int     `json:"pid,omitempty"`
+	Status           string  `json:"status"` // "completed", "failed" or "still_running"
+	Exited           bool    `json:"exited"`
+	ExitCode         int     `json:"exit_code"` // Only meaningful when exited
+	Output           string  `json:"output"`
+	ErrorOutput      string  `json:"error_output"`
+	OutputLines      int     `json:"output_lines"`
+	ErrorOutputLines int     `json:"error_output_lines"`
+	WaitedSeconds    float64 `json:"waited_seconds"`
+	TimeoutUsed      int     `json:"timeout_used"`
+	Message          string  `json:"message"`
 }
 
 // RunBackgroundProcessArgs represents arguments for running a background process
 type RunBackgroundProcessArgs struct {
 	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the terminal session to run the background process in. Use list_terminal_sessions to see available sessions."`
 	Command   string `json:"command" jsonschema:"required,description=The command to execute as a background process. No validation is performed - the agent decides what to run."`
+	// Optional readiness wait: block until output matches WaitForPattern (or ReadyPattern, its older name)
+	WaitForPattern string `json:"wait_for_pattern,omitempty" jsonschema:"description=Optional: Regular expression to wait for in the process output before returning (e.g. 'Listening on :3000'). Output printed before the wait started counts."`
+	ReadyPattern   string `json:"ready_pattern,omitempty" jsonschema:"description=Optional: Same as wait_for_pattern, kept for compatibility"`
+	ReadyTimeout   int    `json:"ready_timeout,omitempty" jsonschema:"description=Optional: Seconds to wait for wait_for_pattern. Defaults to the server's configured readiness timeout."`
+	// Optional crash-restart: rerun the command when it exits non-zero
+	AutoRestart           bool `json:"auto_restart,omitempty" jsonschema:"description=Optional: Restart the process automatically when it exits with a non-zero code"`
+	MaxRestarts           int  `json:"max_restarts,omitempty" jsonschema:"description=Optional: Maximum automatic restarts (default 3, max 100). Requires auto_restart."`
+	RestartBackoffSeconds int  `json:"restart_backoff_seconds,omitempty" jsonschema:"description=Optional: Seconds to wait before each restart (default 1). Requires auto_restart."`
+	// Optional history labels, added to those detected from the command
+	Tags []string `json:"tags,omitempty" jsonschema:"description=Optional: Labels stored with the command in history for filtering with search_history. Tools such as git npm and docker are tagged automatically."`
+	// Optional pseudo-terminal for TTY-sensitive processes
+	UsePTY bool `json:"use_pty,omitempty" jsonschema:"description=Optional: Attach the process to a pseudo-terminal so it behaves as if run in a terminal. Its stdout and stderr are then merged into output."`
 }
 
 // RunBackgroundProcessResult represents the result of starting a background process
@@ -577,6 +1355,14 @@ type RunBackgroundProcessResult struct {
 	Message           string `json:"message"`
 	BackgroundCount   int    `json:"background_count"`
 	MaxBackgroundProc int    `json:"max_background_processes"`
+	// Readiness wait outcome, present only when wait_for_pattern was given
+	Ready         *bool  `json:"ready,omitempty"`
+	ReadyWaitTime string `json:"ready_wait_time,omitempty"`
+	ReadyMatch    string `json:"ready_match,omitempty"` // Output text the pattern matched
+	// Security decision for the command, reported on both success and rejection
+	Security *SecurityDecision `json:"security,omitempty"`
+	// History tags recorded with the command, explicit and detected from the command
+	Tags []string `json:"tags,omitempty"`
 }
 
 // ListBackgroundProcessesArgs represents arguments for listing background processes
@@ -587,19 +1373,20 @@ type ListBackgroundProcessesArgs struct {
 
 // BackgroundProcessInfo represents information about a background process
 type BackgroundProcessInfo struct {
-	ProcessID   string `json:"process_id"`
-	SessionID   string `json:"session_id"`
-	SessionName string `json:"session_name"`
-	ProjectID   string `json:"project_id"`
-	Command     string `json:"command"`
-	PID         int    `json:"pid"`
-	StartTime   string `json:"start_time"`
-	Duration    string `json:"duration"`
-	IsRunning   bool   `json:"is_running"`
-	ExitCode    int    `json:"exit_code,omitempty"`
-	WorkingDir  string `json:"working_dir"`
-	OutputSize  int    `json:"output_size"`
-	ErrorSize   int    `json:"error_size"`
+	ProcessID    string `json:"process_id"`
+	SessionID    string `json:"session_id"`
+	SessionName  string `json:"session_name"`
+	ProjectID    string `json:"project_id"`
+	Command      string `json:"command"`
+	PID          int    `json:"pid"`
+	StartTime    string `json:"start_time"`
+	Duration     string `json:"duration"`
+	IsRunning    bool   `json:"is_running"`
+	ExitCode     int    `json:"exit_code,omitempty"`
+	WorkingDir   string `json:"working_dir"`
+	OutputSize   int    `json:"output_size"`
+	ErrorSize    int    `json:"error_size"`
+	RestartCount int    `json:"restart_count,omitempty"`
 }
 
 // ListBackgroundProcessesResult represents the result of listing background processes
@@ -615,23 +1402,47 @@ type ListBackgroundProcessesResult struct {
 
 // TerminateBackgroundProcessArgs represents arguments for terminating a background process
 type TerminateBackgroundProcessArgs struct {
-	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session containing the background process."`
-	ProcessID string `json:"process_id" jsonschema:"required,description=The UUID4 identifier of the background process to terminate."`
-	Force     bool   `json:"force,omitempty" jsonschema:"description=Whether to force kill the process (SIGKILL) instead of graceful termination (SIGTERM). Default: false."`
+	SessionID string   `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session containing the background process."`
+	ProcessID string   `json:"process_id" jsonschema:"required,description=The UUID4 identifier of the background process to terminate."`
+	Force     bool     `json:"force,omitempty" jsonschema:"description=Whether to force kill the process (SIGKILL) instead of graceful termination (SIGTERM). Default: false."`
+	Signals   []string `json:"signals,omitempty" jsonschema:"description=Optional ordered signal escalation sequence, e.g. [SIGINT, SIGTERM, SIGKILL]. SIGKILL is always sent last if the process is still running. Default: [SIGTERM, SIGKILL]."`
+	GraceSecs int      `json:"grace_seconds,omitempty" jsonschema:"description=Seconds to wait for the process to exit after each signal. Default: 5."`
 }
 
 // TerminateBackgroundProcessResult represents the result of terminating a background process
 type TerminateBackgroundProcessResult struct {
-	SessionID   string `json:"session_id"`
-	ProcessID   string `json:"process_id"`
-	Command     string `json:"command"`
-	PID         int    `json:"pid"`
-	WasRunning  bool   `json:"was_running"`
-	Terminated  bool   `json:"terminated"`
-	Force       bool   `json:"force"`
-	Message     string `json:"message"`
-	FinalOutput string `json:"final_output,omitempty"`
-	FinalError  string `json:"final_error,omitempty"`
+	SessionID   string   `json:"session_id"`
+	ProcessID   string   `json:"process_id"`
+	Command     string   `json:"command"`
+	PID         int      `json:"pid"`
+	WasRunning  bool     `json:"was_running"`
+	Terminated  bool     `json:"terminated"`
+	Force       bool     `json:"force"`
+	Signals     []string `json:"signals,omitempty"` // Escalation sequence used for graceful termination
+	Stuck       bool     `json:"stuck,omitempty"`   // The process survived SIGKILL; cleanup keeps trying to reap it
+	State       string   `json:"state,omitempty"`   // Process state of a stuck process, e.g. "D (uninterruptible sleep (usually I/O))"
+	Message     string   `json:"message"`
+	FinalOutput string   `json:"final_output,omitempty"`
+	FinalError  string   `json:"final_error,omitempty"`
+}
+
+// RestartBackgroundProcessArgs represents arguments for restarting a background process
+type RestartBackgroundProcessArgs struct {
+	SessionID string `json:"session_id" jsonschema:"required,description=The UUID4 identifier of the session containing the background process."`
+	ProcessID string `json:"process_id" jsonschema:"required,description=The UUID4 identifier of the background process to restart. It keeps this ID."`
+	Force     bool   `json:"force,omitempty" jsonschema:"description=Force kill the old process (SIGKILL) instead of terminating it gracefully. Default: false."`
+}
+
+// RestartBackgroundProcessResult represents the result of restarting a background process
+type RestartBackgroundProcessResult struct {
+	SessionID string `json:"session_id"`
+	ProcessID string `json:"process_id"`
+	Command   string `json:"command"`
+	OldPID    int    `json:"old_pid"` // 0 if the old process had already exited
+	NewPID    int    `json:"new_pid"`
+	StartTime string `json:"start_time"`
+	Force     bool   `json:"force"`
+	Message   string `json:"message"`
 }
 
 // SearchHistoryArgs represents arguments for searching command history
@@ -640,26 +1451,40 @@ type SearchHistoryArgs struct {
 	ProjectID     string   `json:"project_id,omitempty" jsonschema:"description,Filter by specific project ID. Leave empty to search all projects."`
 	Command       string   `json:"command,omitempty" jsonschema:"description,Search for commands containing this text (case-insensitive partial match)."`
 	Output        string   `json:"output,omitempty" jsonschema:"description,Search for commands with output containing this text (case-insensitive partial match)."`
+	CommandRegex  string   `json:"command_regex,omitempty" jsonschema:"description,Only return commands matching this Go regular expression."`
+	OutputRegex   string   `json:"output_regex,omitempty" jsonschema:"description,Only return commands whose output or error output matches this Go regular expression."`
 	Success       *bool    `json:"success,omitempty" jsonschema:"description,Filter by success status: true for successful commands false for failed commands omit for all."`
 	StartTime     string   `json:"start_time,omitempty" jsonschema:"description,Find commands executed after this time (ISO 8601 format: 2006-01-02T15:04:05Z)."`
 	EndTime       string   `json:"end_time,omitempty" jsonschema:"description,Find commands executed before this time (ISO 8601 format: 2006-01-02T15:04:05Z)."`
 	WorkingDir    string   `json:"working_dir,omitempty" jsonschema:"description,Filter by working directory path (partial match)."`
 	Tags          []string `json:"tags,omitempty" jsonschema:"description,Filter by tags (commands must have all specified tags)."`
 	Limit         int      `json:"limit,omitempty" jsonschema:"description,Maximum number of results to return (default: 100 max: 1000)."`
+	Offset        int      `json:"offset,omitempty" jsonschema:"description,Number of matching commands to skip for paging (default: 0 max: 10000). Not supported with command_regex or output_regex."`
 	SortBy        string   `json:"sort_by,omitempty" jsonschema:"description,Sort results by: 'time' (default) 'duration' or 'command'."`
 	SortDesc      bool     `json:"sort_desc,omitempty" jsonschema:"description,Sort in descending order (default: true for time-based sorting)."`
 	IncludeOutput bool     `json:"include_output,omitempty" jsonschema:"description,Include command output in results (default: false to reduce response size)."`
+	TimeFormat    string   `json:"time_format,omitempty" jsonschema:"description,Timestamp format for results: rfc3339 (default) unix unix_ms or a Go time layout."`
+	Fields        []string `json:"fields,omitempty" jsonschema:"description,Only return these fields of each command in rows instead of full records in results (e.g. command and success)."`
 }
 
 // SearchHistoryResult represents the result of searching command history
 type SearchHistoryResult struct {
-	TotalFound   int                       `json:"total_found"`
-	Results      []*database.CommandResult `json:"results"`
+	TotalFound   int                       `json:"total_found"`           // Commands in this page
+	TotalCount   *int                      `json:"total_count,omitempty"` // Commands matching the filters across all pages; omitted for regex searches
+	HasMore      bool                      `json:"has_more"`              // Another page follows at offset + total_found
+	Offset       int                       `json:"offset"`
+	Results      []*database.CommandResult `json:"results"` // Empty when fields is set
 	Query        SearchHistoryArgs         `json:"query"`
 	SearchTime   string                    `json:"search_time"`
 	ProjectStats map[string]int            `json:"project_stats"` // project_id -> command_count in results
 	SessionStats map[string]int            `json:"session_stats"` // session_id -> command_count in results
 	Instructions SearchInstructions        `json:"instructions"`
+
+	// How much history a command_regex or output_regex search examined
+	RegexStats *database.RegexSearchStats `json:"regex_stats,omitempty"`
+
+	// With fields set, each command reduced to the requested fields
+	Rows []map[string]interface{} `json:"rows,omitempty"`
 }
 
 // SearchInstructions provides guidance on how to use the search functionality
@@ -680,5 +1505,6 @@ type SearchExample struct {
 type SearchLimits struct {
 	MaxResults     int    `json:"max_results"`
 	DefaultResults int    `json:"default_results"`
+	MaxOffset      int    `json:"max_offset"`
 	TimeFormat     string `json:"time_format"`
 }
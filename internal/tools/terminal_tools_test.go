@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -315,6 +316,78 @@ func TestSecurityValidator(t *testing.T) {
 	}
 }
 
+// TestSecurityDecision tests that command decisions report the rule that fired
+func TestSecurityDecision(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Security.EnableSandbox = true
+	cfg.Security.BlockedCommands = []string{"sudo", "rm -rf /"}
+	cfg.Security.AllowNetworkAccess = false
+
+	validator := NewSecurityValidator(cfg)
+
+	tests := []struct {
+		command     string
+		allowed     bool
+		ruleType    string
+		matchedRule string
+	}{
+		{"echo hello", true, "", ""},
+		{"", false, RuleTypeEmptyCommand, ""},
+		{" \t\n ", false, RuleTypeEmptyCommand, ""},
+		{"# just a comment\n  # another", false, RuleTypeEmptyCommand, ""},
+		{"echo hi # trailing comment", true, "", ""},
+		{"sudo ls", false, RuleTypeBlockedCommand, "sudo"},
+		{"rm -rf /", false, RuleTypeBlockedCommand, "rm -rf /"},
+		{"chmod 777 file", false, RuleTypeDangerousPattern, "chmod 777"},
+		{"wget https://example.com", false, RuleTypeNetworkAccess, "wget"},
+	}
+
+	for _, tt := range tests {
+		decision := validator.EvaluateCommand(tt.command)
+		if decision.Allowed != tt.allowed || decision.RuleType != tt.ruleType || decision.MatchedRule != tt.matchedRule {
+			t.Errorf("EvaluateCommand(%q) = %+v, want allowed=%v rule_type=%q matched_rule=%q",
+				tt.command, decision, tt.allowed, tt.ruleType, tt.matchedRule)
+		}
+		if err := validator.ValidateCommand(tt.command); (err == nil) != tt.allowed {
+			t.Errorf("ValidateCommand(%q) error = %v, want allowed=%v", tt.command, err, tt.allowed)
+		}
+	}
+}
+
+// TestRunCommandSecurityField tests that run_command reports the security decision
+func TestRunCommandSecurityField(t *testing.T) {
+	tools, manager, tempDir := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	tools.config.Security.BlockedCommands = append(tools.config.Security.BlockedCommands, "sudo")
+
+	ctx := context.Background()
+	_, session, err := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "security-field", WorkingDir: tempDir})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	result, blockedResult, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.SessionID, Command: "sudo ls"})
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("Expected blocked command to return an error result")
+	}
+	if blockedResult.Security == nil || blockedResult.Security.Allowed || blockedResult.Security.MatchedRule != "sudo" {
+		t.Errorf("Expected security decision blocking sudo, got %+v", blockedResult.Security)
+	}
+
+	_, allowedResult, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.SessionID, Command: "echo ok"})
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if allowedResult.Security == nil || !allowedResult.Security.Allowed {
+		t.Errorf("Expected allowed security decision, got %+v", allowedResult.Security)
+	}
+}
+
 // TestSecurityValidatorFalsePositives tests that we don't have false positives in security validation
 func TestSecurityValidatorFalsePositives(t *testing.T) {
 	cfg := config.DefaultConfig()
@@ -397,6 +470,76 @@ func TestSecurityValidatorFalsePositives(t *testing.T) {
 	}
 }
 
+// TestBlankAndCommentOnlyCommands tests that commands which would do nothing are rejected in both
+// the foreground and background paths, and that comment-only commands can be allowed
+func TestBlankAndCommentOnlyCommands(t *testing.T) {
+	tools, manager, tempDir := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+	_, session, err := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "blank-commands"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		message string
+	}{
+		{"whitespace only", "   \t\n  ", "empty or whitespace-only"},
+		{"comment only", "# just a comment", "only comments"},
+		{"multi-line comments", "  # first\n\n# second\n", "only comments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, runResult, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.SessionID, Command: tt.command})
+			if err != nil {
+				t.Fatalf("RunCommand returned error: %v", err)
+			}
+			if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, tt.message) {
+				t.Errorf("Expected run_command to reject %q with %q, got %+v", tt.command, tt.message, result.Content)
+			}
+			if runResult.Security != nil {
+				t.Errorf("Expected a validation error, not a security decision: %+v", runResult.Security)
+			}
+
+			result, _, err = tools.RunBackgroundProcess(ctx, nil, RunBackgroundProcessArgs{SessionID: session.SessionID, Command: tt.command})
+			if err != nil {
+				t.Fatalf("RunBackgroundProcess returned error: %v", err)
+			}
+			if !result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, tt.message) {
+				t.Errorf("Expected run_background_process to reject %q with %q, got %+v", tt.command, tt.message, result.Content)
+			}
+		})
+	}
+
+	// Nothing was spawned or recorded for the rejected commands
+	updated, err := manager.GetSession(session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if updated.CommandCount != 0 {
+		t.Errorf("Expected no commands to run, got count %d", updated.CommandCount)
+	}
+
+	tools.config.Security.AllowCommentOnlyCommands = true
+	result, runResult, err := tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.SessionID, Command: "# allowed comment"})
+	if err != nil || result.IsError {
+		t.Fatalf("Expected comment-only command to run when allowed, got err=%v result=%+v", err, result.Content)
+	}
+	if !runResult.Success {
+		t.Errorf("Expected comment-only command to succeed, got %+v", runResult)
+	}
+
+	result, _, _ = tools.RunCommand(ctx, nil, RunCommandArgs{SessionID: session.SessionID, Command: "  "})
+	if !result.IsError {
+		t.Error("Expected whitespace-only command to stay rejected when comment-only commands are allowed")
+	}
+}
+
 // TestCreateSessionWithWorkingDir tests creating sessions with working directory parameter
 func TestCreateSessionWithWorkingDir(t *testing.T) {
 	tools, manager, tempDir := setupTestEnvironment(t)
@@ -446,6 +589,59 @@ func TestCreateSessionWithWorkingDir(t *testing.T) {
 	}
 }
 
+// TestValidateWorkingDirectory tests working directory pre-validation
+func TestValidateWorkingDirectory(t *testing.T) {
+	tools, manager, tempDir := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer manager.Shutdown()
+
+	ctx := context.Background()
+
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "go.mod"), []byte("module example\n"), 0o644); err != nil {
+		t.Fatalf("Failed to create go.mod: %v", err)
+	}
+	filePath := filepath.Join(tempDir, "file.txt")
+	if err := os.WriteFile(filePath, []byte("x"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	_, verdict, err := tools.ValidateWorkingDirectory(ctx, nil, ValidateWorkingDirectoryArgs{Path: projectDir})
+	if err != nil {
+		t.Fatalf("ValidateWorkingDirectory failed: %v", err)
+	}
+	if !verdict.Valid || verdict.ProjectType != "go" {
+		t.Errorf("Expected valid go project directory, got valid=%v project_type=%q issues=%v", verdict.Valid, verdict.ProjectType, verdict.Issues)
+	}
+
+	_, verdict, _ = tools.ValidateWorkingDirectory(ctx, nil, ValidateWorkingDirectoryArgs{Path: filePath})
+	if verdict.Valid || !verdict.Exists || verdict.IsDirectory {
+		t.Errorf("Expected file path to be rejected as not a directory, got %+v", verdict)
+	}
+
+	_, verdict, _ = tools.ValidateWorkingDirectory(ctx, nil, ValidateWorkingDirectoryArgs{Path: filepath.Join(tempDir, "missing")})
+	if verdict.Valid || verdict.Exists {
+		t.Errorf("Expected missing path to be invalid, got %+v", verdict)
+	}
+
+	// Restrict the allowlist to the project directory
+	tools.config.Security.AllowedWorkingDirs = []string{projectDir}
+	defer func() { tools.config.Security.AllowedWorkingDirs = nil }()
+
+	_, verdict, _ = tools.ValidateWorkingDirectory(ctx, nil, ValidateWorkingDirectoryArgs{Path: tempDir})
+	if verdict.Valid || verdict.WithinAllowlist {
+		t.Errorf("Expected directory outside allowlist to be invalid, got %+v", verdict)
+	}
+
+	result, _, _ := tools.CreateSession(ctx, nil, CreateSessionArgs{Name: "outside-allowlist", WorkingDir: tempDir})
+	if !result.IsError {
+		t.Error("Expected session creation outside allowlist to fail")
+	}
+}
+
 // TestRunCommandTimeout tests the timeout functionality for run_command
 func TestRunCommandTimeout(t *testing.T) {
 	tools, manager, tempDir := setupTestEnvironment(t)
@@ -23,6 +23,8 @@ type TracesResult struct {
 	Spans   []*tracing.Span `json:"spans"`
 	Count   int             `json:"count"`
 	Message string          `json:"message,omitempty"`
+
+	Export *tracing.ExportStats `json:"export,omitempty"` // OTLP export counters; omitted when export is disabled
 }
 
 // GetTraces retrieves collected trace spans
@@ -62,6 +64,10 @@ func (t *TerminalTools) GetTraces(ctx context.Context, req *mcp.CallToolRequest,
 		Count:   len(spans),
 		Message: fmt.Sprintf("Retrieved %d trace spans", len(spans)),
 	}
+	if t.spanExporter != nil {
+		stats := t.spanExporter.Stats()
+		result.Export = &stats
+	}
 
 	return createJSONResult(result), result, nil
 }
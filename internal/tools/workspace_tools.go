@@ -0,0 +1,356 @@
+// Package tools provides MCP tool handlers for whole-workspace snapshots
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rama-kairi/go-term/internal/terminal"
+)
+
+// --- Workspace Snapshot Types ---
+
+// WorkspaceSessionState captures the restorable state of a single session
+type WorkspaceSessionState struct {
+	SessionID    string            `json:"session_id"`
+	Name         string            `json:"name"`
+	ProjectID    string            `json:"project_id"`
+	WorkingDir   string            `json:"working_dir"`
+	CurrentDir   string            `json:"current_dir"`
+	Environment  map[string]string `json:"environment"`
+	ShellOptions []string          `json:"shell_options,omitempty"`
+	CommandCount int               `json:"command_count"`
+}
+
+// WorkspaceSnapshot bundles the state of every active session
+type WorkspaceSnapshot struct {
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+	Sessions    []WorkspaceSessionState `json:"sessions"`
+}
+
+// WorkspaceSnapshotStore persists workspace snapshots as JSON files under dataDir/workspaces
+type WorkspaceSnapshotStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewWorkspaceSnapshotStore creates a workspace snapshot store rooted in dataDir
+func NewWorkspaceSnapshotStore(dataDir string) *WorkspaceSnapshotStore {
+	dir := filepath.Join(dataDir, "workspaces")
+	os.MkdirAll(dir, 0o755)
+	return &WorkspaceSnapshotStore{dir: dir}
+}
+
+// Save writes a workspace snapshot to disk
+func (ws *WorkspaceSnapshotStore) Save(snapshot *WorkspaceSnapshot) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if err := os.MkdirAll(ws.dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(ws.dir, snapshot.ID+".json"), data, 0o644)
+}
+
+// Load returns the snapshot matching idOrName, or the most recent snapshot if idOrName is empty
+func (ws *WorkspaceSnapshotStore) Load(idOrName string) (*WorkspaceSnapshot, error) {
+	snapshots, err := ws.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *WorkspaceSnapshot
+	for _, snapshot := range snapshots {
+		if idOrName != "" {
+			if snapshot.ID == idOrName || snapshot.Name == idOrName {
+				return snapshot, nil
+			}
+			continue
+		}
+		if latest == nil || snapshot.CreatedAt.After(latest.CreatedAt) {
+			latest = snapshot
+		}
+	}
+
+	if latest == nil {
+		if idOrName != "" {
+			return nil, fmt.Errorf("workspace snapshot not found: %s", idOrName)
+		}
+		return nil, fmt.Errorf("no workspace snapshots found")
+	}
+	return latest, nil
+}
+
+// List reads every workspace snapshot on disk, skipping files that cannot be parsed
+func (ws *WorkspaceSnapshotStore) List() ([]*WorkspaceSnapshot, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	files, err := os.ReadDir(ws.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace snapshots: %w", err)
+	}
+
+	snapshots := make([]*WorkspaceSnapshot, 0, len(files))
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(ws.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+
+		var snapshot WorkspaceSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, nil
+}
+
+// SaveWorkspaceSnapshotArgs represents arguments for saving a workspace snapshot
+type SaveWorkspaceSnapshotArgs struct {
+	Name        string `json:"name" jsonschema:"required,description=Name for the workspace snapshot"`
+	Description string `json:"description,omitempty" jsonschema:"description=Description of the workspace snapshot"`
+}
+
+// SaveWorkspaceSnapshotResult represents the result of saving a workspace snapshot
+type SaveWorkspaceSnapshotResult struct {
+	SnapshotID   string    `json:"snapshot_id"`
+	Name         string    `json:"name"`
+	SessionCount int       `json:"session_count"`
+	SessionIDs   []string  `json:"session_ids"`
+	CreatedAt    time.Time `json:"created_at"`
+	Message      string    `json:"message"`
+}
+
+// RestoreWorkspaceSnapshotArgs represents arguments for restoring a workspace snapshot
+type RestoreWorkspaceSnapshotArgs struct {
+	SnapshotID string `json:"snapshot_id,omitempty" jsonschema:"description=Workspace snapshot ID or name to restore (default: most recent)"`
+}
+
+// WorkspaceSessionOutcome reports how a single session was restored
+type WorkspaceSessionOutcome struct {
+	SnapshotSessionID string   `json:"snapshot_session_id"`
+	SessionID         string   `json:"session_id,omitempty"` // Live session ID after restore
+	Name              string   `json:"name"`
+	Action            string   `json:"action"` // created, updated, or failed
+	Conflicts         []string `json:"conflicts,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// RestoreWorkspaceSnapshotResult represents the result of restoring a workspace snapshot
+type RestoreWorkspaceSnapshotResult struct {
+	SnapshotID string                    `json:"snapshot_id"`
+	Name       string                    `json:"name"`
+	Created    int                       `json:"created"`
+	Updated    int                       `json:"updated"`
+	Failed     int                       `json:"failed"`
+	Sessions   []WorkspaceSessionOutcome `json:"sessions"`
+	Message    string                    `json:"message"`
+}
+
+// --- MCP Tool Handlers ---
+
+// SaveWorkspaceSnapshot captures every active session into a single snapshot bundle
+func (t *TerminalTools) SaveWorkspaceSnapshot(ctx context.Context, req *mcp.CallToolRequest, args SaveWorkspaceSnapshotArgs) (*mcp.CallToolResult, SaveWorkspaceSnapshotResult, error) {
+	if strings.TrimSpace(args.Name) == "" {
+		return createErrorResult("Snapshot name is required"), SaveWorkspaceSnapshotResult{}, nil
+	}
+
+	sessions := t.manager.ListSessions()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	now := time.Now()
+	snapshot := &WorkspaceSnapshot{
+		ID:          "ws-" + strings.ReplaceAll(now.Format("20060102-150405.000"), ".", "-"),
+		Name:        args.Name,
+		Description: args.Description,
+		CreatedAt:   now,
+		Sessions:    make([]WorkspaceSessionState, 0, len(sessions)),
+	}
+
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, listed := range sessions {
+		// ListSessions returns detached copies; capture state from the live session
+		session, err := t.manager.GetSession(listed.ID)
+		if err != nil || !session.IsActive {
+			continue
+		}
+		snapshot.Sessions = append(snapshot.Sessions, WorkspaceSessionState{
+			SessionID:    session.ID,
+			Name:         session.Name,
+			ProjectID:    session.ProjectID,
+			WorkingDir:   session.GetWorkingDir(),
+			CurrentDir:   session.GetCurrentDir(),
+			Environment:  session.GetAllEnvironment(),
+			ShellOptions: session.GetShellOptions(),
+			CommandCount: session.CommandCount,
+		})
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+
+	if err := t.workspaceStore.Save(snapshot); err != nil {
+		return createErrorResult(fmt.Sprintf("Failed to save workspace snapshot: %v", err)), SaveWorkspaceSnapshotResult{}, nil
+	}
+
+	result := SaveWorkspaceSnapshotResult{
+		SnapshotID:   snapshot.ID,
+		Name:         snapshot.Name,
+		SessionCount: len(snapshot.Sessions),
+		SessionIDs:   sessionIDs,
+		CreatedAt:    snapshot.CreatedAt,
+		Message:      fmt.Sprintf("Workspace snapshot '%s' saved with %d session(s)", snapshot.Name, len(snapshot.Sessions)),
+	}
+
+	t.logger.Info("Workspace snapshot saved", map[string]interface{}{
+		"snapshot_id":   snapshot.ID,
+		"name":          snapshot.Name,
+		"session_count": len(snapshot.Sessions),
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// RestoreWorkspaceSnapshot recreates missing sessions and updates existing ones from a snapshot bundle
+func (t *TerminalTools) RestoreWorkspaceSnapshot(ctx context.Context, req *mcp.CallToolRequest, args RestoreWorkspaceSnapshotArgs) (*mcp.CallToolResult, RestoreWorkspaceSnapshotResult, error) {
+	// H2: Check rate limit
+	if err := t.CheckRateLimit(""); err != nil {
+		return createErrorResult(err.Error()), RestoreWorkspaceSnapshotResult{}, nil
+	}
+
+	snapshot, err := t.workspaceStore.Load(args.SnapshotID)
+	if err != nil {
+		return createErrorResult(err.Error()), RestoreWorkspaceSnapshotResult{}, nil
+	}
+
+	result := RestoreWorkspaceSnapshotResult{
+		SnapshotID: snapshot.ID,
+		Name:       snapshot.Name,
+		Sessions:   make([]WorkspaceSessionOutcome, 0, len(snapshot.Sessions)),
+	}
+
+	for _, state := range snapshot.Sessions {
+		outcome := t.restoreWorkspaceSession(state)
+		switch outcome.Action {
+		case "created":
+			result.Created++
+		case "updated":
+			result.Updated++
+		default:
+			result.Failed++
+		}
+		result.Sessions = append(result.Sessions, outcome)
+	}
+
+	result.Message = fmt.Sprintf("Workspace snapshot '%s' restored: %d created, %d updated, %d failed",
+		snapshot.Name, result.Created, result.Updated, result.Failed)
+
+	t.logger.Info("Workspace snapshot restored", map[string]interface{}{
+		"snapshot_id": snapshot.ID,
+		"created":     result.Created,
+		"updated":     result.Updated,
+		"failed":      result.Failed,
+	})
+
+	return createJSONResult(result), result, nil
+}
+
+// restoreWorkspaceSession applies one saved session state, creating the session if it no longer exists
+func (t *TerminalTools) restoreWorkspaceSession(state WorkspaceSessionState) WorkspaceSessionOutcome {
+	outcome := WorkspaceSessionOutcome{
+		SnapshotSessionID: state.SessionID,
+		Name:              state.Name,
+	}
+
+	session, err := t.manager.GetSession(state.SessionID)
+	if err == nil {
+		outcome.Action = "updated"
+		outcome.Conflicts = workspaceConflicts(session, state)
+	} else {
+		session, err = t.manager.CreateSession(state.Name, state.ProjectID, state.WorkingDir)
+		if err != nil {
+			outcome.Action = "failed"
+			outcome.Error = fmt.Sprintf("failed to recreate session: %v", err)
+			return outcome
+		}
+		outcome.Action = "created"
+	}
+	outcome.SessionID = session.ID
+
+	if len(state.Environment) > 0 {
+		if err := t.manager.SetSessionEnvironment(session.ID, state.Environment); err != nil {
+			outcome.Conflicts = append(outcome.Conflicts, fmt.Sprintf("environment not restored: %v", err))
+		}
+	}
+
+	options := make(map[string]bool, len(terminal.KnownShellOptions))
+	for _, name := range terminal.KnownShellOptions {
+		options[name] = false
+	}
+	for _, name := range state.ShellOptions {
+		options[name] = true
+	}
+	if _, err := t.manager.SetSessionShellOptions(session.ID, options); err != nil {
+		outcome.Conflicts = append(outcome.Conflicts, fmt.Sprintf("shell options not restored: %v", err))
+	}
+
+	if state.CurrentDir != "" {
+		if err := t.manager.SetSessionCurrentDir(session.ID, state.CurrentDir); err != nil {
+			outcome.Conflicts = append(outcome.Conflicts, fmt.Sprintf("current directory not restored: %v", err))
+		}
+	}
+
+	return outcome
+}
+
+// workspaceConflicts lists differences between a live session and its saved state
+func workspaceConflicts(session *terminal.Session, state WorkspaceSessionState) []string {
+	var conflicts []string
+
+	if session.Name != state.Name {
+		conflicts = append(conflicts, fmt.Sprintf("name differs: live %q, snapshot %q (live name kept)", session.Name, state.Name))
+	}
+	if workingDir := session.GetWorkingDir(); workingDir != state.WorkingDir {
+		conflicts = append(conflicts, fmt.Sprintf("working_dir differs: live %s, snapshot %s (live working_dir kept)", workingDir, state.WorkingDir))
+	}
+	if current := session.GetCurrentDir(); current != state.CurrentDir {
+		conflicts = append(conflicts, fmt.Sprintf("current_dir changed from %s to %s", current, state.CurrentDir))
+	}
+
+	live := session.GetAllEnvironment()
+	var changed []string
+	for key, value := range state.Environment {
+		if liveValue, exists := live[key]; exists && liveValue != value {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		conflicts = append(conflicts, fmt.Sprintf("environment overwritten: %s", strings.Join(changed, ", ")))
+	}
+
+	return conflicts
+}
@@ -0,0 +1,229 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for BatchOptions fields left at zero
+const (
+	defaultBatchSize     = 128
+	defaultFlushInterval = 5 * time.Second
+	defaultQueueSize     = 2048
+	defaultRetryBackoff  = 500 * time.Millisecond
+)
+
+// SpanProcessor receives spans as they end
+type SpanProcessor interface {
+	OnEnd(span *Span)
+	Shutdown() error
+}
+
+// BatchOptions configures a BatchProcessor
+type BatchOptions struct {
+	BatchSize     int           // Spans per export request
+	FlushInterval time.Duration // Longest a queued span waits before it is exported
+	QueueSize     int           // Ended spans waiting for export; further spans are dropped
+	MaxRetries    int           // Retries of a failed export before its spans are dropped
+	RetryBackoff  time.Duration // Wait before the first retry, doubled for each further one
+
+	// OnError is called, from the export goroutine, when a batch is dropped after its retries
+	OnError func(err error, spans int)
+}
+
+// ExportStats counts what a BatchProcessor has done with ended spans
+type ExportStats struct {
+	Exported int64 `json:"exported"` // Spans the exporter accepted
+	Failed   int64 `json:"failed"`   // Spans dropped after the export and its retries failed
+	Dropped  int64 `json:"dropped"`  // Spans dropped because the queue was full
+	Queued   int   `json:"queued"`   // Spans waiting for export
+}
+
+// BatchProcessor queues ended spans and exports them in batches from a background goroutine,
+// retrying failed exports with exponential backoff
+type BatchProcessor struct {
+	exporter SpanExporter
+	opts     BatchOptions
+
+	queue   chan *Span
+	flushCh chan chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	stop    sync.Once
+
+	exported atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewBatchProcessor creates a processor exporting through exporter and starts its goroutine
+func NewBatchProcessor(exporter SpanExporter, opts BatchOptions) *BatchProcessor {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+
+	p := &BatchProcessor{
+		exporter: exporter,
+		opts:     opts,
+		queue:    make(chan *Span, opts.QueueSize),
+		flushCh:  make(chan chan struct{}),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// OnEnd queues an ended span without blocking; the span is dropped if the queue is full
+func (p *BatchProcessor) OnEnd(span *Span) {
+	select {
+	case <-p.stopCh:
+		p.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case p.queue <- span:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// ForceFlush exports every queued span and waits until done or ctx is cancelled
+func (p *BatchProcessor) ForceFlush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case p.flushCh <- done:
+	case <-p.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans with a single attempt each, stops the goroutine, and shuts
+// down the exporter
+func (p *BatchProcessor) Shutdown() error {
+	p.stop.Do(func() { close(p.stopCh) })
+	<-p.doneCh
+	return p.exporter.Shutdown()
+}
+
+// Stats returns the processor's counters
+func (p *BatchProcessor) Stats() ExportStats {
+	return ExportStats{
+		Exported: p.exported.Load(),
+		Failed:   p.failed.Load(),
+		Dropped:  p.dropped.Load(),
+		Queued:   len(p.queue),
+	}
+}
+
+// run collects spans into batches, exporting when a batch is full, on every flush interval, when
+// flushed, and on shutdown
+func (p *BatchProcessor) run() {
+	defer close(p.doneCh)
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, p.opts.BatchSize)
+	exportBatch := func() {
+		if len(batch) > 0 {
+			p.export(batch)
+			batch = make([]*Span, 0, p.opts.BatchSize)
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-p.queue:
+				batch = append(batch, span)
+				if len(batch) >= p.opts.BatchSize {
+					exportBatch()
+				}
+			default:
+				exportBatch()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) >= p.opts.BatchSize {
+				exportBatch()
+			}
+		case <-ticker.C:
+			exportBatch()
+		case done := <-p.flushCh:
+			drain()
+			close(done)
+		case <-p.stopCh:
+			drain()
+			return
+		}
+	}
+}
+
+// export sends a batch, retrying retryable failures until MaxRetries is reached or the processor
+// shuts down
+func (p *BatchProcessor) export(batch []*Span) {
+	backoff := p.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := p.exporter.Export(batch)
+		if err == nil {
+			p.exported.Add(int64(len(batch)))
+			return
+		}
+
+		var exportErr *ExportError
+		permanent := errors.As(err, &exportErr) && !exportErr.Retryable()
+		if permanent || attempt >= p.opts.MaxRetries || !p.waitToRetry(backoff) {
+			p.failed.Add(int64(len(batch)))
+			if p.opts.OnError != nil {
+				p.opts.OnError(err, len(batch))
+			}
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// waitToRetry waits for the backoff and reports false if the processor shut down meanwhile
+func (p *BatchProcessor) waitToRetry(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-p.stopCh:
+		return false
+	}
+}
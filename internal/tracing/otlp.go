@@ -0,0 +1,259 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpTracesPath is where OTLP/HTTP collectors accept spans
+const otlpTracesPath = "/v1/traces"
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+// An exporter without an endpoint accepts and discards every span.
+type OTLPExporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter creates an exporter for the collector at endpoint. Spans are POSTed to
+// endpoint/v1/traces unless endpoint already ends in that path.
+func NewOTLPExporter(endpoint string, headers map[string]string, timeout time.Duration, serviceName string) *OTLPExporter {
+	url := strings.TrimRight(endpoint, "/")
+	if url != "" && !strings.HasSuffix(url, otlpTracesPath) {
+		url += otlpTracesPath
+	}
+	return &OTLPExporter{
+		url:         url,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// ExportError reports a collector response other than success
+type ExportError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements the error interface
+func (e *ExportError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("collector returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("collector returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the collector asked to try again later, as the OTLP specification
+// allows for 429, 502, 503 and 504
+func (e *ExportError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Export sends spans in a single request
+func (e *OTLPExporter) Export(spans []*Span) error {
+	if e.url == "" || len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &ExportError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(message))}
+}
+
+// Shutdown releases idle connections
+func (e *OTLPExporter) Shutdown() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// --- OTLP/JSON encoding (opentelemetry-proto's JSON mapping) ---
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue holds exactly one of its fields; 64-bit integers are strings in the JSON mapping
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// encode converts spans into an export request
+func (e *OTLPExporter) encode(spans []*Span) otlpTraceRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, encodeSpan(span))
+	}
+
+	return otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpKeyValue{
+				{Key: AttrServiceName, Value: otlpValue(e.serviceName)},
+			}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/rama-kairi/go-term/internal/tracing"},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+// encodeSpan converts one span, reading it under its lock
+func encodeSpan(span *Span) otlpSpan {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	encoded := otlpSpan{
+		TraceID:           span.SpanContext.TraceID,
+		SpanID:            span.SpanContext.SpanID,
+		ParentSpanID:      span.SpanContext.ParentID,
+		Name:              span.Name,
+		Kind:              int(span.Kind) + 1, // OTLP reserves 0 for an unspecified kind
+		StartTimeUnixNano: unixNano(span.StartTime),
+		EndTimeUnixNano:   unixNano(span.EndTime),
+		Attributes:        otlpAttributes(span.Attributes),
+		Status:            otlpStatus{Code: int(span.Status), Message: span.StatusMsg},
+	}
+	for _, event := range span.Events {
+		encoded.Events = append(encoded.Events, otlpEvent{
+			TimeUnixNano: unixNano(event.Timestamp),
+			Name:         event.Name,
+			Attributes:   otlpAttributes(event.Attributes),
+		})
+	}
+	return encoded
+}
+
+// otlpAttributes converts span or event attributes
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	converted := make([]otlpKeyValue, len(attrs))
+	for i, attr := range attrs {
+		converted[i] = otlpKeyValue{Key: attr.Key, Value: otlpValue(attr.Value)}
+	}
+	return converted
+}
+
+// otlpValue converts an attribute value, falling back to its string form for other types
+func otlpValue(value interface{}) otlpAnyValue {
+	var intValue int64
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		intValue = int64(v)
+	case int32:
+		intValue = int64(v)
+	case int64:
+		intValue = v
+	case time.Duration:
+		intValue = int64(v)
+	case float32:
+		f := float64(v)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+	s := strconv.FormatInt(intValue, 10)
+	return otlpAnyValue{IntValue: &s}
+}
+
+// unixNano formats a timestamp as OTLP nanoseconds since the epoch, 0 for an unset time
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,248 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collector is a fake OTLP/HTTP collector recording every request it accepts
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpTraceRequest
+	headers  []http.Header
+	status   func(attempt int) int
+	attempts atomic.Int32
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempt := int(c.attempts.Add(1))
+	if c.status != nil {
+		if status := c.status(attempt); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	var req otlpTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var spans []otlpSpan
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestOTLPExporterPayload(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	tracer := NewTracer("test")
+	processor := NewBatchProcessor(
+		NewOTLPExporter(server.URL, map[string]string{"Authorization": "Bearer secret"}, time.Second, "go-term"),
+		BatchOptions{FlushInterval: time.Hour},
+	)
+	tracer.AddSpanProcessor(processor)
+
+	ctx, parent := tracer.StartSpan(context.Background(), "process_chain")
+	parent.SetAttribute("chain.process_count", 2)
+	for _, name := range []string{"db", "api"} {
+		_, child := tracer.StartSpan(ctx, "chain_process")
+		child.SetAttribute("process.name", name)
+		child.SetStatus(StatusOK, "ready")
+		child.End()
+	}
+	parent.SetStatus(StatusError, "process 1 failed")
+	parent.End()
+
+	if err := processor.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush failed: %v", err)
+	}
+
+	spans := c.spans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 exported spans, got %d", len(spans))
+	}
+	if got := c.headers[0].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected configured header, got %q", got)
+	}
+	if name := *c.requests[0].ResourceSpans[0].Resource.Attributes[0].Value.StringValue; name != "go-term" {
+		t.Errorf("Expected service name go-term, got %q", name)
+	}
+
+	root := spans[2]
+	if root.Name != "process_chain" || root.ParentSpanID != "" {
+		t.Fatalf("Expected the root span last without a parent, got %+v", root)
+	}
+	if root.Status.Code != int(StatusError) || root.Status.Message != "process 1 failed" {
+		t.Errorf("Unexpected root status: %+v", root.Status)
+	}
+	for _, attr := range root.Attributes {
+		if attr.Key == "chain.process_count" {
+			if v := attr.Value.IntValue; v == nil || *v != "2" {
+				t.Errorf("Expected integer attribute encoded as \"2\", got %+v", attr.Value)
+			}
+		}
+	}
+	for _, child := range spans[:2] {
+		if child.ParentSpanID != root.SpanID || child.TraceID != root.TraceID {
+			t.Errorf("Child span %+v is not linked to the chain span", child)
+		}
+		if child.Kind != 1 {
+			t.Errorf("Expected internal span kind 1, got %d", child.Kind)
+		}
+		if child.StartTimeUnixNano == "0" || child.EndTimeUnixNano == "0" {
+			t.Errorf("Expected span timestamps, got %s..%s", child.StartTimeUnixNano, child.EndTimeUnixNano)
+		}
+	}
+
+	// The in-memory buffer behind get_traces keeps every span too
+	if n := len(tracer.GetSpans()); n != 3 {
+		t.Errorf("Expected 3 buffered spans, got %d", n)
+	}
+	if stats := processor.Stats(); stats.Exported != 3 || stats.Failed != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if err := tracer.Shutdown(); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestBatchProcessorRetries(t *testing.T) {
+	t.Run("retries unavailable collector", func(t *testing.T) {
+		c := &collector{status: func(attempt int) int {
+			if attempt < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		}}
+		server := httptest.NewServer(c)
+		defer server.Close()
+
+		processor := NewBatchProcessor(NewOTLPExporter(server.URL, nil, time.Second, "go-term"), BatchOptions{
+			FlushInterval: time.Hour,
+			MaxRetries:    3,
+			RetryBackoff:  time.Millisecond,
+		})
+		defer processor.Shutdown()
+
+		tracer := NewTracer("test")
+		tracer.AddSpanProcessor(processor)
+		_, span := tracer.StartSpan(context.Background(), "run_command")
+		span.End()
+
+		if err := processor.ForceFlush(context.Background()); err != nil {
+			t.Fatalf("ForceFlush failed: %v", err)
+		}
+		if got := c.attempts.Load(); got != 3 {
+			t.Errorf("Expected 3 attempts, got %d", got)
+		}
+		if stats := processor.Stats(); stats.Exported != 1 || stats.Failed != 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("does not retry rejected batch", func(t *testing.T) {
+		c := &collector{status: func(int) int { return http.StatusBadRequest }}
+		server := httptest.NewServer(c)
+		defer server.Close()
+
+		var reported error
+		processor := NewBatchProcessor(NewOTLPExporter(server.URL, nil, time.Second, "go-term"), BatchOptions{
+			FlushInterval: time.Hour,
+			MaxRetries:    3,
+			RetryBackoff:  time.Millisecond,
+			OnError:       func(err error, spans int) { reported = err },
+		})
+		defer processor.Shutdown()
+
+		tracer := NewTracer("test")
+		tracer.AddSpanProcessor(processor)
+		_, span := tracer.StartSpan(context.Background(), "run_command")
+		span.End()
+
+		if err := processor.ForceFlush(context.Background()); err != nil {
+			t.Fatalf("ForceFlush failed: %v", err)
+		}
+		if got := c.attempts.Load(); got != 1 {
+			t.Errorf("Expected a single attempt, got %d", got)
+		}
+		if stats := processor.Stats(); stats.Failed != 1 {
+			t.Errorf("Expected 1 failed span, got %+v", stats)
+		}
+		if exportErr, ok := reported.(*ExportError); !ok || exportErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected a 400 ExportError, got %v", reported)
+		}
+	})
+}
+
+func TestBatchProcessorBatchSize(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	processor := NewBatchProcessor(NewOTLPExporter(server.URL+"/v1/traces", nil, time.Second, "go-term"), BatchOptions{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	tracer := NewTracer("test")
+	tracer.AddSpanProcessor(processor)
+	for i := 0; i < 5; i++ {
+		_, span := tracer.StartSpan(context.Background(), "run_command")
+		span.End()
+	}
+
+	// Shutdown drains the queue, so every span is exported in batches of at most 2
+	if err := processor.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if n := len(c.spans()); n != 5 {
+		t.Fatalf("Expected 5 exported spans, got %d", n)
+	}
+	for _, req := range c.requests {
+		if n := len(req.ResourceSpans[0].ScopeSpans[0].Spans); n > 2 {
+			t.Errorf("Expected batches of at most 2 spans, got %d", n)
+		}
+	}
+
+	// Spans ending after shutdown are dropped rather than queued
+	_, late := tracer.StartSpan(context.Background(), "late")
+	late.End()
+	if stats := processor.Stats(); stats.Dropped != 1 || stats.Queued != 0 {
+		t.Errorf("Expected the late span to be dropped, got %+v", stats)
+	}
+}
+
+func TestOTLPExporterWithoutEndpoint(t *testing.T) {
+	exporter := NewOTLPExporter("", nil, time.Second, "go-term")
+	tracer := NewTracer("test")
+	_, span := tracer.StartSpan(context.Background(), "run_command")
+	span.End()
+
+	if err := exporter.Export([]*Span{span}); err != nil {
+		t.Errorf("Expected a no-op export without an endpoint, got %v", err)
+	}
+}
@@ -132,6 +132,7 @@ type Span struct {
 	// Internal state
 	isEnded bool
 	mutex   sync.Mutex
+	tracer  *Tracer // Notified when the span ends; nil for spans created outside a tracer
 }
 
 // spanJSON is used for custom JSON marshaling
@@ -245,18 +246,21 @@ func (s *Span) SetStatus(code StatusCode, message string) *Span {
 	return s
 }
 
-// End ends the span
+// End ends the span and hands it to the tracer's span processors
 func (s *Span) End() {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
 	if s.isEnded {
+		s.mutex.Unlock()
 		return
 	}
-
 	s.EndTime = time.Now()
 	s.Duration = s.EndTime.Sub(s.StartTime)
 	s.isEnded = true
+	s.mutex.Unlock()
+
+	if s.tracer != nil {
+		s.tracer.spanEnded(s)
+	}
 }
 
 // TraceID returns the trace ID
@@ -294,6 +298,7 @@ type Tracer struct {
 	spans       []*Span
 	mutex       sync.RWMutex
 	exporters   []SpanExporter
+	processors  []SpanProcessor // Receive spans as they end, e.g. to export them in batches
 	maxSpans    int
 }
 
@@ -317,6 +322,7 @@ func NewTracer(serviceName string) *Tracer {
 func (t *Tracer) StartSpan(ctx context.Context, name string) (context.Context, *Span) {
 	span := NewChildSpan(ctx, name, SpanKindInternal)
 	span.SetAttribute("service.name", t.serviceName)
+	span.tracer = t
 
 	t.addSpan(span)
 
@@ -327,6 +333,7 @@ func (t *Tracer) StartSpan(ctx context.Context, name string) (context.Context, *
 func (t *Tracer) StartSpanWithKind(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
 	span := NewChildSpan(ctx, name, kind)
 	span.SetAttribute("service.name", t.serviceName)
+	span.tracer = t
 
 	t.addSpan(span)
 
@@ -377,6 +384,25 @@ func (t *Tracer) AddExporter(exporter SpanExporter) {
 	t.exporters = append(t.exporters, exporter)
 }
 
+// AddSpanProcessor registers a processor that receives every span started by this tracer when it ends
+func (t *Tracer) AddSpanProcessor(processor SpanProcessor) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.processors = append(t.processors, processor)
+}
+
+// spanEnded passes an ended span to the span processors
+func (t *Tracer) spanEnded(span *Span) {
+	t.mutex.RLock()
+	processors := make([]SpanProcessor, len(t.processors))
+	copy(processors, t.processors)
+	t.mutex.RUnlock()
+
+	for _, processor := range processors {
+		processor.OnEnd(span)
+	}
+}
+
 // Export exports all spans to registered exporters
 func (t *Tracer) Export() error {
 	t.mutex.RLock()
@@ -396,12 +422,24 @@ func (t *Tracer) Export() error {
 	return lastErr
 }
 
-// Shutdown shuts down the tracer and all exporters
+// Shutdown shuts down the tracer's span processors, which export the spans they still hold, and
+// all exporters
 func (t *Tracer) Shutdown() error {
 	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	processors := t.processors
+	t.processors = nil
+	t.mutex.Unlock()
 
 	var lastErr error
+	for _, processor := range processors {
+		if err := processor.Shutdown(); err != nil {
+			lastErr = err
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	for _, exporter := range t.exporters {
 		if err := exporter.Shutdown(); err != nil {
 			lastErr = err
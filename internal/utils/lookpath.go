@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrExecutableNotFound is returned by LookPathIn when no directory holds the executable
+var ErrExecutableNotFound = errors.New("executable file not found in PATH")
+
+// LookPathIn searches the directories of pathList, a PATH value, for an executable named name,
+// the way exec.LookPath searches the server's own PATH. It lets a session's PATH be checked
+// without changing the server's environment. A name containing a path separator is checked
+// directly. On Windows, names without an extension are tried with each PATHEXT extension.
+func LookPathIn(name, pathList string) (string, error) {
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) {
+		if found, ok := findExecutable(name); ok {
+			return found, nil
+		}
+		return "", ErrExecutableNotFound
+	}
+
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			// An empty entry means the current directory, which is never trusted for lookups
+			continue
+		}
+		if found, ok := findExecutable(filepath.Join(dir, name)); ok {
+			return found, nil
+		}
+	}
+	return "", ErrExecutableNotFound
+}
+
+// findExecutable returns the executable at path, trying PATHEXT extensions on Windows
+func findExecutable(path string) (string, bool) {
+	if runtime.GOOS != "windows" || filepath.Ext(path) != "" {
+		return path, isExecutableFile(path)
+	}
+
+	extensions := os.Getenv("PATHEXT")
+	if extensions == "" {
+		extensions = ".com;.exe;.bat;.cmd"
+	}
+	for _, ext := range strings.Split(extensions, ";") {
+		if ext == "" {
+			continue
+		}
+		if candidate := path + strings.ToLower(ext); isExecutableFile(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// isExecutableFile reports whether path is a regular file that may be executed. Windows has no
+// execute permission bit, so any file counts there.
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0o111 != 0
+}
@@ -33,6 +33,7 @@ type PackageManagerDetector struct {
 	cache    map[string]*cachedResult // M5: Cache by directory path
 	cacheTTL time.Duration            // M5: Cache time-to-live
 	mu       sync.RWMutex             // M5: Mutex for cache access
+	probe    probeCache               // Cached executable availability probe
 }
 
 // NewPackageManagerDetector creates a new package manager detector with caching (M5)
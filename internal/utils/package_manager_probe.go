@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// probeCacheTTL is how long executable probe results are reused before PATH is searched again
+	probeCacheTTL = 30 * time.Second
+	// versionProbeTimeout bounds each best-effort version query
+	versionProbeTimeout = 3 * time.Second
+)
+
+// extraProbeExecutables are package managers worth reporting that the detector does not
+// drive directly from lock files
+var extraProbeExecutables = []string{"pip", "pip3", "pipx", "deno", "gem", "bundle", "composer", "mvn", "gradle", "dotnet"}
+
+// versionArgs overrides the default --version flag for tools that do not support it
+var versionArgs = map[string][]string{
+	"go": {"version"},
+}
+
+// ExecutableStatus describes whether a package manager executable is installed on the host
+type ExecutableStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"` // First line of the version output, best effort
+}
+
+// probeCache holds the last executable probe so repeated queries do not re-run every version command
+type probeCache struct {
+	mu       sync.Mutex
+	results  []ExecutableStatus
+	probedAt time.Time
+}
+
+// ProbeExecutables reports which known package manager executables are on PATH, with their
+// versions. Results are cached for probeCacheTTL unless refresh is set.
+func (d *PackageManagerDetector) ProbeExecutables(ctx context.Context, refresh bool) ([]ExecutableStatus, time.Time) {
+	d.probe.mu.Lock()
+	defer d.probe.mu.Unlock()
+
+	if !refresh && d.probe.results != nil && time.Since(d.probe.probedAt) < probeCacheTTL {
+		return append([]ExecutableStatus(nil), d.probe.results...), d.probe.probedAt
+	}
+
+	names := d.probeNames()
+	results := make([]ExecutableStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = probeExecutable(ctx, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	d.probe.results = results
+	d.probe.probedAt = time.Now()
+	return append([]ExecutableStatus(nil), results...), d.probe.probedAt
+}
+
+// probeNames returns the detector's executables followed by the extra probes, without duplicates
+func (d *PackageManagerDetector) probeNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, manager := range d.managers {
+		if !seen[manager.ExecutableName] {
+			seen[manager.ExecutableName] = true
+			names = append(names, manager.ExecutableName)
+		}
+	}
+	for _, name := range extraProbeExecutables {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// probeExecutable looks name up on PATH and, if found, asks it for its version
+func probeExecutable(ctx context.Context, name string) ExecutableStatus {
+	status := ExecutableStatus{Name: name}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return status
+	}
+	status.Available = true
+	status.Path = path
+
+	args, ok := versionArgs[name]
+	if !ok {
+		args = []string{"--version"}
+	}
+	versionCtx, cancel := context.WithTimeout(ctx, versionProbeTimeout)
+	defer cancel()
+	// A failed version query still leaves the executable reported as available
+	if output, err := exec.CommandContext(versionCtx, path, args...).Output(); err == nil {
+		status.Version = firstLine(string(output))
+	}
+	return status
+}
+
+// firstLine returns the first non-empty line of text, trimmed
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
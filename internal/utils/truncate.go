@@ -0,0 +1,37 @@
+package utils
+
+import "unicode/utf8"
+
+// TruncateHead returns the first maxBytes bytes of s at most, cut back to a rune boundary so a
+// multi-byte character is never split
+func TruncateHead(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	if maxBytes <= 0 {
+		return ""
+	}
+
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// TruncateTail returns the last maxBytes bytes of s at most, starting on a rune boundary so a
+// multi-byte character is never split
+func TruncateTail(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	if maxBytes <= 0 {
+		return ""
+	}
+
+	start := len(s) - maxBytes
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 // TestProjectIDGenerator tests project ID generation functionality
@@ -767,3 +770,111 @@ edition = "2021"`), 0o644)
 		}
 	})
 }
+
+// TestProbeExecutables tests package manager availability probing and its cache
+func TestProbeExecutables(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script executables are not supported on Windows")
+	}
+
+	binDir := t.TempDir()
+	pnpm := filepath.Join(binDir, "pnpm")
+	if err := os.WriteFile(pnpm, []byte("#!/bin/sh\necho 9.1.0\n"), 0o755); err != nil {
+		t.Fatalf("Failed to create fake pnpm: %v", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	detector := NewPackageManagerDetector()
+	find := func(statuses []ExecutableStatus, name string) ExecutableStatus {
+		for _, status := range statuses {
+			if status.Name == name {
+				return status
+			}
+		}
+		t.Fatalf("%s missing from probe results", name)
+		return ExecutableStatus{}
+	}
+
+	statuses, probedAt := detector.ProbeExecutables(context.Background(), false)
+	if status := find(statuses, "pnpm"); !status.Available || status.Path != pnpm || status.Version != "9.1.0" {
+		t.Errorf("Expected pnpm 9.1.0 at %s, got %+v", pnpm, status)
+	}
+	if status := find(statuses, "npm"); status.Available {
+		t.Errorf("Expected npm to be unavailable, got %+v", status)
+	}
+	find(statuses, "pip")
+
+	// Removing the executable is not noticed until the cache is bypassed
+	if err := os.Remove(pnpm); err != nil {
+		t.Fatalf("Failed to remove fake pnpm: %v", err)
+	}
+	statuses, cachedAt := detector.ProbeExecutables(context.Background(), false)
+	if !cachedAt.Equal(probedAt) || !find(statuses, "pnpm").Available {
+		t.Error("Expected the cached probe result to be reused")
+	}
+	statuses, _ = detector.ProbeExecutables(context.Background(), true)
+	if find(statuses, "pnpm").Available {
+		t.Error("Expected a refreshed probe to report pnpm as unavailable")
+	}
+}
+
+func TestLookPathIn(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("execute permission bits are not used on Windows")
+	}
+
+	first, second := t.TempDir(), t.TempDir()
+	for _, dir := range []string{first, second} {
+		if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatalf("Failed to create fake tool: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(first, "notes"), []byte("not executable\n"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(first, "subdir"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	pathList := strings.Join([]string{filepath.Join(first, "missing"), first, second}, string(os.PathListSeparator))
+
+	if path, err := LookPathIn("tool", pathList); err != nil || path != filepath.Join(first, "tool") {
+		t.Errorf("Expected the first match on PATH, got %q (%v)", path, err)
+	}
+	for _, name := range []string{"notes", "subdir", "absent"} {
+		if _, err := LookPathIn(name, pathList); err != ErrExecutableNotFound {
+			t.Errorf("Expected %s not to be found, got %v", name, err)
+		}
+	}
+	if _, err := LookPathIn("tool", ""); err != ErrExecutableNotFound {
+		t.Errorf("Expected nothing to be found on an empty PATH, got %v", err)
+	}
+
+	direct := filepath.Join(second, "tool")
+	if path, err := LookPathIn(direct, ""); err != nil || path != direct {
+		t.Errorf("Expected a path to be checked directly, got %q (%v)", path, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := "héllo wörld" // é and ö are two bytes each
+
+	if got := TruncateHead(text, len(text)); got != text {
+		t.Errorf("Expected a short string to be kept, got %q", got)
+	}
+	if got := TruncateHead(text, 2); got != "h" {
+		t.Errorf("Expected the head to stop before a split é, got %q", got)
+	}
+	if got := TruncateTail(text, 4); got != "rld" {
+		t.Errorf("Expected the tail to start after a split ö, got %q", got)
+	}
+	if got := TruncateHead(text, 0); got != "" {
+		t.Errorf("Expected an empty head for a zero limit, got %q", got)
+	}
+
+	for limit := 0; limit <= len(text); limit++ {
+		head, tail := TruncateHead(text, limit), TruncateTail(text, limit)
+		if !utf8.ValidString(head) || len(head) > limit || !utf8.ValidString(tail) || len(tail) > limit {
+			t.Errorf("limit %d: got invalid or oversized head %q / tail %q", limit, head, tail)
+		}
+	}
+}
@@ -61,15 +61,16 @@ func main() {
 	var db *database.DB
 	if cfg.Database.Enable {
 		var err error
-		db, err = database.NewDB(cfg.Database.Path)
+		db, err = database.NewDBWithPool(cfg.Database.Path, cfg.Database.MaxConnections)
 		if err != nil {
 			log.Fatalf("Failed to initialize database: %v", err)
 		}
 		defer db.Close()
 
 		appLogger.Info("Database initialized successfully", map[string]interface{}{
-			"driver": cfg.Database.Driver,
-			"path":   cfg.Database.Path,
+			"driver":          cfg.Database.Driver,
+			"path":            cfg.Database.Path,
+			"max_connections": cfg.Database.MaxConnections,
 		})
 	}
 
@@ -82,6 +83,16 @@ func main() {
 		})
 	}
 
+	// Fail fast if commands are configured to run as a user the server cannot switch to
+	if cfg.Session.RunAsUser != "" {
+		if _, err := terminal.ResolveRunAsUser(cfg.Session.RunAsUser); err != nil {
+			log.Fatalf("Invalid run_as_user configuration: %v", err)
+		}
+		appLogger.Info("Commands will run as restricted user", map[string]interface{}{
+			"run_as_user": cfg.Session.RunAsUser,
+		})
+	}
+
 	// Create terminal session manager with enhanced features
 	terminalManager := terminal.NewManager(cfg, appLogger, db)
 
@@ -91,6 +102,12 @@ func main() {
 		if db != nil {
 			healthEndpoint.RegisterHealthCheck("database", db)
 		}
+		healthEndpoint.RegisterComponentCheck("goroutine_leak", monitoring.NewGoroutineLeakCheck(
+			terminalManager.GetResourceMonitor(),
+			cfg.Monitoring.GoroutineDegradedIncrease,
+			cfg.Monitoring.GoroutineUnhealthyIncrease,
+		))
+		healthEndpoint.RegisterComponentCheck("background_processes", monitoring.ComponentCheckFunc(terminalManager.CheckBackgroundProcessHealth))
 		if err := healthEndpoint.Start(); err != nil {
 			appLogger.Warn("Failed to start health endpoint", map[string]interface{}{
 				"error": err.Error(),
@@ -111,6 +128,27 @@ func main() {
 	// Create terminal tools with enhanced features
 	terminalTools := tools.NewTerminalTools(terminalManager, cfg, appLogger, db)
 
+	// Serve Prometheus metrics on their own port alongside the health endpoint
+	if cfg.Monitoring.EnableMetrics {
+		metricsEndpoint := monitoring.NewMetricsEndpoint(cfg.Monitoring.MetricsPort, terminalTools.ServerMetrics, terminalManager.GetResourceMonitor(), appLogger)
+		if err := metricsEndpoint.Start(); err != nil {
+			appLogger.Warn("Failed to start metrics endpoint", map[string]interface{}{
+				"error": err.Error(),
+				"port":  cfg.Monitoring.MetricsPort,
+			})
+		} else {
+			appLogger.Info("Metrics endpoint started", map[string]interface{}{
+				"port": cfg.Monitoring.MetricsPort,
+				"path": "/metrics",
+			})
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				metricsEndpoint.Stop(ctx)
+			}()
+		}
+	}
+
 	// Create MCP server
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    cfg.Server.Name,
@@ -136,6 +174,33 @@ func main() {
 					Type:        "string",
 					Description: "Optional: Starting directory for the session. Uses current directory if not specified.",
 				},
+				"security_policy": {
+					Type:        "object",
+					Description: "Optional: Session-level security policy fixed at creation. It can only tighten the global settings: blocked_commands are added to the global blocklist, and flags that would loosen them are rejected.",
+					Properties: map[string]*jsonschema.Schema{
+						"blocked_commands": {
+							Type:        "array",
+							Description: "Extra commands or patterns blocked in this session",
+							Items:       &jsonschema.Schema{Type: "string"},
+						},
+						"enable_sandbox": {
+							Type:        "boolean",
+							Description: "true runs the sandbox checks for this session even when the global sandbox is off",
+						},
+						"allow_network_access": {
+							Type:        "boolean",
+							Description: "false blocks network commands such as curl and ssh in this session",
+						},
+						"allow_filesystem_write": {
+							Type:        "boolean",
+							Description: "false blocks file system writes such as rm, mv and mkdir in this session",
+						},
+					},
+				},
+				"auto_create_dirs": {
+					Type:        "boolean",
+					Description: "Optional: Create missing directories (like mkdir -p) when a command cds into them, within the allowed working directories. By default a cd to a missing directory is refused before the command runs.",
+				},
 			},
 			Required: []string{"name"},
 		},
@@ -145,13 +210,110 @@ func main() {
 		},
 	}, terminalTools.CreateSession)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "clone_session",
+		Description: "Create a new terminal session set up like an existing one: same project, working directory, current directory, environment variables, shell options, command aliases and security policy, with a fresh ID and shell. Background processes and command history are not copied. Use to open a second shell for tests next to a running dev server.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"source_session_id": {
+					Type:        "string",
+					Description: "The session to clone. Get from list_terminal_sessions.",
+				},
+				"name": {
+					Type:        "string",
+					Description: "Optional: Name of the new session. Defaults to the source's name with a -copy suffix.",
+				},
+			},
+			Required: []string{"source_session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Clone Session",
+			ReadOnlyHint: false,
+		},
+	}, terminalTools.CloneSession)
+
+	// Register session relocation tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "relocate_session",
+		Description: "Move a session to a new working directory after its project was moved, keeping environment, aliases and history. The current directory keeps its relative place if that path exists in the new location. With restart_background and confirm, running background processes are restarted in the matching directory under the new one; processes that cannot be moved keep running and are listed in not_moved.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session to relocate. Get from list_terminal_sessions.",
+				},
+				"new_working_dir": {
+					Type:        "string",
+					Description: "Existing directory the project now lives in. Must be within allowed_working_dirs.",
+				},
+				"restart_background": {
+					Type:        "boolean",
+					Description: "Restart running background processes in the new location (requires confirm). Default: false",
+				},
+				"force": {
+					Type:        "boolean",
+					Description: "Kill background processes immediately instead of stopping them gracefully before the restart. Default: false",
+				},
+				"confirm": {
+					Type:        "boolean",
+					Description: "Must be true together with restart_background",
+				},
+			},
+			Required: []string{"session_id", "new_working_dir"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Relocate Session",
+			ReadOnlyHint: false,
+		},
+	}, terminalTools.RelocateSession)
+
+	// Register working directory validation tool (pre-check before session creation)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "validate_working_directory",
+		Description: "Check whether a directory is a good working directory before calling create_terminal_session. Verifies existence, that it is a directory, readability, and the configured working directory allowlist, and reports the detected project type and package manager.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"path": {
+					Type:        "string",
+					Description: "Directory path to validate. Relative paths are resolved against the server's current directory.",
+				},
+			},
+			Required: []string{"path"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Validate Working Directory",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.ValidateWorkingDirectory)
+
 	// Register list terminal sessions tool with enhanced information
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "list_terminal_sessions",
-		Description: "List all active terminal sessions with comprehensive status information including command statistics, background process counts, and project grouping. Essential for session management - use this to find available sessions for commands, check which sessions have running background processes, and monitor resource usage across projects.",
+		Description: "List all active terminal sessions with comprehensive status information including command statistics, background process counts, shell health, and project grouping. Essential for session management - use this to find available sessions for commands, check which sessions have running background processes, and monitor resource usage across projects. Optionally sort and filter by activity to find the busiest or most-failing sessions.",
 		InputSchema: &jsonschema.Schema{
-			Type:       "object",
-			Properties: map[string]*jsonschema.Schema{},
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"sort_by": {
+					Type:        "string",
+					Description: "Optional sort order: 'by_commands' (most commands first), 'by_failures' (most failures first), 'by_last_used' (most recent first) or 'by_idle' (longest idle first)",
+					Enum:        []any{"by_commands", "by_failures", "by_last_used", "by_idle"},
+				},
+				"active_only": {
+					Type:        "boolean",
+					Description: "Only include active sessions",
+				},
+				"has_background": {
+					Type:        "boolean",
+					Description: "Only include sessions with running background processes",
+				},
+				"min_commands": {
+					Type:        "integer",
+					Description: "Only include sessions with at least this many commands",
+				},
+			},
 		},
 		Annotations: &mcp.ToolAnnotations{
 			Title:        "List Terminal Sessions",
@@ -176,7 +338,41 @@ func main() {
 				},
 				"timeout": {
 					Type:        "integer",
-					Description: "Optional: Command timeout in seconds. Default: 60 seconds. Maximum: 300 seconds (5 minutes). Set to 0 to use default timeout.",
+					Description: "Optional: Command timeout in seconds. Default: 60 seconds. Maximum: 300 seconds (5 minutes). Set to 0 to use default timeout. With an idle timeout it caps the total run time instead and may go up to the server's command_max_timeout (30 minutes by default), which is then the default.",
+				},
+				"idle_timeout": {
+					Type:        "integer",
+					Description: "Optional: Stop the command once it has produced no output for this many seconds, however long it has been running, e.g. 60 for a slow build that keeps printing progress. timeout_reason then reports 'idle', or 'total' when the overall timeout stopped it. Default: the server's command_idle_timeout (off unless configured).",
+				},
+				"env": {
+					Type:                 "object",
+					AdditionalProperties: &jsonschema.Schema{Type: "string"},
+					Description:          "Optional: Extra environment variables for this command only (e.g. {\"FOO\": \"bar\"}). Merged on top of the session environment; the session itself is not modified.",
+				},
+				"stdin": {
+					Type:        "string",
+					Description: "Optional: Text written to the command's standard input, which is then closed. Use to answer prompts (e.g. \"y\\n\") or feed data to commands such as python, mysql or cat.",
+				},
+				"tags": {
+					Type:        "array",
+					Description: "Optional: Labels stored with the command in history, e.g. [\"deploy\", \"release\"]; search_history's tags filter finds commands carrying all given tags. Tools such as git, npm and docker are tagged automatically.",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
+				"dry_run": {
+					Type:        "boolean",
+					Description: "Optional: Validate the command and detect the package manager and project type without running it. Returns success and any validation_error; nothing is added to history and the session's command count is unchanged. Use to check whether a command needs rewording.",
+				},
+				"use_pty": {
+					Type:        "boolean",
+					Description: "Optional: Run the command attached to a pseudo-terminal so TTY-sensitive tools (colorized output, top, password prompts) behave as in a terminal. Stdout and stderr are merged into output, stdin is typed into the terminal, and the command runs in a fresh shell even with the persistent shell. Falls back to running without one, reporting pty_error, if none can be allocated.",
+				},
+				"max_output_bytes": {
+					Type:        "integer",
+					Description: "Optional: Maximum bytes of output to capture, e.g. 65536 for commands such as 'find /'. Beyond it the first and last halves are kept, joined by an '[output truncated, N bytes omitted]' line, the command still runs to completion and truncated is set. Default and maximum: the server's max_output_size (5MB by default).",
+				},
+				"allow_protected_dir": {
+					Type:        "boolean",
+					Description: "Optional: Run a destructive command (rm, mv, chmod, sed -i, output redirection into a file...) even though the session is in the server's installation or data directory or a protected path and security.server_dir_guard is block. Default: false.",
 				},
 			},
 			Required: []string{"session_id", "command"},
@@ -189,6 +385,103 @@ func main() {
 		},
 	}, terminalTools.RunCommand)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "run_command_in_sessions",
+		Description: "Run the same foreground command in several terminal sessions (listed by ID or every session of a project), e.g. 'git pull' across repositories. Each run goes through the normal validation and history; returns per-session results and aggregate success/failure counts.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_ids": {
+					Type:        "array",
+					Description: "Sessions to run the command in",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Run the command in every session of this project instead of listing session_ids",
+				},
+				"command": {
+					Type:        "string",
+					Description: "The command to run in each session",
+				},
+				"timeout": {
+					Type:        "integer",
+					Description: "Per-session timeout in seconds (default 60, max 300)",
+				},
+				"concurrency": {
+					Type:        "integer",
+					Description: "Number of sessions to run in at once (default 1 = sequential, capped by max_fan_out_concurrency)",
+				},
+				"stop_on_error": {
+					Type:        "boolean",
+					Description: "Skip the remaining sessions after the first failure (sequential runs only)",
+				},
+			},
+			Required: []string{"command"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Run Command In Multiple Sessions",
+			DestructiveHint: boolPtr(false),
+			OpenWorldHint:   boolPtr(true),
+		},
+	}, terminalTools.RunCommandInSessions)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "run_commands",
+		Description: "Run an ordered list of foreground commands in one session, e.g. 'npm ci', 'npm run build', 'npm test', in a single call. Each command goes through the normal validation and history, and a cd in one step carries over to the next. With stop_on_failure the commands after the first failure are skipped. The call counts once against the rate limit and may list at most max_sequence_commands (default 50) commands. Returns per-command results and overall success.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session to run the commands in",
+				},
+				"commands": {
+					Type:        "array",
+					Description: "Commands to run in order",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
+				"stop_on_failure": {
+					Type:        "boolean",
+					Description: "Skip the remaining commands after the first one that fails (nonzero exit or rejected)",
+				},
+				"timeout": {
+					Type:        "integer",
+					Description: "Per-command timeout in seconds (default 60, max 300)",
+				},
+			},
+			Required: []string{"session_id", "commands"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Run Commands In Sequence",
+			DestructiveHint: boolPtr(false),
+			OpenWorldHint:   boolPtr(true),
+		},
+	}, terminalTools.RunCommands)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_active_command_output",
+		Description: "Read the output captured so far for a session's foreground command while run_command is still waiting on it, e.g. to watch a slow build or test run. Reports whether the command is still running and, once finished, its exit code.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session ID the command is running in",
+				},
+				"tail_lines": {
+					Type:        "integer",
+					Description: "Optional: Return only the last N lines of the output captured so far",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Active Command Output",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetActiveCommandOutput)
+
 	// Register run background process tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "run_background_process",
@@ -204,6 +497,39 @@ func main() {
 					Type:        "string",
 					Description: "Long-running command to execute in background. Examples: 'npm start', 'python manage.py runserver', 'webpack --watch --mode development'. Command starts immediately and runs until manually terminated.",
 				},
+				"wait_for_pattern": {
+					Type:        "string",
+					Description: "Optional: Regular expression to wait for in the process output before returning, e.g. 'Listening on :3000|ready in'. Output printed before the wait started counts, so a fast server is never missed. Use it to start a dev server and run tests only once it is ready.",
+				},
+				"ready_pattern": {
+					Type:        "string",
+					Description: "Optional: Same as wait_for_pattern, kept for compatibility",
+				},
+				"ready_timeout": {
+					Type:        "integer",
+					Description: "Optional: Seconds to wait for wait_for_pattern (defaults to the configured readiness timeout, 30s unless changed)",
+				},
+				"auto_restart": {
+					Type:        "boolean",
+					Description: "Optional: Restart the process automatically when it exits with a non-zero code (only failures sooner than the configured restart_min_uptime, if set)",
+				},
+				"max_restarts": {
+					Type:        "integer",
+					Description: "Optional: Maximum automatic restarts (default 3, max 100). Requires auto_restart.",
+				},
+				"restart_backoff_seconds": {
+					Type:        "integer",
+					Description: "Optional: Seconds to wait before each restart (default 1). Requires auto_restart.",
+				},
+				"use_pty": {
+					Type:        "boolean",
+					Description: "Optional: Attach the process to a pseudo-terminal so TTY-sensitive tools behave as in a terminal. Stdout and stderr are merged into output; check_background_process reports pty_error if none could be allocated.",
+				},
+				"tags": {
+					Type:        "array",
+					Description: "Optional: Labels stored with the command in history, e.g. [\"deploy\", \"release\"]; search_history's tags filter finds commands carrying all given tags. Tools such as git, npm and docker are tagged automatically.",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
 			},
 			Required: []string{"session_id", "command"},
 		},
@@ -237,10 +563,32 @@ func main() {
 		},
 	}, terminalTools.ListBackgroundProcesses)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_background_process_stats",
+		Description: "Get a server-wide summary of background processes: running and completed counts across sessions and projects, the longest-running process, the output held in memory and how close each session is to max_background_processes. Use for a quick capacity view before starting more processes.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Optional: Only count processes of this session. Leave empty for the whole server.",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Optional: Only count processes of sessions in this project. Leave empty for the whole server.",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Background Process Stats",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetBackgroundProcessStats)
+
 	// Register terminate background process tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "terminate_background_process",
-		Description: "Stop and remove specific background processes by their process ID. Essential for resource management - use to terminate dev servers, build watchers, or stuck processes. Supports graceful termination (SIGTERM) or force kill (SIGKILL). Always terminate background processes when switching tasks or completing development work to free resources.",
+		Description: "Stop and remove specific background processes by their process ID. Essential for resource management - use to terminate dev servers, build watchers, or stuck processes. Supports graceful termination (SIGTERM) or force kill (SIGKILL). A process that survives SIGKILL (e.g. uninterruptible sleep on hung I/O) is reported as stuck with its process state, and the resource cleanup routine keeps trying to reap it. Always terminate background processes when switching tasks or completing development work to free resources.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
@@ -256,6 +604,15 @@ func main() {
 					Type:        "boolean",
 					Description: "Whether to force kill the process (SIGKILL) instead of graceful termination (SIGTERM). Use true for stuck processes. Default: false.",
 				},
+				"signals": {
+					Type:        "array",
+					Items:       &jsonschema.Schema{Type: "string"},
+					Description: "Optional ordered signal escalation for graceful termination, e.g. [\"SIGINT\", \"SIGTERM\", \"SIGKILL\"]. Use SIGINT first for dev servers that handle Ctrl-C. SIGKILL is always sent last if the process is still running. Default: [\"SIGTERM\", \"SIGKILL\"].",
+				},
+				"grace_seconds": {
+					Type:        "integer",
+					Description: "Seconds to wait for the process to exit after each signal. Default: 5.",
+				},
 			},
 			Required: []string{"session_id", "process_id"},
 		},
@@ -266,6 +623,68 @@ func main() {
 		},
 	}, terminalTools.TerminateBackgroundProcess)
 
+	// Register restart background process tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "restart_background_process",
+		Description: "Restart a background process, e.g. a crashed or stale dev server, without losing its process ID: terminates it (SIGTERM then SIGKILL, or SIGKILL at once with force) and relaunches the same command in the directory and with the environment it ran with. Output, exit code and start time start afresh. Returns the old and new PIDs.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session ID containing the background process",
+				},
+				"process_id": {
+					Type:        "string",
+					Description: "ID of the background process to restart; it keeps this ID",
+				},
+				"force": {
+					Type:        "boolean",
+					Description: "Force kill the old process instead of terminating it gracefully (default: false)",
+				},
+			},
+			Required: []string{"session_id", "process_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Restart Background Process",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.RestartBackgroundProcess)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "archive_background_process",
+		Description: "Archive a background process's current stdout and stderr to a file under the data directory, for processes that keep running but whose useful output is done. Optionally remove it from the active list while it keeps running (it is then no longer tracked or stopped with the session), or terminate it. Returns the archive path and whether the process is still running.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The UUID4 identifier of the session containing the background process",
+				},
+				"process_id": {
+					Type:        "string",
+					Description: "The UUID4 identifier of the background process to archive",
+				},
+				"remove": {
+					Type:        "boolean",
+					Description: "Remove the process from the active list while leaving it running. Default: false.",
+				},
+				"terminate": {
+					Type:        "boolean",
+					Description: "Terminate the process after archiving its output. Default: false.",
+				},
+				"force": {
+					Type:        "boolean",
+					Description: "With terminate, force kill (SIGKILL) instead of terminating gracefully",
+				},
+			},
+			Required: []string{"session_id", "process_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Archive Background Process",
+		},
+	}, terminalTools.ArchiveBackgroundProcess)
+
 	// Register search history tool for command discovery
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "search_terminal_history",
@@ -289,9 +708,17 @@ func main() {
 					Type:        "string",
 					Description: "Search for commands with output containing this text (case-insensitive). Useful for finding errors or specific output patterns.",
 				},
-				"success": {
-					Type:        "boolean",
-					Description: "Filter by command success status: true for successful commands, false for failed commands. Useful for debugging.",
+				"command_regex": {
+					Type:        "string",
+					Description: "Only return commands matching this Go regular expression, e.g. '^go (test|build)'. Results include the matched offsets in regex_matches.",
+				},
+				"output_regex": {
+					Type:        "string",
+					Description: "Only return commands whose output or error output matches this Go regular expression, e.g. '(?i)panic|fatal'. Regex searches examine at most the 5000 newest commands that pass the other filters.",
+				},
+				"success": {
+					Type:        "boolean",
+					Description: "Filter by command success status: true for successful commands, false for failed commands. Useful for debugging.",
 				},
 				"start_time": {
 					Type:        "string",
@@ -308,12 +735,16 @@ func main() {
 				"tags": {
 					Type:        "array",
 					Items:       &jsonschema.Schema{Type: "string"},
-					Description: "Filter by tags (commands must have all specified tags). Used for categorizing and filtering commands.",
+					Description: "Filter by tags (commands must have all specified tags, case-insensitive). Tags come from run_command/run_background_process and from automatic detection of tools such as git, npm and docker.",
 				},
 				"limit": {
 					Type:        "integer",
 					Description: "Maximum results to return (default: 100, max: 1000). Use smaller values for focused results.",
 				},
+				"offset": {
+					Type:        "integer",
+					Description: "Matching commands to skip for paging (default: 0, max: 10000). Pass offset + total_found while has_more is true. Not supported with command_regex or output_regex.",
+				},
 				"sort_by": {
 					Type:        "string",
 					Description: "Sort results by: 'time' (default), 'duration', or 'command'. Choose based on analysis needs.",
@@ -324,7 +755,19 @@ func main() {
 				},
 				"include_output": {
 					Type:        "boolean",
-					Description: "Include full command output in results (default: false). Warning: may return large amounts of data.",
+					Description: "Include full command output in results (default: false). Warning: may return large amounts of data; to read one command's output, pass its id to get_command_output instead.",
+				},
+				"fields": {
+					Type:        "array",
+					Description: "Optional: return only these fields of each command, in rows instead of results, to keep large scans small (e.g. ['command', 'success']). output and error_output also need include_output.",
+					Items: &jsonschema.Schema{
+						Type: "string",
+						Enum: []any{"id", "session_id", "project_id", "command", "output", "error_output", "success", "exit_code", "duration_ms", "working_dir", "timestamp", "tags", "regex_matches"},
+					},
+				},
+				"time_format": {
+					Type:        "string",
+					Description: "Timestamp format for results: 'rfc3339' (default), 'unix', 'unix_ms', or a Go time layout such as '2006-01-02 15:04:05'",
 				},
 			},
 		},
@@ -366,7 +809,7 @@ func main() {
 	// Register background process monitoring tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "check_background_process",
-		Description: "Monitor specific background processes to check their status, output, and health. Use to track development servers, build processes, and other long-running tasks started with run_background_process. Returns real-time status, output logs, error messages, and resource usage. Essential for debugging background processes and monitoring their health.",
+		Description: "Monitor specific background processes to check their status, output, and health. Use to track development servers, build processes, and other long-running tasks started with run_background_process. Returns real-time status, output logs, error messages, resource usage, and restart counts for auto-restarting processes. Essential for debugging background processes and monitoring their health.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
@@ -378,6 +821,22 @@ func main() {
 					Type:        "string",
 					Description: "Optional: Specific process ID to check. If not provided, checks the latest background process in the session. Get process IDs from list_background_processes.",
 				},
+				"head_lines": {
+					Type:        "integer",
+					Description: "Optional: Return only the first N lines of output and error output. Total line counts are still reported.",
+				},
+				"tail_lines": {
+					Type:        "integer",
+					Description: "Optional: Return only the last N lines of output and error output (e.g. 20 to see recent server logs). Cannot be combined with head_lines.",
+				},
+				"output_offset": {
+					Type:        "integer",
+					Description: "Optional: Return only output captured since this byte offset. Pass next_output_offset from the previous check to tail a process without re-reading output; output_gap_bytes reports output dropped by the output limit in between. Cannot be combined with head_lines or tail_lines.",
+				},
+				"error_output_offset": {
+					Type:        "integer",
+					Description: "Optional: Return only error output captured since this byte offset (next_error_output_offset from the previous check)",
+				},
 			},
 			Required: []string{"session_id"},
 		},
@@ -387,6 +846,42 @@ func main() {
 		},
 	}, terminalTools.CheckBackgroundProcess)
 
+	// Register background process wait tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "wait_for_background_process",
+		Description: "Block until a background process exits, instead of polling check_background_process. Returns the exit code and final output once the process has exited for good (auto-restarting processes are waited for until they stop restarting). If the process is still running when the timeout elapses, returns status \"still_running\" with the output so far rather than an error; call again to keep waiting.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session ID where the background process is running. Get from list_terminal_sessions.",
+				},
+				"process_id": {
+					Type:        "string",
+					Description: "Process ID of the background process to wait for. Get from run_background_process or list_background_processes.",
+				},
+				"timeout": {
+					Type:        "integer",
+					Description: "Optional: Seconds to wait before returning \"still_running\". Default: 60. Maximum: 300.",
+				},
+				"head_lines": {
+					Type:        "integer",
+					Description: "Optional: Return only the first N lines of output and error output. Total line counts are still reported.",
+				},
+				"tail_lines": {
+					Type:        "integer",
+					Description: "Optional: Return only the last N lines of output and error output. Cannot be combined with head_lines.",
+				},
+			},
+			Required: []string{"session_id", "process_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Wait For Background Process",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.WaitForBackgroundProcess)
+
 	// Register resource monitoring tools
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "get_resource_status",
@@ -448,6 +943,161 @@ func main() {
 		},
 	}, terminalTools.ForceCleanup)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_available_package_managers",
+		Description: "List which package manager executables (npm, yarn, pnpm, bun, go, cargo, uv, poetry, pip and others) are installed on the host, with their paths and versions. Check this before running a tool such as pnpm. Results are cached briefly; set refresh to probe again.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"refresh": {
+					Type:        "boolean",
+					Description: "Probe PATH again instead of using the briefly cached result",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "List Available Package Managers",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.ListAvailablePackageManagers)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_database_pool_stats",
+		Description: "Get database connection pool statistics: the configured maximum, open, in-use and idle connections, and how often and how long queries waited for a free connection. Use it to tune database.max_connections under load.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Database Pool Stats",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetDatabasePoolStats)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "cleanup_orphaned_records",
+		Description: "Find command history and stream chunk rows whose session no longer exists (left behind when a session was not deleted cleanly) and, with confirm, delete them to reclaim space and keep the database consistent.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"confirm": {
+					Type:        "boolean",
+					Description: "Delete the orphaned records; without it they are only counted",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Cleanup Orphaned Records",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.CleanupOrphanedRecords)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "checkpoint_wal",
+		Description: "Checkpoint the SQLite write-ahead log back into the database and truncate it (PRAGMA wal_checkpoint(TRUNCATE)), reporting the WAL size before and after and the frames checkpointed. Runs automatically every database.wal_checkpoint_interval; use it when the -wal file has grown under heavy write load.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Checkpoint WAL",
+		},
+	}, terminalTools.CheckpointWAL)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "preview_redaction",
+		Description: "Apply the secret redaction patterns to sample text without storing or logging it. Returns the redacted text and which patterns (secret_assignment, bearer_token, url_credentials, github_token, ...) matched at which byte offsets and lines, so redaction can be checked before relying on it. The patterns redact command output echoed to the log, logged commands, and secret-looking environment values in tool results; command history is stored as captured.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"text": {
+					Type:        "string",
+					Description: "Sample text to redact (max 1 MiB)",
+				},
+			},
+			Required: []string{"text"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Preview Redaction",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.PreviewRedaction)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "pause_cleanup",
+		Description: "Temporarily pause the automatic inactive-session and resource cleanup routines so a long bulk operation is not reaped mid-flight. Cleanup resumes on its own after the given duration (capped by max_cleanup_pause); call resume_cleanup when done.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"duration_seconds": {
+					Type:        "integer",
+					Description: "How long to pause cleanup, in seconds, before it resumes automatically",
+				},
+				"reason": {
+					Type:        "string",
+					Description: "Why cleanup is paused, recorded in the logs",
+				},
+			},
+			Required: []string{"duration_seconds"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Pause Automatic Cleanup",
+		},
+	}, terminalTools.PauseCleanup)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "resume_cleanup",
+		Description: "Resume the automatic cleanup routines after pause_cleanup, before the pause expires.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Resume Automatic Cleanup",
+		},
+	}, terminalTools.ResumeCleanup)
+
+	// H2: Register rate limit status tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_rate_limit_status",
+		Description: "Get current rate limit headroom: available tokens, configured rate and burst, and estimated time until the next call is allowed, for each session's limiter (category \"session:<id>\", or \"no_session\" for calls without one), each project limiter (\"project:<id>\") when per-project limits are enabled and the global limiter (\"global\") when a global limit is configured. Use this to pace tool calls proactively instead of reacting to rate limit errors.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Rate Limit Status",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetRateLimitStatus)
+
+	// Register execution overhead measurement tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "measure_execution_overhead",
+		Description: "Measure the fixed per-command overhead (shell spawn + teardown) of the fresh-shell execution model by timing a no-op command repeatedly. Optionally time a workload command too, to separate its work from the overhead. Reports mean, min, max and p50/p90/p99 in milliseconds. Runs are not recorded in history.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session to measure; runs use its working directory, environment and shell options",
+				},
+				"iterations": {
+					Type:        "integer",
+					Description: "Number of runs per measurement (default 10, max 100)",
+				},
+				"command": {
+					Type:        "string",
+					Description: "Optional workload command to time alongside the no-op",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Measure Execution Overhead",
+		},
+	}, terminalTools.MeasureExecutionOverhead)
+
 	// F1: Register command template tools
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "create_command_template",
@@ -469,7 +1119,7 @@ func main() {
 				},
 				"category": {
 					Type:        "string",
-					Description: "Optional category for organizing templates (e.g., 'docker', 'git', 'deployment')",
+					Description: "Optional category for organizing templates (e.g., 'docker', 'git', 'deployment'). When omitted it is inferred from the command, e.g. git, docker or nodejs for npm.",
 				},
 			},
 			Required: []string{"name", "command"},
@@ -521,16 +1171,142 @@ func main() {
 		},
 	}, terminalTools.ExpandCommandTemplate)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "update_command_template",
+		Description: "Edit an existing command template. Only the fields provided are changed; omitted fields keep their current values. The command cannot be set to an empty string.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"name": {
+					Type:        "string",
+					Description: "Name of the template to update",
+				},
+				"command": {
+					Type:        "string",
+					Description: "New command with optional {{variable}} placeholders (omit to keep the current one)",
+				},
+				"description": {
+					Type:        "string",
+					Description: "New description (omit to keep the current one)",
+				},
+				"category": {
+					Type:        "string",
+					Description: "New category (omit to keep the current one)",
+				},
+			},
+			Required: []string{"name"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Update Command Template",
+			ReadOnlyHint: false,
+		},
+	}, terminalTools.UpdateCommandTemplate)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "delete_command_template",
+		Description: "Delete a command template by name. Returns whether the template existed.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"name": {
+					Type:        "string",
+					Description: "Name of the template to delete",
+				},
+			},
+			Required: []string{"name"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Delete Command Template",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.DeleteCommandTemplate)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "import_command_templates",
+		Description: "Import command templates from a JSON file or an inline array, e.g. a template library shared across a team. Each template is validated; name conflicts are skipped, overwritten or renamed. Returns the outcome for every template.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"path": {
+					Type:        "string",
+					Description: "Path to a JSON file containing an array of templates (as written by export_command_templates)",
+				},
+				"templates": {
+					Type:        "array",
+					Description: "Inline array of templates to import instead of a file",
+					Items: &jsonschema.Schema{
+						Type: "object",
+						Properties: map[string]*jsonschema.Schema{
+							"name":        {Type: "string"},
+							"command":     {Type: "string"},
+							"description": {Type: "string"},
+							"category":    {Type: "string"},
+							"variables": {
+								Type:                 "object",
+								AdditionalProperties: &jsonschema.Schema{Type: "string"},
+							},
+							"tags": {
+								Type:  "array",
+								Items: &jsonschema.Schema{Type: "string"},
+							},
+						},
+						Required: []string{"name", "command"},
+					},
+				},
+				"on_conflict": {
+					Type:        "string",
+					Description: "What to do when a template name already exists: skip (default), overwrite or rename (adds a numeric suffix)",
+					Enum:        []any{"skip", "overwrite", "rename"},
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Import Command Templates",
+		},
+	}, terminalTools.ImportCommandTemplates)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_command_templates",
+		Description: "Export command templates as a JSON array that import_command_templates accepts, optionally writing them to a file to share.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"path": {
+					Type:        "string",
+					Description: "File to write the templates to (omit to return them inline only)",
+				},
+				"category": {
+					Type:        "string",
+					Description: "Only export templates in this category",
+				},
+				"names": {
+					Type:        "array",
+					Description: "Only export templates with these names",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Export Command Templates",
+			ReadOnlyHint: false,
+		},
+	}, terminalTools.ExportCommandTemplates)
+
 	// F6: Register output search tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "search_command_output",
-		Description: "Search through command outputs for specific patterns or text. Supports regex patterns and case-insensitive matching.",
+		Description: "Search through command outputs for specific patterns or text. Supports regex patterns and case-insensitive matching. Omit session_id to search the most recent commands of all sessions (optionally within one project); each match reports its session and project.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
 				"session_id": {
 					Type:        "string",
-					Description: "Session ID to search in",
+					Description: "Session ID to search in. Omit to search across all sessions.",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Optional: Only search commands from this project",
 				},
 				"pattern": {
 					Type:        "string",
@@ -550,10 +1326,15 @@ func main() {
 				},
 				"max_results": {
 					Type:        "integer",
-					Description: "Maximum number of results to return (default: 50)",
+					Description: "Maximum number of results to return (default: 100, max 1000 across sessions)",
+				},
+				"sort_by": {
+					Type:        "string",
+					Description: "Result order: recency (newest commands first, the default) or relevance (commands with the most matching lines first, newest first on ties)",
+					Enum:        []any{"recency", "relevance"},
 				},
 			},
-			Required: []string{"session_id", "pattern"},
+			Required: []string{"pattern"},
 		},
 		Annotations: &mcp.ToolAnnotations{
 			Title:        "Search Command Output",
@@ -591,7 +1372,7 @@ func main() {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "list_session_snapshots",
-		Description: "List all saved session snapshots.",
+		Description: "List saved session snapshots, optionally filtered by session, project, name, or creation time range. Returns both the filtered count and the total number of snapshots.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
@@ -599,6 +1380,27 @@ func main() {
 					Type:        "string",
 					Description: "Optional: filter by session ID",
 				},
+				"project_id": {
+					Type:        "string",
+					Description: "Optional: filter by project ID",
+				},
+				"name_contains": {
+					Type:        "string",
+					Description: "Optional: filter by case-insensitive name substring",
+				},
+				"created_after": {
+					Type:        "string",
+					Description: "Optional: only snapshots created at or after this RFC3339 time",
+				},
+				"created_before": {
+					Type:        "string",
+					Description: "Optional: only snapshots created at or before this RFC3339 time",
+				},
+				"sort": {
+					Type:        "string",
+					Description: "Sort by creation time: newest (default) or oldest",
+					Enum:        []any{"newest", "oldest"},
+				},
 			},
 		},
 		Annotations: &mcp.ToolAnnotations{
@@ -607,26 +1409,184 @@ func main() {
 		},
 	}, terminalTools.ListSessionSnapshots)
 
-	// F7: Register process chain tools
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "create_process_chain",
-		Description: "Create a chain of background processes that run in sequence with dependency management. Processes in the chain start one after another, optionally waiting for readiness signals.",
+		Name:        "restore_session_snapshot",
+		Description: "Restore a saved session snapshot: re-apply its environment variables (saved values overwrite existing ones) and working directory to an existing session, or to a new session when no target is given. Falls back to the home directory with a warning if the saved directory no longer exists. Returns the session ID and the list of applied changes.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
-				"session_id": {
+				"snapshot_id": {
 					Type:        "string",
-					Description: "Session ID to run processes in",
+					Description: "Snapshot ID or name to restore",
 				},
-				"name": {
+				"target_session_id": {
 					Type:        "string",
-					Description: "Name for the process chain",
+					Description: "Optional: existing session to restore into; a new session is created when omitted",
 				},
-				"description": {
+				"new_name": {
 					Type:        "string",
-					Description: "Description of what this chain does",
+					Description: "Optional: name for the new session (default: '<snapshot name>-restored')",
 				},
-				"processes": {
+			},
+			Required: []string{"snapshot_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Restore Session Snapshot",
+		},
+	}, terminalTools.RestoreSessionSnapshot)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_environment_drift_since",
+		Description: "Compare a session's current environment variables with those saved in a snapshot without restoring anything. Returns the variables added, removed, and changed since the snapshot; values that look like secrets are redacted.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"snapshot_id": {
+					Type:        "string",
+					Description: "Snapshot ID or name to compare against",
+				},
+				"session_id": {
+					Type:        "string",
+					Description: "Optional: session to compare (default: the session the snapshot was taken from)",
+				},
+			},
+			Required: []string{"snapshot_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Environment Drift Since Snapshot",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetEnvironmentDriftSince)
+
+	// Register workspace snapshot tools
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "save_workspace_snapshot",
+		Description: "Save every active session's metadata, environment, shell options, and working directory into a single workspace snapshot bundle.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"name": {
+					Type:        "string",
+					Description: "Name for the workspace snapshot",
+				},
+				"description": {
+					Type:        "string",
+					Description: "Optional description of what this workspace snapshot represents",
+				},
+			},
+			Required: []string{"name"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Save Workspace Snapshot",
+		},
+	}, terminalTools.SaveWorkspaceSnapshot)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "restore_workspace_snapshot",
+		Description: "Restore a workspace snapshot. Sessions that still exist are updated in place; missing sessions are recreated. Reports the outcome and any conflicts for each session.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"snapshot_id": {
+					Type:        "string",
+					Description: "Workspace snapshot ID or name to restore (default: most recent)",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Restore Workspace Snapshot",
+		},
+	}, terminalTools.RestoreWorkspaceSnapshot)
+
+	// Register the unified snapshot catalog over session and workspace snapshots
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_all_snapshots",
+		Description: "List session and workspace snapshots together, each with a type and the tool that restores it. Filter by type, session, project, name, or creation time range. Returns matching and stored counts per type.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"type": {
+					Type:        "string",
+					Description: "Optional: only snapshots of this type",
+					Enum:        []any{"session", "workspace"},
+				},
+				"session_id": {
+					Type:        "string",
+					Description: "Optional: filter by session ID (workspace snapshots holding the session match)",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Optional: filter by project ID (workspace snapshots with a session in the project match)",
+				},
+				"name_contains": {
+					Type:        "string",
+					Description: "Optional: filter by case-insensitive name substring",
+				},
+				"created_after": {
+					Type:        "string",
+					Description: "Optional: only snapshots created at or after this RFC3339 time",
+				},
+				"created_before": {
+					Type:        "string",
+					Description: "Optional: only snapshots created at or before this RFC3339 time",
+				},
+				"sort": {
+					Type:        "string",
+					Description: "Sort by creation time: newest (default) or oldest",
+					Enum:        []any{"newest", "oldest"},
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "List All Snapshots",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.ListAllSnapshots)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_snapshot",
+		Description: "Fetch a session or workspace snapshot by ID or name, with its full saved state and the tool that restores it.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"snapshot_id": {
+					Type:        "string",
+					Description: "Snapshot ID or name",
+				},
+				"type": {
+					Type:        "string",
+					Description: "Optional: snapshot type, needed only when a name is used by both a session and a workspace snapshot",
+					Enum:        []any{"session", "workspace"},
+				},
+			},
+			Required: []string{"snapshot_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Snapshot",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSnapshot)
+
+	// F7: Register process chain tools
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "create_process_chain",
+		Description: "Create a chain of background processes with dependency management. By default processes start one after another, optionally waiting for readiness signals. Give steps depends_on to form a graph instead: each step starts once the steps it names are ready, so independent steps (e.g. a database and a cache) start in parallel. Dependency cycles are rejected.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session ID to run processes in",
+				},
+				"name": {
+					Type:        "string",
+					Description: "Name for the process chain",
+				},
+				"description": {
+					Type:        "string",
+					Description: "Description of what this chain does",
+				},
+				"processes": {
 					Type:        "array",
 					Description: "List of processes to run in order. Each has: name, command, ready_pattern (optional), wait_seconds (optional)",
 					Items: &jsonschema.Schema{
@@ -642,12 +1602,21 @@ func main() {
 							},
 							"ready_pattern": {
 								Type:        "string",
-								Description: "Pattern in output indicating process is ready (optional)",
+								Description: "Regular expression in output indicating process is ready; the chain waits for it before continuing (optional)",
+							},
+							"ready_timeout": {
+								Type:        "integer",
+								Description: "Seconds to wait for ready_pattern (optional, defaults to the configured readiness timeout)",
 							},
 							"wait_seconds": {
 								Type:        "integer",
 								Description: "Seconds to wait after starting before proceeding to next process (optional)",
 							},
+							"depends_on": {
+								Type:        "array",
+								Description: "Names of the steps that must be ready before this one starts (optional). When no step sets it, each step waits for the one before it; when any does, step names must be unique.",
+								Items:       &jsonschema.Schema{Type: "string"},
+							},
 						},
 						Required: []string{"name", "command"},
 					},
@@ -682,7 +1651,7 @@ func main() {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "get_process_chain_status",
-		Description: "Get the current status of a process chain including status of each process in the chain.",
+		Description: "Get the current status of a process chain including status of each process in the chain. Pending processes list the dependencies they are still waiting on in blocked_on.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
@@ -699,6 +1668,72 @@ func main() {
 		},
 	}, terminalTools.GetProcessChainStatus)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_process_chain_graph",
+		Description: "Export a process chain as a dependency graph: one node per step with its command, readiness condition and current status, and an edge from each step to the steps that depend on it. Use format=dot for Graphviz DOT source. Use this to review a chain before starting it.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"chain_id": {
+					Type:        "string",
+					Description: "ID of the chain to export",
+				},
+				"format": {
+					Type:        "string",
+					Description: "Output format: json adjacency list (default) or dot, which adds Graphviz DOT source",
+					Enum:        []any{"json", "dot"},
+				},
+			},
+			Required: []string{"chain_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Process Chain Graph",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetProcessChainGraph)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "stop_process_chain",
+		Description: "Stop a process chain: steps that have not started are cancelled, and the background processes the chain started are terminated gracefully, dependents before the steps they depend on. Works while the chain is still starting up. Returns the processes terminated, those that had already exited and any that failed to stop.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"chain_id": {
+					Type:        "string",
+					Description: "ID of the chain to stop",
+				},
+			},
+			Required: []string{"chain_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Stop Process Chain",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.StopProcessChain)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "cancel_session_process_chains",
+		Description: "Cancel every process chain in a session at once and stop the background processes those chains started. Use this for bulk cleanup when abandoning a workflow.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session whose process chains should be cancelled",
+				},
+				"force": {
+					Type:        "boolean",
+					Description: "Kill started processes immediately instead of terminating gracefully (default: false)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Cancel Session Process Chains",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.CancelSessionProcessChains)
+
 	// Environment variable management tools (M4)
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "set_session_environment",
@@ -773,72 +1808,764 @@ func main() {
 		},
 	}, terminalTools.UnsetSessionEnvironment)
 
-	// M9: Session Activity Metrics tool
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "get_session_activity_metrics",
-		Description: "Get detailed activity metrics for terminal sessions including command counts, success rates, execution times, command type distribution, and error categories.",
+		Name:        "set_project_sessions_environment",
+		Description: "Set or update environment variables for every terminal session in a project at once, e.g. after changing a shared config value. Returns how many sessions were updated.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
-				"session_id": {
+				"project_id": {
 					Type:        "string",
-					Description: "Session ID to get metrics for. If not provided, returns metrics for all sessions.",
+					Description: "The project whose sessions should receive the variables",
+				},
+				"variables": {
+					Type:        "object",
+					Description: "Map of environment variable names to values",
+					AdditionalProperties: &jsonschema.Schema{
+						Type: "string",
+					},
 				},
 			},
+			Required: []string{"project_id", "variables"},
 		},
 		Annotations: &mcp.ToolAnnotations{
-			Title:        "Get Session Activity Metrics",
-			ReadOnlyHint: true,
+			Title: "Set Project Sessions Environment Variables",
 		},
-	}, terminalTools.GetSessionActivityMetrics)
+	}, terminalTools.SetProjectSessionsEnvironment)
 
-	// M10: Command Execution Tracing tool
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "get_traces",
-		Description: "Get OpenTelemetry-compatible trace spans for command execution. Useful for debugging and performance analysis.",
+		Name:        "append_session_environment_from_file",
+		Description: "Load environment variables into a terminal session from a dotenv (.env) file. Supports KEY=VALUE lines, single and double quotes, export prefixes and # comments; malformed lines are skipped with a warning. The file must be inside the session's current directory unless allow_absolute_env_files is enabled. Returns the keys set, not their values.",
 		InputSchema: &jsonschema.Schema{
 			Type: "object",
 			Properties: map[string]*jsonschema.Schema{
-				"limit": {
-					Type:        "integer",
-					Description: "Maximum number of spans to return (default: 100, max: 1000)",
+				"session_id": {
+					Type:        "string",
+					Description: "The session ID to set environment variables for",
 				},
-				"trace_id": {
+				"path": {
 					Type:        "string",
-					Description: "Filter by specific trace ID",
+					Description: "Path to the dotenv file, relative to the session's current directory (e.g. '.env' or 'config/.env.local')",
 				},
 			},
+			Required: []string{"session_id", "path"},
 		},
 		Annotations: &mcp.ToolAnnotations{
-			Title:        "Get Command Traces",
-			ReadOnlyHint: true,
+			Title: "Append Session Environment From File",
 		},
-	}, terminalTools.GetTraces)
+	}, terminalTools.AppendSessionEnvironmentFromFile)
 
-	appLogger.Info("Terminal MCP Server registered all tools successfully", map[string]interface{}{
-		"tools_count": 26,
-	})
-	appLogger.Info("Available tools:")
-	appLogger.Info("  - create_terminal_session: Create isolated terminal sessions for organized project work")
-	appLogger.Info("  - list_terminal_sessions: View all sessions with status and statistics")
-	appLogger.Info("  - run_command: Execute foreground commands with immediate output")
-	appLogger.Info("  - run_background_process: Start long-running processes in background")
-	appLogger.Info("  - list_background_processes: List all running background processes")
-	appLogger.Info("  - terminate_background_process: Stop specific background processes")
-	appLogger.Info("  - search_terminal_history: Find and analyze previous commands across projects")
-	appLogger.Info("  - delete_session: Clean up sessions individually or by project")
-	appLogger.Info("  - check_background_process: Monitor specific background processes")
-	appLogger.Info("  - get_resource_status: Monitor server resource usage and health")
-	appLogger.Info("  - check_resource_leaks: Detect and analyze potential resource leaks")
-	appLogger.Info("  - force_resource_cleanup: Perform aggressive resource cleanup when needed")
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "diagnose_environment",
+		Description: "Quick environment diagnostic for troubleshooting 'command not found' errors: the session's PATH entries (flagging missing or duplicate directories), its shell, whether git, node, npm, python3, python, go, make and docker are on the session's PATH, and the working directory's project type and package manager, with an issue when the project's toolchain is missing. Toolchain variables such as GOPATH and VIRTUAL_ENV are included with secrets redacted.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session whose environment to diagnose",
+				},
+				"tools": {
+					Type:        "array",
+					Description: "Optional: Extra executables to look for, e.g. ['cargo', 'pnpm'] (max 20)",
+					Items:       &jsonschema.Schema{Type: "string"},
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Diagnose Environment",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.DiagnoseEnvironment)
 
-	// Set up graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Shell option tools (set -o errexit, pipefail, ...)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_shell_options",
+		Description: "Get the shell options (set -o) enabled for a terminal session, plus the list of supported options.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session ID to get shell options for",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Shell Options",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetShellOptions)
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "set_shell_options",
+		Description: "Enable or disable shell options for a terminal session. Enabled options apply to all subsequent commands, e.g. enable errexit and pipefail so chained commands fail fast. Supported: errexit, nounset, pipefail, xtrace, noclobber, noglob, allexport.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session ID to set shell options for",
+				},
+				"enable": {
+					Type:        "array",
+					Items:       &jsonschema.Schema{Type: "string"},
+					Description: "Shell options to enable (set -o)",
+				},
+				"disable": {
+					Type:        "array",
+					Items:       &jsonschema.Schema{Type: "string"},
+					Description: "Shell options to disable (set +o)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Set Shell Options",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(false),
+		},
+	}, terminalTools.SetShellOptions)
+
+	// Command alias tools
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "set_command_alias",
+		Description: "Define, replace or remove a command alias in a terminal session, e.g. gs for 'git status'. run_command expands an alias at the start of a command (and aliases it expands to, up to 10 levels) before security validation, and reports the expansion in its alias field. An alias is never expanded twice for one command, so ls may alias 'ls -la'.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session to define the alias in",
+				},
+				"name": {
+					Type:        "string",
+					Description: "Alias name: a single word such as 'gs'",
+				},
+				"command": {
+					Type:        "string",
+					Description: "What the alias expands to, e.g. 'git status'; arguments after the alias are appended. Leave empty to remove the alias.",
+				},
+			},
+			Required: []string{"session_id", "name"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Set Command Alias",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(false),
+		},
+	}, terminalTools.SetCommandAlias)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_command_aliases",
+		Description: "List the command aliases defined in a terminal session with what each expands to.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session whose aliases to list",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "List Command Aliases",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.ListCommandAliases)
+
+	// M9: Session Activity Metrics tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_session_activity_metrics",
+		Description: "Get detailed activity metrics for terminal sessions including command counts, success rates, execution times, command type distribution, and error categories.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session ID to get metrics for. If not provided, returns metrics for all sessions.",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Session Activity Metrics",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSessionActivityMetrics)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_activity_metrics",
+		Description: "Append a snapshot of every session's activity metrics as JSON lines to the configured activity_metrics_file, the same file the periodic export writes to. The file is rotated once it exceeds activity_metrics_max_size_mb. Fails when activity_metrics_file is not set.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title: "Export Activity Metrics",
+		},
+	}, terminalTools.ExportActivityMetrics)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_success_rate_trend",
+		Description: "Show how the command success rate changes over time. Buckets command history into hourly or daily windows and returns the success rate per bucket as an ordered series, whether the rate is improving, degrading or stable, and buckets where it dropped sharply (e.g. a dependency change breaking builds).",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Optional: Only include commands from this session",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Optional: Only include commands from this project",
+				},
+				"interval": {
+					Type:        "string",
+					Description: "Bucket size (default daily)",
+					Enum:        []any{"hourly", "daily"},
+				},
+				"periods": {
+					Type:        "integer",
+					Description: "Number of buckets to look back. Default: 24 for hourly, 14 for daily. Maximum: 720.",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Success Rate Trend",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSuccessRateTrend)
+
+	// Register session handoff report tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_session_report",
+		Description: "Summarize what a session has accomplished for handoff or auditing. Returns deterministic structured fields: duration, command counts and success rate, commands grouped by type, top commands, key successes (longest-running) and failures (most recent), directories touched, error categories and background processes started.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session to summarize",
+				},
+				"history_limit": {
+					Type:        "integer",
+					Description: "Maximum number of recent history entries to analyze (default 500, max 5000)",
+				},
+				"top_n": {
+					Type:        "integer",
+					Description: "Number of entries in top commands, key successes and key failures (default 5, max 50)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Session Report",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSessionReport)
+
+	// Register manager diagnostics tool (debug mode only)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_manager_diagnostics",
+		Description: "Debug view of the server's internal state: session and background process counts, goroutine count, cleanup routine status, the latest resource monitor sample and rate limiter tokens. Read-only and only available when the server runs in debug mode.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Manager Diagnostics",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetManagerDiagnostics)
+
+	// Register resource pressure simulation tool (debug mode only)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "simulate_resource_pressure",
+		Description: "Temporarily start idle goroutines, allocate memory and create dummy sessions and background processes to verify that leak detection and cleanup behave as configured, then release everything and report metrics before, during and after. Only available in debug mode and requires confirm=true.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"confirm": {
+					Type:        "boolean",
+					Description: "Must be true to confirm the simulation, which deliberately consumes server resources. Required safety measure.",
+				},
+				"goroutines": {
+					Type:        "integer",
+					Description: "Number of idle goroutines to start (max 10000).",
+				},
+				"memory_mb": {
+					Type:        "integer",
+					Description: "Megabytes of memory to allocate and hold (max 1024).",
+				},
+				"sessions": {
+					Type:        "integer",
+					Description: "Number of dummy sessions to create (max 20). Subject to max_sessions.",
+				},
+				"background_processes": {
+					Type:        "integer",
+					Description: "Number of idle background processes to start across the dummy sessions (max 20). A dummy session is created if none were requested.",
+				},
+				"hold_seconds": {
+					Type:        "integer",
+					Description: "How long to hold the pressure before releasing it (max 60). Default: 0.",
+				},
+				"run_cleanup": {
+					Type:        "boolean",
+					Description: "Run one pass of the session and resource cleanup routines while the pressure is applied. Skipped while cleanup is paused.",
+				},
+			},
+			Required: []string{"confirm"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Simulate Resource Pressure",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.SimulateResourcePressure)
+
+	// Register in-memory recent commands tool (works without the database)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_session_recent_commands",
+		Description: "Read a session's most recent commands with their output and exit codes from an in-memory buffer, newest first. Works even when the history database is disabled; the buffer is bounded by recent_commands_limit and recent_commands_max_bytes.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session whose recent commands to return",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum number of commands to return, newest first (default: all buffered)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Session Recent Commands",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSessionRecentCommands)
+
+	// Register session-scoped kill-by-PID tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "kill_process_by_pid",
+		Description: "Signal a process by OS PID when it escaped tracking (e.g. a server spawned by a background script). The PID must descend from the session's shell or one of its running background processes; anything else, including tracked processes themselves, is refused.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session whose process tree must contain the PID",
+				},
+				"pid": {
+					Type:        "integer",
+					Description: "OS process ID to signal",
+				},
+				"signal": {
+					Type:        "string",
+					Description: "Signal to send (default SIGTERM)",
+					Enum:        []any{"SIGTERM", "SIGINT", "SIGHUP", "SIGQUIT", "SIGKILL"},
+				},
+			},
+			Required: []string{"session_id", "pid"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Kill Process By PID",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.KillProcessByPID)
+
+	// Register blocked command history tools
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_blocked_command_history",
+		Description: "List recent command attempts blocked by the security policy (command, source tool, rule type, matched rule, reason, timestamp, session), newest first, with counts per rule type. History is kept in the database so it survives restarts; use it to spot legitimate commands that the block lists reject.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Only return attempts from this session (default: all sessions)",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum number of attempts to return (default: 50, max: 500)",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Blocked Command History",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetBlockedCommandHistory)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "clear_blocked_history",
+		Description: "Delete recorded blocked command attempts, for one session or all sessions.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Only clear attempts from this session (default: clear all)",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Clear Blocked History",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.ClearBlockedHistory)
+
+	// Register session lifecycle event tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_session_events",
+		Description: "List recorded session lifecycle events (created, closed, cleaned_up) with timestamps and reasons such as inactive_timeout, max_sessions_exceeded, project_deleted or server_shutdown, newest first, with counts per event. Events are kept in the database for the configured retention; use them to find out why a session disappeared.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Only return events of this session",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Only return events of sessions in this project",
+				},
+				"event": {
+					Type:        "string",
+					Description: "Only return this event",
+					Enum:        []any{"created", "closed", "cleaned_up", "relocated"},
+				},
+				"reason": {
+					Type:        "string",
+					Description: "Only return events with this reason, e.g. inactive_timeout",
+				},
+				"start_time": {
+					Type:        "string",
+					Description: "Only return events at or after this time (RFC3339, e.g. 2025-01-01T00:00:00Z)",
+				},
+				"end_time": {
+					Type:        "string",
+					Description: "Only return events at or before this time (RFC3339)",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum number of events to return (default: 50, max: 500)",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Session Events",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetSessionEvents)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "diff_security_policy",
+		Description: "Compare the security policy the server is enforcing with the one in its config file: blocked/allowed commands and allowed working directories added or removed, and changed flags such as allow_network_access. Optionally write the runtime policy back to the file (requires confirm) so it survives a restart.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"persist": {
+					Type:        "boolean",
+					Description: "Write the runtime security policy back to the config file (default: false)",
+				},
+				"confirm": {
+					Type:        "boolean",
+					Description: "Must be true together with persist to overwrite the config file",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Diff Security Policy",
+			DestructiveHint: boolPtr(true),
+		},
+	}, terminalTools.DiffSecurityPolicy)
+
+	// Register session shell health tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "check_session_health",
+		Description: "Check whether a session's backing shell process is alive and its pipes are open, so broken sessions surface before a command fails confusingly. Set restart_shell to replace an unhealthy shell with a fresh one in the session's current directory.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "The session ID to check",
+				},
+				"restart_shell": {
+					Type:        "boolean",
+					Description: "Restart the shell if it is unhealthy (default: false)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Check Session Health",
+			ReadOnlyHint: false,
+		},
+	}, terminalTools.CheckSessionHealth)
+
+	// M10: Command Execution Tracing tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_traces",
+		Description: "Get OpenTelemetry-compatible trace spans for command execution. Useful for debugging and performance analysis.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum number of spans to return (default: 100, max: 1000)",
+				},
+				"trace_id": {
+					Type:        "string",
+					Description: "Filter by specific trace ID",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Command Traces",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetTraces)
+
+	// Register follow history tool for real-time command history (long-poll)
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "follow_command_history",
+		Description: "Follow command history in near real time. Returns commands recorded after the 'since' cursor, blocking briefly (up to wait_seconds) until new commands arrive. Pass the returned next_cursor as 'since' on the next call to keep following.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Only follow commands from this session. Leave empty to follow all sessions.",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Only follow commands from this project. Leave empty to follow all projects.",
+				},
+				"since": {
+					Type:        "integer",
+					Description: "Cursor from a previous call's next_cursor. Omit or 0 to start from the latest recorded command.",
+				},
+				"wait_seconds": {
+					Type:        "integer",
+					Description: "Maximum seconds to block waiting for new commands (default: 10, max: 30)",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Maximum number of commands to return (default: 100, max: 1000)",
+				},
+				"time_format": {
+					Type:        "string",
+					Description: "Timestamp format for results: 'rfc3339' (default), 'unix', 'unix_ms', or a Go time layout such as '2006-01-02 15:04:05'",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Follow Command History",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.FollowHistory)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_command_output",
+		Description: "Fetch one command from history by ID with its complete, untruncated output, working directory and duration. Search with search_terminal_history (output omitted by default) to find the command cheaply, then pass its id here.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"command_id": {
+					Type:        "string",
+					Description: "Command ID from run_command's command_id or the id field of search_terminal_history or follow_command_history results",
+				},
+				"time_format": {
+					Type:        "string",
+					Description: "Timestamp format: 'rfc3339' (default), 'unix', 'unix_ms', or a Go time layout such as '2006-01-02 15:04:05'",
+				},
+			},
+			Required: []string{"command_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Command Output",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetCommandByID)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_command_stream",
+		Description: "Replay a command's output as the stream chunks recorded while it ran (stdout and stderr in the order produced, then a status chunk with the exit code). Chunks are saved when the command finishes; use get_active_command_output to watch a command that is still running. Pass last_sequence back as after_sequence to page through a long stream. Requires enable_streaming and the database.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"command_id": {
+					Type:        "string",
+					Description: "Command ID from run_command's command_id or get_active_command_output",
+				},
+				"after_sequence": {
+					Type:        "integer",
+					Description: "Optional: Only return chunks after this sequence number (the previous call's last_sequence)",
+				},
+			},
+			Required: []string{"command_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:        "Get Command Stream",
+			ReadOnlyHint: true,
+		},
+	}, terminalTools.GetCommandStream)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_history_as_script",
+		Description: "Turn recorded command history into a runnable bash script (shebang, set -e, and a cd wherever the working directory changes) that replays the commands oldest first, so work done in a session can be reproduced without the server. Returns the script and optionally writes it to an executable file. Requires the database.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Only export commands from this session. session_id or project_id is required.",
+				},
+				"project_id": {
+					Type:        "string",
+					Description: "Only export commands from this project",
+				},
+				"successful_only": {
+					Type:        "boolean",
+					Description: "Optional: Leave out commands that failed. Otherwise failed commands are kept, marked with a comment and followed by '|| true' so the script runs past them.",
+				},
+				"include_timestamps": {
+					Type:        "boolean",
+					Description: "Optional: Precede each command with a comment giving when it ran",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Optional: Export at most this many of the most recent matching commands (default and maximum: 1000)",
+				},
+				"path": {
+					Type:        "string",
+					Description: "Optional: File to write the script to, with execute permission. The script is returned either way.",
+				},
+			},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Export History as Script",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(false),
+		},
+	}, terminalTools.ExportHistoryAsScript)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_session_history",
+		Description: "Write a session's recorded command history, oldest first, to a JSON, CSV or Markdown table file for reporting and sharing. Each row has the command, success, exit code, duration, timestamp and working directory, and optionally the output. Returns the file path and row count. Requires the database.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"session_id": {
+					Type:        "string",
+					Description: "Session whose command history is exported",
+				},
+				"format": {
+					Type:        "string",
+					Description: "Optional: File format (default: json)",
+					Enum:        []any{"json", "csv", "markdown"},
+				},
+				"include_output": {
+					Type:        "boolean",
+					Description: "Optional: Add output and error_output columns",
+				},
+				"limit": {
+					Type:        "integer",
+					Description: "Optional: Export at most this many of the most recent commands (default and maximum: 1000)",
+				},
+				"path": {
+					Type:        "string",
+					Description: "Optional: File to write (default: exports/<session_id>/history-<time>.<ext> under the data directory)",
+				},
+			},
+			Required: []string{"session_id"},
+		},
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Export Session History",
+			ReadOnlyHint:    false,
+			DestructiveHint: boolPtr(false),
+		},
+	}, terminalTools.ExportSessionHistory)
+
+	appLogger.Info("Terminal MCP Server registered all tools successfully", map[string]interface{}{
+		"tools_count": 82,
+	})
+	appLogger.Info("Available tools:")
+	appLogger.Info("  - create_terminal_session: Create isolated terminal sessions for organized project work")
+	appLogger.Info("  - validate_working_directory: Pre-check a directory before creating a session")
+	appLogger.Info("  - list_terminal_sessions: View all sessions with status and statistics")
+	appLogger.Info("  - run_command: Execute foreground commands with immediate output")
+	appLogger.Info("  - run_command_in_sessions: Run one command across several sessions or a whole project")
+	appLogger.Info("  - get_active_command_output: Read a running foreground command's output so far")
+	appLogger.Info("  - run_background_process: Start long-running processes in background")
+	appLogger.Info("  - list_background_processes: List all running background processes")
+	appLogger.Info("  - terminate_background_process: Stop specific background processes")
+	appLogger.Info("  - restart_background_process: Relaunch a background process under the same ID")
+	appLogger.Info("  - archive_background_process: Save a background process's output and stop watching it")
+	appLogger.Info("  - search_terminal_history: Find and analyze previous commands across projects")
+	appLogger.Info("  - follow_command_history: Follow newly recorded commands in real time")
+	appLogger.Info("  - get_command_output: Fetch one command from history with its full output")
+	appLogger.Info("  - get_command_stream: Replay a command's recorded output stream chunks in order")
+	appLogger.Info("  - export_history_as_script: Export recorded commands as a runnable shell script")
+	appLogger.Info("  - delete_session: Clean up sessions individually or by project")
+	appLogger.Info("  - check_background_process: Monitor specific background processes")
+	appLogger.Info("  - wait_for_background_process: Block until a background process exits")
+	appLogger.Info("  - get_resource_status: Monitor server resource usage and health")
+	appLogger.Info("  - check_resource_leaks: Detect and analyze potential resource leaks")
+	appLogger.Info("  - force_resource_cleanup: Perform aggressive resource cleanup when needed")
+	appLogger.Info("  - list_available_package_managers: Check which package managers are installed on the host")
+	appLogger.Info("  - get_database_pool_stats: Monitor database connection pool usage")
+	appLogger.Info("  - cleanup_orphaned_records: Delete history rows of sessions that no longer exist")
+	appLogger.Info("  - checkpoint_wal: Checkpoint and truncate the SQLite write-ahead log")
+	appLogger.Info("  - pause_cleanup / resume_cleanup: Suspend automatic cleanup during bulk operations")
+	appLogger.Info("  - get_rate_limit_status: Check rate limit headroom before making calls")
+	appLogger.Info("  - measure_execution_overhead: Quantify per-command shell spawn overhead")
+	appLogger.Info("  - restore_session_snapshot: Re-apply a saved session snapshot to a new or existing session")
+	appLogger.Info("  - get_environment_drift_since: Show environment variables added, removed, or changed since a snapshot")
+	appLogger.Info("  - save_workspace_snapshot / restore_workspace_snapshot: Checkpoint and restore all sessions at once")
+	appLogger.Info("  - cancel_session_process_chains: Cancel all process chains in a session")
+	appLogger.Info("  - get_process_chain_graph: Export a process chain's steps as a JSON or DOT dependency graph")
+	appLogger.Info("  - get_success_rate_trend: Track command success rate over hourly or daily windows")
+	appLogger.Info("  - get_session_report: Summarize a session's work for handoff and auditing")
+	appLogger.Info("  - export_activity_metrics: Append session activity metrics to the configured JSON lines file")
+	appLogger.Info("  - get_manager_diagnostics: Inspect internal server state (debug mode only)")
+	appLogger.Info("  - simulate_resource_pressure: Exercise leak detection and cleanup with temporary load (debug mode only)")
+	appLogger.Info("  - get_session_recent_commands: Recent commands and output without the database")
+	appLogger.Info("  - kill_process_by_pid: Kill an untracked descendant of a session's processes")
+	appLogger.Info("  - get_blocked_command_history: Review commands rejected by the security policy")
+	appLogger.Info("  - clear_blocked_history: Clear recorded blocked command attempts")
+	appLogger.Info("  - get_session_events: Review when and why sessions were created, closed or cleaned up")
+	appLogger.Info("  - diff_security_policy: Compare the runtime security policy with the config file")
+	appLogger.Info("  - check_session_health: Verify a session's shell is alive and optionally restart it")
+	appLogger.Info("  - set_project_sessions_environment: Set environment variables on all sessions in a project")
+	appLogger.Info("  - append_session_environment_from_file: Load session environment variables from a .env file")
+	appLogger.Info("  - diagnose_environment: Check a session's PATH, shell and common tools")
+	appLogger.Info("  - update_command_template / delete_command_template: Edit or remove command templates")
+	appLogger.Info("  - import_command_templates / export_command_templates: Share command template libraries as JSON")
+	appLogger.Info("  - set_command_alias / list_command_aliases: Manage per-session command aliases expanded by run_command")
+	appLogger.Info("  - get_background_process_stats: Summarize background processes and per-session capacity")
+	appLogger.Info("  - clone_session: Open a new session with another session's directory and environment")
+	appLogger.Info("  - list_all_snapshots / get_snapshot: Browse and fetch session and workspace snapshots in one place")
+	appLogger.Info("  - preview_redaction: Show how secret redaction would treat sample text")
+	appLogger.Info("  - export_session_history: Write a session's command history to a JSON, CSV or Markdown file")
+	appLogger.Info("  - relocate_session: Move a session to a new working directory, optionally restarting its background processes")
+	appLogger.Info("  - run_commands: Run a sequence of commands in one session, optionally stopping at the first failure")
+	appLogger.Info("  - stop_process_chain: Stop a process chain, terminating its processes dependents first")
+
+	// Set up graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		<-sigChan
@@ -847,6 +2574,9 @@ func main() {
 		// Shutdown terminal manager (this will close all sessions)
 		terminalManager.Shutdown()
 
+		// Export spans still waiting for the OTLP collector
+		terminalTools.Shutdown()
+
 		cancel()
 	}()
 
@@ -867,5 +2597,6 @@ func main() {
 		os.Exit(1)
 	}
 
+	terminalTools.Shutdown()
 	appLogger.Info("Terminal MCP Server shutdown completed")
 }